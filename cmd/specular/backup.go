@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/elisiariocouto/specular/pkg/config"
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+// runBackup implements `specular backup`
+func runBackup(args []string) int {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	output := flags.String("o", "-", "file to write the backup to, - for stdout")
+	archives := flags.Bool("archives", false, "include provider archives, not only metadata")
+	since := flags.String("since", "", "only back up files changed after an RFC 3339 time or the creation of a previous backup file")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: specular backup [-archives] [-since time|backup] [-o file]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	fs, err := openCache()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "backup: %v\n", err)
+		return 1
+	}
+
+	opts := storage.BackupOptions{Archives: *archives}
+	if *since != "" {
+		if opts.Since, err = parseSince(*since); err != nil {
+			fmt.Fprintf(os.Stderr, "backup: %v\n", err)
+			return 1
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	var tmpPath string
+	if *output != "-" {
+		// Written next to the destination and renamed, so a failed backup never replaces a good one
+		f, err := os.CreateTemp(filepath.Dir(*output), ".tmp-backup-")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "backup: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		defer os.Remove(f.Name())
+		w, tmpPath = f, f.Name()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	manifest, err := fs.Backup(ctx, w, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "backup: %v\n", err)
+		return 1
+	}
+	if tmpPath != "" {
+		if err := w.(*os.File).Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "backup: %v\n", err)
+			return 1
+		}
+		if err := os.Rename(tmpPath, *output); err != nil {
+			fmt.Fprintf(os.Stderr, "backup: %v\n", err)
+			return 1
+		}
+	}
+	fmt.Fprintf(os.Stderr, "backed up %d files (%d bytes) at %s\n", manifest.Files, manifest.Bytes, manifest.CreatedAt.Format(time.RFC3339))
+	return 0
+}
+
+// runRestore implements `specular restore`
+func runRestore(args []string) int {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: specular restore [backup...]")
+		fmt.Fprintln(flags.Output(), "Backups are applied in order, list a full backup followed by its incremental backups. Reads stdin when none is given.")
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	fs, err := openCache()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "restore: %v\n", err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	restore := func(name string, r io.Reader) error {
+		manifest, err := fs.Restore(ctx, r)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		fmt.Fprintf(os.Stderr, "restored %d files from %s, taken at %s\n", manifest.Files, name, manifest.CreatedAt.Format(time.RFC3339))
+		return nil
+	}
+
+	if flags.NArg() == 0 {
+		if err := restore("stdin", os.Stdin); err != nil {
+			fmt.Fprintf(os.Stderr, "restore: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	for _, name := range flags.Args() {
+		f, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "restore: %v\n", err)
+			return 1
+		}
+		err = restore(name, f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "restore: %v\n", err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// openCache opens the filesystem cache configured by the environment
+func openCache() (*storage.FilesystemStorage, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if cfg.StorageType != "filesystem" {
+		return nil, fmt.Errorf("only filesystem storage is supported, storage type is %s", cfg.StorageType)
+	}
+	st, err := storage.NewFilesystemStorage(cfg.CacheDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := st.SetArchiveDirs(cfg.ArchiveDirs); err != nil {
+		return nil, err
+	}
+	st.SetShardArchives(cfg.ShardArchives)
+	return st, nil
+}
+
+// parseSince reads an RFC 3339 time, or the creation time of a previous backup file
+func parseSince(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	f, err := os.Open(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("-since must be an RFC 3339 time or a backup file: %w", err)
+	}
+	defer f.Close()
+	manifest, err := storage.ReadBackupManifest(f)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return manifest.CreatedAt, nil
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/elisiariocouto/specular/pkg/config"
+	"github.com/elisiariocouto/specular/pkg/mirror"
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+// Severities of doctor findings
+const (
+	findingOK   = "ok"
+	findingWarn = "warn"
+	findingFail = "fail"
+)
+
+// Thresholds of doctor findings
+const (
+	// doctorLowFreePercent warns when the cache disk is almost full, before MinFreeBytes refuses writes
+	doctorLowFreePercent = 10
+	// doctorCertExpiryWarning warns about TLS certificates expiring soon
+	doctorCertExpiryWarning = 14 * 24 * time.Hour
+	// doctorClockSkewWarning and doctorClockSkewFailure bound the clock difference with upstream registries
+	// TLS validity and token expiry checks start failing as it grows
+	doctorClockSkewWarning = 30 * time.Second
+	doctorClockSkewFailure = 5 * time.Minute
+)
+
+// finding is the result of one doctor check
+type finding struct {
+	severity string
+	check    string
+	message  string
+	// hint tells how to fix a warning or failure
+	hint string
+}
+
+// runDoctor implements `specular doctor`
+func runDoctor(args []string) int {
+	flags := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: specular doctor [-timeout DURATION] [-offline]")
+		fmt.Fprintln(flags.Output(), "Checks the configuration, cache directories, TLS certificates, upstream connectivity and clock. Exits 1 when a check fails.")
+		flags.PrintDefaults()
+	}
+	timeout := flags.Duration("timeout", 10*time.Second, "how long to wait for each upstream registry")
+	offline := flags.Bool("offline", false, "skip the upstream connectivity and clock checks")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	cfg, err := config.Load()
+	if err != nil {
+		printFindings([]finding{{
+			severity: findingFail,
+			check:    "config",
+			message:  err.Error(),
+			hint:     "fix the SPECULAR_ environment variables above, every other check needs a valid configuration",
+		}})
+		return 1
+	}
+
+	findings := []finding{{severity: findingOK, check: "config", message: "configuration is valid"}}
+	findings = append(findings, checkCertificates(cfg)...)
+	findings = append(findings, checkCacheDirs(ctx, cfg)...)
+	if !*offline {
+		findings = append(findings, checkUpstreams(ctx, cfg, *timeout)...)
+	}
+
+	printFindings(findings)
+	if slices.ContainsFunc(findings, func(f finding) bool { return f.severity == findingFail }) {
+		return 1
+	}
+	return 0
+}
+
+// printFindings writes one line per finding, followed by its hint
+func printFindings(findings []finding) {
+	for _, f := range findings {
+		fmt.Printf("%-4s  %s: %s\n", f.severity, f.check, f.message)
+		if f.hint != "" && f.severity != findingOK {
+			fmt.Printf("      -> %s\n", f.hint)
+		}
+	}
+}
+
+// checkCertificates loads the certificate of every TLS listener and checks its validity period
+func checkCertificates(cfg *config.Config) []finding {
+	listeners, err := cfg.Listeners()
+	if err != nil {
+		return []finding{{severity: findingFail, check: "tls", message: err.Error()}}
+	}
+
+	var findings []finding
+	for _, l := range listeners {
+		if !l.TLS() {
+			continue
+		}
+		check := "tls " + l.Address
+		pair, err := tls.LoadX509KeyPair(l.CertFile, l.KeyFile)
+		if err != nil {
+			findings = append(findings, finding{
+				severity: findingFail,
+				check:    check,
+				message:  err.Error(),
+				hint:     "check that the certificate and key files exist, are readable by this user and belong together",
+			})
+			continue
+		}
+		leaf := pair.Leaf
+		if leaf == nil {
+			if leaf, err = x509.ParseCertificate(pair.Certificate[0]); err != nil {
+				findings = append(findings, finding{severity: findingFail, check: check, message: err.Error()})
+				continue
+			}
+		}
+		now := time.Now()
+		switch {
+		case now.After(leaf.NotAfter):
+			findings = append(findings, finding{
+				severity: findingFail,
+				check:    check,
+				message:  fmt.Sprintf("certificate expired on %s", leaf.NotAfter.Format(time.RFC3339)),
+				hint:     "renew the certificate, Specular reloads it every SPECULAR_TLS_RELOAD_INTERVAL",
+			})
+		case now.Before(leaf.NotBefore):
+			findings = append(findings, finding{
+				severity: findingFail,
+				check:    check,
+				message:  fmt.Sprintf("certificate is not valid before %s", leaf.NotBefore.Format(time.RFC3339)),
+				hint:     "check the system clock",
+			})
+		case leaf.NotAfter.Sub(now) < doctorCertExpiryWarning:
+			findings = append(findings, finding{
+				severity: findingWarn,
+				check:    check,
+				message:  fmt.Sprintf("certificate expires on %s", leaf.NotAfter.Format(time.RFC3339)),
+				hint:     "renew the certificate, Specular reloads it every SPECULAR_TLS_RELOAD_INTERVAL",
+			})
+		default:
+			findings = append(findings, finding{
+				severity: findingOK,
+				check:    check,
+				message:  fmt.Sprintf("certificate for %v valid until %s", leaf.DNSNames, leaf.NotAfter.Format(time.RFC3339)),
+			})
+		}
+	}
+	return findings
+}
+
+// checkCacheDirs checks that the cache directories are writable and have free space left
+func checkCacheDirs(ctx context.Context, cfg *config.Config) []finding {
+	if cfg.StorageType != "filesystem" {
+		return []finding{{severity: findingOK, check: "storage", message: fmt.Sprintf("%s storage has no directories to check", cfg.StorageType)}}
+	}
+
+	dirs := []string{cfg.CacheDir}
+	for _, dir := range cfg.ArchiveDirs {
+		if !slices.Contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	for _, secondary := range cfg.SecondaryStorage {
+		if secondary != "s3" && !slices.Contains(dirs, secondary) {
+			dirs = append(dirs, secondary)
+		}
+	}
+
+	var findings []finding
+	writable := true
+	for _, dir := range dirs {
+		if err := checkWritable(dir); err != nil {
+			writable = false
+			findings = append(findings, finding{
+				severity: findingFail,
+				check:    "cache " + dir,
+				message:  err.Error(),
+				hint:     fmt.Sprintf("create the directory and give user %d write access to it", os.Getuid()),
+			})
+			continue
+		}
+		findings = append(findings, finding{severity: findingOK, check: "cache " + dir, message: "directory is writable"})
+	}
+	if !writable {
+		return findings
+	}
+
+	fs, err := storage.NewFilesystemStorage(cfg.CacheDir)
+	if err == nil {
+		err = fs.SetArchiveDirs(cfg.ArchiveDirs)
+	}
+	var usage storage.DiskUsage
+	if err == nil {
+		usage, err = fs.DiskUsage(ctx)
+	}
+	if err != nil {
+		return append(findings, finding{severity: findingWarn, check: "free space", message: err.Error()})
+	}
+
+	free, err := fs.FreeSpace(ctx)
+	if err != nil {
+		return append(findings, finding{severity: findingWarn, check: "free space", message: err.Error()})
+	}
+	message := fmt.Sprintf("%d bytes free (%.1f%%)", free, usage.FreePercent())
+	switch {
+	case cfg.MinFreeBytes > 0 && free < cfg.MinFreeBytes:
+		findings = append(findings, finding{
+			severity: findingFail,
+			check:    "free space",
+			message:  fmt.Sprintf("%s, below SPECULAR_MIN_FREE_BYTES of %d, new archives will not be cached", message, cfg.MinFreeBytes),
+			hint:     "free disk space, set namespace quotas, or run the gc job",
+		})
+	case usage.FreePercent() < doctorLowFreePercent:
+		findings = append(findings, finding{
+			severity: findingWarn,
+			check:    "free space",
+			message:  message,
+			hint:     "grow the disk or add another one with SPECULAR_ARCHIVE_DIRS before it fills",
+		})
+	default:
+		findings = append(findings, finding{severity: findingOK, check: "free space", message: message})
+	}
+	return findings
+}
+
+// checkWritable creates dir if needed and writes a file into it
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".specular-doctor-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	_, err = f.WriteString("ok")
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if removeErr := os.Remove(name); err == nil {
+		err = removeErr
+	}
+	return err
+}
+
+// checkUpstreams fetches service discovery from every configured upstream registry
+// and compares the registries' clocks with the local one
+func checkUpstreams(ctx context.Context, cfg *config.Config, timeout time.Duration) []finding {
+	client := &http.Client{Timeout: timeout}
+
+	hosts := []string{"registry.terraform.io"}
+	if cfg.DiscoveryHost != "" && !slices.Contains(hosts, cfg.DiscoveryHost) {
+		hosts = append(hosts, cfg.DiscoveryHost)
+	}
+	probes, _ := config.ParseUpstreamProbes(cfg.UpstreamProbes)
+	for hostname := range probes {
+		if !slices.Contains(hosts, hostname) {
+			hosts = append(hosts, hostname)
+		}
+	}
+	slices.Sort(hosts[1:])
+
+	var findings []finding
+	var skew time.Duration
+	var skewHost string
+	for _, hostname := range hosts {
+		f, date := checkDiscovery(ctx, client, hostname)
+		findings = append(findings, f)
+		if !date.IsZero() {
+			if d := time.Since(date).Abs(); d >= skew {
+				skew, skewHost = d, hostname
+			}
+		}
+	}
+
+	sources, _ := config.ParseProviderSources(cfg.ProviderSources)
+	patterns := make([]string, 0, len(sources))
+	for pattern := range sources {
+		patterns = append(patterns, pattern)
+	}
+	slices.Sort(patterns)
+	for _, pattern := range patterns {
+		findings = append(findings, checkSource(ctx, client, pattern, sources[pattern]))
+	}
+
+	if skewHost == "" {
+		return findings
+	}
+	// Date headers have a resolution of one second
+	message := fmt.Sprintf("local clock is %s off from %s", skew.Round(time.Second), skewHost)
+	switch {
+	case skew >= doctorClockSkewFailure:
+		findings = append(findings, finding{
+			severity: findingFail,
+			check:    "clock",
+			message:  message,
+			hint:     "synchronize the clock with NTP, certificate and token validation fail with a skewed clock",
+		})
+	case skew >= doctorClockSkewWarning:
+		findings = append(findings, finding{
+			severity: findingWarn,
+			check:    "clock",
+			message:  message,
+			hint:     "synchronize the clock with NTP",
+		})
+	default:
+		findings = append(findings, finding{severity: findingOK, check: "clock", message: message})
+	}
+	return findings
+}
+
+// checkDiscovery fetches the service discovery document of hostname
+// It also returns the Date header of the response, zero when there was no response
+func checkDiscovery(ctx context.Context, client *http.Client, hostname string) (finding, time.Time) {
+	check := "upstream " + hostname
+	u := &url.URL{Scheme: "https", Host: hostname, Path: "/.well-known/terraform.json"}
+	resp, err := doctorGet(ctx, client, u.String())
+	if err != nil {
+		return connectivityFinding(check, err), time.Time{}
+	}
+	defer resp.Body.Close()
+	date, _ := http.ParseTime(resp.Header.Get("Date"))
+
+	if resp.StatusCode != http.StatusOK {
+		return finding{
+			severity: findingFail,
+			check:    check,
+			message:  fmt.Sprintf("service discovery answered %s", resp.Status),
+			hint:     "check that the hostname is a Terraform registry",
+		}, date
+	}
+	var sd mirror.ServiceDiscovery
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&sd); err != nil {
+		return finding{severity: findingFail, check: check, message: fmt.Sprintf("invalid service discovery document: %v", err)}, date
+	}
+	if sd.ProvidersV1 == "" {
+		return finding{
+			severity: findingFail,
+			check:    check,
+			message:  "service discovery has no providers.v1 service",
+			hint:     "the registry does not serve providers, use SPECULAR_PROVIDER_SOURCES to point at its providers endpoint",
+		}, date
+	}
+	return finding{severity: findingOK, check: check, message: fmt.Sprintf("providers.v1 at %s", sd.ProvidersV1)}, date
+}
+
+// checkSource checks that the providers.v1 endpoint of a provider source can be reached
+// Any HTTP response counts, the endpoint serves nothing at its root
+func checkSource(ctx context.Context, client *http.Client, pattern, source string) finding {
+	check := "source " + pattern
+	resp, err := doctorGet(ctx, client, source)
+	if err != nil {
+		return connectivityFinding(check, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return finding{severity: findingWarn, check: check, message: fmt.Sprintf("%s answered %s", source, resp.Status)}
+	}
+	return finding{severity: findingOK, check: check, message: fmt.Sprintf("%s is reachable", source)}
+}
+
+// doctorGet sends a GET request
+func doctorGet(ctx context.Context, client *http.Client, target string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
+// connectivityFinding explains why an upstream request failed
+func connectivityFinding(check string, err error) finding {
+	f := finding{severity: findingFail, check: check, message: err.Error()}
+	var dnsErr *net.DNSError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidCert x509.CertificateInvalidError
+	switch {
+	case errors.As(err, &unknownAuthority):
+		f.hint = "the certificate is signed by an unknown authority, add the CA of your TLS inspecting proxy to the system trust store or point SSL_CERT_FILE at it"
+	case errors.As(err, &hostnameErr):
+		f.hint = "the certificate does not match the hostname, check for a TLS inspecting proxy or a DNS override"
+	case errors.As(err, &invalidCert):
+		if invalidCert.Reason == x509.Expired {
+			f.hint = "the certificate is expired or not yet valid, check the system clock"
+		} else {
+			f.hint = "the certificate is not valid for this host"
+		}
+	case errors.As(err, &dnsErr):
+		f.hint = "the hostname does not resolve, check the DNS configuration of this host or container"
+	case errors.Is(err, context.DeadlineExceeded) || os.IsTimeout(err):
+		f.hint = "the request timed out, outbound HTTPS may be blocked, set HTTPS_PROXY if egress goes through a proxy"
+	default:
+		f.hint = "check outbound HTTPS connectivity, set HTTPS_PROXY if egress goes through a proxy"
+	}
+	return f
+}
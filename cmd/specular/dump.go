@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"time"
+
+	"github.com/elisiariocouto/specular/internal/jobs"
+	"github.com/elisiariocouto/specular/pkg/metrics"
+	"github.com/elisiariocouto/specular/pkg/mirror"
+)
+
+// dumpState logs a snapshot of the runtime state, for incident triage without the admin API
+func dumpState(log *slog.Logger, m *metrics.Metrics, discovery *mirror.DiscoveryCache, discoveryTTL time.Duration, queue *jobs.Queue) {
+	ctx := context.Background()
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	attrs := []any{
+		slog.Int("goroutines", runtime.NumGoroutine()),
+		slog.Uint64("heap_alloc_bytes", mem.HeapAlloc),
+		slog.Uint64("heap_sys_bytes", mem.HeapSys),
+		slog.Uint64("gc_cycles", uint64(mem.NumGC)),
+	}
+
+	counters, err := m.Snapshot()
+	if err != nil {
+		log.WarnContext(ctx, "Failed to gather metrics for state dump",
+			slog.String("error", err.Error()))
+	}
+	attrs = append(attrs, slog.Any("metrics", counters))
+
+	entries := discovery.Entries()
+	hosts := make([]map[string]any, len(entries))
+	for i, entry := range entries {
+		hosts[i] = map[string]any{
+			"hostname":     entry.Hostname,
+			"providers_v1": entry.ProvidersV1,
+			"cached_at":    entry.CachedAt.UTC().Format(time.RFC3339),
+			"expired":      entry.Expired(discoveryTTL),
+		}
+	}
+	attrs = append(attrs, slog.Any("discovery_cache", hosts))
+
+	byStatus := make(map[jobs.Status]int)
+	for _, job := range queue.List() {
+		byStatus[job.Status]++
+	}
+	attrs = append(attrs, slog.Any("jobs", byStatus))
+
+	log.InfoContext(ctx, "Runtime state", attrs...)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/elisiariocouto/specular/pkg/mirror"
+)
+
+// runExport implements `specular export`
+func runExport(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: specular export dir")
+		fmt.Fprintln(flags.Output(), "Writes the cached providers to dir in the layout of `terraform providers mirror`.")
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	fs, err := openCache()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export: %v\n", err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	// Only cached data is exported, the mirror never reaches upstream
+	result, err := mirror.NewMirror(fs, nil, "").Export(ctx, flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "exported %d archives (%d bytes) of %d versions of %d providers\n", result.Archives, result.Bytes, result.Versions, result.Providers)
+	return 0
+}
@@ -6,18 +6,40 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
 	"syscall"
 
-	"github.com/elisiariocouto/specular/internal/config"
+	"github.com/elisiariocouto/specular/internal/jobs"
 	"github.com/elisiariocouto/specular/internal/logger"
-	"github.com/elisiariocouto/specular/internal/metrics"
-	"github.com/elisiariocouto/specular/internal/mirror"
-	"github.com/elisiariocouto/specular/internal/server"
-	"github.com/elisiariocouto/specular/internal/storage"
+	"github.com/elisiariocouto/specular/internal/stats"
 	"github.com/elisiariocouto/specular/internal/version"
+	"github.com/elisiariocouto/specular/pkg/config"
+	"github.com/elisiariocouto/specular/pkg/metrics"
+	"github.com/elisiariocouto/specular/pkg/mirror"
+	"github.com/elisiariocouto/specular/pkg/server"
+	"github.com/elisiariocouto/specular/pkg/storage"
 )
 
 func main() {
+	// Subcommands, the server runs when none is given
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "backup":
+			os.Exit(runBackup(os.Args[2:]))
+		case "restore":
+			os.Exit(runRestore(os.Args[2:]))
+		case "export":
+			os.Exit(runExport(os.Args[2:]))
+		case "healthcheck":
+			os.Exit(runHealthcheck(os.Args[2:]))
+		case "doctor":
+			os.Exit(runDoctor(os.Args[2:]))
+		case "selftest":
+			os.Exit(runSelftest(os.Args[2:]))
+		}
+	}
+
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
@@ -26,7 +48,17 @@ func main() {
 	}
 
 	// Setup logger
-	log := logger.SetupLogger(cfg.LogLevel, cfg.LogFormat)
+	redaction := logger.Redaction{
+		ClientIPs:    slices.Contains(cfg.LogRedact, "client_ip"),
+		AnonymizeIPs: cfg.LogAnonymizeIP,
+		AuthTokens:   slices.Contains(cfg.LogRedact, "auth"),
+		QueryStrings: slices.Contains(cfg.LogRedact, "query"),
+	}
+	log, err := logger.SetupLogger(cfg.LogLevel, cfg.LogFormat, cfg.LogOutput, cfg.SyslogAddress, redaction)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to setup logger: %v\n", err)
+		os.Exit(1)
+	}
 
 	log.InfoContext(context.Background(), "Specular starting",
 		slog.String("version", version.Version),
@@ -41,6 +73,8 @@ func main() {
 
 	// Initialize storage backend
 	var storageBackend storage.Storage
+	// memoryStorage is set when memory storage is snapshotted to disk
+	var memoryStorage *storage.MemoryStorage
 	switch cfg.StorageType {
 	case "filesystem":
 		st, err := storage.NewFilesystemStorage(cfg.CacheDir)
@@ -49,16 +83,204 @@ func main() {
 				slog.String("error", err.Error()))
 			os.Exit(1)
 		}
+		if err := st.SetArchiveDirs(cfg.ArchiveDirs); err != nil {
+			log.ErrorContext(context.Background(), "Failed to initialize archive directories",
+				slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		st.SetShardArchives(cfg.ShardArchives)
+		st.SetSharedLocks(cfg.CacheLockTTL)
+		quotas, err := config.ParseNamespaceQuotas(cfg.NamespaceQuotas)
+		if err != nil {
+			log.ErrorContext(context.Background(), "Invalid namespace quotas",
+				slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		if len(quotas) > 0 {
+			st.SetNamespaceQuotas(quotas, storage.QuotaPolicy(cfg.NamespaceQuotaPolicy))
+		}
+		if cfg.CacheMaxSize > 0 {
+			st.SetQuota(cfg.CacheMaxSize, storage.QuotaPolicy(cfg.CacheEvictionPolicy))
+		}
+		// Access times cannot be recorded on a read-only cache
+		st.SetTrackAccess(cfg.CacheRetention > 0 && !cfg.StorageReadOnly)
+		st.SetVerifyOnRead(cfg.VerifyArchives)
+		st.SetCompressMetadata(cfg.CompressMetadata)
+		st.SetDedup(storage.DedupMode(cfg.Dedup))
+		var removed int
+		if !cfg.StorageReadOnly {
+			removed, err = st.PurgeTruncated(context.Background())
+			if err != nil {
+				log.WarnContext(context.Background(), "Failed to scan cache for interrupted writes",
+					slog.String("error", err.Error()))
+			}
+			// Move archives cached before sharding was turned on or off into the configured layout
+			resharded, err := st.ReshardArchives(context.Background())
+			if err != nil {
+				log.ErrorContext(context.Background(), "Failed to move archives into the configured layout",
+					slog.String("error", err.Error()))
+				os.Exit(1)
+			}
+			if resharded > 0 {
+				log.InfoContext(context.Background(), "moved archives into the configured layout",
+					slog.Int("archives", resharded),
+					slog.Bool("sharded", cfg.ShardArchives))
+			}
+		}
+		if cfg.CacheCatalog {
+			stats, err := st.BuildCatalog(context.Background())
+			if err != nil {
+				log.ErrorContext(context.Background(), "Failed to build cache catalog",
+					slog.String("error", err.Error()))
+				os.Exit(1)
+			}
+			log.InfoContext(context.Background(), "cache catalog built",
+				slog.Int("providers", stats.Providers),
+				slog.Int("versions", stats.Versions),
+				slog.Int("archives", stats.Archives),
+				slog.Int64("archive_bytes", stats.ArchiveBytes))
+		}
 		storageBackend = st
 		log.InfoContext(context.Background(), "Filesystem storage initialized",
-			slog.String("cache_dir", cfg.CacheDir))
+			slog.String("cache_dir", cfg.CacheDir),
+			slog.Any("archive_dirs", cfg.ArchiveDirs),
+			slog.Bool("shard_archives", cfg.ShardArchives),
+			slog.Int("namespace_quotas", len(quotas)),
+			slog.Int64("cache_max_size", cfg.CacheMaxSize),
+			slog.String("cache_eviction_policy", cfg.CacheEvictionPolicy),
+			slog.Bool("verify_archives", cfg.VerifyArchives),
+			slog.Bool("compress_metadata", cfg.CompressMetadata),
+			slog.String("dedup", cfg.Dedup),
+			slog.Int("purged_files", removed))
 	case "memory":
-		storageBackend = storage.NewMemoryStorage()
-		log.InfoContext(context.Background(), "In-memory storage initialized")
+		st := storage.NewMemoryStorage()
+		st.SetMaxBytes(cfg.CacheMaxSize)
+		if cfg.MemorySnapshotFile != "" {
+			restoreSnapshot(st, cfg.MemorySnapshotFile, log)
+			memoryStorage = st
+		}
+		storageBackend = st
+		log.InfoContext(context.Background(), "In-memory storage initialized",
+			slog.String("snapshot_file", cfg.MemorySnapshotFile),
+			slog.Int64("cache_max_size", cfg.CacheMaxSize))
+		if len(cfg.NamespaceQuotas) > 0 {
+			log.WarnContext(context.Background(), "namespace quotas are only supported by filesystem storage")
+		}
+	case "s3":
+		st, err := storage.NewS3Storage(s3Config(cfg))
+		if err != nil {
+			log.ErrorContext(context.Background(), "Failed to initialize S3 storage",
+				slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		storageBackend = st
+		log.InfoContext(context.Background(), "S3 storage initialized",
+			slog.String("endpoint", cfg.S3Endpoint),
+			slog.String("bucket", cfg.S3Bucket),
+			slog.String("prefix", cfg.S3Prefix),
+			slog.Bool("path_style", cfg.S3PathStyle))
+		if len(cfg.NamespaceQuotas) > 0 || cfg.CacheMaxSize > 0 {
+			log.WarnContext(context.Background(), "namespace quotas and the cache max size are not supported by s3 storage")
+		}
 	default:
-		log.ErrorContext(context.Background(), "Unknown storage type",
+		// Backends compiled in through plugins.go register themselves
+		st, err := storage.Open(context.Background(), cfg.StorageType, storage.Options{CacheDir: cfg.CacheDir, Logger: log})
+		if err != nil {
+			log.ErrorContext(context.Background(), "Failed to initialize storage",
+				slog.String("storage_type", cfg.StorageType),
+				slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		storageBackend = st
+		log.InfoContext(context.Background(), "Registered storage initialized",
 			slog.String("storage_type", cfg.StorageType))
-		os.Exit(1)
+	}
+
+	// Write every cached object to the secondaries as well, they serve what the primary misses
+	var replicated *storage.Replicated
+	if len(cfg.SecondaryStorage) > 0 {
+		var secondaries []storage.Storage
+		for _, secondary := range cfg.SecondaryStorage {
+			st, err := newSecondaryStorage(cfg, secondary)
+			if err != nil {
+				log.ErrorContext(context.Background(), "Failed to initialize secondary storage",
+					slog.String("secondary", secondary),
+					slog.String("error", err.Error()))
+				os.Exit(1)
+			}
+			secondaries = append(secondaries, st)
+		}
+		replicated = storage.NewReplicated(storageBackend, secondaries...)
+		storageBackend = replicated
+		log.InfoContext(context.Background(), "secondary storage enabled",
+			slog.Any("secondaries", cfg.SecondaryStorage),
+			slog.Bool("async", cfg.SecondaryAsync))
+	}
+
+	// Keep metadata in Redis so replicas share it, archives stay in the configured storage
+	if cfg.RedisURL != "" {
+		st, err := storage.NewRedisStorage(storage.RedisConfig{URL: cfg.RedisURL, Prefix: cfg.RedisPrefix}, storageBackend)
+		if err != nil {
+			log.ErrorContext(context.Background(), "Failed to initialize Redis storage",
+				slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		defer st.Close()
+		if err := st.Ping(context.Background()); err != nil {
+			log.WarnContext(context.Background(), "Redis is not reachable, metadata will be fetched from upstream until it is",
+				slog.String("error", err.Error()))
+		}
+		storageBackend = st
+		log.InfoContext(context.Background(), "Redis metadata storage initialized",
+			slog.String("prefix", cfg.RedisPrefix))
+	}
+
+	if cfg.CacheCatalog && cfg.StorageType != "filesystem" {
+		log.WarnContext(context.Background(), "cache catalog is only supported by filesystem storage")
+	}
+
+	// Serve a pre-seeded cache without ever writing to it, retention, garbage collection and
+	// verification jobs are skipped since the read-only storage hides them
+	if cfg.StorageReadOnly {
+		storageBackend = storage.NewReadOnly(storageBackend)
+		log.InfoContext(context.Background(), "storage is read-only, cache misses are served from upstream without being cached")
+	}
+
+	// Keep the hottest metadata in memory so it is not read from disk or S3 on every request
+	if cfg.MemoryTierSize > 0 {
+		if cfg.StorageType == "memory" {
+			log.WarnContext(context.Background(), "memory tier ignored, storage is already in memory")
+		} else {
+			tiered := storage.NewTiered(storageBackend, cfg.MemoryTierSize)
+			tiered.SetMaxArchiveSize(cfg.MemoryTierMaxArchiveSize)
+			storageBackend = tiered
+			log.InfoContext(context.Background(), "memory tier enabled",
+				slog.Int64("size", cfg.MemoryTierSize),
+				slog.Int64("max_archive_size", cfg.MemoryTierMaxArchiveSize))
+		}
+	}
+
+	// Initialize metrics conditionally
+	var m *metrics.Metrics
+	if cfg.MetricsEnabled {
+		m = metrics.New(nil, metrics.Options{
+			DisableGoCollector:      !cfg.MetricsGoCollector,
+			DisableProcessCollector: !cfg.MetricsProcessCollector,
+		})
+		log.InfoContext(context.Background(), "metrics enabled",
+			slog.Bool("go_collector", cfg.MetricsGoCollector),
+			slog.Bool("process_collector", cfg.MetricsProcessCollector))
+	} else {
+		m = metrics.Noop()
+		log.InfoContext(context.Background(), "metrics disabled")
+	}
+
+	// Copy writes to the secondaries in the background, so requests only wait on the primary
+	replCtx, stopReplication := context.WithCancel(context.Background())
+	defer stopReplication()
+	if replicated != nil && cfg.SecondaryAsync {
+		replicated.SetAsync(cfg.SecondaryQueueSize, m)
+		go replicated.Run(replCtx)
 	}
 
 	// Initialize upstream client
@@ -68,30 +290,192 @@ func main() {
 		cfg.DiscoveryCacheTTL,
 		log,
 	)
+	upstreamClient.SetMetrics(m)
+	if err := server.ConfigureUpstream(upstreamClient, cfg); err != nil {
+		log.ErrorContext(context.Background(), "Invalid upstream settings",
+			slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	if cfg.ChaosEnabled {
+		log.WarnContext(context.Background(), "chaos mode enabled, injecting faults into upstream requests",
+			slog.Duration("latency", cfg.ChaosLatency),
+			slog.Float64("error_rate", cfg.ChaosErrorRate),
+			slog.Float64("truncate_rate", cfg.ChaosTruncateRate))
+	}
 
 	// Initialize mirror service
 	mirrorService := mirror.NewMirror(storageBackend, upstreamClient, cfg.BaseURL)
+	if err := server.ConfigureMirror(mirrorService, cfg); err != nil {
+		log.ErrorContext(context.Background(), "Invalid mirror settings",
+			slog.String("error", err.Error()))
+		os.Exit(1)
+	}
 
-	// Initialize metrics conditionally
-	var m *metrics.Metrics
-	if cfg.MetricsEnabled {
-		m = metrics.New()
-		log.InfoContext(context.Background(), "metrics enabled")
+	// Restore the service discovery cache of the previous run, so restarts do not refetch every registry's discovery document
+	switch restored, err := mirrorService.LoadDiscoveryCache(context.Background()); {
+	case err == nil:
+		log.InfoContext(context.Background(), "service discovery cache restored",
+			slog.Int("hosts", restored))
+	case !storage.IsNotFound(err):
+		log.WarnContext(context.Background(), "Failed to restore the service discovery cache",
+			slog.String("error", err.Error()))
+	}
+
+	// Retry failed cache writes in the background, retries still waiting at shutdown are dropped
+	if cfg.CacheWriteRetries > 0 {
+		retrier := mirror.NewWriteRetrier(cfg.CacheWriteRetryQueueSize, cfg.CacheWriteRetries, m, log)
+		mirrorService.SetWriteRetrier(retrier)
+		go retrier.Run(replCtx)
+	}
+
+	// Switch to passthrough mode while the cache disk is low on space
+	monitorCtx, stopMonitor := context.WithCancel(context.Background())
+	defer stopMonitor()
+	if cfg.MinFreeBytes > 0 {
+		if reporter, ok := storage.As[storage.SpaceReporter](storageBackend); ok {
+			monitor := mirror.NewFreeSpaceMonitor(mirrorService, reporter, cfg.MinFreeBytes, m, log)
+			go monitor.Run(monitorCtx, cfg.FreeSpaceCheckInterval)
+			log.InfoContext(context.Background(), "free space monitoring enabled",
+				slog.Int64("min_free_bytes", cfg.MinFreeBytes))
+		} else {
+			log.WarnContext(context.Background(), "minimum free space ignored, storage backend does not report free space",
+				slog.String("storage_type", cfg.StorageType))
+		}
+	}
+
+	// Remove cache entries nobody read within the retention window, a scan in progress is interrupted on shutdown
+	gcCtx, stopGC := context.WithCancel(context.Background())
+	defer stopGC()
+	gcDone := make(chan struct{})
+	if cfg.CacheRetention > 0 {
+		if expirer, ok := storage.As[storage.Expirer](storageBackend); ok {
+			collector := mirror.NewRetentionCollector(expirer, cfg.CacheRetention, m, log)
+			go func() {
+				defer close(gcDone)
+				collector.Run(gcCtx, cfg.CacheRetentionInterval)
+			}()
+			log.InfoContext(context.Background(), "cache retention enabled",
+				slog.Duration("retention", cfg.CacheRetention),
+				slog.Duration("interval", cfg.CacheRetentionInterval))
+		} else {
+			close(gcDone)
+			log.WarnContext(context.Background(), "cache retention ignored, storage backend cannot remove unused entries",
+				slog.String("storage_type", cfg.StorageType))
+		}
 	} else {
-		m = metrics.Noop()
-		log.InfoContext(context.Background(), "metrics disabled")
+		close(gcDone)
+	}
+
+	// Save memory storage periodically, it is saved a last time on shutdown
+	if memoryStorage != nil && cfg.MemorySnapshotInterval > 0 {
+		go runSnapshots(monitorCtx, memoryStorage, cfg.MemorySnapshotFile, cfg.MemorySnapshotInterval, log)
+	}
+
+	// Probe upstream registries, failing requests fast to those that keep failing
+	probes, err := config.ParseUpstreamProbes(cfg.UpstreamProbes)
+	if err != nil {
+		log.ErrorContext(context.Background(), "Invalid upstream probes",
+			slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	if len(probes) > 0 {
+		addresses := make([]mirror.ProviderAddress, 0, len(probes))
+		for hostname, provider := range probes {
+			addresses = append(addresses, mirror.ProviderAddress{Hostname: hostname, Namespace: provider[0], Type: provider[1]})
+		}
+		health := mirror.NewHealthMonitor(upstreamClient, addresses, cfg.UpstreamCircuitThreshold, m, log)
+		upstreamClient.SetHealthMonitor(health)
+		go health.Run(monitorCtx, cfg.UpstreamProbeInterval)
+		log.InfoContext(context.Background(), "upstream health probing enabled",
+			slog.Int("upstreams", len(addresses)),
+			slog.Duration("interval", cfg.UpstreamProbeInterval),
+			slog.Int("circuit_threshold", cfg.UpstreamCircuitThreshold))
+	}
+
+	// Initialize download statistics
+	recorder := stats.NewRecorder(cfg.StatsRetention)
+
+	// Initialize background jobs
+	queue, err := jobs.NewQueue(jobs.Options{
+		Workers:   cfg.JobsWorkers,
+		QueueSize: cfg.JobsQueueSize,
+		Path:      cfg.JobsFile,
+	}, m, log)
+	if err != nil {
+		log.ErrorContext(context.Background(), "Failed to initialize job queue",
+			slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	pinned := make(mirror.ProviderRules[bool], len(cfg.PinnedProviders))
+	for _, pattern := range cfg.PinnedProviders {
+		pinned[pattern] = true
+	}
+	jobs.RegisterDefaults(queue, mirrorService, storageBackend, recorder, func(p storage.Provider) bool {
+		_, ok := pinned.Lookup(p.Hostname, p.Namespace, p.Type)
+		return ok
+	}, jobs.AutoPrefetch{Top: cfg.AutoPrefetchTop, Platforms: cfg.AutoPrefetchPlatforms})
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	jobsDone := make(chan struct{})
+	go func() {
+		queue.Run(jobsCtx)
+		close(jobsDone)
+	}()
+
+	// Queue maintenance jobs on their cron schedules
+	schedule, err := config.ParseSchedule(cfg.Schedule)
+	if err != nil {
+		log.ErrorContext(context.Background(), "Invalid schedule",
+			slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	if len(schedule) > 0 {
+		var tasks []jobs.Task
+		for kind, expr := range schedule {
+			cron, err := jobs.ParseCron(expr)
+			if err != nil {
+				log.ErrorContext(context.Background(), "Invalid schedule",
+					slog.String("kind", kind),
+					slog.String("error", err.Error()))
+				os.Exit(1)
+			}
+			tasks = append(tasks, jobs.Task{Kind: kind, Schedule: cron})
+		}
+		scheduler, err := jobs.NewScheduler(queue, tasks, cfg.ScheduleJitter, log)
+		if err != nil {
+			log.ErrorContext(context.Background(), "Invalid schedule",
+				slog.String("error", err.Error()),
+				slog.Any("available_kinds", queue.Kinds()))
+			os.Exit(1)
+		}
+		go scheduler.Run(jobsCtx)
+		log.InfoContext(context.Background(), "maintenance schedule enabled",
+			slog.Any("schedule", schedule),
+			slog.Duration("jitter", cfg.ScheduleJitter))
+	}
+
+	if cfg.AdminEnabled() {
+		log.InfoContext(context.Background(), "admin API enabled",
+			slog.Any("job_kinds", queue.Kinds()))
+	}
+
+	// Route requests from tenants to their own policies and caches
+	var serverMirror server.Mirror = mirrorService
+	if cfg.TenantsFile != "" {
+		serverMirror, err = newTenantMirror(cfg, mirrorService, upstreamClient, log)
+		if err != nil {
+			log.ErrorContext(context.Background(), "Failed to initialize tenants",
+				slog.String("error", err.Error()))
+			os.Exit(1)
+		}
 	}
 
 	// Create HTTP server
-	httpServer := server.New(
-		cfg.Host,
-		cfg.Port,
-		cfg.ReadTimeout,
-		cfg.WriteTimeout,
-		mirrorService,
-		m,
-		log,
-	)
+	httpServer, err := server.New(cfg, serverMirror, m, recorder, log, server.WithJobQueue(queue))
+	if err != nil {
+		log.ErrorContext(context.Background(), "Failed to create HTTP server",
+			slog.String("error", err.Error()))
+		os.Exit(1)
+	}
 
 	// Start server in a goroutine
 	go func() {
@@ -104,13 +488,76 @@ func main() {
 		}
 	}()
 
-	// Wait for shutdown signal
+	// Log a snapshot of the runtime state on SIGUSR1
+	dumpChan := make(chan os.Signal, 1)
+	signal.Notify(dumpChan, syscall.SIGUSR1)
+	go func() {
+		for range dumpChan {
+			dumpState(log, m, upstreamClient.DiscoveryCache(), cfg.DiscoveryCacheTTL, queue)
+		}
+	}()
+
+	// Reload TLS certificates and API keys on SIGHUP
+	reloadChan := make(chan os.Signal, 1)
+	signal.Notify(reloadChan, syscall.SIGHUP)
+	go func() {
+		for range reloadChan {
+			if httpServer.TLSEnabled() {
+				if err := httpServer.ReloadTLS(); err != nil {
+					log.ErrorContext(context.Background(), "Failed to reload TLS certificate",
+						slog.String("error", err.Error()))
+				} else {
+					log.InfoContext(context.Background(), "Reloaded TLS certificate")
+				}
+			}
+			if httpServer.APIKeysEnabled() {
+				if err := httpServer.ReloadAPIKeys(); err != nil {
+					log.ErrorContext(context.Background(), "Failed to reload API keys",
+						slog.String("error", err.Error()))
+				} else {
+					log.InfoContext(context.Background(), "Reloaded API keys")
+				}
+			}
+		}
+	}()
+
+	if cfg.PIDFile != "" {
+		if err := writePIDFile(cfg.PIDFile); err != nil {
+			log.ErrorContext(context.Background(), "Failed to write PID file",
+				slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+	}
+
+	// Wait for shutdown signal, SIGUSR2 hands the listeners over to a new process first
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
+	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT, syscall.SIGUSR2)
 
-	sig := <-sigChan
-	log.InfoContext(context.Background(), "Received signal",
-		slog.String("signal", sig.String()))
+	upgraded := false
+	for !upgraded {
+		sig := <-sigChan
+		log.InfoContext(context.Background(), "Received signal",
+			slog.String("signal", sig.String()))
+		if sig != syscall.SIGUSR2 {
+			break
+		}
+		upgradeCtx, cancelUpgrade := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		err := httpServer.Upgrade(upgradeCtx)
+		cancelUpgrade()
+		if err != nil {
+			log.ErrorContext(context.Background(), "Upgrade failed, still serving",
+				slog.String("error", err.Error()))
+			// The new process may have replaced the PID file before failing
+			if cfg.PIDFile != "" {
+				if err := writePIDFile(cfg.PIDFile); err != nil {
+					log.WarnContext(context.Background(), "Failed to write PID file",
+						slog.String("error", err.Error()))
+				}
+			}
+			continue
+		}
+		upgraded = true
+	}
 
 	// Graceful shutdown
 	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
@@ -122,5 +569,62 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Cancel running jobs, they are marked failed on the next start if they do not return in time
+	stopJobs()
+	select {
+	case <-jobsDone:
+	case <-ctx.Done():
+		log.WarnContext(context.Background(), "Background jobs did not stop before shutdown")
+	}
+
+	stopGC()
+	select {
+	case <-gcDone:
+	case <-ctx.Done():
+		log.WarnContext(context.Background(), "Cache retention scan did not stop before shutdown")
+	}
+
+	// Let write-back cache writes of the last requests finish
+	if err := mirrorService.Flush(ctx); err != nil {
+		log.WarnContext(context.Background(), "Background cache writes did not finish before shutdown",
+			slog.String("error", err.Error()))
+	}
+
+	// Saved before the memory snapshot, which then includes it
+	if !cfg.StorageReadOnly {
+		if err := mirrorService.SaveDiscoveryCache(ctx); err != nil && !storage.IsNotFound(err) {
+			log.WarnContext(context.Background(), "Failed to save the service discovery cache",
+				slog.String("error", err.Error()))
+		}
+	}
+
+	if memoryStorage != nil {
+		stopMonitor()
+		saveSnapshot(memoryStorage, cfg.MemorySnapshotFile, log)
+	}
+
+	// Copy what is still queued to the secondaries, the rest is caught up by a backup and restore
+	if replicated != nil && cfg.SecondaryAsync {
+		if err := replicated.Drain(ctx); err != nil {
+			log.WarnContext(context.Background(), "Replication did not finish before shutdown",
+				slog.String("error", err.Error()))
+		}
+		stopReplication()
+	}
+
+	// The new process has written its own PID by now
+	if cfg.PIDFile != "" && !upgraded {
+		os.Remove(cfg.PIDFile)
+	}
+
 	log.InfoContext(context.Background(), "Specular shutdown complete")
 }
+
+// writePIDFile atomically replaces path with the PID of this process
+func writePIDFile(path string) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
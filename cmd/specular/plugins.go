@@ -0,0 +1,6 @@
+package main
+
+// Third-party storage backends are compiled in with a blank import of their package here, which
+// registers them with storage.Register. They are then selected by name with SPECULAR_STORAGE_TYPE:
+//
+//	import _ "example.com/specular-ceph"
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/elisiariocouto/specular/pkg/config"
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+// s3Config returns the S3 settings from cfg, used for s3 storage and s3 secondary storage
+func s3Config(cfg *config.Config) storage.S3Config {
+	return storage.S3Config{
+		Endpoint:        cfg.S3Endpoint,
+		Region:          cfg.S3Region,
+		Bucket:          cfg.S3Bucket,
+		Prefix:          cfg.S3Prefix,
+		AccessKeyID:     cfg.S3AccessKeyID,
+		SecretAccessKey: cfg.S3SecretAccessKey,
+		SessionToken:    cfg.S3SessionToken,
+		PathStyle:       cfg.S3PathStyle,
+	}
+}
+
+// newSecondaryStorage creates a secondary storage from an entry of SPECULAR_SECONDARY_STORAGE, s3 or a directory
+func newSecondaryStorage(cfg *config.Config, secondary string) (storage.Storage, error) {
+	if secondary == "s3" {
+		return storage.NewS3Storage(s3Config(cfg))
+	}
+	st, err := storage.NewFilesystemStorage(secondary)
+	if err != nil {
+		return nil, err
+	}
+	st.SetShardArchives(cfg.ShardArchives)
+	st.SetSharedLocks(cfg.CacheLockTTL)
+	st.SetCompressMetadata(cfg.CompressMetadata)
+	st.SetDedup(storage.DedupMode(cfg.Dedup))
+	return st, nil
+}
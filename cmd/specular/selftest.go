@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/elisiariocouto/specular/pkg/mirror"
+)
+
+// selftestMaxMetadata bounds the index and version responses read by the self test
+const selftestMaxMetadata = 10 << 20
+
+// selftest requests provider metadata and archives from a running mirror
+type selftest struct {
+	client *http.Client
+	token  string
+}
+
+// runSelftest implements `specular selftest`
+// It fetches the index, version and archive of a provider from a running instance and verifies the archive hashes
+func runSelftest(args []string) int {
+	flags := flag.NewFlagSet("selftest", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: specular selftest [-url URL] [-provider HOSTNAME/NAMESPACE/TYPE] [-version VERSION] [-platform OS_ARCH]")
+		fmt.Fprintln(flags.Output(), "Fetches a provider through a running mirror and verifies the archive hashes. Exits 0 when every step passes, 1 otherwise. Without -url the first configured listener is tested on the loopback address.")
+		flags.PrintDefaults()
+	}
+	base := flags.String("url", "", "base URL of the mirror, such as https://specular.example.com")
+	provider := flags.String("provider", "registry.terraform.io/hashicorp/null", "provider to fetch")
+	version := flags.String("version", "", "version to fetch, the latest release when empty")
+	platform := flags.String("platform", "linux_amd64", "platform of the archive to fetch")
+	token := flags.String("token", os.Getenv("SPECULAR_SELFTEST_TOKEN"), "bearer token sent to the mirror, when it requires authentication")
+	insecure := flags.Bool("insecure", false, "skip TLS certificate verification")
+	timeout := flags.Duration("timeout", 2*time.Minute, "how long the whole test may take")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	parts := strings.Split(*provider, "/")
+	if len(parts) != 3 {
+		fmt.Fprintf(os.Stderr, "selftest: -provider must be hostname/namespace/type\n")
+		return 2
+	}
+	address := mirror.ProviderAddress{Hostname: parts[0], Namespace: parts[1], Type: parts[2]}
+	if err := address.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "selftest: %v\n", err)
+		return 2
+	}
+
+	if *base == "" {
+		local, err := localBaseURL()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "selftest: %v\n", err)
+			return 1
+		}
+		*base = local
+		// The certificate is issued for the public name, not the loopback address the test dials
+		*insecure = true
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+
+	st := &selftest{
+		client: &http.Client{Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: *insecure},
+		}},
+		token: *token,
+	}
+	if err := st.run(ctx, strings.TrimSuffix(*base, "/"), address, *version, *platform); err != nil {
+		fmt.Fprintf(os.Stderr, "selftest: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// run fetches the index, the version and one archive, printing a line per passed step
+func (st *selftest) run(ctx context.Context, base string, address mirror.ProviderAddress, version, platform string) error {
+	providerURL := fmt.Sprintf("%s/terraform/providers/%s/%s/%s/", base, address.Hostname, address.Namespace, address.Type)
+
+	start := time.Now()
+	var index mirror.IndexResponse
+	if err := st.getJSON(ctx, providerURL+"index.json", &index); err != nil {
+		return fmt.Errorf("index: %w", err)
+	}
+	if len(index.Versions) == 0 {
+		return errors.New("index: no versions listed")
+	}
+	if version == "" {
+		version = mirror.LatestVersion(index)
+	} else if _, ok := index.Versions[version]; !ok {
+		return fmt.Errorf("index: version %s is not listed", version)
+	}
+	fmt.Printf("ok    index: %d versions in %s\n", len(index.Versions), time.Since(start).Round(time.Millisecond))
+
+	start = time.Now()
+	versionURL := providerURL + version + ".json"
+	var versionResp mirror.VersionResponse
+	if err := st.getJSON(ctx, versionURL, &versionResp); err != nil {
+		return fmt.Errorf("version %s: %w", version, err)
+	}
+	archive, ok := versionResp.Archives[platform]
+	if !ok {
+		return fmt.Errorf("version %s: no archive for %s", version, platform)
+	}
+	fmt.Printf("ok    version %s: %d platforms in %s\n", version, len(versionResp.Archives), time.Since(start).Round(time.Millisecond))
+
+	// Archive URLs are relative to the version document
+	ref, err := url.Parse(archive.URL)
+	if err != nil {
+		return fmt.Errorf("archive: %w", err)
+	}
+	parsedVersionURL, err := url.Parse(versionURL)
+	if err != nil {
+		return err
+	}
+	archiveURL := parsedVersionURL.ResolveReference(ref)
+
+	start = time.Now()
+	size, err := st.verifyArchive(ctx, archiveURL, parsedVersionURL.Host, archive.Hashes)
+	if err != nil {
+		return fmt.Errorf("archive %s: %w", platform, err)
+	}
+	fmt.Printf("ok    archive %s: %d bytes in %s, hashes verified\n", platform, size, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// getJSON fetches a metadata document
+func (st *selftest) getJSON(ctx context.Context, target string, v any) error {
+	resp, err := st.get(ctx, target, true)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(io.LimitReader(resp.Body, selftestMaxMetadata)).Decode(v); err != nil {
+		return fmt.Errorf("invalid response from %s: %w", target, err)
+	}
+	return nil
+}
+
+// verifyArchive downloads an archive to a temporary file and checks its hashes
+// The token is only sent when the archive is served by the mirror itself, it may redirect elsewhere
+func (st *selftest) verifyArchive(ctx context.Context, target *url.URL, mirrorHost string, hashes []string) (int64, error) {
+	resp, err := st.get(ctx, target.String(), target.Host == mirrorHost)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	f, err := os.CreateTemp("", "specular-selftest-*.zip")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	size, err := io.Copy(f, resp.Body)
+	if err != nil {
+		return 0, fmt.Errorf("download failed: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	if err := mirror.VerifyArchiveHashes(f, hashes); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// get sends a GET request and fails on any status but 200 OK
+func (st *selftest) get(ctx context.Context, target string, authenticate bool) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	if authenticate && st.token != "" {
+		req.Header.Set("Authorization", "Bearer "+st.token)
+	}
+	resp, err := st.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s answered %s: %s", target, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+// restoreSnapshot loads the memory snapshot written by a previous run, a missing or unreadable one starts empty
+func restoreSnapshot(st *storage.MemoryStorage, path string, log *slog.Logger) {
+	start := time.Now()
+	err := st.RestoreSnapshot(path)
+	switch {
+	case storage.IsNotFound(err):
+		log.InfoContext(context.Background(), "no memory snapshot to restore",
+			slog.String("path", path))
+	case err != nil:
+		log.WarnContext(context.Background(), "failed to restore memory snapshot, starting empty",
+			slog.String("path", path),
+			slog.String("error", err.Error()))
+	default:
+		log.InfoContext(context.Background(), "memory snapshot restored",
+			slog.String("path", path),
+			slog.Duration("duration", time.Since(start)))
+	}
+}
+
+// runSnapshots saves the memory storage every interval until ctx is cancelled
+func runSnapshots(ctx context.Context, st *storage.MemoryStorage, path string, interval time.Duration, log *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			saveSnapshot(st, path, log)
+		}
+	}
+}
+
+// saveSnapshot writes the memory storage to path if anything was cached since the last snapshot
+func saveSnapshot(st *storage.MemoryStorage, path string, log *slog.Logger) {
+	start := time.Now()
+	written, err := st.Snapshot(path)
+	if err != nil {
+		log.ErrorContext(context.Background(), "failed to write memory snapshot",
+			slog.String("path", path),
+			slog.String("error", err.Error()))
+		return
+	}
+	if written {
+		log.DebugContext(context.Background(), "memory snapshot written",
+			slog.String("path", path),
+			slog.Duration("duration", time.Since(start)))
+	}
+}
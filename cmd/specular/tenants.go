@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/elisiariocouto/specular/internal/tenants"
+	"github.com/elisiariocouto/specular/pkg/config"
+	"github.com/elisiariocouto/specular/pkg/mirror"
+	"github.com/elisiariocouto/specular/pkg/server"
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+// newTenantMirror loads the tenants file and builds the isolated caches of tenants asking for one
+func newTenantMirror(cfg *config.Config, shared *mirror.Mirror, upstream *mirror.UpstreamClient, log *slog.Logger) (*server.TenantMirror, error) {
+	defined, err := tenants.Load(cfg.TenantsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	routes := make([]*server.Tenant, len(defined))
+	for i, tenant := range defined {
+		providers := make(mirror.ProviderRules[bool], len(tenant.Providers))
+		for _, provider := range tenant.Providers {
+			providers[provider] = true
+		}
+		routes[i] = &server.Tenant{ID: tenant.ID, Principals: tenant.Principals, Providers: providers}
+
+		if tenant.Isolated {
+			st, err := newTenantStorage(cfg, tenant, log)
+			if err != nil {
+				return nil, fmt.Errorf("tenant %q: %w", tenant.ID, err)
+			}
+			if cfg.StorageReadOnly {
+				st = storage.NewReadOnly(st)
+			}
+			m := mirror.NewMirror(st, upstream, cfg.BaseURL)
+			if err := server.ConfigureMirror(m, cfg); err != nil {
+				return nil, err
+			}
+			routes[i].Mirror = m
+		}
+
+		log.InfoContext(context.Background(), "tenant configured",
+			slog.String("tenant", tenant.ID),
+			slog.Int("principals", len(tenant.Principals)),
+			slog.Any("providers", tenant.Providers),
+			slog.Bool("isolated", tenant.Isolated),
+			slog.Int64("quota_bytes", tenant.QuotaBytes))
+	}
+
+	return server.NewTenantMirror(shared, routes), nil
+}
+
+// newTenantStorage creates the isolated cache of a tenant with the same kind of storage as the shared cache
+func newTenantStorage(cfg *config.Config, tenant tenants.Tenant, log *slog.Logger) (storage.Storage, error) {
+	if cfg.StorageType == "memory" {
+		if tenant.QuotaBytes > 0 {
+			log.WarnContext(context.Background(), "tenant quotas are only supported by filesystem storage",
+				slog.String("tenant", tenant.ID))
+		}
+		return storage.NewMemoryStorage(), nil
+	}
+
+	st, err := storage.NewFilesystemStorage(filepath.Join(cfg.TenantsCacheDir, tenant.ID))
+	if err != nil {
+		return nil, err
+	}
+	if tenant.QuotaBytes > 0 {
+		st.SetQuota(tenant.QuotaBytes, storage.QuotaPolicy(cfg.NamespaceQuotaPolicy))
+	}
+	st.SetShardArchives(cfg.ShardArchives)
+	st.SetSharedLocks(cfg.CacheLockTTL)
+	st.SetVerifyOnRead(cfg.VerifyArchives)
+	st.SetCompressMetadata(cfg.CompressMetadata)
+	st.SetDedup(storage.DedupMode(cfg.Dedup))
+	return st, nil
+}
@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Scope is a permission that can be granted to an API key
+type Scope string
+
+const (
+	// ScopeReadMirror allows reading provider metadata and archives through the mirror
+	ScopeReadMirror Scope = "read-mirror"
+	// ScopePrefetch allows triggering cache prefetches
+	ScopePrefetch Scope = "prefetch"
+	// ScopePurge allows removing cached content
+	ScopePurge Scope = "purge"
+	// ScopeStats allows reading download statistics
+	ScopeStats Scope = "stats"
+	// ScopeJobs allows listing, starting and cancelling background jobs
+	ScopeJobs Scope = "jobs"
+	// ScopeBackup allows downloading backups of the cache
+	ScopeBackup Scope = "backup"
+)
+
+// AllScopes lists every known scope
+var AllScopes = []Scope{ScopeReadMirror, ScopePrefetch, ScopePurge, ScopeStats, ScopeJobs, ScopeBackup}
+
+// Authentication methods reported on a Principal
+const (
+	MethodAdminToken = "admin_token"
+	MethodOIDC       = "oidc"
+	MethodAPIKey     = "api_key"
+)
+
+// Principal is an authenticated caller
+type Principal struct {
+	// Method is how the caller authenticated
+	Method string
+	// ID identifies the caller: the API key ID or the JWT subject
+	ID string
+	// Scopes lists the permissions granted to the caller
+	Scopes []Scope
+}
+
+// HasScope reports whether the principal was granted scope
+func (p Principal) HasScope(scope Scope) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+// principalKey is the context key for the authenticated principal
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the principal
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the principal stored in ctx, if any
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// APIKey is an entry of the API keys file
+// Only the SHA-256 hash of the secret is stored so the file itself grants no access
+type APIKey struct {
+	ID      string  `json:"id"`
+	SHA256  string  `json:"sha256"`
+	Scopes  []Scope `json:"scopes"`
+	Revoked bool    `json:"revoked"`
+}
+
+// keysFile is the on-disk format of the API keys file
+type keysFile struct {
+	Keys []APIKey `json:"keys"`
+}
+
+// KeyStore holds API keys loaded from a JSON file
+// The file can be reloaded at runtime so keys are added or revoked without a restart
+type KeyStore struct {
+	path   string
+	logger *slog.Logger
+
+	mu      sync.RWMutex
+	byHash  map[[sha256.Size]byte]APIKey
+	modTime time.Time
+}
+
+// NewKeyStore loads the API keys file at path
+func NewKeyStore(path string, logger *slog.Logger) (*KeyStore, error) {
+	ks := &KeyStore{path: path, logger: logger}
+	if err := ks.Reload(); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// Lookup returns the key matching secret
+// Revoked keys are returned with ok set to false so callers can log their use
+func (ks *KeyStore) Lookup(secret string) (key APIKey, ok bool) {
+	hash := sha256.Sum256([]byte(secret))
+
+	ks.mu.RLock()
+	key, found := ks.byHash[hash]
+	ks.mu.RUnlock()
+
+	return key, found && !key.Revoked
+}
+
+// Reload reads the keys file from disk and swaps in its contents
+// On failure the previously loaded keys stay in effect
+func (ks *KeyStore) Reload() error {
+	info, err := os.Stat(ks.path)
+	if err != nil {
+		return fmt.Errorf("failed to stat API keys file: %w", err)
+	}
+	data, err := os.ReadFile(ks.path)
+	if err != nil {
+		return fmt.Errorf("failed to read API keys file: %w", err)
+	}
+
+	var file keysFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse API keys file: %w", err)
+	}
+
+	byHash := make(map[[sha256.Size]byte]APIKey, len(file.Keys))
+	ids := make(map[string]bool, len(file.Keys))
+	for i, key := range file.Keys {
+		if key.ID == "" {
+			return fmt.Errorf("API key %d has no id", i)
+		}
+		if ids[key.ID] {
+			return fmt.Errorf("duplicate API key id %q", key.ID)
+		}
+		ids[key.ID] = true
+
+		raw, err := hex.DecodeString(key.SHA256)
+		if err != nil || len(raw) != sha256.Size {
+			return fmt.Errorf("API key %q must have a hex-encoded sha256 hash", key.ID)
+		}
+		for _, scope := range key.Scopes {
+			if !slices.Contains(AllScopes, scope) {
+				return fmt.Errorf("API key %q has unknown scope %q", key.ID, scope)
+			}
+		}
+		byHash[[sha256.Size]byte(raw)] = key
+	}
+
+	ks.mu.Lock()
+	ks.byHash = byHash
+	ks.modTime = info.ModTime()
+	ks.mu.Unlock()
+
+	return nil
+}
+
+// Watch polls the keys file and reloads it when it changes
+// It returns when the context is cancelled
+func (ks *KeyStore) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := ks.reloadIfChanged(); err != nil {
+				ks.logger.ErrorContext(ctx, "failed to reload API keys",
+					slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+// reloadIfChanged reloads the keys file if it was modified since the last load
+func (ks *KeyStore) reloadIfChanged() (bool, error) {
+	info, err := os.Stat(ks.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat API keys file: %w", err)
+	}
+
+	ks.mu.RLock()
+	unchanged := info.ModTime().Equal(ks.modTime)
+	ks.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	if err := ks.Reload(); err != nil {
+		return false, err
+	}
+	ks.logger.Info("API keys reloaded",
+		slog.String("file", ks.path))
+	return true, nil
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func writeKeysFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write keys file: %v", err)
+	}
+}
+
+func TestKeyStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	writeKeysFile(t, path, `{"keys": [{"id": "ci", "sha256": "`+hashSecret("secret")+`", "scopes": ["read-mirror", "prefetch"]}]}`)
+
+	ks, err := NewKeyStore(path, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("NewKeyStore() returned error: %v", err)
+	}
+
+	key, ok := ks.Lookup("secret")
+	if !ok || key.ID != "ci" || len(key.Scopes) != 2 {
+		t.Fatalf("expected key ci with two scopes, got %+v (ok %v)", key, ok)
+	}
+	if _, ok := ks.Lookup("other"); ok {
+		t.Fatal("expected unknown secret to be rejected")
+	}
+
+	// Revoke the key and make sure the change is picked up
+	writeKeysFile(t, path, `{"keys": [{"id": "ci", "sha256": "`+hashSecret("secret")+`", "revoked": true}]}`)
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatalf("failed to touch keys file: %v", err)
+	}
+	reloaded, err := ks.reloadIfChanged()
+	if err != nil || !reloaded {
+		t.Fatalf("expected keys to be reloaded, got %v (reloaded %v)", err, reloaded)
+	}
+
+	key, ok = ks.Lookup("secret")
+	if ok || key.ID != "ci" {
+		t.Fatalf("expected revoked key ci to be rejected, got %+v (ok %v)", key, ok)
+	}
+}
+
+func TestKeyStore_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		errorOn string
+	}{
+		{name: "malformed", content: `{"keys": [`, errorOn: "failed to parse API keys file"},
+		{name: "missing id", content: `{"keys": [{"sha256": "` + hashSecret("a") + `"}]}`, errorOn: "has no id"},
+		{name: "duplicate id", content: `{"keys": [{"id": "a", "sha256": "` + hashSecret("a") + `"}, {"id": "a", "sha256": "` + hashSecret("b") + `"}]}`, errorOn: `duplicate API key id "a"`},
+		{name: "bad hash", content: `{"keys": [{"id": "a", "sha256": "abc"}]}`, errorOn: "hex-encoded sha256 hash"},
+		{name: "unknown scope", content: `{"keys": [{"id": "a", "sha256": "` + hashSecret("a") + `", "scopes": ["root"]}]}`, errorOn: `unknown scope "root"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "keys.json")
+			writeKeysFile(t, path, tt.content)
+
+			_, err := NewKeyStore(path, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if err == nil || !strings.Contains(err.Error(), tt.errorOn) {
+				t.Fatalf("expected error containing %q, got %v", tt.errorOn, err)
+			}
+		})
+	}
+}
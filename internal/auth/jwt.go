@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidToken is returned when a token is malformed or its signature does not verify
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrTokenExpired is returned when a token is expired or not yet valid
+	ErrTokenExpired = errors.New("token expired or not yet valid")
+	// ErrClaimMismatch is returned when a token's issuer, audience or required claims do not match
+	ErrClaimMismatch = errors.New("token claims rejected")
+)
+
+// clockSkew is the leeway applied to time-based claims
+const clockSkew = time.Minute
+
+// Claims holds the decoded payload of a JWT
+type Claims map[string]any
+
+// Subject returns the sub claim
+func (c Claims) Subject() string {
+	sub, _ := c["sub"].(string)
+	return sub
+}
+
+// HasValue reports whether claim equals value, or contains it when the claim is a list
+func (c Claims) HasValue(claim, value string) bool {
+	switch v := c[claim].(type) {
+	case string:
+		return v == value
+	case []any:
+		for _, item := range v {
+			if s, ok := item.(string); ok && s == value {
+				return true
+			}
+		}
+	case bool:
+		return fmt.Sprintf("%t", v) == value
+	}
+	return false
+}
+
+// time returns a numeric date claim as a time
+func (c Claims) time(claim string) (time.Time, bool) {
+	v, ok := c[claim].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(v), 0), true
+}
+
+// header is the JOSE header of a JWT
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// parseToken splits a compact JWS into its decoded parts
+func parseToken(token string) (header, Claims, []byte, []byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return header{}, nil, nil, nil, fmt.Errorf("%w: expected 3 parts", ErrInvalidToken)
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return header{}, nil, nil, nil, fmt.Errorf("%w: bad header encoding", ErrInvalidToken)
+	}
+	var h header
+	if err := json.Unmarshal(headerJSON, &h); err != nil {
+		return header{}, nil, nil, nil, fmt.Errorf("%w: bad header", ErrInvalidToken)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return header{}, nil, nil, nil, fmt.Errorf("%w: bad payload encoding", ErrInvalidToken)
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return header{}, nil, nil, nil, fmt.Errorf("%w: bad payload", ErrInvalidToken)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return header{}, nil, nil, nil, fmt.Errorf("%w: bad signature encoding", ErrInvalidToken)
+	}
+
+	return h, claims, []byte(parts[0] + "." + parts[1]), signature, nil
+}
+
+// verifySignature checks a JWS signature with the given algorithm and public key
+// Only asymmetric algorithms are accepted, "none" and HMAC are always rejected
+func verifySignature(alg string, key crypto.PublicKey, signingInput, signature []byte) error {
+	var hasher hash.Hash
+	var hashID crypto.Hash
+	switch alg {
+	case "RS256", "ES256", "PS256":
+		hasher, hashID = sha256.New(), crypto.SHA256
+	case "RS384", "ES384", "PS384":
+		hasher, hashID = sha512.New384(), crypto.SHA384
+	case "RS512", "ES512", "PS512":
+		hasher, hashID = sha512.New(), crypto.SHA512
+	default:
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, alg)
+	}
+	hasher.Write(signingInput)
+	digest := hasher.Sum(nil)
+
+	switch alg[:2] {
+	case "RS":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%w: key type does not match algorithm", ErrInvalidToken)
+		}
+		if err := rsa.VerifyPKCS1v15(pub, hashID, digest, signature); err != nil {
+			return fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+		}
+	case "PS":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%w: key type does not match algorithm", ErrInvalidToken)
+		}
+		if err := rsa.VerifyPSS(pub, hashID, digest, signature, nil); err != nil {
+			return fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+		}
+	case "ES":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%w: key type does not match algorithm", ErrInvalidToken)
+		}
+		// JWS ECDSA signatures are the fixed-size concatenation of r and s
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return fmt.Errorf("%w: bad signature length", ErrInvalidToken)
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+		}
+	}
+	return nil
+}
+
+// validateClaims checks the registered time, issuer and audience claims
+func validateClaims(claims Claims, issuer, audience string, now time.Time) error {
+	exp, ok := claims.time("exp")
+	if !ok {
+		return fmt.Errorf("%w: missing exp claim", ErrTokenExpired)
+	}
+	if now.After(exp.Add(clockSkew)) {
+		return ErrTokenExpired
+	}
+	if nbf, ok := claims.time("nbf"); ok && now.Add(clockSkew).Before(nbf) {
+		return ErrTokenExpired
+	}
+
+	if iss, _ := claims["iss"].(string); iss != issuer {
+		return fmt.Errorf("%w: unexpected issuer %q", ErrClaimMismatch, iss)
+	}
+
+	// Issuers such as CI providers sign tokens for anyone, the audience tells Specular's tokens apart
+	if audience == "" {
+		return fmt.Errorf("%w: no audience configured", ErrClaimMismatch)
+	}
+	var audiences []string
+	switch aud := claims["aud"].(type) {
+	case string:
+		audiences = []string{aud}
+	case []any:
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				audiences = append(audiences, s)
+			}
+		}
+	}
+	if !slices.Contains(audiences, audience) {
+		return fmt.Errorf("%w: audience does not include %q", ErrClaimMismatch, audience)
+	}
+
+	return nil
+}
@@ -0,0 +1,254 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jwksRefreshInterval is the minimum time between JWKS fetches triggered by unknown key IDs
+const jwksRefreshInterval = time.Minute
+
+// jwksMaxAge is how long fetched signing keys are trusted before being refreshed
+const jwksMaxAge = time.Hour
+
+// maxDiscoveryBytes bounds the size of discovery and JWKS documents
+const maxDiscoveryBytes = 1 << 20
+
+// OIDCConfig configures JWT validation against an OpenID Connect issuer
+type OIDCConfig struct {
+	// Issuer is the expected iss claim, also used for discovery
+	Issuer string
+	// Audience is the expected aud claim, required since the issuer may sign tokens for other services too
+	Audience string
+	// RequiredClaims maps claim names to a value the claim must equal or contain
+	RequiredClaims map[string]string
+}
+
+// OIDCVerifier validates JWTs issued by an OpenID Connect provider
+// Signing keys are discovered from the issuer and cached
+type OIDCVerifier struct {
+	config     OIDCConfig
+	httpClient *http.Client
+	now        func() time.Time
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	lastFetch time.Time
+	jwksURI   string
+}
+
+// NewOIDCVerifier creates a verifier for the configured issuer
+// Keys are fetched lazily on the first verification
+func NewOIDCVerifier(config OIDCConfig, httpClient *http.Client) *OIDCVerifier {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &OIDCVerifier{
+		config:     config,
+		httpClient: httpClient,
+		now:        time.Now,
+	}
+}
+
+// Verify validates the token signature and claims, returning the claims on success
+func (v *OIDCVerifier) Verify(ctx context.Context, token string) (Claims, error) {
+	h, claims, signingInput, signature, err := parseToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := v.key(ctx, h.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(h.Alg, key, signingInput, signature); err != nil {
+		return nil, err
+	}
+
+	if err := validateClaims(claims, v.config.Issuer, v.config.Audience, v.now()); err != nil {
+		return nil, err
+	}
+	for claim, value := range v.config.RequiredClaims {
+		if !claims.HasValue(claim, value) {
+			return nil, fmt.Errorf("%w: claim %q does not contain %q", ErrClaimMismatch, claim, value)
+		}
+	}
+
+	return claims, nil
+}
+
+// key returns the signing key with the given ID, refreshing the JWKS when needed
+func (v *OIDCVerifier) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	now := v.now()
+	stale := v.keys == nil || now.Sub(v.lastFetch) > jwksMaxAge
+	_, known := v.lookup(kid)
+	if stale || (!known && now.Sub(v.lastFetch) > jwksRefreshInterval) {
+		if err := v.refresh(ctx); err != nil && v.keys == nil {
+			return nil, err
+		}
+	}
+
+	key, ok := v.lookup(kid)
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidToken, kid)
+	}
+	return key, nil
+}
+
+// lookup finds a cached key by ID, an empty ID matches when there is a single key
+// Must be called with the lock held
+func (v *OIDCVerifier) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, true
+		}
+	}
+	key, ok := v.keys[kid]
+	return key, ok
+}
+
+// refresh fetches the JWKS, discovering its location from the issuer on first use
+// Must be called with the lock held
+func (v *OIDCVerifier) refresh(ctx context.Context) error {
+	v.lastFetch = v.now()
+
+	if v.jwksURI == "" {
+		var discovery struct {
+			Issuer  string `json:"issuer"`
+			JWKSURI string `json:"jwks_uri"`
+		}
+		discoveryURL := strings.TrimSuffix(v.config.Issuer, "/") + "/.well-known/openid-configuration"
+		if err := v.fetchJSON(ctx, discoveryURL, &discovery); err != nil {
+			return fmt.Errorf("OIDC discovery failed: %w", err)
+		}
+		if discovery.Issuer != v.config.Issuer {
+			return fmt.Errorf("OIDC discovery returned issuer %q, expected %q", discovery.Issuer, v.config.Issuer)
+		}
+		if discovery.JWKSURI == "" {
+			return fmt.Errorf("OIDC discovery document has no jwks_uri")
+		}
+		v.jwksURI = discovery.JWKSURI
+	}
+
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := v.fetchJSON(ctx, v.jwksURI, &jwks); err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			// Skip keys of unsupported types rather than failing the whole set
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	v.keys = keys
+
+	return nil
+}
+
+// fetchJSON retrieves and decodes a JSON document
+func (v *OIDCVerifier) fetchJSON(ctx context.Context, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := v.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, maxDiscoveryBytes)).Decode(out)
+}
+
+// jwk is a JSON Web Key as published in a JWKS document
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey converts the JWK into an RSA or ECDSA public key
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA modulus: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA exponent: %w", err)
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("RSA exponent too large")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC x coordinate: %w", err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC y coordinate: %w", err)
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) > size || len(y) > size {
+			return nil, fmt.Errorf("EC coordinates too large for curve %s", k.Crv)
+		}
+		point := make([]byte, 1+2*size)
+		point[0] = 4
+		copy(point[1+size-len(x):1+size], x)
+		copy(point[1+2*size-len(y):], y)
+		return ecdsa.ParseUncompressedPublicKey(curve, point)
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
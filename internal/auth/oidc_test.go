@@ -0,0 +1,283 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testIssuer serves OIDC discovery and a JWKS with one RSA and one EC key
+type testIssuer struct {
+	server   *httptest.Server
+	rsaKey   *rsa.PrivateKey
+	ecKey    *ecdsa.PrivateKey
+	jwksHits int
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate EC key: %v", err)
+	}
+
+	issuer := &testIssuer{rsaKey: rsaKey, ecKey: ecKey}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   issuer.server.URL,
+			"jwks_uri": issuer.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		issuer.jwksHits++
+		b64 := base64.RawURLEncoding.EncodeToString
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{
+				{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+				{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+			},
+		})
+	})
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+
+	return issuer
+}
+
+// sign creates a compact JWS for the claims using the named key
+func (i *testIssuer) sign(t *testing.T, alg, kid string, claims map[string]any) string {
+	t.Helper()
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	headerJSON, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signingInput := b64(headerJSON) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	var signature []byte
+	switch alg {
+	case "RS256":
+		sig, err := rsa.SignPKCS1v15(rand.Reader, i.rsaKey, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatalf("failed to sign: %v", err)
+		}
+		signature = sig
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, i.ecKey, digest[:])
+		if err != nil {
+			t.Fatalf("failed to sign: %v", err)
+		}
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	case "none":
+	default:
+		t.Fatalf("unsupported test algorithm %s", alg)
+	}
+
+	return signingInput + "." + b64(signature)
+}
+
+func TestOIDCVerifier(t *testing.T) {
+	issuer := newTestIssuer(t)
+	now := time.Now()
+
+	validClaims := func() map[string]any {
+		return map[string]any{
+			"iss":    issuer.server.URL,
+			"aud":    []string{"specular", "other"},
+			"sub":    "alice",
+			"exp":    now.Add(time.Hour).Unix(),
+			"groups": []string{"platform-admins", "developers"},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		token   func() string
+		wantErr error
+	}{
+		{
+			name:  "valid RS256",
+			token: func() string { return issuer.sign(t, "RS256", "rsa-1", validClaims()) },
+		},
+		{
+			name:  "valid ES256",
+			token: func() string { return issuer.sign(t, "ES256", "ec-1", validClaims()) },
+		},
+		{
+			name: "expired",
+			token: func() string {
+				c := validClaims()
+				c["exp"] = now.Add(-time.Hour).Unix()
+				return issuer.sign(t, "RS256", "rsa-1", c)
+			},
+			wantErr: ErrTokenExpired,
+		},
+		{
+			name: "not yet valid",
+			token: func() string {
+				c := validClaims()
+				c["nbf"] = now.Add(time.Hour).Unix()
+				return issuer.sign(t, "RS256", "rsa-1", c)
+			},
+			wantErr: ErrTokenExpired,
+		},
+		{
+			name: "wrong issuer",
+			token: func() string {
+				c := validClaims()
+				c["iss"] = "https://evil.example.com"
+				return issuer.sign(t, "RS256", "rsa-1", c)
+			},
+			wantErr: ErrClaimMismatch,
+		},
+		{
+			name: "wrong audience",
+			token: func() string {
+				c := validClaims()
+				c["aud"] = "someone-else"
+				return issuer.sign(t, "RS256", "rsa-1", c)
+			},
+			wantErr: ErrClaimMismatch,
+		},
+		{
+			name: "missing required group",
+			token: func() string {
+				c := validClaims()
+				c["groups"] = []string{"developers"}
+				return issuer.sign(t, "RS256", "rsa-1", c)
+			},
+			wantErr: ErrClaimMismatch,
+		},
+		{
+			name:    "alg none",
+			token:   func() string { return issuer.sign(t, "none", "rsa-1", validClaims()) },
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "key type mismatch",
+			token:   func() string { return issuer.sign(t, "RS256", "ec-1", validClaims()) },
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "unknown key",
+			token:   func() string { return issuer.sign(t, "RS256", "missing", validClaims()) },
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "tampered payload",
+			token: func() string {
+				token := issuer.sign(t, "RS256", "rsa-1", validClaims())
+				c := validClaims()
+				c["sub"] = "mallory"
+				forged := issuer.sign(t, "RS256", "rsa-1", c)
+				return forged[:len(forged)-10] + token[len(token)-10:]
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "malformed",
+			token:   func() string { return "not-a-jwt" },
+			wantErr: ErrInvalidToken,
+		},
+	}
+
+	verifier := NewOIDCVerifier(OIDCConfig{
+		Issuer:         issuer.server.URL,
+		Audience:       "specular",
+		RequiredClaims: map[string]string{"groups": "platform-admins"},
+	}, nil)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := verifier.Verify(context.Background(), tt.token())
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("expected token to verify, got %v", err)
+				}
+				if claims.Subject() != "alice" {
+					t.Errorf("expected subject alice, got %q", claims.Subject())
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestOIDCVerifier_RequiresAudience(t *testing.T) {
+	issuer := newTestIssuer(t)
+	verifier := NewOIDCVerifier(OIDCConfig{Issuer: issuer.server.URL}, nil)
+
+	// Without a configured audience any token of the issuer would pass, none is accepted instead
+	token := issuer.sign(t, "RS256", "rsa-1", map[string]any{
+		"iss": issuer.server.URL,
+		"aud": "another-app",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	if _, err := verifier.Verify(context.Background(), token); !errors.Is(err, ErrClaimMismatch) {
+		t.Errorf("expected ErrClaimMismatch without a configured audience, got %v", err)
+	}
+}
+
+func TestOIDCVerifier_CachesKeys(t *testing.T) {
+	issuer := newTestIssuer(t)
+	verifier := NewOIDCVerifier(OIDCConfig{Issuer: issuer.server.URL, Audience: "specular"}, nil)
+
+	token := issuer.sign(t, "RS256", "rsa-1", map[string]any{
+		"iss": issuer.server.URL,
+		"aud": "specular",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	for range 3 {
+		if _, err := verifier.Verify(context.Background(), token); err != nil {
+			t.Fatalf("expected token to verify, got %v", err)
+		}
+	}
+
+	// Unknown key IDs within the refresh interval must not trigger refetches
+	unknown := issuer.sign(t, "RS256", "rotated", map[string]any{
+		"iss": issuer.server.URL,
+		"aud": "specular",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	for range 3 {
+		verifier.Verify(context.Background(), unknown)
+	}
+
+	if issuer.jwksHits != 1 {
+		t.Errorf("expected JWKS to be fetched once, got %d", issuer.jwksHits)
+	}
+}
+
+func TestOIDCVerifier_DiscoveryFailure(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	token := b64([]byte(`{"alg":"RS256","kid":"k"}`)) + "." + b64([]byte(`{}`)) + "." + b64([]byte("sig"))
+
+	verifier := NewOIDCVerifier(OIDCConfig{Issuer: server.URL, Audience: "specular"}, nil)
+	if _, err := verifier.Verify(context.Background(), token); err == nil {
+		t.Error("expected verification to fail when discovery is unavailable")
+	}
+}
@@ -0,0 +1,198 @@
+package jobs
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/elisiariocouto/specular/internal/stats"
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+// Mirror is the part of the mirror service used by the default job kinds
+type Mirror interface {
+	Prefetch(ctx context.Context, hostname, namespace, providerType, version string, platforms ...string) (int, error)
+	RefreshVersions(ctx context.Context, hostname, namespace, providerType string) ([]string, error)
+	PrecomputeHashes(ctx context.Context) (int, error)
+}
+
+// AutoPrefetch caches versions found by refresh jobs for the most downloaded providers,
+// so the first client asking for a new release gets a cache hit
+type AutoPrefetch struct {
+	// Top is how many of the most downloaded providers are covered, zero disables auto-prefetch
+	Top int
+	// Platforms lists the os_arch platforms fetched, every published platform is fetched when empty
+	Platforms []string
+}
+
+// RegisterDefaults registers the prefetch, refresh, refresh-indices, hashes, gc, verify, reconcile and stats-rollup job kinds
+// Kinds are only registered when the storage backend supports them, and stats-rollup when recorder is not nil
+// refresh-indices refreshes pinned providers first, then the most downloaded ones, pinned may be nil
+// Both refresh kinds prefetch new versions of popular providers according to auto, which needs a recorder
+func RegisterDefaults(q *Queue, m Mirror, store storage.Storage, recorder *stats.Recorder, pinned func(storage.Provider) bool, auto AutoPrefetch) {
+	q.Register("prefetch", func(ctx context.Context, params map[string]string) (string, error) {
+		if err := requireParams(params, "hostname", "namespace", "type", "version"); err != nil {
+			return "", err
+		}
+		// platforms is an optional comma-separated list, every platform is fetched without it
+		var platforms []string
+		if params["platforms"] != "" {
+			platforms = strings.Split(params["platforms"], ",")
+		}
+		fetched, err := m.Prefetch(ctx, params["hostname"], params["namespace"], params["type"], params["version"], platforms...)
+		return fmt.Sprintf("fetched %d archives", fetched), err
+	})
+
+	q.Register("refresh", func(ctx context.Context, params map[string]string) (string, error) {
+		if err := requireParams(params, "hostname", "namespace", "type"); err != nil {
+			return "", err
+		}
+		p := storage.Provider{Hostname: params["hostname"], Namespace: params["namespace"], Type: params["type"]}
+		added, err := m.RefreshVersions(ctx, p.Hostname, p.Namespace, p.Type)
+		if err != nil {
+			return "", err
+		}
+		if !auto.popular(recorder)[p] {
+			return "index refreshed", nil
+		}
+		prefetched, err := auto.prefetch(ctx, m, p, added)
+		return fmt.Sprintf("index refreshed, prefetched %d new versions", prefetched), err
+	})
+
+	q.Register("refresh-indices", func(ctx context.Context, _ map[string]string) (string, error) {
+		providers, err := store.ListProviders(ctx)
+		if err != nil {
+			return "", err
+		}
+		// Upstream requests are rate limited, so the important providers must not wait behind the rest
+		prioritize(providers, pinned, recorder)
+		popular := auto.popular(recorder)
+		// Keep going when one provider fails, and report the failures together
+		var errs []error
+		failed, prefetched := 0, 0
+		for _, p := range providers {
+			if err := ctx.Err(); err != nil {
+				return "", err
+			}
+			added, err := m.RefreshVersions(ctx, p.Hostname, p.Namespace, p.Type)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s/%s/%s: %w", p.Hostname, p.Namespace, p.Type, err))
+				failed++
+				continue
+			}
+			if popular[p] {
+				n, err := auto.prefetch(ctx, m, p, added)
+				prefetched += n
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s/%s/%s: %w", p.Hostname, p.Namespace, p.Type, err))
+				}
+			}
+		}
+		result := fmt.Sprintf("refreshed %d of %d indices", len(providers)-failed, len(providers))
+		if auto.Top > 0 {
+			result += fmt.Sprintf(", prefetched %d new versions", prefetched)
+		}
+		return result, errors.Join(errs...)
+	})
+
+	if _, ok := storage.As[storage.HashRecorder](store); ok {
+		q.Register("hashes", func(ctx context.Context, _ map[string]string) (string, error) {
+			hashed, err := m.PrecomputeHashes(ctx)
+			return fmt.Sprintf("recorded hashes of %d archives", hashed), err
+		})
+	}
+
+	if gc, ok := storage.As[storage.GarbageCollector](store); ok {
+		q.Register("gc", func(ctx context.Context, _ map[string]string) (string, error) {
+			removed, err := gc.CollectGarbage(ctx)
+			return fmt.Sprintf("removed %d files", removed), err
+		})
+	}
+
+	if verifier, ok := storage.As[storage.ArchiveVerifier](store); ok {
+		q.Register("verify", func(ctx context.Context, _ map[string]string) (string, error) {
+			checked, removed, err := verifier.VerifyArchives(ctx)
+			return fmt.Sprintf("checked %d archives, removed %d corrupted", checked, removed), err
+		})
+	}
+
+	if reconciler, ok := storage.As[storage.Reconciler](store); ok {
+		q.Register("reconcile", func(ctx context.Context, _ map[string]string) (string, error) {
+			contents, err := reconciler.Reconcile(ctx)
+			if err != nil {
+				return "", err
+			}
+			q.metrics.SetCacheContents(contents.Archives, contents.Bytes)
+			return fmt.Sprintf("found %d archives (%d bytes), adopted %d, removed %d orphaned sidecars",
+				contents.Archives, contents.Bytes, contents.Adopted, contents.Orphans), nil
+		})
+	}
+
+	if recorder != nil {
+		q.Register("stats-rollup", func(context.Context, map[string]string) (string, error) {
+			return fmt.Sprintf("dropped %d expired buckets", recorder.Prune()), nil
+		})
+	}
+}
+
+// popular returns the providers covered by auto-prefetch, the most downloaded over the stats retention
+func (a AutoPrefetch) popular(recorder *stats.Recorder) map[storage.Provider]bool {
+	popular := make(map[storage.Provider]bool)
+	if a.Top <= 0 || recorder == nil {
+		return popular
+	}
+	for _, p := range recorder.Top(recorder.Retention(), a.Top).Providers {
+		popular[storage.Provider{Hostname: p.Hostname, Namespace: p.Namespace, Type: p.Type}] = true
+	}
+	return popular
+}
+
+// prefetch caches the configured platforms of versions, returning how many versions were cached
+// Versions that fail are reported together once the others have been tried
+func (a AutoPrefetch) prefetch(ctx context.Context, m Mirror, p storage.Provider, versions []string) (int, error) {
+	var errs []error
+	prefetched := 0
+	for _, version := range versions {
+		if _, err := m.Prefetch(ctx, p.Hostname, p.Namespace, p.Type, version, a.Platforms...); err != nil {
+			errs = append(errs, fmt.Errorf("prefetch %s: %w", version, err))
+			continue
+		}
+		prefetched++
+	}
+	return prefetched, errors.Join(errs...)
+}
+
+// prioritize orders providers pinned first, then by downloads over the stats retention, keeping the order of ties
+func prioritize(providers []storage.Provider, pinned func(storage.Provider) bool, recorder *stats.Recorder) {
+	downloads := make(map[storage.Provider]int64)
+	if recorder != nil {
+		for _, p := range recorder.Top(recorder.Retention(), 0).Providers {
+			downloads[storage.Provider{Hostname: p.Hostname, Namespace: p.Namespace, Type: p.Type}] = p.Downloads
+		}
+	}
+	isPinned := func(p storage.Provider) bool {
+		return pinned != nil && pinned(p)
+	}
+	slices.SortStableFunc(providers, func(a, b storage.Provider) int {
+		if pa, pb := isPinned(a), isPinned(b); pa != pb {
+			if pa {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Compare(downloads[b], downloads[a])
+	})
+}
+
+// requireParams returns an error naming the first missing parameter
+func requireParams(params map[string]string, names ...string) error {
+	for _, name := range names {
+		if params[name] == "" {
+			return fmt.Errorf("missing parameter %q", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,373 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/elisiariocouto/specular/pkg/metrics"
+)
+
+// maxFinished is the number of finished jobs kept for the status API
+const maxFinished = 1000
+
+// Status is the state of a job
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+)
+
+// Finished reports whether a job in this status will not change again
+func (s Status) Finished() bool {
+	return s == StatusSucceeded || s == StatusFailed || s == StatusCancelled
+}
+
+var (
+	// ErrUnknownKind is returned when enqueueing a job of a kind with no handler
+	ErrUnknownKind = errors.New("unknown job kind")
+	// ErrQueueFull is returned when the queue already holds its maximum number of waiting jobs
+	ErrQueueFull = errors.New("job queue is full")
+	// ErrNotFound is returned for unknown job IDs
+	ErrNotFound = errors.New("job not found")
+	// ErrFinished is returned when cancelling a job that already finished
+	ErrFinished = errors.New("job already finished")
+)
+
+// Handler runs a job and returns a short summary of its result
+type Handler func(ctx context.Context, params map[string]string) (string, error)
+
+// Job is the record of a background job
+type Job struct {
+	ID         string            `json:"id"`
+	Kind       string            `json:"kind"`
+	Params     map[string]string `json:"params,omitempty"`
+	Status     Status            `json:"status"`
+	Result     string            `json:"result,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	CreatedAt  time.Time         `json:"created_at"`
+	StartedAt  *time.Time        `json:"started_at,omitempty"`
+	FinishedAt *time.Time        `json:"finished_at,omitempty"`
+}
+
+// Options configures a job queue
+type Options struct {
+	// Workers is the number of jobs run at the same time
+	Workers int
+	// QueueSize is the maximum number of jobs waiting for a worker
+	QueueSize int
+	// Path is the file job records are persisted to, empty keeps them in memory only
+	Path string
+}
+
+// Queue runs background jobs on a fixed pool of workers
+type Queue struct {
+	opts     Options
+	metrics  *metrics.Metrics
+	logger   *slog.Logger
+	handlers map[string]Handler
+
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	pending chan string
+	cancels map[string]context.CancelFunc
+}
+
+// NewQueue creates a job queue and loads the records persisted at opts.Path
+// Jobs that were queued or running when the previous process stopped are marked failed
+func NewQueue(opts Options, m *metrics.Metrics, logger *slog.Logger) (*Queue, error) {
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	if opts.QueueSize < 1 {
+		opts.QueueSize = 1
+	}
+	q := &Queue{
+		opts:     opts,
+		metrics:  m,
+		logger:   logger,
+		handlers: make(map[string]Handler),
+		jobs:     make(map[string]*Job),
+		pending:  make(chan string, opts.QueueSize),
+		cancels:  make(map[string]context.CancelFunc),
+	}
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// Register adds the handler for a job kind
+// Must be called before the queue is used
+func (q *Queue) Register(kind string, handler Handler) {
+	q.handlers[kind] = handler
+}
+
+// Kinds returns the registered job kinds in sorted order
+func (q *Queue) Kinds() []string {
+	kinds := make([]string, 0, len(q.handlers))
+	for kind := range q.handlers {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// Enqueue adds a job to the queue and returns its record
+func (q *Queue) Enqueue(kind string, params map[string]string) (Job, error) {
+	if _, ok := q.handlers[kind]; !ok {
+		return Job{}, fmt.Errorf("%w: %q", ErrUnknownKind, kind)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job := &Job{
+		ID:        newID(),
+		Kind:      kind,
+		Params:    params,
+		Status:    StatusQueued,
+		CreatedAt: time.Now().UTC(),
+	}
+	select {
+	case q.pending <- job.ID:
+	default:
+		return Job{}, ErrQueueFull
+	}
+	q.jobs[job.ID] = job
+	q.metrics.SetJobsQueueDepth(len(q.pending))
+	q.saveLocked()
+	return *job, nil
+}
+
+// Get returns the record of a job
+func (q *Queue) Get(id string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	return *job, nil
+}
+
+// List returns all job records, newest first
+func (q *Queue) List() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	jobs := make([]Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+	return jobs
+}
+
+// Cancel stops a running job or removes a queued one from the queue
+func (q *Queue) Cancel(id string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	switch {
+	case job.Status.Finished():
+		return *job, ErrFinished
+	case job.Status == StatusRunning:
+		// The worker records the cancellation once the handler returns
+		q.cancels[id]()
+	default:
+		// The worker skips the job when it is dequeued
+		q.finishLocked(job, StatusCancelled, "", nil)
+	}
+	return *job, nil
+}
+
+// Run starts the workers and blocks until ctx is done and running jobs have returned
+func (q *Queue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for range q.opts.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case id := <-q.pending:
+					q.run(ctx, id)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// run runs a single job unless it was cancelled while queued
+func (q *Queue) run(ctx context.Context, id string) {
+	q.mu.Lock()
+	q.metrics.SetJobsQueueDepth(len(q.pending))
+	job, ok := q.jobs[id]
+	if !ok || job.Status != StatusQueued {
+		q.mu.Unlock()
+		return
+	}
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	q.cancels[id] = cancel
+	now := time.Now().UTC()
+	job.Status = StatusRunning
+	job.StartedAt = &now
+	kind, params := job.Kind, job.Params
+	q.saveLocked()
+	q.mu.Unlock()
+
+	q.logger.InfoContext(ctx, "job started", slog.String("id", id), slog.String("kind", kind))
+	result, err := q.handlers[kind](jobCtx, params)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.cancels, id)
+	switch {
+	case err != nil && jobCtx.Err() != nil && ctx.Err() == nil:
+		q.finishLocked(job, StatusCancelled, result, nil)
+	case err != nil:
+		q.finishLocked(job, StatusFailed, result, err)
+	default:
+		q.finishLocked(job, StatusSucceeded, result, nil)
+	}
+	q.logger.InfoContext(ctx, "job finished",
+		slog.String("id", id),
+		slog.String("kind", kind),
+		slog.String("status", string(job.Status)),
+		slog.String("error", job.Error))
+}
+
+// finishLocked records the outcome of a job, q.mu must be held
+func (q *Queue) finishLocked(job *Job, status Status, result string, err error) {
+	now := time.Now().UTC()
+	job.Status = status
+	job.Result = result
+	job.FinishedAt = &now
+	if err != nil {
+		job.Error = err.Error()
+	}
+	q.metrics.RecordJob(job.Kind, string(status))
+	q.pruneLocked()
+	q.saveLocked()
+}
+
+// pruneLocked drops the oldest finished jobs beyond maxFinished, q.mu must be held
+func (q *Queue) pruneLocked() {
+	var finished []*Job
+	for _, job := range q.jobs {
+		if job.Status.Finished() {
+			finished = append(finished, job)
+		}
+	}
+	if len(finished) <= maxFinished {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].FinishedAt.Before(*finished[j].FinishedAt)
+	})
+	for _, job := range finished[:len(finished)-maxFinished] {
+		delete(q.jobs, job.ID)
+	}
+}
+
+// load reads persisted job records
+func (q *Queue) load() error {
+	if q.opts.Path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(q.opts.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read jobs file: %w", err)
+	}
+
+	var jobs []*Job
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return fmt.Errorf("failed to parse jobs file: %w", err)
+	}
+	now := time.Now().UTC()
+	for _, job := range jobs {
+		if !job.Status.Finished() {
+			job.Status = StatusFailed
+			job.Error = "interrupted by restart"
+			job.FinishedAt = &now
+		}
+		q.jobs[job.ID] = job
+	}
+	return nil
+}
+
+// saveLocked atomically writes all job records to the jobs file, q.mu must be held
+// Failures are logged, the in-memory records stay authoritative
+func (q *Queue) saveLocked() {
+	if q.opts.Path == "" {
+		return
+	}
+	jobs := make([]*Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		jobs = append(jobs, job)
+	}
+	if err := writeFile(q.opts.Path, jobs); err != nil {
+		q.logger.Warn("failed to persist jobs", slog.String("path", q.opts.Path), slog.String("error", err.Error()))
+	}
+}
+
+// writeFile atomically replaces path with the JSON encoding of v
+func writeFile(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// newID returns a random job ID
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
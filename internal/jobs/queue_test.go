@@ -0,0 +1,327 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elisiariocouto/specular/internal/stats"
+	"github.com/elisiariocouto/specular/pkg/metrics"
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+func newTestQueue(t *testing.T, opts Options) *Queue {
+	t.Helper()
+	q, err := NewQueue(opts, metrics.Noop(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("NewQueue failed: %v", err)
+	}
+	return q
+}
+
+// runQueue runs the workers until the test ends
+func runQueue(t *testing.T, q *Queue) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// waitFinished polls a job until it finishes
+func waitFinished(t *testing.T, q *Queue, id string) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := q.Get(id)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		if job.Status.Finished() {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return Job{}
+}
+
+func TestQueue_Run(t *testing.T) {
+	q := newTestQueue(t, Options{Workers: 2, QueueSize: 10})
+	q.Register("echo", func(_ context.Context, params map[string]string) (string, error) {
+		return params["msg"], nil
+	})
+	q.Register("fail", func(context.Context, map[string]string) (string, error) {
+		return "", errors.New("boom")
+	})
+	runQueue(t, q)
+
+	if _, err := q.Enqueue("missing", nil); !errors.Is(err, ErrUnknownKind) {
+		t.Errorf("expected ErrUnknownKind, got %v", err)
+	}
+
+	ok, err := q.Enqueue("echo", map[string]string{"msg": "hello"})
+	if err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	failed, err := q.Enqueue("fail", nil)
+	if err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+
+	if job := waitFinished(t, q, ok.ID); job.Status != StatusSucceeded || job.Result != "hello" || job.StartedAt == nil {
+		t.Errorf("unexpected echo job: %+v", job)
+	}
+	if job := waitFinished(t, q, failed.ID); job.Status != StatusFailed || job.Error != "boom" {
+		t.Errorf("unexpected fail job: %+v", job)
+	}
+	if jobs := q.List(); len(jobs) != 2 {
+		t.Errorf("expected 2 jobs, got %d", len(jobs))
+	}
+	if _, err := q.Get("unknown"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestQueue_Cancel(t *testing.T) {
+	q := newTestQueue(t, Options{Workers: 1, QueueSize: 1})
+	started := make(chan struct{})
+	q.Register("block", func(ctx context.Context, _ map[string]string) (string, error) {
+		close(started)
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+	q.Register("noop", func(context.Context, map[string]string) (string, error) {
+		return "", nil
+	})
+
+	running, err := q.Enqueue("block", nil)
+	if err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	runQueue(t, q)
+	<-started
+
+	queued, err := q.Enqueue("noop", nil)
+	if err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	if _, err := q.Enqueue("noop", nil); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("expected ErrQueueFull, got %v", err)
+	}
+
+	if job, err := q.Cancel(queued.ID); err != nil || job.Status != StatusCancelled {
+		t.Errorf("Cancel queued = %+v, %v", job, err)
+	}
+	if _, err := q.Cancel(running.ID); err != nil {
+		t.Fatalf("Cancel running failed: %v", err)
+	}
+	if job := waitFinished(t, q, running.ID); job.Status != StatusCancelled {
+		t.Errorf("expected running job to be cancelled, got %s", job.Status)
+	}
+	if _, err := q.Cancel(running.ID); !errors.Is(err, ErrFinished) {
+		t.Errorf("expected ErrFinished, got %v", err)
+	}
+}
+
+func TestQueue_Persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	q := newTestQueue(t, Options{Workers: 1, QueueSize: 10, Path: path})
+	q.Register("noop", func(context.Context, map[string]string) (string, error) {
+		return "done", nil
+	})
+	finished, _ := q.Enqueue("noop", nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(done)
+	}()
+	waitFinished(t, q, finished.ID)
+	cancel()
+	<-done
+
+	// Still queued when the process stops
+	interrupted, err := q.Enqueue("noop", nil)
+	if err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+
+	reloaded := newTestQueue(t, Options{Path: path})
+	if job, err := reloaded.Get(finished.ID); err != nil || job.Status != StatusSucceeded || job.Result != "done" {
+		t.Errorf("reloaded finished job = %+v, %v", job, err)
+	}
+	if job, err := reloaded.Get(interrupted.ID); err != nil || job.Status != StatusFailed || job.FinishedAt == nil {
+		t.Errorf("reloaded interrupted job = %+v, %v", job, err)
+	}
+}
+
+type fakeMirror struct {
+	prefetched []string
+	refreshed  []string
+	// added is returned by every Refresh call
+	added []string
+}
+
+func (f *fakeMirror) Prefetch(_ context.Context, hostname, namespace, providerType, version string, platforms ...string) (int, error) {
+	call := hostname + "/" + namespace + "/" + providerType + "/" + version
+	if len(platforms) > 0 {
+		call += " " + strings.Join(platforms, " ")
+	}
+	f.prefetched = append(f.prefetched, call)
+	return 2, nil
+}
+
+func (f *fakeMirror) RefreshVersions(_ context.Context, hostname, namespace, providerType string) ([]string, error) {
+	f.refreshed = append(f.refreshed, hostname+"/"+namespace+"/"+providerType)
+	return f.added, nil
+}
+
+func (f *fakeMirror) PrecomputeHashes(context.Context) (int, error) {
+	return 3, nil
+}
+
+func TestRegisterDefaults(t *testing.T) {
+	q := newTestQueue(t, Options{Workers: 1, QueueSize: 10})
+	mirror := &fakeMirror{}
+	store := storage.NewMemoryStorage()
+	store.PutIndex(context.Background(), "registry.terraform.io", "hashicorp", "random", []byte(`{}`))
+	RegisterDefaults(q, mirror, store, nil, nil, AutoPrefetch{})
+	runQueue(t, q)
+
+	// Memory storage supports neither garbage collection nor verification
+	if kinds := q.Kinds(); !slices.Equal(kinds, []string{"hashes", "prefetch", "refresh", "refresh-indices"}) {
+		t.Errorf("unexpected kinds %v", kinds)
+	}
+
+	missing, _ := q.Enqueue("prefetch", map[string]string{"hostname": "registry.terraform.io"})
+	if job := waitFinished(t, q, missing.ID); job.Status != StatusFailed {
+		t.Errorf("expected prefetch without version to fail, got %+v", job)
+	}
+
+	prefetch, _ := q.Enqueue("prefetch", map[string]string{
+		"hostname":  "registry.terraform.io",
+		"namespace": "hashicorp",
+		"type":      "aws",
+		"version":   "5.0.0",
+	})
+	if job := waitFinished(t, q, prefetch.ID); job.Status != StatusSucceeded || job.Result != "fetched 2 archives" {
+		t.Errorf("unexpected prefetch job: %+v", job)
+	}
+	if len(mirror.prefetched) != 1 || mirror.prefetched[0] != "registry.terraform.io/hashicorp/aws/5.0.0" {
+		t.Errorf("unexpected prefetch calls %v", mirror.prefetched)
+	}
+
+	platforms, _ := q.Enqueue("prefetch", map[string]string{
+		"hostname":  "registry.terraform.io",
+		"namespace": "hashicorp",
+		"type":      "aws",
+		"version":   "5.0.0",
+		"platforms": "linux_amd64,darwin_arm64",
+	})
+	waitFinished(t, q, platforms.ID)
+	if len(mirror.prefetched) != 2 || mirror.prefetched[1] != "registry.terraform.io/hashicorp/aws/5.0.0 linux_amd64 darwin_arm64" {
+		t.Errorf("unexpected prefetch calls %v", mirror.prefetched)
+	}
+
+	refresh, _ := q.Enqueue("refresh-indices", nil)
+	if job := waitFinished(t, q, refresh.ID); job.Status != StatusSucceeded || job.Result != "refreshed 1 of 1 indices" {
+		t.Errorf("unexpected refresh-indices job: %+v", job)
+	}
+	if len(mirror.refreshed) != 1 || mirror.refreshed[0] != "registry.terraform.io/hashicorp/random" {
+		t.Errorf("unexpected refresh calls %v", mirror.refreshed)
+	}
+
+	hashes, _ := q.Enqueue("hashes", nil)
+	if job := waitFinished(t, q, hashes.ID); job.Status != StatusSucceeded || job.Result != "recorded hashes of 3 archives" {
+		t.Errorf("unexpected hashes job: %+v", job)
+	}
+}
+
+func TestRegisterDefaults_AutoPrefetch(t *testing.T) {
+	q := newTestQueue(t, Options{Workers: 1, QueueSize: 10})
+	mirror := &fakeMirror{added: []string{"6.1.0"}}
+	store := storage.NewMemoryStorage()
+	store.PutIndex(context.Background(), "registry.terraform.io", "hashicorp", "aws", []byte(`{}`))
+	store.PutIndex(context.Background(), "registry.terraform.io", "hashicorp", "null", []byte(`{}`))
+	recorder := stats.NewRecorder(time.Hour)
+	recorder.Record(stats.Download{Hostname: "registry.terraform.io", Namespace: "hashicorp", Type: "aws", Version: "6.0.0"})
+	RegisterDefaults(q, mirror, store, recorder, nil, AutoPrefetch{Top: 1, Platforms: []string{"linux_amd64"}})
+	runQueue(t, q)
+
+	// Only aws was downloaded, new versions of null are left for clients to fetch
+	refresh, _ := q.Enqueue("refresh-indices", nil)
+	if job := waitFinished(t, q, refresh.ID); job.Status != StatusSucceeded || job.Result != "refreshed 2 of 2 indices, prefetched 1 new versions" {
+		t.Errorf("unexpected refresh-indices job: %+v", job)
+	}
+	if !slices.Equal(mirror.prefetched, []string{"registry.terraform.io/hashicorp/aws/6.1.0 linux_amd64"}) {
+		t.Errorf("unexpected prefetch calls %v", mirror.prefetched)
+	}
+
+	single, _ := q.Enqueue("refresh", map[string]string{"hostname": "registry.terraform.io", "namespace": "hashicorp", "type": "null"})
+	if job := waitFinished(t, q, single.ID); job.Status != StatusSucceeded || job.Result != "index refreshed" {
+		t.Errorf("unexpected refresh job: %+v", job)
+	}
+	if len(mirror.prefetched) != 1 {
+		t.Errorf("unexpected prefetch calls %v", mirror.prefetched)
+	}
+}
+
+func TestPrioritize(t *testing.T) {
+	providers := []storage.Provider{
+		{Hostname: "registry.terraform.io", Namespace: "hashicorp", Type: "aws"},
+		{Hostname: "registry.terraform.io", Namespace: "hashicorp", Type: "google"},
+		{Hostname: "registry.terraform.io", Namespace: "hashicorp", Type: "null"},
+		{Hostname: "registry.terraform.io", Namespace: "hashicorp", Type: "random"},
+	}
+	recorder := stats.NewRecorder(time.Hour)
+	recorder.Record(stats.Download{Hostname: "registry.terraform.io", Namespace: "hashicorp", Type: "random", Version: "3.0.0"})
+	recorder.Record(stats.Download{Hostname: "registry.terraform.io", Namespace: "hashicorp", Type: "random", Version: "3.0.0"})
+	recorder.Record(stats.Download{Hostname: "registry.terraform.io", Namespace: "hashicorp", Type: "google", Version: "6.0.0"})
+	recorder.Record(stats.Download{Hostname: "registry.terraform.io", Namespace: "hashicorp", Type: "null", Version: "3.0.0"})
+	recorder.Record(stats.Download{Hostname: "registry.terraform.io", Namespace: "hashicorp", Type: "null", Version: "3.0.0"})
+	recorder.Record(stats.Download{Hostname: "registry.terraform.io", Namespace: "hashicorp", Type: "null", Version: "3.0.0"})
+
+	prioritize(providers, func(p storage.Provider) bool { return p.Type == "google" }, recorder)
+
+	var order []string
+	for _, p := range providers {
+		order = append(order, p.Type)
+	}
+	if want := []string{"google", "null", "random", "aws"}; !slices.Equal(order, want) {
+		t.Errorf("expected order %v, got %v", want, order)
+	}
+}
+
+func TestRegisterDefaults_Filesystem(t *testing.T) {
+	q := newTestQueue(t, Options{Workers: 1, QueueSize: 10})
+	store, err := storage.NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	RegisterDefaults(q, &fakeMirror{}, store, stats.NewRecorder(time.Hour), nil, AutoPrefetch{})
+	runQueue(t, q)
+
+	want := []string{"gc", "hashes", "prefetch", "reconcile", "refresh", "refresh-indices", "stats-rollup", "verify"}
+	if kinds := q.Kinds(); !slices.Equal(kinds, want) {
+		t.Errorf("expected kinds %v, got %v", want, kinds)
+	}
+
+	store.PutArchive(context.Background(), "registry.terraform.io/hashicorp/aws/archive.zip", strings.NewReader("archive"))
+	reconcile, _ := q.Enqueue("reconcile", nil)
+	if job := waitFinished(t, q, reconcile.ID); job.Status != StatusSucceeded || !strings.HasPrefix(job.Result, "found 1 archives") {
+		t.Errorf("unexpected reconcile job: %+v", job)
+	}
+}
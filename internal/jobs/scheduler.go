@@ -0,0 +1,89 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Task is a job kind queued on a cron schedule
+type Task struct {
+	Kind     string
+	Schedule *Cron
+}
+
+// Scheduler queues maintenance jobs on their cron schedules
+type Scheduler struct {
+	queue  *Queue
+	tasks  []Task
+	jitter time.Duration
+	logger *slog.Logger
+	now    func() time.Time
+}
+
+// NewScheduler creates a scheduler queueing tasks on q
+// Each run is delayed by a random duration up to jitter, so replicas sharing a schedule do not all start together
+// Scheduled jobs get no parameters, so only kinds that need none can be scheduled
+func NewScheduler(q *Queue, tasks []Task, jitter time.Duration, logger *slog.Logger) (*Scheduler, error) {
+	kinds := q.Kinds()
+	for _, task := range tasks {
+		if !slices.Contains(kinds, task.Kind) {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownKind, task.Kind)
+		}
+	}
+	return &Scheduler{
+		queue:  q,
+		tasks:  tasks,
+		jitter: jitter,
+		logger: logger,
+		now:    time.Now,
+	}, nil
+}
+
+// Run queues jobs as their schedules come due until ctx is done
+func (s *Scheduler) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, task := range s.tasks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.runTask(ctx, task)
+		}()
+	}
+	wg.Wait()
+}
+
+// runTask queues a single task every time its schedule comes due
+func (s *Scheduler) runTask(ctx context.Context, task Task) {
+	for {
+		next := task.Schedule.Next(s.now())
+		if s.jitter > 0 {
+			next = next.Add(rand.N(s.jitter))
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		job, err := s.queue.Enqueue(task.Kind, nil)
+		if err != nil {
+			s.logger.WarnContext(ctx, "failed to queue scheduled job",
+				slog.String("kind", task.Kind),
+				slog.String("schedule", task.Schedule.String()),
+				slog.String("error", err.Error()))
+			continue
+		}
+		s.logger.InfoContext(ctx, "queued scheduled job",
+			slog.String("id", job.ID),
+			slog.String("kind", task.Kind),
+			slog.String("schedule", task.Schedule.String()))
+	}
+}
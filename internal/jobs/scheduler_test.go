@@ -0,0 +1,100 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestParseCron_Next(t *testing.T) {
+	// Saturday
+	from := time.Date(2025, 12, 20, 10, 17, 30, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2025, 12, 20, 10, 18, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2025, 12, 20, 10, 30, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2025, 12, 21, 3, 0, 0, 0, time.UTC)},
+		{"30 2,14 * * *", time.Date(2025, 12, 20, 14, 30, 0, 0, time.UTC)},
+		{"0 0 * * 1-5", time.Date(2025, 12, 22, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2025, 12, 21, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Either day field matches when both are restricted
+		{"0 0 25 * 1", time.Date(2025, 12, 22, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2025, 12, 20, 11, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2025, 12, 21, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		cron, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Errorf("ParseCron(%q) failed: %v", tt.expr, err)
+			continue
+		}
+		if got := cron.Next(from); !got.Equal(tt.want) {
+			t.Errorf("%q: Next = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseCron_Invalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *", "0 0 31 2 *", "@yearly"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q): expected error", expr)
+		}
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	q := newTestQueue(t, Options{Workers: 1, QueueSize: 10})
+	q.Register("gc", func(context.Context, map[string]string) (string, error) {
+		return "", nil
+	})
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	cron, _ := ParseCron("* * * * *")
+	if _, err := NewScheduler(q, []Task{{Kind: "prefetch", Schedule: cron}}, 0, logger); !errors.Is(err, ErrUnknownKind) {
+		t.Errorf("expected ErrUnknownKind, got %v", err)
+	}
+
+	scheduler, err := NewScheduler(q, []Task{{Kind: "gc", Schedule: cron}}, 0, logger)
+	if err != nil {
+		t.Fatalf("NewScheduler failed: %v", err)
+	}
+	// Pretend the next minute starts right away, later runs use the real clock
+	first := true
+	scheduler.now = func() time.Time {
+		if first {
+			first = false
+			return time.Now().Truncate(time.Minute).Add(-time.Minute)
+		}
+		return time.Now()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		scheduler.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(q.List()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("scheduled job was not queued")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if job := q.List()[0]; job.Kind != "gc" {
+		t.Errorf("unexpected scheduled job %+v", job)
+	}
+}
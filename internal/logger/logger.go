@@ -1,33 +1,209 @@
 package logger
 
 import (
+	"bytes"
+	"context"
+	"fmt"
 	"io"
 	"log/slog"
+	"net"
+	"net/url"
 	"os"
 	"strings"
+	"sync"
 )
 
+// redactedValue replaces values scrubbed from log records
+const redactedValue = "[REDACTED]"
+
+// Attribute keys holding values that may need redaction
+var (
+	clientIPKeys  = map[string]bool{"remote_addr": true, "client_ip": true}
+	authTokenKeys = map[string]bool{"authorization": true, "token": true, "api_key": true}
+	urlKeys       = map[string]bool{"url": true, "download_url": true, "path": true, "uri": true}
+)
+
+// Redaction controls which sensitive values are scrubbed from log records
+type Redaction struct {
+	// ClientIPs replaces client addresses entirely
+	ClientIPs bool
+	// AnonymizeIPs masks client addresses to their network (/24 for IPv4, /48 for IPv6)
+	AnonymizeIPs bool
+	// AuthTokens replaces credentials such as Authorization headers and tokens
+	AuthTokens bool
+	// QueryStrings strips query strings from logged URLs
+	QueryStrings bool
+}
+
+// levelSink receives fully formatted log lines together with their level
+// Implemented by outputs that carry their own severity, such as syslog and journald
+type levelSink interface {
+	WriteLevel(level slog.Level, line []byte) error
+}
+
 // SetupLogger initializes the structured logger
-func SetupLogger(logLevel, logFormat string) *slog.Logger {
+// logOutput selects where logs are written: stdout, stderr, syslog or journald
+// syslogAddress is only used by the syslog output, an empty value uses the local syslog daemon
+func SetupLogger(logLevel, logFormat, logOutput, syslogAddress string, redaction Redaction) (*slog.Logger, error) {
 	var handler slog.Handler
-	var output io.Writer = os.Stdout
 
-	level := slogLevelFromString(logLevel)
+	opts := &slog.HandlerOptions{
+		Level:       slogLevelFromString(logLevel),
+		ReplaceAttr: redaction.replaceAttr,
+	}
 
-	if strings.ToLower(logFormat) == "json" {
-		handler = slog.NewJSONHandler(output, &slog.HandlerOptions{
-			Level: level,
-		})
-	} else {
-		handler = slog.NewTextHandler(output, &slog.HandlerOptions{
-			Level: level,
-		})
+	switch strings.ToLower(logOutput) {
+	case "", "stdout":
+		handler = newFormatHandler(os.Stdout, logFormat, opts)
+	case "stderr":
+		handler = newFormatHandler(os.Stderr, logFormat, opts)
+	case "syslog":
+		sink, err := newSyslogSink(syslogAddress)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+		}
+		handler = newSinkHandler(sink, logFormat, opts)
+	case "journald":
+		sink, err := newJournaldSink()
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to journald: %w", err)
+		}
+		handler = newSinkHandler(sink, logFormat, opts)
+	default:
+		return nil, fmt.Errorf("unknown log output: %s", logOutput)
 	}
 
 	logger := slog.New(handler)
 	slog.SetDefault(logger)
 
-	return logger
+	return logger, nil
+}
+
+// newFormatHandler creates a JSON or text handler writing to output
+func newFormatHandler(output io.Writer, logFormat string, opts *slog.HandlerOptions) slog.Handler {
+	if strings.ToLower(logFormat) == "json" {
+		return slog.NewJSONHandler(output, opts)
+	}
+	return slog.NewTextHandler(output, opts)
+}
+
+// sinkOutput is the formatting buffer shared by a sinkHandler and its derived handlers
+type sinkOutput struct {
+	mu   sync.Mutex
+	buf  bytes.Buffer
+	sink levelSink
+}
+
+// sinkHandler formats records with a regular JSON/text handler and forwards
+// each resulting line to a levelSink along with the record level
+type sinkHandler struct {
+	inner slog.Handler
+	out   *sinkOutput
+}
+
+// newSinkHandler creates a handler that writes formatted records to sink
+func newSinkHandler(sink levelSink, logFormat string, opts *slog.HandlerOptions) *sinkHandler {
+	out := &sinkOutput{sink: sink}
+	return &sinkHandler{
+		inner: newFormatHandler(&out.buf, logFormat, opts),
+		out:   out,
+	}
+}
+
+// Enabled reports whether the inner handler handles records at the given level
+func (h *sinkHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+// Handle formats the record and writes it to the sink
+func (h *sinkHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.out.mu.Lock()
+	defer h.out.mu.Unlock()
+
+	h.out.buf.Reset()
+	if err := h.inner.Handle(ctx, r); err != nil {
+		return err
+	}
+	return h.out.sink.WriteLevel(r.Level, bytes.TrimSuffix(h.out.buf.Bytes(), []byte("\n")))
+}
+
+// WithAttrs returns a handler with additional attributes sharing the same sink
+func (h *sinkHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &sinkHandler{inner: h.inner.WithAttrs(attrs), out: h.out}
+}
+
+// WithGroup returns a handler with a group sharing the same sink
+func (h *sinkHandler) WithGroup(name string) slog.Handler {
+	return &sinkHandler{inner: h.inner.WithGroup(name), out: h.out}
+}
+
+// replaceAttr scrubs sensitive attribute values according to the redaction settings
+func (rd Redaction) replaceAttr(groups []string, a slog.Attr) slog.Attr {
+	if a.Value.Kind() != slog.KindString {
+		return a
+	}
+	key := strings.ToLower(a.Key)
+
+	switch {
+	case clientIPKeys[key]:
+		if rd.ClientIPs {
+			return slog.String(a.Key, redactedValue)
+		}
+		if rd.AnonymizeIPs {
+			return slog.String(a.Key, anonymizeIP(a.Value.String()))
+		}
+	case authTokenKeys[key]:
+		if rd.AuthTokens && a.Value.String() != "" {
+			return slog.String(a.Key, redactedValue)
+		}
+	case urlKeys[key]:
+		if rd.QueryStrings {
+			return slog.String(a.Key, stripQuery(a.Value.String()))
+		}
+	}
+	return a
+}
+
+// anonymizeIP masks the host part of an address, keeping the port if present
+// IPv4 addresses keep their /24 network and IPv6 addresses their /48 network
+func anonymizeIP(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, port = addr, ""
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return redactedValue
+	}
+
+	var masked string
+	if ip4 := ip.To4(); ip4 != nil {
+		masked = ip4.Mask(net.CIDRMask(24, 32)).String()
+	} else {
+		masked = ip.Mask(net.CIDRMask(48, 128)).String()
+	}
+
+	if port != "" {
+		return net.JoinHostPort(masked, port)
+	}
+	return masked
+}
+
+// stripQuery removes the query string and fragment from a URL
+func stripQuery(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		if i := strings.IndexAny(raw, "?#"); i >= 0 {
+			return raw[:i]
+		}
+		return raw
+	}
+	u.RawQuery = ""
+	u.ForceQuery = false
+	u.Fragment = ""
+	u.RawFragment = ""
+	return u.String()
 }
 
 // slogLevelFromString converts a string to slog.Level
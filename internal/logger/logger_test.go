@@ -0,0 +1,81 @@
+package logger
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// recordingSink captures lines written to it along with their levels
+type recordingSink struct {
+	levels []slog.Level
+	lines  []string
+}
+
+func (s *recordingSink) WriteLevel(level slog.Level, line []byte) error {
+	s.levels = append(s.levels, level)
+	s.lines = append(s.lines, string(line))
+	return nil
+}
+
+func TestSinkHandler(t *testing.T) {
+	sink := &recordingSink{}
+	logger := slog.New(newSinkHandler(sink, "json", &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+	logger.Debug("dropped")
+	logger.Info("first", slog.String("key", "value"))
+	logger.With(slog.String("component", "mirror")).Error("second")
+
+	if len(sink.lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d: %v", len(sink.lines), sink.lines)
+	}
+	if sink.levels[0] != slog.LevelInfo || sink.levels[1] != slog.LevelError {
+		t.Errorf("unexpected levels: %v", sink.levels)
+	}
+	if !strings.Contains(sink.lines[0], `"msg":"first"`) || !strings.Contains(sink.lines[0], `"key":"value"`) {
+		t.Errorf("unexpected first line: %s", sink.lines[0])
+	}
+	if !strings.Contains(sink.lines[1], `"component":"mirror"`) {
+		t.Errorf("expected derived handler attributes in second line: %s", sink.lines[1])
+	}
+	for _, line := range sink.lines {
+		if strings.HasSuffix(line, "\n") {
+			t.Errorf("expected trailing newline to be trimmed: %q", line)
+		}
+	}
+}
+
+func TestSetupLogger_UnknownOutput(t *testing.T) {
+	if _, err := SetupLogger("info", "json", "carrier-pigeon", "", Redaction{}); err == nil {
+		t.Fatal("expected error for unknown log output")
+	}
+}
+
+func TestRedaction(t *testing.T) {
+	tests := []struct {
+		name      string
+		redaction Redaction
+		attr      slog.Attr
+		want      string
+	}{
+		{name: "ip kept", redaction: Redaction{}, attr: slog.String("remote_addr", "10.1.2.3:5555"), want: "10.1.2.3:5555"},
+		{name: "ip redacted", redaction: Redaction{ClientIPs: true}, attr: slog.String("remote_addr", "10.1.2.3:5555"), want: redactedValue},
+		{name: "ipv4 anonymized", redaction: Redaction{AnonymizeIPs: true}, attr: slog.String("remote_addr", "10.1.2.3:5555"), want: "10.1.2.0:5555"},
+		{name: "ipv6 anonymized", redaction: Redaction{AnonymizeIPs: true}, attr: slog.String("client_ip", "2001:db8:abcd:12::1"), want: "2001:db8:abcd::"},
+		{name: "invalid ip anonymized", redaction: Redaction{AnonymizeIPs: true}, attr: slog.String("client_ip", "not-an-ip"), want: redactedValue},
+		{name: "auth redacted", redaction: Redaction{AuthTokens: true}, attr: slog.String("authorization", "Bearer abc"), want: redactedValue},
+		{name: "auth kept", redaction: Redaction{}, attr: slog.String("token", "abc"), want: "abc"},
+		{name: "query stripped", redaction: Redaction{QueryStrings: true}, attr: slog.String("download_url", "https://cdn.example.com/a.zip?X-Amz-Signature=abc"), want: "https://cdn.example.com/a.zip"},
+		{name: "query kept", redaction: Redaction{}, attr: slog.String("url", "https://example.com/?a=b"), want: "https://example.com/?a=b"},
+		{name: "other keys untouched", redaction: Redaction{ClientIPs: true, AuthTokens: true, QueryStrings: true}, attr: slog.String("hostname", "registry.terraform.io"), want: "registry.terraform.io"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.redaction.replaceAttr(nil, tt.attr)
+			if got.Value.String() != tt.want {
+				t.Errorf("replaceAttr(%s) = %q, want %q", tt.attr, got.Value.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+//go:build windows || plan9
+
+package logger
+
+import (
+	"errors"
+	"log/slog"
+)
+
+// errSinkUnsupported is returned for log outputs not available on this platform
+var errSinkUnsupported = errors.New("log output not supported on this platform")
+
+// unsupportedSink is never constructed; it satisfies levelSink on platforms without syslog
+type unsupportedSink struct{}
+
+// WriteLevel always fails
+func (unsupportedSink) WriteLevel(level slog.Level, line []byte) error {
+	return errSinkUnsupported
+}
+
+// newSyslogSink is not supported on this platform
+func newSyslogSink(address string) (*unsupportedSink, error) {
+	return nil, errSinkUnsupported
+}
+
+// newJournaldSink is not supported on this platform
+func newJournaldSink() (*unsupportedSink, error) {
+	return nil, errSinkUnsupported
+}
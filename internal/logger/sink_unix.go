@@ -0,0 +1,103 @@
+//go:build !windows && !plan9
+
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"log/syslog"
+	"net"
+	"strings"
+)
+
+// syslogTag identifies specular in syslog and journald entries
+const syslogTag = "specular"
+
+// journaldSocket is the native journald protocol socket
+const journaldSocket = "/run/systemd/journal/socket"
+
+// syslogSink writes log lines to syslog with a severity derived from the record level
+type syslogSink struct {
+	writer *syslog.Writer
+}
+
+// newSyslogSink connects to syslog
+// address is either empty for the local daemon, or network://host:port (e.g., udp://logs:514)
+func newSyslogSink(address string) (*syslogSink, error) {
+	var network, raddr string
+	if address != "" {
+		var ok bool
+		network, raddr, ok = strings.Cut(address, "://")
+		if !ok {
+			return nil, fmt.Errorf("invalid syslog address %q, expected network://host:port", address)
+		}
+	}
+
+	writer, err := syslog.Dial(network, raddr, syslog.LOG_INFO|syslog.LOG_DAEMON, syslogTag)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogSink{writer: writer}, nil
+}
+
+// WriteLevel writes a line with the syslog severity matching level
+func (s *syslogSink) WriteLevel(level slog.Level, line []byte) error {
+	msg := string(line)
+	switch {
+	case level >= slog.LevelError:
+		return s.writer.Err(msg)
+	case level >= slog.LevelWarn:
+		return s.writer.Warning(msg)
+	case level >= slog.LevelInfo:
+		return s.writer.Info(msg)
+	default:
+		return s.writer.Debug(msg)
+	}
+}
+
+// journaldSink writes log lines using the journald native protocol
+type journaldSink struct {
+	conn *net.UnixConn
+}
+
+// newJournaldSink connects to the local journald socket
+func newJournaldSink() (*journaldSink, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journaldSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &journaldSink{conn: conn}, nil
+}
+
+// WriteLevel sends a line to journald with the priority matching level
+func (s *journaldSink) WriteLevel(level slog.Level, line []byte) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "PRIORITY=%d\n", journaldPriority(level))
+	fmt.Fprintf(&buf, "SYSLOG_IDENTIFIER=%s\n", syslogTag)
+
+	// MESSAGE uses the binary-safe field encoding: name, newline,
+	// little-endian 64-bit length, data, newline
+	buf.WriteString("MESSAGE\n")
+	binary.Write(&buf, binary.LittleEndian, uint64(len(line)))
+	buf.Write(line)
+	buf.WriteByte('\n')
+
+	_, err := s.conn.Write(buf.Bytes())
+	return err
+}
+
+// journaldPriority maps a slog level to a syslog priority value
+func journaldPriority(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return 3
+	case level >= slog.LevelWarn:
+		return 4
+	case level >= slog.LevelInfo:
+		return 6
+	default:
+		return 7
+	}
+}
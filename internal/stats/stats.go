@@ -0,0 +1,319 @@
+package stats
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// bucketSize is the granularity at which downloads are aggregated
+const bucketSize = time.Hour
+
+// Download describes a single provider archive served to a client
+type Download struct {
+	Hostname  string
+	Namespace string
+	Type      string
+	Version   string
+	// Client identifies who downloaded the archive: the authenticated principal or the client IP
+	Client string
+	Bytes  int64
+	Time   time.Time
+}
+
+// ProviderStats summarizes downloads of a provider over a window
+type ProviderStats struct {
+	Hostname  string `json:"hostname"`
+	Namespace string `json:"namespace"`
+	Type      string `json:"type"`
+	Downloads int64  `json:"downloads"`
+	Bytes     int64  `json:"bytes"`
+}
+
+// VersionStats summarizes downloads of a single provider version over a window
+type VersionStats struct {
+	Hostname  string `json:"hostname"`
+	Namespace string `json:"namespace"`
+	Type      string `json:"type"`
+	Version   string `json:"version"`
+	Downloads int64  `json:"downloads"`
+	Bytes     int64  `json:"bytes"`
+}
+
+// ReportEntry summarizes downloads of a provider version by a single client over a period
+type ReportEntry struct {
+	Hostname  string `json:"hostname"`
+	Namespace string `json:"namespace"`
+	Type      string `json:"type"`
+	Version   string `json:"version"`
+	Client    string `json:"client"`
+	Downloads int64  `json:"downloads"`
+	Bytes     int64  `json:"bytes"`
+}
+
+// Report is the response of a downloads report query
+type Report struct {
+	From           time.Time     `json:"from"`
+	To             time.Time     `json:"to"`
+	TotalDownloads int64         `json:"total_downloads"`
+	TotalBytes     int64         `json:"total_bytes"`
+	Entries        []ReportEntry `json:"entries"`
+}
+
+// TopResult is the response of a top providers query
+type TopResult struct {
+	Window         string          `json:"window"`
+	TotalDownloads int64           `json:"total_downloads"`
+	TotalBytes     int64           `json:"total_bytes"`
+	Providers      []ProviderStats `json:"providers"`
+	Versions       []VersionStats  `json:"versions"`
+}
+
+// providerKey identifies a provider
+type providerKey struct {
+	hostname, namespace, providerType string
+}
+
+// versionKey identifies a provider version
+type versionKey struct {
+	providerKey
+	version string
+}
+
+// downloadKey identifies a provider version downloaded by a client
+type downloadKey struct {
+	versionKey
+	client string
+}
+
+// counter accumulates downloads and bytes
+type counter struct {
+	downloads int64
+	bytes     int64
+}
+
+// Recorder aggregates archive downloads into hourly buckets
+// Buckets older than the retention window are discarded
+type Recorder struct {
+	mu        sync.Mutex
+	retention time.Duration
+	buckets   map[int64]map[downloadKey]*counter
+	now       func() time.Time
+}
+
+// NewRecorder creates a new download recorder that keeps data for the given retention
+func NewRecorder(retention time.Duration) *Recorder {
+	return &Recorder{
+		retention: retention,
+		buckets:   make(map[int64]map[downloadKey]*counter),
+		now:       time.Now,
+	}
+}
+
+// Retention returns how far back the recorder keeps download data
+func (r *Recorder) Retention() time.Duration {
+	return r.retention
+}
+
+// Since returns the start of the oldest hour whose downloads are still kept
+func (r *Recorder) Since() time.Time {
+	return time.Unix(r.cutoff(), 0)
+}
+
+// Record adds a download to the current bucket
+func (r *Recorder) Record(d Download) {
+	if d.Time.IsZero() {
+		d.Time = r.now()
+	}
+	bucket := d.Time.Truncate(bucketSize).Unix()
+	key := downloadKey{
+		versionKey: versionKey{
+			providerKey: providerKey{d.Hostname, d.Namespace, d.Type},
+			version:     d.Version,
+		},
+		client: d.Client,
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.prune()
+	if bucket < r.cutoff() {
+		return
+	}
+
+	counters, ok := r.buckets[bucket]
+	if !ok {
+		counters = make(map[downloadKey]*counter)
+		r.buckets[bucket] = counters
+	}
+	c, ok := counters[key]
+	if !ok {
+		c = &counter{}
+		counters[key] = c
+	}
+	c.downloads++
+	c.bytes += d.Bytes
+}
+
+// Top returns the most downloaded providers and versions within the window
+// A limit of zero or less returns all entries
+func (r *Recorder) Top(window time.Duration, limit int) TopResult {
+	since := r.now().Add(-window).Truncate(bucketSize).Unix()
+
+	providers := make(map[providerKey]*counter)
+	versions := make(map[versionKey]*counter)
+	result := TopResult{Window: window.String()}
+
+	r.mu.Lock()
+	r.prune()
+	for bucket, counters := range r.buckets {
+		if bucket < since {
+			continue
+		}
+		for key, c := range counters {
+			add(versions, key.versionKey, c)
+			add(providers, key.providerKey, c)
+			result.TotalDownloads += c.downloads
+			result.TotalBytes += c.bytes
+		}
+	}
+	r.mu.Unlock()
+
+	result.Providers = make([]ProviderStats, 0, len(providers))
+	for key, c := range providers {
+		result.Providers = append(result.Providers, ProviderStats{
+			Hostname:  key.hostname,
+			Namespace: key.namespace,
+			Type:      key.providerType,
+			Downloads: c.downloads,
+			Bytes:     c.bytes,
+		})
+	}
+	sort.Slice(result.Providers, func(i, j int) bool {
+		a, b := result.Providers[i], result.Providers[j]
+		if a.Downloads != b.Downloads {
+			return a.Downloads > b.Downloads
+		}
+		return a.Hostname+"/"+a.Namespace+"/"+a.Type < b.Hostname+"/"+b.Namespace+"/"+b.Type
+	})
+
+	result.Versions = make([]VersionStats, 0, len(versions))
+	for key, c := range versions {
+		result.Versions = append(result.Versions, VersionStats{
+			Hostname:  key.hostname,
+			Namespace: key.namespace,
+			Type:      key.providerType,
+			Version:   key.version,
+			Downloads: c.downloads,
+			Bytes:     c.bytes,
+		})
+	}
+	sort.Slice(result.Versions, func(i, j int) bool {
+		a, b := result.Versions[i], result.Versions[j]
+		if a.Downloads != b.Downloads {
+			return a.Downloads > b.Downloads
+		}
+		return a.Hostname+"/"+a.Namespace+"/"+a.Type+"/"+a.Version < b.Hostname+"/"+b.Namespace+"/"+b.Type+"/"+b.Version
+	})
+
+	if limit > 0 {
+		if len(result.Providers) > limit {
+			result.Providers = result.Providers[:limit]
+		}
+		if len(result.Versions) > limit {
+			result.Versions = result.Versions[:limit]
+		}
+	}
+
+	return result
+}
+
+// Report summarizes downloads per provider version and client between from and to
+// Downloads are aggregated hourly, so the period is widened to whole hours, to being exclusive
+// Entries are sorted by provider, version and client
+func (r *Recorder) Report(from, to time.Time) Report {
+	start, end := from.Truncate(bucketSize), to.Truncate(bucketSize)
+	if end.Before(to) {
+		end = end.Add(bucketSize)
+	}
+	result := Report{From: start, To: end}
+	entries := make(map[downloadKey]*counter)
+
+	r.mu.Lock()
+	r.prune()
+	for bucket, counters := range r.buckets {
+		if bucket < start.Unix() || bucket >= end.Unix() {
+			continue
+		}
+		for key, c := range counters {
+			add(entries, key, c)
+			result.TotalDownloads += c.downloads
+			result.TotalBytes += c.bytes
+		}
+	}
+	r.mu.Unlock()
+
+	result.Entries = make([]ReportEntry, 0, len(entries))
+	for key, c := range entries {
+		result.Entries = append(result.Entries, ReportEntry{
+			Hostname:  key.hostname,
+			Namespace: key.namespace,
+			Type:      key.providerType,
+			Version:   key.version,
+			Client:    key.client,
+			Downloads: c.downloads,
+			Bytes:     c.bytes,
+		})
+	}
+	sort.Slice(result.Entries, func(i, j int) bool {
+		a, b := result.Entries[i], result.Entries[j]
+		if a.Hostname+"/"+a.Namespace+"/"+a.Type != b.Hostname+"/"+b.Namespace+"/"+b.Type {
+			return a.Hostname+"/"+a.Namespace+"/"+a.Type < b.Hostname+"/"+b.Namespace+"/"+b.Type
+		}
+		if a.Version != b.Version {
+			return a.Version < b.Version
+		}
+		return a.Client < b.Client
+	})
+
+	return result
+}
+
+// Prune drops buckets that fell outside the retention window and returns how many were dropped
+// Recording also prunes, this frees memory when no downloads happen for a while
+func (r *Recorder) Prune() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.prune()
+}
+
+// prune drops buckets that fall outside the retention window
+// Must be called with the lock held
+func (r *Recorder) prune() int {
+	cutoff := r.cutoff()
+	dropped := 0
+	for bucket := range r.buckets {
+		if bucket < cutoff {
+			delete(r.buckets, bucket)
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// cutoff returns the oldest bucket still within the retention window
+func (r *Recorder) cutoff() int64 {
+	return r.now().Add(-r.retention).Truncate(bucketSize).Unix()
+}
+
+// add accumulates a counter into the map entry for key
+func add[K comparable](m map[K]*counter, key K, c *counter) {
+	total, ok := m[key]
+	if !ok {
+		total = &counter{}
+		m[key] = total
+	}
+	total.downloads += c.downloads
+	total.bytes += c.bytes
+}
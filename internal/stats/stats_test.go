@@ -0,0 +1,160 @@
+package stats
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestRecorder(retention time.Duration, now time.Time) *Recorder {
+	r := NewRecorder(retention)
+	r.now = func() time.Time { return now }
+	return r
+}
+
+func TestRecorder_Top(t *testing.T) {
+	now := time.Date(2025, 12, 20, 12, 30, 0, 0, time.UTC)
+	r := newTestRecorder(7*24*time.Hour, now)
+
+	r.Record(Download{Hostname: "registry.terraform.io", Namespace: "hashicorp", Type: "aws", Version: "6.0.0", Bytes: 100})
+	r.Record(Download{Hostname: "registry.terraform.io", Namespace: "hashicorp", Type: "aws", Version: "6.0.0", Bytes: 100})
+	r.Record(Download{Hostname: "registry.terraform.io", Namespace: "hashicorp", Type: "aws", Version: "5.0.0", Bytes: 90})
+	r.Record(Download{Hostname: "registry.terraform.io", Namespace: "hashicorp", Type: "random", Version: "3.0.0", Bytes: 10})
+
+	result := r.Top(24*time.Hour, 0)
+
+	if result.TotalDownloads != 4 {
+		t.Errorf("TotalDownloads = %d, want 4", result.TotalDownloads)
+	}
+	if result.TotalBytes != 300 {
+		t.Errorf("TotalBytes = %d, want 300", result.TotalBytes)
+	}
+	if len(result.Providers) != 2 {
+		t.Fatalf("expected 2 providers, got %d", len(result.Providers))
+	}
+	if result.Providers[0].Type != "aws" || result.Providers[0].Downloads != 3 || result.Providers[0].Bytes != 290 {
+		t.Errorf("unexpected top provider: %+v", result.Providers[0])
+	}
+	if len(result.Versions) != 3 {
+		t.Fatalf("expected 3 versions, got %d", len(result.Versions))
+	}
+	if result.Versions[0].Version != "6.0.0" || result.Versions[0].Downloads != 2 {
+		t.Errorf("unexpected top version: %+v", result.Versions[0])
+	}
+}
+
+func TestRecorder_TopLimit(t *testing.T) {
+	now := time.Date(2025, 12, 20, 12, 0, 0, 0, time.UTC)
+	r := newTestRecorder(24*time.Hour, now)
+
+	r.Record(Download{Hostname: "h", Namespace: "n", Type: "a", Version: "1.0.0"})
+	r.Record(Download{Hostname: "h", Namespace: "n", Type: "b", Version: "1.0.0"})
+	r.Record(Download{Hostname: "h", Namespace: "n", Type: "b", Version: "1.0.0"})
+
+	result := r.Top(time.Hour, 1)
+
+	if len(result.Providers) != 1 || result.Providers[0].Type != "b" {
+		t.Errorf("expected only provider b, got %+v", result.Providers)
+	}
+	if len(result.Versions) != 1 {
+		t.Errorf("expected 1 version, got %d", len(result.Versions))
+	}
+}
+
+func TestRecorder_Window(t *testing.T) {
+	now := time.Date(2025, 12, 20, 12, 0, 0, 0, time.UTC)
+	r := newTestRecorder(7*24*time.Hour, now)
+
+	r.Record(Download{Hostname: "h", Namespace: "n", Type: "old", Version: "1.0.0", Time: now.Add(-48 * time.Hour)})
+	r.Record(Download{Hostname: "h", Namespace: "n", Type: "new", Version: "1.0.0", Time: now.Add(-time.Hour)})
+
+	result := r.Top(24*time.Hour, 0)
+	if len(result.Providers) != 1 || result.Providers[0].Type != "new" {
+		t.Errorf("expected only recent provider in 24h window, got %+v", result.Providers)
+	}
+
+	result = r.Top(72*time.Hour, 0)
+	if len(result.Providers) != 2 {
+		t.Errorf("expected 2 providers in 72h window, got %d", len(result.Providers))
+	}
+}
+
+func TestRecorder_Retention(t *testing.T) {
+	now := time.Date(2025, 12, 20, 12, 0, 0, 0, time.UTC)
+	r := newTestRecorder(24*time.Hour, now)
+
+	r.Record(Download{Hostname: "h", Namespace: "n", Type: "expired", Version: "1.0.0", Time: now.Add(-48 * time.Hour)})
+
+	if len(r.buckets) != 0 {
+		t.Errorf("expected expired bucket to be pruned, got %d buckets", len(r.buckets))
+	}
+
+	result := r.Top(72*time.Hour, 0)
+	if result.TotalDownloads != 0 {
+		t.Errorf("expected no downloads beyond retention, got %d", result.TotalDownloads)
+	}
+}
+
+func TestRecorder_Since(t *testing.T) {
+	now := time.Date(2025, 12, 20, 12, 30, 0, 0, time.UTC)
+	r := newTestRecorder(24*time.Hour, now)
+
+	if want := time.Date(2025, 12, 19, 12, 0, 0, 0, time.UTC); !r.Since().Equal(want) {
+		t.Errorf("Since = %s, want %s", r.Since(), want)
+	}
+}
+
+func TestRecorder_Prune(t *testing.T) {
+	now := time.Date(2025, 12, 20, 12, 0, 0, 0, time.UTC)
+	r := newTestRecorder(24*time.Hour, now)
+	r.Record(Download{Hostname: "h", Namespace: "n", Type: "t", Version: "1.0.0", Time: now.Add(-2 * time.Hour)})
+	r.Record(Download{Hostname: "h", Namespace: "n", Type: "t", Version: "1.0.0", Time: now})
+
+	if dropped := r.Prune(); dropped != 0 {
+		t.Errorf("expected nothing to prune, dropped %d", dropped)
+	}
+
+	r.now = func() time.Time { return now.Add(23 * time.Hour) }
+	if dropped := r.Prune(); dropped != 1 || len(r.buckets) != 1 {
+		t.Errorf("expected 1 bucket dropped and 1 left, dropped %d left %d", dropped, len(r.buckets))
+	}
+}
+
+func TestRecorder_Report(t *testing.T) {
+	now := time.Date(2025, 12, 20, 12, 30, 0, 0, time.UTC)
+	r := newTestRecorder(30*24*time.Hour, now)
+
+	r.Record(Download{Hostname: "h", Namespace: "n", Type: "aws", Version: "6.0.0", Client: "ci", Bytes: 100})
+	r.Record(Download{Hostname: "h", Namespace: "n", Type: "aws", Version: "6.0.0", Client: "ci", Bytes: 100})
+	r.Record(Download{Hostname: "h", Namespace: "n", Type: "aws", Version: "6.0.0", Client: "10.0.0.1", Bytes: 100})
+	r.Record(Download{Hostname: "h", Namespace: "n", Type: "aws", Version: "5.0.0", Client: "ci", Bytes: 90, Time: now.Add(-48 * time.Hour)})
+	r.Record(Download{Hostname: "h", Namespace: "n", Type: "random", Version: "3.0.0", Client: "ci", Bytes: 10, Time: now.Add(-10 * 24 * time.Hour)})
+
+	report := r.Report(now.Add(-72*time.Hour), now)
+
+	if !report.From.Equal(time.Date(2025, 12, 17, 12, 0, 0, 0, time.UTC)) || !report.To.Equal(time.Date(2025, 12, 20, 13, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected period %v to %v", report.From, report.To)
+	}
+	if report.TotalDownloads != 4 || report.TotalBytes != 390 {
+		t.Errorf("unexpected totals: downloads %d bytes %d", report.TotalDownloads, report.TotalBytes)
+	}
+
+	want := []ReportEntry{
+		{Hostname: "h", Namespace: "n", Type: "aws", Version: "5.0.0", Client: "ci", Downloads: 1, Bytes: 90},
+		{Hostname: "h", Namespace: "n", Type: "aws", Version: "6.0.0", Client: "10.0.0.1", Downloads: 1, Bytes: 100},
+		{Hostname: "h", Namespace: "n", Type: "aws", Version: "6.0.0", Client: "ci", Downloads: 2, Bytes: 200},
+	}
+	if len(report.Entries) != len(want) {
+		t.Fatalf("expected %d entries, got %+v", len(want), report.Entries)
+	}
+	for i := range want {
+		if report.Entries[i] != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, report.Entries[i], want[i])
+		}
+	}
+
+	// Per-client downloads still add up per version in the top query
+	top := r.Top(time.Hour, 0)
+	if len(top.Versions) != 1 || top.Versions[0].Downloads != 3 {
+		t.Errorf("unexpected top versions %+v", top.Versions)
+	}
+}
@@ -0,0 +1,94 @@
+package tenants
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/elisiariocouto/specular/pkg/config"
+)
+
+// validID matches tenant IDs, which name the directory of isolated caches
+var validID = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// Tenant is a group of principals sharing provider access rules and, optionally, an isolated cache
+type Tenant struct {
+	ID string `json:"id"`
+	// Principals lists the API key IDs and token subjects identifying the tenant
+	Principals []string `json:"principals"`
+	// Providers lists the hostname[/namespace[/type]] patterns the tenant may use, empty allows every provider
+	Providers []string `json:"providers"`
+	// Isolated gives the tenant its own cache instead of the shared one
+	Isolated bool `json:"isolated"`
+	// Quota limits the size of an isolated cache, such as "20GB"
+	Quota string `json:"quota"`
+
+	// QuotaBytes is the parsed Quota, zero when unlimited
+	QuotaBytes int64 `json:"-"`
+}
+
+// tenantsFile is the on-disk format of the tenants file
+type tenantsFile struct {
+	Tenants []Tenant `json:"tenants"`
+}
+
+// Load reads and validates the tenants file at path
+func Load(path string) ([]Tenant, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tenants file: %w", err)
+	}
+
+	var file tenantsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse tenants file: %w", err)
+	}
+
+	ids := make(map[string]bool, len(file.Tenants))
+	owners := make(map[string]string)
+	var errs []error
+	for i := range file.Tenants {
+		tenant := &file.Tenants[i]
+		if !validID.MatchString(tenant.ID) {
+			errs = append(errs, fmt.Errorf("tenant %d has invalid id %q, must be letters, digits, '.', '_' or '-'", i, tenant.ID))
+			continue
+		}
+		if ids[tenant.ID] {
+			errs = append(errs, fmt.Errorf("duplicate tenant id %q", tenant.ID))
+		}
+		ids[tenant.ID] = true
+
+		if len(tenant.Principals) == 0 {
+			errs = append(errs, fmt.Errorf("tenant %q has no principals", tenant.ID))
+		}
+		for _, principal := range tenant.Principals {
+			if owner, ok := owners[principal]; ok {
+				errs = append(errs, fmt.Errorf("principal %q belongs to tenants %q and %q", principal, owner, tenant.ID))
+			}
+			owners[principal] = tenant.ID
+		}
+
+		providers, err := config.ParseProviderPatterns(tenant.Providers)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("tenant %q providers: %w", tenant.ID, err))
+		}
+		tenant.Providers = providers
+
+		if tenant.Quota != "" {
+			if !tenant.Isolated {
+				errs = append(errs, fmt.Errorf("tenant %q has a quota but shares the cache, quotas need an isolated cache", tenant.ID))
+			}
+			quota, err := config.ParseBytes(tenant.Quota)
+			if err != nil || quota <= 0 {
+				errs = append(errs, fmt.Errorf("tenant %q quota must be a positive byte size", tenant.ID))
+			}
+			tenant.QuotaBytes = quota
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return file.Tenants, nil
+}
@@ -0,0 +1,70 @@
+package tenants
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTenantsFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write tenants file: %v", err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	path := writeTenantsFile(t, `{"tenants": [
+		{"id": "payments", "principals": ["ci-payments"], "providers": ["registry.terraform.io/hashicorp"], "isolated": true, "quota": "20GB"},
+		{"id": "data", "principals": ["ci-data", "alice@example.com"]}
+	]}`)
+
+	tenants, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if len(tenants) != 2 {
+		t.Fatalf("expected 2 tenants, got %d", len(tenants))
+	}
+	if payments := tenants[0]; payments.ID != "payments" || !payments.Isolated || payments.QuotaBytes != 20_000_000_000 {
+		t.Errorf("unexpected payments tenant %+v", payments)
+	}
+	if data := tenants[1]; len(data.Principals) != 2 || len(data.Providers) != 0 || data.QuotaBytes != 0 {
+		t.Errorf("unexpected data tenant %+v", data)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	path := writeTenantsFile(t, `{"tenants": [
+		{"id": "../etc", "principals": ["a"]},
+		{"id": "shared", "principals": ["b"], "quota": "1GB"},
+		{"id": "empty"},
+		{"id": "dup", "principals": ["c"], "providers": ["registry.example.com//aws"]},
+		{"id": "dup", "principals": ["c"], "isolated": true, "quota": "lots"}
+	]}`)
+
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected validation to fail")
+	}
+	for _, want := range []string{
+		`tenant 0 has invalid id "../etc"`,
+		`tenant "shared" has a quota but shares the cache`,
+		`tenant "empty" has no principals`,
+		`tenant "dup" providers: invalid provider "registry.example.com//aws"`,
+		`duplicate tenant id "dup"`,
+		`principal "c" belongs to tenants "dup" and "dup"`,
+		`tenant "dup" quota must be a positive byte size`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to contain %q, got %q", want, err.Error())
+		}
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
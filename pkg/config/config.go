@@ -0,0 +1,1697 @@
+package config
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+// Config holds all application configuration
+type Config struct {
+	// Server configuration
+	Port                         int
+	Host                         string
+	Listen                       []string
+	ReadTimeout                  time.Duration
+	WriteTimeout                 time.Duration
+	DownloadIdleTimeout          time.Duration
+	DownloadConcurrencyPerClient int
+	DownloadQueueTimeout         time.Duration
+	ShutdownTimeout              time.Duration
+	TrustedProxies               []string
+	ManagementAllowlist          []string
+	// RefreshAllowlist holds CIDRs or IPs whose mirror requests may force a metadata refresh without credentials
+	RefreshAllowlist []string
+	// ResponseHeaders holds "[group:]Name=value" entries added to every response, or to the mirror, api or admin routes
+	ResponseHeaders []string
+	// PIDFile is rewritten by each process, so supervisors follow zero-downtime upgrades
+	PIDFile string
+
+	// TLS configuration
+	TLSCertFile       string
+	TLSKeyFile        string
+	TLSMinVersion     string
+	TLSMaxVersion     string
+	TLSCipherSuites   []string
+	TLSReloadInterval time.Duration
+
+	// Storage configuration
+	StorageType            string
+	CacheDir               string
+	MinFreeBytes           int64
+	FreeSpaceCheckInterval time.Duration
+	NamespaceQuotas        []string
+	NamespaceQuotaPolicy   string
+	// CacheMaxSize limits the size of the whole cache directory, or of memory storage, zero leaves it unbounded
+	CacheMaxSize        int64
+	CacheEvictionPolicy string
+	// CacheRetention removes cached metadata and archives not read for this long, zero keeps them forever
+	CacheRetention         time.Duration
+	CacheRetentionInterval time.Duration
+	VerifyArchives         bool
+	// VerifyShasums checks cached archives against the shasum published by the registry before serving them
+	VerifyShasums    bool
+	CompressMetadata bool
+	// StorageReadOnly serves the existing cache without ever writing to it
+	StorageReadOnly bool
+	// CacheCatalog indexes cached files in memory for listings, statistics and retention without walking the cache
+	CacheCatalog bool
+	Dedup        string
+	CachePolicy  []string
+	// ArchiveDirs spreads archives across several directories, typically on separate disks
+	ArchiveDirs []string
+	// ShardArchives stores archives in hashed subdirectories of their provider
+	ShardArchives bool
+	// CacheLockTTL takes lock files around archive writes so several instances can share the cache directory, zero disables them
+	CacheLockTTL time.Duration
+	// PassthroughProviders lists providers that are always fetched from upstream and never cached
+	PassthroughProviders []string
+	// SecondaryStorage lists backends, s3 or directories, written alongside the primary storage and read when it misses
+	SecondaryStorage []string
+	// SecondaryAsync copies writes to the secondary storage in the background, queueing up to SecondaryQueueSize
+	SecondaryAsync     bool
+	SecondaryQueueSize int
+	// CacheWriteRetries is how many more times a failed cache write is tried in the background, zero disables retries
+	CacheWriteRetries        int
+	CacheWriteRetryQueueSize int
+	// MemorySnapshotFile is where memory storage is saved periodically and on shutdown, and restored from on startup
+	MemorySnapshotFile     string
+	MemorySnapshotInterval time.Duration
+	// ArchiveRedirectExpiry is how long presigned archive URLs clients are redirected to stay valid, zero proxies archives
+	ArchiveRedirectExpiry time.Duration
+	// S3 storage, the endpoint defaults to the AWS endpoint of the region and credentials to the AWS_* variables
+	S3Endpoint        string
+	S3Region          string
+	S3Bucket          string
+	S3Prefix          string
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+	S3SessionToken    string
+	S3PathStyle       bool
+	// RedisURL is the server index, version and versions API responses are kept in, so replicas share them, empty disables Redis
+	RedisURL    string
+	RedisPrefix string
+	// MemoryTierSize caps the recently read metadata kept in memory in front of filesystem or S3 storage, zero disables the memory tier
+	MemoryTierSize int64
+	// MemoryTierMaxArchiveSize is the size up to which archives are kept in the memory tier as well, zero keeps none
+	MemoryTierMaxArchiveSize int64
+
+	// Upstream configuration
+	UpstreamTimeout   time.Duration
+	MaxRetries        int
+	DiscoveryCacheTTL time.Duration
+	// DiscoveryHost is the registry whose service discovery document is served at /.well-known/terraform.json
+	DiscoveryHost string
+	// ProviderSources holds "provider=url" entries fetching matching providers from another registry's providers.v1 endpoint
+	ProviderSources []string
+	// MetadataTTL is how long a cached provider index is served before it is fetched again, zero never expires it
+	MetadataTTL time.Duration
+	// MetadataTTLOverrides holds "provider=duration" entries overriding MetadataTTL for matching providers
+	MetadataTTLOverrides []string
+	// WithdrawnVersions is serve, hide or block, for versions upstream marks yanked or deprecated
+	WithdrawnVersions string
+	// WithdrawnVersionsOverrides holds "provider=policy" entries overriding WithdrawnVersions for matching providers
+	WithdrawnVersionsOverrides []string
+	// StrictIndex lists only versions with a cached archive in served provider indices
+	StrictIndex bool
+	// IndexVersionLimit caps the versions advertised in served provider indices to the most recent ones, zero serves all
+	IndexVersionLimit int
+	// UpstreamProbes lists one hostname/namespace/type per upstream registry to probe, empty disables probing
+	UpstreamProbes           []string
+	UpstreamProbeInterval    time.Duration
+	UpstreamCircuitThreshold int
+	// BackgroundRateLimit is the requests per minute prefetch and refresh jobs make to each upstream host, zero is unlimited
+	BackgroundRateLimit int
+	// BackgroundRateLimits holds "hostname=requests per minute" entries overriding BackgroundRateLimit
+	BackgroundRateLimits []string
+	// BackgroundMaxDownloads and BackgroundMaxBandwidth (bytes per second) bound background archive downloads, zero is unlimited
+	BackgroundMaxDownloads int
+	BackgroundMaxBandwidth int64
+
+	// Fault injection into upstream requests, for testing only
+	ChaosEnabled      bool
+	ChaosLatency      time.Duration
+	ChaosErrorRate    float64
+	ChaosTruncateRate float64
+
+	// Mirror configuration
+	BaseURL string
+	// CacheControl holds "resource=value" entries replacing the Cache-Control header of index, version and archive responses
+	CacheControl []string
+	// CacheControlOverrides holds "provider=value" entries replacing the Cache-Control header of every response for matching providers
+	CacheControlOverrides []string
+
+	// Observability
+	LogLevel                string
+	LogFormat               string
+	LogOutput               string
+	SyslogAddress           string
+	LogRedact               []string
+	LogAnonymizeIP          bool
+	MetricsEnabled          bool
+	MetricsGoCollector      bool
+	MetricsProcessCollector bool
+	// MetricsProviderLabels lists providers whose HTTP requests are also counted by hostname, namespace and type
+	MetricsProviderLabels []string
+
+	// Admin API configuration
+	AdminToken              string
+	AdminOIDCIssuer         string
+	AdminOIDCAudience       string
+	AdminOIDCRequiredClaims []string
+	StatsRetention          time.Duration
+
+	// Background job configuration
+	JobsWorkers   int
+	JobsQueueSize int
+	JobsFile      string
+	// Schedule holds "kind=cron" entries of maintenance jobs queued periodically
+	Schedule       []string
+	ScheduleJitter time.Duration
+	// PinnedProviders are refreshed before any other provider by refresh-indices
+	PinnedProviders []string
+	// AutoPrefetchTop is how many of the most downloaded providers get new versions prefetched by refresh jobs, zero disables it
+	AutoPrefetchTop int
+	// AutoPrefetchPlatforms lists the os_arch platforms auto-prefetch caches, empty caches every platform
+	AutoPrefetchPlatforms []string
+
+	// API key configuration
+	APIKeysFile           string
+	APIKeysReloadInterval time.Duration
+	MirrorAuthRequired    bool
+
+	// TenantsFile defines tenants identified by their principals, see internal/tenants
+	TenantsFile string
+	// TenantsCacheDir holds the isolated caches of tenants, one directory per tenant
+	TenantsCacheDir string
+
+	// NuGetUpstream is the service index of the NuGet v3 source proxied under /nuget, empty disables the proxy
+	NuGetUpstream string
+	// NuGetCacheDir holds the packages cached by the NuGet proxy
+	NuGetCacheDir string
+}
+
+// Load reads configuration from environment variables
+func Load() (*Config, error) {
+	cfg := &Config{
+		// Defaults
+		Port:                     8080,
+		Host:                     "0.0.0.0",
+		ReadTimeout:              30 * time.Second,
+		WriteTimeout:             30 * time.Second,
+		DownloadIdleTimeout:      30 * time.Second,
+		ShutdownTimeout:          30 * time.Second,
+		StorageType:              "filesystem",
+		CacheDir:                 "/var/cache/specular",
+		FreeSpaceCheckInterval:   30 * time.Second,
+		MemorySnapshotInterval:   5 * time.Minute,
+		S3Region:                 "us-east-1",
+		RedisPrefix:              "specular:",
+		NamespaceQuotaPolicy:     "reject",
+		CacheEvictionPolicy:      "evict-lru",
+		CacheRetentionInterval:   1 * time.Hour,
+		Dedup:                    "off",
+		WithdrawnVersions:        "serve",
+		UpstreamTimeout:          60 * time.Second,
+		MaxRetries:               3,
+		DiscoveryCacheTTL:        1 * time.Hour,
+		UpstreamProbeInterval:    30 * time.Second,
+		UpstreamCircuitThreshold: 3,
+		BackgroundRateLimit:      60,
+		BaseURL:                  "https://specular.example.com",
+		LogLevel:                 "info",
+		LogFormat:                "json",
+		LogOutput:                "stdout",
+		LogRedact:                []string{"auth"},
+		MetricsEnabled:           true,
+		MetricsGoCollector:       true,
+		MetricsProcessCollector:  true,
+		StatsRetention:           7 * 24 * time.Hour,
+		JobsWorkers:              2,
+		JobsQueueSize:            100,
+		SecondaryQueueSize:       10000,
+		CacheWriteRetries:        5,
+		CacheWriteRetryQueueSize: 1000,
+		ScheduleJitter:           time.Minute,
+		APIKeysReloadInterval:    time.Minute,
+		TenantsCacheDir:          "/var/cache/specular-tenants",
+		NuGetCacheDir:            "/var/cache/specular-nuget",
+	}
+
+	// Override with environment variables
+	if err := setEnvInt("SPECULAR_PORT", &cfg.Port, "must be a valid integer"); err != nil {
+		return nil, err
+	}
+
+	if v := os.Getenv("SPECULAR_HOST"); v != "" {
+		cfg.Host = v
+	}
+
+	if err := setEnvDuration("SPECULAR_READ_TIMEOUT", &cfg.ReadTimeout, "must be a valid duration (e.g., 30s)"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvDuration("SPECULAR_WRITE_TIMEOUT", &cfg.WriteTimeout, "must be a valid duration (e.g., 30s)"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvDuration("SPECULAR_DOWNLOAD_IDLE_TIMEOUT", &cfg.DownloadIdleTimeout, "must be a valid duration (e.g., 30s)"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvInt("SPECULAR_DOWNLOAD_CONCURRENCY_PER_CLIENT", &cfg.DownloadConcurrencyPerClient, "must be a valid integer"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvDuration("SPECULAR_DOWNLOAD_QUEUE_TIMEOUT", &cfg.DownloadQueueTimeout, "must be a valid duration (e.g., 10s)"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvDuration("SPECULAR_SHUTDOWN_TIMEOUT", &cfg.ShutdownTimeout, "must be a valid duration (e.g., 30s)"); err != nil {
+		return nil, err
+	}
+
+	setEnvList("SPECULAR_LISTEN", &cfg.Listen)
+
+	if v := os.Getenv("SPECULAR_PID_FILE"); v != "" {
+		cfg.PIDFile = v
+	}
+
+	setEnvList("SPECULAR_TRUSTED_PROXIES", &cfg.TrustedProxies)
+	setEnvList("SPECULAR_MANAGEMENT_ALLOWLIST", &cfg.ManagementAllowlist)
+	setEnvList("SPECULAR_REFRESH_ALLOWLIST", &cfg.RefreshAllowlist)
+
+	// Entries are separated by semicolons since header values may contain commas
+	setEnvEntries("SPECULAR_RESPONSE_HEADERS", &cfg.ResponseHeaders)
+
+	if v := os.Getenv("SPECULAR_TLS_CERT_FILE"); v != "" {
+		cfg.TLSCertFile = v
+	}
+
+	if v := os.Getenv("SPECULAR_TLS_KEY_FILE"); v != "" {
+		cfg.TLSKeyFile = v
+	}
+
+	if v := os.Getenv("SPECULAR_TLS_MIN_VERSION"); v != "" {
+		cfg.TLSMinVersion = v
+	}
+
+	if v := os.Getenv("SPECULAR_TLS_MAX_VERSION"); v != "" {
+		cfg.TLSMaxVersion = v
+	}
+
+	setEnvList("SPECULAR_TLS_CIPHER_SUITES", &cfg.TLSCipherSuites)
+
+	if err := setEnvDuration("SPECULAR_TLS_RELOAD_INTERVAL", &cfg.TLSReloadInterval, "must be a valid duration (e.g., 1m)"); err != nil {
+		return nil, err
+	}
+
+	if v := os.Getenv("SPECULAR_STORAGE_TYPE"); v != "" {
+		cfg.StorageType = v
+	}
+
+	if v := os.Getenv("SPECULAR_CACHE_DIR"); v != "" {
+		cfg.CacheDir = v
+	}
+
+	setEnvList("SPECULAR_ARCHIVE_DIRS", &cfg.ArchiveDirs)
+
+	if err := setEnvBool("SPECULAR_SHARD_ARCHIVES", &cfg.ShardArchives, "must be true or false"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvDuration("SPECULAR_CACHE_LOCK_TTL", &cfg.CacheLockTTL, "must be a valid duration (e.g., 30s)"); err != nil {
+		return nil, err
+	}
+
+	if v := os.Getenv("SPECULAR_MEMORY_SNAPSHOT_FILE"); v != "" {
+		cfg.MemorySnapshotFile = v
+	}
+
+	if err := setEnvDuration("SPECULAR_MEMORY_SNAPSHOT_INTERVAL", &cfg.MemorySnapshotInterval, "must be a valid duration (e.g., 5m)"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvDuration("SPECULAR_ARCHIVE_REDIRECT_EXPIRY", &cfg.ArchiveRedirectExpiry, "must be a valid duration (e.g., 5m)"); err != nil {
+		return nil, err
+	}
+
+	// S3 settings fall back to the variables AWS tooling uses
+	for _, s := range []struct {
+		target *string
+		keys   []string
+	}{
+		{&cfg.S3Endpoint, []string{"SPECULAR_S3_ENDPOINT"}},
+		{&cfg.S3Region, []string{"SPECULAR_S3_REGION", "AWS_REGION"}},
+		{&cfg.S3Bucket, []string{"SPECULAR_S3_BUCKET"}},
+		{&cfg.S3Prefix, []string{"SPECULAR_S3_PREFIX"}},
+		{&cfg.S3AccessKeyID, []string{"SPECULAR_S3_ACCESS_KEY_ID", "AWS_ACCESS_KEY_ID"}},
+		{&cfg.S3SecretAccessKey, []string{"SPECULAR_S3_SECRET_ACCESS_KEY", "AWS_SECRET_ACCESS_KEY"}},
+		{&cfg.S3SessionToken, []string{"SPECULAR_S3_SESSION_TOKEN", "AWS_SESSION_TOKEN"}},
+	} {
+		for _, key := range s.keys {
+			if v := os.Getenv(key); v != "" {
+				*s.target = v
+				break
+			}
+		}
+	}
+	if cfg.S3Endpoint == "" {
+		cfg.S3Endpoint = "https://s3." + cfg.S3Region + ".amazonaws.com"
+	}
+
+	if err := setEnvBool("SPECULAR_S3_PATH_STYLE", &cfg.S3PathStyle, "must be true or false"); err != nil {
+		return nil, err
+	}
+
+	if v := os.Getenv("SPECULAR_REDIS_URL"); v != "" {
+		cfg.RedisURL = v
+	}
+
+	if v, ok := os.LookupEnv("SPECULAR_REDIS_PREFIX"); ok {
+		cfg.RedisPrefix = v
+	}
+
+	if err := setEnvBytes("SPECULAR_MEMORY_TIER_SIZE", &cfg.MemoryTierSize, "must be a byte size (e.g., 256MB)"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvBytes("SPECULAR_MEMORY_TIER_MAX_ARCHIVE_SIZE", &cfg.MemoryTierMaxArchiveSize, "must be a byte size (e.g., 1MB)"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvBytes("SPECULAR_MIN_FREE_BYTES", &cfg.MinFreeBytes, "must be a byte size (e.g., 10GB)"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvDuration("SPECULAR_FREE_SPACE_CHECK_INTERVAL", &cfg.FreeSpaceCheckInterval, "must be a valid duration (e.g., 30s)"); err != nil {
+		return nil, err
+	}
+
+	setEnvList("SPECULAR_NAMESPACE_QUOTAS", &cfg.NamespaceQuotas)
+
+	if v := os.Getenv("SPECULAR_NAMESPACE_QUOTA_POLICY"); v != "" {
+		cfg.NamespaceQuotaPolicy = v
+	}
+
+	if err := setEnvBytes("SPECULAR_CACHE_MAX_SIZE", &cfg.CacheMaxSize, "must be a byte size (e.g., 50GB)"); err != nil {
+		return nil, err
+	}
+
+	if v := os.Getenv("SPECULAR_CACHE_EVICTION_POLICY"); v != "" {
+		cfg.CacheEvictionPolicy = v
+	}
+
+	if err := setEnvDuration("SPECULAR_CACHE_RETENTION", &cfg.CacheRetention, "must be a valid duration (e.g., 720h)"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvDuration("SPECULAR_CACHE_RETENTION_INTERVAL", &cfg.CacheRetentionInterval, "must be a valid duration (e.g., 1h)"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvBool("SPECULAR_VERIFY_ARCHIVES", &cfg.VerifyArchives, "must be true or false"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvBool("SPECULAR_VERIFY_SHASUMS", &cfg.VerifyShasums, "must be true or false"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvBool("SPECULAR_COMPRESS_METADATA", &cfg.CompressMetadata, "must be true or false"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvBool("SPECULAR_STORAGE_READ_ONLY", &cfg.StorageReadOnly, "must be true or false"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvBool("SPECULAR_CACHE_CATALOG", &cfg.CacheCatalog, "must be true or false"); err != nil {
+		return nil, err
+	}
+
+	if v := os.Getenv("SPECULAR_DEDUP"); v != "" {
+		cfg.Dedup = v
+	}
+
+	setEnvList("SPECULAR_CACHE_POLICY", &cfg.CachePolicy)
+
+	setEnvList("SPECULAR_PASSTHROUGH_PROVIDERS", &cfg.PassthroughProviders)
+
+	setEnvList("SPECULAR_SECONDARY_STORAGE", &cfg.SecondaryStorage)
+
+	if err := setEnvBool("SPECULAR_SECONDARY_ASYNC", &cfg.SecondaryAsync, "must be true or false"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvInt("SPECULAR_SECONDARY_QUEUE_SIZE", &cfg.SecondaryQueueSize, "must be a valid integer"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvInt("SPECULAR_CACHE_WRITE_RETRIES", &cfg.CacheWriteRetries, "must be a valid integer"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvInt("SPECULAR_CACHE_WRITE_RETRY_QUEUE_SIZE", &cfg.CacheWriteRetryQueueSize, "must be a valid integer"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvDuration("SPECULAR_UPSTREAM_TIMEOUT", &cfg.UpstreamTimeout, "must be a valid duration (e.g., 60s)"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvInt("SPECULAR_UPSTREAM_MAX_RETRIES", &cfg.MaxRetries, "must be a valid integer"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvDuration("SPECULAR_DISCOVERY_CACHE_TTL", &cfg.DiscoveryCacheTTL, "must be a valid duration (e.g., 1h)"); err != nil {
+		return nil, err
+	}
+
+	if v := os.Getenv("SPECULAR_DISCOVERY_HOST"); v != "" {
+		cfg.DiscoveryHost = v
+	}
+
+	setEnvList("SPECULAR_PROVIDER_SOURCES", &cfg.ProviderSources)
+
+	if err := setEnvDuration("SPECULAR_METADATA_TTL", &cfg.MetadataTTL, "must be a valid duration (e.g., 1h)"); err != nil {
+		return nil, err
+	}
+
+	setEnvList("SPECULAR_METADATA_TTL_OVERRIDES", &cfg.MetadataTTLOverrides)
+
+	if v := os.Getenv("SPECULAR_WITHDRAWN_VERSIONS"); v != "" {
+		cfg.WithdrawnVersions = v
+	}
+
+	setEnvList("SPECULAR_WITHDRAWN_VERSIONS_OVERRIDES", &cfg.WithdrawnVersionsOverrides)
+
+	if err := setEnvBool("SPECULAR_STRICT_INDEX", &cfg.StrictIndex, "must be true or false"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvInt("SPECULAR_INDEX_VERSION_LIMIT", &cfg.IndexVersionLimit, "must be a valid integer"); err != nil {
+		return nil, err
+	}
+
+	setEnvList("SPECULAR_UPSTREAM_PROBES", &cfg.UpstreamProbes)
+
+	if err := setEnvDuration("SPECULAR_UPSTREAM_PROBE_INTERVAL", &cfg.UpstreamProbeInterval, "must be a valid duration (e.g., 30s)"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvInt("SPECULAR_UPSTREAM_CIRCUIT_THRESHOLD", &cfg.UpstreamCircuitThreshold, "must be a valid integer"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvInt("SPECULAR_BACKGROUND_RATE_LIMIT", &cfg.BackgroundRateLimit, "must be a valid integer"); err != nil {
+		return nil, err
+	}
+
+	setEnvList("SPECULAR_BACKGROUND_RATE_LIMITS", &cfg.BackgroundRateLimits)
+
+	if err := setEnvInt("SPECULAR_BACKGROUND_MAX_DOWNLOADS", &cfg.BackgroundMaxDownloads, "must be a valid integer"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvBytes("SPECULAR_BACKGROUND_MAX_BANDWIDTH", &cfg.BackgroundMaxBandwidth, "must be a byte size per second (e.g., 10MB)"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvBool("SPECULAR_CHAOS_ENABLED", &cfg.ChaosEnabled, "must be true or false"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvDuration("SPECULAR_CHAOS_LATENCY", &cfg.ChaosLatency, "must be a valid duration (e.g., 500ms)"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvFloat("SPECULAR_CHAOS_ERROR_RATE", &cfg.ChaosErrorRate, "must be a number between 0 and 1"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvFloat("SPECULAR_CHAOS_TRUNCATE_RATE", &cfg.ChaosTruncateRate, "must be a number between 0 and 1"); err != nil {
+		return nil, err
+	}
+
+	if v := os.Getenv("SPECULAR_BASE_URL"); v != "" {
+		cfg.BaseURL = v
+	}
+
+	// Entries are separated by semicolons since header values contain commas
+	setEnvEntries("SPECULAR_CACHE_CONTROL", &cfg.CacheControl)
+	setEnvEntries("SPECULAR_CACHE_CONTROL_OVERRIDES", &cfg.CacheControlOverrides)
+
+	if v := os.Getenv("SPECULAR_LOG_LEVEL"); v != "" {
+		cfg.LogLevel = v
+	}
+
+	if v := os.Getenv("SPECULAR_LOG_FORMAT"); v != "" {
+		cfg.LogFormat = v
+	}
+
+	if v := os.Getenv("SPECULAR_LOG_OUTPUT"); v != "" {
+		cfg.LogOutput = v
+	}
+
+	if v := os.Getenv("SPECULAR_LOG_SYSLOG_ADDRESS"); v != "" {
+		cfg.SyslogAddress = v
+	}
+
+	setEnvList("SPECULAR_LOG_REDACT", &cfg.LogRedact)
+
+	if err := setEnvBool("SPECULAR_LOG_ANONYMIZE_IP", &cfg.LogAnonymizeIP, "must be true or false"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvBool("SPECULAR_METRICS_ENABLED", &cfg.MetricsEnabled, "must be true or false"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvBool("SPECULAR_METRICS_GO_COLLECTOR", &cfg.MetricsGoCollector, "must be true or false"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvBool("SPECULAR_METRICS_PROCESS_COLLECTOR", &cfg.MetricsProcessCollector, "must be true or false"); err != nil {
+		return nil, err
+	}
+
+	setEnvList("SPECULAR_METRICS_PROVIDER_LABELS", &cfg.MetricsProviderLabels)
+
+	if v := os.Getenv("SPECULAR_ADMIN_TOKEN"); v != "" {
+		cfg.AdminToken = v
+	}
+
+	if v := os.Getenv("SPECULAR_ADMIN_OIDC_ISSUER"); v != "" {
+		cfg.AdminOIDCIssuer = v
+	}
+
+	if v := os.Getenv("SPECULAR_ADMIN_OIDC_AUDIENCE"); v != "" {
+		cfg.AdminOIDCAudience = v
+	}
+
+	setEnvList("SPECULAR_ADMIN_OIDC_REQUIRED_CLAIMS", &cfg.AdminOIDCRequiredClaims)
+
+	if err := setEnvDuration("SPECULAR_STATS_RETENTION", &cfg.StatsRetention, "must be a valid duration (e.g., 168h)"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvInt("SPECULAR_JOBS_WORKERS", &cfg.JobsWorkers, "must be a valid integer"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvInt("SPECULAR_JOBS_QUEUE_SIZE", &cfg.JobsQueueSize, "must be a valid integer"); err != nil {
+		return nil, err
+	}
+
+	if v := os.Getenv("SPECULAR_JOBS_FILE"); v != "" {
+		cfg.JobsFile = v
+	}
+
+	// Entries are separated by semicolons since cron expressions contain commas
+	setEnvEntries("SPECULAR_SCHEDULE", &cfg.Schedule)
+
+	if err := setEnvDuration("SPECULAR_SCHEDULE_JITTER", &cfg.ScheduleJitter, "must be a valid duration (e.g., 1m)"); err != nil {
+		return nil, err
+	}
+
+	setEnvList("SPECULAR_PINNED_PROVIDERS", &cfg.PinnedProviders)
+
+	if err := setEnvInt("SPECULAR_AUTO_PREFETCH_TOP", &cfg.AutoPrefetchTop, "must be a valid integer"); err != nil {
+		return nil, err
+	}
+
+	setEnvList("SPECULAR_AUTO_PREFETCH_PLATFORMS", &cfg.AutoPrefetchPlatforms)
+
+	if v := os.Getenv("SPECULAR_API_KEYS_FILE"); v != "" {
+		cfg.APIKeysFile = v
+	}
+
+	if err := setEnvDuration("SPECULAR_API_KEYS_RELOAD_INTERVAL", &cfg.APIKeysReloadInterval, "must be a valid duration (e.g., 1m)"); err != nil {
+		return nil, err
+	}
+
+	if err := setEnvBool("SPECULAR_MIRROR_AUTH_REQUIRED", &cfg.MirrorAuthRequired, "must be true or false"); err != nil {
+		return nil, err
+	}
+
+	if v := os.Getenv("SPECULAR_TENANTS_FILE"); v != "" {
+		cfg.TenantsFile = v
+	}
+
+	if v := os.Getenv("SPECULAR_TENANTS_CACHE_DIR"); v != "" {
+		cfg.TenantsCacheDir = v
+	}
+
+	if v := os.Getenv("SPECULAR_NUGET_UPSTREAM"); v != "" {
+		cfg.NuGetUpstream = v
+	}
+
+	if v := os.Getenv("SPECULAR_NUGET_CACHE_DIR"); v != "" {
+		cfg.NuGetCacheDir = v
+	}
+
+	// Validate configuration
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Validate checks that configuration values are valid
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Port < 1 || c.Port > 65535 {
+		errs = append(errs, errors.New("port must be between 1 and 65535"))
+	}
+
+	if strings.TrimSpace(c.Host) == "" {
+		errs = append(errs, errors.New("host must not be empty"))
+	}
+
+	if _, err := c.Listeners(); err != nil {
+		errs = append(errs, fmt.Errorf("listen: %w", err))
+	}
+
+	if c.ReadTimeout <= 0 {
+		errs = append(errs, errors.New("read timeout must be positive"))
+	}
+
+	if c.WriteTimeout <= 0 {
+		errs = append(errs, errors.New("write timeout must be positive"))
+	}
+
+	if c.DownloadIdleTimeout <= 0 {
+		errs = append(errs, errors.New("download idle timeout must be positive"))
+	}
+
+	if c.DownloadConcurrencyPerClient < 0 {
+		errs = append(errs, errors.New("download concurrency per client must not be negative"))
+	}
+
+	if c.DownloadQueueTimeout < 0 {
+		errs = append(errs, errors.New("download queue timeout must not be negative"))
+	}
+
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("shutdown timeout must be positive"))
+	}
+
+	if _, err := ParsePrefixes(c.TrustedProxies); err != nil {
+		errs = append(errs, fmt.Errorf("trusted proxies: %w", err))
+	}
+
+	if _, err := ParsePrefixes(c.ManagementAllowlist); err != nil {
+		errs = append(errs, fmt.Errorf("management allowlist: %w", err))
+	}
+
+	if _, err := ParsePrefixes(c.RefreshAllowlist); err != nil {
+		errs = append(errs, fmt.Errorf("refresh allowlist: %w", err))
+	}
+
+	if _, err := ParseResponseHeaders(c.ResponseHeaders); err != nil {
+		errs = append(errs, fmt.Errorf("response headers: %w", err))
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		errs = append(errs, errors.New("TLS certificate and key files must be set together"))
+	}
+
+	minVersion, err := ParseTLSVersion(c.TLSMinVersion)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("TLS min version: %w", err))
+	}
+
+	maxVersion, err := ParseTLSVersion(c.TLSMaxVersion)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("TLS max version: %w", err))
+	}
+
+	if minVersion != 0 && maxVersion != 0 && minVersion > maxVersion {
+		errs = append(errs, errors.New("TLS min version must not be greater than max version"))
+	}
+
+	if _, err := ParseCipherSuites(c.TLSCipherSuites); err != nil {
+		errs = append(errs, fmt.Errorf("TLS cipher suites: %w", err))
+	}
+
+	if c.TLSReloadInterval < 0 {
+		errs = append(errs, errors.New("TLS reload interval must not be negative"))
+	}
+
+	if c.UpstreamTimeout <= 0 {
+		errs = append(errs, errors.New("upstream timeout must be positive"))
+	}
+
+	if c.MaxRetries < 0 {
+		errs = append(errs, errors.New("max retries must not be negative"))
+	}
+
+	if c.ChaosLatency < 0 {
+		errs = append(errs, errors.New("chaos latency must not be negative"))
+	}
+
+	if c.ChaosErrorRate < 0 || c.ChaosErrorRate > 1 {
+		errs = append(errs, errors.New("chaos error rate must be between 0 and 1"))
+	}
+
+	if c.ChaosTruncateRate < 0 || c.ChaosTruncateRate > 1 {
+		errs = append(errs, errors.New("chaos truncate rate must be between 0 and 1"))
+	}
+
+	if c.StatsRetention <= 0 {
+		errs = append(errs, errors.New("stats retention must be positive"))
+	}
+
+	if c.JobsWorkers < 1 {
+		errs = append(errs, errors.New("jobs workers must be at least 1"))
+	}
+
+	if c.JobsQueueSize < 1 {
+		errs = append(errs, errors.New("jobs queue size must be at least 1"))
+	}
+
+	if _, err := ParseSchedule(c.Schedule); err != nil {
+		errs = append(errs, fmt.Errorf("schedule: %w", err))
+	}
+
+	if c.ScheduleJitter < 0 {
+		errs = append(errs, errors.New("schedule jitter must not be negative"))
+	}
+
+	if c.AdminOIDCIssuer != "" {
+		parsed, err := url.Parse(c.AdminOIDCIssuer)
+		if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			errs = append(errs, errors.New("admin OIDC issuer must be a valid URL with scheme and host"))
+		}
+		// Shared issuers such as GitHub Actions sign tokens for every repository, admin access needs both
+		if c.AdminOIDCAudience == "" {
+			errs = append(errs, errors.New("admin OIDC issuer requires an audience"))
+		}
+		if len(c.AdminOIDCRequiredClaims) == 0 {
+			errs = append(errs, errors.New("admin OIDC issuer requires at least one required claim"))
+		}
+	} else if c.AdminOIDCAudience != "" || len(c.AdminOIDCRequiredClaims) > 0 {
+		errs = append(errs, errors.New("admin OIDC audience and required claims need an OIDC issuer"))
+	}
+
+	if _, err := ParseRequiredClaims(c.AdminOIDCRequiredClaims); err != nil {
+		errs = append(errs, fmt.Errorf("admin OIDC required claims: %w", err))
+	}
+
+	if c.APIKeysReloadInterval < 0 {
+		errs = append(errs, errors.New("API keys reload interval must not be negative"))
+	}
+
+	if c.MirrorAuthRequired && !c.AdminEnabled() {
+		errs = append(errs, errors.New("mirror authentication requires an admin token, OIDC issuer, or API keys file"))
+	}
+
+	if c.TenantsFile != "" && !c.MirrorAuthRequired {
+		errs = append(errs, errors.New("tenants require mirror authentication to identify them"))
+	}
+
+	if c.TenantsFile != "" && filepath.Clean(c.TenantsCacheDir) == filepath.Clean(c.CacheDir) {
+		errs = append(errs, errors.New("tenants cache directory must differ from the cache directory"))
+	}
+
+	if c.NuGetUpstream != "" {
+		if u, err := url.Parse(c.NuGetUpstream); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("NuGet upstream %q must be an http or https URL", c.NuGetUpstream))
+		}
+		if filepath.Clean(c.NuGetCacheDir) == filepath.Clean(c.CacheDir) {
+			errs = append(errs, errors.New("NuGet cache directory must differ from the cache directory"))
+		}
+	}
+
+	if c.MemoryTierSize < 0 || c.MemoryTierMaxArchiveSize < 0 {
+		errs = append(errs, errors.New("memory tier sizes must not be negative"))
+	}
+
+	if c.MinFreeBytes < 0 {
+		errs = append(errs, errors.New("minimum free bytes must not be negative"))
+	}
+
+	if c.FreeSpaceCheckInterval <= 0 {
+		errs = append(errs, errors.New("free space check interval must be positive"))
+	}
+
+	if _, err := ParseNamespaceQuotas(c.NamespaceQuotas); err != nil {
+		errs = append(errs, fmt.Errorf("namespace quotas: %w", err))
+	}
+
+	if _, err := ParseCachePolicies(c.CachePolicy); err != nil {
+		errs = append(errs, fmt.Errorf("cache policy: %w", err))
+	}
+
+	if _, err := ParseCacheControl(c.CacheControl); err != nil {
+		errs = append(errs, fmt.Errorf("cache control: %w", err))
+	}
+
+	if _, err := ParseCacheControlOverrides(c.CacheControlOverrides); err != nil {
+		errs = append(errs, fmt.Errorf("cache control overrides: %w", err))
+	}
+
+	if _, err := ParseProviderSources(c.ProviderSources); err != nil {
+		errs = append(errs, fmt.Errorf("provider sources: %w", err))
+	}
+
+	if c.MetadataTTL < 0 {
+		errs = append(errs, errors.New("metadata TTL must not be negative"))
+	}
+
+	if _, err := ParseMetadataTTLs(c.MetadataTTLOverrides); err != nil {
+		errs = append(errs, fmt.Errorf("metadata TTL overrides: %w", err))
+	}
+
+	if !validWithdrawnPolicy(c.WithdrawnVersions) {
+		errs = append(errs, errors.New("withdrawn versions must be serve, hide or block"))
+	}
+
+	if _, err := ParseWithdrawnPolicies(c.WithdrawnVersionsOverrides); err != nil {
+		errs = append(errs, fmt.Errorf("withdrawn versions overrides: %w", err))
+	}
+
+	if c.IndexVersionLimit < 0 {
+		errs = append(errs, errors.New("index version limit must not be negative"))
+	}
+
+	if _, err := ParseUpstreamProbes(c.UpstreamProbes); err != nil {
+		errs = append(errs, fmt.Errorf("upstream probes: %w", err))
+	}
+
+	if c.UpstreamProbeInterval <= 0 {
+		errs = append(errs, errors.New("upstream probe interval must be positive"))
+	}
+
+	if c.UpstreamCircuitThreshold < 0 {
+		errs = append(errs, errors.New("upstream circuit threshold must not be negative"))
+	}
+
+	if c.BackgroundRateLimit < 0 {
+		errs = append(errs, errors.New("background rate limit must not be negative"))
+	}
+
+	if _, err := ParseRateLimits(c.BackgroundRateLimits); err != nil {
+		errs = append(errs, fmt.Errorf("background rate limits: %w", err))
+	}
+
+	if c.BackgroundMaxDownloads < 0 {
+		errs = append(errs, errors.New("background max downloads must not be negative"))
+	}
+
+	if c.BackgroundMaxBandwidth < 0 {
+		errs = append(errs, errors.New("background max bandwidth must not be negative"))
+	}
+
+	if _, err := ParseProviderPatterns(c.PinnedProviders); err != nil {
+		errs = append(errs, fmt.Errorf("pinned providers: %w", err))
+	}
+
+	if c.AutoPrefetchTop < 0 {
+		errs = append(errs, errors.New("auto-prefetch top must not be negative"))
+	}
+
+	for _, platform := range c.AutoPrefetchPlatforms {
+		if goos, goarch, ok := strings.Cut(platform, "_"); !ok || goos == "" || goarch == "" || strings.Contains(goarch, "_") {
+			errs = append(errs, fmt.Errorf("auto-prefetch platform %q must be os_arch (e.g., linux_amd64)", platform))
+		}
+	}
+
+	if c.DiscoveryHost != "" && (strings.Contains(c.DiscoveryHost, "/") || !validProviderPattern(c.DiscoveryHost)) {
+		errs = append(errs, fmt.Errorf("discovery host %q must be a hostname", c.DiscoveryHost))
+	}
+
+	if _, err := ParseProviderPatterns(c.MetricsProviderLabels); err != nil {
+		errs = append(errs, fmt.Errorf("metrics provider labels: %w", err))
+	}
+
+	if _, err := ParseProviderPatterns(c.PassthroughProviders); err != nil {
+		errs = append(errs, fmt.Errorf("passthrough providers: %w", err))
+	}
+
+	for _, secondary := range c.SecondaryStorage {
+		switch {
+		case secondary == "s3":
+			if c.StorageType == "s3" {
+				errs = append(errs, errors.New("s3 secondary storage requires another primary storage type"))
+			}
+		case !filepath.IsAbs(secondary):
+			errs = append(errs, fmt.Errorf("secondary storage %q must be s3 or an absolute directory", secondary))
+		case filepath.Clean(secondary) == filepath.Clean(c.CacheDir):
+			errs = append(errs, errors.New("secondary storage directory must differ from the cache directory"))
+		}
+	}
+
+	if c.SecondaryQueueSize < 1 {
+		errs = append(errs, errors.New("secondary queue size must be at least 1"))
+	}
+
+	if c.CacheWriteRetries < 0 {
+		errs = append(errs, errors.New("cache write retries must not be negative"))
+	}
+
+	if c.CacheWriteRetryQueueSize < 1 {
+		errs = append(errs, errors.New("cache write retry queue size must be at least 1"))
+	}
+
+	if !validQuotaPolicy(c.NamespaceQuotaPolicy) {
+		errs = append(errs, errors.New("namespace quota policy must be reject, evict or evict-lru"))
+	}
+
+	if c.CacheMaxSize < 0 {
+		errs = append(errs, errors.New("cache max size must not be negative"))
+	}
+
+	if !validQuotaPolicy(c.CacheEvictionPolicy) {
+		errs = append(errs, errors.New("cache eviction policy must be reject, evict or evict-lru"))
+	}
+
+	if c.CacheRetention < 0 {
+		errs = append(errs, errors.New("cache retention must not be negative"))
+	}
+
+	if c.CacheRetentionInterval <= 0 {
+		errs = append(errs, errors.New("cache retention interval must be positive"))
+	}
+
+	if c.Dedup != "off" && c.Dedup != "hardlink" && c.Dedup != "reflink" {
+		errs = append(errs, errors.New("dedup must be off, hardlink or reflink"))
+	}
+
+	if c.CacheDir == "" {
+		errs = append(errs, errors.New("cache directory must not be empty"))
+	}
+
+	if len(c.ArchiveDirs) > 0 && c.StorageType != "filesystem" {
+		errs = append(errs, errors.New("archive directories require filesystem storage"))
+	}
+
+	if c.ShardArchives && c.StorageType != "filesystem" {
+		errs = append(errs, errors.New("archive sharding requires filesystem storage"))
+	}
+
+	if c.CacheLockTTL < 0 {
+		errs = append(errs, errors.New("cache lock TTL must not be negative"))
+	} else if c.CacheLockTTL > 0 && c.StorageType != "filesystem" {
+		errs = append(errs, errors.New("cache locks require filesystem storage"))
+	}
+
+	if c.MemorySnapshotFile != "" && c.StorageType != "memory" {
+		errs = append(errs, errors.New("memory snapshot file requires memory storage"))
+	}
+
+	if c.MemorySnapshotInterval < 0 {
+		errs = append(errs, errors.New("memory snapshot interval must not be negative"))
+	}
+
+	// Object stores cap the lifetime of presigned URLs at a week
+	if c.ArchiveRedirectExpiry < 0 || c.ArchiveRedirectExpiry > 7*24*time.Hour {
+		errs = append(errs, errors.New("archive redirect expiry must be between 0 and 168h"))
+	}
+
+	// Nested directories would be scanned twice, counting their archives twice against quotas
+	for i, dir := range c.ArchiveDirs {
+		for _, other := range append([]string{c.CacheDir}, c.ArchiveDirs[:i]...) {
+			if nestedDir(dir, other) {
+				errs = append(errs, fmt.Errorf("archive directory %q must not be inside or contain %q", dir, other))
+			}
+		}
+	}
+
+	if c.BaseURL == "" {
+		errs = append(errs, errors.New("base URL must not be empty"))
+	} else {
+		parsed, err := url.Parse(c.BaseURL)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			errs = append(errs, errors.New("base URL must be a valid URL with scheme and host"))
+		}
+	}
+
+	validLogLevels := map[string]bool{
+		"debug": true,
+		"info":  true,
+		"warn":  true,
+		"error": true,
+	}
+	if !validLogLevels[c.LogLevel] {
+		errs = append(errs, errors.New("log level must be debug, info, warn, or error"))
+	}
+
+	validLogFormats := map[string]bool{
+		"json": true,
+		"text": true,
+	}
+	if !validLogFormats[c.LogFormat] {
+		errs = append(errs, errors.New("log format must be json or text"))
+	}
+
+	validLogOutputs := map[string]bool{
+		"stdout":   true,
+		"stderr":   true,
+		"syslog":   true,
+		"journald": true,
+	}
+	if !validLogOutputs[c.LogOutput] {
+		errs = append(errs, errors.New("log output must be stdout, stderr, syslog, or journald"))
+	}
+
+	validRedactions := map[string]bool{
+		"client_ip": true,
+		"auth":      true,
+		"query":     true,
+	}
+	for _, r := range c.LogRedact {
+		if !validRedactions[r] {
+			errs = append(errs, fmt.Errorf("log redaction %q must be client_ip, auth, or query", r))
+		}
+	}
+
+	validStorageTypes := map[string]bool{
+		"filesystem": true,
+		"memory":     true,
+		"s3":         true,
+	}
+	if registered := storage.Registered(); !validStorageTypes[c.StorageType] && !slices.Contains(registered, c.StorageType) {
+		if len(registered) == 0 {
+			errs = append(errs, errors.New("storage type must be filesystem, memory, or s3"))
+		} else {
+			errs = append(errs, fmt.Errorf("storage type must be filesystem, memory, or s3, or a registered backend: %s", strings.Join(registered, ", ")))
+		}
+	}
+
+	if c.StorageType == "s3" || slices.Contains(c.SecondaryStorage, "s3") {
+		if c.S3Bucket == "" {
+			errs = append(errs, errors.New("S3 storage requires a bucket"))
+		}
+		if u, err := url.Parse(c.S3Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("S3 endpoint %q must be an http or https URL", c.S3Endpoint))
+		}
+		if (c.S3AccessKeyID == "") != (c.S3SecretAccessKey == "") {
+			errs = append(errs, errors.New("S3 access key ID and secret access key must be set together"))
+		}
+	}
+
+	if c.RedisURL != "" {
+		if u, err := url.Parse(c.RedisURL); err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") || u.Hostname() == "" {
+			errs = append(errs, errors.New("Redis URL must be a redis:// or rediss:// URL with a host"))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validQuotaPolicy reports whether policy is a known quota policy
+func validQuotaPolicy(policy string) bool {
+	return policy == "reject" || policy == "evict" || policy == "evict-lru"
+}
+
+// ParsePrefixes parses a list of CIDRs or bare IP addresses into network prefixes
+// Bare addresses are treated as single-host prefixes
+func ParsePrefixes(list []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(list))
+	for _, entry := range list {
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR or IP address %q", entry)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// responseHeaderGroups lists the route groups response headers can be added to
+var responseHeaderGroups = []string{"mirror", "api", "admin"}
+
+// ParseResponseHeaders parses "[group:]Name=value" entries into headers keyed by route group
+// Entries without a group are keyed by an empty string and apply to every response
+func ParseResponseHeaders(list []string) (map[string]http.Header, error) {
+	headers := make(map[string]http.Header)
+	for _, entry := range list {
+		name, value, ok := strings.Cut(entry, "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		group, header, grouped := strings.Cut(name, ":")
+		if !grouped {
+			group, header = "", name
+		} else if group, header = strings.TrimSpace(group), strings.TrimSpace(header); !slices.Contains(responseHeaderGroups, group) {
+			return nil, fmt.Errorf("invalid group in %q, must be mirror, api or admin", entry)
+		}
+		if !ok || !validHeaderName(header) {
+			return nil, fmt.Errorf("invalid entry %q, must be [group:]Name=value", entry)
+		}
+		if !validHeaderValue(value) {
+			return nil, fmt.Errorf("invalid header value in %q", entry)
+		}
+		if headers[group] == nil {
+			headers[group] = make(http.Header)
+		}
+		headers[group].Add(header, value)
+	}
+	return headers, nil
+}
+
+// validHeaderName reports whether name is a valid HTTP header field name
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("!#$%&'*+-.^_`|~", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// AdminEnabled reports whether the admin API has any authentication configured
+func (c *Config) AdminEnabled() bool {
+	return c.AdminToken != "" || c.AdminOIDCIssuer != "" || c.APIKeysFile != ""
+}
+
+// ParseRequiredClaims parses claim=value pairs into a map of required claim values
+func ParseRequiredClaims(list []string) (map[string]string, error) {
+	claims := make(map[string]string, len(list))
+	for _, entry := range list {
+		name, value, ok := strings.Cut(entry, "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || name == "" || value == "" {
+			return nil, fmt.Errorf("invalid claim %q, must be name=value", entry)
+		}
+		claims[name] = value
+	}
+	return claims, nil
+}
+
+// cacheResources lists the resource types a cache policy can be set for
+var cacheResources = []string{"index", "version", "archive"}
+
+// ParseCachePolicies parses "resource=policy" entries into policies keyed by resource type
+// An entry without a resource applies to every resource type, later entries take precedence
+func ParseCachePolicies(list []string) (map[string]string, error) {
+	policies := make(map[string]string, len(cacheResources))
+	for _, entry := range list {
+		resource, policy, ok := strings.Cut(entry, "=")
+		resource, policy = strings.TrimSpace(resource), strings.TrimSpace(policy)
+		if !ok {
+			resource, policy = "", resource
+		} else if resource == "" {
+			return nil, fmt.Errorf("invalid resource in %q, must be index, version or archive", entry)
+		}
+		if policy != "write-through" && policy != "write-back" && policy != "no-store" {
+			return nil, fmt.Errorf("invalid policy in %q, must be write-through, write-back or no-store", entry)
+		}
+		switch {
+		case resource == "":
+			for _, r := range cacheResources {
+				policies[r] = policy
+			}
+		case slices.Contains(cacheResources, resource):
+			policies[resource] = policy
+		default:
+			return nil, fmt.Errorf("invalid resource in %q, must be index, version or archive", entry)
+		}
+	}
+	return policies, nil
+}
+
+// ParseCacheControl parses "resource=value" entries into Cache-Control header values keyed by resource type
+func ParseCacheControl(list []string) (map[string]string, error) {
+	values := make(map[string]string, len(list))
+	for _, entry := range list {
+		resource, value, ok := strings.Cut(entry, "=")
+		resource, value = strings.TrimSpace(resource), strings.TrimSpace(value)
+		if !ok || !slices.Contains(cacheResources, resource) {
+			return nil, fmt.Errorf("invalid resource in %q, must be index, version or archive", entry)
+		}
+		if !validHeaderValue(value) {
+			return nil, fmt.Errorf("invalid header value in %q", entry)
+		}
+		values[resource] = value
+	}
+	return values, nil
+}
+
+// ParseCacheControlOverrides parses "provider=value" entries into Cache-Control header values keyed by provider pattern
+func ParseCacheControlOverrides(list []string) (map[string]string, error) {
+	values := make(map[string]string, len(list))
+	for _, entry := range list {
+		pattern, value, ok := strings.Cut(entry, "=")
+		pattern, value = strings.TrimSpace(pattern), strings.TrimSpace(value)
+		if !ok || !validProviderPattern(pattern) {
+			return nil, fmt.Errorf("invalid entry %q, must be hostname[/namespace[/type]]=value", entry)
+		}
+		if !validHeaderValue(value) {
+			return nil, fmt.Errorf("invalid header value in %q", entry)
+		}
+		values[pattern] = value
+	}
+	return values, nil
+}
+
+// validHeaderValue reports whether value is a non-empty HTTP header value without control characters
+func validHeaderValue(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, r := range value {
+		if r < ' ' && r != '\t' || r == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// validProviderPattern reports whether pattern is a hostname, hostname/namespace or hostname/namespace/type
+func validProviderPattern(pattern string) bool {
+	parts := strings.Split(pattern, "/")
+	if len(parts) > 3 {
+		return false
+	}
+	for _, part := range parts {
+		if part == "" || strings.TrimSpace(part) != part {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseProviderPatterns checks that every entry is a hostname, hostname/namespace or hostname/namespace/type
+func ParseProviderPatterns(list []string) ([]string, error) {
+	for _, entry := range list {
+		if !validProviderPattern(entry) {
+			return nil, fmt.Errorf("invalid provider %q, must be hostname[/namespace[/type]]", entry)
+		}
+	}
+	return list, nil
+}
+
+// ParseUpstreamProbes parses hostname/namespace/type entries into the provider probed on each hostname
+// Each hostname is probed through a single provider
+func ParseUpstreamProbes(list []string) (map[string][2]string, error) {
+	probes := make(map[string][2]string, len(list))
+	for _, entry := range list {
+		parts := strings.Split(entry, "/")
+		if len(parts) != 3 || !validProviderPattern(entry) {
+			return nil, fmt.Errorf("invalid probe %q, must be hostname/namespace/type", entry)
+		}
+		if _, ok := probes[parts[0]]; ok {
+			return nil, fmt.Errorf("hostname %q is probed more than once", parts[0])
+		}
+		probes[parts[0]] = [2]string{parts[1], parts[2]}
+	}
+	return probes, nil
+}
+
+// ParseRateLimits parses "hostname=rate" entries into requests per minute keyed by hostname
+func ParseRateLimits(list []string) (map[string]int, error) {
+	rates := make(map[string]int, len(list))
+	for _, entry := range list {
+		hostname, value, ok := strings.Cut(entry, "=")
+		hostname = strings.TrimSpace(hostname)
+		if !ok || hostname == "" || strings.Contains(hostname, "/") {
+			return nil, fmt.Errorf("invalid entry %q, must be hostname=requests per minute", entry)
+		}
+		rate, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || rate < 0 {
+			return nil, fmt.Errorf("invalid rate in %q, must be a non-negative integer", entry)
+		}
+		rates[hostname] = rate
+	}
+	return rates, nil
+}
+
+// ParseProviderSources parses "provider=url" entries into providers.v1 endpoint URLs keyed by provider pattern
+func ParseProviderSources(list []string) (map[string]string, error) {
+	sources := make(map[string]string, len(list))
+	for _, entry := range list {
+		pattern, source, ok := strings.Cut(entry, "=")
+		pattern, source = strings.TrimSpace(pattern), strings.TrimSpace(source)
+		if !ok || !validProviderPattern(pattern) {
+			return nil, fmt.Errorf("invalid entry %q, must be hostname[/namespace[/type]]=url", entry)
+		}
+		parsed, err := url.Parse(source)
+		if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			return nil, fmt.Errorf("invalid URL in %q, must be an http or https URL", entry)
+		}
+		sources[pattern] = source
+	}
+	return sources, nil
+}
+
+// ParseMetadataTTLs parses "provider=duration" entries into TTLs keyed by provider pattern
+// A provider pattern is a hostname, hostname/namespace or hostname/namespace/type
+func ParseMetadataTTLs(list []string) (map[string]time.Duration, error) {
+	ttls := make(map[string]time.Duration, len(list))
+	for _, entry := range list {
+		pattern, value, ok := strings.Cut(entry, "=")
+		pattern = strings.TrimSpace(pattern)
+		if !ok || !validProviderPattern(pattern) {
+			return nil, fmt.Errorf("invalid entry %q, must be hostname[/namespace[/type]]=duration", entry)
+		}
+		ttl, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || ttl < 0 {
+			return nil, fmt.Errorf("invalid duration in %q", entry)
+		}
+		ttls[pattern] = ttl
+	}
+	return ttls, nil
+}
+
+// validWithdrawnPolicy reports whether policy is serve, hide or block
+func validWithdrawnPolicy(policy string) bool {
+	return policy == "serve" || policy == "hide" || policy == "block"
+}
+
+// ParseWithdrawnPolicies parses "provider=policy" entries into withdrawn version policies keyed by provider pattern
+func ParseWithdrawnPolicies(list []string) (map[string]string, error) {
+	policies := make(map[string]string, len(list))
+	for _, entry := range list {
+		pattern, policy, ok := strings.Cut(entry, "=")
+		pattern, policy = strings.TrimSpace(pattern), strings.TrimSpace(policy)
+		if !ok || !validProviderPattern(pattern) {
+			return nil, fmt.Errorf("invalid entry %q, must be hostname[/namespace[/type]]=policy", entry)
+		}
+		if !validWithdrawnPolicy(policy) {
+			return nil, fmt.Errorf("invalid policy in %q, must be serve, hide or block", entry)
+		}
+		policies[pattern] = policy
+	}
+	return policies, nil
+}
+
+// ParseSchedule parses "kind=cron" entries into cron expressions keyed by job kind
+// Expressions are checked when the scheduler starts, since job kinds depend on the storage backend
+func ParseSchedule(list []string) (map[string]string, error) {
+	schedule := make(map[string]string, len(list))
+	for _, entry := range list {
+		kind, expr, ok := strings.Cut(entry, "=")
+		kind, expr = strings.TrimSpace(kind), strings.TrimSpace(expr)
+		if !ok || kind == "" || expr == "" {
+			return nil, fmt.Errorf("invalid entry %q, must be kind=cron expression", entry)
+		}
+		if _, dup := schedule[kind]; dup {
+			return nil, fmt.Errorf("duplicate entry for %q", kind)
+		}
+		schedule[kind] = expr
+	}
+	return schedule, nil
+}
+
+// ParseNamespaceQuotas parses "namespace=size" or "hostname/namespace=size" entries
+// into byte limits keyed by namespace or hostname/namespace
+func ParseNamespaceQuotas(list []string) (map[string]int64, error) {
+	quotas := make(map[string]int64, len(list))
+	for _, entry := range list {
+		key, size, ok := strings.Cut(entry, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.Count(key, "/") > 1 || strings.HasPrefix(key, "/") || strings.HasSuffix(key, "/") {
+			return nil, fmt.Errorf("invalid quota %q, must be namespace=size or hostname/namespace=size", entry)
+		}
+		limit, err := ParseBytes(size)
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("invalid quota size in %q", entry)
+		}
+		quotas[key] = limit
+	}
+	return quotas, nil
+}
+
+// Listener is an address the server accepts connections on
+type Listener struct {
+	// Address is the host:port to bind
+	Address string
+	// Network is tcp for dual-stack, tcp4 or tcp6 to restrict the socket to one IP version
+	Network string
+	// CertFile and KeyFile enable TLS on the listener when set
+	CertFile string
+	KeyFile  string
+}
+
+// TLS reports whether the listener terminates TLS
+func (l Listener) TLS() bool {
+	return l.CertFile != "" && l.KeyFile != ""
+}
+
+// Listeners returns the addresses the server listens on
+// Without SPECULAR_LISTEN this is a single listener on Host and Port, using the global TLS settings.
+// Each SPECULAR_LISTEN entry is an address followed by semicolon-separated options:
+// tls (use the global certificate), cert=FILE and key=FILE (use a listener-specific
+// certificate) and network=tcp|tcp4|tcp6.
+func (c *Config) Listeners() ([]Listener, error) {
+	if len(c.Listen) == 0 {
+		return []Listener{{
+			Address:  net.JoinHostPort(c.Host, strconv.Itoa(c.Port)),
+			Network:  "tcp",
+			CertFile: c.TLSCertFile,
+			KeyFile:  c.TLSKeyFile,
+		}}, nil
+	}
+
+	listeners := make([]Listener, 0, len(c.Listen))
+	seen := make(map[string]bool, len(c.Listen))
+	for _, entry := range c.Listen {
+		parts := strings.Split(entry, ";")
+		l := Listener{Address: strings.TrimSpace(parts[0]), Network: "tcp"}
+
+		_, port, err := net.SplitHostPort(l.Address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address %q, must be host:port", l.Address)
+		}
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return nil, fmt.Errorf("invalid port in %q, must be between 1 and 65535", l.Address)
+		}
+		if seen[l.Address] {
+			return nil, fmt.Errorf("duplicate address %q", l.Address)
+		}
+		seen[l.Address] = true
+
+		for _, option := range parts[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(option), "=")
+			switch name {
+			case "tls":
+				if !c.TLSEnabled() {
+					return nil, fmt.Errorf("listener %q uses tls but no TLS certificate and key files are set", l.Address)
+				}
+				l.CertFile, l.KeyFile = c.TLSCertFile, c.TLSKeyFile
+			case "cert":
+				l.CertFile = value
+			case "key":
+				l.KeyFile = value
+			case "network":
+				if value != "tcp" && value != "tcp4" && value != "tcp6" {
+					return nil, fmt.Errorf("listener %q has invalid network %q, must be tcp, tcp4, or tcp6", l.Address, value)
+				}
+				l.Network = value
+			default:
+				return nil, fmt.Errorf("listener %q has unknown option %q", l.Address, option)
+			}
+		}
+		if (l.CertFile == "") != (l.KeyFile == "") {
+			return nil, fmt.Errorf("listener %q must set cert and key together", l.Address)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// TLSEnabled reports whether the server should terminate TLS itself
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
+
+// ParseTLSVersion parses a TLS version such as "1.2" into its crypto/tls constant
+// An empty version returns zero, meaning the crypto/tls default
+func ParseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "":
+		return 0, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported TLS version %q, must be 1.0, 1.1, 1.2, or 1.3", version)
+	}
+}
+
+// ParseCipherSuites parses IANA cipher suite names (e.g., TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256)
+// into their crypto/tls IDs. Insecure suites are rejected.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// byteUnits maps size suffixes to multipliers, both decimal (GB) and binary (GiB) units are accepted
+var byteUnits = map[string]int64{
+	"":    1,
+	"B":   1,
+	"KB":  1000,
+	"MB":  1000 * 1000,
+	"GB":  1000 * 1000 * 1000,
+	"TB":  1000 * 1000 * 1000 * 1000,
+	"KIB": 1 << 10,
+	"MIB": 1 << 20,
+	"GIB": 1 << 30,
+	"TIB": 1 << 40,
+}
+
+// ParseBytes parses a byte size such as "1048576", "500MB" or "20GiB"
+func ParseBytes(size string) (int64, error) {
+	size = strings.TrimSpace(size)
+	i := strings.IndexFunc(size, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	number, unit := size, ""
+	if i >= 0 {
+		number, unit = size[:i], strings.ToUpper(strings.TrimSpace(size[i:]))
+	}
+
+	multiplier, ok := byteUnits[unit]
+	if !ok || number == "" {
+		return 0, fmt.Errorf("invalid byte size %q", size)
+	}
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil || value*float64(multiplier) > math.MaxInt64 {
+		return 0, fmt.Errorf("invalid byte size %q", size)
+	}
+	return int64(value * float64(multiplier)), nil
+}
+
+func setEnvInt(key string, target *int, errMsg string) error {
+	if v := os.Getenv(key); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("%s %s", key, errMsg)
+		}
+		*target = parsed
+	}
+	return nil
+}
+
+func setEnvBytes(key string, target *int64, errMsg string) error {
+	if v := os.Getenv(key); v != "" {
+		parsed, err := ParseBytes(v)
+		if err != nil {
+			return fmt.Errorf("%s %s", key, errMsg)
+		}
+		*target = parsed
+	}
+	return nil
+}
+
+func setEnvDuration(key string, target *time.Duration, errMsg string) error {
+	if v := os.Getenv(key); v != "" {
+		duration, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("%s %s", key, errMsg)
+		}
+		*target = duration
+	}
+	return nil
+}
+
+func setEnvFloat(key string, target *float64, errMsg string) error {
+	if v := os.Getenv(key); v != "" {
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("%s %s", key, errMsg)
+		}
+		*target = parsed
+	}
+	return nil
+}
+
+func setEnvBool(key string, target *bool, errMsg string) error {
+	if v := os.Getenv(key); v != "" {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("%s %s", key, errMsg)
+		}
+		*target = parsed
+	}
+
+	return nil
+}
+
+// setEnvList parses a comma-separated list, trimming whitespace and dropping empty entries
+// Setting the variable to "none" clears the list
+func setEnvList(key string, target *[]string) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return
+	}
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" && item != "none" {
+			list = append(list, item)
+		}
+	}
+	*target = list
+}
+
+// setEnvEntries parses a semicolon-separated list, for entries that may contain commas
+func setEnvEntries(key string, target *[]string) {
+	v := os.Getenv(key)
+	if v == "" {
+		return
+	}
+	var list []string
+	for _, entry := range strings.Split(v, ";") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	*target = list
+}
+
+// nestedDir reports whether one of the directories is strictly inside the other
+func nestedDir(a, b string) bool {
+	rel, err := filepath.Rel(filepath.Clean(b), filepath.Clean(a))
+	if err != nil || rel == "." {
+		return false
+	}
+	if filepath.IsLocal(rel) {
+		return true
+	}
+	rel, err = filepath.Rel(filepath.Clean(a), filepath.Clean(b))
+	return err == nil && filepath.IsLocal(rel)
+}
@@ -0,0 +1,1077 @@
+package config
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+
+	if cfg.Port != 8080 {
+		t.Fatalf("expected default port 8080, got %d", cfg.Port)
+	}
+	if cfg.Host != "0.0.0.0" {
+		t.Fatalf("expected default host 0.0.0.0, got %s", cfg.Host)
+	}
+	if cfg.StorageType != "filesystem" {
+		t.Fatalf("expected default storage type filesystem, got %s", cfg.StorageType)
+	}
+	if cfg.CacheDir != "/var/cache/specular" {
+		t.Fatalf("expected default cache dir /var/cache/specular, got %s", cfg.CacheDir)
+	}
+	if cfg.BaseURL != "https://specular.example.com" {
+		t.Fatalf("expected default base URL https://specular.example.com, got %s", cfg.BaseURL)
+	}
+	if cfg.LogLevel != "info" || cfg.LogFormat != "json" {
+		t.Fatalf("expected default log level info and format json, got %s/%s", cfg.LogLevel, cfg.LogFormat)
+	}
+	if !cfg.MetricsGoCollector || !cfg.MetricsProcessCollector {
+		t.Fatalf("expected default collectors enabled")
+	}
+}
+
+func TestLoadOverrides(t *testing.T) {
+	t.Setenv("SPECULAR_PORT", "9090")
+	t.Setenv("SPECULAR_HOST", "127.0.0.1")
+	t.Setenv("SPECULAR_READ_TIMEOUT", "10s")
+	t.Setenv("SPECULAR_WRITE_TIMEOUT", "11s")
+	t.Setenv("SPECULAR_SHUTDOWN_TIMEOUT", "12s")
+	t.Setenv("SPECULAR_DOWNLOAD_IDLE_TIMEOUT", "14s")
+	t.Setenv("SPECULAR_DOWNLOAD_CONCURRENCY_PER_CLIENT", "4")
+	t.Setenv("SPECULAR_DOWNLOAD_QUEUE_TIMEOUT", "15s")
+	t.Setenv("SPECULAR_MANAGEMENT_ALLOWLIST", "10.0.0.0/8, 127.0.0.1")
+	t.Setenv("SPECULAR_REFRESH_ALLOWLIST", "192.0.2.10")
+	t.Setenv("SPECULAR_RESPONSE_HEADERS", "Via=1.1 specular; mirror:X-Classification=public, cached")
+	t.Setenv("SPECULAR_LISTEN", "0.0.0.0:8080,[::1]:8080;network=tcp6")
+	t.Setenv("SPECULAR_STORAGE_TYPE", "memory")
+	t.Setenv("SPECULAR_CACHE_DIR", "/tmp/specular-cache")
+	t.Setenv("SPECULAR_MIN_FREE_BYTES", "10GiB")
+	t.Setenv("SPECULAR_MEMORY_TIER_SIZE", "256MB")
+	t.Setenv("SPECULAR_MEMORY_TIER_MAX_ARCHIVE_SIZE", "1MiB")
+	t.Setenv("SPECULAR_FREE_SPACE_CHECK_INTERVAL", "5s")
+	t.Setenv("SPECULAR_NAMESPACE_QUOTAS", "partner=20GB")
+	t.Setenv("SPECULAR_NAMESPACE_QUOTA_POLICY", "evict")
+	t.Setenv("SPECULAR_CACHE_MAX_SIZE", "50GB")
+	t.Setenv("SPECULAR_CACHE_EVICTION_POLICY", "evict")
+	t.Setenv("SPECULAR_CACHE_RETENTION", "720h")
+	t.Setenv("SPECULAR_CACHE_RETENTION_INTERVAL", "6h")
+	t.Setenv("SPECULAR_VERIFY_ARCHIVES", "true")
+	t.Setenv("SPECULAR_VERIFY_SHASUMS", "true")
+	t.Setenv("SPECULAR_COMPRESS_METADATA", "true")
+	t.Setenv("SPECULAR_CACHE_CATALOG", "true")
+	t.Setenv("SPECULAR_STORAGE_READ_ONLY", "true")
+	t.Setenv("SPECULAR_DEDUP", "hardlink")
+	t.Setenv("SPECULAR_DISCOVERY_HOST", "registry.terraform.io")
+	t.Setenv("SPECULAR_CACHE_POLICY", "index=write-back, archive=no-store")
+	t.Setenv("SPECULAR_METRICS_GO_COLLECTOR", "false")
+	t.Setenv("SPECULAR_METRICS_PROCESS_COLLECTOR", "false")
+	t.Setenv("SPECULAR_METRICS_PROVIDER_LABELS", "registry.example.com/internal")
+	t.Setenv("SPECULAR_UPSTREAM_TIMEOUT", "13s")
+	t.Setenv("SPECULAR_UPSTREAM_MAX_RETRIES", "5")
+	t.Setenv("SPECULAR_CHAOS_ENABLED", "true")
+	t.Setenv("SPECULAR_CHAOS_LATENCY", "250ms")
+	t.Setenv("SPECULAR_CHAOS_ERROR_RATE", "0.1")
+	t.Setenv("SPECULAR_CHAOS_TRUNCATE_RATE", "0.05")
+	t.Setenv("SPECULAR_BASE_URL", "https://example.com")
+	t.Setenv("SPECULAR_LOG_LEVEL", "debug")
+	t.Setenv("SPECULAR_LOG_FORMAT", "text")
+	t.Setenv("SPECULAR_LOG_OUTPUT", "syslog")
+	t.Setenv("SPECULAR_LOG_SYSLOG_ADDRESS", "udp://logs.example.com:514")
+	t.Setenv("SPECULAR_LOG_REDACT", "client_ip, query")
+	t.Setenv("SPECULAR_LOG_ANONYMIZE_IP", "true")
+	t.Setenv("SPECULAR_METRICS_ENABLED", "false")
+	t.Setenv("SPECULAR_ADMIN_TOKEN", "s3cret")
+	t.Setenv("SPECULAR_STATS_RETENTION", "48h")
+	t.Setenv("SPECULAR_JOBS_WORKERS", "4")
+	t.Setenv("SPECULAR_JOBS_QUEUE_SIZE", "20")
+	t.Setenv("SPECULAR_JOBS_FILE", "/var/lib/specular/jobs.json")
+	t.Setenv("SPECULAR_SECONDARY_ASYNC", "true")
+	t.Setenv("SPECULAR_METADATA_TTL", "1h")
+	t.Setenv("SPECULAR_PROVIDER_SOURCES", "registry.terraform.io/acme=https://registry.acme.example/v1/providers/")
+	t.Setenv("SPECULAR_PASSTHROUGH_PROVIDERS", "registry.example.com/internal, registry.example.com/platform/netbox")
+	t.Setenv("SPECULAR_METADATA_TTL_OVERRIDES", "registry.example.com=5m")
+	t.Setenv("SPECULAR_INDEX_VERSION_LIMIT", "50")
+	t.Setenv("SPECULAR_WITHDRAWN_VERSIONS", "block")
+	t.Setenv("SPECULAR_WITHDRAWN_VERSIONS_OVERRIDES", "registry.terraform.io/hashicorp/aws=serve")
+	t.Setenv("SPECULAR_STRICT_INDEX", "true")
+	t.Setenv("SPECULAR_UPSTREAM_PROBES", "registry.terraform.io/hashicorp/null")
+	t.Setenv("SPECULAR_UPSTREAM_PROBE_INTERVAL", "1m")
+	t.Setenv("SPECULAR_UPSTREAM_CIRCUIT_THRESHOLD", "5")
+	t.Setenv("SPECULAR_BACKGROUND_RATE_LIMIT", "30")
+	t.Setenv("SPECULAR_BACKGROUND_RATE_LIMITS", "releases.hashicorp.com=600")
+	t.Setenv("SPECULAR_PINNED_PROVIDERS", "registry.terraform.io/hashicorp/aws")
+	t.Setenv("SPECULAR_AUTO_PREFETCH_TOP", "20")
+	t.Setenv("SPECULAR_AUTO_PREFETCH_PLATFORMS", "linux_amd64, darwin_arm64")
+	t.Setenv("SPECULAR_BACKGROUND_MAX_DOWNLOADS", "2")
+	t.Setenv("SPECULAR_BACKGROUND_MAX_BANDWIDTH", "10MiB")
+	t.Setenv("SPECULAR_PID_FILE", "/run/specular.pid")
+	t.Setenv("SPECULAR_SECONDARY_QUEUE_SIZE", "500")
+	t.Setenv("SPECULAR_CACHE_WRITE_RETRIES", "2")
+	t.Setenv("SPECULAR_CACHE_WRITE_RETRY_QUEUE_SIZE", "50")
+	t.Setenv("SPECULAR_SCHEDULE", "gc=0 3 * * *; verify=0 4 * * 0,3")
+	t.Setenv("SPECULAR_SCHEDULE_JITTER", "5m")
+	t.Setenv("SPECULAR_CACHE_CONTROL", "index=public, max-age=60; archive=private, max-age=86400")
+	t.Setenv("SPECULAR_CACHE_CONTROL_OVERRIDES", "registry.example.com/internal=no-store")
+	t.Setenv("SPECULAR_ADMIN_OIDC_ISSUER", "https://sso.example.com")
+	t.Setenv("SPECULAR_ADMIN_OIDC_AUDIENCE", "specular")
+	t.Setenv("SPECULAR_ADMIN_OIDC_REQUIRED_CLAIMS", "groups=platform-admins, email_verified=true")
+	t.Setenv("SPECULAR_API_KEYS_FILE", "/etc/specular/keys.json")
+	t.Setenv("SPECULAR_API_KEYS_RELOAD_INTERVAL", "30s")
+	t.Setenv("SPECULAR_MIRROR_AUTH_REQUIRED", "true")
+	t.Setenv("SPECULAR_TENANTS_FILE", "/etc/specular/tenants.json")
+	t.Setenv("SPECULAR_TENANTS_CACHE_DIR", "/srv/specular-tenants")
+	t.Setenv("SPECULAR_NUGET_UPSTREAM", "https://nuget.example.com/v3/index.json")
+	t.Setenv("SPECULAR_NUGET_CACHE_DIR", "/srv/specular-nuget")
+	t.Setenv("SPECULAR_MEMORY_SNAPSHOT_FILE", "/var/lib/specular/memory.snapshot")
+	t.Setenv("SPECULAR_MEMORY_SNAPSHOT_INTERVAL", "1m")
+	t.Setenv("SPECULAR_ARCHIVE_REDIRECT_EXPIRY", "5m")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+
+	if cfg.Port != 9090 {
+		t.Fatalf("expected port 9090, got %d", cfg.Port)
+	}
+	if cfg.Host != "127.0.0.1" {
+		t.Fatalf("expected host 127.0.0.1, got %s", cfg.Host)
+	}
+	if cfg.ReadTimeout != 10*time.Second || cfg.WriteTimeout != 11*time.Second || cfg.ShutdownTimeout != 12*time.Second {
+		t.Fatalf("unexpected timeouts: read %v write %v shutdown %v", cfg.ReadTimeout, cfg.WriteTimeout, cfg.ShutdownTimeout)
+	}
+	if cfg.DownloadIdleTimeout != 14*time.Second {
+		t.Fatalf("expected download idle timeout 14s, got %v", cfg.DownloadIdleTimeout)
+	}
+	if cfg.DownloadConcurrencyPerClient != 4 {
+		t.Fatalf("expected download concurrency per client 4, got %d", cfg.DownloadConcurrencyPerClient)
+	}
+	if cfg.DownloadQueueTimeout != 15*time.Second {
+		t.Fatalf("expected download queue timeout 15s, got %v", cfg.DownloadQueueTimeout)
+	}
+	if strings.Join(cfg.ManagementAllowlist, ",") != "10.0.0.0/8,127.0.0.1" {
+		t.Fatalf("unexpected management allowlist: %v", cfg.ManagementAllowlist)
+	}
+	if !slices.Equal(cfg.RefreshAllowlist, []string{"192.0.2.10"}) {
+		t.Fatalf("unexpected refresh allowlist: %v", cfg.RefreshAllowlist)
+	}
+	if strings.Join(cfg.Listen, ",") != "0.0.0.0:8080,[::1]:8080;network=tcp6" {
+		t.Fatalf("unexpected listen addresses: %v", cfg.Listen)
+	}
+	if cfg.StorageType != "memory" || cfg.CacheDir != "/tmp/specular-cache" {
+		t.Fatalf("unexpected storage settings: type %s cache %s", cfg.StorageType, cfg.CacheDir)
+	}
+	if cfg.MemoryTierSize != 256_000_000 || cfg.MemoryTierMaxArchiveSize != 1<<20 {
+		t.Fatalf("unexpected memory tier settings: size %d max archive size %d", cfg.MemoryTierSize, cfg.MemoryTierMaxArchiveSize)
+	}
+	if cfg.MinFreeBytes != 10<<30 || cfg.FreeSpaceCheckInterval != 5*time.Second {
+		t.Fatalf("unexpected free space settings: min %d interval %v", cfg.MinFreeBytes, cfg.FreeSpaceCheckInterval)
+	}
+	if strings.Join(cfg.NamespaceQuotas, ",") != "partner=20GB" || cfg.NamespaceQuotaPolicy != "evict" {
+		t.Fatalf("unexpected quota settings: quotas %v policy %s", cfg.NamespaceQuotas, cfg.NamespaceQuotaPolicy)
+	}
+	if cfg.CacheMaxSize != 50_000_000_000 || cfg.CacheEvictionPolicy != "evict" {
+		t.Fatalf("unexpected cache size settings: max %d policy %s", cfg.CacheMaxSize, cfg.CacheEvictionPolicy)
+	}
+	if cfg.CacheRetention != 720*time.Hour || cfg.CacheRetentionInterval != 6*time.Hour {
+		t.Fatalf("unexpected retention settings: retention %v interval %v", cfg.CacheRetention, cfg.CacheRetentionInterval)
+	}
+	if !cfg.VerifyArchives {
+		t.Fatalf("expected archive verification enabled")
+	}
+	if !cfg.VerifyShasums {
+		t.Fatalf("expected shasum verification enabled")
+	}
+	if !cfg.CompressMetadata {
+		t.Fatalf("expected metadata compression enabled")
+	}
+	if !cfg.CacheCatalog {
+		t.Fatalf("expected the cache catalog enabled")
+	}
+	if !cfg.StorageReadOnly {
+		t.Fatalf("expected read-only storage")
+	}
+	if cfg.Dedup != "hardlink" {
+		t.Fatalf("unexpected dedup mode %q", cfg.Dedup)
+	}
+	if cfg.DiscoveryHost != "registry.terraform.io" {
+		t.Fatalf("unexpected discovery host %q", cfg.DiscoveryHost)
+	}
+	if strings.Join(cfg.CachePolicy, ",") != "index=write-back,archive=no-store" {
+		t.Fatalf("unexpected cache policy: %v", cfg.CachePolicy)
+	}
+	if cfg.MetricsGoCollector || cfg.MetricsProcessCollector {
+		t.Fatalf("expected default collectors disabled")
+	}
+	if cfg.UpstreamTimeout != 13*time.Second || cfg.MaxRetries != 5 {
+		t.Fatalf("unexpected upstream settings: timeout %v retries %d", cfg.UpstreamTimeout, cfg.MaxRetries)
+	}
+	if !cfg.ChaosEnabled || cfg.ChaosLatency != 250*time.Millisecond || cfg.ChaosErrorRate != 0.1 || cfg.ChaosTruncateRate != 0.05 {
+		t.Fatalf("unexpected chaos settings: enabled %v latency %v error rate %v truncate rate %v",
+			cfg.ChaosEnabled, cfg.ChaosLatency, cfg.ChaosErrorRate, cfg.ChaosTruncateRate)
+	}
+	if cfg.BaseURL != "https://example.com" {
+		t.Fatalf("expected base URL https://example.com, got %s", cfg.BaseURL)
+	}
+	if cfg.LogLevel != "debug" || cfg.LogFormat != "text" {
+		t.Fatalf("unexpected logging settings: level %s format %s", cfg.LogLevel, cfg.LogFormat)
+	}
+	if cfg.LogOutput != "syslog" || cfg.SyslogAddress != "udp://logs.example.com:514" {
+		t.Fatalf("unexpected log output settings: output %s address %s", cfg.LogOutput, cfg.SyslogAddress)
+	}
+	if strings.Join(cfg.LogRedact, ",") != "client_ip,query" || !cfg.LogAnonymizeIP {
+		t.Fatalf("unexpected redaction settings: redact %v anonymize %v", cfg.LogRedact, cfg.LogAnonymizeIP)
+	}
+	if cfg.MetricsEnabled {
+		t.Fatalf("expected metrics disabled")
+	}
+	if cfg.AdminToken != "s3cret" || cfg.StatsRetention != 48*time.Hour {
+		t.Fatalf("unexpected admin settings: token %q retention %v", cfg.AdminToken, cfg.StatsRetention)
+	}
+	if cfg.JobsWorkers != 4 || cfg.JobsQueueSize != 20 || cfg.JobsFile != "/var/lib/specular/jobs.json" {
+		t.Fatalf("unexpected jobs settings: workers %d queue size %d file %q", cfg.JobsWorkers, cfg.JobsQueueSize, cfg.JobsFile)
+	}
+	if cfg.MetadataTTL != time.Hour || !slices.Equal(cfg.MetadataTTLOverrides, []string{"registry.example.com=5m"}) {
+		t.Fatalf("unexpected metadata TTL settings: %v overrides %q", cfg.MetadataTTL, cfg.MetadataTTLOverrides)
+	}
+	if cfg.IndexVersionLimit != 50 {
+		t.Fatalf("expected index version limit 50, got %d", cfg.IndexVersionLimit)
+	}
+	if len(cfg.UpstreamProbes) != 1 || cfg.UpstreamProbes[0] != "registry.terraform.io/hashicorp/null" {
+		t.Fatalf("unexpected upstream probes %v", cfg.UpstreamProbes)
+	}
+	if cfg.UpstreamProbeInterval != time.Minute || cfg.UpstreamCircuitThreshold != 5 {
+		t.Fatalf("unexpected upstream probe interval %s and circuit threshold %d", cfg.UpstreamProbeInterval, cfg.UpstreamCircuitThreshold)
+	}
+	if cfg.BackgroundRateLimit != 30 || !slices.Equal(cfg.BackgroundRateLimits, []string{"releases.hashicorp.com=600"}) {
+		t.Fatalf("unexpected background rate limits %d %q", cfg.BackgroundRateLimit, cfg.BackgroundRateLimits)
+	}
+	if !slices.Equal(cfg.PinnedProviders, []string{"registry.terraform.io/hashicorp/aws"}) {
+		t.Fatalf("unexpected pinned providers %q", cfg.PinnedProviders)
+	}
+	if cfg.AutoPrefetchTop != 20 || !slices.Equal(cfg.AutoPrefetchPlatforms, []string{"linux_amd64", "darwin_arm64"}) {
+		t.Fatalf("unexpected auto-prefetch settings: top %d platforms %q", cfg.AutoPrefetchTop, cfg.AutoPrefetchPlatforms)
+	}
+	if cfg.BackgroundMaxDownloads != 2 || cfg.BackgroundMaxBandwidth != 10<<20 {
+		t.Fatalf("unexpected background budgets %d downloads %d bytes per second", cfg.BackgroundMaxDownloads, cfg.BackgroundMaxBandwidth)
+	}
+	if !slices.Equal(cfg.ProviderSources, []string{"registry.terraform.io/acme=https://registry.acme.example/v1/providers/"}) {
+		t.Fatalf("unexpected provider sources %q", cfg.ProviderSources)
+	}
+	if !slices.Equal(cfg.PassthroughProviders, []string{"registry.example.com/internal", "registry.example.com/platform/netbox"}) {
+		t.Fatalf("unexpected passthrough providers %q", cfg.PassthroughProviders)
+	}
+	if cfg.PIDFile != "/run/specular.pid" {
+		t.Fatalf("unexpected PID file %q", cfg.PIDFile)
+	}
+	if !cfg.SecondaryAsync || cfg.SecondaryQueueSize != 500 {
+		t.Fatalf("unexpected secondary settings: async %v queue size %d", cfg.SecondaryAsync, cfg.SecondaryQueueSize)
+	}
+	if cfg.CacheWriteRetries != 2 || cfg.CacheWriteRetryQueueSize != 50 {
+		t.Fatalf("unexpected cache write retry settings: %d retries queue size %d", cfg.CacheWriteRetries, cfg.CacheWriteRetryQueueSize)
+	}
+	if !slices.Equal(cfg.Schedule, []string{"gc=0 3 * * *", "verify=0 4 * * 0,3"}) || cfg.ScheduleJitter != 5*time.Minute {
+		t.Fatalf("unexpected schedule settings: %q jitter %v", cfg.Schedule, cfg.ScheduleJitter)
+	}
+	if cfg.WithdrawnVersions != "block" || !slices.Equal(cfg.WithdrawnVersionsOverrides, []string{"registry.terraform.io/hashicorp/aws=serve"}) {
+		t.Fatalf("unexpected withdrawn versions settings: %s overrides %q", cfg.WithdrawnVersions, cfg.WithdrawnVersionsOverrides)
+	}
+	if !cfg.StrictIndex {
+		t.Fatal("expected StrictIndex to be true")
+	}
+	if !slices.Equal(cfg.MetricsProviderLabels, []string{"registry.example.com/internal"}) {
+		t.Fatalf("unexpected metrics provider labels: %q", cfg.MetricsProviderLabels)
+	}
+	if !slices.Equal(cfg.ResponseHeaders, []string{"Via=1.1 specular", "mirror:X-Classification=public, cached"}) {
+		t.Fatalf("unexpected response headers: %q", cfg.ResponseHeaders)
+	}
+	if !slices.Equal(cfg.CacheControl, []string{"index=public, max-age=60", "archive=private, max-age=86400"}) ||
+		!slices.Equal(cfg.CacheControlOverrides, []string{"registry.example.com/internal=no-store"}) {
+		t.Fatalf("unexpected cache control settings: %q overrides %q", cfg.CacheControl, cfg.CacheControlOverrides)
+	}
+	if cfg.AdminOIDCIssuer != "https://sso.example.com" || cfg.AdminOIDCAudience != "specular" ||
+		strings.Join(cfg.AdminOIDCRequiredClaims, ",") != "groups=platform-admins,email_verified=true" {
+		t.Fatalf("unexpected admin OIDC settings: issuer %q audience %q claims %v",
+			cfg.AdminOIDCIssuer, cfg.AdminOIDCAudience, cfg.AdminOIDCRequiredClaims)
+	}
+	if cfg.APIKeysFile != "/etc/specular/keys.json" || cfg.APIKeysReloadInterval != 30*time.Second || !cfg.MirrorAuthRequired {
+		t.Fatalf("unexpected API key settings: file %q reload %v mirror auth %v",
+			cfg.APIKeysFile, cfg.APIKeysReloadInterval, cfg.MirrorAuthRequired)
+	}
+	if cfg.TenantsFile != "/etc/specular/tenants.json" || cfg.TenantsCacheDir != "/srv/specular-tenants" {
+		t.Fatalf("unexpected tenants settings: file %q cache %q", cfg.TenantsFile, cfg.TenantsCacheDir)
+	}
+	if cfg.NuGetUpstream != "https://nuget.example.com/v3/index.json" || cfg.NuGetCacheDir != "/srv/specular-nuget" {
+		t.Fatalf("unexpected NuGet settings: upstream %q cache %q", cfg.NuGetUpstream, cfg.NuGetCacheDir)
+	}
+	if cfg.MemorySnapshotFile != "/var/lib/specular/memory.snapshot" || cfg.MemorySnapshotInterval != time.Minute {
+		t.Fatalf("unexpected memory snapshot settings: file %q interval %v", cfg.MemorySnapshotFile, cfg.MemorySnapshotInterval)
+	}
+	if cfg.ArchiveRedirectExpiry != 5*time.Minute {
+		t.Fatalf("unexpected archive redirect expiry %v", cfg.ArchiveRedirectExpiry)
+	}
+}
+
+func TestLoadInvalidEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		envKey  string
+		envVal  string
+		errorOn string
+	}{
+		{name: "port", envKey: "SPECULAR_PORT", envVal: "abc", errorOn: "SPECULAR_PORT must be a valid integer"},
+		{name: "read timeout", envKey: "SPECULAR_READ_TIMEOUT", envVal: "notaduration", errorOn: "SPECULAR_READ_TIMEOUT must be a valid duration"},
+		{name: "write timeout", envKey: "SPECULAR_WRITE_TIMEOUT", envVal: "1x", errorOn: "SPECULAR_WRITE_TIMEOUT must be a valid duration"},
+		{name: "download idle timeout", envKey: "SPECULAR_DOWNLOAD_IDLE_TIMEOUT", envVal: "1x", errorOn: "SPECULAR_DOWNLOAD_IDLE_TIMEOUT must be a valid duration"},
+		{name: "metadata TTL", envKey: "SPECULAR_METADATA_TTL", envVal: "hourly", errorOn: "SPECULAR_METADATA_TTL must be a valid duration"},
+		{name: "index version limit", envKey: "SPECULAR_INDEX_VERSION_LIMIT", envVal: "latest", errorOn: "SPECULAR_INDEX_VERSION_LIMIT must be a valid integer"},
+		{name: "upstream probe interval", envKey: "SPECULAR_UPSTREAM_PROBE_INTERVAL", envVal: "often", errorOn: "SPECULAR_UPSTREAM_PROBE_INTERVAL must be a valid duration (e.g., 30s)"},
+		{name: "background rate limit", envKey: "SPECULAR_BACKGROUND_RATE_LIMIT", envVal: "slow", errorOn: "SPECULAR_BACKGROUND_RATE_LIMIT must be a valid integer"},
+		{name: "background max downloads", envKey: "SPECULAR_BACKGROUND_MAX_DOWNLOADS", envVal: "few", errorOn: "SPECULAR_BACKGROUND_MAX_DOWNLOADS must be a valid integer"},
+		{name: "background max bandwidth", envKey: "SPECULAR_BACKGROUND_MAX_BANDWIDTH", envVal: "fast", errorOn: "SPECULAR_BACKGROUND_MAX_BANDWIDTH must be a byte size per second (e.g., 10MB)"},
+		{name: "upstream circuit threshold", envKey: "SPECULAR_UPSTREAM_CIRCUIT_THRESHOLD", envVal: "three", errorOn: "SPECULAR_UPSTREAM_CIRCUIT_THRESHOLD must be a valid integer"},
+		{name: "download queue timeout", envKey: "SPECULAR_DOWNLOAD_QUEUE_TIMEOUT", envVal: "soon", errorOn: "SPECULAR_DOWNLOAD_QUEUE_TIMEOUT must be a valid duration"},
+		{name: "download concurrency", envKey: "SPECULAR_DOWNLOAD_CONCURRENCY_PER_CLIENT", envVal: "four", errorOn: "SPECULAR_DOWNLOAD_CONCURRENCY_PER_CLIENT must be a valid integer"},
+		{name: "shutdown timeout", envKey: "SPECULAR_SHUTDOWN_TIMEOUT", envVal: "1x", errorOn: "SPECULAR_SHUTDOWN_TIMEOUT must be a valid duration"},
+		{name: "upstream timeout", envKey: "SPECULAR_UPSTREAM_TIMEOUT", envVal: "1x", errorOn: "SPECULAR_UPSTREAM_TIMEOUT must be a valid duration"},
+		{name: "max retries", envKey: "SPECULAR_UPSTREAM_MAX_RETRIES", envVal: "one", errorOn: "SPECULAR_UPSTREAM_MAX_RETRIES must be a valid integer"},
+		{name: "chaos enabled", envKey: "SPECULAR_CHAOS_ENABLED", envVal: "sometimes", errorOn: "SPECULAR_CHAOS_ENABLED must be true or false"},
+		{name: "chaos latency", envKey: "SPECULAR_CHAOS_LATENCY", envVal: "slow", errorOn: "SPECULAR_CHAOS_LATENCY must be a valid duration"},
+		{name: "chaos error rate", envKey: "SPECULAR_CHAOS_ERROR_RATE", envVal: "often", errorOn: "SPECULAR_CHAOS_ERROR_RATE must be a number between 0 and 1"},
+		{name: "chaos error rate range", envKey: "SPECULAR_CHAOS_ERROR_RATE", envVal: "1.5", errorOn: "chaos error rate must be between 0 and 1"},
+		{name: "chaos truncate rate", envKey: "SPECULAR_CHAOS_TRUNCATE_RATE", envVal: "-0.1", errorOn: "chaos truncate rate must be between 0 and 1"},
+		{name: "metrics", envKey: "SPECULAR_METRICS_ENABLED", envVal: "maybe", errorOn: "SPECULAR_METRICS_ENABLED must be true or false"},
+		{name: "anonymize ip", envKey: "SPECULAR_LOG_ANONYMIZE_IP", envVal: "sometimes", errorOn: "SPECULAR_LOG_ANONYMIZE_IP must be true or false"},
+		{name: "min free bytes", envKey: "SPECULAR_MIN_FREE_BYTES", envVal: "lots", errorOn: "SPECULAR_MIN_FREE_BYTES must be a byte size"},
+		{name: "memory tier size", envKey: "SPECULAR_MEMORY_TIER_SIZE", envVal: "lots", errorOn: "SPECULAR_MEMORY_TIER_SIZE must be a byte size"},
+		{name: "free space check interval", envKey: "SPECULAR_FREE_SPACE_CHECK_INTERVAL", envVal: "1x", errorOn: "SPECULAR_FREE_SPACE_CHECK_INTERVAL must be a valid duration"},
+		{name: "go collector", envKey: "SPECULAR_METRICS_GO_COLLECTOR", envVal: "off", errorOn: "SPECULAR_METRICS_GO_COLLECTOR must be true or false"},
+		{name: "compress metadata", envKey: "SPECULAR_COMPRESS_METADATA", envVal: "zstd", errorOn: "SPECULAR_COMPRESS_METADATA must be true or false"},
+		{name: "archive sharding", envKey: "SPECULAR_SHARD_ARCHIVES", envVal: "2", errorOn: "SPECULAR_SHARD_ARCHIVES must be true or false"},
+		{name: "cache lock TTL", envKey: "SPECULAR_CACHE_LOCK_TTL", envVal: "forever", errorOn: "SPECULAR_CACHE_LOCK_TTL must be a valid duration"},
+		{name: "read-only storage", envKey: "SPECULAR_STORAGE_READ_ONLY", envVal: "immutable", errorOn: "SPECULAR_STORAGE_READ_ONLY must be true or false"},
+		{name: "cache catalog", envKey: "SPECULAR_CACHE_CATALOG", envVal: "sqlite", errorOn: "SPECULAR_CACHE_CATALOG must be true or false"},
+		{name: "verify archives", envKey: "SPECULAR_VERIFY_ARCHIVES", envVal: "always", errorOn: "SPECULAR_VERIFY_ARCHIVES must be true or false"},
+		{name: "verify shasums", envKey: "SPECULAR_VERIFY_SHASUMS", envVal: "always", errorOn: "SPECULAR_VERIFY_SHASUMS must be true or false"},
+		{name: "stats retention", envKey: "SPECULAR_STATS_RETENTION", envVal: "1x", errorOn: "SPECULAR_STATS_RETENTION must be a valid duration"},
+		{name: "schedule jitter", envKey: "SPECULAR_SCHEDULE_JITTER", envVal: "1x", errorOn: "SPECULAR_SCHEDULE_JITTER must be a valid duration"},
+		{name: "secondary async", envKey: "SPECULAR_SECONDARY_ASYNC", envVal: "sometimes", errorOn: "SPECULAR_SECONDARY_ASYNC must be true or false"},
+		{name: "secondary queue size", envKey: "SPECULAR_SECONDARY_QUEUE_SIZE", envVal: "lots", errorOn: "SPECULAR_SECONDARY_QUEUE_SIZE must be a valid integer"},
+		{name: "cache write retries", envKey: "SPECULAR_CACHE_WRITE_RETRIES", envVal: "forever", errorOn: "SPECULAR_CACHE_WRITE_RETRIES must be a valid integer"},
+		{name: "jobs workers", envKey: "SPECULAR_JOBS_WORKERS", envVal: "many", errorOn: "SPECULAR_JOBS_WORKERS must be a valid integer"},
+		{name: "api keys reload interval", envKey: "SPECULAR_API_KEYS_RELOAD_INTERVAL", envVal: "1x", errorOn: "SPECULAR_API_KEYS_RELOAD_INTERVAL must be a valid duration"},
+		{name: "mirror auth", envKey: "SPECULAR_MIRROR_AUTH_REQUIRED", envVal: "maybe", errorOn: "SPECULAR_MIRROR_AUTH_REQUIRED must be true or false"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tt.envKey, tt.envVal)
+			_, err := Load()
+			if err == nil {
+				t.Fatalf("expected error for %s", tt.envKey)
+			}
+			if !strings.Contains(err.Error(), tt.errorOn) {
+				t.Fatalf("expected error to contain %q, got %q", tt.errorOn, err.Error())
+			}
+		})
+	}
+}
+
+func TestLoadArchiveDirs(t *testing.T) {
+	t.Setenv("SPECULAR_CACHE_DIR", "/mnt/disk1")
+	t.Setenv("SPECULAR_ARCHIVE_DIRS", "/mnt/disk1, /mnt/disk2")
+	t.Setenv("SPECULAR_SHARD_ARCHIVES", "true")
+	t.Setenv("SPECULAR_CACHE_LOCK_TTL", "30s")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	// The cache directory may also hold archives
+	if !slices.Equal(cfg.ArchiveDirs, []string{"/mnt/disk1", "/mnt/disk2"}) {
+		t.Fatalf("unexpected archive directories %q", cfg.ArchiveDirs)
+	}
+	if !cfg.ShardArchives {
+		t.Fatal("expected archive sharding enabled")
+	}
+	if cfg.CacheLockTTL != 30*time.Second {
+		t.Fatalf("expected cache lock TTL 30s, got %s", cfg.CacheLockTTL)
+	}
+}
+
+func TestLoadSecondaryStorage(t *testing.T) {
+	t.Setenv("SPECULAR_SECONDARY_STORAGE", "s3, /mnt/standby")
+	t.Setenv("SPECULAR_S3_BUCKET", "specular-standby")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if !slices.Equal(cfg.SecondaryStorage, []string{"s3", "/mnt/standby"}) {
+		t.Fatalf("unexpected secondary storage %q", cfg.SecondaryStorage)
+	}
+
+	// The S3 settings are checked for an s3 secondary as well
+	t.Setenv("SPECULAR_S3_BUCKET", "")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "S3 storage requires a bucket") {
+		t.Fatalf("expected a missing bucket error, got %v", err)
+	}
+}
+
+func TestValidateRegisteredStorage(t *testing.T) {
+	storage.Register("config-test", func(ctx context.Context, opts storage.Options) (storage.Storage, error) {
+		return storage.NewMemoryStorage(), nil
+	})
+
+	t.Setenv("SPECULAR_STORAGE_TYPE", "config-test")
+	if _, err := Load(); err != nil {
+		t.Fatalf("expected a registered storage type to be accepted, got %v", err)
+	}
+	t.Setenv("SPECULAR_STORAGE_TYPE", "ceph")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "storage type must be filesystem, memory, or s3, or a registered backend: config-test") {
+		t.Errorf("expected the registered backends in the error, got %v", err)
+	}
+}
+
+func TestLoadRedis(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if cfg.RedisURL != "" || cfg.RedisPrefix != "specular:" {
+		t.Fatalf("unexpected Redis defaults: %q %q", cfg.RedisURL, cfg.RedisPrefix)
+	}
+
+	t.Setenv("SPECULAR_REDIS_URL", "redis://:secret@redis:6379/1")
+	t.Setenv("SPECULAR_REDIS_PREFIX", "")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if cfg.RedisURL != "redis://:secret@redis:6379/1" || cfg.RedisPrefix != "" {
+		t.Fatalf("unexpected Redis settings: %q %q", cfg.RedisURL, cfg.RedisPrefix)
+	}
+
+	t.Setenv("SPECULAR_REDIS_URL", "redis:6379")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "Redis URL must be a redis:// or rediss:// URL with a host") {
+		t.Errorf("expected a Redis URL error, got %v", err)
+	}
+}
+
+func TestLoadS3(t *testing.T) {
+	t.Setenv("SPECULAR_STORAGE_TYPE", "s3")
+	t.Setenv("SPECULAR_S3_BUCKET", "specular-cache")
+	t.Setenv("SPECULAR_S3_PREFIX", "mirror/")
+	t.Setenv("AWS_REGION", "eu-west-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("SPECULAR_S3_ACCESS_KEY_ID", "AKIDSPECULAR")
+	t.Setenv("SPECULAR_S3_SECRET_ACCESS_KEY", "specular-secret")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if cfg.S3Endpoint != "https://s3.eu-west-1.amazonaws.com" || cfg.S3Region != "eu-west-1" || cfg.S3Bucket != "specular-cache" || cfg.S3Prefix != "mirror/" {
+		t.Fatalf("unexpected S3 location: %s %s %s %s", cfg.S3Endpoint, cfg.S3Region, cfg.S3Bucket, cfg.S3Prefix)
+	}
+	// Specular's own variables win over the AWS ones
+	if cfg.S3AccessKeyID != "AKIDSPECULAR" || cfg.S3SecretAccessKey != "specular-secret" || cfg.S3PathStyle {
+		t.Fatalf("unexpected S3 credentials: %s path style %v", cfg.S3AccessKeyID, cfg.S3PathStyle)
+	}
+
+	t.Setenv("SPECULAR_S3_BUCKET", "")
+	t.Setenv("SPECULAR_S3_ENDPOINT", "minio:9000")
+	t.Setenv("SPECULAR_S3_SECRET_ACCESS_KEY", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	_, err = Load()
+	for _, want := range []string{
+		"S3 storage requires a bucket",
+		`S3 endpoint "minio:9000" must be an http or https URL`,
+		"S3 access key ID and secret access key must be set together",
+	} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error %q, got %v", want, err)
+		}
+	}
+}
+
+func TestValidateAggregatesErrors(t *testing.T) {
+	cfg := &Config{
+		Port:                 0,
+		Host:                 " ",
+		ReadTimeout:          -1,
+		WriteTimeout:         0,
+		ShutdownTimeout:      0,
+		DownloadQueueTimeout: -1,
+		StorageType:          "fs",
+		CacheDir:             "",
+		ArchiveDirs:          []string{"/mnt/disk1", "/mnt/disk1/archives"},
+		ShardArchives:        true,
+		CacheLockTTL:         time.Minute,
+		SecondaryStorage:     []string{"standby"},
+		UpstreamTimeout:      0,
+		MaxRetries:           -1,
+		BaseURL:              "http://",
+		LogLevel:             "nope",
+		LogFormat:            "xml",
+		LogOutput:            "printer",
+		LogRedact:            []string{"passwords"},
+		TrustedProxies:       []string{"10.0.0.0/33"},
+		ManagementAllowlist:  []string{"office"},
+		RefreshAllowlist:     []string{"lab"},
+		Listen:               []string{"localhost"},
+		TLSCertFile:          "/etc/specular/tls.crt",
+		TLSMinVersion:        "1.3",
+		TLSMaxVersion:        "1.2",
+		TLSCipherSuites:      []string{"TLS_RSA_WITH_RC4_128_SHA"},
+
+		AdminOIDCRequiredClaims:    []string{"groups"},
+		NamespaceQuotas:            []string{"partner"},
+		NamespaceQuotaPolicy:       "lru",
+		CacheMaxSize:               -1,
+		CacheEvictionPolicy:        "lfu",
+		CacheRetention:             -time.Hour,
+		Dedup:                      "symlink",
+		DiscoveryHost:              "https://registry.terraform.io",
+		Schedule:                   []string{"gc"},
+		CacheControl:               []string{"manifest=no-store"},
+		ResponseHeaders:            []string{"metrics:Via=1.1 specular"},
+		CacheControlOverrides:      []string{"registry.example.com/internal=\r\n"},
+		MetadataTTLOverrides:       []string{"registry.example.com"},
+		IndexVersionLimit:          -1,
+		UpstreamProbes:             []string{"registry.terraform.io"},
+		UpstreamCircuitThreshold:   -1,
+		CacheWriteRetries:          -1,
+		BackgroundRateLimit:        -1,
+		BackgroundMaxDownloads:     -1,
+		BackgroundRateLimits:       []string{"registry.terraform.io=fast"},
+		PinnedProviders:            []string{"registry.terraform.io/"},
+		AutoPrefetchTop:            -1,
+		AutoPrefetchPlatforms:      []string{"linux"},
+		MetricsProviderLabels:      []string{"/internal"},
+		WithdrawnVersions:          "delete",
+		WithdrawnVersionsOverrides: []string{"registry.terraform.io=skip"},
+		PassthroughProviders:       []string{"registry.example.com//aws"},
+		ProviderSources:            []string{"registry.terraform.io/acme=ftp://mirror.acme.example"},
+		APIKeysReloadInterval:      -1,
+		MirrorAuthRequired:         true,
+		TenantsFile:                "/etc/specular/tenants.json",
+		MemorySnapshotFile:         "/var/lib/specular/memory.snapshot",
+		MemorySnapshotInterval:     -1,
+		ArchiveRedirectExpiry:      8 * 24 * time.Hour,
+		NuGetUpstream:              "nuget.org",
+	}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatalf("expected validation to fail")
+	}
+
+	checks := []string{
+		"port must be between 1 and 65535",
+		"host must not be empty",
+		"read timeout must be positive",
+		"write timeout must be positive",
+		"download idle timeout must be positive",
+		"shutdown timeout must be positive",
+		"download queue timeout must not be negative",
+		"upstream timeout must be positive",
+		"max retries must not be negative",
+		"free space check interval must be positive",
+		`namespace quotas: invalid quota "partner", must be namespace=size or hostname/namespace=size`,
+		"namespace quota policy must be reject, evict or evict-lru",
+		"cache max size must not be negative",
+		"cache eviction policy must be reject, evict or evict-lru",
+		"cache retention must not be negative",
+		"cache retention interval must be positive",
+		"dedup must be off, hardlink or reflink",
+		"cache directory must not be empty",
+		"archive directories require filesystem storage",
+		"archive sharding requires filesystem storage",
+		"cache locks require filesystem storage",
+		`secondary storage "standby" must be s3 or an absolute directory`,
+		"memory snapshot file requires memory storage",
+		"memory snapshot interval must not be negative",
+		"archive redirect expiry must be between 0 and 168h",
+		`archive directory "/mnt/disk1/archives" must not be inside or contain "/mnt/disk1"`,
+		"base URL must be a valid URL with scheme and host",
+		"log level must be debug, info, warn, or error",
+		"log format must be json or text",
+		"log output must be stdout, stderr, syslog, or journald",
+		`log redaction "passwords" must be client_ip, auth, or query`,
+		`trusted proxies: invalid CIDR or IP address "10.0.0.0/33"`,
+		`management allowlist: invalid CIDR or IP address "office"`,
+		`refresh allowlist: invalid CIDR or IP address "lab"`,
+		`listen: invalid address "localhost", must be host:port`,
+		"TLS certificate and key files must be set together",
+		"TLS min version must not be greater than max version",
+		`TLS cipher suites: unknown or insecure cipher suite "TLS_RSA_WITH_RC4_128_SHA"`,
+		"admin OIDC audience and required claims need an OIDC issuer",
+		`admin OIDC required claims: invalid claim "groups", must be name=value`,
+		"jobs workers must be at least 1",
+		"jobs queue size must be at least 1",
+		"secondary queue size must be at least 1",
+		"cache write retries must not be negative",
+		"cache write retry queue size must be at least 1",
+		`provider sources: invalid URL in "registry.terraform.io/acme=ftp://mirror.acme.example", must be an http or https URL`,
+		`discovery host "https://registry.terraform.io" must be a hostname`,
+		`passthrough providers: invalid provider "registry.example.com//aws", must be hostname[/namespace[/type]]`,
+		"index version limit must not be negative",
+		`upstream probes: invalid probe "registry.terraform.io", must be hostname/namespace/type`,
+		"upstream probe interval must be positive",
+		"upstream circuit threshold must not be negative",
+		"background rate limit must not be negative",
+		"background max downloads must not be negative",
+		`background rate limits: invalid rate in "registry.terraform.io=fast", must be a non-negative integer`,
+		`pinned providers: invalid provider "registry.terraform.io/", must be hostname[/namespace[/type]]`,
+		"auto-prefetch top must not be negative",
+		`auto-prefetch platform "linux" must be os_arch (e.g., linux_amd64)`,
+		"withdrawn versions must be serve, hide or block",
+		`withdrawn versions overrides: invalid policy in "registry.terraform.io=skip", must be serve, hide or block`,
+		`metrics provider labels: invalid provider "/internal", must be hostname[/namespace[/type]]`,
+		`metadata TTL overrides: invalid entry "registry.example.com", must be hostname[/namespace[/type]]=duration`,
+		`response headers: invalid group in "metrics:Via=1.1 specular", must be mirror, api or admin`,
+		`cache control: invalid resource in "manifest=no-store", must be index, version or archive`,
+		`cache control overrides: invalid header value in "registry.example.com/internal=\r\n"`,
+		`schedule: invalid entry "gc", must be kind=cron expression`,
+		"API keys reload interval must not be negative",
+		"mirror authentication requires an admin token, OIDC issuer, or API keys file",
+		"tenants cache directory must differ from the cache directory",
+		`NuGet upstream "nuget.org" must be an http or https URL`,
+		"NuGet cache directory must differ from the cache directory",
+		"storage type must be filesystem, memory, or s3",
+	}
+
+	for _, msg := range checks {
+		if !strings.Contains(err.Error(), msg) {
+			t.Fatalf("expected error to include %q, got %q", msg, err.Error())
+		}
+	}
+}
+
+func TestValidateBaseURLMissingHost(t *testing.T) {
+	cfg := &Config{
+		Port:            8080,
+		Host:            "localhost",
+		ReadTimeout:     time.Second,
+		WriteTimeout:    time.Second,
+		ShutdownTimeout: time.Second,
+		StorageType:     "filesystem",
+		CacheDir:        "/tmp",
+		UpstreamTimeout: time.Second,
+		MaxRetries:      1,
+		BaseURL:         "http://",
+		LogLevel:        "info",
+		LogFormat:       "json",
+		MetricsEnabled:  true,
+	}
+
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "base URL must be a valid URL with scheme and host") {
+		t.Fatalf("expected base URL validation error, got %v", err)
+	}
+}
+
+func TestValidateHostWhitespace(t *testing.T) {
+	cfg := &Config{
+		Port:            8080,
+		Host:            "   ",
+		ReadTimeout:     time.Second,
+		WriteTimeout:    time.Second,
+		ShutdownTimeout: time.Second,
+		StorageType:     "filesystem",
+		CacheDir:        "/tmp",
+		UpstreamTimeout: time.Second,
+		MaxRetries:      1,
+		BaseURL:         "http://localhost:8080",
+		LogLevel:        "info",
+		LogFormat:       "json",
+		MetricsEnabled:  true,
+	}
+
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "host must not be empty") {
+		t.Fatalf("expected host validation error, got %v", err)
+	}
+}
+
+func TestLoadLogRedactNone(t *testing.T) {
+	t.Setenv("SPECULAR_LOG_REDACT", "none")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if len(cfg.LogRedact) != 0 {
+		t.Fatalf("expected no redactions, got %v", cfg.LogRedact)
+	}
+}
+
+func TestParsePrefixes(t *testing.T) {
+	prefixes, err := ParsePrefixes([]string{"10.0.0.0/8", "192.168.1.7", "fd00::/8", "10.1.2.3/16"})
+	if err != nil {
+		t.Fatalf("ParsePrefixes() returned error: %v", err)
+	}
+
+	want := []string{"10.0.0.0/8", "192.168.1.7/32", "fd00::/8", "10.1.0.0/16"}
+	if len(prefixes) != len(want) {
+		t.Fatalf("expected %d prefixes, got %d", len(want), len(prefixes))
+	}
+	for i, prefix := range prefixes {
+		if prefix.String() != want[i] {
+			t.Errorf("prefix %d = %s, want %s", i, prefix, want[i])
+		}
+	}
+
+	if _, err := ParsePrefixes([]string{"not-an-ip"}); err == nil {
+		t.Fatal("expected error for invalid entry")
+	}
+}
+
+func TestLoadTLS(t *testing.T) {
+	t.Setenv("SPECULAR_TLS_CERT_FILE", "/etc/specular/tls.crt")
+	t.Setenv("SPECULAR_TLS_KEY_FILE", "/etc/specular/tls.key")
+	t.Setenv("SPECULAR_TLS_MIN_VERSION", "1.3")
+	t.Setenv("SPECULAR_TLS_CIPHER_SUITES", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if !cfg.TLSEnabled() {
+		t.Fatal("expected TLS to be enabled")
+	}
+	if cfg.TLSMinVersion != "1.3" || len(cfg.TLSCipherSuites) != 2 {
+		t.Fatalf("unexpected TLS settings: min %s suites %v", cfg.TLSMinVersion, cfg.TLSCipherSuites)
+	}
+}
+
+func TestListeners(t *testing.T) {
+	base := Config{Host: "0.0.0.0", Port: 8080, TLSCertFile: "/etc/tls.crt", TLSKeyFile: "/etc/tls.key"}
+
+	listeners, err := base.Listeners()
+	if err != nil {
+		t.Fatalf("Listeners() returned error: %v", err)
+	}
+	if len(listeners) != 1 || listeners[0].Address != "0.0.0.0:8080" || !listeners[0].TLS() {
+		t.Fatalf("unexpected default listeners: %+v", listeners)
+	}
+
+	cfg := base
+	cfg.Listen = []string{"0.0.0.0:8080", "[::]:8443;tls;network=tcp6", "10.0.0.5:9443;cert=/etc/a.crt;key=/etc/a.key"}
+	listeners, err = cfg.Listeners()
+	if err != nil {
+		t.Fatalf("Listeners() returned error: %v", err)
+	}
+	want := []Listener{
+		{Address: "0.0.0.0:8080", Network: "tcp"},
+		{Address: "[::]:8443", Network: "tcp6", CertFile: "/etc/tls.crt", KeyFile: "/etc/tls.key"},
+		{Address: "10.0.0.5:9443", Network: "tcp", CertFile: "/etc/a.crt", KeyFile: "/etc/a.key"},
+	}
+	if len(listeners) != len(want) {
+		t.Fatalf("expected %d listeners, got %+v", len(want), listeners)
+	}
+	for i := range want {
+		if listeners[i] != want[i] {
+			t.Errorf("listener %d = %+v, want %+v", i, listeners[i], want[i])
+		}
+	}
+
+	invalid := map[string][]string{
+		"missing port":      {"0.0.0.0"},
+		"port out of range": {"0.0.0.0:70000"},
+		"duplicate":         {":8080", ":8080"},
+		"unknown option":    {":8080;http2"},
+		"bad network":       {":8080;network=udp"},
+		"cert without key":  {":8443;cert=/etc/a.crt"},
+	}
+	for name, listen := range invalid {
+		cfg := base
+		cfg.Listen = listen
+		if _, err := cfg.Listeners(); err == nil {
+			t.Errorf("%s: expected error for %v", name, listen)
+		}
+	}
+
+	noTLS := Config{Listen: []string{":8443;tls"}}
+	if _, err := noTLS.Listeners(); err == nil {
+		t.Error("expected error for tls option without global certificate")
+	}
+}
+
+func TestParseTLSVersion(t *testing.T) {
+	for _, v := range []string{"", "1.0", "1.1", "1.2", "1.3"} {
+		if _, err := ParseTLSVersion(v); err != nil {
+			t.Errorf("ParseTLSVersion(%q) returned error: %v", v, err)
+		}
+	}
+	if _, err := ParseTLSVersion("1.4"); err == nil {
+		t.Error("expected error for unsupported version")
+	}
+}
+
+func TestValidateAdminOIDCIssuer(t *testing.T) {
+	t.Setenv("SPECULAR_ADMIN_OIDC_ISSUER", "sso.example.com")
+
+	_, err := Load()
+	if err == nil || !strings.Contains(err.Error(), "admin OIDC issuer must be a valid URL with scheme and host") {
+		t.Fatalf("expected admin OIDC issuer validation error, got %v", err)
+	}
+}
+
+func TestValidateAdminOIDCNeedsAudienceAndClaims(t *testing.T) {
+	t.Setenv("SPECULAR_ADMIN_OIDC_ISSUER", "https://token.actions.githubusercontent.com")
+
+	_, err := Load()
+	if err == nil || !strings.Contains(err.Error(), "admin OIDC issuer requires an audience") ||
+		!strings.Contains(err.Error(), "admin OIDC issuer requires at least one required claim") {
+		t.Fatalf("expected audience and required claims validation errors, got %v", err)
+	}
+}
+
+func TestValidateTenantsNeedMirrorAuth(t *testing.T) {
+	t.Setenv("SPECULAR_API_KEYS_FILE", "/etc/specular/keys.json")
+	t.Setenv("SPECULAR_TENANTS_FILE", "/etc/specular/tenants.json")
+
+	_, err := Load()
+	if err == nil || !strings.Contains(err.Error(), "tenants require mirror authentication to identify them") {
+		t.Fatalf("expected tenants validation error, got %v", err)
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    int64
+		wantErr bool
+	}{
+		{input: "1048576", want: 1048576},
+		{input: "500MB", want: 500 * 1000 * 1000},
+		{input: "20 GB", want: 20 * 1000 * 1000 * 1000},
+		{input: "1.5GiB", want: 3 << 29},
+		{input: "2tib", want: 2 << 40},
+		{input: "10B", want: 10},
+		{input: "", wantErr: true},
+		{input: "GB", wantErr: true},
+		{input: "-1GB", wantErr: true},
+		{input: "10PB", wantErr: true},
+		{input: "1.2.3MB", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseBytes(tt.input)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseBytes(%q) expected error, got %d", tt.input, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseBytes(%q) = %d, %v, want %d", tt.input, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseNamespaceQuotas(t *testing.T) {
+	quotas, err := ParseNamespaceQuotas([]string{"partner=20GB", "registry.example.com/team=512MiB"})
+	if err != nil {
+		t.Fatalf("ParseNamespaceQuotas() returned error: %v", err)
+	}
+	if quotas["partner"] != 20*1000*1000*1000 || quotas["registry.example.com/team"] != 512<<20 {
+		t.Fatalf("unexpected quotas: %v", quotas)
+	}
+
+	for _, invalid := range []string{"partner", "=1GB", "a/b/c=1GB", "/team=1GB", "partner=0", "partner=lots"} {
+		if _, err := ParseNamespaceQuotas([]string{invalid}); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestParseCachePolicies(t *testing.T) {
+	policies, err := ParseCachePolicies([]string{"write-back", "archive=no-store"})
+	if err != nil {
+		t.Fatalf("ParseCachePolicies() returned error: %v", err)
+	}
+	if policies["index"] != "write-back" || policies["version"] != "write-back" || policies["archive"] != "no-store" {
+		t.Fatalf("unexpected policies: %v", policies)
+	}
+
+	for _, invalid := range []string{"write-around", "index=", "manifest=no-store", "=write-back"} {
+		if _, err := ParseCachePolicies([]string{invalid}); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestParseCacheControl(t *testing.T) {
+	values, err := ParseCacheControl([]string{"index = public, max-age=60", "archive=no-store"})
+	if err != nil {
+		t.Fatalf("ParseCacheControl() returned error: %v", err)
+	}
+	if values["index"] != "public, max-age=60" || values["archive"] != "no-store" || len(values) != 2 {
+		t.Fatalf("unexpected values: %v", values)
+	}
+
+	for _, invalid := range []string{"no-store", "index=", "manifest=no-store", "=no-store", "index=no-store\nX-Injected: 1"} {
+		if _, err := ParseCacheControl([]string{invalid}); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestParseCacheControlOverrides(t *testing.T) {
+	values, err := ParseCacheControlOverrides([]string{"registry.example.com/internal=no-store", "registry.terraform.io=public, max-age=60"})
+	if err != nil {
+		t.Fatalf("ParseCacheControlOverrides() returned error: %v", err)
+	}
+	if values["registry.example.com/internal"] != "no-store" || values["registry.terraform.io"] != "public, max-age=60" {
+		t.Fatalf("unexpected values: %v", values)
+	}
+
+	for _, invalid := range []string{"registry.example.com", "=no-store", "registry.example.com/=no-store", "registry.example.com="} {
+		if _, err := ParseCacheControlOverrides([]string{invalid}); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestParseResponseHeaders(t *testing.T) {
+	headers, err := ParseResponseHeaders([]string{"via=1.1 specular", " mirror : X-Classification = internal ", "mirror:X-Classification=cached"})
+	if err != nil {
+		t.Fatalf("ParseResponseHeaders() returned error: %v", err)
+	}
+	if headers[""].Get("Via") != "1.1 specular" || len(headers[""]) != 1 {
+		t.Fatalf("unexpected global headers: %v", headers[""])
+	}
+	if got := headers["mirror"].Values("X-Classification"); !slices.Equal(got, []string{"internal", "cached"}) {
+		t.Fatalf("unexpected mirror headers: %v", headers["mirror"])
+	}
+
+	for _, invalid := range []string{"Via", "=1.1 specular", "X Classification=internal", "metrics:Via=1.1", "Via=", "Via=a\r\nX-Injected: 1"} {
+		if _, err := ParseResponseHeaders([]string{invalid}); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestParseWithdrawnPolicies(t *testing.T) {
+	policies, err := ParseWithdrawnPolicies([]string{"registry.terraform.io=hide", " registry.terraform.io/hashicorp/aws = serve "})
+	if err != nil {
+		t.Fatalf("ParseWithdrawnPolicies() returned error: %v", err)
+	}
+	if policies["registry.terraform.io"] != "hide" || policies["registry.terraform.io/hashicorp/aws"] != "serve" {
+		t.Fatalf("unexpected policies: %v", policies)
+	}
+
+	for _, invalid := range []string{"registry.terraform.io", "=hide", "registry.terraform.io/=hide", "registry.terraform.io=skip"} {
+		if _, err := ParseWithdrawnPolicies([]string{invalid}); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestParseSchedule(t *testing.T) {
+	schedule, err := ParseSchedule([]string{"gc=0 3 * * *", " verify = @weekly "})
+	if err != nil {
+		t.Fatalf("ParseSchedule() returned error: %v", err)
+	}
+	if schedule["gc"] != "0 3 * * *" || schedule["verify"] != "@weekly" {
+		t.Fatalf("unexpected schedule: %v", schedule)
+	}
+
+	for _, invalid := range [][]string{{"gc"}, {"gc="}, {"=@daily"}, {"gc=@daily", "gc=@hourly"}} {
+		if _, err := ParseSchedule(invalid); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestParseMetadataTTLs(t *testing.T) {
+	ttls, err := ParseMetadataTTLs([]string{"registry.example.com=5m", " registry.terraform.io/hashicorp/aws = 1h "})
+	if err != nil {
+		t.Fatalf("ParseMetadataTTLs() returned error: %v", err)
+	}
+	if ttls["registry.example.com"] != 5*time.Minute || ttls["registry.terraform.io/hashicorp/aws"] != time.Hour {
+		t.Fatalf("unexpected TTLs: %v", ttls)
+	}
+
+	for _, invalid := range []string{"registry.example.com", "=5m", "registry.example.com/=5m", "a/b/c/d=5m", "registry.example.com=soon", "registry.example.com=-1m"} {
+		if _, err := ParseMetadataTTLs([]string{invalid}); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestParseProviderPatterns(t *testing.T) {
+	valid := []string{"registry.example.com", "registry.example.com/internal", "registry.example.com/internal/netbox"}
+	if _, err := ParseProviderPatterns(valid); err != nil {
+		t.Fatalf("ParseProviderPatterns() returned error: %v", err)
+	}
+	for _, invalid := range []string{"", "/internal", "registry.example.com/", "a/b/c/d"} {
+		if _, err := ParseProviderPatterns([]string{invalid}); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestParseRateLimits(t *testing.T) {
+	rates, err := ParseRateLimits([]string{"registry.terraform.io=120", " releases.hashicorp.com = 0 "})
+	if err != nil {
+		t.Fatalf("ParseRateLimits() returned error: %v", err)
+	}
+	if rates["registry.terraform.io"] != 120 || rates["releases.hashicorp.com"] != 0 || len(rates) != 2 {
+		t.Fatalf("unexpected rates: %v", rates)
+	}
+
+	for _, invalid := range []string{"registry.terraform.io", "=60", "registry.terraform.io/hashicorp=60", "registry.terraform.io=-1", "registry.terraform.io=1.5"} {
+		if _, err := ParseRateLimits([]string{invalid}); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestParseUpstreamProbes(t *testing.T) {
+	probes, err := ParseUpstreamProbes([]string{"registry.terraform.io/hashicorp/null", "registry.acme.example/acme/widget"})
+	if err != nil {
+		t.Fatalf("ParseUpstreamProbes() returned error: %v", err)
+	}
+	if probes["registry.terraform.io"] != [2]string{"hashicorp", "null"} || probes["registry.acme.example"] != [2]string{"acme", "widget"} {
+		t.Fatalf("unexpected probes: %v", probes)
+	}
+
+	for _, invalid := range [][]string{
+		{"registry.terraform.io/hashicorp"},
+		{"registry.terraform.io/hashicorp/null/extra"},
+		{"registry.terraform.io//null"},
+		{"registry.terraform.io/hashicorp/null", "registry.terraform.io/hashicorp/aws"},
+	} {
+		if _, err := ParseUpstreamProbes(invalid); err == nil {
+			t.Errorf("expected error for %v", invalid)
+		}
+	}
+}
+
+func TestParseProviderSources(t *testing.T) {
+	sources, err := ParseProviderSources([]string{"registry.terraform.io/acme = https://registry.acme.example/v1/providers/?token=a=b"})
+	if err != nil {
+		t.Fatalf("ParseProviderSources() returned error: %v", err)
+	}
+	if sources["registry.terraform.io/acme"] != "https://registry.acme.example/v1/providers/?token=a=b" {
+		t.Fatalf("unexpected sources: %v", sources)
+	}
+
+	for _, invalid := range []string{"registry.terraform.io/acme", "=https://registry.acme.example", "registry.terraform.io/acme=/v1/providers", "registry.terraform.io/acme=ftp://registry.acme.example"} {
+		if _, err := ParseProviderSources([]string{invalid}); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
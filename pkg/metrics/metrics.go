@@ -0,0 +1,573 @@
+// Package metrics provides the Prometheus metrics recorded by the mirror
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics holds all Prometheus metrics
+type Metrics struct {
+	enabled  bool // true if metrics are actually enabled, false for noop
+	registry *prometheus.Registry
+	handler  http.Handler
+
+	// HTTP request metrics
+	HTTPRequestsTotal    prometheus.CounterVec
+	HTTPRequestDuration  prometheus.HistogramVec
+	HTTPRequestSize      prometheus.HistogramVec
+	HTTPResponseSize     prometheus.HistogramVec
+	HTTPRequestsInFlight prometheus.Gauge
+	// HTTPProviderRequestsTotal is only recorded for providers with provider labels enabled
+	HTTPProviderRequestsTotal prometheus.CounterVec
+
+	// Cache metrics
+	CacheHitsTotal   prometheus.CounterVec
+	CacheMissesTotal prometheus.CounterVec
+
+	// Upstream metrics
+	UpstreamRequestsTotal   prometheus.CounterVec
+	UpstreamRequestDuration prometheus.HistogramVec
+	UpstreamErrors          prometheus.CounterVec
+	UpstreamBytesTotal      prometheus.CounterVec
+
+	// Upstream health probes
+	UpstreamHealthy       prometheus.GaugeVec
+	UpstreamProbeDuration prometheus.GaugeVec
+	UpstreamCircuitOpen   prometheus.GaugeVec
+	UpstreamProbesTotal   prometheus.CounterVec
+
+	// Bandwidth metrics
+	BytesServedTotal prometheus.CounterVec
+
+	// Storage metrics
+	StorageOperationsTotal   prometheus.CounterVec
+	StorageOperationDuration prometheus.HistogramVec
+	StorageFreeBytes         prometheus.Gauge
+	PassthroughMode          prometheus.Gauge
+
+	// Cache contents, updated by reconciliation
+	CacheArchives     prometheus.Gauge
+	CacheArchiveBytes prometheus.Gauge
+
+	// Cache entries removed for not being read within the retention window
+	CacheExpiredEntriesTotal prometheus.CounterVec
+	CacheExpiredBytesTotal   prometheus.Counter
+
+	// Replication to a secondary storage
+	ReplicationLag     prometheus.Gauge
+	ReplicationPending prometheus.Gauge
+	ReplicationTotal   prometheus.CounterVec
+
+	// Retries of failed cache writes
+	CacheWriteRetryPending prometheus.Gauge
+	CacheWriteRetriesTotal prometheus.CounterVec
+
+	// Background job metrics
+	JobsQueueDepth prometheus.Gauge
+	JobsTotal      prometheus.CounterVec
+
+	// Error metrics
+	ErrorsTotal prometheus.CounterVec
+}
+
+// Options selects the default collectors registered alongside the Specular metrics
+type Options struct {
+	// DisableGoCollector skips the Go runtime metrics (go_*)
+	DisableGoCollector bool
+	// DisableProcessCollector skips the process metrics (process_*)
+	DisableProcessCollector bool
+}
+
+// New creates all metrics and registers them with registry
+// A nil registry creates a new one, so independent instances never collide
+func New(registry *prometheus.Registry, opts Options) *Metrics {
+	if registry == nil {
+		registry = prometheus.NewRegistry()
+	}
+	if !opts.DisableGoCollector {
+		registry.MustRegister(collectors.NewGoCollector())
+	}
+	if !opts.DisableProcessCollector {
+		registry.MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	}
+
+	factory := promauto.With(registry)
+	m := &Metrics{
+		enabled:  true,
+		registry: registry,
+		handler:  promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry}),
+		HTTPRequestsTotal: *factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "specular_http_requests_total",
+				Help: "Total number of HTTP requests by route pattern",
+			},
+			[]string{"method", "path", "status"},
+		),
+
+		HTTPRequestDuration: *factory.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "specular_http_request_duration_seconds",
+				Help:    "HTTP request duration in seconds",
+				Buckets: prometheus.DefBuckets,
+			},
+			[]string{"method", "path"},
+		),
+
+		HTTPRequestSize: *factory.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "specular_http_request_size_bytes",
+				Help:    "HTTP request size in bytes",
+				Buckets: prometheus.ExponentialBuckets(100, 10, 8),
+			},
+			[]string{"method", "path"},
+		),
+
+		HTTPResponseSize: *factory.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "specular_http_response_size_bytes",
+				Help:    "HTTP response size in bytes",
+				Buckets: prometheus.ExponentialBuckets(100, 10, 8),
+			},
+			[]string{"method", "path", "status"},
+		),
+
+		HTTPRequestsInFlight: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "specular_http_requests_in_flight",
+				Help: "Number of HTTP requests currently being served",
+			},
+		),
+
+		HTTPProviderRequestsTotal: *factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "specular_http_provider_requests_total",
+				Help: "Total number of HTTP requests by route pattern and provider, for providers with provider labels enabled",
+			},
+			[]string{"method", "path", "hostname", "namespace", "type", "status"},
+		),
+
+		CacheHitsTotal: *factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "specular_cache_hits_total",
+				Help: "Total number of cache hits",
+			},
+			[]string{"cache_type"},
+		),
+
+		CacheMissesTotal: *factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "specular_cache_misses_total",
+				Help: "Total number of cache misses",
+			},
+			[]string{"cache_type"},
+		),
+
+		UpstreamRequestsTotal: *factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "specular_upstream_requests_total",
+				Help: "Total number of upstream registry requests",
+			},
+			[]string{"status"},
+		),
+
+		UpstreamRequestDuration: *factory.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "specular_upstream_request_duration_seconds",
+				Help:    "Upstream request duration in seconds",
+				Buckets: prometheus.DefBuckets,
+			},
+			[]string{"endpoint"},
+		),
+
+		UpstreamErrors: *factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "specular_upstream_errors_total",
+				Help: "Total number of upstream errors",
+			},
+			[]string{"error_type"},
+		),
+
+		UpstreamBytesTotal: *factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "specular_upstream_bytes_total",
+				Help: "Total bytes fetched from upstream registries",
+			},
+			[]string{"resource_type"},
+		),
+
+		UpstreamHealthy: *factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "specular_upstream_healthy",
+				Help: "Whether the last health probe of an upstream registry succeeded (1) or failed (0)",
+			},
+			[]string{"hostname"},
+		),
+
+		UpstreamProbeDuration: *factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "specular_upstream_probe_duration_seconds",
+				Help: "Duration of the last health probe of an upstream registry",
+			},
+			[]string{"hostname"},
+		),
+
+		UpstreamCircuitOpen: *factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "specular_upstream_circuit_open",
+				Help: "Whether the circuit breaker of an upstream registry is open (1) or closed (0)",
+			},
+			[]string{"hostname"},
+		),
+
+		UpstreamProbesTotal: *factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "specular_upstream_probes_total",
+				Help: "Total number of upstream health probes by result (success, failure)",
+			},
+			[]string{"hostname", "result"},
+		),
+
+		BytesServedTotal: *factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "specular_bytes_served_total",
+				Help: "Total response body bytes served to clients",
+			},
+			[]string{"resource_type"},
+		),
+
+		StorageOperationsTotal: *factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "specular_storage_operations_total",
+				Help: "Total number of storage operations",
+			},
+			[]string{"operation", "status"},
+		),
+
+		StorageOperationDuration: *factory.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "specular_storage_operation_duration_seconds",
+				Help:    "Storage operation duration in seconds",
+				Buckets: prometheus.DefBuckets,
+			},
+			[]string{"operation"},
+		),
+
+		StorageFreeBytes: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "specular_storage_free_bytes",
+				Help: "Bytes available on the cache filesystem",
+			},
+		),
+
+		PassthroughMode: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "specular_passthrough_mode",
+				Help: "Whether archives are served from upstream without caching (1) or cached normally (0)",
+			},
+		),
+
+		CacheArchives: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "specular_cache_archives",
+				Help: "Number of cached provider archives found by the last reconciliation",
+			},
+		),
+
+		CacheArchiveBytes: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "specular_cache_archive_bytes",
+				Help: "Total size of cached provider archives found by the last reconciliation",
+			},
+		),
+
+		CacheExpiredEntriesTotal: *factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "specular_cache_expired_entries_total",
+				Help: "Total number of cache entries removed for not being read within the retention window by type (metadata, archive)",
+			},
+			[]string{"type"},
+		),
+
+		CacheExpiredBytesTotal: factory.NewCounter(
+			prometheus.CounterOpts{
+				Name: "specular_cache_expired_bytes_total",
+				Help: "Total bytes of cache entries removed for not being read within the retention window",
+			},
+		),
+
+		ReplicationLag: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "specular_replication_lag_seconds",
+				Help: "Time the last replicated object waited in the replication queue, zero once the queue is empty",
+			},
+		),
+
+		ReplicationPending: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "specular_replication_pending",
+				Help: "Number of cached objects waiting to be replicated",
+			},
+		),
+
+		ReplicationTotal: *factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "specular_replication_total",
+				Help: "Total number of cached objects handed to replication by result (replicated, failed, dropped)",
+			},
+			[]string{"result"},
+		),
+
+		CacheWriteRetryPending: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "specular_cache_write_retry_pending",
+				Help: "Number of failed cache writes waiting to be retried",
+			},
+		),
+
+		CacheWriteRetriesTotal: *factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "specular_cache_write_retries_total",
+				Help: "Total number of failed cache writes handed to the retry queue by result (succeeded, failed, dropped)",
+			},
+			[]string{"result"},
+		),
+
+		JobsQueueDepth: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "specular_jobs_queue_depth",
+				Help: "Number of background jobs waiting for a worker",
+			},
+		),
+
+		JobsTotal: *factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "specular_jobs_total",
+				Help: "Total number of finished background jobs",
+			},
+			[]string{"kind", "status"},
+		),
+
+		ErrorsTotal: *factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "specular_errors_total",
+				Help: "Total number of errors",
+			},
+			[]string{"component", "error_type"},
+		),
+	}
+
+	return m
+}
+
+// RecordHTTPRequest records HTTP request metrics
+// path should be a route pattern rather than the request path, to keep the number of series bounded
+func (m *Metrics) RecordHTTPRequest(method, path string, status int, duration float64, reqSize, respSize int64) {
+	statusStr := fmt.Sprintf("%d", status)
+	m.HTTPRequestsTotal.WithLabelValues(method, path, statusStr).Inc()
+	m.HTTPRequestDuration.WithLabelValues(method, path).Observe(duration)
+	m.HTTPRequestSize.WithLabelValues(method, path).Observe(float64(reqSize))
+	m.HTTPResponseSize.WithLabelValues(method, path, statusStr).Observe(float64(respSize))
+}
+
+// RecordHTTPProviderRequest records an HTTP request for a provider
+func (m *Metrics) RecordHTTPProviderRequest(method, path, hostname, namespace, providerType string, status int) {
+	m.HTTPProviderRequestsTotal.WithLabelValues(method, path, hostname, namespace, providerType, fmt.Sprintf("%d", status)).Inc()
+}
+
+// AddHTTPRequestsInFlight adjusts the number of HTTP requests being served by delta
+func (m *Metrics) AddHTTPRequestsInFlight(delta int) {
+	m.HTTPRequestsInFlight.Add(float64(delta))
+}
+
+// RecordCacheHit records a cache hit
+func (m *Metrics) RecordCacheHit(cacheType string) {
+	m.CacheHitsTotal.WithLabelValues(cacheType).Inc()
+}
+
+// RecordCacheMiss records a cache miss
+func (m *Metrics) RecordCacheMiss(cacheType string) {
+	m.CacheMissesTotal.WithLabelValues(cacheType).Inc()
+}
+
+// RecordUpstreamRequest records an upstream request
+func (m *Metrics) RecordUpstreamRequest(status int, duration float64, endpoint string) {
+	statusStr := fmt.Sprintf("%d", status)
+	m.UpstreamRequestsTotal.WithLabelValues(statusStr).Inc()
+	m.UpstreamRequestDuration.WithLabelValues(endpoint).Observe(duration)
+}
+
+// RecordUpstreamError records an upstream error
+func (m *Metrics) RecordUpstreamError(errorType string) {
+	m.UpstreamErrors.WithLabelValues(errorType).Inc()
+}
+
+// RecordUpstreamBytes records bytes fetched from upstream
+func (m *Metrics) RecordUpstreamBytes(resourceType string, n int64) {
+	if n > 0 {
+		m.UpstreamBytesTotal.WithLabelValues(resourceType).Add(float64(n))
+	}
+}
+
+// RecordUpstreamProbe records the outcome of an upstream health probe and the circuit breaker state
+func (m *Metrics) RecordUpstreamProbe(hostname string, healthy bool, duration time.Duration, circuitOpen bool) {
+	result := "failure"
+	if healthy {
+		result = "success"
+	}
+	m.UpstreamProbesTotal.WithLabelValues(hostname, result).Inc()
+	m.UpstreamHealthy.WithLabelValues(hostname).Set(boolGauge(healthy))
+	m.UpstreamProbeDuration.WithLabelValues(hostname).Set(duration.Seconds())
+	m.UpstreamCircuitOpen.WithLabelValues(hostname).Set(boolGauge(circuitOpen))
+}
+
+// boolGauge converts a boolean to a gauge value
+func boolGauge(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+// RecordBytesServed records response body bytes served to clients
+func (m *Metrics) RecordBytesServed(resourceType string, n int64) {
+	if n > 0 {
+		m.BytesServedTotal.WithLabelValues(resourceType).Add(float64(n))
+	}
+}
+
+// RecordStorageOperation records a storage operation
+func (m *Metrics) RecordStorageOperation(operation, status string, duration float64) {
+	m.StorageOperationsTotal.WithLabelValues(operation, status).Inc()
+	m.StorageOperationDuration.WithLabelValues(operation).Observe(duration)
+}
+
+// SetStorageFreeBytes records the free space on the cache filesystem
+func (m *Metrics) SetStorageFreeBytes(bytes int64) {
+	m.StorageFreeBytes.Set(float64(bytes))
+}
+
+// SetPassthroughMode records whether the mirror is in passthrough mode
+func (m *Metrics) SetPassthroughMode(enabled bool) {
+	if enabled {
+		m.PassthroughMode.Set(1)
+	} else {
+		m.PassthroughMode.Set(0)
+	}
+}
+
+// SetCacheContents records the archives found in the cache
+func (m *Metrics) SetCacheContents(archives int, bytes int64) {
+	m.CacheArchives.Set(float64(archives))
+	m.CacheArchiveBytes.Set(float64(bytes))
+}
+
+// RecordCacheExpired records cache entries removed for not being read within the retention window
+func (m *Metrics) RecordCacheExpired(metadata, archives int, bytes int64) {
+	m.CacheExpiredEntriesTotal.WithLabelValues("metadata").Add(float64(metadata))
+	m.CacheExpiredEntriesTotal.WithLabelValues("archive").Add(float64(archives))
+	m.CacheExpiredBytesTotal.Add(float64(bytes))
+}
+
+// SetReplicationLag records how long the last replicated object waited
+func (m *Metrics) SetReplicationLag(d time.Duration) {
+	m.ReplicationLag.Set(d.Seconds())
+}
+
+// SetReplicationPending records the number of objects waiting to be replicated
+func (m *Metrics) SetReplicationPending(n int) {
+	m.ReplicationPending.Set(float64(n))
+}
+
+// RecordReplication records the outcome of replicating one object
+func (m *Metrics) RecordReplication(result string) {
+	m.ReplicationTotal.WithLabelValues(result).Inc()
+}
+
+// SetCacheWriteRetryPending records the number of failed cache writes waiting to be retried
+func (m *Metrics) SetCacheWriteRetryPending(n int) {
+	m.CacheWriteRetryPending.Set(float64(n))
+}
+
+// RecordCacheWriteRetry records the outcome of retrying one failed cache write
+func (m *Metrics) RecordCacheWriteRetry(result string) {
+	m.CacheWriteRetriesTotal.WithLabelValues(result).Inc()
+}
+
+// SetJobsQueueDepth records the number of background jobs waiting for a worker
+func (m *Metrics) SetJobsQueueDepth(n int) {
+	m.JobsQueueDepth.Set(float64(n))
+}
+
+// RecordJob records a finished background job
+func (m *Metrics) RecordJob(kind, status string) {
+	m.JobsTotal.WithLabelValues(kind, status).Inc()
+}
+
+// RecordError records an error
+func (m *Metrics) RecordError(component, errorType string) {
+	m.ErrorsTotal.WithLabelValues(component, errorType).Inc()
+}
+
+// Snapshot returns the current value of every Specular counter and gauge, keyed by series
+// Series are written as name{label="value",...}, histograms are left out
+// It works for Noop metrics too, which still record into their private registry
+func (m *Metrics) Snapshot() (map[string]float64, error) {
+	families, err := m.registry.Gather()
+	if err != nil {
+		return nil, err
+	}
+	snapshot := make(map[string]float64)
+	for _, family := range families {
+		if !strings.HasPrefix(family.GetName(), "specular_") {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			var value float64
+			switch {
+			case metric.GetCounter() != nil:
+				value = metric.GetCounter().GetValue()
+			case metric.GetGauge() != nil:
+				value = metric.GetGauge().GetValue()
+			default:
+				continue
+			}
+			series := family.GetName()
+			if labels := metric.GetLabel(); len(labels) > 0 {
+				pairs := make([]string, len(labels))
+				for i, label := range labels {
+					pairs[i] = fmt.Sprintf("%s=%q", label.GetName(), label.GetValue())
+				}
+				series += "{" + strings.Join(pairs, ",") + "}"
+			}
+			snapshot[series] = value
+		}
+	}
+	return snapshot, nil
+}
+
+// Noop returns a no-op metrics instance that does nothing
+// Use this when metrics are disabled to avoid nil pointer checks everywhere
+// Metrics are recorded into a private registry that is never exposed
+func Noop() *Metrics {
+	m := New(nil, Options{DisableGoCollector: true, DisableProcessCollector: true})
+	m.enabled = false
+	return m
+}
+
+// Handler returns an HTTP handler exposing the metrics registry
+func (m *Metrics) Handler() http.Handler {
+	return m.handler
+}
+
+// Enabled returns true if metrics collection is enabled
+func (m *Metrics) Enabled() bool {
+	return m.enabled
+}
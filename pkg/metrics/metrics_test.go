@@ -0,0 +1,157 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// familyNames returns the names of the metric families gathered from registry
+func familyNames(t *testing.T, registry *prometheus.Registry) []string {
+	t.Helper()
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather() returned error: %v", err)
+	}
+	names := make([]string, 0, len(families))
+	for _, family := range families {
+		names = append(names, family.GetName())
+	}
+	return names
+}
+
+func hasPrefix(names []string, prefix string) bool {
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestNewRegistersWithRegistry(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	m := New(registry, Options{})
+	m.RecordCacheHit("index")
+
+	names := familyNames(t, registry)
+	if !hasPrefix(names, "specular_cache_hits_total") {
+		t.Errorf("expected specular metrics in registry, got %v", names)
+	}
+	if !hasPrefix(names, "go_") || !hasPrefix(names, "process_") {
+		t.Errorf("expected default collectors in registry, got %v", names)
+	}
+
+	// Independent instances do not collide
+	New(nil, Options{})
+	New(nil, Options{})
+}
+
+func TestNewCollectorOptOuts(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	New(registry, Options{DisableGoCollector: true, DisableProcessCollector: true})
+
+	names := familyNames(t, registry)
+	if hasPrefix(names, "go_") || hasPrefix(names, "process_") {
+		t.Errorf("expected no default collectors, got %v", names)
+	}
+}
+
+func TestNoop(t *testing.T) {
+	m := Noop()
+	if m.Enabled() {
+		t.Fatal("expected noop metrics to be disabled")
+	}
+
+	// Recording must be safe on a disabled instance
+	m.RecordHTTPRequest("GET", "/health", 200, 0.1, 0, 10)
+	m.RecordCacheHit("index")
+	m.RecordCacheMiss("index")
+	m.RecordUpstreamRequest(200, 0.1, "index")
+	m.RecordUpstreamError("timeout")
+	m.RecordStorageOperation("get", "ok", 0.1)
+	m.RecordError("handler", "failed")
+	m.SetStorageFreeBytes(1)
+	m.SetPassthroughMode(true)
+	m.RecordCacheExpired(1, 1, 100)
+}
+
+func TestRecordBytes(t *testing.T) {
+	m := New(nil, Options{DisableGoCollector: true, DisableProcessCollector: true})
+	m.RecordBytesServed("archive", 100)
+	m.RecordBytesServed("archive", 50)
+	m.RecordBytesServed("index", 0)
+	m.RecordUpstreamBytes("archive", 100)
+
+	if got := testutil.ToFloat64(m.BytesServedTotal.WithLabelValues("archive")); got != 150 {
+		t.Errorf("expected 150 archive bytes served, got %v", got)
+	}
+	if got := testutil.CollectAndCount(&m.BytesServedTotal); got != 1 {
+		t.Errorf("expected zero-byte responses not to create series, got %d series", got)
+	}
+	if got := testutil.ToFloat64(m.UpstreamBytesTotal.WithLabelValues("archive")); got != 100 {
+		t.Errorf("expected 100 upstream archive bytes, got %v", got)
+	}
+}
+
+func TestRecordHTTPProviderRequest(t *testing.T) {
+	m := New(nil, Options{DisableGoCollector: true, DisableProcessCollector: true})
+	m.RecordHTTPProviderRequest("GET", "/terraform/providers/{hostname}/{namespace}/{type}/*", "registry.example.com", "internal", "netbox", 200)
+
+	if got := testutil.ToFloat64(m.HTTPProviderRequestsTotal.WithLabelValues("GET", "/terraform/providers/{hostname}/{namespace}/{type}/*", "registry.example.com", "internal", "netbox", "200")); got != 1 {
+		t.Errorf("expected 1 provider request, got %v", got)
+	}
+}
+
+func TestRecordJob(t *testing.T) {
+	m := New(nil, Options{DisableGoCollector: true, DisableProcessCollector: true})
+	m.SetJobsQueueDepth(3)
+	m.RecordJob("gc", "failed")
+	m.RecordJob("gc", "failed")
+
+	if got := testutil.ToFloat64(m.JobsQueueDepth); got != 3 {
+		t.Errorf("expected queue depth 3, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.JobsTotal.WithLabelValues("gc", "failed")); got != 2 {
+		t.Errorf("expected 2 failed gc jobs, got %v", got)
+	}
+}
+
+func TestSetCacheContents(t *testing.T) {
+	m := New(nil, Options{DisableGoCollector: true, DisableProcessCollector: true})
+	m.SetCacheContents(2, 1024)
+
+	if got := testutil.ToFloat64(m.CacheArchives); got != 2 {
+		t.Errorf("expected 2 archives, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.CacheArchiveBytes); got != 1024 {
+		t.Errorf("expected 1024 archive bytes, got %v", got)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	m := Noop()
+	m.RecordCacheHit("index")
+	m.RecordCacheHit("index")
+	m.AddHTTPRequestsInFlight(3)
+	m.AddHTTPRequestsInFlight(-1)
+	m.RecordHTTPRequest("GET", "/health", 200, 0.1, 0, 10)
+
+	snapshot, err := m.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot() returned error: %v", err)
+	}
+	if got := snapshot[`specular_cache_hits_total{cache_type="index"}`]; got != 2 {
+		t.Errorf("expected 2 index cache hits, got %v", got)
+	}
+	if got := snapshot["specular_http_requests_in_flight"]; got != 2 {
+		t.Errorf("expected 2 requests in flight, got %v", got)
+	}
+	for series := range snapshot {
+		if strings.HasPrefix(series, "specular_http_request_duration_seconds") {
+			t.Errorf("expected histograms to be left out, got %s", series)
+		}
+	}
+}
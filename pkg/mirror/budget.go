@@ -0,0 +1,105 @@
+package mirror
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// DownloadBudget bounds the archive downloads made for background work
+// Prefetch jobs then leave upstream bandwidth and connections to the downloads serving clients
+type DownloadBudget struct {
+	// slots holds one token per running download, nil when downloads are not limited
+	slots chan struct{}
+	// bytesPerSecond is shared by every background download, zero is unlimited
+	bytesPerSecond int64
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// NewDownloadBudget creates a budget of maxDownloads concurrent downloads sharing bytesPerSecond
+// Zero values are unlimited
+func NewDownloadBudget(maxDownloads int, bytesPerSecond int64) *DownloadBudget {
+	b := &DownloadBudget{bytesPerSecond: bytesPerSecond}
+	if maxDownloads > 0 {
+		b.slots = make(chan struct{}, maxDownloads)
+	}
+	return b
+}
+
+// SetBackgroundBudget bounds the archive downloads made by Prefetch and cache write retries
+// Downloads serving clients are never limited. Must be called before the client is used
+func (uc *UpstreamClient) SetBackgroundBudget(b *DownloadBudget) {
+	uc.budget = b
+}
+
+// acquire blocks until a download slot is free or ctx is done
+func (b *DownloadBudget) acquire(ctx context.Context) error {
+	if b.slots == nil {
+		return nil
+	}
+	select {
+	case b.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release frees a slot taken by acquire
+func (b *DownloadBudget) release() {
+	if b.slots != nil {
+		<-b.slots
+	}
+}
+
+// throttle waits long enough for n more bytes to stay within the bandwidth budget
+func (b *DownloadBudget) throttle(ctx context.Context, n int) error {
+	if b.bytesPerSecond <= 0 || n <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	now := time.Now()
+	if b.next.Before(now) {
+		b.next = now
+	}
+	wait := b.next.Sub(now)
+	b.next = b.next.Add(time.Duration(int64(n) * int64(time.Second) / b.bytesPerSecond))
+	b.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// budgetReader holds a download slot until closed and paces reads to the bandwidth budget
+type budgetReader struct {
+	io.ReadCloser
+	ctx    context.Context
+	budget *DownloadBudget
+	once   sync.Once
+}
+
+func (r *budgetReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if werr := r.budget.throttle(r.ctx, n); werr != nil && err == nil {
+		err = werr
+	}
+	return n, err
+}
+
+func (r *budgetReader) Close() error {
+	r.once.Do(r.budget.release)
+	return r.ReadCloser.Close()
+}
@@ -0,0 +1,80 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/elisiariocouto/specular/pkg/registrytest"
+)
+
+func TestDownloadBudget_Concurrency(t *testing.T) {
+	mirror, registry := newRegistryTestMirror(t, NewMockStorage())
+	registry.AddPackage("hashicorp", "aws", "1.0.0", "linux", "amd64", []byte("archive"))
+	mirror.upstream.SetBackgroundBudget(NewDownloadBudget(1, 0))
+	archiveURL := registry.URL + registrytest.ArchivePath("hashicorp", "aws", "1.0.0", "linux", "amd64")
+	background := withBackground(context.Background())
+
+	first, err := mirror.upstream.FetchArchive(background, archiveURL)
+	if err != nil {
+		t.Fatalf("FetchArchive failed: %v", err)
+	}
+
+	// Client downloads never wait for the budget
+	interactive, err := mirror.upstream.FetchArchive(context.Background(), archiveURL)
+	if err != nil {
+		t.Fatalf("FetchArchive failed: %v", err)
+	}
+	interactive.Close()
+
+	// The only slot is taken until the first background download is closed
+	ctx, cancel := context.WithTimeout(background, 50*time.Millisecond)
+	defer cancel()
+	if _, err := mirror.upstream.FetchArchive(ctx, archiveURL); err == nil {
+		t.Fatal("expected the second background download to wait for a slot")
+	}
+
+	first.Close()
+	first.Close()
+	second, err := mirror.upstream.FetchArchive(background, archiveURL)
+	if err != nil {
+		t.Fatalf("FetchArchive failed after the slot was released: %v", err)
+	}
+	second.Close()
+}
+
+func TestDownloadBudget_Bandwidth(t *testing.T) {
+	mirror, registry := newRegistryTestMirror(t, NewMockStorage())
+	archive := bytes.Repeat([]byte("x"), 64<<10)
+	registry.AddPackage("hashicorp", "aws", "1.0.0", "linux", "amd64", archive)
+	// 64KiB at 512KiB/s takes 125ms, minus the first read which is let through right away
+	mirror.upstream.SetBackgroundBudget(NewDownloadBudget(0, 512<<10))
+	archiveURL := registry.URL + registrytest.ArchivePath("hashicorp", "aws", "1.0.0", "linux", "amd64")
+
+	start := time.Now()
+	reader, err := mirror.upstream.FetchArchive(withBackground(context.Background()), archiveURL)
+	if err != nil {
+		t.Fatalf("FetchArchive failed: %v", err)
+	}
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil || !bytes.Equal(data, archive) {
+		t.Fatalf("unexpected archive: %d bytes, err %v", len(data), err)
+	}
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("64KiB at 512KiB/s took %s, want at least 60ms", elapsed)
+	}
+
+	start = time.Now()
+	reader, err = mirror.upstream.FetchArchive(context.Background(), archiveURL)
+	if err != nil {
+		t.Fatalf("FetchArchive failed: %v", err)
+	}
+	io.ReadAll(reader)
+	reader.Close()
+	if elapsed := time.Since(start); elapsed >= 100*time.Millisecond {
+		t.Errorf("client download took %s, expected no throttling", elapsed)
+	}
+}
@@ -0,0 +1,146 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+// CachePolicy controls how responses fetched from upstream are written to the cache
+type CachePolicy string
+
+const (
+	// CacheWriteThrough stores a response before returning it, the default
+	CacheWriteThrough CachePolicy = "write-through"
+	// CacheWriteBack returns a response right away and stores it in the background
+	// Archives are streamed to the client while they are written, a client that disconnects early leaves them uncached
+	CacheWriteBack CachePolicy = "write-back"
+	// CacheNoStore never stores the response, every request is fetched from upstream
+	CacheNoStore CachePolicy = "no-store"
+)
+
+// ParseCachePolicy parses a cache policy name
+func ParseCachePolicy(name string) (CachePolicy, error) {
+	switch policy := CachePolicy(name); policy {
+	case CacheWriteThrough, CacheWriteBack, CacheNoStore:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown cache policy %q, must be write-through, write-back or no-store", name)
+	}
+}
+
+// CachePolicies holds the cache policy of each resource type
+// Empty fields mean write-through
+type CachePolicies struct {
+	// Index applies to index.json and the registry versions response it is built from
+	Index CachePolicy
+	// Version applies to version.json
+	Version CachePolicy
+	// Archive applies to provider archives
+	Archive CachePolicy
+}
+
+// errArchiveIncomplete aborts a write-back archive write when the client stops reading early
+var errArchiveIncomplete = errors.New("archive download incomplete")
+
+// SetCachePolicies sets how each resource type is written to the cache
+// Must be called before the mirror is used
+func (m *Mirror) SetCachePolicies(policies CachePolicies) {
+	m.policies = policies
+}
+
+// Flush waits for background cache writes to finish or the context to be done
+func (m *Mirror) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		m.pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// store runs put against the cache according to policy
+// Write-back puts run in the background, detached from the request context. Failed puts are queued for retry
+func (m *Mirror) store(ctx context.Context, policy CachePolicy, put func(ctx context.Context, s storage.Storage) error, logMsg string, logArgs ...any) {
+	run := func(ctx context.Context) {
+		if err := put(ctx, m.storage); err != nil {
+			slog.WarnContext(ctx, logMsg, append(logArgs, "err", err)...)
+			m.retryWrite(err, put, logArgs...)
+		}
+	}
+
+	switch policy {
+	case CacheNoStore:
+		return
+	case CacheWriteBack:
+		m.pending.Add(1)
+		go func() {
+			defer m.pending.Done()
+			run(context.WithoutCancel(ctx))
+		}()
+	default:
+		run(ctx)
+	}
+}
+
+// writeBackArchive returns a reader serving src that also writes what it reads into the cache
+// The archive is only stored once src has been read to the end, onError is called when storing it fails
+// A stored archive is recorded and verified against registryShasum like a write-through one
+func (m *Mirror) writeBackArchive(ctx context.Context, archivePath string, src io.ReadCloser, registryShasum string, onError func(error)) io.ReadCloser {
+	pr, pw := io.Pipe()
+	m.pending.Add(1)
+	go func() {
+		defer m.pending.Done()
+		err := m.storage.PutArchive(context.WithoutCancel(ctx), archivePath, pr)
+		// Unblock the client reader if storage gave up before reading everything
+		pr.CloseWithError(err)
+		if err != nil {
+			slog.WarnContext(ctx, "failed to cache archive", "path", archivePath, "err", err)
+			onError(err)
+			return
+		}
+		if err := m.commitArchive(context.WithoutCancel(ctx), archivePath, src, registryShasum); err != nil {
+			slog.WarnContext(ctx, "failed to cache archive", "path", archivePath, "err", err)
+		}
+	}()
+	return &writeBackReader{src: src, pw: pw}
+}
+
+// writeBackReader copies what is read from src into pw, and keeps serving src if pw fails
+type writeBackReader struct {
+	src    io.ReadCloser
+	pw     *io.PipeWriter
+	failed bool
+}
+
+func (r *writeBackReader) Read(p []byte) (int, error) {
+	n, err := r.src.Read(p)
+	if n > 0 && !r.failed {
+		if _, werr := r.pw.Write(p[:n]); werr != nil {
+			r.failed = true
+		}
+	}
+	switch {
+	case err == io.EOF:
+		r.pw.Close()
+	case err != nil:
+		r.pw.CloseWithError(err)
+	}
+	return n, err
+}
+
+func (r *writeBackReader) Close() error {
+	// No effect when the pipe was already closed at the end of the archive
+	r.pw.CloseWithError(errArchiveIncomplete)
+	return r.src.Close()
+}
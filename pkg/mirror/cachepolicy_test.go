@@ -0,0 +1,214 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elisiariocouto/specular/pkg/registrytest"
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+func TestParseCachePolicy(t *testing.T) {
+	for _, name := range []string{"write-through", "write-back", "no-store"} {
+		policy, err := ParseCachePolicy(name)
+		if err != nil || string(policy) != name {
+			t.Errorf("ParseCachePolicy(%q) = %q, %v", name, policy, err)
+		}
+	}
+	if _, err := ParseCachePolicy("write-around"); err == nil {
+		t.Error("expected error for unknown policy")
+	}
+}
+
+// newCachePolicyTestMirror returns a mirror over memory storage with the given policies and one published package
+func newCachePolicyTestMirror(t *testing.T, policies CachePolicies) (*Mirror, storage.Storage, *registrytest.Server, []byte) {
+	t.Helper()
+
+	store := storage.NewMemoryStorage()
+	mirror, registry := newRegistryTestMirror(t, store)
+	mirror.SetCachePolicies(policies)
+
+	archive := registrytest.Archive(map[string]string{"terraform-provider-aws_v1.0.0": string(bytes.Repeat([]byte("x"), 64<<10))})
+	registry.AddPackage("hashicorp", "aws", "1.0.0", "linux", "amd64", archive)
+	return mirror, store, registry, archive
+}
+
+func flush(t *testing.T, mirror *Mirror) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := mirror.Flush(ctx); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+}
+
+func TestCachePolicy_MetadataNoStore(t *testing.T) {
+	mirror, store, registry, _ := newCachePolicyTestMirror(t, CachePolicies{Index: CacheNoStore, Version: CacheNoStore})
+	hostname := registry.Hostname()
+
+	for range 2 {
+		if _, err := mirror.GetIndex(context.Background(), hostname, "hashicorp", "aws"); err != nil {
+			t.Fatalf("GetIndex failed: %v", err)
+		}
+	}
+	if n := registry.Requests(registrytest.VersionsPath("hashicorp", "aws")); n != 2 {
+		t.Errorf("versions endpoint called %d times, want 2", n)
+	}
+
+	// Versions are built from the fetched response when nothing is cached
+	if _, err := mirror.GetVersion(context.Background(), hostname, "hashicorp", "aws", "1.0.0"); err != nil {
+		t.Fatalf("GetVersion failed: %v", err)
+	}
+
+	if _, err := store.GetIndex(context.Background(), hostname, "hashicorp", "aws"); !storage.IsNotFound(err) {
+		t.Errorf("expected index not to be cached, got %v", err)
+	}
+	if _, err := store.GetVersionsResponse(context.Background(), hostname, "hashicorp", "aws"); !storage.IsNotFound(err) {
+		t.Errorf("expected versions response not to be cached, got %v", err)
+	}
+	if _, err := store.GetVersion(context.Background(), hostname, "hashicorp", "aws", "1.0.0"); !storage.IsNotFound(err) {
+		t.Errorf("expected version not to be cached, got %v", err)
+	}
+}
+
+func TestCachePolicy_MetadataWriteBack(t *testing.T) {
+	mirror, store, registry, _ := newCachePolicyTestMirror(t, CachePolicies{Index: CacheWriteBack, Version: CacheWriteBack})
+	hostname := registry.Hostname()
+
+	version, err := mirror.GetVersion(context.Background(), hostname, "hashicorp", "aws", "1.0.0")
+	if err != nil {
+		t.Fatalf("GetVersion failed: %v", err)
+	}
+	flush(t, mirror)
+
+	if _, err := store.GetIndex(context.Background(), hostname, "hashicorp", "aws"); err != nil {
+		t.Errorf("expected index to be cached: %v", err)
+	}
+	if cached, err := store.GetVersion(context.Background(), hostname, "hashicorp", "aws", "1.0.0"); err != nil || !bytes.Equal(cached, version) {
+		t.Errorf("cached version = %q, %v, want %q", cached, err, version)
+	}
+}
+
+func TestCachePolicy_ArchiveNoStore(t *testing.T) {
+	mirror, store, registry, archive := newCachePolicyTestMirror(t, CachePolicies{Archive: CacheNoStore})
+	hostname := registry.Hostname()
+	archivePath := hostname + "/hashicorp/aws/terraform-provider-aws_1.0.0_linux_amd64.zip"
+
+	reader, err := mirror.GetArchive(context.Background(), hostname, "hashicorp", "aws", "1.0.0", "linux", "amd64", archivePath)
+	if err != nil {
+		t.Fatalf("GetArchive failed: %v", err)
+	}
+	content, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil || !bytes.Equal(content, archive) {
+		t.Fatalf("GetArchive returned %d bytes, %v", len(content), err)
+	}
+
+	if exists, _ := store.ExistsArchive(context.Background(), archivePath); exists {
+		t.Error("expected archive not to be cached")
+	}
+}
+
+func TestCachePolicy_ArchiveWriteBack(t *testing.T) {
+	mirror, store, registry, archive := newCachePolicyTestMirror(t, CachePolicies{Archive: CacheWriteBack})
+	hostname := registry.Hostname()
+	archivePath := hostname + "/hashicorp/aws/terraform-provider-aws_1.0.0_linux_amd64.zip"
+
+	// A client that disconnects early leaves the archive uncached
+	reader, err := mirror.GetArchive(context.Background(), hostname, "hashicorp", "aws", "1.0.0", "linux", "amd64", archivePath)
+	if err != nil {
+		t.Fatalf("GetArchive failed: %v", err)
+	}
+	if _, err := reader.Read(make([]byte, 16)); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	reader.Close()
+	flush(t, mirror)
+	if exists, _ := store.ExistsArchive(context.Background(), archivePath); exists {
+		t.Fatal("expected partially read archive not to be cached")
+	}
+
+	reader, err = mirror.GetArchive(context.Background(), hostname, "hashicorp", "aws", "1.0.0", "linux", "amd64", archivePath)
+	if err != nil {
+		t.Fatalf("GetArchive failed: %v", err)
+	}
+	content, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil || !bytes.Equal(content, archive) {
+		t.Fatalf("GetArchive returned %d bytes, %v", len(content), err)
+	}
+	flush(t, mirror)
+
+	cached, err := store.GetArchive(context.Background(), archivePath)
+	if err != nil {
+		t.Fatalf("expected archive to be cached: %v", err)
+	}
+	defer cached.Close()
+	if data, _ := io.ReadAll(cached); !bytes.Equal(data, archive) {
+		t.Errorf("cached archive has %d bytes, want %d", len(data), len(archive))
+	}
+	if info, err := store.(storage.EntryInfoStore).EntryInfo(context.Background(), archivePath); err != nil || info.RegistryShasum == "" {
+		t.Errorf("expected the archive to be recorded with its registry shasum, got %+v (%v)", info, err)
+	}
+}
+
+// corruptingStorage stores archives with a byte appended
+type corruptingStorage struct {
+	storage.Storage
+}
+
+func (c corruptingStorage) PutArchive(ctx context.Context, path string, r io.Reader) error {
+	return c.Storage.PutArchive(ctx, path, io.MultiReader(r, strings.NewReader("x")))
+}
+
+func TestCachePolicy_ArchiveWriteBack_VerifyShasums(t *testing.T) {
+	store := corruptingStorage{Storage: storage.NewMemoryStorage()}
+	mirror, registry := newRegistryTestMirror(t, store)
+	mirror.SetCachePolicies(CachePolicies{Archive: CacheWriteBack})
+	mirror.SetVerifyShasums(true)
+	archive := registrytest.Archive(map[string]string{"terraform-provider-aws_v1.0.0": "provider binary"})
+	registry.AddPackage("hashicorp", "aws", "1.0.0", "linux", "amd64", archive)
+	hostname := registry.Hostname()
+	archivePath := hostname + "/hashicorp/aws/terraform-provider-aws_1.0.0_linux_amd64.zip"
+
+	// The client already got the archive, but a cached copy not matching the registry shasum is not kept
+	reader, err := mirror.GetArchive(context.Background(), hostname, "hashicorp", "aws", "1.0.0", "linux", "amd64", archivePath)
+	if err != nil {
+		t.Fatalf("GetArchive failed: %v", err)
+	}
+	content, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil || !bytes.Equal(content, archive) {
+		t.Fatalf("GetArchive returned %d bytes, %v", len(content), err)
+	}
+	flush(t, mirror)
+	if exists, _ := store.ExistsArchive(context.Background(), archivePath); exists {
+		t.Error("expected an archive not matching the registry shasum to be evicted")
+	}
+}
+
+func TestCachePolicy_ArchiveWriteBack_StorageFailure(t *testing.T) {
+	mockStorage := NewMockStorage()
+	mockStorage.putArchiveErr = storage.ErrQuotaExceeded
+	mirror, registry := newRegistryTestMirror(t, mockStorage)
+	mirror.SetCachePolicies(CachePolicies{Archive: CacheWriteBack})
+	archive := registrytest.Archive(map[string]string{"terraform-provider-aws_v1.0.0": "provider binary"})
+	registry.AddPackage("hashicorp", "aws", "1.0.0", "linux", "amd64", archive)
+	hostname := registry.Hostname()
+
+	// The client is still served when the cache write fails
+	reader, err := mirror.GetArchive(context.Background(), hostname, "hashicorp", "aws", "1.0.0", "linux", "amd64", hostname+"/hashicorp/aws/archive.zip")
+	if err != nil {
+		t.Fatalf("GetArchive failed: %v", err)
+	}
+	content, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil || !bytes.Equal(content, archive) {
+		t.Fatalf("GetArchive returned %d bytes, %v", len(content), err)
+	}
+	flush(t, mirror)
+}
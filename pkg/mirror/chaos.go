@@ -0,0 +1,111 @@
+package mirror
+
+import (
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// chaosTruncateBytes is how much of a body of unknown length is returned before truncating it
+const chaosTruncateBytes = 512
+
+// ChaosConfig describes faults injected into upstream responses
+// Rates are probabilities between 0 and 1 applied to every upstream request
+type ChaosConfig struct {
+	// Latency is added before every upstream request
+	Latency time.Duration
+	// ErrorRate is the share of requests answered with 503 Service Unavailable instead of reaching upstream
+	ErrorRate float64
+	// TruncateRate is the share of responses whose body ends early with io.ErrUnexpectedEOF
+	TruncateRate float64
+}
+
+// EnableChaos injects the faults described by cfg into every upstream request, including service discovery
+// It is meant for testing clients and alerting against a misbehaving mirror, never for production traffic
+// Must be called before the client is used, after SetHTTPClient
+func (uc *UpstreamClient) EnableChaos(cfg ChaosConfig) {
+	client := *uc.httpClient
+	client.Transport = &chaosTransport{
+		next:   client.Transport,
+		cfg:    cfg,
+		random: rand.Float64,
+		logger: uc.logger,
+	}
+	uc.SetHTTPClient(&client)
+}
+
+// chaosTransport wraps an http.RoundTripper and injects latency, errors and truncated bodies
+type chaosTransport struct {
+	next   http.RoundTripper
+	cfg    ChaosConfig
+	random func() float64
+	logger *slog.Logger
+}
+
+func (ct *chaosTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if ct.cfg.Latency > 0 {
+		timer := time.NewTimer(ct.cfg.Latency)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+
+	if ct.random() < ct.cfg.ErrorRate {
+		ct.logger.DebugContext(req.Context(), "chaos: injecting upstream error", slog.String("url", req.URL.String()))
+		body := "chaos: injected upstream error\n"
+		return &http.Response{
+			Status:        "503 Service Unavailable",
+			StatusCode:    http.StatusServiceUnavailable,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+			Body:          io.NopCloser(strings.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+
+	next := ct.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if ct.random() < ct.cfg.TruncateRate {
+		ct.logger.DebugContext(req.Context(), "chaos: truncating upstream response", slog.String("url", req.URL.String()))
+		remaining := int64(chaosTruncateBytes)
+		if resp.ContentLength > 0 {
+			remaining = resp.ContentLength / 2
+		}
+		resp.Body = &truncatedBody{ReadCloser: resp.Body, remaining: remaining}
+	}
+	return resp, nil
+}
+
+// truncatedBody returns io.ErrUnexpectedEOF once remaining bytes have been read
+type truncatedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (tb *truncatedBody) Read(p []byte) (int, error) {
+	if tb.remaining <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if int64(len(p)) > tb.remaining {
+		p = p[:tb.remaining]
+	}
+	n, err := tb.ReadCloser.Read(p)
+	tb.remaining -= int64(n)
+	return n, err
+}
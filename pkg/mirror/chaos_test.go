@@ -0,0 +1,94 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/elisiariocouto/specular/pkg/registrytest"
+)
+
+// newChaosTestMirror returns a mirror whose upstream client injects the faults in cfg without retrying
+func newChaosTestMirror(t *testing.T, cfg ChaosConfig) (*Mirror, *registrytest.Server) {
+	t.Helper()
+
+	registry := registrytest.NewServer()
+	t.Cleanup(registry.Close)
+	registry.AddPackage("hashicorp", "aws", "1.0.0", "linux", "amd64", registrytest.Archive(map[string]string{
+		"terraform-provider-aws_v1.0.0": "provider binary",
+	}))
+
+	upstream := NewUpstreamClient(10*time.Second, 0, time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	upstream.SetHTTPClient(registry.Client())
+	upstream.EnableChaos(cfg)
+	return NewMirror(NewMockStorage(), upstream, "http://localhost:8080"), registry
+}
+
+func TestChaos_Latency(t *testing.T) {
+	mirror, registry := newChaosTestMirror(t, ChaosConfig{Latency: 50 * time.Millisecond})
+
+	start := time.Now()
+	if _, err := mirror.GetIndex(context.Background(), registry.Hostname(), "hashicorp", "aws"); err != nil {
+		t.Fatalf("GetIndex failed: %v", err)
+	}
+	// Service discovery and the versions API each wait
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("GetIndex took %v, want at least 100ms", elapsed)
+	}
+}
+
+func TestChaos_Latency_ContextCancelled(t *testing.T) {
+	mirror, registry := newChaosTestMirror(t, ChaosConfig{Latency: time.Minute})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := mirror.GetIndex(ctx, registry.Hostname(), "hashicorp", "aws"); err == nil {
+		t.Fatal("expected error when the context is cancelled during injected latency")
+	}
+}
+
+func TestChaos_Errors(t *testing.T) {
+	mirror, registry := newChaosTestMirror(t, ChaosConfig{ErrorRate: 1})
+
+	_, err := mirror.GetIndex(context.Background(), registry.Hostname(), "hashicorp", "aws")
+	if !errors.Is(err, ErrUpstreamUnavailable) {
+		t.Fatalf("expected ErrUpstreamUnavailable, got %v", err)
+	}
+	if n := registry.Requests(registrytest.VersionsPath("hashicorp", "aws")); n != 0 {
+		t.Errorf("upstream received %d requests, want 0", n)
+	}
+}
+
+func TestChaos_Truncate(t *testing.T) {
+	mirror, registry := newChaosTestMirror(t, ChaosConfig{})
+	hostname := registry.Hostname()
+
+	// Enable truncation once the download URL is known so only the archive body is cut short
+	ct := mirror.upstream.httpClient.Transport.(*chaosTransport)
+	downloadInfo, err := mirror.upstream.FetchDownloadURL(context.Background(), hostname, "hashicorp", "aws", "1.0.0", "linux", "amd64")
+	if err != nil {
+		t.Fatalf("FetchDownloadURL failed: %v", err)
+	}
+	ct.cfg.TruncateRate = 1
+
+	body, err := mirror.upstream.FetchArchive(context.Background(), downloadInfo.DownloadURL)
+	if err != nil {
+		t.Fatalf("FetchArchive failed: %v", err)
+	}
+	defer body.Close()
+
+	if _, err := io.ReadAll(body); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected io.ErrUnexpectedEOF reading a truncated archive, got %v", err)
+	}
+}
+
+func TestChaos_Disabled(t *testing.T) {
+	mirror, registry := newChaosTestMirror(t, ChaosConfig{})
+
+	if _, err := mirror.GetVersion(context.Background(), registry.Hostname(), "hashicorp", "aws", "1.0.0"); err != nil {
+		t.Fatalf("GetVersion failed with no faults configured: %v", err)
+	}
+}
@@ -0,0 +1,347 @@
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+// ServiceDiscovery represents the response from .well-known/terraform.json
+type ServiceDiscovery struct {
+	Hostname    string `json:"-"`
+	ProvidersV1 string `json:"providers.v1"`
+	// Services holds every key of the response, including services other than providers.v1 such as modules.v1 and login.v1
+	Services map[string]json.RawMessage `json:"-"`
+	CachedAt time.Time                  `json:"-"`
+}
+
+// UnmarshalJSON decodes a service discovery response, keeping the services Specular does not use
+func (sd *ServiceDiscovery) UnmarshalJSON(data []byte) error {
+	var services map[string]json.RawMessage
+	if err := json.Unmarshal(data, &services); err != nil {
+		return err
+	}
+	if raw, ok := services["providers.v1"]; ok {
+		if err := json.Unmarshal(raw, &sd.ProvidersV1); err != nil {
+			return fmt.Errorf("invalid providers.v1: %w", err)
+		}
+	}
+	sd.Services = services
+	return nil
+}
+
+// loginURLFields are the login.v1 properties holding URLs
+var loginURLFields = []string{"authz", "token"}
+
+// ResolvedServices returns the services of the response with relative URLs resolved against the registry,
+// so the document can be served from another host. Values that are not URLs are returned unchanged
+func (sd ServiceDiscovery) ResolvedServices() map[string]json.RawMessage {
+	base := &url.URL{Scheme: "https", Host: sd.Hostname, Path: "/.well-known/terraform.json"}
+	resolve := func(raw json.RawMessage) json.RawMessage {
+		var ref string
+		if json.Unmarshal(raw, &ref) != nil {
+			return raw
+		}
+		u, err := url.Parse(ref)
+		if err != nil {
+			return raw
+		}
+		resolved, _ := json.Marshal(base.ResolveReference(u).String())
+		return resolved
+	}
+
+	services := make(map[string]json.RawMessage, len(sd.Services))
+	for name, raw := range sd.Services {
+		var fields map[string]json.RawMessage
+		switch {
+		case json.Unmarshal(raw, &fields) == nil && name == "login.v1":
+			for _, field := range loginURLFields {
+				if value, ok := fields[field]; ok {
+					fields[field] = resolve(value)
+				}
+			}
+			services[name], _ = json.Marshal(fields)
+		case fields != nil:
+			services[name] = raw
+		default:
+			services[name] = resolve(raw)
+		}
+	}
+	return services
+}
+
+// DiscoveryCache caches service discovery responses with TTL
+type DiscoveryCache struct {
+	mu       sync.RWMutex
+	cache    map[string]*ServiceDiscovery
+	inFlight map[string]bool // Track hostnames currently being fetched
+	cond     *sync.Cond      // Signal when a fetch completes
+	ttl      time.Duration
+	client   *http.Client
+	logger   *slog.Logger
+}
+
+// NewDiscoveryCache creates a new discovery cache
+func NewDiscoveryCache(ttl time.Duration, client *http.Client, logger *slog.Logger) *DiscoveryCache {
+	dc := &DiscoveryCache{
+		cache:    make(map[string]*ServiceDiscovery),
+		inFlight: make(map[string]bool),
+		ttl:      ttl,
+		client:   client,
+		logger:   logger,
+	}
+	dc.cond = sync.NewCond(&dc.mu)
+	return dc
+}
+
+// isValidProvidersURL validates that the ProvidersV1 URL is well-formed
+func isValidProvidersURL(urlStr string) bool {
+	if urlStr == "" {
+		return false
+	}
+	// Check for control characters or unencoded spaces
+	for _, ch := range urlStr {
+		if ch < 32 || ch == 127 {
+			return false
+		}
+		if ch == ' ' {
+			return false
+		}
+	}
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return false
+	}
+	// URL must be either a valid absolute URL with a scheme or a valid path
+	if u.Scheme != "" {
+		// Absolute URL: must have a host
+		if u.Host == "" {
+			return false
+		}
+		// Only allow http or https schemes
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return false
+		}
+	}
+	return true
+}
+
+// DiscoverServices discovers the service endpoints for a Terraform registry
+// It fetches https://{hostname}/.well-known/terraform.json and caches the result.
+// Multiple concurrent requests for the same hostname will coalesce to a single upstream fetch.
+func (dc *DiscoveryCache) DiscoverServices(ctx context.Context, hostname string) (*ServiceDiscovery, error) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	// Check cache first
+	if cached, ok := dc.cache[hostname]; ok {
+		// Check if cache is still valid
+		if time.Since(cached.CachedAt) < dc.ttl {
+			dc.logger.DebugContext(ctx, "using cached service discovery",
+				slog.String("hostname", hostname),
+				slog.String("providers_v1", cached.ProvidersV1))
+			return cached, nil
+		}
+	}
+
+	// Wait for any in-flight request for this hostname to complete
+	for dc.inFlight[hostname] {
+		dc.cond.Wait()
+		// After waiting, check cache again in case the in-flight request succeeded
+		if cached, ok := dc.cache[hostname]; ok {
+			if time.Since(cached.CachedAt) < dc.ttl {
+				dc.logger.DebugContext(ctx, "using service discovery from coalesced request",
+					slog.String("hostname", hostname),
+					slog.String("providers_v1", cached.ProvidersV1))
+				return cached, nil
+			}
+		}
+	}
+
+	// Mark this hostname as in-flight
+	dc.inFlight[hostname] = true
+	dc.mu.Unlock()
+
+	// Fetch from upstream (outside the lock)
+	discovery, err := dc.fetchFromUpstream(ctx, hostname)
+
+	// Update cache and signal waiters
+	dc.mu.Lock()
+	delete(dc.inFlight, hostname)
+
+	if err != nil {
+		dc.cond.Broadcast()
+		return nil, err
+	}
+
+	// Validate ProvidersV1 URL before caching
+	if !isValidProvidersURL(discovery.ProvidersV1) {
+		dc.cond.Broadcast()
+		return nil, fmt.Errorf("invalid providers.v1 URL in service discovery: %q", discovery.ProvidersV1)
+	}
+
+	dc.cache[hostname] = discovery
+	dc.cond.Broadcast()
+	return discovery, nil
+}
+
+// fetchFromUpstream fetches service discovery from the .well-known endpoint
+func (dc *DiscoveryCache) fetchFromUpstream(ctx context.Context, hostname string) (*ServiceDiscovery, error) {
+	dc.logger.DebugContext(ctx, "discovering services from .well-known",
+		slog.String("hostname", hostname))
+
+	wellKnownURL := fmt.Sprintf("https://%s/.well-known/terraform.json", hostname)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnownURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create discovery request: %w", err)
+	}
+
+	injectTraceContext(req)
+	resp, err := dc.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch service discovery: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("service discovery returned status %d", resp.StatusCode)
+	}
+
+	var discovery ServiceDiscovery
+	if err := json.NewDecoder(resp.Body).Decode(&discovery); err != nil {
+		return nil, fmt.Errorf("failed to parse service discovery response: %w", err)
+	}
+
+	// Set metadata
+	discovery.Hostname = hostname
+	discovery.CachedAt = time.Now()
+
+	dc.logger.DebugContext(ctx, "discovered service endpoints",
+		slog.String("hostname", hostname),
+		slog.String("providers_v1", discovery.ProvidersV1))
+
+	return &discovery, nil
+}
+
+// Clear removes all cached discovery information
+func (dc *DiscoveryCache) Clear() {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	dc.cache = make(map[string]*ServiceDiscovery)
+}
+
+// ClearHost removes cached discovery information for a specific hostname
+func (dc *DiscoveryCache) ClearHost(hostname string) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	delete(dc.cache, hostname)
+}
+
+// Entries returns a copy of the cached discovery responses, sorted by hostname
+// Expired entries are included until they are refreshed
+func (dc *DiscoveryCache) Entries() []ServiceDiscovery {
+	dc.mu.RLock()
+	defer dc.mu.RUnlock()
+	entries := make([]ServiceDiscovery, 0, len(dc.cache))
+	for _, discovery := range dc.cache {
+		entries = append(entries, *discovery)
+	}
+	slices.SortFunc(entries, func(a, b ServiceDiscovery) int {
+		return strings.Compare(a.Hostname, b.Hostname)
+	})
+	return entries
+}
+
+// Expired reports whether the discovery response is older than ttl
+func (sd ServiceDiscovery) Expired(ttl time.Duration) bool {
+	return time.Since(sd.CachedAt) >= ttl
+}
+
+// savedDiscovery is a cached service discovery response as serialized by Save
+type savedDiscovery struct {
+	Hostname string                     `json:"hostname"`
+	Services map[string]json.RawMessage `json:"services"`
+	CachedAt time.Time                  `json:"cached_at"`
+}
+
+// Save serializes the cached responses that have not expired, for Load to restore after a restart
+func (dc *DiscoveryCache) Save() ([]byte, error) {
+	saved := []savedDiscovery{}
+	for _, entry := range dc.Entries() {
+		if !entry.Expired(dc.ttl) {
+			saved = append(saved, savedDiscovery{Hostname: entry.Hostname, Services: entry.Services, CachedAt: entry.CachedAt})
+		}
+	}
+	return json.Marshal(saved)
+}
+
+// Load restores responses serialized by Save, keeping their age so they expire when they would have
+// Expired and invalid responses are skipped, and so are hosts discovered again since they were saved.
+// It returns the number of hosts restored
+func (dc *DiscoveryCache) Load(data []byte) (int, error) {
+	var saved []savedDiscovery
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return 0, fmt.Errorf("invalid saved discovery cache: %w", err)
+	}
+
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	restored := 0
+	for _, entry := range saved {
+		discovery := &ServiceDiscovery{Hostname: entry.Hostname, Services: entry.Services, CachedAt: entry.CachedAt}
+		if raw, ok := entry.Services["providers.v1"]; ok {
+			json.Unmarshal(raw, &discovery.ProvidersV1)
+		}
+		if entry.Hostname == "" || discovery.Expired(dc.ttl) || !isValidProvidersURL(discovery.ProvidersV1) {
+			continue
+		}
+		if cached, ok := dc.cache[entry.Hostname]; ok && !cached.CachedAt.Before(entry.CachedAt) {
+			continue
+		}
+		dc.cache[entry.Hostname] = discovery
+		restored++
+	}
+	return restored, nil
+}
+
+// discoveryState names the service discovery cache among the state documents of the storage
+const discoveryState = "discovery"
+
+// SaveDiscoveryCache stores the service discovery cache in the storage, for LoadDiscoveryCache after a restart
+// Returns storage.ErrNotFound if the storage cannot keep state
+func (m *Mirror) SaveDiscoveryCache(ctx context.Context) error {
+	store, ok := storage.As[storage.StateStore](m.storage)
+	if !ok {
+		return storage.ErrNotFound
+	}
+	data, err := m.upstream.DiscoveryCache().Save()
+	if err != nil {
+		return err
+	}
+	return store.PutState(ctx, discoveryState, data)
+}
+
+// LoadDiscoveryCache restores the service discovery cache saved by SaveDiscoveryCache, so the first requests
+// after a restart do not each wait on a discovery request. It returns the number of hosts restored
+// Returns storage.ErrNotFound if the storage cannot keep state or holds no saved cache
+func (m *Mirror) LoadDiscoveryCache(ctx context.Context) (int, error) {
+	store, ok := storage.As[storage.StateStore](m.storage)
+	if !ok {
+		return 0, storage.ErrNotFound
+	}
+	data, err := store.GetState(ctx, discoveryState)
+	if err != nil {
+		return 0, err
+	}
+	return m.upstream.DiscoveryCache().Load(data)
+}
@@ -13,6 +13,8 @@ import (
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/elisiariocouto/specular/pkg/storage"
 )
 
 func newTestLogger() *slog.Logger {
@@ -292,6 +294,37 @@ func TestDiscoveryCache_Clear(t *testing.T) {
 	}
 }
 
+func TestDiscoveryCache_Entries(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"providers.v1": "/v1/providers/",
+		})
+	}))
+	defer server.Close()
+
+	cache := NewDiscoveryCache(10*time.Second, server.Client(), newTestLogger())
+	if entries := cache.Entries(); len(entries) != 0 {
+		t.Fatalf("expected no entries, got %v", entries)
+	}
+
+	u, _ := url.Parse(server.URL)
+	if _, err := cache.DiscoverServices(context.Background(), u.Host); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+
+	entries := cache.Entries()
+	if len(entries) != 1 || entries[0].Hostname != u.Host || entries[0].ProvidersV1 != "/v1/providers/" {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+	if entries[0].Expired(10 * time.Second) {
+		t.Error("expected fresh entry not to be expired")
+	}
+	if !entries[0].Expired(0) {
+		t.Error("expected entry to be expired with a zero TTL")
+	}
+}
+
 func TestDiscoveryCache_ClearHost(t *testing.T) {
 	callCount := 0
 	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -429,3 +462,120 @@ func TestDiscoveryCache_ContextCancellation(t *testing.T) {
 		t.Errorf("expected context cancellation error")
 	}
 }
+
+func TestDiscoveryCache_OtherServices(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{
+			"providers.v1": "/v1/providers/",
+			"modules.v1": "https://modules.example.com/v1/modules/",
+			"login.v1": {"client": "terraform-cli", "grant_types": ["authz_code"], "authz": "/oauth/authorization", "token": "/oauth/token", "ports": [10000, 10010]},
+			"tfe.v2.1": "/api/v2/"
+		}`)
+	}))
+	defer server.Close()
+
+	cache := NewDiscoveryCache(time.Minute, server.Client(), newTestLogger())
+	u, _ := url.Parse(server.URL)
+	discovery, err := cache.DiscoverServices(context.Background(), u.Host)
+	if err != nil {
+		t.Fatalf("DiscoverServices failed: %v", err)
+	}
+	if discovery.ProvidersV1 != "/v1/providers/" {
+		t.Errorf("expected providers.v1 /v1/providers/, got %s", discovery.ProvidersV1)
+	}
+	if len(discovery.Services) != 4 {
+		t.Errorf("expected 4 services, got %d", len(discovery.Services))
+	}
+
+	services := discovery.ResolvedServices()
+	want := map[string]string{
+		"providers.v1": "https://" + u.Host + "/v1/providers/",
+		"modules.v1":   "https://modules.example.com/v1/modules/",
+		"tfe.v2.1":     "https://" + u.Host + "/api/v2/",
+	}
+	for name, url := range want {
+		var got string
+		if err := json.Unmarshal(services[name], &got); err != nil || got != url {
+			t.Errorf("expected %s %s, got %s", name, url, services[name])
+		}
+	}
+
+	var login map[string]any
+	if err := json.Unmarshal(services["login.v1"], &login); err != nil {
+		t.Fatalf("invalid login.v1: %v", err)
+	}
+	if login["authz"] != "https://"+u.Host+"/oauth/authorization" || login["token"] != "https://"+u.Host+"/oauth/token" {
+		t.Errorf("expected login.v1 URLs resolved against the registry, got %v", login)
+	}
+	if login["client"] != "terraform-cli" || len(login["ports"].([]any)) != 2 {
+		t.Errorf("expected other login.v1 properties unchanged, got %v", login)
+	}
+}
+
+func TestDiscoveryCache_SaveLoad(t *testing.T) {
+	callCount := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		callCount++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"providers.v1":"/v1/providers/","modules.v1":"/v1/modules/"}`)
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	hostname := u.Host
+
+	cache := NewDiscoveryCache(time.Hour, server.Client(), newTestLogger())
+	if _, err := cache.DiscoverServices(context.Background(), hostname); err != nil {
+		t.Fatalf("DiscoverServices failed: %v", err)
+	}
+	data, err := cache.Save()
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// A new cache, as after a restart, serves the saved response without a discovery request
+	restarted := NewDiscoveryCache(time.Hour, server.Client(), newTestLogger())
+	restored, err := restarted.Load(data)
+	if err != nil || restored != 1 {
+		t.Fatalf("Load = %d, %v", restored, err)
+	}
+	discovery, err := restarted.DiscoverServices(context.Background(), hostname)
+	if err != nil {
+		t.Fatalf("DiscoverServices failed: %v", err)
+	}
+	if discovery.ProvidersV1 != "/v1/providers/" || string(discovery.Services["modules.v1"]) != `"/v1/modules/"` {
+		t.Errorf("unexpected restored discovery %+v", discovery)
+	}
+	if callCount != 1 {
+		t.Errorf("expected the restored response to be used, got %d discovery requests", callCount)
+	}
+
+	// Responses keep their age, so a shorter TTL drops them
+	short := NewDiscoveryCache(time.Nanosecond, server.Client(), newTestLogger())
+	if restored, err := short.Load(data); err != nil || restored != 0 {
+		t.Errorf("expected expired responses to be skipped, got %d, %v", restored, err)
+	}
+	if _, err := restarted.Load([]byte("not json")); err == nil {
+		t.Error("expected an error for an invalid saved cache")
+	}
+}
+
+func TestMirror_SaveLoadDiscoveryCache(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	m, registry := newRegistryTestMirror(t, store)
+	if _, err := m.LoadDiscoveryCache(context.Background()); !storage.IsNotFound(err) {
+		t.Errorf("expected ErrNotFound before anything was saved, got %v", err)
+	}
+	if _, err := m.upstream.DiscoveryCache().DiscoverServices(context.Background(), registry.Hostname()); err != nil {
+		t.Fatalf("DiscoverServices failed: %v", err)
+	}
+	if err := m.SaveDiscoveryCache(context.Background()); err != nil {
+		t.Fatalf("SaveDiscoveryCache failed: %v", err)
+	}
+
+	restarted, _ := newRegistryTestMirror(t, store)
+	restored, err := restarted.LoadDiscoveryCache(context.Background())
+	if err != nil || restored != 1 {
+		t.Errorf("LoadDiscoveryCache = %d, %v", restored, err)
+	}
+}
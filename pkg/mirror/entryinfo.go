@@ -0,0 +1,36 @@
+package mirror
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+// recordEntry keeps info with an entry just cached in s, if s keeps entry records
+// The entry is served either way, so failures are only logged
+func recordEntry(ctx context.Context, s storage.Storage, entry string, info storage.EntryInfo) {
+	store, ok := storage.As[storage.EntryInfoStore](s)
+	if !ok {
+		return
+	}
+	if err := store.PutEntryInfo(ctx, entry, info); err != nil && !storage.IsNotFound(err) {
+		slog.WarnContext(ctx, "failed to record cache entry", "entry", entry, "err", err)
+	}
+}
+
+// metadataInfo describes index or version metadata fetched from upstream now
+func metadataInfo(data []byte) storage.EntryInfo {
+	sum := sha256.Sum256(data)
+	return storage.EntryInfo{FetchedAt: time.Now(), Size: int64(len(data)), Shasum: hex.EncodeToString(sum[:])}
+}
+
+// archiveInfo describes an archive fetched from upstream now, storage fills in its size and checksum
+func archiveInfo(body io.Reader) storage.EntryInfo {
+	etag, lastModified := ArchiveValidators(body)
+	return storage.EntryInfo{FetchedAt: time.Now(), ETag: etag, LastModified: lastModified}
+}
@@ -0,0 +1,54 @@
+package mirror
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"testing"
+
+	"github.com/elisiariocouto/specular/pkg/registrytest"
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+func TestGetArchive_RecordsEntryInfo(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	mirror, registry := newRegistryTestMirror(t, store)
+	archiveContent := registrytest.Archive(map[string]string{"terraform-provider-aws_v1.0.0": "provider binary"})
+	registry.AddPackage("hashicorp", "aws", "1.0.0", "linux", "amd64", archiveContent)
+	hostname := registry.Hostname()
+	ctx := context.Background()
+
+	index, err := mirror.GetIndex(ctx, hostname, "hashicorp", "aws")
+	if err != nil {
+		t.Fatalf("GetIndex failed: %v", err)
+	}
+	info, err := store.EntryInfo(ctx, storage.IndexEntry(hostname, "hashicorp", "aws"))
+	if err != nil {
+		t.Fatalf("no record of the index: %v", err)
+	}
+	sum := sha256.Sum256(index)
+	if info.Size != int64(len(index)) || info.Shasum != hex.EncodeToString(sum[:]) || info.FetchedAt.IsZero() {
+		t.Errorf("unexpected index record %+v", info)
+	}
+
+	archivePath := hostname + "/hashicorp/aws/terraform-provider-aws_1.0.0_linux_amd64.zip"
+	rc, err := mirror.GetArchive(ctx, hostname, "hashicorp", "aws", "1.0.0", "linux", "amd64", archivePath)
+	if err != nil {
+		t.Fatalf("GetArchive failed: %v", err)
+	}
+	io.Copy(io.Discard, rc)
+	rc.Close()
+
+	info, err = store.EntryInfo(ctx, archivePath)
+	if err != nil {
+		t.Fatalf("no record of the archive: %v", err)
+	}
+	sum = sha256.Sum256(archiveContent)
+	if info.ETag != `"`+hex.EncodeToString(sum[:])+`"` {
+		t.Errorf("expected the upstream ETag to be recorded, got %q", info.ETag)
+	}
+	if info.Size != int64(len(archiveContent)) || info.Shasum != hex.EncodeToString(sum[:]) {
+		t.Errorf("expected the size and checksum to be filled in, got %+v", info)
+	}
+}
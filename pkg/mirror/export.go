@@ -0,0 +1,159 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+// ExportResult counts what Export wrote
+type ExportResult struct {
+	Providers int   `json:"providers"`
+	Versions  int   `json:"versions"`
+	Archives  int   `json:"archives"`
+	Bytes     int64 `json:"bytes"`
+}
+
+// Export writes every cached archive to dir in the packed layout `terraform providers mirror` produces,
+// hostname/namespace/type/ with an index.json, a version.json per version and the archives next to them,
+// so the directory can be copied into an air-gapped network and served as a static network mirror or used
+// as a filesystem mirror. Archive URLs are relative and list h1: and zh: hashes, computed when not recorded.
+// Platforms without a cached archive are left out, and so are versions and providers without one.
+// Only cached data is read, nothing is fetched from upstream
+func (m *Mirror) Export(ctx context.Context, dir string) (ExportResult, error) {
+	var result ExportResult
+	providers, err := m.storage.ListProviders(ctx)
+	if err != nil {
+		return result, fmt.Errorf("%w: failed to list cached providers: %w", ErrStorageFailure, err)
+	}
+
+	for _, p := range providers {
+		versions, err := m.storage.ListVersions(ctx, p.Hostname, p.Namespace, p.Type)
+		if err != nil {
+			return result, fmt.Errorf("%w: failed to list cached versions of %s/%s/%s: %w", ErrStorageFailure, p.Hostname, p.Namespace, p.Type, err)
+		}
+
+		index := IndexResponse{Versions: make(map[string]VersionInfo)}
+		for _, version := range versions {
+			exported, err := m.exportVersion(ctx, dir, p, version, &result)
+			if err != nil {
+				return result, err
+			}
+			if exported {
+				index.Versions[version] = VersionInfo{}
+			}
+		}
+		if len(index.Versions) == 0 {
+			continue
+		}
+		data, err := json.Marshal(index)
+		if err != nil {
+			return result, err
+		}
+		if _, err := writeExportFile(filepath.Join(dir, p.Hostname, p.Namespace, p.Type, "index.json"), bytes.NewReader(data)); err != nil {
+			return result, err
+		}
+		result.Providers++
+	}
+	return result, nil
+}
+
+// exportVersion writes the cached archives of a version and its version.json, it reports whether any archive is cached
+func (m *Mirror) exportVersion(ctx context.Context, dir string, p storage.Provider, version string, result *ExportResult) (bool, error) {
+	data, err := m.storage.GetVersion(ctx, p.Hostname, p.Namespace, p.Type, version)
+	if err != nil {
+		if storage.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("%w: failed to read cached version %s of %s/%s/%s: %w", ErrStorageFailure, version, p.Hostname, p.Namespace, p.Type, err)
+	}
+	var cached VersionResponse
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return false, fmt.Errorf("%s/%s/%s %s: invalid cached version: %w", p.Hostname, p.Namespace, p.Type, version, err)
+	}
+
+	providerDir := filepath.Join(dir, p.Hostname, p.Namespace, p.Type)
+	exported := VersionResponse{Archives: make(map[string]Archive)}
+	for platform, archive := range cached.Archives {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		if archive.URL == "" {
+			continue
+		}
+		filename := m.extractFilename(archive.URL)
+		archivePath := fmt.Sprintf("%s/%s/%s/%s", p.Hostname, p.Namespace, p.Type, filename)
+
+		// Missing hashes are synthesized from the archive, which also tells whether it is cached
+		hashes, err := m.archiveLockHashes(ctx, archivePath)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return false, err
+		}
+		reader, err := m.storage.GetArchive(ctx, archivePath)
+		if err != nil {
+			return false, fmt.Errorf("%w: failed to read cached archive: %w", ErrStorageFailure, err)
+		}
+		n, err := writeExportFile(filepath.Join(providerDir, filename), reader)
+		reader.Close()
+		if err != nil {
+			return false, err
+		}
+		result.Archives++
+		result.Bytes += n
+
+		hashes = append(hashes, archive.Hashes...)
+		slices.Sort(hashes)
+		exported.Archives[platform] = Archive{URL: filename, Hashes: slices.Compact(hashes)}
+	}
+	if len(exported.Archives) == 0 {
+		return false, nil
+	}
+
+	data, err = json.Marshal(exported)
+	if err != nil {
+		return false, err
+	}
+	if _, err := writeExportFile(filepath.Join(providerDir, version+".json"), bytes.NewReader(data)); err != nil {
+		return false, err
+	}
+	result.Versions++
+	return true, nil
+}
+
+// writeExportFile writes r to path through a temporary file, so an interrupted export never leaves a partial file
+func writeExportFile(path string, r io.Reader) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, fmt.Errorf("failed to create export directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-export-")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	n, err := io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return 0, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return 0, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return n, nil
+}
@@ -0,0 +1,97 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elisiariocouto/specular/pkg/registrytest"
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+func TestExport(t *testing.T) {
+	store, err := storage.NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	mirror, registry := newRegistryTestMirror(t, store)
+	archiveContent := registrytest.Archive(map[string]string{"terraform-provider-aws_v1.0.0": "provider binary"})
+	registry.AddPackage("hashicorp", "aws", "1.0.0", "linux", "amd64", archiveContent)
+	registry.AddPackage("hashicorp", "aws", "1.0.0", "darwin", "arm64", registrytest.Archive(map[string]string{"terraform-provider-aws_v1.0.0": "darwin binary"}))
+	registry.AddPackage("hashicorp", "aws", "0.9.0", "linux", "amd64", registrytest.Archive(map[string]string{"terraform-provider-aws_v0.9.0": "old binary"}))
+	hostname := registry.Hostname()
+	ctx := context.Background()
+
+	// Only linux_amd64 of 1.0.0 is cached, 0.9.0 has metadata but no archive
+	if _, err := mirror.GetIndex(ctx, hostname, "hashicorp", "aws"); err != nil {
+		t.Fatalf("GetIndex failed: %v", err)
+	}
+	for _, version := range []string{"1.0.0", "0.9.0"} {
+		if _, err := mirror.GetVersion(ctx, hostname, "hashicorp", "aws", version); err != nil {
+			t.Fatalf("GetVersion %s failed: %v", version, err)
+		}
+	}
+	filename := registrytest.Filename("aws", "1.0.0", "linux", "amd64")
+	rc, err := mirror.GetArchive(ctx, hostname, "hashicorp", "aws", "1.0.0", "linux", "amd64", hostname+"/hashicorp/aws/"+filename)
+	if err != nil {
+		t.Fatalf("GetArchive failed: %v", err)
+	}
+	io.Copy(io.Discard, rc)
+	rc.Close()
+
+	dir := t.TempDir()
+	result, err := mirror.Export(ctx, dir)
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if result.Providers != 1 || result.Versions != 1 || result.Archives != 1 || result.Bytes != int64(len(archiveContent)) {
+		t.Errorf("unexpected export result %+v", result)
+	}
+
+	providerDir := filepath.Join(dir, hostname, "hashicorp", "aws")
+	var index IndexResponse
+	readExportJSON(t, filepath.Join(providerDir, "index.json"), &index)
+	if len(index.Versions) != 1 {
+		t.Errorf("expected only the version with a cached archive in index.json, got %v", index.Versions)
+	}
+	var version VersionResponse
+	readExportJSON(t, filepath.Join(providerDir, "1.0.0.json"), &version)
+	archive, ok := version.Archives["linux_amd64"]
+	if len(version.Archives) != 1 || !ok {
+		t.Fatalf("expected only the cached platform in 1.0.0.json, got %v", version.Archives)
+	}
+	if archive.URL != filename {
+		t.Errorf("expected a relative archive URL, got %q", archive.URL)
+	}
+	var h1, zh bool
+	for _, hash := range archive.Hashes {
+		h1 = h1 || strings.HasPrefix(hash, "h1:")
+		zh = zh || strings.HasPrefix(hash, "zh:")
+	}
+	if !h1 || !zh {
+		t.Errorf("expected h1: and zh: hashes, got %v", archive.Hashes)
+	}
+	data, err := os.ReadFile(filepath.Join(providerDir, filename))
+	if err != nil || !bytes.Equal(data, archiveContent) {
+		t.Errorf("expected the archive next to its version.json, got %d bytes, %v", len(data), err)
+	}
+	if _, err := os.Stat(filepath.Join(providerDir, "0.9.0.json")); !os.IsNotExist(err) {
+		t.Errorf("expected no version.json for a version without cached archives, got %v", err)
+	}
+}
+
+func readExportJSON(t *testing.T, path string, v any) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", path, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("invalid JSON in %s: %v", path, err)
+	}
+}
@@ -0,0 +1,77 @@
+package mirror
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/elisiariocouto/specular/pkg/metrics"
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+// FreeSpaceMonitor switches the mirror into passthrough mode while the cache
+// filesystem has less free space than the configured minimum, and back once space recovers
+type FreeSpaceMonitor struct {
+	mirror   *Mirror
+	reporter storage.SpaceReporter
+	minFree  int64
+	metrics  *metrics.Metrics
+	logger   *slog.Logger
+}
+
+// NewFreeSpaceMonitor creates a monitor for the given mirror and storage
+func NewFreeSpaceMonitor(m *Mirror, reporter storage.SpaceReporter, minFree int64, metrics *metrics.Metrics, logger *slog.Logger) *FreeSpaceMonitor {
+	return &FreeSpaceMonitor{
+		mirror:   m,
+		reporter: reporter,
+		minFree:  minFree,
+		metrics:  metrics,
+		logger:   logger,
+	}
+}
+
+// Check measures free space once and updates passthrough mode accordingly
+// When free space cannot be determined the current mode is kept
+func (fm *FreeSpaceMonitor) Check(ctx context.Context) error {
+	free, err := fm.reporter.FreeSpace(ctx)
+	if err != nil {
+		return err
+	}
+	fm.metrics.SetStorageFreeBytes(free)
+
+	low := free < fm.minFree
+	if low != fm.mirror.Passthrough() {
+		fm.mirror.SetPassthrough(low)
+		if low {
+			fm.logger.WarnContext(ctx, "free space below minimum, switching to passthrough mode",
+				slog.Int64("free_bytes", free),
+				slog.Int64("min_free_bytes", fm.minFree))
+		} else {
+			fm.logger.InfoContext(ctx, "free space recovered, resuming caching",
+				slog.Int64("free_bytes", free),
+				slog.Int64("min_free_bytes", fm.minFree))
+		}
+	}
+	fm.metrics.SetPassthroughMode(low)
+
+	return nil
+}
+
+// Run checks free space immediately and then at every interval until the context is cancelled
+func (fm *FreeSpaceMonitor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := fm.Check(ctx); err != nil {
+			fm.logger.ErrorContext(ctx, "failed to check free space",
+				slog.String("error", err.Error()))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/elisiariocouto/specular/pkg/metrics"
+)
+
+// fakeSpaceReporter reports a fixed amount of free space
+type fakeSpaceReporter struct {
+	free int64
+	err  error
+}
+
+func (f *fakeSpaceReporter) FreeSpace(ctx context.Context) (int64, error) {
+	return f.free, f.err
+}
+
+func TestFreeSpaceMonitor(t *testing.T) {
+	mirror := NewMirror(NewMockStorage(), nil, "http://localhost:8080")
+	reporter := &fakeSpaceReporter{free: 5 << 30}
+	monitor := NewFreeSpaceMonitor(mirror, reporter, 1<<30, metrics.Noop(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	steps := []struct {
+		free            int64
+		err             error
+		wantPassthrough bool
+	}{
+		{free: 5 << 30, wantPassthrough: false},
+		{free: 512 << 20, wantPassthrough: true},
+		// Errors keep the current mode
+		{err: errors.New("statfs failed"), wantPassthrough: true},
+		{free: 1 << 30, wantPassthrough: false},
+	}
+
+	for i, step := range steps {
+		reporter.free, reporter.err = step.free, step.err
+		err := monitor.Check(context.Background())
+		if (err != nil) != (step.err != nil) {
+			t.Fatalf("step %d: unexpected error %v", i, err)
+		}
+		if mirror.Passthrough() != step.wantPassthrough {
+			t.Errorf("step %d: expected passthrough %v, got %v", i, step.wantPassthrough, mirror.Passthrough())
+		}
+	}
+}
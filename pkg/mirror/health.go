@@ -0,0 +1,206 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elisiariocouto/specular/pkg/metrics"
+)
+
+// Circuit breaker states reported in UpstreamHealth
+const (
+	// BreakerClosed lets requests reach the upstream registry
+	BreakerClosed = "closed"
+	// BreakerOpen fails registry requests fast until a probe succeeds again
+	BreakerOpen = "open"
+)
+
+// UpstreamHealth is the result of the latest probes of an upstream registry
+type UpstreamHealth struct {
+	Hostname string `json:"hostname"`
+	// Provider is the hostname/namespace/type whose versions are fetched by the probe
+	Provider            string    `json:"provider"`
+	Healthy             bool      `json:"healthy"`
+	Breaker             string    `json:"breaker"`
+	LatencyMs           int64     `json:"latency_ms"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	LastProbe           time.Time `json:"last_probe"`
+	LastSuccess         time.Time `json:"last_success,omitzero"`
+	LastError           string    `json:"last_error,omitempty"`
+}
+
+// HealthMonitor periodically probes upstream registries with service discovery and a versions request
+// After threshold consecutive failed probes a host's circuit breaker opens, and registry requests to it
+// fail fast so cached metadata is served without waiting on timeouts. The next successful probe closes it.
+type HealthMonitor struct {
+	upstream  *UpstreamClient
+	probes    []ProviderAddress
+	threshold int
+	metrics   *metrics.Metrics
+	logger    *slog.Logger
+
+	mu    sync.RWMutex
+	hosts map[string]*UpstreamHealth
+}
+
+// NewHealthMonitor creates a monitor probing one provider per upstream registry
+// A threshold of zero never opens the circuit breaker
+func NewHealthMonitor(upstream *UpstreamClient, probes []ProviderAddress, threshold int, metrics *metrics.Metrics, logger *slog.Logger) *HealthMonitor {
+	return &HealthMonitor{
+		upstream:  upstream,
+		probes:    probes,
+		threshold: threshold,
+		metrics:   metrics,
+		logger:    logger,
+		hosts:     make(map[string]*UpstreamHealth),
+	}
+}
+
+// Check probes every upstream registry once, concurrently
+func (hm *HealthMonitor) Check(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, probe := range hm.probes {
+		wg.Go(func() {
+			hm.check(ctx, probe)
+		})
+	}
+	wg.Wait()
+}
+
+// check probes one upstream registry and updates its health
+func (hm *HealthMonitor) check(ctx context.Context, probe ProviderAddress) {
+	start := time.Now()
+	err := hm.probe(ctx, probe)
+	latency := time.Since(start)
+
+	hm.mu.Lock()
+	health, ok := hm.hosts[probe.Hostname]
+	if !ok {
+		health = &UpstreamHealth{Hostname: probe.Hostname, Breaker: BreakerClosed}
+		hm.hosts[probe.Hostname] = health
+	}
+	health.Provider = probe.Hostname + "/" + probe.Namespace + "/" + probe.Type
+	health.LatencyMs = latency.Milliseconds()
+	health.LastProbe = start
+	health.Healthy = err == nil
+	previous := health.Breaker
+	if err == nil {
+		health.ConsecutiveFailures = 0
+		health.LastSuccess = start
+		health.LastError = ""
+		health.Breaker = BreakerClosed
+	} else {
+		health.ConsecutiveFailures++
+		health.LastError = err.Error()
+		if hm.threshold > 0 && health.ConsecutiveFailures >= hm.threshold {
+			health.Breaker = BreakerOpen
+		}
+	}
+	breaker := health.Breaker
+	hm.mu.Unlock()
+
+	hm.metrics.RecordUpstreamProbe(probe.Hostname, err == nil, latency, breaker == BreakerOpen)
+
+	switch {
+	case previous != BreakerOpen && breaker == BreakerOpen:
+		hm.logger.WarnContext(ctx, "upstream unhealthy, opening circuit breaker",
+			slog.String("hostname", probe.Hostname),
+			slog.String("error", err.Error()))
+	case previous == BreakerOpen && breaker == BreakerClosed:
+		hm.logger.InfoContext(ctx, "upstream recovered, closing circuit breaker",
+			slog.String("hostname", probe.Hostname))
+	case err != nil:
+		hm.logger.DebugContext(ctx, "upstream probe failed",
+			slog.String("hostname", probe.Hostname),
+			slog.String("error", err.Error()))
+	}
+}
+
+// probe runs service discovery and fetches the versions of the probed provider, without retries
+// Providers with a configured source skip discovery
+func (hm *HealthMonitor) probe(ctx context.Context, probe ProviderAddress) error {
+	uc := hm.upstream
+	endpoint, ok := uc.sources.Lookup(probe.Hostname, probe.Namespace, probe.Type)
+	if ok {
+		endpoint = strings.TrimSuffix(endpoint, "/")
+	} else {
+		discovery, err := uc.discoveryCache.fetchFromUpstream(ctx, probe.Hostname)
+		if err != nil {
+			return err
+		}
+		if !isValidProvidersURL(discovery.ProvidersV1) {
+			return fmt.Errorf("invalid providers.v1 URL in service discovery: %q", discovery.ProvidersV1)
+		}
+		endpoint = fmt.Sprintf("https://%s%s", probe.Hostname, strings.TrimSuffix(discovery.ProvidersV1, "/"))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/%s/%s/versions", endpoint, probe.Namespace, probe.Type), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create probe request: %w", err)
+	}
+	injectTraceContext(req)
+	resp, err := uc.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("versions request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("versions request returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Run probes immediately and then at every interval until the context is cancelled
+func (hm *HealthMonitor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		hm.Check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Status returns the health of every probed upstream registry, sorted by hostname
+// Registries are listed once they have been probed
+func (hm *HealthMonitor) Status() []UpstreamHealth {
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
+	status := make([]UpstreamHealth, 0, len(hm.hosts))
+	for _, health := range hm.hosts {
+		status = append(status, *health)
+	}
+	slices.SortFunc(status, func(a, b UpstreamHealth) int {
+		return strings.Compare(a.Hostname, b.Hostname)
+	})
+	return status
+}
+
+// breakerOpen reports whether requests to hostname should fail fast
+func (hm *HealthMonitor) breakerOpen(hostname string) bool {
+	hm.mu.RLock()
+	defer hm.mu.RUnlock()
+	health, ok := hm.hosts[hostname]
+	return ok && health.Breaker == BreakerOpen
+}
+
+// checkBreaker returns an error when the circuit breaker of hostname is open
+func (uc *UpstreamClient) checkBreaker(hostname string) error {
+	if uc.health != nil && uc.health.breakerOpen(hostname) {
+		return fmt.Errorf("%w: circuit breaker open for %s", ErrUpstreamUnavailable, hostname)
+	}
+	return nil
+}
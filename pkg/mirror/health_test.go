@@ -0,0 +1,81 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+
+	"github.com/elisiariocouto/specular/pkg/metrics"
+	"github.com/elisiariocouto/specular/pkg/registrytest"
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+func TestHealthMonitor(t *testing.T) {
+	mirror, registry := newRegistryTestMirror(t, storage.NewMemoryStorage())
+	registry.AddPackage("hashicorp", "aws", "1.0.0", "linux", "amd64", registrytest.Archive(map[string]string{"terraform-provider-aws": "binary"}))
+	hostname := registry.Hostname()
+
+	probe := ProviderAddress{Hostname: hostname, Namespace: "hashicorp", Type: "aws"}
+	monitor := NewHealthMonitor(mirror.upstream, []ProviderAddress{probe}, 2, metrics.Noop(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	mirror.upstream.SetHealthMonitor(monitor)
+	ctx := context.Background()
+
+	if health := mirror.UpstreamHealth(); len(health) != 0 {
+		t.Fatalf("expected no health before probing, got %+v", health)
+	}
+
+	monitor.Check(ctx)
+	health := mirror.UpstreamHealth()
+	if len(health) != 1 || !health[0].Healthy || health[0].Breaker != BreakerClosed || health[0].Provider != hostname+"/hashicorp/aws" {
+		t.Fatalf("unexpected health after a successful probe %+v", health)
+	}
+
+	registry.Fail(http.StatusInternalServerError)
+	monitor.Check(ctx)
+	health = mirror.UpstreamHealth()
+	if health[0].Healthy || health[0].Breaker != BreakerClosed || health[0].ConsecutiveFailures != 1 || health[0].LastError == "" {
+		t.Fatalf("breaker should stay closed below the threshold %+v", health[0])
+	}
+
+	monitor.Check(ctx)
+	health = mirror.UpstreamHealth()
+	if health[0].Breaker != BreakerOpen {
+		t.Fatalf("breaker should open at the threshold %+v", health[0])
+	}
+
+	// Requests fail fast without reaching the registry while the breaker is open
+	before := registry.Requests(registrytest.VersionsPath("hashicorp", "aws"))
+	if _, err := mirror.GetIndex(ctx, hostname, "hashicorp", "aws"); !errors.Is(err, ErrUpstreamUnavailable) {
+		t.Fatalf("expected ErrUpstreamUnavailable, got %v", err)
+	}
+	if n := registry.Requests(registrytest.VersionsPath("hashicorp", "aws")); n != before {
+		t.Errorf("versions endpoint called %d times while the breaker was open", n-before)
+	}
+
+	registry.Fail(0)
+	monitor.Check(ctx)
+	health = mirror.UpstreamHealth()
+	if !health[0].Healthy || health[0].Breaker != BreakerClosed || health[0].ConsecutiveFailures != 0 || health[0].LastError != "" {
+		t.Fatalf("breaker should close after a successful probe %+v", health[0])
+	}
+	if _, err := mirror.GetIndex(ctx, hostname, "hashicorp", "aws"); err != nil {
+		t.Fatalf("GetIndex failed after recovery: %v", err)
+	}
+}
+
+func TestHealthMonitor_NoThreshold(t *testing.T) {
+	mirror, registry := newRegistryTestMirror(t, storage.NewMemoryStorage())
+	registry.Fail(http.StatusServiceUnavailable)
+
+	probe := ProviderAddress{Hostname: registry.Hostname(), Namespace: "hashicorp", Type: "aws"}
+	monitor := NewHealthMonitor(mirror.upstream, []ProviderAddress{probe}, 0, metrics.Noop(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	for range 3 {
+		monitor.Check(context.Background())
+	}
+	if health := monitor.Status(); health[0].Breaker != BreakerClosed || health[0].ConsecutiveFailures != 3 {
+		t.Fatalf("breaker should never open without a threshold %+v", health[0])
+	}
+}
@@ -0,0 +1,142 @@
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ProviderInfo describes a provider as known to the mirror, combining upstream metadata and the cache
+type ProviderInfo struct {
+	Hostname  string `json:"hostname"`
+	Namespace string `json:"namespace"`
+	Type      string `json:"type"`
+	// Latest is the most recent release, or the most recent pre-release if there is no release
+	Latest string `json:"latest"`
+	// Versions are sorted from newest to oldest
+	Versions []ProviderVersionInfo `json:"versions"`
+}
+
+// ProviderVersionInfo describes a single provider version
+type ProviderVersionInfo struct {
+	Version   string   `json:"version"`
+	Protocols []string `json:"protocols,omitempty"`
+	// PublishedAt is set when the upstream registry reports it
+	PublishedAt *time.Time `json:"published_at,omitempty"`
+	// CachedAt is when the version metadata was cached, unset if it is not
+	CachedAt  *time.Time     `json:"cached_at,omitempty"`
+	Platforms []PlatformInfo `json:"platforms"`
+}
+
+// PlatformInfo describes the archive of a provider version for one platform
+type PlatformInfo struct {
+	OS     string `json:"os"`
+	Arch   string `json:"arch"`
+	Cached bool   `json:"cached"`
+}
+
+// ProviderInfo returns the versions of a provider with their platforms and whether their archives are cached
+// Platforms come from the cached registry versions response, or from cached version metadata for mirror protocol upstreams
+func (m *Mirror) ProviderInfo(ctx context.Context, hostname, namespace, providerType string) (*ProviderInfo, error) {
+	data, err := m.GetIndex(ctx, hostname, namespace, providerType)
+	if err != nil {
+		return nil, err
+	}
+	var index IndexResponse
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("failed to parse index: %w", err)
+	}
+
+	bypass := m.bypassCache(hostname, namespace, providerType)
+	upstream := make(map[string]RegistryVersion)
+	if !bypass {
+		if versionsData, err := m.storage.GetVersionsResponse(ctx, hostname, namespace, providerType); err == nil {
+			var versionsResp RegistryVersionsResponse
+			if err := json.Unmarshal(versionsData, &versionsResp); err == nil {
+				for _, v := range versionsResp.Versions {
+					upstream[v.Version] = v
+				}
+			}
+		}
+	}
+
+	versions := slices.SortedFunc(maps.Keys(index.Versions), func(a, b string) int {
+		return compareVersions(b, a)
+	})
+	info := &ProviderInfo{
+		Hostname:  hostname,
+		Namespace: namespace,
+		Type:      providerType,
+		Versions:  make([]ProviderVersionInfo, 0, len(versions)),
+	}
+	for _, version := range versions {
+		v := ProviderVersionInfo{Version: version, Platforms: []PlatformInfo{}}
+		if modTime, err := m.VersionModTime(ctx, hostname, namespace, providerType, version); err == nil {
+			v.CachedAt = &modTime
+		}
+
+		archives := make(map[RegistryPlatform]string)
+		if registryVersion, ok := upstream[version]; ok {
+			v.Protocols = registryVersion.Protocols
+			v.PublishedAt = registryVersion.PublishedAt
+			for _, platform := range registryVersion.Platforms {
+				archives[platform] = buildProviderFilename(providerType, version, platform.OS, platform.Arch)
+			}
+		} else if !bypass {
+			archives = m.cachedArchives(ctx, hostname, namespace, providerType, version)
+		}
+
+		for platform, filename := range archives {
+			cached := false
+			if !bypass {
+				cached, err = m.storage.ExistsArchive(ctx, fmt.Sprintf("%s/%s/%s/%s", hostname, namespace, providerType, filename))
+				if err != nil {
+					return nil, fmt.Errorf("%w: failed to check cached archive: %w", ErrStorageFailure, err)
+				}
+			}
+			v.Platforms = append(v.Platforms, PlatformInfo{OS: platform.OS, Arch: platform.Arch, Cached: cached})
+		}
+		slices.SortFunc(v.Platforms, func(a, b PlatformInfo) int {
+			return strings.Compare(a.OS+"_"+a.Arch, b.OS+"_"+b.Arch)
+		})
+
+		info.Versions = append(info.Versions, v)
+	}
+
+	for _, v := range info.Versions {
+		if _, pre, ok := splitVersion(v.Version); ok && pre == "" {
+			info.Latest = v.Version
+			break
+		}
+	}
+	if info.Latest == "" && len(info.Versions) > 0 {
+		info.Latest = info.Versions[0].Version
+	}
+
+	return info, nil
+}
+
+// cachedArchives returns the archive file names listed in the cached version metadata, keyed by platform
+func (m *Mirror) cachedArchives(ctx context.Context, hostname, namespace, providerType, version string) map[RegistryPlatform]string {
+	archives := make(map[RegistryPlatform]string)
+	data, err := m.storage.GetVersion(ctx, hostname, namespace, providerType, version)
+	if err != nil {
+		return archives
+	}
+	var response VersionResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return archives
+	}
+	for key, archive := range response.Archives {
+		os, arch, err := parsePlatformKey(key)
+		if err != nil || archive.URL == "" {
+			continue
+		}
+		archives[RegistryPlatform{OS: os, Arch: arch}] = m.extractFilename(archive.URL)
+	}
+	return archives
+}
@@ -0,0 +1,54 @@
+package mirror
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestProviderInfo(t *testing.T) {
+	mockStorage := NewMockStorage()
+	mockStorage.indices["registry.terraform.io/hashicorp/aws/index"] = []byte(`{"versions":{"1.0.0":{},"1.10.0":{},"2.0.0-beta1":{},"0.9.0":{}}}`)
+	mockStorage.versionsResponses["registry.terraform.io/hashicorp/aws/versions"] = []byte(`{"versions":[
+		{"version":"1.10.0","protocols":["5.0"],"published_at":"2025-11-01T10:00:00Z","platforms":[{"os":"linux","arch":"amd64"},{"os":"darwin","arch":"arm64"}]},
+		{"version":"1.0.0","platforms":[{"os":"linux","arch":"amd64"}]},
+		{"version":"2.0.0-beta1","platforms":[{"os":"linux","arch":"amd64"}]}
+	]}`)
+	mockStorage.archives["registry.terraform.io/hashicorp/aws/terraform-provider-aws_1.10.0_linux_amd64.zip"] = []byte("zip")
+	// Only in the cached version metadata, as with mirror protocol upstreams
+	mockStorage.versions["registry.terraform.io/hashicorp/aws/0.9.0"] = []byte(`{"archives":{
+		"linux_arm64":{"url":"http://localhost:8080/download/registry.terraform.io/hashicorp/aws/0.9.0/linux/arm64/custom.zip"}
+	}}`)
+	mockStorage.archives["registry.terraform.io/hashicorp/aws/custom.zip"] = []byte("zip")
+
+	mirror := NewMirror(mockStorage, nil, "http://localhost:8080")
+	info, err := mirror.ProviderInfo(context.Background(), "registry.terraform.io", "hashicorp", "aws")
+	if err != nil {
+		t.Fatalf("ProviderInfo failed: %v", err)
+	}
+
+	if info.Latest != "1.10.0" {
+		t.Errorf("Latest = %q, want 1.10.0", info.Latest)
+	}
+	var versions []string
+	for _, v := range info.Versions {
+		versions = append(versions, v.Version)
+	}
+	if len(versions) != 4 || versions[0] != "2.0.0-beta1" || versions[1] != "1.10.0" || versions[3] != "0.9.0" {
+		t.Fatalf("unexpected version order %v", versions)
+	}
+
+	latest := info.Versions[1]
+	if latest.PublishedAt == nil || !latest.PublishedAt.Equal(time.Date(2025, 11, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected published date %v", latest.PublishedAt)
+	}
+	want := []PlatformInfo{{OS: "darwin", Arch: "arm64"}, {OS: "linux", Arch: "amd64", Cached: true}}
+	if len(latest.Platforms) != 2 || latest.Platforms[0] != want[0] || latest.Platforms[1] != want[1] {
+		t.Errorf("unexpected platforms %+v", latest.Platforms)
+	}
+
+	old := info.Versions[3]
+	if len(old.Platforms) != 1 || old.Platforms[0] != (PlatformInfo{OS: "linux", Arch: "arm64", Cached: true}) {
+		t.Errorf("unexpected platforms from cached version metadata %+v", old.Platforms)
+	}
+}
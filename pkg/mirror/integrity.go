@@ -0,0 +1,109 @@
+package mirror
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+// SetVerifyShasums makes the mirror compare cached archives with the shasum the registry published before
+// serving them, so a mismatching archive is evicted and fetched again instead of failing lock verification.
+// Fetched archives that do not match are not served. The checksum the storage recorded is compared, archives
+// are only hashed when it records none. Must be called before the mirror is used
+func (m *Mirror) SetVerifyShasums(enabled bool) {
+	m.verifyShasums = enabled
+}
+
+// verifiedArchive returns the cached archive if it matches the shasum published by the registry
+// An archive that is not cached, or does not match and is evicted, returns storage.ErrNotFound so the caller
+// fetches it. When the registry cannot tell the shasum the archive is served unverified
+func (m *Mirror) verifiedArchive(ctx context.Context, hostname, namespace, providerType, version, os, arch, archivePath string) (io.ReadCloser, error) {
+	exists, err := m.storage.ExistsArchive(ctx, archivePath)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, storage.ErrNotFound
+	}
+
+	want, err := m.registryShasum(ctx, hostname, namespace, providerType, version, os, arch, archivePath)
+	if err != nil {
+		slog.WarnContext(ctx, "serving archive without shasum verification", "path", archivePath, "err", err)
+		return m.storage.GetArchive(ctx, archivePath)
+	}
+	got, err := m.storedShasum(ctx, archivePath)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(got, want) {
+		return m.storage.GetArchive(ctx, archivePath)
+	}
+
+	slog.ErrorContext(ctx, "cached archive does not match the registry shasum, fetching it again",
+		"path", archivePath, "shasum", got, "registry_shasum", want)
+	if err := m.storage.DeleteArchive(ctx, archivePath); err != nil {
+		return nil, fmt.Errorf("%w: failed to evict corrupted archive: %w", ErrStorageFailure, err)
+	}
+	return nil, storage.ErrNotFound
+}
+
+// registryShasum returns the shasum the registry published for a cached archive
+// The one recorded with the archive saves a registry request, a fetched one is recorded for next time
+func (m *Mirror) registryShasum(ctx context.Context, hostname, namespace, providerType, version, os, arch, archivePath string) (string, error) {
+	store, ok := storage.As[storage.EntryInfoStore](m.storage)
+	var info storage.EntryInfo
+	if ok {
+		recorded, err := store.EntryInfo(ctx, archivePath)
+		if err == nil && recorded.RegistryShasum != "" {
+			return recorded.RegistryShasum, nil
+		}
+		info = recorded
+	}
+
+	downloadInfo, err := m.upstream.FetchDownloadURL(ctx, hostname, namespace, providerType, version, os, arch)
+	if err != nil {
+		return "", err
+	}
+	if downloadInfo.Shasum == "" {
+		return "", fmt.Errorf("registry published no shasum for %s", archivePath)
+	}
+	if ok {
+		// Archives cached before records were kept have none, their modification time is the best guess
+		if info.FetchedAt.IsZero() {
+			info.FetchedAt, _ = m.ArchiveModTime(ctx, archivePath)
+		}
+		info.RegistryShasum = downloadInfo.Shasum
+		recordEntry(ctx, m.storage, archivePath, info)
+	}
+	return downloadInfo.Shasum, nil
+}
+
+// storedShasum returns the SHA-256 the storage recorded for a cached archive, or hashes it when none was
+func (m *Mirror) storedShasum(ctx context.Context, archivePath string) (string, error) {
+	if reporter, ok := storage.As[storage.ChecksumReporter](m.storage); ok {
+		if sum, err := reporter.ArchiveChecksum(ctx, archivePath); err == nil {
+			return sum, nil
+		}
+	}
+	return m.cachedShasum(ctx, archivePath)
+}
+
+// cachedShasum hashes the cached archive as it would be served
+func (m *Mirror) cachedShasum(ctx context.Context, archivePath string) (string, error) {
+	reader, err := m.storage.GetArchive(ctx, archivePath)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, reader); err != nil {
+		return "", fmt.Errorf("%w: failed to read cached archive: %w", ErrStorageFailure, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,131 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elisiariocouto/specular/pkg/registrytest"
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+func TestGetArchive_VerifyShasumsRefetchesCorruptedArchive(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	mirror, registry := newRegistryTestMirror(t, store)
+	mirror.SetVerifyShasums(true)
+	archiveContent := registrytest.Archive(map[string]string{"terraform-provider-aws_v1.0.0": "provider binary"})
+	registry.AddPackage("hashicorp", "aws", "1.0.0", "linux", "amd64", archiveContent)
+	hostname := registry.Hostname()
+	archivePath := hostname + "/hashicorp/aws/terraform-provider-aws_1.0.0_linux_amd64.zip"
+	ctx := context.Background()
+
+	get := func() []byte {
+		t.Helper()
+		rc, err := mirror.GetArchive(ctx, hostname, "hashicorp", "aws", "1.0.0", "linux", "amd64", archivePath)
+		if err != nil {
+			t.Fatalf("GetArchive failed: %v", err)
+		}
+		defer rc.Close()
+		data, _ := io.ReadAll(rc)
+		return data
+	}
+
+	get()
+	// A miss asks the registry for the download URL once
+	if n := registry.Requests(registrytest.DownloadPath("hashicorp", "aws", "1.0.0", "linux", "amd64")); n != 1 {
+		t.Errorf("expected 1 download info request on a miss, got %d", n)
+	}
+	info, err := store.EntryInfo(ctx, archivePath)
+	if err != nil || info.RegistryShasum == "" {
+		t.Fatalf("expected the registry shasum to be recorded, got %+v, %v", info, err)
+	}
+
+	// A verified hit uses the recorded shasum and does not ask the registry again
+	downloads := registry.Requests(registrytest.DownloadPath("hashicorp", "aws", "1.0.0", "linux", "amd64"))
+	if !bytes.Equal(get(), archiveContent) {
+		t.Fatal("unexpected archive content on a cache hit")
+	}
+	if n := registry.Requests(registrytest.DownloadPath("hashicorp", "aws", "1.0.0", "linux", "amd64")); n != downloads {
+		t.Errorf("expected no download info request on a verified hit, got %d more", n-downloads)
+	}
+
+	// A corrupted archive is evicted and fetched again transparently
+	store.PutArchive(ctx, archivePath, strings.NewReader("truncated zip"))
+	if !bytes.Equal(get(), archiveContent) {
+		t.Fatal("expected the corrupted archive to be replaced by the upstream one")
+	}
+	if n := registry.Requests(registrytest.ArchivePath("hashicorp", "aws", "1.0.0", "linux", "amd64")); n != 2 {
+		t.Errorf("expected the archive to be fetched twice, got %d", n)
+	}
+}
+
+func TestGetArchive_VerifyShasumsWithoutRecord(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	mirror, registry := newRegistryTestMirror(t, store)
+	mirror.SetVerifyShasums(true)
+	archiveContent := registrytest.Archive(map[string]string{"terraform-provider-aws_v1.0.0": "provider binary"})
+	registry.AddPackage("hashicorp", "aws", "1.0.0", "linux", "amd64", archiveContent)
+	hostname := registry.Hostname()
+	archivePath := hostname + "/hashicorp/aws/terraform-provider-aws_1.0.0_linux_amd64.zip"
+	ctx := context.Background()
+
+	// An archive cached before records were kept is checked against the registry, which is then recorded
+	store.PutArchive(ctx, archivePath, bytes.NewReader(archiveContent))
+	rc, err := mirror.GetArchive(ctx, hostname, "hashicorp", "aws", "1.0.0", "linux", "amd64", archivePath)
+	if err != nil {
+		t.Fatalf("GetArchive failed: %v", err)
+	}
+	rc.Close()
+	if n := registry.Requests(registrytest.ArchivePath("hashicorp", "aws", "1.0.0", "linux", "amd64")); n != 0 {
+		t.Errorf("expected the matching archive to be served from cache, got %d upstream fetches", n)
+	}
+	info, err := store.EntryInfo(ctx, archivePath)
+	if err != nil || info.RegistryShasum == "" || info.FetchedAt.IsZero() {
+		t.Errorf("expected the registry shasum to be recorded, got %+v, %v", info, err)
+	}
+}
+
+func TestGetArchive_VerifyShasumsWithVerifyOnRead(t *testing.T) {
+	dir := t.TempDir()
+	store, err := storage.NewFilesystemStorage(dir)
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	store.SetVerifyOnRead(true)
+	mirror, registry := newRegistryTestMirror(t, store)
+	mirror.SetVerifyShasums(true)
+	archiveContent := registrytest.Archive(map[string]string{"terraform-provider-aws_v1.0.0": "provider binary"})
+	registry.AddPackage("hashicorp", "aws", "1.0.0", "linux", "amd64", archiveContent)
+	hostname := registry.Hostname()
+	archivePath := hostname + "/hashicorp/aws/terraform-provider-aws_1.0.0_linux_amd64.zip"
+	ctx := context.Background()
+
+	get := func() []byte {
+		t.Helper()
+		rc, err := mirror.GetArchive(ctx, hostname, "hashicorp", "aws", "1.0.0", "linux", "amd64", archivePath)
+		if err != nil {
+			t.Fatalf("GetArchive failed: %v", err)
+		}
+		defer rc.Close()
+		data, _ := io.ReadAll(rc)
+		return data
+	}
+	get()
+
+	// The recorded checksum still matches the registry, storage verification catches the corruption on disk
+	corrupted := bytes.Clone(archiveContent)
+	corrupted[len(corrupted)/2] ^= 0xff
+	if err := os.WriteFile(filepath.Join(dir, archivePath), corrupted, 0o644); err != nil {
+		t.Fatalf("failed to corrupt archive: %v", err)
+	}
+	if !bytes.Equal(get(), archiveContent) {
+		t.Fatal("expected the corrupted archive to be replaced by the upstream one")
+	}
+	if n := registry.Requests(registrytest.ArchivePath("hashicorp", "aws", "1.0.0", "linux", "amd64")); n != 2 {
+		t.Errorf("expected the archive to be fetched twice, got %d", n)
+	}
+}
@@ -0,0 +1,260 @@
+package mirror
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+// LockHashes returns the hashes Terraform records for a provider version in .terraform.lock.hcl
+// h1: and zh: hashes are computed from the cached archives, platforms that are not cached are
+// skipped. Hashes included in the version metadata are returned as well.
+// Returns ErrNotFound if no hash is known for the version.
+func (m *Mirror) LockHashes(ctx context.Context, hostname, namespace, providerType, version string) ([]string, error) {
+	data, err := m.GetVersion(ctx, hostname, namespace, providerType, version)
+	if err != nil {
+		return nil, err
+	}
+
+	var response VersionResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse version response: %w", err)
+	}
+
+	var hashes []string
+	for _, archive := range response.Archives {
+		hashes = append(hashes, archive.Hashes...)
+		if archive.URL == "" {
+			continue
+		}
+
+		archivePath := fmt.Sprintf("%s/%s/%s/%s", hostname, namespace, providerType, m.extractFilename(archive.URL))
+		archiveHashes, err := m.archiveLockHashes(ctx, archivePath)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		hashes = append(hashes, archiveHashes...)
+	}
+
+	if len(hashes) == 0 {
+		return nil, ErrNotFound
+	}
+	slices.Sort(hashes)
+	return slices.Compact(hashes), nil
+}
+
+// PrecomputeHashes records the lock file hashes of every cached archive of every cached version,
+// so LockHashes never has to hash large archives while a client waits. Only cached data is read,
+// nothing is fetched from upstream. It returns the number of archives with recorded hashes
+func (m *Mirror) PrecomputeHashes(ctx context.Context) (int, error) {
+	providers, err := m.storage.ListProviders(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to list cached providers: %w", ErrStorageFailure, err)
+	}
+
+	// Keep going when one archive fails, and report the failures together
+	var hashed int
+	var errs []error
+	for _, p := range providers {
+		data, err := m.storage.GetIndex(ctx, p.Hostname, p.Namespace, p.Type)
+		if err != nil {
+			continue
+		}
+		var index IndexResponse
+		if err := json.Unmarshal(data, &index); err != nil {
+			errs = append(errs, fmt.Errorf("%s/%s/%s: invalid cached index: %w", p.Hostname, p.Namespace, p.Type, err))
+			continue
+		}
+		for version := range index.Versions {
+			data, err := m.storage.GetVersion(ctx, p.Hostname, p.Namespace, p.Type, version)
+			if err != nil {
+				continue
+			}
+			var response VersionResponse
+			if err := json.Unmarshal(data, &response); err != nil {
+				errs = append(errs, fmt.Errorf("%s/%s/%s %s: invalid cached version: %w", p.Hostname, p.Namespace, p.Type, version, err))
+				continue
+			}
+			for _, archive := range response.Archives {
+				if err := ctx.Err(); err != nil {
+					return hashed, err
+				}
+				if archive.URL == "" {
+					continue
+				}
+				archivePath := fmt.Sprintf("%s/%s/%s/%s", p.Hostname, p.Namespace, p.Type, m.extractFilename(archive.URL))
+				if _, err := m.archiveLockHashes(ctx, archivePath); err != nil {
+					if !errors.Is(err, ErrNotFound) {
+						errs = append(errs, err)
+					}
+					continue
+				}
+				hashed++
+			}
+		}
+	}
+	return hashed, errors.Join(errs...)
+}
+
+// archiveLockHashes returns the h1: and zh: hashes of a cached archive
+// Hashes recorded by the storage are used while they match the archive, otherwise they are computed and recorded
+// Returns ErrNotFound if the archive is not cached
+func (m *Mirror) archiveLockHashes(ctx context.Context, archivePath string) ([]string, error) {
+	recorder, canRecord := storage.As[storage.HashRecorder](m.storage)
+	if canRecord {
+		if hashes, err := recorder.ArchiveHashes(ctx, archivePath); err == nil && m.hashesCurrent(ctx, archivePath, hashes) {
+			return hashes, nil
+		}
+	}
+
+	reader, err := m.storage.GetArchive(ctx, archivePath)
+	if err != nil {
+		if storage.IsNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("%w: failed to read cached archive: %w", ErrStorageFailure, err)
+	}
+	h1, zh, err := archiveHashes(reader)
+	reader.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash %s: %w", archivePath, err)
+	}
+	hashes := []string{h1, zh}
+
+	if canRecord {
+		if err := recorder.PutArchiveHashes(ctx, archivePath, hashes); err != nil && !storage.IsNotFound(err) {
+			slog.WarnContext(ctx, "failed to record archive hashes", "path", archivePath, "err", err)
+		}
+	}
+	return hashes, nil
+}
+
+// hashesCurrent reports whether recorded hashes belong to the archive as cached now
+// The zh: hash must match the archive's checksum when the storage records one
+func (m *Mirror) hashesCurrent(ctx context.Context, archivePath string, hashes []string) bool {
+	var h1, zh string
+	for _, hash := range hashes {
+		switch {
+		case strings.HasPrefix(hash, "h1:"):
+			h1 = hash
+		case strings.HasPrefix(hash, "zh:"):
+			zh = hash
+		}
+	}
+	if h1 == "" || zh == "" {
+		return false
+	}
+	reporter, ok := storage.As[storage.ChecksumReporter](m.storage)
+	if !ok {
+		return true
+	}
+	sum, err := reporter.ArchiveChecksum(ctx, archivePath)
+	return err == nil && zh == "zh:"+sum
+}
+
+// archiveHashes computes the h1: hash of the files inside a provider zip and the zh: hash of the zip itself
+func archiveHashes(reader io.Reader) (h1, zh string, err error) {
+	var readerAt io.ReaderAt
+	var size int64
+	if f, ok := reader.(*os.File); ok {
+		info, err := f.Stat()
+		if err != nil {
+			return "", "", err
+		}
+		readerAt, size = f, info.Size()
+	} else {
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return "", "", err
+		}
+		readerAt, size = bytes.NewReader(data), int64(len(data))
+	}
+
+	zipHash := sha256.New()
+	if _, err := io.Copy(zipHash, io.NewSectionReader(readerAt, 0, size)); err != nil {
+		return "", "", err
+	}
+
+	zr, err := zip.NewReader(readerAt, size)
+	if err != nil {
+		return "", "", err
+	}
+	h1, err = hashZipContents(zr)
+	if err != nil {
+		return "", "", err
+	}
+	return h1, "zh:" + hex.EncodeToString(zipHash.Sum(nil)), nil
+}
+
+// VerifyArchiveHashes checks a provider zip against the h1: and zh: hashes listed for it
+// Hashes of other schemes are ignored, at least one h1: or zh: hash must be listed
+func VerifyArchiveHashes(reader io.Reader, hashes []string) error {
+	h1, zh, err := archiveHashes(reader)
+	if err != nil {
+		return err
+	}
+	checked := 0
+	for _, hash := range hashes {
+		var computed string
+		switch {
+		case strings.HasPrefix(hash, "h1:"):
+			computed = h1
+		case strings.HasPrefix(hash, "zh:"):
+			computed = zh
+		default:
+			continue
+		}
+		if hash != computed {
+			return fmt.Errorf("hash mismatch: listed %s, archive has %s", hash, computed)
+		}
+		checked++
+	}
+	if checked == 0 {
+		return errors.New("no h1: or zh: hash listed")
+	}
+	return nil
+}
+
+// hashZipContents computes the h1: hash Terraform uses for provider packages
+// It is the dirhash Hash1 scheme: a SHA-256 over the sorted "sha256  name" lines of every file
+func hashZipContents(zr *zip.Reader) (string, error) {
+	files := slices.Clone(zr.File)
+	slices.SortFunc(files, func(a, b *zip.File) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	summary := sha256.New()
+	for _, file := range files {
+		if strings.Contains(file.Name, "\n") {
+			return "", fmt.Errorf("file name contains a newline: %q", file.Name)
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return "", err
+		}
+		fileHash := sha256.New()
+		_, err = io.Copy(fileHash, rc)
+		rc.Close()
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(summary, "%x  %s\n", fileHash.Sum(nil), file.Name)
+	}
+	return "h1:" + base64.StdEncoding.EncodeToString(summary.Sum(nil)), nil
+}
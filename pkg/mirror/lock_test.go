@@ -0,0 +1,163 @@
+package mirror
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+// buildTestZip creates a provider zip, files are added in reverse name order to exercise sorting
+func buildTestZip(t *testing.T) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range []struct{ name, content string }{
+		{"terraform-provider-aws_v1.0.0", "provider binary"},
+		{"LICENSE", "MIT"},
+	} {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			t.Fatalf("failed to add %s to zip: %v", f.name, err)
+		}
+		w.Write([]byte(f.content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to close zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestArchiveHashes(t *testing.T) {
+	archive := buildTestZip(t)
+	sum := sha256.Sum256(archive)
+	wantZH := "zh:" + hex.EncodeToString(sum[:])
+	// Computed with: sha256sum LICENSE terraform-provider-aws_v1.0.0 | sha256sum | xxd -r -p | base64
+	wantH1 := "h1:1WlH3G5AMkFB5+8+r7WQZG7NpcfS7PE0FNawR+jdQn8="
+
+	h1, zh, err := archiveHashes(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatalf("archiveHashes failed: %v", err)
+	}
+	if h1 != wantH1 || zh != wantZH {
+		t.Errorf("archiveHashes = %s, %s, want %s, %s", h1, zh, wantH1, wantZH)
+	}
+
+	// Files are hashed in place instead of being read into memory
+	path := filepath.Join(t.TempDir(), "archive.zip")
+	if err := os.WriteFile(path, archive, 0644); err != nil {
+		t.Fatalf("failed to write archive: %v", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open archive: %v", err)
+	}
+	defer f.Close()
+	h1, zh, err = archiveHashes(f)
+	if err != nil || h1 != wantH1 || zh != wantZH {
+		t.Errorf("archiveHashes of file = %s, %s, %v", h1, zh, err)
+	}
+
+	if _, _, err := archiveHashes(bytes.NewReader([]byte("not a zip"))); err == nil {
+		t.Error("expected error for invalid zip")
+	}
+}
+
+func TestVerifyArchiveHashes(t *testing.T) {
+	archive := buildTestZip(t)
+	h1, zh, err := archiveHashes(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatalf("archiveHashes failed: %v", err)
+	}
+
+	if err := VerifyArchiveHashes(bytes.NewReader(archive), []string{h1, zh, "h9:unknown"}); err != nil {
+		t.Errorf("VerifyArchiveHashes of listed hashes failed: %v", err)
+	}
+	if err := VerifyArchiveHashes(bytes.NewReader(archive), []string{h1, "zh:0000"}); err == nil {
+		t.Error("VerifyArchiveHashes accepted a wrong zh: hash")
+	}
+	if err := VerifyArchiveHashes(bytes.NewReader(archive), []string{"h9:unknown"}); err == nil {
+		t.Error("VerifyArchiveHashes accepted an archive without h1: or zh: hashes")
+	}
+}
+
+func TestLockHashes(t *testing.T) {
+	mockStorage := NewMockStorage()
+	archive := buildTestZip(t)
+	h1, zh, _ := archiveHashes(bytes.NewReader(archive))
+
+	mockStorage.versions["registry.terraform.io/hashicorp/aws/1.0.0"] = []byte(`{"archives":{
+		"linux_amd64":{"url":"http://localhost:8080/download/registry.terraform.io/hashicorp/aws/1.0.0/linux/amd64/terraform-provider-aws_1.0.0_linux_amd64.zip"},
+		"darwin_arm64":{"url":"http://localhost:8080/download/registry.terraform.io/hashicorp/aws/1.0.0/darwin/arm64/terraform-provider-aws_1.0.0_darwin_arm64.zip","hashes":["h1:upstream="]}
+	}}`)
+	mockStorage.archives["registry.terraform.io/hashicorp/aws/terraform-provider-aws_1.0.0_linux_amd64.zip"] = archive
+
+	mirror := NewMirror(mockStorage, nil, "http://localhost:8080")
+	hashes, err := mirror.LockHashes(context.Background(), "registry.terraform.io", "hashicorp", "aws", "1.0.0")
+	if err != nil {
+		t.Fatalf("LockHashes failed: %v", err)
+	}
+
+	want := []string{h1, "h1:upstream=", zh}
+	slices.Sort(want)
+	if !slices.Equal(hashes, want) {
+		t.Errorf("LockHashes = %v, want %v", hashes, want)
+	}
+
+	// Without cached archives or published hashes there is nothing to lock
+	mockStorage.versions["registry.terraform.io/hashicorp/aws/2.0.0"] = []byte(`{"archives":{
+		"linux_amd64":{"url":"http://localhost:8080/download/registry.terraform.io/hashicorp/aws/2.0.0/linux/amd64/terraform-provider-aws_2.0.0_linux_amd64.zip"}
+	}}`)
+	if _, err := mirror.LockHashes(context.Background(), "registry.terraform.io", "hashicorp", "aws", "2.0.0"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestPrecomputeHashes(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	ctx := context.Background()
+	archive := buildTestZip(t)
+	h1, zh, _ := archiveHashes(bytes.NewReader(archive))
+	archivePath := "registry.terraform.io/hashicorp/aws/terraform-provider-aws_1.0.0_linux_amd64.zip"
+
+	store.PutIndex(ctx, "registry.terraform.io", "hashicorp", "aws", []byte(`{"versions":{"1.0.0":{}}}`))
+	store.PutVersion(ctx, "registry.terraform.io", "hashicorp", "aws", "1.0.0", []byte(`{"archives":{
+		"linux_amd64":{"url":"http://localhost:8080/download/registry.terraform.io/hashicorp/aws/1.0.0/linux/amd64/terraform-provider-aws_1.0.0_linux_amd64.zip"},
+		"darwin_arm64":{"url":"http://localhost:8080/download/registry.terraform.io/hashicorp/aws/1.0.0/darwin/arm64/terraform-provider-aws_1.0.0_darwin_arm64.zip"}
+	}}`))
+	store.PutArchive(ctx, archivePath, bytes.NewReader(archive))
+
+	mirror := NewMirror(store, nil, "http://localhost:8080")
+	// Archives that are not cached are skipped
+	hashed, err := mirror.PrecomputeHashes(ctx)
+	if err != nil || hashed != 1 {
+		t.Fatalf("PrecomputeHashes = %d, %v, want 1, nil", hashed, err)
+	}
+	recorded, err := store.ArchiveHashes(ctx, archivePath)
+	if err != nil || !slices.Equal(recorded, []string{h1, zh}) {
+		t.Errorf("recorded hashes = %v, %v, want %v", recorded, err, []string{h1, zh})
+	}
+
+	// Recorded hashes are used as long as they match the cached archive
+	store.PutArchiveHashes(ctx, archivePath, []string{"h1:recorded=", zh})
+	hashes, err := mirror.LockHashes(ctx, "registry.terraform.io", "hashicorp", "aws", "1.0.0")
+	if err != nil || !slices.Equal(hashes, []string{"h1:recorded=", zh}) {
+		t.Errorf("LockHashes = %v, %v, want recorded hashes", hashes, err)
+	}
+
+	// Replacing the archive drops them
+	store.PutArchive(ctx, archivePath, bytes.NewReader(archive))
+	hashes, err = mirror.LockHashes(ctx, "registry.terraform.io", "hashicorp", "aws", "1.0.0")
+	if err != nil || !slices.Equal(hashes, []string{h1, zh}) {
+		t.Errorf("LockHashes = %v, %v, want %v", hashes, err, []string{h1, zh})
+	}
+}
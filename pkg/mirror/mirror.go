@@ -0,0 +1,600 @@
+// Package mirror implements the cache-or-fetch logic of a Terraform provider network mirror
+// It can be embedded in other services together with a storage backend from the storage package
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+// Mirror handles caching and proxying of Terraform providers
+type Mirror struct {
+	storage  storage.Storage
+	upstream *UpstreamClient
+	baseURL  string
+
+	// passthrough serves archive cache misses straight from upstream without storing them
+	passthrough atomic.Bool
+
+	policies  CachePolicies
+	ttl       MetadataTTL
+	withdrawn WithdrawnVersions
+	// strictIndex lists only versions with a cached archive in index.json
+	strictIndex bool
+	// verifyShasums checks cached archives against the registry shasum before serving them
+	verifyShasums bool
+	// redirectExpiry is how long archive URLs handed out by ArchiveURL are valid, zero disables them
+	redirectExpiry time.Duration
+	// passthroughProviders never read from or write to the cache
+	passthroughProviders ProviderRules[bool]
+	// pending tracks write-back cache writes still running in the background
+	pending sync.WaitGroup
+
+	// retrier retries failed cache writes in the background, nil when they are only logged
+	retrier *WriteRetrier
+}
+
+// NewMirror creates a new mirror service
+func NewMirror(store storage.Storage, upstream *UpstreamClient, baseURL string) *Mirror {
+	return &Mirror{
+		storage:  store,
+		upstream: upstream,
+		baseURL:  baseURL,
+	}
+}
+
+// SetPassthrough enables or disables passthrough mode
+// In passthrough mode archives missing from the cache are streamed from upstream without being cached
+func (m *Mirror) SetPassthrough(enabled bool) {
+	m.passthrough.Store(enabled)
+}
+
+// Passthrough reports whether passthrough mode is enabled
+func (m *Mirror) Passthrough() bool {
+	return m.passthrough.Load()
+}
+
+// UpstreamHealth returns the health of the probed upstream registries
+// Returns nil when no health monitor is set on the upstream client
+func (m *Mirror) UpstreamHealth() []UpstreamHealth {
+	if m.upstream == nil {
+		return nil
+	}
+	return m.upstream.Health()
+}
+
+// Services returns the service discovery document of a registry with relative URLs resolved against it
+func (m *Mirror) Services(ctx context.Context, hostname string) (map[string]json.RawMessage, error) {
+	if m.upstream == nil {
+		return nil, ErrNotFound
+	}
+	discovery, err := m.upstream.DiscoveryCache().DiscoverServices(ctx, hostname)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUpstreamUnavailable, err)
+	}
+	return discovery.ResolvedServices(), nil
+}
+
+// GetIndex returns the index for a provider, using cache or fetching from upstream
+// Versions withdrawn upstream are left out when their policy hides them, and versions without
+// a cached archive in strict index mode. The cache keeps every version
+func (m *Mirror) GetIndex(ctx context.Context, hostname, namespace, providerType string) ([]byte, error) {
+	data, err := m.getIndex(ctx, hostname, namespace, providerType)
+	if err != nil {
+		return nil, err
+	}
+	data, err = m.hideWithdrawn(data, hostname, namespace, providerType)
+	if err != nil || !m.strictIndex || m.bypassCache(hostname, namespace, providerType) {
+		return data, err
+	}
+	return m.onlyCached(ctx, data, hostname, namespace, providerType)
+}
+
+// getIndex returns the full index for a provider, using cache or fetching from upstream
+func (m *Mirror) getIndex(ctx context.Context, hostname, namespace, providerType string) ([]byte, error) {
+	// Try to get from cache
+	cachedData, err := m.storage.GetIndex(ctx, hostname, namespace, providerType)
+	if err == nil && !m.bypassCache(hostname, namespace, providerType) && !RefreshRequested(ctx) {
+		if !m.indexExpired(ctx, hostname, namespace, providerType) {
+			return cachedData, nil
+		}
+		// Expired, the cached copy is still better than an error if upstream is unavailable
+		data, _, err := m.fetchIndex(ctx, hostname, namespace, providerType)
+		if err != nil {
+			slog.WarnContext(ctx, "failed to refresh expired index, serving cached copy",
+				"hostname", hostname, "namespace", namespace, "type", providerType, "err", err)
+			return cachedData, nil
+		}
+		return data, nil
+	}
+
+	// Cache miss, fetch from upstream
+	data, _, err := m.fetchIndex(ctx, hostname, namespace, providerType)
+	return data, err
+}
+
+// fetchIndex fetches the index from upstream and caches it according to the index cache policy
+// It also returns the full registry versions response, nil for mirror protocol upstreams
+func (m *Mirror) fetchIndex(ctx context.Context, hostname, namespace, providerType string) ([]byte, *RegistryVersionsResponse, error) {
+	indexResponse, versionsResponse, err := m.upstream.FetchIndex(ctx, hostname, namespace, providerType)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Marshal index response to JSON
+	data, err := json.Marshal(indexResponse)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal index response: %w", err)
+	}
+
+	// Store index in cache (errors are logged)
+	policy := m.policy(m.policies.Index, hostname, namespace, providerType)
+	info := metadataInfo(data)
+	m.store(ctx, policy, func(ctx context.Context, s storage.Storage) error {
+		if err := s.PutIndex(ctx, hostname, namespace, providerType, data); err != nil {
+			return err
+		}
+		recordEntry(ctx, s, storage.IndexEntry(hostname, namespace, providerType), info)
+		return nil
+	}, "failed to cache index", "hostname", hostname, "namespace", namespace, "type", providerType)
+
+	// Also cache the full versions response if available
+	if versionsResponse != nil {
+		versionsData, err := json.Marshal(versionsResponse)
+		if err == nil {
+			m.store(ctx, policy, func(ctx context.Context, s storage.Storage) error {
+				return s.PutVersionsResponse(ctx, hostname, namespace, providerType, versionsData)
+			}, "failed to cache versions response", "hostname", hostname, "namespace", namespace, "type", providerType)
+		}
+	}
+
+	return data, versionsResponse, nil
+}
+
+// GetVersion returns the version for a provider, using cache or fetching from upstream
+// It also rewrites archive URLs to point to this mirror
+func (m *Mirror) GetVersion(ctx context.Context, hostname, namespace, providerType, version string) ([]byte, error) {
+	if err := m.CheckWithdrawn(ctx, hostname, namespace, providerType, version); err != nil {
+		return nil, err
+	}
+
+	// Try to get from cache
+	cachedData, err := m.storage.GetVersion(ctx, hostname, namespace, providerType, version)
+	if err == nil && !m.bypassCache(hostname, namespace, providerType) && !RefreshRequested(ctx) {
+		// Return cached data (URLs are already correct from when we built it)
+		return cachedData, nil
+	}
+
+	// Cache miss, try to fetch from upstream
+	response, err := m.upstream.FetchVersion(ctx, hostname, namespace, providerType, version)
+	if err != nil {
+		// If upstream returns ErrNotFound, build from cached versions response
+		if errors.Is(err, ErrNotFound) {
+			data, buildErr := m.buildVersionFromCache(ctx, hostname, namespace, providerType, version)
+			// If versions cache is empty, fetch the index first to populate it
+			if buildErr != nil && !errors.Is(buildErr, ErrNotFound) {
+				slog.DebugContext(ctx, "versions cache empty, fetching index first",
+					"hostname", hostname,
+					"namespace", namespace,
+					"type", providerType,
+					"version", version)
+				// Build from the fetched response, it is not in the cache yet with write-back or no-store
+				if _, versionsResp, indexErr := m.fetchIndex(ctx, hostname, namespace, providerType); indexErr == nil && versionsResp != nil {
+					data, buildErr = m.buildVersion(ctx, hostname, namespace, providerType, version, versionsResp)
+				}
+			}
+			if buildErr != nil {
+				return nil, buildErr
+			}
+			return data, nil
+		}
+		return nil, err
+	}
+
+	// Marshal response to JSON
+	data, err := json.Marshal(response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal version response: %w", err)
+	}
+
+	// Rewrite archive URLs to point to this mirror
+	rewritten, err := m.rewriteArchiveURLs(ctx, hostname, namespace, providerType, version, data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Store rewritten response in cache (errors are logged)
+	info := metadataInfo(rewritten)
+	m.store(ctx, m.policy(m.policies.Version, hostname, namespace, providerType), func(ctx context.Context, s storage.Storage) error {
+		if err := s.PutVersion(ctx, hostname, namespace, providerType, version, rewritten); err != nil {
+			return err
+		}
+		recordEntry(ctx, s, storage.VersionEntry(hostname, namespace, providerType, version), info)
+		return nil
+	}, "failed to cache rewritten version", "hostname", hostname, "namespace", namespace, "type", providerType, "version", version)
+
+	return rewritten, nil
+}
+
+// buildVersionFromCache builds a version.json response from the cached versions response
+// This avoids making multiple API calls to the upstream registry
+func (m *Mirror) buildVersionFromCache(ctx context.Context, hostname, namespace, providerType, version string) ([]byte, error) {
+	// A refresh builds from a fresh versions response instead
+	if m.bypassCache(hostname, namespace, providerType) || RefreshRequested(ctx) {
+		return nil, errCacheBypassed
+	}
+
+	// Get cached versions response
+	versionsData, err := m.storage.GetVersionsResponse(ctx, hostname, namespace, providerType)
+	if err != nil {
+		return nil, fmt.Errorf("no cached versions response available: %w", err)
+	}
+
+	// Parse versions response
+	var versionsResp RegistryVersionsResponse
+	if err := json.Unmarshal(versionsData, &versionsResp); err != nil {
+		return nil, fmt.Errorf("failed to parse versions response: %w", err)
+	}
+
+	return m.buildVersion(ctx, hostname, namespace, providerType, version, &versionsResp)
+}
+
+// buildVersion builds a version.json response from a registry versions response and caches it
+func (m *Mirror) buildVersion(ctx context.Context, hostname, namespace, providerType, version string, versionsResp *RegistryVersionsResponse) ([]byte, error) {
+	// Find requested version
+	var platforms []RegistryPlatform
+	var protocols []string
+	for _, v := range versionsResp.Versions {
+		if v.Version == version {
+			platforms = v.Platforms
+			protocols = v.Protocols
+			break
+		}
+	}
+
+	if len(platforms) == 0 {
+		return nil, ErrNotFound
+	}
+
+	// Hashes are optional, archives are listed without them when SHA256SUMS is unavailable
+	shasums := m.upstreamShasums(ctx, hostname, namespace, providerType, version, platforms[0])
+
+	response := &VersionResponse{
+		Archives:  make(map[string]Archive),
+		Protocols: protocols,
+	}
+
+	for _, platform := range platforms {
+		platformKey := buildPlatformKey(platform.OS, platform.Arch)
+		filename := buildProviderFilename(providerType, version, platform.OS, platform.Arch)
+
+		// Build URL pointing to mirror's download endpoint
+		archiveURL := m.buildDownloadURL(hostname, namespace, providerType, version, platform.OS, platform.Arch, filename)
+
+		var hashes []string
+		if sum, ok := shasums[filename]; ok {
+			hashes = []string{"zh:" + sum}
+		}
+		response.Archives[platformKey] = Archive{
+			URL:    archiveURL,
+			Hashes: hashes,
+		}
+	}
+
+	// Marshal and cache
+	data, err := json.Marshal(response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal version response: %w", err)
+	}
+
+	// Store in cache (errors are logged)
+	info := metadataInfo(data)
+	m.store(ctx, m.policy(m.policies.Version, hostname, namespace, providerType), func(ctx context.Context, s storage.Storage) error {
+		if err := s.PutVersion(ctx, hostname, namespace, providerType, version, data); err != nil {
+			return err
+		}
+		recordEntry(ctx, s, storage.VersionEntry(hostname, namespace, providerType, version), info)
+		return nil
+	}, "failed to cache version from cache build", "hostname", hostname, "namespace", namespace, "type", providerType, "version", version)
+
+	return data, nil
+}
+
+// upstreamShasums fetches the SHA256SUMS file published for a provider version
+// The download response of any platform links to it. Failures are logged and return nil
+func (m *Mirror) upstreamShasums(ctx context.Context, hostname, namespace, providerType, version string, platform RegistryPlatform) map[string]string {
+	info, err := m.upstream.FetchDownloadURL(ctx, hostname, namespace, providerType, version, platform.OS, platform.Arch)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to fetch download info for SHA256SUMS", "hostname", hostname, "namespace", namespace, "type", providerType, "version", version, "err", err)
+		return nil
+	}
+	if info.ShasumsURL == "" {
+		return nil
+	}
+
+	shasums, err := m.upstream.FetchShasums(ctx, info.ShasumsURL)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to fetch SHA256SUMS", "hostname", hostname, "namespace", namespace, "type", providerType, "version", version, "err", err)
+		return nil
+	}
+	return shasums
+}
+
+// GetArchive returns a provider archive, using cache or fetching from upstream on-demand
+// Takes explicit parameters for on-demand fetching instead of relying on stored URLs
+func (m *Mirror) GetArchive(ctx context.Context, hostname, namespace, providerType, version, os, arch, archivePath string) (io.ReadCloser, error) {
+	if err := m.CheckWithdrawn(ctx, hostname, namespace, providerType, version); err != nil {
+		return nil, err
+	}
+
+	// Try to get from cache
+	bypass := m.bypassCache(hostname, namespace, providerType)
+	if !bypass {
+		var reader io.ReadCloser
+		var err error
+		if m.verifyShasums {
+			reader, err = m.verifiedArchive(ctx, hostname, namespace, providerType, version, os, arch, archivePath)
+		} else {
+			reader, err = m.storage.GetArchive(ctx, archivePath)
+		}
+		if err == nil {
+			return reader, nil
+		}
+	}
+
+	// Cache miss - fetch download URL from registry API
+	downloadInfo, err := m.upstream.FetchDownloadURL(ctx, hostname, namespace, providerType, version, os, arch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get download URL: %w", err)
+	}
+
+	// Fetch archive from upstream
+	archiveReader, err := m.upstream.FetchArchive(ctx, downloadInfo.DownloadURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch archive: %w", err)
+	}
+
+	// Serve directly from upstream when caching is suspended
+	if bypass || m.Passthrough() || m.policies.Archive == CacheNoStore {
+		return archiveReader, nil
+	}
+	if m.policies.Archive == CacheWriteBack {
+		return m.writeBackArchive(ctx, archivePath, archiveReader, downloadInfo.Shasum, func(err error) {
+			m.retryArchive(err, hostname, namespace, providerType, version, os, arch, archivePath)
+		}), nil
+	}
+	defer archiveReader.Close()
+
+	// Stream archive directly into cache to avoid holding entire file in memory
+	if err := m.storage.PutArchive(ctx, archivePath, archiveReader); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrQuotaExceeded):
+			// The namespace is out of cache space, serve this archive without caching it
+			slog.WarnContext(ctx, "archive not cached", "path", archivePath, "err", err)
+			var rejected *storage.QuotaExceededError
+			if errors.As(err, &rejected) && rejected.Archive != nil {
+				return rejected.Archive, nil
+			}
+			return m.upstream.FetchArchive(ctx, downloadInfo.DownloadURL)
+		case errors.Is(err, ErrUpstreamUnavailable):
+			return nil, fmt.Errorf("failed to fetch archive: %w", err)
+		default:
+			m.retryArchive(err, hostname, namespace, providerType, version, os, arch, archivePath)
+			return nil, fmt.Errorf("%w: failed to cache archive: %w", ErrStorageFailure, err)
+		}
+	}
+
+	if err := m.commitArchive(ctx, archivePath, archiveReader, downloadInfo.Shasum); err != nil {
+		return nil, err
+	}
+
+	// Return cached file
+	reader, err := m.storage.GetArchive(ctx, archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read cached archive: %w", ErrStorageFailure, err)
+	}
+	return reader, nil
+}
+
+// commitArchive finishes caching an archive fetched from src, once it has been put in the storage
+// The registry shasum is recorded with the entry. When verifying shasums, an archive that does not match
+// the registry shasum is evicted instead and an error returned
+func (m *Mirror) commitArchive(ctx context.Context, archivePath string, src io.Reader, registryShasum string) error {
+	info := archiveInfo(src)
+	info.RegistryShasum = registryShasum
+	if m.verifyShasums && registryShasum != "" {
+		got, err := m.storedShasum(ctx, archivePath)
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(got, registryShasum) {
+			if err := m.storage.DeleteArchive(ctx, archivePath); err != nil {
+				slog.WarnContext(ctx, "failed to evict corrupted archive", "path", archivePath, "err", err)
+			}
+			return fmt.Errorf("%w: archive %s does not match the registry shasum", ErrUpstreamUnavailable, archivePath)
+		}
+	}
+	recordEntry(ctx, m.storage, archivePath, info)
+	return nil
+}
+
+// ArchiveChecksum returns the recorded SHA-256 of a cached archive
+// Returns storage.ErrNotFound if the archive is not cached, its provider bypasses the cache or the storage does not record checksums
+func (m *Mirror) ArchiveChecksum(ctx context.Context, archivePath string) (string, error) {
+	reporter, ok := storage.As[storage.ChecksumReporter](m.storage)
+	if !ok || m.bypassArchive(archivePath) {
+		return "", storage.ErrNotFound
+	}
+	return reporter.ArchiveChecksum(ctx, archivePath)
+}
+
+// DiskUsage returns the capacity and usage of the disk holding the cache
+// Returns storage.ErrNotFound if the storage does not live on a disk
+func (m *Mirror) DiskUsage(ctx context.Context) (storage.DiskUsage, error) {
+	reporter, ok := storage.As[storage.UsageReporter](m.storage)
+	if !ok {
+		return storage.DiskUsage{}, storage.ErrNotFound
+	}
+	return reporter.DiskUsage(ctx)
+}
+
+// CheckStorage checks the cache storage can serve and store entries and returns how long the check took
+// Returns storage.ErrNotFound if the storage cannot be checked
+func (m *Mirror) CheckStorage(ctx context.Context) (time.Duration, error) {
+	checker, ok := storage.As[storage.HealthChecker](m.storage)
+	if !ok {
+		return 0, storage.ErrNotFound
+	}
+	start := time.Now()
+	err := checker.HealthCheck(ctx)
+	return time.Since(start), err
+}
+
+// Backup writes a backup of the cache to w, as `specular backup` does, and returns its manifest
+// Returns storage.ErrNotFound if the storage cannot be backed up
+func (m *Mirror) Backup(ctx context.Context, w io.Writer, opts storage.BackupOptions) (storage.BackupManifest, error) {
+	backuper, ok := storage.As[storage.Backuper](m.storage)
+	if !ok {
+		return storage.BackupManifest{}, storage.ErrNotFound
+	}
+	return backuper.Backup(ctx, w, opts)
+}
+
+// IndexModTime returns when the index for a provider was cached, for the date validators of index.json
+// Returns storage.ErrNotFound if the index is not cached, its provider bypasses the cache or the storage does not track
+// modification times. So does an index past its TTL, which is fetched again, and strict index mode, where the index
+// served changes with the cached archives
+func (m *Mirror) IndexModTime(ctx context.Context, hostname, namespace, providerType string) (time.Time, error) {
+	if m.strictIndex || m.indexExpired(ctx, hostname, namespace, providerType) {
+		return time.Time{}, storage.ErrNotFound
+	}
+	return m.indexWritten(ctx, hostname, namespace, providerType)
+}
+
+// indexWritten returns when the index for a provider was cached
+func (m *Mirror) indexWritten(ctx context.Context, hostname, namespace, providerType string) (time.Time, error) {
+	reporter, ok := storage.As[storage.ModTimeReporter](m.storage)
+	if !ok || m.bypassCache(hostname, namespace, providerType) {
+		return time.Time{}, storage.ErrNotFound
+	}
+	return reporter.IndexModTime(ctx, hostname, namespace, providerType)
+}
+
+// VersionModTime returns when the version for a provider was cached
+// Returns storage.ErrNotFound if the version is not cached, its provider bypasses the cache or the storage does not track modification times
+func (m *Mirror) VersionModTime(ctx context.Context, hostname, namespace, providerType, version string) (time.Time, error) {
+	reporter, ok := storage.As[storage.ModTimeReporter](m.storage)
+	if !ok || m.bypassCache(hostname, namespace, providerType) {
+		return time.Time{}, storage.ErrNotFound
+	}
+	return reporter.VersionModTime(ctx, hostname, namespace, providerType, version)
+}
+
+// ArchiveModTime returns when an archive was cached
+// Returns storage.ErrNotFound if the archive is not cached, its provider bypasses the cache or the storage does not track modification times
+func (m *Mirror) ArchiveModTime(ctx context.Context, archivePath string) (time.Time, error) {
+	reporter, ok := storage.As[storage.ModTimeReporter](m.storage)
+	if !ok || m.bypassArchive(archivePath) {
+		return time.Time{}, storage.ErrNotFound
+	}
+	return reporter.ArchiveModTime(ctx, archivePath)
+}
+
+// rewriteArchiveURLs rewrites archive URLs to point to this mirror
+// For mirror protocol registries only (not used for service discovery-based registries)
+func (m *Mirror) rewriteArchiveURLs(ctx context.Context, hostname, namespace, providerType, version string, data []byte) ([]byte, error) {
+	var response VersionResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse version response: %w", err)
+	}
+
+	// Rewrite URLs to point to mirror's download endpoint
+	for platform, archive := range response.Archives {
+		if archive.URL != "" {
+			// Extract just the filename from the original URL
+			filename := m.extractFilename(archive.URL)
+
+			// Parse OS/arch from platform key (e.g., "linux_amd64" -> linux, amd64)
+			os, arch, err := parsePlatformKey(platform)
+			if err != nil {
+				slog.Warn("invalid platform key format", "platform", platform, "err", err)
+				continue
+			}
+
+			// Build URL pointing to download endpoint
+			archiveURL := m.buildDownloadURL(hostname, namespace, providerType, version, os, arch, filename)
+
+			// Keep upstream hashes if present (but don't compute our own)
+			archive.URL = archiveURL
+			response.Archives[platform] = archive
+		}
+	}
+
+	// Marshal back to JSON
+	rewritten, err := json.Marshal(response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal rewritten response: %w", err)
+	}
+
+	return rewritten, nil
+}
+
+// extractFilename extracts just the filename from an archive URL
+// For example: https://releases.hashicorp.com/terraform-provider-aws/5.0.0/terraform-provider-aws_5.0.0_linux_amd64.zip
+// Returns: terraform-provider-aws_5.0.0_linux_amd64.zip
+func (m *Mirror) extractFilename(archiveURL string) string {
+	u, err := url.Parse(archiveURL)
+	if err != nil {
+		// Fall back to extracting from string
+		parts := strings.Split(archiveURL, "/")
+		if len(parts) > 0 {
+			return parts[len(parts)-1]
+		}
+		return archiveURL
+	}
+
+	// Get the last component of the path
+	base := path.Base(u.Path)
+	if base == "." || base == "/" || base == "" {
+		return "archive.zip"
+	}
+	return base
+}
+
+// buildDownloadURL constructs a download URL for a provider archive
+func (m *Mirror) buildDownloadURL(hostname, namespace, providerType, version, os, arch, filename string) string {
+	return fmt.Sprintf("%s/download/%s/%s/%s/%s/%s/%s/%s",
+		strings.TrimSuffix(m.baseURL, "/"),
+		hostname, namespace, providerType, version, os, arch, filename)
+}
+
+// buildPlatformKey constructs a platform key from OS and architecture
+func buildPlatformKey(os, arch string) string {
+	return fmt.Sprintf("%s_%s", os, arch)
+}
+
+// buildProviderFilename constructs a provider archive filename
+func buildProviderFilename(providerType, version, os, arch string) string {
+	return fmt.Sprintf("terraform-provider-%s_%s_%s_%s.zip", providerType, version, os, arch)
+}
+
+// parsePlatformKey parses a platform key (e.g., "linux_amd64") into OS and architecture
+func parsePlatformKey(platform string) (os, arch string, err error) {
+	parts := strings.Split(platform, "_")
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("invalid platform key format: %s", platform)
+	}
+	return parts[0], parts[1], nil
+}
@@ -3,6 +3,8 @@ package mirror
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -12,6 +14,9 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/elisiariocouto/specular/pkg/registrytest"
+	"github.com/elisiariocouto/specular/pkg/storage"
 )
 
 // MockStorage implements the Storage interface for testing
@@ -118,6 +123,62 @@ func (m *MockStorage) ExistsArchive(ctx context.Context, path string) (bool, err
 	return ok, nil
 }
 
+func (m *MockStorage) DeleteIndex(ctx context.Context, hostname, namespace, providerType string) error {
+	delete(m.indices, fmt.Sprintf("%s/%s/%s/index", hostname, namespace, providerType))
+	delete(m.versionsResponses, fmt.Sprintf("%s/%s/%s/versions", hostname, namespace, providerType))
+	return nil
+}
+
+func (m *MockStorage) DeleteVersion(ctx context.Context, hostname, namespace, providerType, version string) error {
+	delete(m.versions, fmt.Sprintf("%s/%s/%s/%s", hostname, namespace, providerType, version))
+	return nil
+}
+
+func (m *MockStorage) DeleteArchive(ctx context.Context, path string) error {
+	delete(m.archives, path)
+	return nil
+}
+
+func (m *MockStorage) PurgeProvider(ctx context.Context, hostname, namespace, providerType string) error {
+	prefix := fmt.Sprintf("%s/%s/%s/", hostname, namespace, providerType)
+	for _, entries := range []map[string][]byte{m.indices, m.versions, m.versionsResponses, m.archives} {
+		for key := range entries {
+			if strings.HasPrefix(key, prefix) {
+				delete(entries, key)
+			}
+		}
+	}
+	return nil
+}
+
+func (m *MockStorage) ListProviders(ctx context.Context) ([]storage.Provider, error) {
+	var providers []storage.Provider
+	for key := range m.indices {
+		parts := strings.Split(key, "/")
+		providers = append(providers, storage.Provider{Hostname: parts[0], Namespace: parts[1], Type: parts[2]})
+	}
+	return providers, nil
+}
+
+func (m *MockStorage) ListVersions(ctx context.Context, hostname, namespace, providerType string) ([]string, error) {
+	prefix := fmt.Sprintf("%s/%s/%s/", hostname, namespace, providerType)
+	var versions []string
+	for key := range m.versions {
+		if version, ok := strings.CutPrefix(key, prefix); ok {
+			versions = append(versions, version)
+		}
+	}
+	return versions, nil
+}
+
+func (m *MockStorage) StatArchive(ctx context.Context, path string) (storage.ArchiveInfo, error) {
+	data, ok := m.archives[path]
+	if !ok {
+		return storage.ArchiveInfo{}, io.EOF
+	}
+	return storage.ArchiveInfo{Size: int64(len(data))}, nil
+}
+
 func newTestUpstreamClientForMirror(server *httptest.Server) *UpstreamClient {
 	client := server.Client()
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
@@ -130,6 +191,19 @@ func newTestUpstreamClientForMirror(server *httptest.Server) *UpstreamClient {
 	}
 }
 
+// newRegistryTestMirror returns a mirror backed by store and a fake upstream registry
+// Use the registry's Hostname as the provider hostname
+func newRegistryTestMirror(t *testing.T, store storage.Storage) (*Mirror, *registrytest.Server) {
+	t.Helper()
+
+	registry := registrytest.NewServer()
+	t.Cleanup(registry.Close)
+
+	upstream := NewUpstreamClient(10*time.Second, 2, time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	upstream.SetHTTPClient(registry.Client())
+	return NewMirror(store, upstream, "http://localhost:8080"), registry
+}
+
 // TestGetIndex_CacheHit tests that GetIndex returns cached data without fetching upstream
 func TestGetIndex_CacheHit(t *testing.T) {
 	mockStorage := NewMockStorage()
@@ -161,43 +235,41 @@ func TestGetIndex_CacheHit(t *testing.T) {
 // TestGetIndex_CacheMiss_FetchUpstream tests that GetIndex fetches and caches from upstream on miss
 func TestGetIndex_CacheMiss_FetchUpstream(t *testing.T) {
 	mockStorage := NewMockStorage()
+	mirror, registry := newRegistryTestMirror(t, mockStorage)
+	registry.AddPackage("hashicorp", "aws", "1.0.0", "linux", "amd64", []byte("archive"))
+	hostname := registry.Hostname()
 
-	versionsResp := RegistryVersionsResponse{
-		Versions: []RegistryVersion{
-			{
-				Version: "1.0.0",
-				Platforms: []RegistryPlatform{
-					{OS: "linux", Arch: "amd64"},
-				},
-			},
-		},
+	data, err := mirror.GetIndex(context.Background(), hostname, "hashicorp", "aws")
+	if err != nil {
+		t.Fatalf("GetIndex failed: %v", err)
 	}
 
-	// This test verifies that when cache misses, upstream is called and result is cached
-	// We'll use memory storage to verify caching behavior works
-	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(versionsResp)
-	}))
-	defer server.Close()
-
-	upstream := newTestUpstreamClientForMirror(server)
-	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080")
-
-	hostname, namespace, providerType := "registry.terraform.io", "hashicorp", "aws"
+	var index IndexResponse
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatalf("failed to parse index: %v", err)
+	}
+	if _, ok := index.Versions["1.0.0"]; !ok || len(index.Versions) != 1 {
+		t.Errorf("GetIndex versions = %v, want only 1.0.0", index.Versions)
+	}
+	if got := index.Versions["1.0.0"].Protocols; len(got) != 1 || got[0] != "5.0" {
+		t.Errorf("GetIndex protocols = %v, want [5.0]", got)
+	}
 
-	// On cache miss, GetIndex will try to fetch from upstream
-	// Since our mock upstream server will fail (no service discovery), we expect an error
-	// This test documents the expected behavior
-	_, err := mirror.GetIndex(context.Background(), hostname, namespace, providerType)
-	if err == nil {
-		t.Error("expected error when upstream is not properly configured")
-		return
+	// Both the index and the full versions response are cached
+	if cached, err := mockStorage.GetIndex(context.Background(), hostname, "hashicorp", "aws"); err != nil || !bytes.Equal(cached, data) {
+		t.Errorf("cached index = %q, %v, want %q", cached, err, data)
+	}
+	if _, err := mockStorage.GetVersionsResponse(context.Background(), hostname, "hashicorp", "aws"); err != nil {
+		t.Errorf("versions response was not cached: %v", err)
 	}
 
-	// The error is expected because the test server doesn't provide service discovery
-	// A real integration test would need a proper mock that implements service discovery
-	t.Logf("GetIndex failed as expected without service discovery: %v", err)
+	// A second call is served from the cache
+	if _, err := mirror.GetIndex(context.Background(), hostname, "hashicorp", "aws"); err != nil {
+		t.Fatalf("second GetIndex failed: %v", err)
+	}
+	if n := registry.Requests(registrytest.VersionsPath("hashicorp", "aws")); n != 1 {
+		t.Errorf("versions endpoint called %d times, want 1", n)
+	}
 }
 
 // TestGetIndex_UpstreamError tests that GetIndex returns error when upstream fails
@@ -245,43 +317,44 @@ func TestGetVersion_CacheHit(t *testing.T) {
 	}
 }
 
-// TestGetVersion_CacheMiss_FetchUpstream tests URL rewriting when fetching from upstream
+// TestGetVersion_CacheMiss_FetchUpstream tests that archive URLs point to the mirror when fetching from upstream
 func TestGetVersion_CacheMiss_FetchUpstream(t *testing.T) {
 	mockStorage := NewMockStorage()
+	mirror, registry := newRegistryTestMirror(t, mockStorage)
+	registry.AddPackage("hashicorp", "aws", "1.0.0", "linux", "amd64", []byte("archive"))
+	hostname := registry.Hostname()
 
-	upstreamVersion := VersionResponse{
-		Archives: map[string]Archive{
-			"linux_amd64": {
-				URL: "https://releases.hashicorp.com/terraform-provider-aws/1.0.0/terraform-provider-aws_1.0.0_linux_amd64.zip",
-			},
-		},
+	data, err := mirror.GetVersion(context.Background(), hostname, "hashicorp", "aws", "1.0.0")
+	if err != nil {
+		t.Fatalf("GetVersion failed: %v", err)
 	}
 
-	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(upstreamVersion)
-	}))
-	defer server.Close()
-
-	upstream := newTestUpstreamClientForMirror(server)
-	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080")
-
-	hostname, namespace, providerType, version := "registry.terraform.io", "hashicorp", "aws", "1.0.0"
-
-	// This will fail due to service discovery not being properly mocked
-	_, err := mirror.GetVersion(context.Background(), hostname, namespace, providerType, version)
-	if err == nil {
-		t.Error("expected error when upstream is not properly configured")
-		return
+	var version VersionResponse
+	if err := json.Unmarshal(data, &version); err != nil {
+		t.Fatalf("failed to parse version: %v", err)
+	}
+	wantURL := mirror.buildDownloadURL(hostname, "hashicorp", "aws", "1.0.0", "linux", "amd64", "terraform-provider-aws_1.0.0_linux_amd64.zip")
+	if got := version.Archives["linux_amd64"].URL; got != wantURL {
+		t.Errorf("archive URL = %q, want %q", got, wantURL)
+	}
+	if len(version.Protocols) != 1 || version.Protocols[0] != "5.0" {
+		t.Errorf("version protocols = %v, want [5.0]", version.Protocols)
+	}
+	sum := sha256.Sum256([]byte("archive"))
+	if got := version.Archives["linux_amd64"].Hashes; len(got) != 1 || got[0] != "zh:"+hex.EncodeToString(sum[:]) {
+		t.Errorf("archive hashes = %v, want the zh: hash from SHA256SUMS", got)
 	}
 
-	// The error is expected because the test server doesn't provide service discovery
-	t.Logf("GetVersion failed as expected without service discovery: %v", err)
+	if cached, err := mockStorage.GetVersion(context.Background(), hostname, "hashicorp", "aws", "1.0.0"); err != nil || !bytes.Equal(cached, data) {
+		t.Errorf("cached version = %q, %v, want %q", cached, err, data)
+	}
 }
 
 // TestGetVersion_BuildFromCache tests building version from cached versions response
 func TestGetVersion_BuildFromCache(t *testing.T) {
 	mockStorage := NewMockStorage()
+	mirror, registry := newRegistryTestMirror(t, mockStorage)
+	hostname := registry.Hostname()
 
 	// Create versions response that would be fetched from GetIndex
 	versionsResp := RegistryVersionsResponse{
@@ -296,26 +369,25 @@ func TestGetVersion_BuildFromCache(t *testing.T) {
 		},
 	}
 	versionsData, _ := json.Marshal(versionsResp)
-	mockStorage.PutVersionsResponse(context.Background(), "registry.terraform.io", "hashicorp", "aws", versionsData)
+	mockStorage.PutVersionsResponse(context.Background(), hostname, "hashicorp", "aws", versionsData)
 
-	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Return 404 to trigger the "build from cache" logic
-		w.WriteHeader(http.StatusNotFound)
-	}))
-	defer server.Close()
-
-	upstream := newTestUpstreamClientForMirror(server)
-	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080")
+	data, err := mirror.GetVersion(context.Background(), hostname, "hashicorp", "aws", "1.0.0")
+	if err != nil {
+		t.Fatalf("GetVersion failed: %v", err)
+	}
 
-	// This will fail due to service discovery not being configured
-	_, err := mirror.GetVersion(context.Background(), "registry.terraform.io", "hashicorp", "aws", "1.0.0")
-	if err == nil {
-		t.Error("expected error when upstream is not properly configured")
-		return
+	var version VersionResponse
+	if err := json.Unmarshal(data, &version); err != nil {
+		t.Fatalf("failed to parse version: %v", err)
+	}
+	if len(version.Archives) != 2 {
+		t.Errorf("expected 2 archives, got %d", len(version.Archives))
 	}
 
-	// The error is expected because the test server doesn't provide service discovery
-	t.Logf("GetVersion failed as expected without service discovery: %v", err)
+	// The registry has no such provider, so the version can only have come from the cache
+	if n := registry.Requests(registrytest.VersionsPath("hashicorp", "aws")); n != 0 {
+		t.Errorf("versions endpoint called %d times, want 0", n)
+	}
 }
 
 // TestGetVersion_NotFound tests error when version is not found
@@ -372,39 +444,15 @@ func TestGetArchive_CacheHit(t *testing.T) {
 // TestGetArchive_CacheMiss_FetchUpstream tests that GetArchive fetches and caches from upstream on miss
 func TestGetArchive_CacheMiss_FetchUpstream(t *testing.T) {
 	mockStorage := NewMockStorage()
-	archiveContent := []byte("provider archive data")
-
-	// Create a mock server that serves the archive download and the registry API
-	var serverURL string
-	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// For /v1/providers requests (registry API)
-		if strings.Contains(r.URL.Path, "v1/providers") || strings.Contains(r.URL.Path, "download") {
-			w.Header().Set("Content-Type", "application/json")
-			downloadURL := fmt.Sprintf("%s/file.zip", serverURL)
-			downloadInfo := DownloadInfo{DownloadURL: downloadURL}
-			json.NewEncoder(w).Encode(downloadInfo)
-		} else {
-			// For direct file downloads
-			w.Write(archiveContent)
-		}
-	}))
-	serverURL = server.URL
-	defer server.Close()
-
-	upstream := newTestUpstreamClientForMirror(server)
-	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080")
-
-	archivePath := "registry.terraform.io/hashicorp/aws/terraform-provider-aws_1.0.0_linux_amd64.zip"
+	mirror, registry := newRegistryTestMirror(t, mockStorage)
+	archiveContent := registrytest.Archive(map[string]string{"terraform-provider-aws_v1.0.0": "provider binary"})
+	registry.AddPackage("hashicorp", "aws", "1.0.0", "linux", "amd64", archiveContent)
+	hostname := registry.Hostname()
 
-	// This test requires that the upstream client can fetch the download URL and then fetch the archive
-	// We'll test the cache hit scenario instead for simplicity, as the full integration requires
-	// a more complex mock setup
-	result, err := mirror.GetArchive(context.Background(), "registry.terraform.io", "hashicorp", "aws", "1.0.0", "linux", "amd64", archivePath)
+	archivePath := hostname + "/hashicorp/aws/terraform-provider-aws_1.0.0_linux_amd64.zip"
+	result, err := mirror.GetArchive(context.Background(), hostname, "hashicorp", "aws", "1.0.0", "linux", "amd64", archivePath)
 	if err != nil {
-		// This is expected to fail without a full mock, which is okay
-		// The important part is tested in TestGetArchive_CacheHit
-		t.Logf("GetArchive failed as expected without full mock: %v", err)
-		return
+		t.Fatalf("GetArchive failed: %v", err)
 	}
 	defer result.Close()
 
@@ -416,6 +464,12 @@ func TestGetArchive_CacheMiss_FetchUpstream(t *testing.T) {
 	if !bytes.Equal(content, archiveContent) {
 		t.Errorf("GetArchive = %q, want %q", content, archiveContent)
 	}
+	if !bytes.Equal(mockStorage.archives[archivePath], archiveContent) {
+		t.Error("archive was not cached")
+	}
+	if n := registry.Requests(registrytest.ArchivePath("hashicorp", "aws", "1.0.0", "linux", "amd64")); n != 1 {
+		t.Errorf("archive downloaded %d times, want 1", n)
+	}
 }
 
 // TestRewriteArchiveURLs tests that archive URLs are correctly rewritten
@@ -655,7 +709,8 @@ func TestBuildVersionFromCache(t *testing.T) {
 	versionsResp := RegistryVersionsResponse{
 		Versions: []RegistryVersion{
 			{
-				Version: "1.0.0",
+				Version:   "1.0.0",
+				Protocols: []string{"5.0", "6.0"},
 				Platforms: []RegistryPlatform{
 					{OS: "linux", Arch: "amd64"},
 					{OS: "darwin", Arch: "amd64"},
@@ -670,12 +725,14 @@ func TestBuildVersionFromCache(t *testing.T) {
 		},
 	}
 	versionsData, _ := json.Marshal(versionsResp)
-	mockStorage.PutVersionsResponse(context.Background(), "registry.terraform.io", "hashicorp", "aws", versionsData)
+	mirror, registry := newRegistryTestMirror(t, mockStorage)
+	hostname := registry.Hostname()
+	mockStorage.PutVersionsResponse(context.Background(), hostname, "hashicorp", "aws", versionsData)
 
-	upstream := newTestUpstreamClientForMirror(httptest.NewTLSServer(http.HandlerFunc(nil)))
-	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080")
+	// Upstream publishes SHA256SUMS for linux only
+	registry.AddPackage("hashicorp", "aws", "1.0.0", "linux", "amd64", []byte("linux archive"))
 
-	result, err := mirror.buildVersionFromCache(context.Background(), "registry.terraform.io", "hashicorp", "aws", "1.0.0")
+	result, err := mirror.buildVersionFromCache(context.Background(), hostname, "hashicorp", "aws", "1.0.0")
 	if err != nil {
 		t.Fatalf("buildVersionFromCache failed: %v", err)
 	}
@@ -696,6 +753,21 @@ func TestBuildVersionFromCache(t *testing.T) {
 	if _, ok := resp.Archives["darwin_amd64"]; !ok {
 		t.Error("expected darwin_amd64 archive")
 	}
+
+	sum := sha256.Sum256([]byte("linux archive"))
+	if got := resp.Archives["linux_amd64"].Hashes; len(got) != 1 || got[0] != "zh:"+hex.EncodeToString(sum[:]) {
+		t.Errorf("expected linux_amd64 zh: hash from SHA256SUMS, got %v", got)
+	}
+	if got := resp.Archives["darwin_amd64"].Hashes; len(got) != 0 {
+		t.Errorf("expected no hashes for darwin_amd64, got %v", got)
+	}
+	if n := registry.Requests(registrytest.ShasumsPath("hashicorp", "aws", "1.0.0")); n != 1 {
+		t.Errorf("SHA256SUMS fetched %d times, want 1", n)
+	}
+
+	if strings.Join(resp.Protocols, ",") != "5.0,6.0" {
+		t.Errorf("expected protocols [5.0 6.0], got %v", resp.Protocols)
+	}
 }
 
 // TestBuildVersionFromCache_NotFound tests error when version not in cache
@@ -740,66 +812,147 @@ func TestBuildVersionFromCache_NoVersionsCache(t *testing.T) {
 func TestGetIndex_CacheWriteError(t *testing.T) {
 	mockStorage := NewMockStorage()
 	mockStorage.putIndexErr = fmt.Errorf("storage error")
+	mirror, registry := newRegistryTestMirror(t, mockStorage)
+	registry.AddPackage("hashicorp", "aws", "1.0.0", "linux", "amd64", []byte("archive"))
 
-	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		versionsResp := RegistryVersionsResponse{
-			Versions: []RegistryVersion{
-				{
-					Version: "1.0.0",
-					Platforms: []RegistryPlatform{
-						{OS: "linux", Arch: "amd64"},
-					},
-				},
-			},
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(versionsResp)
-	}))
-	defer server.Close()
-
-	upstream := newTestUpstreamClientForMirror(server)
-	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080")
-
-	// Will fail due to service discovery not being configured
-	_, err := mirror.GetIndex(context.Background(), "registry.terraform.io", "hashicorp", "aws")
-	if err == nil {
-		t.Error("expected error when upstream is not properly configured")
-		return
+	data, err := mirror.GetIndex(context.Background(), registry.Hostname(), "hashicorp", "aws")
+	if err != nil {
+		t.Fatalf("GetIndex failed: %v", err)
+	}
+	if !strings.Contains(string(data), `"1.0.0"`) {
+		t.Errorf("GetIndex = %s, want version 1.0.0", data)
 	}
-
-	// The error is expected because the test server doesn't provide service discovery
-	t.Logf("GetIndex failed as expected without service discovery: %v", err)
 }
 
 // TestGetVersion_CacheWriteError tests that GetVersion returns data even if caching fails
 func TestGetVersion_CacheWriteError(t *testing.T) {
 	mockStorage := NewMockStorage()
 	mockStorage.putVersionErr = fmt.Errorf("storage error")
+	mirror, registry := newRegistryTestMirror(t, mockStorage)
+	registry.AddPackage("hashicorp", "aws", "1.0.0", "linux", "amd64", []byte("archive"))
 
-	upstreamVersion := VersionResponse{
-		Archives: map[string]Archive{
-			"linux_amd64": {
-				URL: "https://releases.hashicorp.com/terraform-provider-aws/1.0.0/terraform-provider-aws_1.0.0_linux_amd64.zip",
-			},
-		},
+	data, err := mirror.GetVersion(context.Background(), registry.Hostname(), "hashicorp", "aws", "1.0.0")
+	if err != nil {
+		t.Fatalf("GetVersion failed: %v", err)
+	}
+	if !strings.Contains(string(data), "linux_amd64") {
+		t.Errorf("GetVersion = %s, want archive linux_amd64", data)
 	}
+}
 
-	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(upstreamVersion)
+// newArchiveTestServer serves service discovery, the download API and an archive file
+// It returns the server and the hostname to use as the provider registry
+func newArchiveTestServer(t *testing.T, archiveContent []byte) (*httptest.Server, string) {
+	t.Helper()
+
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/.well-known/terraform.json":
+			json.NewEncoder(w).Encode(ServiceDiscovery{ProvidersV1: "/v1/providers/"})
+		case strings.Contains(r.URL.Path, "/download/"):
+			json.NewEncoder(w).Encode(DownloadInfo{DownloadURL: server.URL + "/file.zip"})
+		case r.URL.Path == "/file.zip":
+			w.Write(archiveContent)
+		default:
+			http.NotFound(w, r)
+		}
 	}))
-	defer server.Close()
+	t.Cleanup(server.Close)
 
-	upstream := newTestUpstreamClientForMirror(server)
-	mirror := NewMirror(mockStorage, upstream, "http://localhost:8080")
+	return server, strings.TrimPrefix(server.URL, "https://")
+}
 
-	// Will fail due to service discovery not being configured
-	_, err := mirror.GetVersion(context.Background(), "registry.terraform.io", "hashicorp", "aws", "1.0.0")
-	if err == nil {
-		t.Error("expected error when upstream is not properly configured")
-		return
+// TestGetArchive_Passthrough tests that archives are served without caching in passthrough mode
+func TestGetArchive_Passthrough(t *testing.T) {
+	mockStorage := NewMockStorage()
+	archiveContent := []byte("provider archive data")
+	server, hostname := newArchiveTestServer(t, archiveContent)
+
+	mirror := NewMirror(mockStorage, newTestUpstreamClientForMirror(server), "http://localhost:8080")
+	mirror.SetPassthrough(true)
+
+	archivePath := hostname + "/hashicorp/aws/terraform-provider-aws_1.0.0_linux_amd64.zip"
+	result, err := mirror.GetArchive(context.Background(), hostname, "hashicorp", "aws", "1.0.0", "linux", "amd64", archivePath)
+	if err != nil {
+		t.Fatalf("GetArchive failed: %v", err)
+	}
+	defer result.Close()
+
+	content, err := io.ReadAll(result)
+	if err != nil {
+		t.Fatalf("failed to read archive: %v", err)
+	}
+	if !bytes.Equal(content, archiveContent) {
+		t.Errorf("GetArchive = %q, want %q", content, archiveContent)
+	}
+	if len(mockStorage.archives) != 0 {
+		t.Errorf("expected archive not to be cached in passthrough mode, got %d cached archives", len(mockStorage.archives))
+	}
+
+	// Caching resumes once passthrough is disabled
+	mirror.SetPassthrough(false)
+	result, err = mirror.GetArchive(context.Background(), hostname, "hashicorp", "aws", "1.0.0", "linux", "amd64", archivePath)
+	if err != nil {
+		t.Fatalf("GetArchive failed: %v", err)
+	}
+	result.Close()
+	if _, ok := mockStorage.archives[archivePath]; !ok {
+		t.Error("expected archive to be cached after passthrough was disabled")
+	}
+}
+
+// TestGetArchive_QuotaExceeded tests that archives over a namespace quota are served without caching
+func TestGetArchive_QuotaExceeded(t *testing.T) {
+	mockStorage := NewMockStorage()
+	mockStorage.putArchiveErr = fmt.Errorf("%w: 100 bytes used of 100", storage.ErrQuotaExceeded)
+	archiveContent := []byte("provider archive data")
+	server, hostname := newArchiveTestServer(t, archiveContent)
+
+	mirror := NewMirror(mockStorage, newTestUpstreamClientForMirror(server), "http://localhost:8080")
+
+	archivePath := hostname + "/partner/aws/terraform-provider-aws_1.0.0_linux_amd64.zip"
+	result, err := mirror.GetArchive(context.Background(), hostname, "partner", "aws", "1.0.0", "linux", "amd64", archivePath)
+	if err != nil {
+		t.Fatalf("GetArchive failed: %v", err)
 	}
+	defer result.Close()
 
-	// The error is expected because the test server doesn't provide service discovery
-	t.Logf("GetVersion failed as expected without service discovery: %v", err)
+	content, err := io.ReadAll(result)
+	if err != nil {
+		t.Fatalf("failed to read archive: %v", err)
+	}
+	if !bytes.Equal(content, archiveContent) {
+		t.Errorf("GetArchive = %q, want %q", content, archiveContent)
+	}
+}
+
+// TestGetArchive_QuotaExceededDownloadsOnce tests that an archive rejected by a quota is served from what was downloaded
+func TestGetArchive_QuotaExceededDownloadsOnce(t *testing.T) {
+	fs, err := storage.NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	fs.SetQuota(64, storage.QuotaReject)
+	mirror, registry := newRegistryTestMirror(t, fs)
+	archive := registrytest.Archive(map[string]string{"terraform-provider-aws_v1.0.0": string(bytes.Repeat([]byte("x"), 64<<10))})
+	registry.AddPackage("hashicorp", "aws", "1.0.0", "linux", "amd64", archive)
+	hostname := registry.Hostname()
+
+	archivePath := hostname + "/hashicorp/aws/" + registrytest.Filename("aws", "1.0.0", "linux", "amd64")
+	reader, err := mirror.GetArchive(context.Background(), hostname, "hashicorp", "aws", "1.0.0", "linux", "amd64", archivePath)
+	if err != nil {
+		t.Fatalf("GetArchive failed: %v", err)
+	}
+	content, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil || !bytes.Equal(content, archive) {
+		t.Fatalf("GetArchive returned %d bytes, %v", len(content), err)
+	}
+	if n := registry.Requests(registrytest.ArchivePath("hashicorp", "aws", "1.0.0", "linux", "amd64")); n != 1 {
+		t.Errorf("archive downloaded %d times, want 1", n)
+	}
+	if exists, _ := fs.ExistsArchive(context.Background(), archivePath); exists {
+		t.Error("expected the archive over the quota not to be cached")
+	}
 }
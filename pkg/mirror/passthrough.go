@@ -0,0 +1,39 @@
+package mirror
+
+import (
+	"errors"
+	"strings"
+)
+
+// errCacheBypassed is returned instead of cached data for providers that bypass the cache
+var errCacheBypassed = errors.New("cache bypassed for provider")
+
+// SetPassthroughProviders makes the providers matched by rules bypass the cache
+// Their metadata and archives are always fetched from upstream and never stored, entries cached before are ignored
+// Must be called before the mirror is used
+func (m *Mirror) SetPassthroughProviders(rules ProviderRules[bool]) {
+	m.passthroughProviders = rules
+}
+
+// bypassCache reports whether a provider is never read from or written to the cache
+func (m *Mirror) bypassCache(hostname, namespace, providerType string) bool {
+	bypass, _ := m.passthroughProviders.Lookup(hostname, namespace, providerType)
+	return bypass
+}
+
+// bypassArchive reports whether the provider of a hostname/namespace/type/filename archive path bypasses the cache
+func (m *Mirror) bypassArchive(archivePath string) bool {
+	parts := strings.SplitN(archivePath, "/", 4)
+	if len(parts) < 4 {
+		return false
+	}
+	return m.bypassCache(parts[0], parts[1], parts[2])
+}
+
+// policy returns the cache policy applied to a resource of a provider
+func (m *Mirror) policy(policy CachePolicy, hostname, namespace, providerType string) CachePolicy {
+	if m.bypassCache(hostname, namespace, providerType) {
+		return CacheNoStore
+	}
+	return policy
+}
@@ -0,0 +1,68 @@
+package mirror
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/elisiariocouto/specular/pkg/registrytest"
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+func TestPassthroughProviders(t *testing.T) {
+	mirror, store, registry, archive := newCachePolicyTestMirror(t, CachePolicies{})
+	hostname := registry.Hostname()
+	registry.AddPackage("hashicorp", "random", "3.0.0", "linux", "amd64", archive)
+	mirror.SetPassthroughProviders(ProviderRules[bool]{hostname + "/hashicorp/aws": true})
+	ctx := context.Background()
+
+	// A stale entry cached before the provider was marked passthrough is ignored
+	if err := store.PutIndex(ctx, hostname, "hashicorp", "aws", []byte(`{"versions":{}}`)); err != nil {
+		t.Fatalf("PutIndex failed: %v", err)
+	}
+	if _, err := mirror.IndexModTime(ctx, hostname, "hashicorp", "aws"); !storage.IsNotFound(err) {
+		t.Errorf("expected no modification time for a passthrough provider, got %v", err)
+	}
+
+	archivePath := hostname + "/hashicorp/aws/" + registrytest.Filename("aws", "1.0.0", "linux", "amd64")
+	for range 2 {
+		data, err := mirror.GetIndex(ctx, hostname, "hashicorp", "aws")
+		if err != nil {
+			t.Fatalf("GetIndex failed: %v", err)
+		}
+		if string(data) == `{"versions":{}}` {
+			t.Error("expected index from upstream, got the stale cached one")
+		}
+		if _, err := mirror.GetVersion(ctx, hostname, "hashicorp", "aws", "1.0.0"); err != nil {
+			t.Fatalf("GetVersion failed: %v", err)
+		}
+		reader, err := mirror.GetArchive(ctx, hostname, "hashicorp", "aws", "1.0.0", "linux", "amd64", archivePath)
+		if err != nil {
+			t.Fatalf("GetArchive failed: %v", err)
+		}
+		io.Copy(io.Discard, reader)
+		reader.Close()
+	}
+	if n := registry.Requests(registrytest.VersionsPath("hashicorp", "aws")); n != 4 {
+		t.Errorf("aws versions endpoint called %d times, want 4", n)
+	}
+	if n := registry.Requests(registrytest.ArchivePath("hashicorp", "aws", "1.0.0", "linux", "amd64")); n != 2 {
+		t.Errorf("aws archive downloaded %d times, want 2", n)
+	}
+	if _, err := store.GetVersion(ctx, hostname, "hashicorp", "aws", "1.0.0"); !storage.IsNotFound(err) {
+		t.Errorf("expected version not to be cached, got %v", err)
+	}
+	if exists, _ := store.ExistsArchive(ctx, archivePath); exists {
+		t.Error("expected archive not to be cached")
+	}
+
+	// Other providers are cached as usual
+	for range 2 {
+		if _, err := mirror.GetIndex(ctx, hostname, "hashicorp", "random"); err != nil {
+			t.Fatalf("GetIndex failed: %v", err)
+		}
+	}
+	if n := registry.Requests(registrytest.VersionsPath("hashicorp", "random")); n != 1 {
+		t.Errorf("random versions endpoint called %d times, want 1", n)
+	}
+}
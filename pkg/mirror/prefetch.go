@@ -0,0 +1,119 @@
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+)
+
+// Prefetch caches every platform archive of a provider version, along with its metadata
+// Archives already in the cache are skipped. It returns the number of archives fetched
+// Archives that fail are reported together once the others have been tried
+// Upstream requests are spaced out by the background limiter of the upstream client
+// When platforms (e.g., linux_amd64) are given, only their archives are fetched
+func (m *Mirror) Prefetch(ctx context.Context, hostname, namespace, providerType, version string, platforms ...string) (int, error) {
+	ctx = withBackground(ctx)
+	data, err := m.GetVersion(ctx, hostname, namespace, providerType, version)
+	if err != nil {
+		return 0, err
+	}
+
+	var response VersionResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return 0, fmt.Errorf("failed to parse version response: %w", err)
+	}
+
+	fetched := 0
+	var errs []error
+	for _, platform := range platforms {
+		if _, ok := response.Archives[platform]; !ok {
+			errs = append(errs, fmt.Errorf("%s: %w", platform, ErrNotFound))
+		}
+	}
+	for platform, archive := range response.Archives {
+		if err := ctx.Err(); err != nil {
+			return fetched, err
+		}
+		if len(platforms) > 0 && !slices.Contains(platforms, platform) {
+			continue
+		}
+
+		os, arch, err := parsePlatformKey(platform)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		archivePath := fmt.Sprintf("%s/%s/%s/%s", hostname, namespace, providerType, m.extractFilename(archive.URL))
+		if exists, err := m.storage.ExistsArchive(ctx, archivePath); err == nil && exists {
+			continue
+		}
+
+		reader, err := m.GetArchive(ctx, hostname, namespace, providerType, version, os, arch, archivePath)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", platform, err))
+			continue
+		}
+		// Write-back archives are only stored once read to the end
+		_, err = io.Copy(io.Discard, reader)
+		reader.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", platform, err))
+			continue
+		}
+		fetched++
+	}
+	return fetched, errors.Join(errs...)
+}
+
+// Refresh fetches the index of a provider from upstream and replaces the cached copy
+// New versions become visible without waiting for the cached index to be removed
+// Upstream requests are spaced out by the background limiter of the upstream client
+func (m *Mirror) Refresh(ctx context.Context, hostname, namespace, providerType string) error {
+	_, err := m.RefreshVersions(ctx, hostname, namespace, providerType)
+	return err
+}
+
+// RefreshVersions refreshes the index of a provider like Refresh and returns the versions missing from the
+// cached copy, newest first. None are returned when nothing was cached or the cached copy cannot be parsed
+func (m *Mirror) RefreshVersions(ctx context.Context, hostname, namespace, providerType string) ([]string, error) {
+	previous, cacheErr := m.storage.GetIndex(ctx, hostname, namespace, providerType)
+	data, _, err := m.fetchIndex(withBackground(ctx), hostname, namespace, providerType)
+	if err != nil {
+		return nil, err
+	}
+	if cacheErr != nil {
+		return nil, nil
+	}
+	added, err := addedVersions(previous, data)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to compare refreshed index with the cached copy",
+			"hostname", hostname, "namespace", namespace, "type", providerType, "err", err)
+		return nil, nil
+	}
+	return added, nil
+}
+
+// addedVersions returns the versions of the current index that are not in the previous one, newest first
+func addedVersions(previous, current []byte) ([]string, error) {
+	var before, after IndexResponse
+	if err := json.Unmarshal(previous, &before); err != nil {
+		return nil, fmt.Errorf("failed to parse cached index: %w", err)
+	}
+	if err := json.Unmarshal(current, &after); err != nil {
+		return nil, fmt.Errorf("failed to parse index: %w", err)
+	}
+	var added []string
+	for version := range after.Versions {
+		if _, ok := before.Versions[version]; !ok {
+			added = append(added, version)
+		}
+	}
+	slices.SortFunc(added, func(a, b string) int {
+		return compareVersions(b, a)
+	})
+	return added, nil
+}
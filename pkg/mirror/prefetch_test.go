@@ -0,0 +1,94 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/elisiariocouto/specular/pkg/registrytest"
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+func TestPrefetch(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	mirror, registry := newRegistryTestMirror(t, store)
+	archive := registrytest.Archive(map[string]string{"terraform-provider-aws_v1.0.0": "provider binary"})
+	registry.AddPackage("hashicorp", "aws", "1.0.0", "linux", "amd64", archive)
+	registry.AddPackage("hashicorp", "aws", "1.0.0", "darwin", "arm64", archive)
+	hostname := registry.Hostname()
+
+	fetched, err := mirror.Prefetch(context.Background(), hostname, "hashicorp", "aws", "1.0.0")
+	if err != nil || fetched != 2 {
+		t.Fatalf("Prefetch = %d, %v, want 2 archives", fetched, err)
+	}
+	for _, platform := range []string{"linux_amd64", "darwin_arm64"} {
+		path := hostname + "/hashicorp/aws/terraform-provider-aws_1.0.0_" + platform + ".zip"
+		if exists, _ := store.ExistsArchive(context.Background(), path); !exists {
+			t.Errorf("expected %s to be cached", path)
+		}
+	}
+
+	// Cached archives are skipped
+	fetched, err = mirror.Prefetch(context.Background(), hostname, "hashicorp", "aws", "1.0.0")
+	if err != nil || fetched != 0 {
+		t.Errorf("second Prefetch = %d, %v, want 0 archives", fetched, err)
+	}
+	if n := registry.Requests(registrytest.ArchivePath("hashicorp", "aws", "1.0.0", "linux", "amd64")); n != 1 {
+		t.Errorf("archive fetched %d times, want 1", n)
+	}
+}
+
+func TestPrefetch_Platforms(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	mirror, registry := newRegistryTestMirror(t, store)
+	archive := registrytest.Archive(map[string]string{"terraform-provider-aws_v1.0.0": "provider binary"})
+	registry.AddPackage("hashicorp", "aws", "1.0.0", "linux", "amd64", archive)
+	registry.AddPackage("hashicorp", "aws", "1.0.0", "darwin", "arm64", archive)
+	hostname := registry.Hostname()
+
+	fetched, err := mirror.Prefetch(context.Background(), hostname, "hashicorp", "aws", "1.0.0", "linux_amd64")
+	if err != nil || fetched != 1 {
+		t.Fatalf("Prefetch = %d, %v, want 1 archive", fetched, err)
+	}
+	if n := registry.Requests(registrytest.ArchivePath("hashicorp", "aws", "1.0.0", "darwin", "arm64")); n != 0 {
+		t.Errorf("darwin_arm64 archive fetched %d times, want 0", n)
+	}
+
+	// Platforms that are not published are reported once the others have been fetched
+	fetched, err = mirror.Prefetch(context.Background(), hostname, "hashicorp", "aws", "1.0.0", "darwin_arm64", "windows_amd64")
+	if fetched != 1 || !errors.Is(err, ErrNotFound) {
+		t.Errorf("Prefetch = %d, %v, want 1 archive and ErrNotFound", fetched, err)
+	}
+}
+
+func TestRefreshVersions(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	mirror, registry := newRegistryTestMirror(t, store)
+	registry.AddPackage("hashicorp", "aws", "1.0.0", "linux", "amd64", []byte("archive"))
+	hostname := registry.Hostname()
+	ctx := context.Background()
+
+	// Nothing cached yet, so nothing is new
+	added, err := mirror.RefreshVersions(ctx, hostname, "hashicorp", "aws")
+	if err != nil || len(added) != 0 {
+		t.Fatalf("first RefreshVersions = %v, %v, want no added versions", added, err)
+	}
+
+	registry.AddPackage("hashicorp", "aws", "1.1.0", "linux", "amd64", []byte("archive"))
+	registry.AddPackage("hashicorp", "aws", "1.10.0", "linux", "amd64", []byte("archive"))
+	added, err = mirror.RefreshVersions(ctx, hostname, "hashicorp", "aws")
+	if err != nil || !slices.Equal(added, []string{"1.10.0", "1.1.0"}) {
+		t.Errorf("RefreshVersions = %v, %v, want [1.10.0 1.1.0]", added, err)
+	}
+
+	// A cached copy that cannot be parsed is still replaced, without reporting new versions
+	store.PutIndex(ctx, hostname, "hashicorp", "aws", []byte("not json"))
+	added, err = mirror.RefreshVersions(ctx, hostname, "hashicorp", "aws")
+	if err != nil || len(added) != 0 {
+		t.Errorf("RefreshVersions = %v, %v, want no added versions", added, err)
+	}
+	if data, err := store.GetIndex(ctx, hostname, "hashicorp", "aws"); err != nil || string(data) == "not json" {
+		t.Errorf("expected the cached index to be replaced, got %q, %v", data, err)
+	}
+}
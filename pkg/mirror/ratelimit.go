@@ -0,0 +1,81 @@
+package mirror
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// HostLimiter spaces out background requests to each upstream host
+// Requests are let through one at a time at the host's rate, so a burst of work is spread over time
+type HostLimiter struct {
+	// defaultRate is the requests per minute allowed to hosts without their own rate, zero is unlimited
+	defaultRate int
+	rates       map[string]int
+
+	mu   sync.Mutex
+	next map[string]time.Time
+}
+
+// NewHostLimiter creates a limiter allowing defaultRate requests per minute to each host
+// rates overrides the rate of individual hosts, zero rates are unlimited
+func NewHostLimiter(defaultRate int, rates map[string]int) *HostLimiter {
+	return &HostLimiter{
+		defaultRate: defaultRate,
+		rates:       rates,
+		next:        make(map[string]time.Time),
+	}
+}
+
+// Wait blocks until a request to host is allowed or ctx is done
+func (l *HostLimiter) Wait(ctx context.Context, host string) error {
+	rate, ok := l.rates[host]
+	if !ok {
+		rate = l.defaultRate
+	}
+	if rate <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	slot := l.next[host]
+	if slot.Before(now) {
+		slot = now
+	}
+	l.next[host] = slot.Add(time.Minute / time.Duration(rate))
+	l.mu.Unlock()
+
+	if wait := slot.Sub(now); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return nil
+}
+
+// backgroundKey marks contexts of background work, whose upstream requests are rate limited
+type backgroundKey struct{}
+
+// withBackground marks ctx as background work
+func withBackground(ctx context.Context) context.Context {
+	return context.WithValue(ctx, backgroundKey{}, true)
+}
+
+// SetBackgroundLimiter rate limits upstream requests made by Prefetch and Refresh per host
+// Requests serving clients are never limited. Must be called before the client is used
+func (uc *UpstreamClient) SetBackgroundLimiter(l *HostLimiter) {
+	uc.limiter = l
+}
+
+// wait blocks background requests to host until the limiter lets them through
+func (uc *UpstreamClient) wait(ctx context.Context, host string) error {
+	if uc.limiter == nil || ctx.Value(backgroundKey{}) == nil {
+		return nil
+	}
+	return uc.limiter.Wait(ctx, host)
+}
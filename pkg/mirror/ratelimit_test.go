@@ -0,0 +1,67 @@
+package mirror
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestHostLimiter(t *testing.T) {
+	limiter := NewHostLimiter(6000, map[string]int{"fast.example.com": 0})
+	ctx := context.Background()
+
+	start := time.Now()
+	for range 5 {
+		if err := limiter.Wait(ctx, "registry.example.com"); err != nil {
+			t.Fatalf("Wait failed: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("5 requests at 100 per second took %s, want at least 40ms", elapsed)
+	}
+
+	// Hosts are limited separately, and a zero rate is unlimited
+	start = time.Now()
+	for range 100 {
+		limiter.Wait(ctx, "fast.example.com")
+	}
+	if err := limiter.Wait(ctx, "other.example.com"); err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
+		t.Errorf("unlimited requests took %s", elapsed)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	slow := NewHostLimiter(1, nil)
+	slow.Wait(ctx, "registry.example.com")
+	if err := slow.Wait(cancelled, "registry.example.com"); err == nil {
+		t.Error("expected Wait to return when the context is done")
+	}
+}
+
+func TestBackgroundLimiter(t *testing.T) {
+	mirror, registry := newRegistryTestMirror(t, NewMockStorage())
+	registry.AddPackage("hashicorp", "aws", "1.0.0", "linux", "amd64", []byte("archive"))
+	// One request per minute, only the first background request goes through right away
+	mirror.upstream.SetBackgroundLimiter(NewHostLimiter(1, nil))
+	hostname := registry.Hostname()
+
+	if err := mirror.Refresh(context.Background(), hostname, "hashicorp", "aws"); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+
+	// Requests serving clients are not limited
+	for range 3 {
+		if _, _, err := mirror.fetchIndex(context.Background(), hostname, "hashicorp", "aws"); err != nil {
+			t.Fatalf("fetchIndex failed: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := mirror.Refresh(ctx, hostname, "hashicorp", "aws"); err == nil {
+		t.Error("expected the second background refresh to wait for the limiter")
+	}
+}
@@ -0,0 +1,28 @@
+package mirror
+
+import (
+	"context"
+	"time"
+
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+// SetArchiveRedirect makes ArchiveURL hand out URLs valid for expiry, zero disables redirects
+// Only storage backends implementing storage.ArchiveURLSigner can sign URLs. Must be called before the mirror is used
+func (m *Mirror) SetArchiveRedirect(expiry time.Duration) {
+	m.redirectExpiry = expiry
+}
+
+// ArchiveURL returns a short-lived URL clients can download a cached archive from, bypassing the mirror
+// Returns storage.ErrNotFound if redirects are disabled, the storage cannot sign URLs, the archive is not cached
+// or its provider bypasses the cache, in which case the archive should be served by GetArchive
+func (m *Mirror) ArchiveURL(ctx context.Context, hostname, namespace, providerType, version, archivePath string) (string, error) {
+	signer, ok := storage.As[storage.ArchiveURLSigner](m.storage)
+	if !ok || m.redirectExpiry <= 0 || m.bypassCache(hostname, namespace, providerType) {
+		return "", storage.ErrNotFound
+	}
+	if err := m.CheckWithdrawn(ctx, hostname, namespace, providerType, version); err != nil {
+		return "", err
+	}
+	return signer.SignArchiveURL(ctx, archivePath, m.redirectExpiry)
+}
@@ -0,0 +1,62 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+// signingStorage is memory storage that presigns URLs of cached archives like an object store
+type signingStorage struct {
+	*storage.MemoryStorage
+}
+
+func (s signingStorage) SignArchiveURL(ctx context.Context, path string, expiry time.Duration) (string, error) {
+	exists, err := s.ExistsArchive(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", storage.ErrNotFound
+	}
+	return "https://bucket.example.com/" + path + "?expires=" + expiry.String(), nil
+}
+
+func TestArchiveURL(t *testing.T) {
+	ctx := context.Background()
+	store := signingStorage{storage.NewMemoryStorage()}
+	archivePath := "registry.terraform.io/hashicorp/aws/terraform-provider-aws_1.0.0_linux_amd64.zip"
+	if err := store.PutArchive(ctx, archivePath, strings.NewReader("zip")); err != nil {
+		t.Fatalf("PutArchive failed: %v", err)
+	}
+	if err := store.PutIndex(ctx, "registry.terraform.io", "hashicorp", "aws", []byte(`{"versions":{"1.0.0":{"yanked":true}}}`)); err != nil {
+		t.Fatalf("PutIndex failed: %v", err)
+	}
+	mirror := NewMirror(store, nil, "http://localhost:8080")
+
+	if _, err := mirror.ArchiveURL(ctx, "registry.terraform.io", "hashicorp", "aws", "1.0.0", archivePath); !storage.IsNotFound(err) {
+		t.Errorf("expected ErrNotFound with redirects disabled, got %v", err)
+	}
+
+	mirror.SetArchiveRedirect(5 * time.Minute)
+	url, err := mirror.ArchiveURL(ctx, "registry.terraform.io", "hashicorp", "aws", "1.0.0", archivePath)
+	if err != nil {
+		t.Fatalf("ArchiveURL failed: %v", err)
+	}
+	if want := "https://bucket.example.com/" + archivePath + "?expires=5m0s"; url != want {
+		t.Errorf("ArchiveURL = %s, want %s", url, want)
+	}
+	if _, err := mirror.ArchiveURL(ctx, "registry.terraform.io", "hashicorp", "aws", "1.1.0", "registry.terraform.io/hashicorp/aws/missing.zip"); !storage.IsNotFound(err) {
+		t.Errorf("expected ErrNotFound for an archive that is not cached, got %v", err)
+	}
+
+	// Withdrawn version policies apply to redirects too
+	mirror.SetWithdrawnVersions(WithdrawnVersions{Default: WithdrawnBlock})
+	if _, err := mirror.ArchiveURL(ctx, "registry.terraform.io", "hashicorp", "aws", "1.0.0", archivePath); !errors.Is(err, ErrVersionWithdrawn) {
+		t.Errorf("expected ErrVersionWithdrawn, got %v", err)
+	}
+}
@@ -0,0 +1,17 @@
+package mirror
+
+import "context"
+
+// refreshKey marks contexts of requests that revalidate cached metadata against upstream
+type refreshKey struct{}
+
+// WithRefresh marks ctx so index and version metadata are fetched from upstream instead of the cache
+// The fetched metadata replaces the cached copy, archives are still served from the cache
+func WithRefresh(ctx context.Context) context.Context {
+	return context.WithValue(ctx, refreshKey{}, true)
+}
+
+// RefreshRequested reports whether ctx was marked by WithRefresh
+func RefreshRequested(ctx context.Context) bool {
+	return ctx.Value(refreshKey{}) != nil
+}
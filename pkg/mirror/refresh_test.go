@@ -0,0 +1,56 @@
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestWithRefresh(t *testing.T) {
+	store := NewMockStorage()
+	mirror, registry := newRegistryTestMirror(t, store)
+	registry.AddPackage("hashicorp", "aws", "1.0.0", "linux", "amd64", []byte("archive"))
+	hostname := registry.Hostname()
+	ctx := context.Background()
+
+	// Stale metadata cached before 1.0.0 was published
+	store.PutIndex(ctx, hostname, "hashicorp", "aws", []byte(`{"versions":{"0.9.0":{}}}`))
+	store.PutVersion(ctx, hostname, "hashicorp", "aws", "1.0.0", []byte(`{"archives":{}}`))
+
+	data, err := mirror.GetIndex(ctx, hostname, "hashicorp", "aws")
+	if err != nil {
+		t.Fatalf("GetIndex failed: %v", err)
+	}
+	if versions := indexVersions(t, data); len(versions) != 1 || !hasVersion(versions, "0.9.0") {
+		t.Errorf("expected the cached index without a refresh, got %v", versions)
+	}
+
+	if RefreshRequested(ctx) || !RefreshRequested(WithRefresh(ctx)) {
+		t.Fatal("RefreshRequested does not report WithRefresh")
+	}
+	data, err = mirror.GetIndex(WithRefresh(ctx), hostname, "hashicorp", "aws")
+	if err != nil {
+		t.Fatalf("refreshed GetIndex failed: %v", err)
+	}
+	if versions := indexVersions(t, data); len(versions) != 1 || !hasVersion(versions, "1.0.0") {
+		t.Errorf("expected the upstream index on refresh, got %v", versions)
+	}
+	if cached, _ := store.GetIndex(ctx, hostname, "hashicorp", "aws"); string(cached) != string(data) {
+		t.Errorf("refresh did not update the cached index, got %s", cached)
+	}
+
+	data, err = mirror.GetVersion(WithRefresh(ctx), hostname, "hashicorp", "aws", "1.0.0")
+	if err != nil {
+		t.Fatalf("refreshed GetVersion failed: %v", err)
+	}
+	var version VersionResponse
+	if err := json.Unmarshal(data, &version); err != nil {
+		t.Fatalf("failed to parse version: %v", err)
+	}
+	if _, ok := version.Archives["linux_amd64"]; !ok {
+		t.Errorf("expected the upstream archives on refresh, got %s", data)
+	}
+	if cached, _ := store.GetVersion(ctx, hostname, "hashicorp", "aws", "1.0.0"); string(cached) != string(data) {
+		t.Errorf("refresh did not update the cached version, got %s", cached)
+	}
+}
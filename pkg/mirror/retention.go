@@ -0,0 +1,62 @@
+package mirror
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/elisiariocouto/specular/pkg/metrics"
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+// RetentionCollector periodically removes cached metadata and archives that were not read within the retention window
+type RetentionCollector struct {
+	expirer   storage.Expirer
+	retention time.Duration
+	metrics   *metrics.Metrics
+	logger    *slog.Logger
+}
+
+// NewRetentionCollector creates a collector removing entries of expirer not read for longer than retention
+func NewRetentionCollector(expirer storage.Expirer, retention time.Duration, metrics *metrics.Metrics, logger *slog.Logger) *RetentionCollector {
+	return &RetentionCollector{
+		expirer:   expirer,
+		retention: retention,
+		metrics:   metrics,
+		logger:    logger,
+	}
+}
+
+// Collect removes expired entries once, entries removed before an error are still counted
+func (rc *RetentionCollector) Collect(ctx context.Context) (storage.ExpiredEntries, error) {
+	expired, err := rc.expirer.RemoveUnused(ctx, time.Now().Add(-rc.retention))
+	rc.metrics.RecordCacheExpired(expired.Metadata, expired.Archives, expired.Bytes)
+	if expired.Metadata > 0 || expired.Archives > 0 {
+		rc.logger.InfoContext(ctx, "removed cache entries not read within retention",
+			slog.Int("metadata", expired.Metadata),
+			slog.Int("archives", expired.Archives),
+			slog.Int64("bytes", expired.Bytes),
+			slog.Duration("retention", rc.retention))
+	}
+	return expired, err
+}
+
+// Run collects at every interval until the context is cancelled, a collection in progress is interrupted
+// The first collection waits for an interval so startup is not slowed down by a full cache scan
+func (rc *RetentionCollector) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := rc.Collect(ctx); err != nil && ctx.Err() == nil {
+			rc.logger.ErrorContext(ctx, "failed to remove expired cache entries",
+				slog.String("error", err.Error()))
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/elisiariocouto/specular/pkg/metrics"
+	"github.com/elisiariocouto/specular/pkg/storage"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// fakeExpirer removes a fixed set of entries and remembers the cutoff it was called with
+type fakeExpirer struct {
+	expired storage.ExpiredEntries
+	err     error
+	cutoff  time.Time
+}
+
+func (f *fakeExpirer) RemoveUnused(ctx context.Context, cutoff time.Time) (storage.ExpiredEntries, error) {
+	f.cutoff = cutoff
+	return f.expired, f.err
+}
+
+func TestRetentionCollector(t *testing.T) {
+	m := metrics.New(nil, metrics.Options{DisableGoCollector: true, DisableProcessCollector: true})
+	expirer := &fakeExpirer{expired: storage.ExpiredEntries{Metadata: 2, Archives: 1, Bytes: 300}}
+	collector := NewRetentionCollector(expirer, 30*24*time.Hour, m, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if _, err := collector.Collect(context.Background()); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	if age := time.Since(expirer.cutoff); age < 30*24*time.Hour || age > 30*24*time.Hour+time.Minute {
+		t.Errorf("expected a cutoff 30 days ago, got %v", expirer.cutoff)
+	}
+
+	// Entries removed before a failure are still counted
+	expirer.err = errors.New("permission denied")
+	if _, err := collector.Collect(context.Background()); err == nil {
+		t.Error("expected the expirer error")
+	}
+
+	if got := testutil.ToFloat64(m.CacheExpiredEntriesTotal.WithLabelValues("metadata")); got != 4 {
+		t.Errorf("expected 4 expired metadata entries, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.CacheExpiredEntriesTotal.WithLabelValues("archive")); got != 2 {
+		t.Errorf("expected 2 expired archives, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.CacheExpiredBytesTotal); got != 600 {
+		t.Errorf("expected 600 expired bytes, got %v", got)
+	}
+}
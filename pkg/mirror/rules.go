@@ -0,0 +1,16 @@
+package mirror
+
+// ProviderRules maps provider patterns to settings
+// A pattern is a hostname, hostname/namespace or hostname/namespace/type
+type ProviderRules[T any] map[string]T
+
+// Lookup returns the setting of the most specific pattern matching a provider
+func (r ProviderRules[T]) Lookup(hostname, namespace, providerType string) (T, bool) {
+	for _, key := range []string{hostname + "/" + namespace + "/" + providerType, hostname + "/" + namespace, hostname} {
+		if value, ok := r[key]; ok {
+			return value, true
+		}
+	}
+	var zero T
+	return zero, false
+}
@@ -0,0 +1,55 @@
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// SetStrictIndex makes index.json list only versions with at least one cached archive, for air-gapped
+// mirrors where versions that cannot be downloaded only produce confusing errors
+// Providers that bypass the cache are not affected. Must be called before the mirror is used
+func (m *Mirror) SetStrictIndex(enabled bool) {
+	m.strictIndex = enabled
+}
+
+// onlyCached leaves versions without a cached archive out of an index.json response
+// It returns ErrNotFound when no version is cached
+func (m *Mirror) onlyCached(ctx context.Context, data []byte, hostname, namespace, providerType string) ([]byte, error) {
+	var index IndexResponse
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("failed to parse index: %w", err)
+	}
+	removed := false
+	for version := range index.Versions {
+		cached, err := m.versionCached(ctx, hostname, namespace, providerType, version)
+		if err != nil {
+			return nil, err
+		}
+		if !cached {
+			delete(index.Versions, version)
+			removed = true
+		}
+	}
+	if len(index.Versions) == 0 {
+		return nil, fmt.Errorf("%w: no version of %s/%s/%s is cached", ErrNotFound, hostname, namespace, providerType)
+	}
+	if !removed {
+		return data, nil
+	}
+	return json.Marshal(index)
+}
+
+// versionCached reports whether the version metadata and at least one archive of a provider version are cached
+func (m *Mirror) versionCached(ctx context.Context, hostname, namespace, providerType, version string) (bool, error) {
+	for _, filename := range m.cachedArchives(ctx, hostname, namespace, providerType, version) {
+		exists, err := m.storage.ExistsArchive(ctx, fmt.Sprintf("%s/%s/%s/%s", hostname, namespace, providerType, filename))
+		if err != nil {
+			return false, fmt.Errorf("%w: failed to check cached archive: %w", ErrStorageFailure, err)
+		}
+		if exists {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,59 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+func TestStrictIndex(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	ctx := context.Background()
+	index := `{"versions":{"1.0.0":{},"1.1.0":{},"1.2.0":{}}}`
+	if err := store.PutIndex(ctx, "registry.terraform.io", "hashicorp", "aws", []byte(index)); err != nil {
+		t.Fatalf("PutIndex failed: %v", err)
+	}
+	// 1.0.0 has its archive cached, 1.1.0 only its metadata, 1.2.0 nothing
+	for _, version := range []string{"1.0.0", "1.1.0"} {
+		versionJSON := `{"archives":{"linux_amd64":{"url":"http://localhost:8080/registry.terraform.io/hashicorp/aws/terraform-provider-aws_` + version + `_linux_amd64.zip"}}}`
+		if err := store.PutVersion(ctx, "registry.terraform.io", "hashicorp", "aws", version, []byte(versionJSON)); err != nil {
+			t.Fatalf("PutVersion failed: %v", err)
+		}
+	}
+	if err := store.PutArchive(ctx, "registry.terraform.io/hashicorp/aws/terraform-provider-aws_1.0.0_linux_amd64.zip", strings.NewReader("zip")); err != nil {
+		t.Fatalf("PutArchive failed: %v", err)
+	}
+	mirror := NewMirror(store, nil, "http://localhost:8080")
+
+	data, err := mirror.GetIndex(ctx, "registry.terraform.io", "hashicorp", "aws")
+	if err != nil {
+		t.Fatalf("GetIndex failed: %v", err)
+	}
+	if versions := indexVersions(t, data); len(versions) != 3 {
+		t.Errorf("expected every version without strict mode, got %v", versions)
+	}
+
+	mirror.SetStrictIndex(true)
+	data, err = mirror.GetIndex(ctx, "registry.terraform.io", "hashicorp", "aws")
+	if err != nil {
+		t.Fatalf("GetIndex failed: %v", err)
+	}
+	if versions := indexVersions(t, data); len(versions) != 1 || !hasVersion(versions, "1.0.0") {
+		t.Errorf("expected only the cached 1.0.0 to be listed, got %v", versions)
+	}
+
+	if err := store.PutIndex(ctx, "registry.terraform.io", "hashicorp", "null", []byte(`{"versions":{"3.0.0":{}}}`)); err != nil {
+		t.Fatalf("PutIndex failed: %v", err)
+	}
+	if _, err := mirror.GetIndex(ctx, "registry.terraform.io", "hashicorp", "null"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a provider without cached versions, got %v", err)
+	}
+}
+
+func hasVersion(versions map[string]VersionInfo, version string) bool {
+	_, ok := versions[version]
+	return ok
+}
@@ -0,0 +1,103 @@
+package mirror
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// TraceContext is a W3C Trace Context (https://www.w3.org/TR/trace-context/) carried from a client request
+// to the upstream requests it causes, so distributed traces connect the client, Specular and the registry
+type TraceContext struct {
+	TraceID [16]byte
+	// SpanID identifies the caller's span, upstream requests are sent as its children
+	SpanID [8]byte
+	Flags  byte
+	// State is the vendor-specific tracestate header, forwarded unchanged
+	State string
+}
+
+// traceContextKey is the context key of the trace context of a request
+type traceContextKey struct{}
+
+// WithTraceContext returns a context whose upstream requests continue tc
+func WithTraceContext(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, tc)
+}
+
+// TraceContextFrom returns the trace context carried by ctx
+func TraceContextFrom(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(traceContextKey{}).(TraceContext)
+	return tc, ok
+}
+
+// ParseTraceParent parses traceparent and tracestate headers
+// It reports false for malformed headers and the all-zero trace and span IDs, which must be ignored
+func ParseTraceParent(traceparent, tracestate string) (TraceContext, bool) {
+	var tc TraceContext
+	// version-traceid-spanid-flags, later versions may append fields
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return tc, false
+	}
+	var flags [1]byte
+	if !decodeLowerHex(tc.TraceID[:], parts[1]) || !decodeLowerHex(tc.SpanID[:], parts[2]) ||
+		!decodeLowerHex(flags[:], parts[3]) || !decodeLowerHex(make([]byte, 1), parts[0]) {
+		return tc, false
+	}
+	if tc.TraceID == [16]byte{} || tc.SpanID == [8]byte{} {
+		return tc, false
+	}
+	tc.Flags = flags[0]
+	tc.State = strings.TrimSpace(tracestate)
+	return tc, true
+}
+
+// NewTraceContext starts a new trace, not sampled since Specular records no spans itself
+func NewTraceContext() TraceContext {
+	var tc TraceContext
+	rand.Read(tc.TraceID[:])
+	rand.Read(tc.SpanID[:])
+	return tc
+}
+
+// Child returns the trace context of a request made on behalf of tc, with a new span ID
+func (tc TraceContext) Child() TraceContext {
+	rand.Read(tc.SpanID[:])
+	return tc
+}
+
+// TraceParent formats the traceparent header
+func (tc TraceContext) TraceParent() string {
+	return "00-" + hex.EncodeToString(tc.TraceID[:]) + "-" + hex.EncodeToString(tc.SpanID[:]) + "-" + hex.EncodeToString([]byte{tc.Flags})
+}
+
+// TraceIDString returns the hex-encoded trace ID, as shown in logs
+func (tc TraceContext) TraceIDString() string {
+	return hex.EncodeToString(tc.TraceID[:])
+}
+
+// injectTraceContext sets the trace context headers of an upstream request
+// Requests made outside a client request, such as background jobs, start a new trace
+func injectTraceContext(req *http.Request) {
+	tc, ok := TraceContextFrom(req.Context())
+	if !ok {
+		tc = NewTraceContext()
+	}
+	tc = tc.Child()
+	req.Header.Set("traceparent", tc.TraceParent())
+	if tc.State != "" {
+		req.Header.Set("tracestate", tc.State)
+	}
+}
+
+// decodeLowerHex decodes s into dst, it must be exactly len(dst) bytes of lowercase hex
+func decodeLowerHex(dst []byte, s string) bool {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
@@ -0,0 +1,85 @@
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	tests := []struct {
+		name        string
+		traceparent string
+		valid       bool
+	}{
+		{"sampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{"not sampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true},
+		{"future version with extra fields", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true},
+		{"empty", "", false},
+		{"uppercase", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-01", false},
+		{"zero trace ID", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"zero span ID", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+		{"invalid version", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"extra fields in version 00", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false},
+		{"short trace ID", "00-4bf92f3577b34da6-00f067aa0ba902b7-01", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc, ok := ParseTraceParent(tt.traceparent, "vendor=value")
+			if ok != tt.valid {
+				t.Fatalf("ParseTraceParent(%q) valid = %v, want %v", tt.traceparent, ok, tt.valid)
+			}
+			if ok && (tc.TraceIDString() != "4bf92f3577b34da6a3ce929d0e0e4736" || tc.State != "vendor=value") {
+				t.Errorf("unexpected trace context %+v", tc)
+			}
+		})
+	}
+}
+
+func TestTraceContextPropagation(t *testing.T) {
+	headers := make(chan http.Header, 1)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header.Clone()
+		json.NewEncoder(w).Encode(map[string]string{"providers.v1": "/v1/providers/"})
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+
+	incoming, _ := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "vendor=value")
+	cache := NewDiscoveryCache(time.Minute, server.Client(), newTestLogger())
+	if _, err := cache.DiscoverServices(WithTraceContext(context.Background(), incoming), u.Host); err != nil {
+		t.Fatalf("DiscoverServices failed: %v", err)
+	}
+
+	// The upstream request continues the trace as a child of the caller's span
+	header := <-headers
+	sent, ok := ParseTraceParent(header.Get("traceparent"), header.Get("tracestate"))
+	if !ok {
+		t.Fatalf("invalid traceparent sent upstream: %q", header.Get("traceparent"))
+	}
+	if sent.TraceID != incoming.TraceID || sent.Flags != incoming.Flags || sent.State != "vendor=value" {
+		t.Errorf("expected trace %s to continue, sent %s", incoming.TraceParent(), header.Get("traceparent"))
+	}
+	if sent.SpanID == incoming.SpanID {
+		t.Errorf("expected a new span ID, got the caller's")
+	}
+
+	// Requests outside a client request start a new trace
+	cache.Clear()
+	if _, err := cache.DiscoverServices(context.Background(), u.Host); err != nil {
+		t.Fatalf("DiscoverServices failed: %v", err)
+	}
+	header = <-headers
+	if fresh, ok := ParseTraceParent(header.Get("traceparent"), ""); !ok || fresh.TraceID == incoming.TraceID {
+		t.Errorf("expected a new trace, got %q", header.Get("traceparent"))
+	}
+	if !strings.HasPrefix(header.Get("traceparent"), "00-") || header.Get("tracestate") != "" {
+		t.Errorf("unexpected trace headers %v", header)
+	}
+}
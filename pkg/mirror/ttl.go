@@ -0,0 +1,39 @@
+package mirror
+
+import (
+	"context"
+	"time"
+)
+
+// MetadataTTL controls how long a cached provider index is served before it is fetched again
+// Version metadata is not affected, published versions do not change
+// Zero durations keep the index until it is refreshed or purged
+type MetadataTTL struct {
+	// Default applies to providers without an override
+	Default time.Duration
+	// Overrides set the TTL of the providers they match
+	Overrides ProviderRules[time.Duration]
+}
+
+// SetMetadataTTL sets how long cached provider indices are served before they are fetched again
+// Expiry needs a storage that reports modification times, other storages keep indices forever
+// Must be called before the mirror is used
+func (m *Mirror) SetMetadataTTL(ttl MetadataTTL) {
+	m.ttl = ttl
+}
+
+// indexExpired reports whether the cached index of a provider is past its TTL
+func (m *Mirror) indexExpired(ctx context.Context, hostname, namespace, providerType string) bool {
+	ttl, ok := m.ttl.Overrides.Lookup(hostname, namespace, providerType)
+	if !ok {
+		ttl = m.ttl.Default
+	}
+	if ttl <= 0 {
+		return false
+	}
+	written, err := m.indexWritten(ctx, hostname, namespace, providerType)
+	if err != nil {
+		return false
+	}
+	return time.Since(written) >= ttl
+}
@@ -0,0 +1,73 @@
+package mirror
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/elisiariocouto/specular/pkg/registrytest"
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+func TestProviderRules_Lookup(t *testing.T) {
+	rules := ProviderRules[string]{
+		"registry.example.com":                 "host",
+		"registry.example.com/internal":        "namespace",
+		"registry.example.com/internal/netbox": "provider",
+		"registry.terraform.io/hashicorp/aws":  "aws",
+	}
+	tests := []struct {
+		hostname, namespace, providerType string
+		want                              string
+		found                             bool
+	}{
+		{"registry.example.com", "internal", "netbox", "provider", true},
+		{"registry.example.com", "internal", "vault", "namespace", true},
+		{"registry.example.com", "platform", "vault", "host", true},
+		{"registry.terraform.io", "hashicorp", "aws", "aws", true},
+		{"registry.terraform.io", "hashicorp", "google", "", false},
+	}
+	for _, tt := range tests {
+		got, found := rules.Lookup(tt.hostname, tt.namespace, tt.providerType)
+		if got != tt.want || found != tt.found {
+			t.Errorf("Lookup(%s/%s/%s) = %q, %v, want %q, %v", tt.hostname, tt.namespace, tt.providerType, got, found, tt.want, tt.found)
+		}
+	}
+}
+
+func TestMetadataTTL(t *testing.T) {
+	mirror, _, registry, archive := newCachePolicyTestMirror(t, CachePolicies{})
+	hostname := registry.Hostname()
+	registry.AddPackage("hashicorp", "random", "3.0.0", "linux", "amd64", archive)
+
+	// The override expires the aws index right away, random keeps the default of never expiring
+	mirror.SetMetadataTTL(MetadataTTL{Overrides: ProviderRules[time.Duration]{hostname + "/hashicorp/aws": time.Nanosecond}})
+	for range 2 {
+		for _, providerType := range []string{"aws", "random"} {
+			if _, err := mirror.GetIndex(context.Background(), hostname, "hashicorp", providerType); err != nil {
+				t.Fatalf("GetIndex(%s) failed: %v", providerType, err)
+			}
+		}
+	}
+	if n := registry.Requests(registrytest.VersionsPath("hashicorp", "aws")); n != 2 {
+		t.Errorf("aws versions endpoint called %d times, want 2", n)
+	}
+	if n := registry.Requests(registrytest.VersionsPath("hashicorp", "random")); n != 1 {
+		t.Errorf("random versions endpoint called %d times, want 1", n)
+	}
+
+	// Only the index that does not expire can validate conditional requests by date
+	if _, err := mirror.IndexModTime(context.Background(), hostname, "hashicorp", "aws"); !storage.IsNotFound(err) {
+		t.Errorf("expected no modification time for an expired index, got %v", err)
+	}
+	if _, err := mirror.IndexModTime(context.Background(), hostname, "hashicorp", "random"); err != nil {
+		t.Errorf("IndexModTime(random) failed: %v", err)
+	}
+
+	// An expired index is still served when upstream fails
+	registry.Fail(http.StatusBadGateway)
+	if _, err := mirror.GetIndex(context.Background(), hostname, "hashicorp", "aws"); err != nil {
+		t.Errorf("expected expired index to be served while upstream fails, got %v", err)
+	}
+}
@@ -0,0 +1,217 @@
+package mirror
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when a provider is not found upstream
+	ErrNotFound = errors.New("provider not found")
+	// ErrValidation is matched by every error caused by invalid request parameters
+	ErrValidation = errors.New("invalid request")
+	// ErrInvalidURL is returned when a URL is invalid
+	ErrInvalidURL error = &kindError{msg: "invalid URL", kind: ErrValidation}
+	// ErrInvalidAddress is returned when a provider address is invalid
+	ErrInvalidAddress error = &kindError{msg: "invalid provider address", kind: ErrValidation}
+	// ErrUpstreamUnavailable is returned when the upstream registry cannot be reached or answers with an error
+	ErrUpstreamUnavailable = errors.New("upstream registry unavailable")
+	// ErrUpstreamTimeout is returned when the upstream registry answers with 504 Gateway Timeout, it is a kind of ErrUpstreamUnavailable
+	ErrUpstreamTimeout error = &kindError{msg: "upstream registry timed out", kind: ErrUpstreamUnavailable}
+	// ErrUpstreamRateLimited is matched by RateLimitError
+	ErrUpstreamRateLimited = errors.New("upstream registry rate limited")
+	// ErrStorageFailure is returned when the cache storage fails to read or write an entry
+	ErrStorageFailure = errors.New("storage failure")
+	// ErrVersionWithdrawn is returned for versions upstream marks yanked or deprecated, when they are blocked
+	ErrVersionWithdrawn = errors.New("provider version withdrawn")
+)
+
+// kindError is a sentinel error that also matches the broader error it is a kind of
+type kindError struct {
+	msg  string
+	kind error
+}
+
+func (e *kindError) Error() string { return e.msg }
+
+func (e *kindError) Unwrap() error { return e.kind }
+
+// RateLimitError is returned when the upstream registry answers with 429 Too Many Requests
+type RateLimitError struct {
+	// RetryAfter is how long upstream asked clients to wait, or zero if it did not say
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("%s, retry after %s", ErrUpstreamRateLimited, e.RetryAfter)
+	}
+	return ErrUpstreamRateLimited.Error()
+}
+
+func (e *RateLimitError) Unwrap() error { return ErrUpstreamRateLimited }
+
+// VersionInfo contains metadata about a provider version
+// The mirror protocol reserves this object for extensions, Terraform ignores unknown fields
+type VersionInfo struct {
+	// Protocols lists the plugin protocol versions the provider supports, when upstream reports them
+	Protocols []string `json:"protocols,omitempty"`
+	// Deprecated and Yanked are set when upstream marks the version so, few registries do
+	Deprecated bool `json:"deprecated,omitempty"`
+	Yanked     bool `json:"yanked,omitempty"`
+}
+
+// Withdrawn reports whether upstream marked the version yanked or deprecated
+func (v VersionInfo) Withdrawn() bool {
+	return v.Deprecated || v.Yanked
+}
+
+// IndexResponse represents the response to a provider index request
+// Returned by GET /:hostname/:namespace/:type/index.json
+type IndexResponse struct {
+	Versions map[string]VersionInfo `json:"versions"`
+}
+
+// VersionResponse represents the response to a provider version request
+// Returned by GET /:hostname/:namespace/:type/:version.json
+type VersionResponse struct {
+	Archives map[string]Archive `json:"archives"`
+	// Protocols lists the plugin protocol versions the provider supports, when upstream reports them
+	Protocols []string `json:"protocols,omitempty"`
+}
+
+// Archive represents a downloadable provider package
+type Archive struct {
+	URL    string   `json:"url"`
+	Hashes []string `json:"hashes,omitempty"`
+}
+
+// ValidateURL checks if the archive URL is valid
+func (a *Archive) ValidateURL() error {
+	if a.URL == "" {
+		return ErrInvalidURL
+	}
+	_, err := url.Parse(a.URL)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+	return nil
+}
+
+// RegistryVersionsResponse is the full response from the registry /versions API
+type RegistryVersionsResponse struct {
+	Versions []RegistryVersion `json:"versions"`
+}
+
+// RegistryVersion represents a single version in the registry versions response
+type RegistryVersion struct {
+	Version   string             `json:"version"`
+	Protocols []string           `json:"protocols,omitempty"`
+	Platforms []RegistryPlatform `json:"platforms"`
+	// PublishedAt is only reported by some registries
+	PublishedAt *time.Time `json:"published_at,omitempty"`
+	// Deprecation and Yanked are only reported by some registries
+	Deprecation *RegistryDeprecation `json:"deprecation,omitempty"`
+	Yanked      bool                 `json:"yanked,omitempty"`
+}
+
+// RegistryDeprecation explains why a registry deprecated a version
+type RegistryDeprecation struct {
+	Reason string `json:"reason,omitempty"`
+	Link   string `json:"link,omitempty"`
+}
+
+// RegistryPlatform represents a platform in the registry versions response
+type RegistryPlatform struct {
+	OS   string `json:"os"`
+	Arch string `json:"arch"`
+}
+
+// DownloadInfo holds the download metadata from registry
+type DownloadInfo struct {
+	DownloadURL string   `json:"download_url"`
+	Shasum      string   `json:"shasum"`
+	ShasumsURL  string   `json:"shasums_url,omitempty"`
+	Protocols   []string `json:"protocols,omitempty"`
+}
+
+// ProviderAddress represents a provider's network address
+type ProviderAddress struct {
+	Hostname  string
+	Namespace string
+	Type      string
+}
+
+var (
+	// hostnamePattern matches lowercase DNS names with an optional port
+	hostnamePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?(\.[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?)*(:[0-9]{1,5})?$`)
+	// providerPartPattern matches namespaces and types as normalized by Terraform
+	providerPartPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9_-]{0,62}[a-z0-9])?$`)
+	// versionPattern matches semantic versions
+	versionPattern = regexp.MustCompile(`^[0-9]+\.[0-9]+\.[0-9]+(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+	// platformPartPattern matches operating systems and architectures such as linux or amd64
+	platformPartPattern = regexp.MustCompile(`^[a-z0-9]{1,32}$`)
+	// filenamePattern matches archive file names
+	filenamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+-]{0,254}$`)
+)
+
+// maxHostnameLength is the longest hostname allowed by DNS
+const maxHostnameLength = 253
+
+// maxVersionLength bounds version strings, including pre-release and build metadata
+const maxVersionLength = 128
+
+// Validate checks if the provider address is valid
+// Hostnames must be lowercase DNS names, namespaces and types follow the registry naming rules
+func (p *ProviderAddress) Validate() error {
+	if p.Hostname == "" {
+		return fmt.Errorf("%w: hostname is required", ErrInvalidAddress)
+	}
+	if p.Namespace == "" {
+		return fmt.Errorf("%w: namespace is required", ErrInvalidAddress)
+	}
+	if p.Type == "" {
+		return fmt.Errorf("%w: type is required", ErrInvalidAddress)
+	}
+	if len(p.Hostname) > maxHostnameLength || !hostnamePattern.MatchString(p.Hostname) {
+		return fmt.Errorf("%w: invalid hostname %q", ErrInvalidAddress, p.Hostname)
+	}
+	if !providerPartPattern.MatchString(p.Namespace) {
+		return fmt.Errorf("%w: invalid namespace %q, must be lowercase letters, digits, dashes and underscores", ErrInvalidAddress, p.Namespace)
+	}
+	if !providerPartPattern.MatchString(p.Type) {
+		return fmt.Errorf("%w: invalid type %q, must be lowercase letters, digits, dashes and underscores", ErrInvalidAddress, p.Type)
+	}
+	return nil
+}
+
+// ValidateVersion checks that version is a semantic version
+func ValidateVersion(version string) error {
+	if len(version) > maxVersionLength || !versionPattern.MatchString(version) {
+		return fmt.Errorf("%w: invalid version %q", ErrInvalidAddress, version)
+	}
+	return nil
+}
+
+// ValidatePlatform checks the operating system and architecture of a provider package
+func ValidatePlatform(os, arch string) error {
+	if !platformPartPattern.MatchString(os) {
+		return fmt.Errorf("%w: invalid os %q", ErrInvalidAddress, os)
+	}
+	if !platformPartPattern.MatchString(arch) {
+		return fmt.Errorf("%w: invalid arch %q", ErrInvalidAddress, arch)
+	}
+	return nil
+}
+
+// ValidateFilename checks that filename is a plain archive file name
+func ValidateFilename(filename string) error {
+	if !filenamePattern.MatchString(filename) || strings.Contains(filename, "..") {
+		return fmt.Errorf("%w: invalid filename %q", ErrInvalidAddress, filename)
+	}
+	return nil
+}
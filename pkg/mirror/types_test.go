@@ -2,6 +2,7 @@ package mirror
 
 import (
 	"errors"
+	"strings"
 	"testing"
 )
 
@@ -133,6 +134,59 @@ func TestProviderAddressValidate(t *testing.T) {
 			errType:   ErrInvalidAddress,
 			errSubstr: "type is required",
 		},
+		{
+			name: "uppercase namespace",
+			address: ProviderAddress{
+				Hostname:  "registry.terraform.io",
+				Namespace: "HashiCorp",
+				Type:      "aws",
+			},
+			wantErr:   true,
+			errType:   ErrInvalidAddress,
+			errSubstr: "invalid namespace",
+		},
+		{
+			name: "type with invalid characters",
+			address: ProviderAddress{
+				Hostname:  "registry.terraform.io",
+				Namespace: "hashicorp",
+				Type:      "aws;rm -rf",
+			},
+			wantErr:   true,
+			errType:   ErrInvalidAddress,
+			errSubstr: "invalid type",
+		},
+		{
+			name: "type too long",
+			address: ProviderAddress{
+				Hostname:  "registry.terraform.io",
+				Namespace: "hashicorp",
+				Type:      strings.Repeat("a", 65),
+			},
+			wantErr:   true,
+			errType:   ErrInvalidAddress,
+			errSubstr: "invalid type",
+		},
+		{
+			name: "hostname with port",
+			address: ProviderAddress{
+				Hostname:  "registry.example.com:8443",
+				Namespace: "hashicorp",
+				Type:      "aws",
+			},
+			wantErr: false,
+		},
+		{
+			name: "hostname with traversal",
+			address: ProviderAddress{
+				Hostname:  "..",
+				Namespace: "hashicorp",
+				Type:      "aws",
+			},
+			wantErr:   true,
+			errType:   ErrInvalidAddress,
+			errSubstr: "invalid hostname",
+		},
 		{
 			name: "all fields empty",
 			address: ProviderAddress{
@@ -240,3 +294,34 @@ func TestDownloadInfo(t *testing.T) {
 		}
 	})
 }
+
+func TestValidatePathParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		wantErr bool
+	}{
+		{name: "version", err: ValidateVersion("5.70.0")},
+		{name: "pre-release version", err: ValidateVersion("1.0.0-beta.1+build.5")},
+		{name: "partial version", err: ValidateVersion("1.0"), wantErr: true},
+		{name: "version with path", err: ValidateVersion("1.0.0/../x"), wantErr: true},
+		{name: "platform", err: ValidatePlatform("linux", "amd64")},
+		{name: "uppercase os", err: ValidatePlatform("Linux", "amd64"), wantErr: true},
+		{name: "empty arch", err: ValidatePlatform("linux", ""), wantErr: true},
+		{name: "filename", err: ValidateFilename("terraform-provider-aws_5.70.0_linux_amd64.zip")},
+		{name: "hidden filename", err: ValidateFilename(".tmp-123"), wantErr: true},
+		{name: "filename traversal", err: ValidateFilename("a..zip"), wantErr: true},
+		{name: "filename with space", err: ValidateFilename("a b.zip"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if (tt.err != nil) != tt.wantErr {
+				t.Errorf("error = %v, wantErr %v", tt.err, tt.wantErr)
+			}
+			if tt.err != nil && !errors.Is(tt.err, ErrInvalidAddress) {
+				t.Errorf("error = %v, want ErrInvalidAddress", tt.err)
+			}
+		})
+	}
+}
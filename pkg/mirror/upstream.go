@@ -0,0 +1,552 @@
+package mirror
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elisiariocouto/specular/pkg/metrics"
+)
+
+// UpstreamClient handles fetching from the upstream registry
+type UpstreamClient struct {
+	httpClient     *http.Client
+	maxRetries     int
+	logger         *slog.Logger
+	discoveryCache *DiscoveryCache
+	metrics        *metrics.Metrics
+	// sources replace the discovered providers.v1 endpoint of matching providers
+	sources ProviderRules[string]
+	// health fails requests fast to registries whose circuit breaker is open
+	health *HealthMonitor
+	// limiter spaces out requests made for background work, nil when they are not limited
+	limiter *HostLimiter
+	// budget bounds archive downloads made for background work, nil when they are not bounded
+	budget *DownloadBudget
+}
+
+// NewUpstreamClient creates a new upstream client
+func NewUpstreamClient(timeout time.Duration, maxRetries int, discoveryCacheTTL time.Duration, logger *slog.Logger) *UpstreamClient {
+	// Create HTTP client with connection pooling and timeouts
+	httpClient := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			MaxIdleConns:        100,
+			MaxIdleConnsPerHost: 10,
+			IdleConnTimeout:     90 * time.Second,
+			DisableCompression:  false,
+		},
+	}
+
+	// Create discovery cache with configurable TTL
+	discoveryCache := NewDiscoveryCache(discoveryCacheTTL, httpClient, logger)
+
+	return &UpstreamClient{
+		httpClient:     httpClient,
+		maxRetries:     maxRetries,
+		logger:         logger,
+		discoveryCache: discoveryCache,
+	}
+}
+
+// SetHTTPClient replaces the HTTP client used for upstream requests and service discovery
+// Must be called before the client is used
+func (uc *UpstreamClient) SetHTTPClient(client *http.Client) {
+	uc.httpClient = client
+	uc.discoveryCache.client = client
+}
+
+// SetProviderSources fetches the providers matched by rules from another registry's providers.v1 endpoint
+// Each value is the full endpoint URL (e.g., https://registry.example.com/v1/providers/), used instead of service discovery
+// Must be called before the client is used
+func (uc *UpstreamClient) SetProviderSources(rules ProviderRules[string]) {
+	uc.sources = rules
+}
+
+// SetHealthMonitor makes requests to registries that failed their health probes fail fast
+// Must be called before the client is used
+func (uc *UpstreamClient) SetHealthMonitor(hm *HealthMonitor) {
+	uc.health = hm
+}
+
+// Health returns the health of the probed registries, nil when they are not probed
+func (uc *UpstreamClient) Health() []UpstreamHealth {
+	if uc.health == nil {
+		return nil
+	}
+	return uc.health.Status()
+}
+
+// DiscoveryCache returns the cache of service discovery responses
+func (uc *UpstreamClient) DiscoveryCache() *DiscoveryCache {
+	return uc.discoveryCache
+}
+
+// SetMetrics enables recording the bytes fetched from upstream
+// Must be called before the client is used
+func (uc *UpstreamClient) SetMetrics(m *metrics.Metrics) {
+	uc.metrics = m
+}
+
+// recordBytes records bytes fetched from upstream when metrics are set
+func (uc *UpstreamClient) recordBytes(resourceType string, n int64) {
+	if uc.metrics != nil {
+		uc.metrics.RecordUpstreamBytes(resourceType, n)
+	}
+}
+
+// getProvidersEndpoint discovers and returns the providers.v1 API endpoint for a provider
+// Uses the provider's configured source if any, service discovery with caching otherwise
+func (uc *UpstreamClient) getProvidersEndpoint(ctx context.Context, hostname, namespace, providerType string) (string, error) {
+	if source, ok := uc.sources.Lookup(hostname, namespace, providerType); ok {
+		return strings.TrimSuffix(source, "/"), nil
+	}
+
+	// Try service discovery first
+	discovery, err := uc.discoveryCache.DiscoverServices(ctx, hostname)
+	if err != nil {
+		uc.logger.DebugContext(ctx, "service discovery failed, using fallback",
+			slog.String("hostname", hostname),
+			slog.String("error", err.Error()))
+		// Fallback: assume standard HTTPS endpoint
+		return fmt.Sprintf("https://%s", hostname), fmt.Errorf("service discovery failed: %w", err)
+	}
+
+	// The ProvidersV1 field contains a path (e.g., "/v1/providers/")
+	// We need to construct the full URL by combining with the hostname
+	providersPath := strings.TrimSuffix(discovery.ProvidersV1, "/")
+	fullURL := fmt.Sprintf("https://%s%s", hostname, providersPath)
+
+	return fullURL, nil
+}
+
+// FetchIndex fetches the index.json for a provider
+// Returns both the simplified IndexResponse and the full RegistryVersionsResponse
+func (uc *UpstreamClient) FetchIndex(ctx context.Context, hostname, namespace, providerType string) (*IndexResponse, *RegistryVersionsResponse, error) {
+	if err := uc.checkBreaker(hostname); err != nil {
+		return nil, nil, err
+	}
+
+	// Use service discovery to get the providers endpoint
+	endpoint, err := uc.getProvidersEndpoint(ctx, hostname, namespace, providerType)
+	if err != nil {
+		uc.logger.DebugContext(ctx, "service discovery failed, using fallback",
+			slog.String("hostname", hostname),
+			slog.String("error", err.Error()))
+		// Fallback to mirror protocol format
+		url := fmt.Sprintf("https://%s/%s/%s/index.json", hostname, namespace, providerType)
+
+		body, status, fetchErr := uc.fetch(ctx, url, "index")
+		if fetchErr != nil {
+			return nil, nil, fetchErr
+		}
+
+		if status == http.StatusNotFound {
+			return nil, nil, ErrNotFound
+		}
+
+		if status != http.StatusOK {
+			return nil, nil, unexpectedStatus(status)
+		}
+
+		var response IndexResponse
+		if err := json.Unmarshal(body, &response); err != nil {
+			return nil, nil, fmt.Errorf("%w: failed to parse index response: %w", ErrUpstreamUnavailable, err)
+		}
+
+		return &response, nil, nil
+	}
+
+	// Use discovered providers.v1 endpoint
+	url := fmt.Sprintf("%s/%s/%s/versions", endpoint, namespace, providerType)
+
+	uc.logger.DebugContext(ctx, "fetching provider versions from upstream",
+		slog.String("url", url),
+		slog.String("hostname", hostname),
+		slog.String("namespace", namespace),
+		slog.String("type", providerType))
+
+	body, status, err := uc.fetch(ctx, url, "index")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if status == http.StatusNotFound {
+		return nil, nil, ErrNotFound
+	}
+
+	if status != http.StatusOK {
+		return nil, nil, unexpectedStatus(status)
+	}
+
+	// Convert registry API response to mirror protocol format
+	return uc.convertRegistryAPIToIndexResponse(body)
+}
+
+// FetchVersion fetches the version.json for a specific provider version
+// For registries with service discovery, this returns ErrNotFound to signal
+// that version.json should be built from cached versions response
+func (uc *UpstreamClient) FetchVersion(ctx context.Context, hostname, namespace, providerType, version string) (*VersionResponse, error) {
+	// Check if this registry supports service discovery
+	_, err := uc.getProvidersEndpoint(ctx, hostname, namespace, providerType)
+	if err == nil {
+		// Registry has service discovery - version.json should be built from cache
+		uc.logger.DebugContext(ctx, "registry uses service discovery, version will be built from cache",
+			slog.String("hostname", hostname),
+			slog.String("namespace", namespace),
+			slog.String("type", providerType),
+			slog.String("version", version))
+		return nil, ErrNotFound
+	}
+
+	if err := uc.checkBreaker(hostname); err != nil {
+		return nil, err
+	}
+
+	// Fallback: use provider network mirror protocol format
+	url := fmt.Sprintf("https://%s/%s/%s/%s.json", hostname, namespace, providerType, version)
+
+	uc.logger.DebugContext(ctx, "fetching version metadata from mirror protocol",
+		slog.String("url", url))
+
+	body, status, err := uc.fetch(ctx, url, "version")
+	if err != nil {
+		return nil, err
+	}
+
+	if status == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+
+	if status != http.StatusOK {
+		return nil, unexpectedStatus(status)
+	}
+
+	var response VersionResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("%w: failed to parse version response: %w", ErrUpstreamUnavailable, err)
+	}
+
+	return &response, nil
+}
+
+// FetchArchive fetches a provider archive from a URL
+// The archiveURL must be an absolute URL
+func (uc *UpstreamClient) FetchArchive(ctx context.Context, archiveURL string) (io.ReadCloser, error) {
+	// Validate URL
+	parsedURL, err := url.Parse(archiveURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid archive URL: %w", ErrUpstreamUnavailable, err)
+	}
+
+	if parsedURL.Scheme == "" || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") {
+		return nil, fmt.Errorf("%w: archive URL must use http or https scheme, got: %s", ErrUpstreamUnavailable, parsedURL.Scheme)
+	}
+
+	if parsedURL.Host == "" {
+		return nil, fmt.Errorf("%w: archive URL must have a host", ErrUpstreamUnavailable)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, archiveURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if err := uc.wait(ctx, parsedURL.Host); err != nil {
+		return nil, err
+	}
+
+	// Background downloads take a slot of the budget until their body is closed
+	budget := uc.budget
+	if ctx.Value(backgroundKey{}) == nil {
+		budget = nil
+	}
+	if budget != nil {
+		if err := budget.acquire(ctx); err != nil {
+			return nil, err
+		}
+	}
+	release := func() {
+		if budget != nil {
+			budget.release()
+		}
+	}
+
+	injectTraceContext(req)
+	resp, err := uc.httpClient.Do(req)
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("%w: failed to fetch archive: %w", ErrUpstreamUnavailable, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		release()
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return nil, rateLimitError(resp)
+		}
+		return nil, unexpectedStatus(resp.StatusCode)
+	}
+
+	var body io.ReadCloser = &countingReader{ReadCloser: resp.Body, record: func(n int64) { uc.recordBytes("archive", n) }}
+	if budget != nil {
+		body = &budgetReader{ReadCloser: body, ctx: ctx, budget: budget}
+	}
+	return &archiveBody{ReadCloser: body, etag: resp.Header.Get("ETag"), lastModified: resp.Header.Get("Last-Modified")}, nil
+}
+
+// archiveBody is an archive download with the validators upstream sent for it
+type archiveBody struct {
+	io.ReadCloser
+	etag         string
+	lastModified string
+}
+
+// ArchiveValidators returns the ETag and Last-Modified headers upstream sent with an archive returned by FetchArchive
+func ArchiveValidators(body io.Reader) (etag, lastModified string) {
+	if b, ok := body.(*archiveBody); ok {
+		return b.etag, b.lastModified
+	}
+	return "", ""
+}
+
+// countingReader reports the bytes read from an upstream response body
+type countingReader struct {
+	io.ReadCloser
+	record func(n int64)
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.record(int64(n))
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("%w: %w", ErrUpstreamUnavailable, err)
+	}
+	return n, err
+}
+
+// unexpectedStatus reports an upstream response that is neither a success nor a not found
+func unexpectedStatus(status int) error {
+	if status == http.StatusGatewayTimeout {
+		return fmt.Errorf("%w: unexpected status code: %d", ErrUpstreamTimeout, status)
+	}
+	return fmt.Errorf("%w: unexpected status code: %d", ErrUpstreamUnavailable, status)
+}
+
+// rateLimitError builds a RateLimitError from the Retry-After header of a 429 response
+func rateLimitError(resp *http.Response) error {
+	rateErr := &RateLimitError{}
+	value := resp.Header.Get("Retry-After")
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		rateErr.RetryAfter = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(value); err == nil {
+		rateErr.RetryAfter = max(time.Until(at).Round(time.Second), 0)
+	}
+	return rateErr
+}
+
+// handleResponse processes HTTP response and extracts body, with proper cleanup
+func (uc *UpstreamClient) handleResponse(resp *http.Response, resourceType string) ([]byte, error) {
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	uc.recordBytes(resourceType, int64(len(body)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read response body: %w", ErrUpstreamUnavailable, err)
+	}
+	return body, nil
+}
+
+// shouldRetry determines if a request should be retried based on status code
+func (uc *UpstreamClient) shouldRetry(statusCode int, attempt int) bool {
+	if statusCode >= 500 && attempt < uc.maxRetries {
+		return true
+	}
+	return false
+}
+
+// exponentialBackoff waits for exponential backoff duration, respecting context cancellation
+func exponentialBackoff(ctx context.Context, attempt int) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(time.Duration(1<<uint(attempt)) * time.Second):
+		return nil
+	}
+}
+
+// fetch performs an HTTP GET request with retry logic
+func (uc *UpstreamClient) fetch(ctx context.Context, url, resourceType string) ([]byte, int, error) {
+	var lastErr error
+	var lastStatus int
+
+	for attempt := 0; attempt <= uc.maxRetries; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to create request: %w", err)
+		}
+		if err := uc.wait(ctx, req.URL.Host); err != nil {
+			return nil, 0, err
+		}
+
+		injectTraceContext(req)
+		resp, err := uc.httpClient.Do(req)
+		if err != nil {
+			lastErr = err
+			if attempt < uc.maxRetries {
+				if backoffErr := exponentialBackoff(ctx, attempt); backoffErr != nil {
+					return nil, 0, backoffErr
+				}
+				continue
+			}
+			continue
+		}
+
+		lastStatus = resp.StatusCode
+
+		// Don't retry on client errors (4xx)
+		if resp.StatusCode == http.StatusTooManyRequests {
+			resp.Body.Close()
+			return nil, resp.StatusCode, rateLimitError(resp)
+		}
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+			body, err := uc.handleResponse(resp, resourceType)
+			return body, resp.StatusCode, err
+		}
+
+		// Retry on server errors (5xx)
+		if uc.shouldRetry(resp.StatusCode, attempt) {
+			resp.Body.Close()
+			if backoffErr := exponentialBackoff(ctx, attempt); backoffErr != nil {
+				return nil, resp.StatusCode, backoffErr
+			}
+			lastErr = fmt.Errorf("server error: %d", resp.StatusCode)
+			continue
+		}
+
+		// Success or final attempt
+		body, err := uc.handleResponse(resp, resourceType)
+		return body, resp.StatusCode, err
+	}
+
+	if lastErr != nil {
+		return nil, lastStatus, fmt.Errorf("%w: %w", ErrUpstreamUnavailable, lastErr)
+	}
+	return nil, lastStatus, fmt.Errorf("%w: max retries exceeded for URL: %s", ErrUpstreamUnavailable, url)
+}
+
+// convertRegistryAPIToIndexResponse converts registry API response to mirror protocol IndexResponse
+// Also returns the full RegistryVersionsResponse for caching
+func (uc *UpstreamClient) convertRegistryAPIToIndexResponse(data []byte) (*IndexResponse, *RegistryVersionsResponse, error) {
+	var registryResponse RegistryVersionsResponse
+
+	if err := json.Unmarshal(data, &registryResponse); err != nil {
+		return nil, nil, fmt.Errorf("%w: failed to parse registry API response: %w", ErrUpstreamUnavailable, err)
+	}
+
+	// Convert to mirror protocol format
+	versions := make(map[string]VersionInfo)
+	for _, v := range registryResponse.Versions {
+		versions[v.Version] = VersionInfo{
+			Protocols:  v.Protocols,
+			Deprecated: v.Deprecation != nil,
+			Yanked:     v.Yanked,
+		}
+	}
+
+	indexResponse := &IndexResponse{
+		Versions: versions,
+	}
+
+	return indexResponse, &registryResponse, nil
+}
+
+// FetchDownloadURL fetches the download information for a specific provider version and platform
+func (uc *UpstreamClient) FetchDownloadURL(ctx context.Context, hostname, namespace, providerType, version, os, arch string) (*DownloadInfo, error) {
+	if err := uc.checkBreaker(hostname); err != nil {
+		return nil, err
+	}
+
+	// Get providers endpoint via service discovery
+	endpoint, err := uc.getProvidersEndpoint(ctx, hostname, namespace, providerType)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to discover services: %w", ErrUpstreamUnavailable, err)
+	}
+
+	// Build download API URL: {endpoint}/{namespace}/{type}/{version}/download/{os}/{arch}
+	url := fmt.Sprintf("%s/%s/%s/%s/download/%s/%s",
+		endpoint, namespace, providerType, version, os, arch)
+
+	uc.logger.DebugContext(ctx, "fetching download URL from registry",
+		slog.String("url", url),
+		slog.String("os", os),
+		slog.String("arch", arch))
+
+	body, status, err := uc.fetch(ctx, url, "download_info")
+	if err != nil {
+		return nil, err
+	}
+
+	if status == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+
+	if status != http.StatusOK {
+		return nil, unexpectedStatus(status)
+	}
+
+	var info DownloadInfo
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, fmt.Errorf("%w: failed to parse download info: %w", ErrUpstreamUnavailable, err)
+	}
+
+	uc.logger.DebugContext(ctx, "received download URL from registry",
+		slog.String("download_url", info.DownloadURL))
+
+	return &info, nil
+}
+
+// FetchShasums fetches a SHA256SUMS file and returns the hex SHA-256 of each listed file, keyed by file name
+func (uc *UpstreamClient) FetchShasums(ctx context.Context, shasumsURL string) (map[string]string, error) {
+	body, status, err := uc.fetch(ctx, shasumsURL, "shasums")
+	if err != nil {
+		return nil, err
+	}
+
+	if status == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+
+	if status != http.StatusOK {
+		return nil, unexpectedStatus(status)
+	}
+
+	return parseShasums(body)
+}
+
+// parseShasums parses the output of sha256sum, one "<hex>  <filename>" line per file
+func parseShasums(data []byte) (map[string]string, error) {
+	sums := make(map[string]string)
+	for line := range strings.Lines(string(data)) {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 || len(fields[0]) != 2*sha256.Size {
+			return nil, fmt.Errorf("%w: invalid SHA256SUMS line: %q", ErrUpstreamUnavailable, strings.TrimSpace(line))
+		}
+		// Binary mode marks file names with a leading asterisk
+		if _, err := hex.DecodeString(fields[0]); err != nil {
+			return nil, fmt.Errorf("%w: invalid SHA256SUMS line: %q", ErrUpstreamUnavailable, strings.TrimSpace(line))
+		}
+		sums[strings.TrimPrefix(fields[1], "*")] = strings.ToLower(fields[0])
+	}
+	return sums, nil
+}
@@ -3,6 +3,7 @@ package mirror
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -12,6 +13,11 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/elisiariocouto/specular/pkg/metrics"
+	"github.com/elisiariocouto/specular/pkg/registrytest"
+	"github.com/elisiariocouto/specular/pkg/storage"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func newTestUpstreamClient(server *httptest.Server) *UpstreamClient {
@@ -66,6 +72,76 @@ func TestFetchArchive_ValidURL(t *testing.T) {
 	}
 }
 
+func TestUpstreamBytesRecorded(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("archive content"))
+	}))
+	defer server.Close()
+
+	client := newTestUpstreamClient(server)
+	m := metrics.New(nil, metrics.Options{})
+	client.SetMetrics(m)
+
+	body, err := client.FetchArchive(context.Background(), server.URL+"/provider.zip")
+	if err != nil {
+		t.Fatalf("FetchArchive failed: %v", err)
+	}
+	io.ReadAll(body)
+	body.Close()
+
+	if _, _, err := client.fetch(context.Background(), server.URL, "index"); err != nil {
+		t.Fatalf("fetch failed: %v", err)
+	}
+
+	if got := testutil.ToFloat64(m.UpstreamBytesTotal.WithLabelValues("archive")); got != 15 {
+		t.Errorf("expected 15 archive bytes, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.UpstreamBytesTotal.WithLabelValues("index")); got != 15 {
+		t.Errorf("expected 15 index bytes, got %v", got)
+	}
+}
+
+func TestFetch_ErrorKinds(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		retryAfter string
+		want       error
+		wantWait   time.Duration
+	}{
+		{"rate limited", http.StatusTooManyRequests, "30", ErrUpstreamRateLimited, 30 * time.Second},
+		{"rate limited without header", http.StatusTooManyRequests, "", ErrUpstreamRateLimited, 0},
+		{"server error", http.StatusBadGateway, "", ErrUpstreamUnavailable, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			client := newTestUpstreamClient(server)
+			client.maxRetries = 0
+			_, err := client.FetchArchive(context.Background(), server.URL+"/provider.zip")
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+			var rateErr *RateLimitError
+			if errors.As(err, &rateErr) && rateErr.RetryAfter != tt.wantWait {
+				t.Errorf("expected RetryAfter %s, got %s", tt.wantWait, rateErr.RetryAfter)
+			}
+
+			_, _, err = client.fetch(context.Background(), server.URL, "index")
+			if tt.status == http.StatusTooManyRequests && !errors.Is(err, ErrUpstreamRateLimited) {
+				t.Errorf("fetch: expected ErrUpstreamRateLimited, got %v", err)
+			}
+		})
+	}
+}
+
 func TestFetchArchive_InvalidURL(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
 	client := &UpstreamClient{
@@ -144,7 +220,7 @@ func TestHandleResponse(t *testing.T) {
 	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
 	resp, _ := client.httpClient.Do(req)
 
-	body, err := client.handleResponse(resp)
+	body, err := client.handleResponse(resp, "index")
 	if err != nil {
 		t.Fatalf("handleResponse failed: %v", err)
 	}
@@ -244,7 +320,7 @@ func TestFetch_Success(t *testing.T) {
 	defer server.Close()
 
 	client := newTestUpstreamClient(server)
-	body, status, err := client.fetch(context.Background(), server.URL)
+	body, status, err := client.fetch(context.Background(), server.URL, "index")
 
 	if err != nil {
 		t.Fatalf("fetch failed: %v", err)
@@ -264,7 +340,7 @@ func TestFetch_NotFound(t *testing.T) {
 	defer server.Close()
 
 	client := newTestUpstreamClient(server)
-	_, status, err := client.fetch(context.Background(), server.URL)
+	_, status, err := client.fetch(context.Background(), server.URL, "index")
 
 	if err != nil {
 		t.Fatalf("fetch returned error for 404: %v", err)
@@ -287,7 +363,7 @@ func TestFetch_ServerError_WithRetry(t *testing.T) {
 	defer server.Close()
 
 	client := newTestUpstreamClient(server)
-	body, status, err := client.fetch(context.Background(), server.URL)
+	body, status, err := client.fetch(context.Background(), server.URL, "index")
 
 	if err != nil {
 		t.Fatalf("fetch failed: %v", err)
@@ -314,7 +390,7 @@ func TestFetch_MaxRetriesExceeded(t *testing.T) {
 	client := newTestUpstreamClient(server)
 	client.maxRetries = 2
 
-	_, status, _ := client.fetch(context.Background(), server.URL)
+	_, status, _ := client.fetch(context.Background(), server.URL, "index")
 
 	// With maxRetries=2, we should get 3 attempts (initial + 2 retries)
 	if callCount != 3 {
@@ -340,7 +416,7 @@ func TestFetch_ContextCancellation(t *testing.T) {
 	// Start fetch in goroutine
 	done := make(chan error)
 	go func() {
-		_, _, err := client.fetch(ctx, server.URL)
+		_, _, err := client.fetch(ctx, server.URL, "index")
 		done <- err
 	}()
 
@@ -391,6 +467,21 @@ func TestFetchIndex_Success(t *testing.T) {
 	}
 }
 
+func TestFetchIndex_WithdrawnVersions(t *testing.T) {
+	client := &UpstreamClient{}
+	index, _, err := client.convertRegistryAPIToIndexResponse([]byte(`{"versions":[
+		{"version":"1.0.0","yanked":true},
+		{"version":"1.1.0","deprecation":{"reason":"security issue"}},
+		{"version":"1.2.0"}
+	]}`))
+	if err != nil {
+		t.Fatalf("convertRegistryAPIToIndexResponse failed: %v", err)
+	}
+	if !index.Versions["1.0.0"].Yanked || !index.Versions["1.1.0"].Deprecated || index.Versions["1.2.0"].Withdrawn() {
+		t.Errorf("unexpected withdrawn flags: %+v", index.Versions)
+	}
+}
+
 func TestFetchIndex_NotFound(t *testing.T) {
 	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNotFound)
@@ -486,3 +577,72 @@ func TestFetchDownloadURL_NotFound(t *testing.T) {
 		t.Errorf("expected ErrNotFound, got %v", err)
 	}
 }
+
+func TestParseShasums(t *testing.T) {
+	linux := strings.Repeat("a", 64)
+	darwin := strings.Repeat("B", 64)
+	sums, err := parseShasums([]byte(linux + "  terraform-provider-aws_1.0.0_linux_amd64.zip\n" +
+		darwin + " *terraform-provider-aws_1.0.0_darwin_arm64.zip\n\n"))
+	if err != nil {
+		t.Fatalf("parseShasums failed: %v", err)
+	}
+	if sums["terraform-provider-aws_1.0.0_linux_amd64.zip"] != linux {
+		t.Errorf("unexpected linux sum: %q", sums["terraform-provider-aws_1.0.0_linux_amd64.zip"])
+	}
+	if sums["terraform-provider-aws_1.0.0_darwin_arm64.zip"] != strings.ToLower(darwin) {
+		t.Errorf("unexpected darwin sum: %q", sums["terraform-provider-aws_1.0.0_darwin_arm64.zip"])
+	}
+
+	for _, invalid := range []string{
+		"abc  file.zip\n",
+		strings.Repeat("z", 64) + "  file.zip\n",
+		linux + "\n",
+	} {
+		if _, err := parseShasums([]byte(invalid)); !errors.Is(err, ErrUpstreamUnavailable) {
+			t.Errorf("parseShasums(%q) = %v, want ErrUpstreamUnavailable", invalid, err)
+		}
+	}
+}
+
+// TestProviderSources tests fetching a provider from a configured source instead of its discovered registry
+func TestProviderSources(t *testing.T) {
+	vendor := registrytest.NewServer()
+	defer vendor.Close()
+	archive := registrytest.Archive(map[string]string{"terraform-provider-widget": "binary"})
+	vendor.AddPackage("acme", "widget", "1.0.0", "linux", "amd64", archive)
+
+	upstream := NewUpstreamClient(10*time.Second, 2, time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	upstream.SetHTTPClient(vendor.Client())
+	// registry.invalid can never be discovered, only the source can serve the provider
+	upstream.SetProviderSources(ProviderRules[string]{"registry.invalid/acme": vendor.URL + registrytest.ProvidersPath})
+	mirror := NewMirror(storage.NewMemoryStorage(), upstream, "http://localhost:8080")
+	ctx := context.Background()
+
+	index, err := mirror.GetIndex(ctx, "registry.invalid", "acme", "widget")
+	if err != nil {
+		t.Fatalf("GetIndex failed: %v", err)
+	}
+	if !strings.Contains(string(index), `"1.0.0"`) {
+		t.Errorf("unexpected index %s", index)
+	}
+	if _, err := mirror.GetVersion(ctx, "registry.invalid", "acme", "widget", "1.0.0"); err != nil {
+		t.Fatalf("GetVersion failed: %v", err)
+	}
+	archivePath := "registry.invalid/acme/widget/" + registrytest.Filename("widget", "1.0.0", "linux", "amd64")
+	reader, err := mirror.GetArchive(ctx, "registry.invalid", "acme", "widget", "1.0.0", "linux", "amd64", archivePath)
+	if err != nil {
+		t.Fatalf("GetArchive failed: %v", err)
+	}
+	defer reader.Close()
+	if data, _ := io.ReadAll(reader); string(data) != string(archive) {
+		t.Errorf("archive has %d bytes, want %d", len(data), len(archive))
+	}
+	if n := vendor.Requests("/.well-known/terraform.json"); n != 0 {
+		t.Errorf("expected no service discovery, got %d requests", n)
+	}
+
+	// Providers without a source still use service discovery
+	if _, err := mirror.GetIndex(ctx, "registry.invalid", "other", "widget"); err == nil {
+		t.Error("expected providers without a source to fail on an undiscoverable hostname")
+	}
+}
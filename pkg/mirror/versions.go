@@ -0,0 +1,127 @@
+package mirror
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// compareVersions orders provider versions by semantic version precedence
+// Pre-releases sort before their release, versions that do not parse sort before all others
+func compareVersions(a, b string) int {
+	coreA, preA, okA := splitVersion(a)
+	coreB, preB, okB := splitVersion(b)
+	switch {
+	case !okA || !okB:
+		if okA != okB {
+			if okA {
+				return 1
+			}
+			return -1
+		}
+		return strings.Compare(a, b)
+	}
+	for i := range coreA {
+		if c := cmp.Compare(coreA[i], coreB[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case preA == preB:
+		return 0
+	case preA == "":
+		return 1
+	case preB == "":
+		return -1
+	}
+	return comparePrerelease(preA, preB)
+}
+
+// splitVersion splits major.minor.patch[-prerelease][+build] into numeric parts and the pre-release
+func splitVersion(version string) ([3]int, string, bool) {
+	var core [3]int
+	version, _, _ = strings.Cut(version, "+")
+	version, pre, _ := strings.Cut(version, "-")
+	parts := strings.Split(version, ".")
+	if len(parts) != 3 {
+		return core, "", false
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return core, "", false
+		}
+		core[i] = n
+	}
+	return core, pre, true
+}
+
+// comparePrerelease compares dot-separated pre-release identifiers, numeric ones numerically
+func comparePrerelease(a, b string) int {
+	partsA, partsB := strings.Split(a, "."), strings.Split(b, ".")
+	for i := range min(len(partsA), len(partsB)) {
+		numA, errA := strconv.Atoi(partsA[i])
+		numB, errB := strconv.Atoi(partsB[i])
+		var c int
+		switch {
+		case errA == nil && errB == nil:
+			c = cmp.Compare(numA, numB)
+		case errA == nil:
+			c = -1
+		case errB == nil:
+			c = 1
+		default:
+			c = strings.Compare(partsA[i], partsB[i])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(partsA), len(partsB))
+}
+
+// LatestVersion returns the most recent release of an index, or its most recent pre-release when it has no release
+// It returns an empty string for an empty index
+func LatestVersion(index IndexResponse) string {
+	var latest string
+	for version := range index.Versions {
+		_, pre, _ := splitVersion(version)
+		_, latestPre, _ := splitVersion(latest)
+		switch {
+		case latest == "":
+			latest = version
+		case (pre == "") != (latestPre == ""):
+			if pre == "" {
+				latest = version
+			}
+		case compareVersions(version, latest) > 0:
+			latest = version
+		}
+	}
+	return latest
+}
+
+// TrimIndex keeps only the limit most recent versions of an index.json response
+// A limit of zero or less, or an index that is already small enough, is returned unchanged
+func TrimIndex(data []byte, limit int) ([]byte, error) {
+	if limit <= 0 {
+		return data, nil
+	}
+	var index IndexResponse
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("failed to parse index: %w", err)
+	}
+	if len(index.Versions) <= limit {
+		return data, nil
+	}
+
+	versions := slices.SortedFunc(maps.Keys(index.Versions), compareVersions)
+	for _, version := range versions[:len(versions)-limit] {
+		delete(index.Versions, version)
+	}
+	return json.Marshal(index)
+}
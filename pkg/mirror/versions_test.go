@@ -0,0 +1,71 @@
+package mirror
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	ordered := []string{"not-a-version", "1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.2.0", "1.10.0", "2.0.0+build.1"}
+	for i := range ordered {
+		for j := range ordered {
+			got := compareVersions(ordered[i], ordered[j])
+			want := 0
+			if i < j {
+				want = -1
+			} else if i > j {
+				want = 1
+			}
+			if got != want {
+				t.Errorf("compareVersions(%q, %q) = %d, want %d", ordered[i], ordered[j], got, want)
+			}
+		}
+	}
+}
+
+func TestLatestVersion(t *testing.T) {
+	tests := []struct {
+		versions []string
+		want     string
+	}{
+		{nil, ""},
+		{[]string{"1.9.0", "1.10.0", "2.0.0-beta"}, "1.10.0"},
+		{[]string{"1.0.0-alpha", "1.0.0-rc.1"}, "1.0.0-rc.1"},
+	}
+	for _, tt := range tests {
+		index := IndexResponse{Versions: make(map[string]VersionInfo)}
+		for _, v := range tt.versions {
+			index.Versions[v] = VersionInfo{}
+		}
+		if got := LatestVersion(index); got != tt.want {
+			t.Errorf("LatestVersion(%v) = %q, want %q", tt.versions, got, tt.want)
+		}
+	}
+}
+
+func TestTrimIndex(t *testing.T) {
+	data := []byte(`{"versions":{"1.9.0":{},"1.10.0":{},"2.0.0-beta":{},"2.0.0":{},"0.1.0":{}}}`)
+
+	trimmed, err := TrimIndex(data, 3)
+	if err != nil {
+		t.Fatalf("TrimIndex failed: %v", err)
+	}
+	var index IndexResponse
+	if err := json.Unmarshal(trimmed, &index); err != nil {
+		t.Fatalf("failed to parse trimmed index: %v", err)
+	}
+	if got := slices.Sorted(maps.Keys(index.Versions)); !slices.Equal(got, []string{"1.10.0", "2.0.0", "2.0.0-beta"}) {
+		t.Errorf("trimmed index has versions %v", got)
+	}
+
+	for _, limit := range []int{0, 5} {
+		if got, err := TrimIndex(data, limit); err != nil || string(got) != string(data) {
+			t.Errorf("TrimIndex(limit %d) = %s, %v, want the index unchanged", limit, got, err)
+		}
+	}
+	if _, err := TrimIndex([]byte("not json"), 1); err == nil {
+		t.Error("expected error for invalid index")
+	}
+}
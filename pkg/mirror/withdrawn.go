@@ -0,0 +1,87 @@
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// WithdrawnPolicy decides how versions upstream marks yanked or deprecated are served
+type WithdrawnPolicy string
+
+const (
+	// WithdrawnServe serves withdrawn versions like any other, the default
+	WithdrawnServe WithdrawnPolicy = "serve"
+	// WithdrawnHide leaves withdrawn versions out of index.json, they can still be installed when pinned
+	WithdrawnHide WithdrawnPolicy = "hide"
+	// WithdrawnBlock leaves withdrawn versions out of index.json and rejects their metadata and archives
+	WithdrawnBlock WithdrawnPolicy = "block"
+)
+
+// WithdrawnVersions controls how versions withdrawn upstream are served
+// Only registries that report yanked or deprecated versions are affected
+type WithdrawnVersions struct {
+	// Default applies to providers without an override
+	Default WithdrawnPolicy
+	// Overrides set the policy of the providers they match, such as serve to reproduce an old build
+	Overrides ProviderRules[WithdrawnPolicy]
+}
+
+// SetWithdrawnVersions sets how versions withdrawn upstream are served
+// Must be called before the mirror is used
+func (m *Mirror) SetWithdrawnVersions(withdrawn WithdrawnVersions) {
+	m.withdrawn = withdrawn
+}
+
+// withdrawnPolicy returns the policy for versions of a provider withdrawn upstream
+func (m *Mirror) withdrawnPolicy(hostname, namespace, providerType string) WithdrawnPolicy {
+	if policy, ok := m.withdrawn.Overrides.Lookup(hostname, namespace, providerType); ok {
+		return policy
+	}
+	if m.withdrawn.Default == "" {
+		return WithdrawnServe
+	}
+	return m.withdrawn.Default
+}
+
+// hideWithdrawn leaves withdrawn versions out of an index.json response when the provider's policy hides them
+func (m *Mirror) hideWithdrawn(data []byte, hostname, namespace, providerType string) ([]byte, error) {
+	if m.withdrawnPolicy(hostname, namespace, providerType) == WithdrawnServe {
+		return data, nil
+	}
+	var index IndexResponse
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("failed to parse index: %w", err)
+	}
+	hidden := false
+	for version, info := range index.Versions {
+		if info.Withdrawn() {
+			delete(index.Versions, version)
+			hidden = true
+		}
+	}
+	if !hidden {
+		return data, nil
+	}
+	return json.Marshal(index)
+}
+
+// CheckWithdrawn returns ErrVersionWithdrawn for a version withdrawn upstream when the provider's policy blocks it
+// Versions are let through when the index cannot be read, a missing index is not a reason to block
+func (m *Mirror) CheckWithdrawn(ctx context.Context, hostname, namespace, providerType, version string) error {
+	if m.withdrawnPolicy(hostname, namespace, providerType) != WithdrawnBlock {
+		return nil
+	}
+	data, err := m.getIndex(ctx, hostname, namespace, providerType)
+	if err != nil {
+		return nil
+	}
+	var index IndexResponse
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil
+	}
+	if index.Versions[version].Withdrawn() {
+		return fmt.Errorf("%w: %s/%s/%s %s", ErrVersionWithdrawn, hostname, namespace, providerType, version)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+// newWithdrawnTestMirror returns a mirror with a cached aws index where 1.0.0 is yanked and 1.1.0 deprecated
+func newWithdrawnTestMirror(t *testing.T, withdrawn WithdrawnVersions) *Mirror {
+	t.Helper()
+	store := storage.NewMemoryStorage()
+	ctx := context.Background()
+	index := `{"versions":{"1.0.0":{"yanked":true},"1.1.0":{"deprecated":true},"1.2.0":{}}}`
+	if err := store.PutIndex(ctx, "registry.terraform.io", "hashicorp", "aws", []byte(index)); err != nil {
+		t.Fatalf("PutIndex failed: %v", err)
+	}
+	for _, version := range []string{"1.0.0", "1.2.0"} {
+		if err := store.PutVersion(ctx, "registry.terraform.io", "hashicorp", "aws", version, []byte(`{"archives":{}}`)); err != nil {
+			t.Fatalf("PutVersion failed: %v", err)
+		}
+	}
+	mirror := NewMirror(store, nil, "http://localhost:8080")
+	mirror.SetWithdrawnVersions(withdrawn)
+	return mirror
+}
+
+func indexVersions(t *testing.T, data []byte) map[string]VersionInfo {
+	t.Helper()
+	var index IndexResponse
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatalf("failed to parse index: %v", err)
+	}
+	return index.Versions
+}
+
+func TestWithdrawnVersions_Serve(t *testing.T) {
+	mirror := newWithdrawnTestMirror(t, WithdrawnVersions{})
+	ctx := context.Background()
+
+	data, err := mirror.GetIndex(ctx, "registry.terraform.io", "hashicorp", "aws")
+	if err != nil {
+		t.Fatalf("GetIndex failed: %v", err)
+	}
+	if versions := indexVersions(t, data); len(versions) != 3 || !versions["1.0.0"].Yanked {
+		t.Errorf("expected every version with its flags, got %v", versions)
+	}
+	if _, err := mirror.GetVersion(ctx, "registry.terraform.io", "hashicorp", "aws", "1.0.0"); err != nil {
+		t.Errorf("expected yanked version to be served, got %v", err)
+	}
+}
+
+func TestWithdrawnVersions_Hide(t *testing.T) {
+	mirror := newWithdrawnTestMirror(t, WithdrawnVersions{Default: WithdrawnHide})
+	ctx := context.Background()
+
+	data, err := mirror.GetIndex(ctx, "registry.terraform.io", "hashicorp", "aws")
+	if err != nil {
+		t.Fatalf("GetIndex failed: %v", err)
+	}
+	if versions := indexVersions(t, data); len(versions) != 1 {
+		t.Errorf("expected only 1.2.0 to be listed, got %v", versions)
+	}
+	// Pinned versions keep installing
+	if _, err := mirror.GetVersion(ctx, "registry.terraform.io", "hashicorp", "aws", "1.0.0"); err != nil {
+		t.Errorf("expected hidden version to be served, got %v", err)
+	}
+}
+
+func TestWithdrawnVersions_Block(t *testing.T) {
+	mirror := newWithdrawnTestMirror(t, WithdrawnVersions{Default: WithdrawnBlock})
+	ctx := context.Background()
+
+	if _, err := mirror.GetVersion(ctx, "registry.terraform.io", "hashicorp", "aws", "1.0.0"); !errors.Is(err, ErrVersionWithdrawn) {
+		t.Errorf("expected ErrVersionWithdrawn for yanked version metadata, got %v", err)
+	}
+	if _, err := mirror.GetArchive(ctx, "registry.terraform.io", "hashicorp", "aws", "1.1.0", "linux", "amd64", "registry.terraform.io/hashicorp/aws/terraform-provider-aws_1.1.0_linux_amd64.zip"); !errors.Is(err, ErrVersionWithdrawn) {
+		t.Errorf("expected ErrVersionWithdrawn for deprecated version archive, got %v", err)
+	}
+	if _, err := mirror.GetVersion(ctx, "registry.terraform.io", "hashicorp", "aws", "1.2.0"); err != nil {
+		t.Errorf("expected current version to be served, got %v", err)
+	}
+}
+
+func TestWithdrawnVersions_Override(t *testing.T) {
+	mirror := newWithdrawnTestMirror(t, WithdrawnVersions{
+		Default:   WithdrawnBlock,
+		Overrides: ProviderRules[WithdrawnPolicy]{"registry.terraform.io/hashicorp/aws": WithdrawnServe},
+	})
+
+	if _, err := mirror.GetVersion(context.Background(), "registry.terraform.io", "hashicorp", "aws", "1.0.0"); err != nil {
+		t.Errorf("expected override to serve yanked version, got %v", err)
+	}
+}
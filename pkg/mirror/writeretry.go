@@ -0,0 +1,168 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/elisiariocouto/specular/pkg/metrics"
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+// writeRetryWorkers is the number of failed cache writes retried at the same time
+const writeRetryWorkers = 2
+
+// maxWriteRetryWait caps the wait between two attempts of a failed cache write
+const maxWriteRetryWait = 5 * time.Minute
+
+// writeRetryTask is a cache write that failed and is tried again
+type writeRetryTask struct {
+	write   func(ctx context.Context) error
+	logArgs []any
+}
+
+// WriteRetrier retries failed cache writes in the background
+// Transient storage errors then leave an object uncached for a while instead of until it is requested again
+type WriteRetrier struct {
+	tasks     chan writeRetryTask
+	pending   sync.WaitGroup
+	attempts  int
+	metrics   *metrics.Metrics
+	logger    *slog.Logger
+	retryWait time.Duration
+}
+
+// NewWriteRetrier creates a retrier trying each failed write up to attempts more times, with exponential backoff
+// Up to queueSize writes wait to be retried, writes failing beyond that are dropped and counted
+func NewWriteRetrier(queueSize, attempts int, m *metrics.Metrics, logger *slog.Logger) *WriteRetrier {
+	return &WriteRetrier{
+		tasks:     make(chan writeRetryTask, queueSize),
+		attempts:  attempts,
+		metrics:   m,
+		logger:    logger,
+		retryWait: 5 * time.Second,
+	}
+}
+
+// SetWriteRetrier makes the mirror retry failed cache writes with r instead of only logging them
+// Must be called before the mirror is used
+func (m *Mirror) SetWriteRetrier(r *WriteRetrier) {
+	m.retrier = r
+}
+
+// retryable reports whether a failed cache write may succeed when tried again
+// Quota errors persist until space is freed, and client disconnects are not storage failures
+func retryable(err error) bool {
+	return !errors.Is(err, storage.ErrQuotaExceeded) && !errors.Is(err, errArchiveIncomplete) && !errors.Is(err, context.Canceled)
+}
+
+// retryWrite queues a failed metadata write, put is called with the cache storage
+func (m *Mirror) retryWrite(err error, put func(ctx context.Context, s storage.Storage) error, logArgs ...any) {
+	if m.retrier == nil || !retryable(err) {
+		return
+	}
+	m.retrier.enqueue(func(ctx context.Context) error {
+		return put(ctx, m.storage)
+	}, logArgs...)
+}
+
+// retryArchive queues a failed archive write, the archive is fetched from upstream again when retried
+func (m *Mirror) retryArchive(err error, hostname, namespace, providerType, version, os, arch, archivePath string) {
+	if m.retrier == nil || !retryable(err) {
+		return
+	}
+	m.retrier.enqueue(func(ctx context.Context) error {
+		if exists, err := m.storage.ExistsArchive(ctx, archivePath); err == nil && exists {
+			return nil
+		}
+		downloadInfo, err := m.upstream.FetchDownloadURL(ctx, hostname, namespace, providerType, version, os, arch)
+		if err != nil {
+			return fmt.Errorf("failed to get download URL: %w", err)
+		}
+		reader, err := m.upstream.FetchArchive(ctx, downloadInfo.DownloadURL)
+		if err != nil {
+			return fmt.Errorf("failed to fetch archive: %w", err)
+		}
+		defer reader.Close()
+		if err := m.storage.PutArchive(ctx, archivePath, reader); err != nil {
+			return err
+		}
+		return m.commitArchive(ctx, archivePath, reader, downloadInfo.Shasum)
+	}, "path", archivePath)
+}
+
+// enqueue adds a task without blocking the request whose write failed
+func (r *WriteRetrier) enqueue(write func(ctx context.Context) error, logArgs ...any) {
+	r.pending.Add(1)
+	select {
+	case r.tasks <- writeRetryTask{write: write, logArgs: logArgs}:
+		r.metrics.SetCacheWriteRetryPending(len(r.tasks))
+	default:
+		r.pending.Done()
+		r.metrics.RecordCacheWriteRetry("dropped")
+		r.logger.Warn("cache write retry queue is full, object left uncached", logArgs...)
+	}
+}
+
+// Run retries queued writes until ctx is done
+func (r *WriteRetrier) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for range writeRetryWorkers {
+		wg.Go(func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case task := <-r.tasks:
+					r.run(ctx, task)
+				}
+			}
+		})
+	}
+	wg.Wait()
+}
+
+// run tries one write again until it succeeds or runs out of attempts
+func (r *WriteRetrier) run(ctx context.Context, task writeRetryTask) {
+	defer r.pending.Done()
+	r.metrics.SetCacheWriteRetryPending(len(r.tasks))
+
+	var err error
+	for attempt := range r.attempts {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(min(r.retryWait<<attempt, maxWriteRetryWait)):
+		}
+		if err = task.write(withBackground(ctx)); err == nil {
+			r.metrics.RecordCacheWriteRetry("succeeded")
+			r.logger.InfoContext(ctx, "cached object after retrying", append(task.logArgs, "attempts", attempt+1)...)
+			return
+		}
+		if !retryable(err) {
+			break
+		}
+	}
+
+	r.metrics.RecordCacheWriteRetry("failed")
+	r.logger.WarnContext(ctx, "giving up on caching object", append(task.logArgs, "err", err)...)
+}
+
+// Drain waits until every queued write has been retried or ctx is done
+func (r *WriteRetrier) Drain(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		r.pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
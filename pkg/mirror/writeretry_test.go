@@ -0,0 +1,160 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/elisiariocouto/specular/pkg/metrics"
+	"github.com/elisiariocouto/specular/pkg/storage"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// flakyStorage fails the first failures version and archive writes
+type flakyStorage struct {
+	storage.Storage
+	failures atomic.Int32
+	err      error
+}
+
+func (f *flakyStorage) Unwrap() storage.Storage {
+	return f.Storage
+}
+
+func (f *flakyStorage) fail() error {
+	if f.failures.Add(-1) >= 0 {
+		return f.err
+	}
+	return nil
+}
+
+func (f *flakyStorage) PutVersion(ctx context.Context, hostname, namespace, providerType, version string, data []byte) error {
+	if err := f.fail(); err != nil {
+		return err
+	}
+	return f.Storage.PutVersion(ctx, hostname, namespace, providerType, version, data)
+}
+
+func (f *flakyStorage) PutArchive(ctx context.Context, path string, r io.Reader) error {
+	if err := f.fail(); err != nil {
+		return err
+	}
+	return f.Storage.PutArchive(ctx, path, r)
+}
+
+// startWriteRetrier runs r with short waits until the test ends
+func startWriteRetrier(t *testing.T, r *WriteRetrier) {
+	t.Helper()
+	r.retryWait = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func drainRetries(t *testing.T, r *WriteRetrier) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := r.Drain(ctx); err != nil {
+		t.Fatalf("Drain failed: %v", err)
+	}
+}
+
+func TestWriteRetrier(t *testing.T) {
+	for _, policy := range []CachePolicy{CacheWriteThrough, CacheWriteBack} {
+		t.Run(string(policy), func(t *testing.T) {
+			m := metrics.New(nil, metrics.Options{DisableGoCollector: true, DisableProcessCollector: true})
+			retrier := NewWriteRetrier(100, 3, m, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			startWriteRetrier(t, retrier)
+
+			store := &flakyStorage{Storage: storage.NewMemoryStorage(), err: errors.New("disk busy")}
+			mirror, registry := newRegistryTestMirror(t, store)
+			mirror.SetCachePolicies(CachePolicies{Index: policy, Version: policy, Archive: policy})
+			mirror.SetWriteRetrier(retrier)
+			registry.AddPackage("hashicorp", "aws", "1.0.0", "linux", "amd64", []byte("archive"))
+			hostname := registry.Hostname()
+			archivePath := hostname + "/hashicorp/aws/terraform-provider-aws_1.0.0_linux_amd64.zip"
+			ctx := context.Background()
+
+			// The version write fails once, then the archive write fails once
+			store.failures.Store(1)
+			if _, err := mirror.GetVersion(ctx, hostname, "hashicorp", "aws", "1.0.0"); err != nil {
+				t.Fatalf("GetVersion failed: %v", err)
+			}
+			flush(t, mirror)
+			drainRetries(t, retrier)
+
+			store.failures.Store(1)
+			reader, err := mirror.GetArchive(ctx, hostname, "hashicorp", "aws", "1.0.0", "linux", "amd64", archivePath)
+			if err == nil {
+				io.Copy(io.Discard, reader)
+				reader.Close()
+			} else if policy != CacheWriteThrough {
+				t.Fatalf("GetArchive failed: %v", err)
+			}
+			flush(t, mirror)
+			drainRetries(t, retrier)
+
+			if _, err := store.GetVersion(ctx, hostname, "hashicorp", "aws", "1.0.0"); err != nil {
+				t.Errorf("expected version to be cached after retrying: %v", err)
+			}
+			if exists, _ := store.ExistsArchive(ctx, archivePath); !exists {
+				t.Error("expected archive to be cached after retrying")
+			}
+			if info, err := store.Storage.(storage.EntryInfoStore).EntryInfo(ctx, archivePath); err != nil || info.RegistryShasum == "" {
+				t.Errorf("expected the retried archive to be recorded with its registry shasum, got %+v (%v)", info, err)
+			}
+			if n := testutil.ToFloat64(m.CacheWriteRetriesTotal.WithLabelValues("succeeded")); n != 2 {
+				t.Errorf("expected 2 successful retries, got %v", n)
+			}
+		})
+	}
+}
+
+func TestWriteRetrier_GivesUp(t *testing.T) {
+	m := metrics.New(nil, metrics.Options{DisableGoCollector: true, DisableProcessCollector: true})
+	retrier := NewWriteRetrier(100, 2, m, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	startWriteRetrier(t, retrier)
+
+	store := &flakyStorage{Storage: storage.NewMemoryStorage(), err: errors.New("disk busy")}
+	store.failures.Store(100)
+	mirror, registry := newRegistryTestMirror(t, store)
+	mirror.SetWriteRetrier(retrier)
+	registry.AddPackage("hashicorp", "aws", "1.0.0", "linux", "amd64", []byte("archive"))
+
+	if _, err := mirror.GetVersion(context.Background(), registry.Hostname(), "hashicorp", "aws", "1.0.0"); err != nil {
+		t.Fatalf("GetVersion failed: %v", err)
+	}
+	drainRetries(t, retrier)
+
+	if n := testutil.ToFloat64(m.CacheWriteRetriesTotal.WithLabelValues("failed")); n != 1 {
+		t.Errorf("expected 1 failed retry, got %v", n)
+	}
+	// The initial write and both retries
+	if n := store.failures.Load(); n != 97 {
+		t.Errorf("expected 3 write attempts, got %d", 100-n)
+	}
+}
+
+func TestWriteRetrier_SkipsQuotaErrors(t *testing.T) {
+	m := metrics.New(nil, metrics.Options{DisableGoCollector: true, DisableProcessCollector: true})
+	retrier := NewWriteRetrier(100, 2, m, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	mirror := NewMirror(NewMockStorage(), nil, "http://localhost:8080")
+	mirror.SetWriteRetrier(retrier)
+
+	mirror.retryWrite(storage.ErrQuotaExceeded, func(ctx context.Context, s storage.Storage) error { return nil })
+	if n := len(retrier.tasks); n != 0 {
+		t.Errorf("expected quota errors not to be retried, %d queued", n)
+	}
+}
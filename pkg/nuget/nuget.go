@@ -0,0 +1,259 @@
+// Package nuget implements a caching proxy of a NuGet v3 package source
+// Only the package content resource (PackageBaseAddress/3.0.0, also called the flat container) is proxied,
+// which is all dotnet restore and nuget.exe need to install packages
+package nuget
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elisiariocouto/specular/pkg/mirror"
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+// PackageBaseAddressType is the service index type of the package content resource
+const PackageBaseAddressType = "PackageBaseAddress/3.0.0"
+
+// DefaultServiceIndex is the service index of nuget.org
+const DefaultServiceIndex = "https://api.nuget.org/v3/index.json"
+
+// maxMetadataSize bounds service indices and version lists read from upstream
+const maxMetadataSize = 32 << 20
+
+var (
+	// idPattern matches package IDs, which NuGet limits to 100 characters
+	idPattern = regexp.MustCompile(`^[a-z0-9_][a-z0-9_.-]{0,99}$`)
+	// versionPattern matches normalized package versions, including NuGet's four-part versions
+	versionPattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+){1,3}(-[0-9a-z.-]+)?$`)
+)
+
+// ServiceIndex is the document a NuGet v3 source is configured with
+type ServiceIndex struct {
+	Version   string     `json:"version"`
+	Resources []Resource `json:"resources"`
+}
+
+// Resource is a service advertised by a service index
+type Resource struct {
+	ID      string `json:"@id"`
+	Type    string `json:"@type"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// Proxy serves NuGet packages from the cache, fetching them from the upstream source on a miss
+// Version lists are always fetched again and only served from the cache when upstream cannot be reached,
+// package contents never change once published and are served from the cache once downloaded
+type Proxy struct {
+	store        storage.Storage
+	client       *http.Client
+	serviceIndex string
+	logger       *slog.Logger
+
+	mu          sync.Mutex
+	packageBase string
+}
+
+// NewProxy creates a proxy of the NuGet v3 source whose service index is at serviceIndex
+// timeout bounds the wait for upstream response headers, packages may take longer to download
+func NewProxy(store storage.Storage, serviceIndex string, timeout time.Duration, logger *slog.Logger) *Proxy {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = timeout
+	return &Proxy{
+		store:        store,
+		client:       &http.Client{Transport: transport},
+		serviceIndex: serviceIndex,
+		logger:       logger,
+	}
+}
+
+// ServiceIndex returns the service index advertising the proxy's package content resource at packageBase
+func (p *Proxy) ServiceIndex(packageBase string) ServiceIndex {
+	return ServiceIndex{
+		Version: "3.0.0",
+		Resources: []Resource{{
+			ID:      packageBase,
+			Type:    PackageBaseAddressType,
+			Comment: "Package contents cached by Specular",
+		}},
+	}
+}
+
+// Versions returns the version list of a package, the flat container index.json
+func (p *Proxy) Versions(ctx context.Context, id string) ([]byte, error) {
+	id = strings.ToLower(id)
+	if err := validateID(id); err != nil {
+		return nil, err
+	}
+	path := id + "/index.json"
+
+	data, err := p.fetchVersions(ctx, id)
+	if err == nil {
+		if err := p.store.PutArchive(ctx, path, bytes.NewReader(data)); err != nil {
+			p.logger.WarnContext(ctx, "failed to cache NuGet version list",
+				slog.String("package", id),
+				slog.String("error", err.Error()))
+		}
+		return data, nil
+	}
+	if !errors.Is(err, mirror.ErrUpstreamUnavailable) {
+		return nil, err
+	}
+
+	// Serve the last known list while upstream is unreachable
+	cached, cacheErr := p.readCached(ctx, path)
+	if cacheErr != nil {
+		return nil, err
+	}
+	p.logger.WarnContext(ctx, "serving cached NuGet version list, upstream unavailable",
+		slog.String("package", id),
+		slog.String("error", err.Error()))
+	return cached, nil
+}
+
+// Package returns a package file: {id}.{version}.nupkg or {id}.nuspec
+// Caller is responsible for closing the returned ReadCloser
+func (p *Proxy) Package(ctx context.Context, id, version, filename string) (io.ReadCloser, error) {
+	id, version, filename = strings.ToLower(id), strings.ToLower(version), strings.ToLower(filename)
+	if err := validateID(id); err != nil {
+		return nil, err
+	}
+	if !versionPattern.MatchString(version) {
+		return nil, fmt.Errorf("%w: invalid version %q", mirror.ErrInvalidAddress, version)
+	}
+	if filename != id+"."+version+".nupkg" && filename != id+".nuspec" {
+		return nil, fmt.Errorf("%w: invalid filename %q", mirror.ErrInvalidAddress, filename)
+	}
+	path := id + "/" + version + "/" + filename
+
+	rc, err := p.store.GetArchive(ctx, path)
+	if err == nil {
+		return rc, nil
+	}
+	if !storage.IsNotFound(err) {
+		return nil, fmt.Errorf("%w: %w", mirror.ErrStorageFailure, err)
+	}
+
+	base, err := p.packageBaseAddress(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.get(ctx, base+path)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := p.store.PutArchive(ctx, path, resp.Body); err != nil {
+		return nil, fmt.Errorf("%w: %w", mirror.ErrStorageFailure, err)
+	}
+	p.logger.InfoContext(ctx, "cached NuGet package file",
+		slog.String("package", id),
+		slog.String("version", version),
+		slog.String("filename", filename))
+
+	rc, err = p.store.GetArchive(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", mirror.ErrStorageFailure, err)
+	}
+	return rc, nil
+}
+
+// fetchVersions downloads the version list of a package from upstream
+func (p *Proxy) fetchVersions(ctx context.Context, id string) ([]byte, error) {
+	base, err := p.packageBaseAddress(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.get(ctx, base+id+"/index.json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxMetadataSize))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", mirror.ErrUpstreamUnavailable, err)
+	}
+	var versions struct {
+		Versions []string `json:"versions"`
+	}
+	if err := json.Unmarshal(data, &versions); err != nil {
+		return nil, fmt.Errorf("%w: invalid version list: %w", mirror.ErrUpstreamUnavailable, err)
+	}
+	return data, nil
+}
+
+// packageBaseAddress returns the package content resource of the upstream source, ending with a slash
+// It is looked up once, failed lookups are tried again on the next request
+func (p *Proxy) packageBaseAddress(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.packageBase != "" {
+		return p.packageBase, nil
+	}
+
+	resp, err := p.get(ctx, p.serviceIndex)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var index ServiceIndex
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxMetadataSize)).Decode(&index); err != nil {
+		return "", fmt.Errorf("%w: invalid service index: %w", mirror.ErrUpstreamUnavailable, err)
+	}
+	for _, resource := range index.Resources {
+		if resource.Type == PackageBaseAddressType && resource.ID != "" {
+			p.packageBase = strings.TrimSuffix(resource.ID, "/") + "/"
+			return p.packageBase, nil
+		}
+	}
+	return "", fmt.Errorf("%w: service index has no %s resource", mirror.ErrUpstreamUnavailable, PackageBaseAddressType)
+}
+
+// get sends a GET request upstream, mapping 404 to ErrNotFound and other failures to ErrUpstreamUnavailable
+func (p *Proxy) get(ctx context.Context, target string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", mirror.ErrUpstreamUnavailable, err)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", mirror.ErrUpstreamUnavailable, err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return resp, nil
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, mirror.ErrNotFound
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s answered %s", mirror.ErrUpstreamUnavailable, target, resp.Status)
+	}
+}
+
+// readCached reads a whole cached file
+func (p *Proxy) readCached(ctx context.Context, path string) ([]byte, error) {
+	rc, err := p.store.GetArchive(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// validateID checks a lowercased package ID
+func validateID(id string) error {
+	if !idPattern.MatchString(id) || strings.Contains(id, "..") {
+		return fmt.Errorf("%w: invalid package id %q", mirror.ErrInvalidAddress, id)
+	}
+	return nil
+}
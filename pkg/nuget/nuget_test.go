@@ -0,0 +1,119 @@
+package nuget
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/elisiariocouto/specular/pkg/mirror"
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+// newTestSource serves a NuGet v3 source with one package, counting package downloads
+func newTestSource(t *testing.T) (*httptest.Server, *atomic.Int32, *atomic.Bool) {
+	t.Helper()
+	var downloads atomic.Int32
+	var down atomic.Bool
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v3/index.json", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"version":"3.0.0","resources":[
+			{"@id":"`+server.URL+`/search","@type":"SearchQueryService"},
+			{"@id":"`+server.URL+`/flat","@type":"PackageBaseAddress/3.0.0"}]}`)
+	})
+	mux.HandleFunc("/flat/newtonsoft.json/index.json", func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, `{"versions":["13.0.1","13.0.3"]}`)
+	})
+	mux.HandleFunc("/flat/newtonsoft.json/13.0.3/newtonsoft.json.13.0.3.nupkg", func(w http.ResponseWriter, r *http.Request) {
+		downloads.Add(1)
+		io.WriteString(w, "nupkg contents")
+	})
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, &downloads, &down
+}
+
+func newTestProxy(t *testing.T, source *httptest.Server) *Proxy {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewProxy(storage.NewMemoryStorage(), source.URL+"/v3/index.json", 5*time.Second, logger)
+}
+
+func TestProxyVersions(t *testing.T) {
+	source, _, down := newTestSource(t)
+	proxy := newTestProxy(t, source)
+	ctx := context.Background()
+
+	data, err := proxy.Versions(ctx, "Newtonsoft.Json")
+	if err != nil {
+		t.Fatalf("Versions failed: %v", err)
+	}
+	if string(data) != `{"versions":["13.0.1","13.0.3"]}` {
+		t.Errorf("unexpected versions %s", data)
+	}
+
+	// The last known list is served while upstream fails
+	down.Store(true)
+	data, err = proxy.Versions(ctx, "newtonsoft.json")
+	if err != nil || string(data) != `{"versions":["13.0.1","13.0.3"]}` {
+		t.Errorf("Versions while upstream is down = %s, %v", data, err)
+	}
+
+	if _, err := proxy.Versions(ctx, "missing"); !errors.Is(err, mirror.ErrNotFound) {
+		t.Errorf("Versions of a missing package returned %v, want ErrNotFound", err)
+	}
+	if _, err := proxy.Versions(ctx, "../etc"); !errors.Is(err, mirror.ErrValidation) {
+		t.Errorf("Versions of an invalid id returned %v, want a validation error", err)
+	}
+}
+
+func TestProxyPackage(t *testing.T) {
+	source, downloads, _ := newTestSource(t)
+	proxy := newTestProxy(t, source)
+	ctx := context.Background()
+
+	for range 2 {
+		rc, err := proxy.Package(ctx, "Newtonsoft.Json", "13.0.3", "Newtonsoft.Json.13.0.3.nupkg")
+		if err != nil {
+			t.Fatalf("Package failed: %v", err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		if string(data) != "nupkg contents" {
+			t.Errorf("unexpected package contents %q", data)
+		}
+	}
+	if n := downloads.Load(); n != 1 {
+		t.Errorf("package downloaded %d times, want once", n)
+	}
+
+	if _, err := proxy.Package(ctx, "newtonsoft.json", "13.0.3", "other.13.0.3.nupkg"); !errors.Is(err, mirror.ErrValidation) {
+		t.Errorf("Package with a foreign filename returned %v, want a validation error", err)
+	}
+	if _, err := proxy.Package(ctx, "newtonsoft.json", "13.0.2", "newtonsoft.json.13.0.2.nupkg"); !errors.Is(err, mirror.ErrNotFound) {
+		t.Errorf("Package of a missing version returned %v, want ErrNotFound", err)
+	}
+}
+
+func TestProxyServiceIndexWithoutPackageBase(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"version":"3.0.0","resources":[]}`)
+	}))
+	defer upstream.Close()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	proxy := NewProxy(storage.NewMemoryStorage(), upstream.URL, 5*time.Second, logger)
+
+	if _, err := proxy.Versions(context.Background(), "newtonsoft.json"); !errors.Is(err, mirror.ErrUpstreamUnavailable) {
+		t.Errorf("Versions returned %v, want ErrUpstreamUnavailable", err)
+	}
+}
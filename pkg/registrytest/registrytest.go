@@ -0,0 +1,263 @@
+// Package registrytest provides a fake Terraform provider registry for tests
+// It serves service discovery, the providers.v1 versions and download APIs, SHA256SUMS files and the archives themselves
+package registrytest
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ProvidersPath is the providers.v1 path announced by service discovery
+const ProvidersPath = "/v1/providers/"
+
+// Server is a fake provider registry running on a local TLS listener
+// Use Hostname as the provider hostname and Client for requests that must trust its certificate
+type Server struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	packages   map[string]map[string][]byte // namespace/type -> version/os/arch -> archive
+	requests   map[string]int
+	failStatus int
+}
+
+// NewServer starts a fake registry without any provider
+// The caller must Close it when done
+func NewServer() *Server {
+	s := &Server{
+		packages: make(map[string]map[string][]byte),
+		requests: make(map[string]int),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/terraform.json", s.handleDiscovery)
+	mux.HandleFunc("GET "+ProvidersPath+"{namespace}/{type}/versions", s.handleVersions)
+	mux.HandleFunc("GET "+ProvidersPath+"{namespace}/{type}/{version}/download/{os}/{arch}", s.handleDownload)
+	mux.HandleFunc("GET /archives/{namespace}/{type}/{filename}", s.handleArchive)
+	mux.HandleFunc("GET /shasums/{namespace}/{type}/{version}", s.handleShasums)
+
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests[r.URL.Path]++
+		failStatus := s.failStatus
+		s.mu.Unlock()
+
+		if failStatus != 0 {
+			w.WriteHeader(failStatus)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	return s
+}
+
+// Hostname returns the host and port to use as the provider hostname
+func (s *Server) Hostname() string {
+	return strings.TrimPrefix(s.URL, "https://")
+}
+
+// AddPackage publishes the archive of a provider version for one platform
+func (s *Server) AddPackage(namespace, providerType, version, os, arch string, archive []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := namespace + "/" + providerType
+	if s.packages[key] == nil {
+		s.packages[key] = make(map[string][]byte)
+	}
+	s.packages[key][version+"/"+os+"/"+arch] = archive
+}
+
+// Fail makes every request answer with status, or serves normally again when status is 0
+func (s *Server) Fail(status int) {
+	s.mu.Lock()
+	s.failStatus = status
+	s.mu.Unlock()
+}
+
+// Requests returns how many requests were made for path
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+// VersionsPath returns the path of the versions API for a provider
+func VersionsPath(namespace, providerType string) string {
+	return ProvidersPath + namespace + "/" + providerType + "/versions"
+}
+
+// DownloadPath returns the path of the download API for a provider package
+func DownloadPath(namespace, providerType, version, os, arch string) string {
+	return fmt.Sprintf("%s%s/%s/%s/download/%s/%s", ProvidersPath, namespace, providerType, version, os, arch)
+}
+
+// ArchivePath returns the path an archive is served from
+func ArchivePath(namespace, providerType, version, os, arch string) string {
+	return fmt.Sprintf("/archives/%s/%s/%s", namespace, providerType, Filename(providerType, version, os, arch))
+}
+
+// ShasumsPath returns the path the SHA256SUMS file of a provider version is served from
+func ShasumsPath(namespace, providerType, version string) string {
+	return fmt.Sprintf("/shasums/%s/%s/%s", namespace, providerType, version)
+}
+
+// Filename returns the conventional archive file name of a provider package
+func Filename(providerType, version, os, arch string) string {
+	return fmt.Sprintf("terraform-provider-%s_%s_%s_%s.zip", providerType, version, os, arch)
+}
+
+// Archive builds a zip archive holding files, keyed by name
+func Archive(files map[string]string) []byte {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range names {
+		w, err := zw.Create(name)
+		if err != nil {
+			panic(err)
+		}
+		if _, err := w.Write([]byte(files[name])); err != nil {
+			panic(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+func (s *Server) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]string{"providers.v1": ProvidersPath})
+}
+
+type platform struct {
+	OS   string `json:"os"`
+	Arch string `json:"arch"`
+}
+
+type version struct {
+	Version   string     `json:"version"`
+	Protocols []string   `json:"protocols"`
+	Platforms []platform `json:"platforms"`
+}
+
+func (s *Server) handleVersions(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	packages, ok := s.packages[r.PathValue("namespace")+"/"+r.PathValue("type")]
+	byVersion := make(map[string][]platform)
+	for key := range packages {
+		parts := strings.Split(key, "/")
+		byVersion[parts[0]] = append(byVersion[parts[0]], platform{OS: parts[1], Arch: parts[2]})
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	versions := make([]version, 0, len(byVersion))
+	for v, platforms := range byVersion {
+		sort.Slice(platforms, func(i, j int) bool {
+			return platforms[i].OS+platforms[i].Arch < platforms[j].OS+platforms[j].Arch
+		})
+		versions = append(versions, version{Version: v, Protocols: []string{"5.0"}, Platforms: platforms})
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	writeJSON(w, map[string]any{"versions": versions})
+}
+
+func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
+	namespace, providerType := r.PathValue("namespace"), r.PathValue("type")
+	v, os, arch := r.PathValue("version"), r.PathValue("os"), r.PathValue("arch")
+	archive, ok := s.archive(namespace, providerType, v, os, arch)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	sum := sha256.Sum256(archive)
+	writeJSON(w, map[string]any{
+		"protocols":    []string{"5.0"},
+		"os":           os,
+		"arch":         arch,
+		"filename":     Filename(providerType, v, os, arch),
+		"download_url": s.URL + ArchivePath(namespace, providerType, v, os, arch),
+		"shasums_url":  s.URL + ShasumsPath(namespace, providerType, v),
+		"shasum":       hex.EncodeToString(sum[:]),
+	})
+}
+
+func (s *Server) handleArchive(w http.ResponseWriter, r *http.Request) {
+	namespace, providerType := r.PathValue("namespace"), r.PathValue("type")
+	s.mu.Lock()
+	var archive []byte
+	for key, data := range s.packages[namespace+"/"+providerType] {
+		parts := strings.Split(key, "/")
+		if Filename(providerType, parts[0], parts[1], parts[2]) == r.PathValue("filename") {
+			archive = data
+			break
+		}
+	}
+	s.mu.Unlock()
+
+	if archive == nil {
+		http.NotFound(w, r)
+		return
+	}
+	sum := sha256.Sum256(archive)
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	w.Write(archive)
+}
+
+func (s *Server) handleShasums(w http.ResponseWriter, r *http.Request) {
+	providerType, v := r.PathValue("type"), r.PathValue("version")
+	s.mu.Lock()
+	var lines []string
+	for key, data := range s.packages[r.PathValue("namespace")+"/"+providerType] {
+		parts := strings.Split(key, "/")
+		if parts[0] == v {
+			sum := sha256.Sum256(data)
+			lines = append(lines, hex.EncodeToString(sum[:])+"  "+Filename(providerType, v, parts[1], parts[2])+"\n")
+		}
+	}
+	s.mu.Unlock()
+
+	if len(lines) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	sort.Strings(lines)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, strings.Join(lines, ""))
+}
+
+// archive returns the archive of a provider package
+func (s *Server) archive(namespace, providerType, version, os, arch string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	archive, ok := s.packages[namespace+"/"+providerType][version+"/"+os+"/"+arch]
+	return archive, ok
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
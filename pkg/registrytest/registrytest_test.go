@@ -0,0 +1,108 @@
+package registrytest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func get(t *testing.T, s *Server, url string) (*http.Response, []byte) {
+	t.Helper()
+	resp, err := s.Client().Get(url)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", url, err)
+	}
+	return resp, body
+}
+
+func TestServer(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	archive := Archive(map[string]string{"terraform-provider-aws_v1.0.0": "binary"})
+	s.AddPackage("hashicorp", "aws", "1.0.0", "linux", "amd64", archive)
+	s.AddPackage("hashicorp", "aws", "1.0.0", "darwin", "arm64", archive)
+
+	resp, body := get(t, s, s.URL+"/.well-known/terraform.json")
+	if resp.StatusCode != http.StatusOK || string(body) != `{"providers.v1":"/v1/providers/"}`+"\n" {
+		t.Errorf("discovery returned %d %s", resp.StatusCode, body)
+	}
+
+	_, body = get(t, s, s.URL+VersionsPath("hashicorp", "aws"))
+	var versions struct {
+		Versions []struct {
+			Version   string `json:"version"`
+			Platforms []struct {
+				OS   string `json:"os"`
+				Arch string `json:"arch"`
+			} `json:"platforms"`
+		} `json:"versions"`
+	}
+	if err := json.Unmarshal(body, &versions); err != nil {
+		t.Fatalf("failed to parse versions: %v", err)
+	}
+	if len(versions.Versions) != 1 || len(versions.Versions[0].Platforms) != 2 {
+		t.Errorf("unexpected versions response: %s", body)
+	}
+
+	_, body = get(t, s, s.URL+DownloadPath("hashicorp", "aws", "1.0.0", "linux", "amd64"))
+	var download struct {
+		DownloadURL string `json:"download_url"`
+		ShasumsURL  string `json:"shasums_url"`
+		Shasum      string `json:"shasum"`
+	}
+	if err := json.Unmarshal(body, &download); err != nil {
+		t.Fatalf("failed to parse download info: %v", err)
+	}
+	sum := sha256.Sum256(archive)
+	if download.Shasum != hex.EncodeToString(sum[:]) {
+		t.Errorf("shasum = %s, want %x", download.Shasum, sum)
+	}
+
+	_, body = get(t, s, download.ShasumsURL)
+	wantSums := fmt.Sprintf("%x  %s\n%x  %s\n", sum, Filename("aws", "1.0.0", "darwin", "arm64"), sum, Filename("aws", "1.0.0", "linux", "amd64"))
+	if string(body) != wantSums {
+		t.Errorf("SHA256SUMS = %q, want %q", body, wantSums)
+	}
+
+	resp, body = get(t, s, download.DownloadURL)
+	if resp.StatusCode != http.StatusOK || string(body) != string(archive) {
+		t.Errorf("archive download returned %d", resp.StatusCode)
+	}
+	if n := s.Requests(ArchivePath("hashicorp", "aws", "1.0.0", "linux", "amd64")); n != 1 {
+		t.Errorf("Requests() = %d, want 1", n)
+	}
+
+	for _, path := range []string{
+		VersionsPath("hashicorp", "google"),
+		DownloadPath("hashicorp", "aws", "2.0.0", "linux", "amd64"),
+		ArchivePath("hashicorp", "aws", "2.0.0", "linux", "amd64"),
+	} {
+		if resp, _ := get(t, s, s.URL+path); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("GET %s returned %d, want 404", path, resp.StatusCode)
+		}
+	}
+}
+
+func TestServer_Fail(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.Fail(http.StatusServiceUnavailable)
+	if resp, _ := get(t, s, s.URL+"/.well-known/terraform.json"); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 while failing, got %d", resp.StatusCode)
+	}
+
+	s.Fail(0)
+	if resp, _ := get(t, s, s.URL+"/.well-known/terraform.json"); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 after reset, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,307 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elisiariocouto/specular/internal/jobs"
+	"github.com/elisiariocouto/specular/pkg/mirror"
+	"github.com/elisiariocouto/specular/pkg/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+// defaultStatsWindow is used when no window is given to the stats endpoints
+const defaultStatsWindow = 24 * time.Hour
+
+// defaultStatsLimit is used when no limit is given to the stats endpoints
+const defaultStatsLimit = 10
+
+// TopStatsHandler handles GET /admin/stats/top?window=24h&limit=10
+// Returns the most downloaded providers and versions within the window
+func (h *Handlers) TopStatsHandler(w http.ResponseWriter, r *http.Request) {
+	window := defaultStatsWindow
+	if v := r.URL.Query().Get("window"); v != "" {
+		parsed, err := time.ParseDuration(v)
+		if err != nil || parsed <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "window must be a positive duration (e.g., 24h)")
+			return
+		}
+		window = parsed
+	}
+
+	if window > h.stats.Retention() {
+		writeJSONError(w, http.StatusBadRequest,
+			fmt.Sprintf("window must not exceed the stats retention of %s", h.stats.Retention()))
+		return
+	}
+
+	limit := defaultStatsLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 0 {
+			writeJSONError(w, http.StatusBadRequest, "limit must be a non-negative integer")
+			return
+		}
+		limit = parsed
+	}
+
+	writeJSON(w, http.StatusOK, h.stats.Top(window, limit))
+}
+
+// DownloadsReportHandler handles GET /admin/reports/downloads?from=...&to=...&format=csv|json
+// Summarizes downloads per provider version and client, from and to are RFC 3339 times or dates
+// The period defaults to the whole stats retention up to now, from may not reach further back
+func (h *Handlers) DownloadsReportHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	to := time.Now()
+	if v := query.Get("to"); v != "" {
+		parsed, err := parseReportTime(v)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "to must be an RFC 3339 time or a date (e.g., 2025-12-01)")
+			return
+		}
+		to = parsed
+	}
+	// Downloads older than the retention are gone, a report reaching further back would look complete but is not
+	since := h.stats.Since()
+	from := to.Add(-h.stats.Retention())
+	if from.Before(since) {
+		from = since
+	}
+	if v := query.Get("from"); v != "" {
+		parsed, err := parseReportTime(v)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "from must be an RFC 3339 time or a date (e.g., 2025-11-01)")
+			return
+		}
+		if parsed.Before(since) {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("from must not be before %s, the stats retention is %s",
+				since.UTC().Format(time.RFC3339), h.stats.Retention()))
+			return
+		}
+		from = parsed
+	}
+	if !from.Before(to) {
+		writeJSONError(w, http.StatusBadRequest, "from must be before to")
+		return
+	}
+
+	format := query.Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		writeJSONError(w, http.StatusBadRequest, "format must be json or csv")
+		return
+	}
+
+	report := h.stats.Report(from, to)
+	if format != "csv" {
+		writeJSON(w, http.StatusOK, report)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"downloads-%s-%s.csv\"",
+		report.From.UTC().Format("20060102T1504Z"), report.To.UTC().Format("20060102T1504Z")))
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"hostname", "namespace", "type", "version", "client", "downloads", "bytes"})
+	for _, e := range report.Entries {
+		cw.Write([]string{e.Hostname, e.Namespace, e.Type, e.Version, e.Client,
+			strconv.FormatInt(e.Downloads, 10), strconv.FormatInt(e.Bytes, 10)})
+	}
+	cw.Flush()
+}
+
+// parseReportTime parses an RFC 3339 time or a date, dates are midnight UTC
+func parseReportTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, v)
+}
+
+// BackupHandler handles GET /admin/backup?archives=true&since=...
+// Streams a backup of the cache, the same gzip-compressed tar `specular backup` writes, which `specular restore` extracts
+// since is an RFC 3339 time or a date and makes the backup incremental
+func (h *Handlers) BackupHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var opts storage.BackupOptions
+	if v := query.Get("archives"); v != "" {
+		archives, err := strconv.ParseBool(v)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "archives must be true or false")
+			return
+		}
+		opts.Archives = archives
+	}
+	if v := query.Get("since"); v != "" {
+		since, err := parseReportTime(v)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "since must be an RFC 3339 time or a date (e.g., 2025-12-01)")
+			return
+		}
+		opts.Since = since
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"specular-%s.tar.gz\"", time.Now().UTC().Format("20060102T150405Z")))
+	rw := &responseWriter{ResponseWriter: w}
+	manifest, err := h.mirror.Backup(r.Context(), rw, opts)
+	switch {
+	case err == nil:
+		h.logger.InfoContext(r.Context(), "backup written",
+			slog.Int("files", manifest.Files),
+			slog.Int64("bytes", manifest.Bytes),
+			slog.Bool("archives", manifest.Archives))
+	case rw.responseSize > 0:
+		// The response has started, the client is left with a truncated backup it cannot extract
+		h.logger.ErrorContext(r.Context(), "backup failed",
+			slog.String("error", err.Error()))
+	case storage.IsNotFound(err):
+		w.Header().Del("Content-Disposition")
+		writeJSONError(w, http.StatusNotImplemented, "backups require filesystem storage")
+	default:
+		h.logger.ErrorContext(r.Context(), "backup failed",
+			slog.String("error", err.Error()))
+		w.Header().Del("Content-Disposition")
+		writeJSONError(w, http.StatusInternalServerError, "failed to back up the cache")
+	}
+}
+
+// UpstreamsHandler handles GET /admin/upstreams
+// Returns the health, probe latency and circuit breaker state of each probed upstream registry
+func (h *Handlers) UpstreamsHandler(w http.ResponseWriter, r *http.Request) {
+	upstreams := h.mirror.UpstreamHealth()
+	if upstreams == nil {
+		upstreams = []mirror.UpstreamHealth{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"upstreams": upstreams})
+}
+
+// jobRequest is the body of POST /admin/jobs
+type jobRequest struct {
+	Kind   string            `json:"kind"`
+	Params map[string]string `json:"params"`
+}
+
+// ListJobsHandler handles GET /admin/jobs
+// Returns every known job, newest first
+func (h *Handlers) ListJobsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"kinds": h.jobs.Kinds(),
+		"jobs":  h.jobs.List(),
+	})
+}
+
+// CreateJobHandler handles POST /admin/jobs
+// Queues a job and returns its record without waiting for it to run
+func (h *Handlers) CreateJobHandler(w http.ResponseWriter, r *http.Request) {
+	var req jobRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid job request body")
+		return
+	}
+
+	job, err := h.jobs.Enqueue(req.Kind, req.Params)
+	switch {
+	case errors.Is(err, jobs.ErrUnknownKind):
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, jobs.ErrQueueFull):
+		writeJSONError(w, http.StatusServiceUnavailable, err.Error())
+	case err != nil:
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+	default:
+		writeJSON(w, http.StatusAccepted, job)
+	}
+}
+
+// prefetchRequest is the body of POST /admin/prefetch
+type prefetchRequest struct {
+	Hostname  string   `json:"hostname"`
+	Namespace string   `json:"namespace"`
+	Type      string   `json:"type"`
+	Version   string   `json:"version"`
+	Platforms []string `json:"platforms"`
+}
+
+// PrefetchHandler handles POST /admin/prefetch
+// Queues a prefetch job for a provider version, limited to platforms when given, and returns its record
+func (h *Handlers) PrefetchHandler(w http.ResponseWriter, r *http.Request) {
+	var req prefetchRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid prefetch request body")
+		return
+	}
+	if req.Hostname == "" || req.Namespace == "" || req.Type == "" || req.Version == "" {
+		writeJSONError(w, http.StatusBadRequest, "hostname, namespace, type and version are required")
+		return
+	}
+	for _, platform := range req.Platforms {
+		if os, arch, ok := strings.Cut(platform, "_"); !ok || os == "" || arch == "" || strings.Contains(arch, "_") {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid platform %q, expected os_arch (e.g., linux_amd64)", platform))
+			return
+		}
+	}
+
+	params := map[string]string{
+		"hostname":  req.Hostname,
+		"namespace": req.Namespace,
+		"type":      req.Type,
+		"version":   req.Version,
+	}
+	if len(req.Platforms) > 0 {
+		params["platforms"] = strings.Join(req.Platforms, ",")
+	}
+	job, err := h.jobs.Enqueue("prefetch", params)
+	switch {
+	case errors.Is(err, jobs.ErrQueueFull):
+		writeJSONError(w, http.StatusServiceUnavailable, err.Error())
+	case err != nil:
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+	default:
+		writeJSON(w, http.StatusAccepted, job)
+	}
+}
+
+// GetJobHandler handles GET /admin/jobs/{id}
+func (h *Handlers) GetJobHandler(w http.ResponseWriter, r *http.Request) {
+	job, err := h.jobs.Get(chi.URLParam(r, "id"))
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// CancelJobHandler handles DELETE /admin/jobs/{id}
+// Running jobs are cancelled asynchronously, poll the job to see when it stopped
+func (h *Handlers) CancelJobHandler(w http.ResponseWriter, r *http.Request) {
+	job, err := h.jobs.Cancel(chi.URLParam(r, "id"))
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		writeJSONError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, jobs.ErrFinished):
+		writeJSONError(w, http.StatusConflict, err.Error())
+	case err != nil:
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+	default:
+		writeJSON(w, http.StatusAccepted, job)
+	}
+}
+
+// writeJSON writes a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeJSONError writes a JSON error body with the given status code
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,290 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elisiariocouto/specular/internal/jobs"
+	"github.com/elisiariocouto/specular/internal/stats"
+	"github.com/elisiariocouto/specular/pkg/config"
+	"github.com/elisiariocouto/specular/pkg/mirror"
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+// TestTopStatsHandler tests the top providers statistics endpoint
+func TestTopStatsHandler(t *testing.T) {
+	recorder := stats.NewRecorder(7 * 24 * time.Hour)
+	recorder.Record(stats.Download{Hostname: "registry.terraform.io", Namespace: "hashicorp", Type: "aws", Version: "6.0.0", Bytes: 42})
+	recorder.Record(stats.Download{Hostname: "registry.terraform.io", Namespace: "hashicorp", Type: "aws", Version: "6.0.0", Bytes: 42})
+	recorder.Record(stats.Download{Hostname: "registry.terraform.io", Namespace: "hashicorp", Type: "random", Version: "3.0.0", Bytes: 8})
+
+	handlers := NewHandlers(createTestMirror(nil, nil, nil, nil, nil, nil), metricsForTests(), recorder, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	req := httptest.NewRequest("GET", "/admin/stats/top?window=24h&limit=1", nil)
+	w := httptest.NewRecorder()
+	handlers.TopStatsHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	var result stats.TopResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if result.TotalDownloads != 3 || result.TotalBytes != 92 {
+		t.Errorf("unexpected totals: downloads %d bytes %d", result.TotalDownloads, result.TotalBytes)
+	}
+	if len(result.Providers) != 1 || result.Providers[0].Type != "aws" {
+		t.Errorf("expected aws as the single top provider, got %+v", result.Providers)
+	}
+}
+
+// TestTopStatsHandler_InvalidParams tests validation of query parameters
+func TestTopStatsHandler_InvalidParams(t *testing.T) {
+	handlers := NewHandlers(createTestMirror(nil, nil, nil, nil, nil, nil), metricsForTests(), stats.NewRecorder(24*time.Hour), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	for _, query := range []string{"window=abc", "window=-1h", "window=48h", "limit=-1", "limit=x"} {
+		req := httptest.NewRequest("GET", "/admin/stats/top?"+query, nil)
+		w := httptest.NewRecorder()
+		handlers.TopStatsHandler(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, w.Code)
+		}
+	}
+}
+
+// TestDownloadsReportHandler tests the downloads report in both formats
+func TestDownloadsReportHandler(t *testing.T) {
+	recorder := stats.NewRecorder(30 * 24 * time.Hour)
+	recorder.Record(stats.Download{Hostname: "registry.terraform.io", Namespace: "hashicorp", Type: "aws", Version: "6.0.0", Client: "ci", Bytes: 42})
+	recorder.Record(stats.Download{Hostname: "registry.terraform.io", Namespace: "hashicorp", Type: "aws", Version: "6.0.0", Client: "ci", Bytes: 42})
+	recorder.Record(stats.Download{Hostname: "registry.terraform.io", Namespace: "hashicorp", Type: "aws", Version: "6.0.0", Client: "10.0.0.1", Bytes: 42})
+
+	handlers := NewHandlers(createTestMirror(nil, nil, nil, nil, nil, nil), metricsForTests(), recorder, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	req := httptest.NewRequest("GET", "/admin/reports/downloads", nil)
+	w := httptest.NewRecorder()
+	handlers.DownloadsReportHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	var report stats.Report
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if report.TotalDownloads != 3 || len(report.Entries) != 2 {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	req = httptest.NewRequest("GET", "/admin/reports/downloads?format=csv&from="+time.Now().Add(-24*time.Hour).UTC().Format(time.RFC3339), nil)
+	w = httptest.NewRecorder()
+	handlers.DownloadsReportHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/csv" {
+		t.Errorf("expected Content-Type text/csv, got %s", ct)
+	}
+	want := "hostname,namespace,type,version,client,downloads,bytes\n" +
+		"registry.terraform.io,hashicorp,aws,6.0.0,10.0.0.1,1,42\n" +
+		"registry.terraform.io,hashicorp,aws,6.0.0,ci,2,84\n"
+	if w.Body.String() != want {
+		t.Errorf("unexpected CSV:\n%s", w.Body.String())
+	}
+
+	// A period starting before the stats retention would be reported incomplete
+	for _, query := range []string{"from=yesterday", "to=2025-13-01", "from=2025-12-02&to=2025-12-01", "format=xml", "from=2000-01-01"} {
+		req := httptest.NewRequest("GET", "/admin/reports/downloads?"+query, nil)
+		w := httptest.NewRecorder()
+		handlers.DownloadsReportHandler(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, w.Code)
+		}
+	}
+}
+
+// TestUpstreamsHandler tests listing upstreams when none are probed
+func TestUpstreamsHandler(t *testing.T) {
+	handlers := NewHandlers(createTestMirror(nil, nil, nil, nil, nil, nil), metricsForTests(), stats.NewRecorder(24*time.Hour), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	req := httptest.NewRequest("GET", "/admin/upstreams", nil)
+	w := httptest.NewRecorder()
+	handlers.UpstreamsHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	if body := strings.TrimSpace(w.Body.String()); body != `{"upstreams":[]}` {
+		t.Errorf("unexpected body %s", body)
+	}
+}
+
+// TestBackupHandler tests downloading a backup of the cache and restoring it elsewhere
+func TestBackupHandler(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	store.PutIndex(ctx, "registry.terraform.io", "hashicorp", "aws", []byte(`{"versions":{"6.0.0":{}}}`))
+	store.PutArchive(ctx, "registry.terraform.io/hashicorp/aws/terraform-provider-aws_6.0.0_linux_amd64.zip", strings.NewReader("archive"))
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	testMirror := mirror.NewMirror(store, mirror.NewUpstreamClient(30, 2, 1, logger), "http://localhost:8080")
+	handlers := NewHandlers(testMirror, metricsForTests(), stats.NewRecorder(time.Hour), logger)
+
+	w := httptest.NewRecorder()
+	handlers.BackupHandler(w, httptest.NewRequest("GET", "/admin/backup?archives=true", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/gzip" {
+		t.Fatalf("expected a gzip backup, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	restored, err := storage.NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	manifest, err := restored.Restore(ctx, w.Body)
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if !manifest.Archives || manifest.Files == 0 {
+		t.Errorf("unexpected manifest %+v", manifest)
+	}
+	if ok, _ := restored.ExistsArchive(ctx, "registry.terraform.io/hashicorp/aws/terraform-provider-aws_6.0.0_linux_amd64.zip"); !ok {
+		t.Error("expected the archive to be restored")
+	}
+
+	w = httptest.NewRecorder()
+	handlers.BackupHandler(w, httptest.NewRequest("GET", "/admin/backup?since=yesterday", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid since, got %d", w.Code)
+	}
+
+	// Storage that cannot be backed up is reported before anything is streamed
+	handlers = NewHandlers(createTestMirror(nil, nil, nil, nil, nil, nil), metricsForTests(), stats.NewRecorder(time.Hour), logger)
+	w = httptest.NewRecorder()
+	handlers.BackupHandler(w, httptest.NewRequest("GET", "/admin/backup", nil))
+	if w.Code != http.StatusNotImplemented || w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("expected a 501 JSON error, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+}
+
+// TestJobsHandlers tests queueing, reading and cancelling jobs through the admin API
+func TestJobsHandlers(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	queue, err := jobs.NewQueue(jobs.Options{Workers: 1, QueueSize: 10}, metricsForTests(), logger)
+	if err != nil {
+		t.Fatalf("NewQueue failed: %v", err)
+	}
+	queue.Register("wait", func(ctx context.Context, _ map[string]string) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+
+	cfg := &config.Config{AdminToken: "s3cret"}
+	router, _, err := newRouter(cfg, createTestMirror(nil, nil, nil, nil, nil, nil), metricsForTests(), stats.NewRecorder(time.Hour), queue, logger)
+	if err != nil {
+		t.Fatalf("newRouter failed: %v", err)
+	}
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer s3cret")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("POST", "/admin/jobs", `{"kind":"missing"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown kind: expected status 400, got %d", w.Code)
+	}
+
+	w := do("POST", "/admin/jobs", `{"kind":"wait","params":{"reason":"test"}}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var job jobs.Job
+	if err := json.Unmarshal(w.Body.Bytes(), &job); err != nil {
+		t.Fatalf("failed to decode job: %v", err)
+	}
+	if job.Kind != "wait" || job.Status != jobs.StatusQueued || job.Params["reason"] != "test" {
+		t.Errorf("unexpected job %+v", job)
+	}
+
+	if w := do("GET", "/admin/jobs", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), job.ID) {
+		t.Errorf("list: got %d %s", w.Code, w.Body.String())
+	}
+	if w := do("GET", "/admin/jobs/"+job.ID, ""); w.Code != http.StatusOK {
+		t.Errorf("get: expected status 200, got %d", w.Code)
+	}
+	if w := do("GET", "/admin/jobs/unknown", ""); w.Code != http.StatusNotFound {
+		t.Errorf("get unknown: expected status 404, got %d", w.Code)
+	}
+
+	// The queue is not running, so the job is cancelled straight away
+	if w := do("DELETE", "/admin/jobs/"+job.ID, ""); w.Code != http.StatusAccepted {
+		t.Errorf("cancel: expected status 202, got %d", w.Code)
+	}
+	if w := do("DELETE", "/admin/jobs/"+job.ID, ""); w.Code != http.StatusConflict {
+		t.Errorf("cancel finished: expected status 409, got %d", w.Code)
+	}
+}
+
+// TestPrefetchHandler tests queueing prefetch jobs with the prefetch scope
+func TestPrefetchHandler(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	queue, err := jobs.NewQueue(jobs.Options{Workers: 1, QueueSize: 10}, metricsForTests(), logger)
+	if err != nil {
+		t.Fatalf("NewQueue failed: %v", err)
+	}
+	queue.Register("prefetch", func(ctx context.Context, _ map[string]string) (string, error) {
+		return "", nil
+	})
+
+	cfg := &config.Config{AdminToken: "s3cret"}
+	router, _, err := newRouter(cfg, createTestMirror(nil, nil, nil, nil, nil, nil), metricsForTests(), stats.NewRecorder(time.Hour), queue, logger)
+	if err != nil {
+		t.Fatalf("newRouter failed: %v", err)
+	}
+
+	do := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/admin/prefetch", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer s3cret")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, body := range []string{
+		`not json`,
+		`{"hostname":"registry.terraform.io","namespace":"hashicorp","type":"aws"}`,
+		`{"hostname":"registry.terraform.io","namespace":"hashicorp","type":"aws","version":"6.0.0","platforms":["linux"]}`,
+	} {
+		if w := do(body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", body, w.Code)
+		}
+	}
+
+	w := do(`{"hostname":"registry.terraform.io","namespace":"hashicorp","type":"aws","version":"6.0.0","platforms":["linux_amd64","darwin_arm64"]}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var job jobs.Job
+	if err := json.Unmarshal(w.Body.Bytes(), &job); err != nil {
+		t.Fatalf("failed to decode job: %v", err)
+	}
+	if job.Kind != "prefetch" || job.Params["version"] != "6.0.0" || job.Params["platforms"] != "linux_amd64,darwin_arm64" {
+		t.Errorf("unexpected job %+v", job)
+	}
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/elisiariocouto/specular/internal/auth"
+)
+
+// Authenticator resolves bearer credentials into principals
+// Credentials are checked against the static admin token, JWTs from the
+// configured OIDC issuer and the API keys file, in that order
+type Authenticator struct {
+	token    string
+	verifier *auth.OIDCVerifier
+	keys     *auth.KeyStore
+	logger   *slog.Logger
+}
+
+// NewAuthenticator creates an authenticator, any of the credential sources may be disabled
+// by passing an empty token or nil verifier or key store
+func NewAuthenticator(token string, verifier *auth.OIDCVerifier, keys *auth.KeyStore, logger *slog.Logger) *Authenticator {
+	return &Authenticator{
+		token:    token,
+		verifier: verifier,
+		keys:     keys,
+		logger:   logger,
+	}
+}
+
+// Authenticate returns the principal behind the request's bearer credential
+// The static admin token and OIDC principals are granted every scope
+func (a *Authenticator) Authenticate(r *http.Request) (auth.Principal, bool) {
+	provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		// Clients that only send basic credentials, such as NuGet, pass the credential as the password
+		_, provided, ok = r.BasicAuth()
+	}
+	if !ok || provided == "" {
+		return auth.Principal{}, false
+	}
+
+	if a.token != "" && subtle.ConstantTimeCompare([]byte(provided), []byte(a.token)) == 1 {
+		return auth.Principal{Method: auth.MethodAdminToken, ID: "admin", Scopes: auth.AllScopes}, true
+	}
+
+	if a.keys != nil {
+		key, ok := a.keys.Lookup(provided)
+		if ok {
+			return auth.Principal{Method: auth.MethodAPIKey, ID: key.ID, Scopes: key.Scopes}, true
+		}
+		if key.ID != "" {
+			a.logger.WarnContext(r.Context(), "revoked API key used",
+				slog.String("key_id", key.ID),
+				slog.String("path", r.URL.Path),
+			)
+			return auth.Principal{}, false
+		}
+	}
+
+	if a.verifier != nil && strings.Count(provided, ".") == 2 {
+		claims, err := a.verifier.Verify(r.Context(), provided)
+		if err == nil {
+			return auth.Principal{Method: auth.MethodOIDC, ID: claims.Subject(), Scopes: auth.AllScopes}, true
+		}
+		a.logger.WarnContext(r.Context(), "OIDC token rejected",
+			slog.String("error", err.Error()),
+			slog.String("path", r.URL.Path),
+		)
+	}
+
+	return auth.Principal{}, false
+}
+
+// RequireScope returns middleware that only lets through principals granted scope
+// Unauthenticated requests get 401 and principals lacking the scope get 403
+// Every authorized request is recorded in the audit log with the principal ID
+func (a *Authenticator) RequireScope(scope auth.Scope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := a.Authenticate(r)
+			if !ok {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="specular"`)
+				writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+			if !principal.HasScope(scope) {
+				a.logger.WarnContext(r.Context(), "audit",
+					slog.String("auth_method", principal.Method),
+					slog.String("principal", principal.ID),
+					slog.String("scope", string(scope)),
+					slog.String("method", r.Method),
+					slog.String("path", r.URL.Path),
+					slog.Int("status", http.StatusForbidden),
+				)
+				writeJSONError(w, http.StatusForbidden, "missing scope "+string(scope))
+				return
+			}
+
+			wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			next.ServeHTTP(wrapped, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+
+			a.logger.InfoContext(r.Context(), "audit",
+				slog.String("auth_method", principal.Method),
+				slog.String("principal", principal.ID),
+				slog.String("scope", string(scope)),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", wrapped.statusCode),
+			)
+		})
+	}
+}
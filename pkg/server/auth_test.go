@@ -0,0 +1,82 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/elisiariocouto/specular/internal/auth"
+)
+
+// TestAuthenticatorRequireScope tests bearer authentication and scope enforcement
+func TestAuthenticatorRequireScope(t *testing.T) {
+	hash := func(secret string) string {
+		sum := sha256.Sum256([]byte(secret))
+		return hex.EncodeToString(sum[:])
+	}
+	keysFile := filepath.Join(t.TempDir(), "keys.json")
+	keysJSON := `{"keys": [
+		{"id": "ci", "sha256": "` + hash("ci-secret") + `", "scopes": ["read-mirror"]},
+		{"id": "dashboard", "sha256": "` + hash("dash-secret") + `", "scopes": ["stats"]},
+		{"id": "old", "sha256": "` + hash("old-secret") + `", "scopes": ["stats"], "revoked": true}
+	]}`
+	if err := os.WriteFile(keysFile, []byte(keysJSON), 0o600); err != nil {
+		t.Fatalf("failed to write keys file: %v", err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	keys, err := auth.NewKeyStore(keysFile, logger)
+	if err != nil {
+		t.Fatalf("failed to load keys: %v", err)
+	}
+	authn := NewAuthenticator("s3cret", nil, keys, logger)
+
+	var gotPrincipal auth.Principal
+	handler := authn.RequireScope(auth.ScopeStats)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPrincipal, _ = auth.PrincipalFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name   string
+		header string
+		want   int
+		wantID string
+	}{
+		{name: "missing", header: "", want: http.StatusUnauthorized},
+		{name: "wrong token", header: "Bearer nope", want: http.StatusUnauthorized},
+		{name: "wrong scheme", header: "Basic s3cret", want: http.StatusUnauthorized},
+		{name: "admin token", header: "Bearer s3cret", want: http.StatusOK, wantID: "admin"},
+		{name: "scoped key", header: "Bearer dash-secret", want: http.StatusOK, wantID: "dashboard"},
+		{name: "key without scope", header: "Bearer ci-secret", want: http.StatusForbidden},
+		{name: "revoked key", header: "Bearer old-secret", want: http.StatusUnauthorized},
+		{name: "basic password", header: "Basic " + base64.StdEncoding.EncodeToString([]byte("nuget:dash-secret")), want: http.StatusOK, wantID: "dashboard"},
+		{name: "basic wrong password", header: "Basic " + base64.StdEncoding.EncodeToString([]byte("dash-secret:nope")), want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotPrincipal = auth.Principal{}
+			req := httptest.NewRequest("GET", "/admin/stats/top", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("expected status %d, got %d", tt.want, w.Code)
+			}
+			if gotPrincipal.ID != tt.wantID {
+				t.Errorf("expected principal %q, got %q", tt.wantID, gotPrincipal.ID)
+			}
+		})
+	}
+}
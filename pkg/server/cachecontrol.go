@@ -0,0 +1,28 @@
+package server
+
+import (
+	"github.com/elisiariocouto/specular/pkg/mirror"
+)
+
+// cacheControl picks the Cache-Control header of index, version and archive responses
+// The zero value serves metadataCacheControl for metadata and archiveCacheControl for archives
+type cacheControl struct {
+	// resources holds the header value of each resource type, keyed by index, version or archive
+	resources map[string]string
+	// overrides holds the header value of every resource type of matching providers, such as no-store for internal ones
+	overrides mirror.ProviderRules[string]
+}
+
+// value returns the Cache-Control header of a resource type served for a provider
+func (c cacheControl) value(resourceType, hostname, namespace, providerType string) string {
+	if value, ok := c.overrides.Lookup(hostname, namespace, providerType); ok {
+		return value
+	}
+	if value, ok := c.resources[resourceType]; ok {
+		return value
+	}
+	if resourceType == "archive" {
+		return archiveCacheControl
+	}
+	return metadataCacheControl
+}
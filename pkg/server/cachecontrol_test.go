@@ -0,0 +1,57 @@
+package server
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/elisiariocouto/specular/internal/stats"
+	"github.com/elisiariocouto/specular/pkg/mirror"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestCacheControlValue(t *testing.T) {
+	c := cacheControl{
+		resources: map[string]string{"index": "public, max-age=60"},
+		overrides: mirror.ProviderRules[string]{"registry.example.com/internal": "no-store"},
+	}
+
+	tests := []struct {
+		resourceType, hostname, namespace string
+		want                              string
+	}{
+		{"index", "registry.terraform.io", "hashicorp", "public, max-age=60"},
+		{"version", "registry.terraform.io", "hashicorp", metadataCacheControl},
+		{"archive", "registry.terraform.io", "hashicorp", archiveCacheControl},
+		{"index", "registry.example.com", "internal", "no-store"},
+		{"archive", "registry.example.com", "internal", "no-store"},
+		{"archive", "registry.example.com", "public", archiveCacheControl},
+	}
+	for _, tt := range tests {
+		if got := c.value(tt.resourceType, tt.hostname, tt.namespace, "netbox"); got != tt.want {
+			t.Errorf("value(%s, %s/%s) = %q, want %q", tt.resourceType, tt.hostname, tt.namespace, got, tt.want)
+		}
+	}
+}
+
+func TestIndexHandler_CacheControlOverride(t *testing.T) {
+	testMirror := createTestMirror([]byte(`{"versions":{"1.0.0":{}}}`), nil, nil, nil, nil, nil)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handlers := NewHandlers(testMirror, metricsForTests(), stats.NewRecorder(time.Hour), logger)
+	handlers.cacheControl = cacheControl{overrides: mirror.ProviderRules[string]{"registry.example.com": "no-store"}}
+
+	router := chi.NewRouter()
+	router.Get("/terraform/providers/{hostname}/{namespace}/{type}/*", handlers.MetadataHandler)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/terraform/providers/registry.example.com/internal/netbox/index.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Errorf("expected Cache-Control no-store, got %s", cc)
+	}
+}
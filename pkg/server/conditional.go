@@ -0,0 +1,72 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// archiveETag builds a strong ETag from an archive's SHA-256, or returns an empty string if it is unknown
+func archiveETag(sum string) string {
+	if sum == "" {
+		return ""
+	}
+	return `"sha256-` + sum + `"`
+}
+
+// etagMatches reports whether an If-None-Match header matches etag
+// If-None-Match uses weak comparison, so W/ prefixes are ignored
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for candidate := range strings.SplitSeq(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified reports whether a conditional request is satisfied by a cached entry
+// If-None-Match takes precedence over If-Modified-Since, as required by RFC 9110
+func notModified(r *http.Request, etag string, modTime time.Time) bool {
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		return etag != "" && etagMatches(header, etag)
+	}
+	if modTime.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	// HTTP dates have second precision
+	return !modTime.Truncate(time.Second).After(since)
+}
+
+// setValidators sets the ETag and Last-Modified headers for the entries that are known
+func setValidators(w http.ResponseWriter, etag string, modTime time.Time) {
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	if !modTime.IsZero() {
+		w.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+}
+
+// setChecksumHeaders advertises an archive's SHA-256 so clients can verify it without fetching SHA256SUMS
+// X-Checksum-SHA256 is hex-encoded like SHA256SUMS, Digest (RFC 3230) and Repr-Digest (RFC 9530) use base64
+func setChecksumHeaders(w http.ResponseWriter, sum string) {
+	raw, err := hex.DecodeString(sum)
+	if err != nil || len(raw) == 0 {
+		return
+	}
+	encoded := base64.StdEncoding.EncodeToString(raw)
+	w.Header().Set("X-Checksum-SHA256", sum)
+	w.Header().Set("Digest", "SHA-256="+encoded)
+	w.Header().Set("Repr-Digest", "sha-256=:"+encoded+":")
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNotModified(t *testing.T) {
+	modTime := time.Date(2026, 3, 1, 12, 0, 0, 500, time.UTC)
+	etag := `"sha256-abc"`
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		etag    string
+		modTime time.Time
+		want    bool
+	}{
+		{name: "unconditional", etag: etag, modTime: modTime, want: false},
+		{name: "etag match", headers: map[string]string{"If-None-Match": etag}, etag: etag, want: true},
+		{name: "etag mismatch", headers: map[string]string{"If-None-Match": `"sha256-def"`}, etag: etag, want: false},
+		{name: "unknown etag", headers: map[string]string{"If-None-Match": "*"}, want: false},
+		{name: "modified since", headers: map[string]string{"If-Modified-Since": modTime.Add(-time.Minute).Format(http.TimeFormat)}, modTime: modTime, want: false},
+		{name: "same second", headers: map[string]string{"If-Modified-Since": modTime.Format(http.TimeFormat)}, modTime: modTime, want: true},
+		{name: "later", headers: map[string]string{"If-Modified-Since": modTime.Add(time.Hour).Format(http.TimeFormat)}, modTime: modTime, want: true},
+		{name: "invalid date", headers: map[string]string{"If-Modified-Since": "yesterday"}, modTime: modTime, want: false},
+		{name: "unknown modification time", headers: map[string]string{"If-Modified-Since": modTime.Format(http.TimeFormat)}, want: false},
+		{
+			name: "if-none-match takes precedence",
+			headers: map[string]string{
+				"If-None-Match":     `"sha256-def"`,
+				"If-Modified-Since": modTime.Add(time.Hour).Format(http.TimeFormat),
+			},
+			etag:    etag,
+			modTime: modTime,
+			want:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			if got := notModified(req, tt.etag, tt.modTime); got != tt.want {
+				t.Errorf("notModified = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
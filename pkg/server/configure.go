@@ -0,0 +1,88 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/elisiariocouto/specular/pkg/config"
+	"github.com/elisiariocouto/specular/pkg/mirror"
+)
+
+// ConfigureUpstream applies the fault injection, provider sources and background limits from cfg
+func ConfigureUpstream(u *mirror.UpstreamClient, cfg *config.Config) error {
+	if cfg.ChaosEnabled {
+		u.EnableChaos(mirror.ChaosConfig{
+			Latency:      cfg.ChaosLatency,
+			ErrorRate:    cfg.ChaosErrorRate,
+			TruncateRate: cfg.ChaosTruncateRate,
+		})
+	}
+
+	sources, err := config.ParseProviderSources(cfg.ProviderSources)
+	if err != nil {
+		return fmt.Errorf("invalid provider sources: %w", err)
+	}
+	u.SetProviderSources(sources)
+
+	// Spread the upstream requests of prefetch and refresh jobs over time to stay clear of registry throttling
+	rates, err := config.ParseRateLimits(cfg.BackgroundRateLimits)
+	if err != nil {
+		return fmt.Errorf("invalid background rate limits: %w", err)
+	}
+	u.SetBackgroundLimiter(mirror.NewHostLimiter(cfg.BackgroundRateLimit, rates))
+	u.SetBackgroundBudget(mirror.NewDownloadBudget(cfg.BackgroundMaxDownloads, cfg.BackgroundMaxBandwidth))
+	return nil
+}
+
+// ConfigureMirror applies the cache policies, metadata TTLs, withdrawn versions and passthrough providers from cfg
+func ConfigureMirror(m *mirror.Mirror, cfg *config.Config) error {
+	policies, err := config.ParseCachePolicies(cfg.CachePolicy)
+	if err != nil {
+		return fmt.Errorf("invalid cache policy: %w", err)
+	}
+	cachePolicies := mirror.CachePolicies{
+		Index:   mirror.CachePolicy(policies["index"]),
+		Version: mirror.CachePolicy(policies["version"]),
+		Archive: mirror.CachePolicy(policies["archive"]),
+	}
+	if cfg.StorageReadOnly {
+		// Cache misses are streamed from upstream instead of failing to be stored
+		cachePolicies = mirror.CachePolicies{Index: mirror.CacheNoStore, Version: mirror.CacheNoStore, Archive: mirror.CacheNoStore}
+	}
+	m.SetCachePolicies(cachePolicies)
+
+	ttlOverrides, err := config.ParseMetadataTTLs(cfg.MetadataTTLOverrides)
+	if err != nil {
+		return fmt.Errorf("invalid metadata TTL overrides: %w", err)
+	}
+	m.SetMetadataTTL(mirror.MetadataTTL{
+		Default:   cfg.MetadataTTL,
+		Overrides: ttlOverrides,
+	})
+
+	withdrawnOverrides, err := config.ParseWithdrawnPolicies(cfg.WithdrawnVersionsOverrides)
+	if err != nil {
+		return fmt.Errorf("invalid withdrawn versions overrides: %w", err)
+	}
+	withdrawn := mirror.WithdrawnVersions{
+		Default:   mirror.WithdrawnPolicy(cfg.WithdrawnVersions),
+		Overrides: make(mirror.ProviderRules[mirror.WithdrawnPolicy], len(withdrawnOverrides)),
+	}
+	for pattern, policy := range withdrawnOverrides {
+		withdrawn.Overrides[pattern] = mirror.WithdrawnPolicy(policy)
+	}
+	m.SetWithdrawnVersions(withdrawn)
+	m.SetStrictIndex(cfg.StrictIndex)
+	m.SetVerifyShasums(cfg.VerifyShasums)
+	m.SetArchiveRedirect(cfg.ArchiveRedirectExpiry)
+
+	passthroughProviders, err := config.ParseProviderPatterns(cfg.PassthroughProviders)
+	if err != nil {
+		return fmt.Errorf("invalid passthrough providers: %w", err)
+	}
+	bypass := make(mirror.ProviderRules[bool], len(passthroughProviders))
+	for _, provider := range passthroughProviders {
+		bypass[provider] = true
+	}
+	m.SetPassthroughProviders(bypass)
+	return nil
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+// WellKnownHandler serves the service discovery document of the registry set as discovery host
+// Every service is forwarded with its URLs resolved against the registry, so clients that use Specular's
+// hostname as a registry keep modules, login and the other services. 404 when no discovery host is set
+func (h *Handlers) WellKnownHandler(w http.ResponseWriter, r *http.Request) {
+	if h.discoveryHost == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	h.handleRequest(w, r, "discovery",
+		[]slog.Attr{slog.String("hostname", h.discoveryHost)},
+		func() (any, error) {
+			return h.mirror.Services(r.Context(), h.discoveryHost)
+		},
+		func(data any) error {
+			body, err := json.Marshal(data)
+			if err != nil {
+				return err
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Cache-Control", metadataCacheControl)
+			_, err = w.Write(body)
+			return err
+		},
+	)
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/elisiariocouto/specular/internal/stats"
+	"github.com/elisiariocouto/specular/pkg/mirror"
+)
+
+// discoveryMirror is a fakeMirror serving a fixed service discovery document
+type discoveryMirror struct {
+	fakeMirror
+	services map[string]json.RawMessage
+}
+
+func (d *discoveryMirror) Services(ctx context.Context, hostname string) (map[string]json.RawMessage, error) {
+	if d.services == nil {
+		return nil, fmt.Errorf("%w: connection refused", mirror.ErrUpstreamUnavailable)
+	}
+	return d.services, nil
+}
+
+// TestWellKnownHandler tests forwarding the discovery document of the discovery host
+func TestWellKnownHandler(t *testing.T) {
+	services := map[string]json.RawMessage{
+		"providers.v1": json.RawMessage(`"https://registry.example.com/v1/providers/"`),
+		"modules.v1":   json.RawMessage(`"https://registry.example.com/v1/modules/"`),
+		"login.v1":     json.RawMessage(`{"client":"terraform-cli"}`),
+	}
+	tests := []struct {
+		name          string
+		discoveryHost string
+		services      map[string]json.RawMessage
+		status        int
+	}{
+		{"forwarded", "registry.example.com", services, http.StatusOK},
+		{"no discovery host", "", services, http.StatusNotFound},
+		{"upstream unavailable", "registry.example.com", nil, http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			handlers := NewHandlers(&discoveryMirror{services: tt.services}, metricsForTests(), stats.NewRecorder(time.Hour), logger)
+			handlers.discoveryHost = tt.discoveryHost
+
+			w := httptest.NewRecorder()
+			handlers.WellKnownHandler(w, httptest.NewRequest("GET", "/.well-known/terraform.json", nil))
+			if w.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, w.Code)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var got map[string]json.RawMessage
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			for name, value := range services {
+				if string(got[name]) != string(value) {
+					t.Errorf("expected %s %s, got %s", name, value, got[name])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/elisiariocouto/specular/pkg/mirror"
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+// errorStatus maps a mirror error to the HTTP status returned to clients and the error type recorded in metrics
+func errorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, mirror.ErrNotFound) || storage.IsNotFound(err):
+		return http.StatusNotFound, "not_found"
+	case errors.Is(err, mirror.ErrVersionWithdrawn):
+		return http.StatusGone, "version_withdrawn"
+	case errors.Is(err, mirror.ErrValidation):
+		return http.StatusBadRequest, "invalid_params"
+	case errors.Is(err, mirror.ErrUpstreamRateLimited):
+		return http.StatusTooManyRequests, "upstream_rate_limited"
+	case errors.Is(err, mirror.ErrUpstreamUnavailable) && isTimeout(err):
+		return http.StatusGatewayTimeout, "upstream_timeout"
+	case errors.Is(err, mirror.ErrUpstreamUnavailable):
+		return http.StatusBadGateway, "upstream_unavailable"
+	case errors.Is(err, mirror.ErrStorageFailure):
+		return http.StatusServiceUnavailable, "storage_failure"
+	case errors.Is(err, context.DeadlineExceeded):
+		// The request ran out of time waiting on upstream, such as between retries
+		return http.StatusGatewayTimeout, "upstream_timeout"
+	default:
+		return http.StatusInternalServerError, "fetch_failed"
+	}
+}
+
+// isTimeout reports whether err is caused by upstream taking too long, either to connect or respond
+// or by answering with 504 Gateway Timeout itself
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, mirror.ErrUpstreamTimeout) || errors.Is(err, context.DeadlineExceeded) ||
+		(errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// writeError writes the status for err as a JSON error body, passing on upstream's Retry-After when rate limited
+// Internal error details are logged, not returned to clients
+func writeError(w http.ResponseWriter, err error, status int) {
+	var rateErr *mirror.RateLimitError
+	if errors.As(err, &rateErr) && rateErr.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(rateErr.RetryAfter.Seconds()))))
+	}
+	writeJSONError(w, status, http.StatusText(status))
+}
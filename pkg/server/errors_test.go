@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elisiariocouto/specular/pkg/mirror"
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{"not found", mirror.ErrNotFound, http.StatusNotFound},
+		{"storage not found", storage.ErrNotFound, http.StatusNotFound},
+		{"legacy io.EOF", io.EOF, http.StatusNotFound},
+		{"validation", fmt.Errorf("%w: bad namespace", mirror.ErrInvalidAddress), http.StatusBadRequest},
+		{"rate limited", &mirror.RateLimitError{RetryAfter: time.Minute}, http.StatusTooManyRequests},
+		{"upstream unavailable", fmt.Errorf("%w: unexpected status code: 500", mirror.ErrUpstreamUnavailable), http.StatusBadGateway},
+		{"upstream timeout", fmt.Errorf("%w: unexpected status code: 504", mirror.ErrUpstreamTimeout), http.StatusGatewayTimeout},
+		{"upstream connection timeout", fmt.Errorf("%w: %w", mirror.ErrUpstreamUnavailable, &net.OpError{Op: "dial", Err: timeoutError{}}), http.StatusGatewayTimeout},
+		{"deadline exceeded", fmt.Errorf("backoff: %w", context.DeadlineExceeded), http.StatusGatewayTimeout},
+		{"version withdrawn", fmt.Errorf("%w: registry.terraform.io/hashicorp/aws 1.0.0", mirror.ErrVersionWithdrawn), http.StatusGone},
+		{"storage failure", fmt.Errorf("%w: disk full", mirror.ErrStorageFailure), http.StatusServiceUnavailable},
+		{"unknown", errors.New("boom"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, _ := errorStatus(tt.err); status != tt.status {
+				t.Errorf("errorStatus(%v) = %d, want %d", tt.err, status, tt.status)
+			}
+		})
+	}
+}
+
+func TestWriteError_RetryAfter(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeError(w, fmt.Errorf("fetch: %w", &mirror.RateLimitError{RetryAfter: 1500 * time.Millisecond}), http.StatusTooManyRequests)
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status 429, got %d", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("expected Retry-After 2, got %q", got)
+	}
+}
+
+func TestWriteError_JSON(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeError(w, fmt.Errorf("%w: dial tcp: i/o timeout", mirror.ErrUpstreamUnavailable), http.StatusGatewayTimeout)
+
+	if got := w.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("expected JSON content type, got %q", got)
+	}
+	// Error details stay in the logs
+	if body := strings.TrimSpace(w.Body.String()); body != `{"error":"Gateway Timeout"}` {
+		t.Errorf("unexpected body %s", body)
+	}
+}
+
+// timeoutError is a net.Error that timed out
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
@@ -0,0 +1,406 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/elisiariocouto/specular/internal/auth"
+	"github.com/elisiariocouto/specular/internal/jobs"
+	"github.com/elisiariocouto/specular/internal/stats"
+	"github.com/elisiariocouto/specular/pkg/metrics"
+	"github.com/elisiariocouto/specular/pkg/mirror"
+	"github.com/elisiariocouto/specular/pkg/nuget"
+	"github.com/elisiariocouto/specular/pkg/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// metadataCacheControl lets clients cache index and version responses for a few minutes, unless configured otherwise
+	metadataCacheControl = "public, max-age=300"
+	// archiveCacheControl lets clients cache archives for a year, they are immutable, unless configured otherwise
+	archiveCacheControl = "public, max-age=31536000"
+)
+
+// Handlers holds dependencies for HTTP handlers
+type Handlers struct {
+	mirror  Mirror
+	metrics *metrics.Metrics
+	stats   *stats.Recorder
+	jobs    *jobs.Queue
+	logger  *slog.Logger
+
+	// indexVersionLimit caps the versions advertised in served indices, zero serves all
+	indexVersionLimit int
+	// baseURL and mirrorAuthRequired are shown on the landing page
+	baseURL            string
+	mirrorAuthRequired bool
+	// discoveryHost is the registry whose service discovery document is served, empty serves none
+	discoveryHost string
+	// cacheControl picks the Cache-Control header of mirror responses
+	cacheControl cacheControl
+	// nuget proxies a NuGet v3 source under /nuget, nil when disabled
+	nuget *nuget.Proxy
+}
+
+// NewHandlers creates a new handlers instance
+func NewHandlers(m Mirror, metrics *metrics.Metrics, recorder *stats.Recorder, logger *slog.Logger) *Handlers {
+	return &Handlers{
+		mirror:  m,
+		metrics: metrics,
+		stats:   recorder,
+		logger:  logger,
+	}
+}
+
+// handleRequest is a helper that handles the common request/error/metrics pattern
+// It takes a fetch function that retrieves the data and a write function that writes the response
+func (h *Handlers) handleRequest(
+	w http.ResponseWriter,
+	r *http.Request,
+	resourceType string,
+	logAttrs []slog.Attr,
+	fetchData func() (any, error),
+	writeResponse func(any) error,
+) {
+	// Log request
+	attrs := make([]any, len(logAttrs))
+	for i, attr := range logAttrs {
+		attrs[i] = attr
+	}
+	h.logger.InfoContext(r.Context(), resourceType+" request", attrs...)
+
+	// Fetch data and measure duration
+	start := time.Now()
+	data, err := fetchData()
+	duration := time.Since(start).Seconds()
+
+	// Handle errors
+	if err != nil {
+		status, errorType := errorStatus(err)
+		if status == http.StatusNotFound {
+			h.metrics.RecordCacheMiss(resourceType)
+			h.logger.InfoContext(r.Context(), resourceType+" not found", attrs...)
+			http.NotFound(w, r)
+			return
+		}
+
+		h.metrics.RecordError(resourceType+"_handler", errorType)
+		h.logger.ErrorContext(r.Context(), "failed to get "+resourceType,
+			append(attrs, slog.String("error", err.Error()), slog.Int("status", status))...)
+		writeError(w, err, status)
+		return
+	}
+
+	// Record success metrics
+	h.metrics.RecordCacheHit(resourceType)
+	h.metrics.RecordUpstreamRequest(http.StatusOK, duration, resourceType)
+
+	// Write response
+	if err := writeResponse(data); err != nil {
+		h.logger.ErrorContext(r.Context(), "failed to write response",
+			slog.String("error", err.Error()))
+	}
+}
+
+// MetadataHandler handles index.json, version.json, and archive requests
+// Routes: /:hostname/:namespace/:type/index.json, /:hostname/:namespace/:type/:version.json, or /:hostname/:namespace/:type/archive.zip
+func (h *Handlers) MetadataHandler(w http.ResponseWriter, r *http.Request) {
+	tail := chi.URLParam(r, "*")
+
+	// Check if this is an index.json request
+	if tail == "index.json" {
+		h.IndexHandler(w, r)
+		return
+	}
+
+	// Check if tail matches version.json pattern (e.g., "6.26.0.json")
+	if strings.HasSuffix(tail, ".json") {
+		// Extract version from tail by removing the .json suffix
+		version := strings.TrimSuffix(tail, ".json")
+		h.VersionHandlerWithParams(w, r, version)
+		return
+	}
+
+	// Note: Archive downloads are now handled by the dedicated /download endpoint
+	// Archive URLs in version.json point to /download/{hostname}/{namespace}/{type}/{version}/{os}/{arch}/{filename}
+	// This makes the old .zip handling here obsolete
+
+	// Not a valid request
+	http.Error(w, "Not Found", http.StatusNotFound)
+}
+
+// IndexHandler handles GET /:hostname/:namespace/:type/index.json
+func (h *Handlers) IndexHandler(w http.ResponseWriter, r *http.Request) {
+	hostname := chi.URLParam(r, "hostname")
+	namespace := chi.URLParam(r, "namespace")
+	providerType := chi.URLParam(r, "type")
+
+	if err := validateProvider(hostname, namespace, providerType); err != nil {
+		h.writeBadRequest(w, r, err)
+		return
+	}
+
+	cacheControl := h.cacheControl.value("index", hostname, namespace, providerType)
+	modTime, _ := h.mirror.IndexModTime(r.Context(), hostname, namespace, providerType)
+	// A refresh replaces the cached copy, so the client is answered with the refreshed one
+	if !mirror.RefreshRequested(r.Context()) && h.writeNotModified(w, r, "index", cacheControl, "", modTime) {
+		return
+	}
+
+	h.handleRequest(w, r, "index",
+		[]slog.Attr{
+			slog.String("hostname", hostname),
+			slog.String("namespace", namespace),
+			slog.String("type", providerType),
+		},
+		func() (any, error) {
+			data, err := h.mirror.GetIndex(r.Context(), hostname, namespace, providerType)
+			if err != nil {
+				return nil, err
+			}
+			// The cache keeps every version, only the served index is trimmed
+			return mirror.TrimIndex(data, h.indexVersionLimit)
+		},
+		func(data any) error {
+			modTime, _ := h.mirror.IndexModTime(r.Context(), hostname, namespace, providerType)
+			setValidators(w, "", modTime)
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Cache-Control", cacheControl)
+			n, err := w.Write(data.([]byte))
+			h.metrics.RecordBytesServed("index", int64(n))
+			return err
+		},
+	)
+}
+
+// VersionHandlerWithParams handles version requests with explicit version parameter
+func (h *Handlers) VersionHandlerWithParams(w http.ResponseWriter, r *http.Request, version string) {
+	hostname := chi.URLParam(r, "hostname")
+	namespace := chi.URLParam(r, "namespace")
+	providerType := chi.URLParam(r, "type")
+
+	if err := validateProviderVersion(hostname, namespace, providerType, version); err != nil {
+		h.writeBadRequest(w, r, err)
+		return
+	}
+
+	cacheControl := h.cacheControl.value("version", hostname, namespace, providerType)
+	modTime, _ := h.mirror.VersionModTime(r.Context(), hostname, namespace, providerType, version)
+	if !mirror.RefreshRequested(r.Context()) && h.writeNotModified(w, r, "version", cacheControl, "", modTime) {
+		return
+	}
+
+	h.handleRequest(w, r, "version",
+		[]slog.Attr{
+			slog.String("hostname", hostname),
+			slog.String("namespace", namespace),
+			slog.String("type", providerType),
+			slog.String("version", version),
+		},
+		func() (any, error) {
+			return h.mirror.GetVersion(r.Context(), hostname, namespace, providerType, version)
+		},
+		func(data any) error {
+			modTime, _ := h.mirror.VersionModTime(r.Context(), hostname, namespace, providerType, version)
+			setValidators(w, "", modTime)
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Cache-Control", cacheControl)
+			n, err := w.Write(data.([]byte))
+			h.metrics.RecordBytesServed("version", int64(n))
+			return err
+		},
+	)
+}
+
+// VersionHandler handles GET /:hostname/:namespace/:type/:version.json (legacy, kept for compatibility)
+func (h *Handlers) VersionHandler(w http.ResponseWriter, r *http.Request) {
+	version := chi.URLParam(r, "version")
+	h.VersionHandlerWithParams(w, r, version)
+}
+
+// DownloadHandler handles archive downloads with explicit parameters
+// Route: /download/{hostname}/{namespace}/{type}/{version}/{os}/{arch}/{filename}
+func (h *Handlers) DownloadHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract all parameters from URL
+	hostname := chi.URLParam(r, "hostname")
+	namespace := chi.URLParam(r, "namespace")
+	providerType := chi.URLParam(r, "type")
+	version := chi.URLParam(r, "version")
+	os := chi.URLParam(r, "os")
+	arch := chi.URLParam(r, "arch")
+	filename := chi.URLParam(r, "filename")
+
+	if err := validateProviderVersion(hostname, namespace, providerType, version); err != nil {
+		h.writeBadRequest(w, r, err)
+		return
+	}
+	if err := mirror.ValidatePlatform(os, arch); err != nil {
+		h.writeBadRequest(w, r, err)
+		return
+	}
+	if err := mirror.ValidateFilename(filename); err != nil {
+		h.writeBadRequest(w, r, err)
+		return
+	}
+
+	// Construct cache path
+	archivePath := fmt.Sprintf("%s/%s/%s/%s", hostname, namespace, providerType, filename)
+
+	// Cached archives are identified by their checksum, let clients revalidate without downloading
+	// A blocked withdrawn version is not revalidated, the download below refuses it
+	cacheControl := h.cacheControl.value("archive", hostname, namespace, providerType)
+	etag, modTime := h.archiveETag(r, archivePath), h.archiveModTime(r, archivePath)
+	if notModified(r, etag, modTime) && h.mirror.CheckWithdrawn(r.Context(), hostname, namespace, providerType, version) == nil {
+		h.writeNotModified(w, r, "archive", cacheControl, etag, modTime)
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("hostname", hostname),
+		slog.String("namespace", namespace),
+		slog.String("type", providerType),
+		slog.String("version", version),
+		slog.String("os", os),
+		slog.String("arch", arch),
+		slog.String("filename", filename),
+	}
+
+	// Archives in object storage can be downloaded straight from it, sparing the mirror's bandwidth
+	// Archives that are not cached yet are proxied, which caches them for the next client
+	url, err := h.mirror.ArchiveURL(r.Context(), hostname, namespace, providerType, version, archivePath)
+	switch {
+	case err == nil:
+		h.logger.LogAttrs(r.Context(), slog.LevelInfo, "archive redirect", attrs...)
+		h.metrics.RecordCacheHit("archive")
+		h.stats.Record(stats.Download{
+			Hostname:  hostname,
+			Namespace: namespace,
+			Type:      providerType,
+			Version:   version,
+			Client:    downloadClient(r),
+		})
+		// The signed URL expires, clients and proxies must come back for a new one
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, url, http.StatusFound)
+		return
+	case !storage.IsNotFound(err) && !errors.Is(err, mirror.ErrVersionWithdrawn):
+		h.logger.LogAttrs(r.Context(), slog.LevelWarn, "failed to sign archive URL, proxying archive",
+			append(attrs, slog.String("error", err.Error()))...)
+	}
+
+	h.handleRequest(w, r, "archive", attrs,
+		func() (any, error) {
+			return h.mirror.GetArchive(r.Context(), hostname, namespace, providerType, version, os, arch, archivePath)
+		},
+		func(data any) error {
+			reader := data.(io.ReadCloser)
+			defer reader.Close()
+
+			w.Header().Set("Content-Type", "application/zip")
+			w.Header().Set("Cache-Control", cacheControl)
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+			// Archives fetched on a cache miss have been stored by now
+			sum := h.archiveChecksum(r, archivePath)
+			setValidators(w, archiveETag(sum), h.archiveModTime(r, archivePath))
+			setChecksumHeaders(w, sum)
+
+			n, err := io.Copy(w, reader)
+			h.metrics.RecordBytesServed("archive", n)
+			if err != nil {
+				return err
+			}
+
+			h.stats.Record(stats.Download{
+				Hostname:  hostname,
+				Namespace: namespace,
+				Type:      providerType,
+				Version:   version,
+				Client:    downloadClient(r),
+				Bytes:     n,
+			})
+			return nil
+		},
+	)
+}
+
+// downloadClient identifies who downloaded an archive in the statistics
+// Authenticated requests are attributed to their principal, others to the client IP
+func downloadClient(r *http.Request) string {
+	if principal, ok := auth.PrincipalFromContext(r.Context()); ok {
+		return principal.ID
+	}
+	return clientKey(r)
+}
+
+// validateProvider checks provider address path parameters
+func validateProvider(hostname, namespace, providerType string) error {
+	address := mirror.ProviderAddress{Hostname: hostname, Namespace: namespace, Type: providerType}
+	return address.Validate()
+}
+
+// validateProviderVersion checks provider address and version path parameters
+func validateProviderVersion(hostname, namespace, providerType, version string) error {
+	if err := validateProvider(hostname, namespace, providerType); err != nil {
+		return err
+	}
+	return mirror.ValidateVersion(version)
+}
+
+// writeBadRequest rejects a request with invalid path parameters
+func (h *Handlers) writeBadRequest(w http.ResponseWriter, r *http.Request, err error) {
+	h.metrics.RecordError("request_validation", "invalid_params")
+	h.logger.InfoContext(r.Context(), "invalid request",
+		slog.String("path", r.URL.Path),
+		slog.String("error", err.Error()))
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
+// writeNotModified answers a conditional request from the validators of a cached entry
+// It reports whether a 304 response was written
+func (h *Handlers) writeNotModified(w http.ResponseWriter, r *http.Request, resourceType, cacheControl, etag string, modTime time.Time) bool {
+	if !notModified(r, etag, modTime) {
+		return false
+	}
+	h.metrics.RecordCacheHit(resourceType)
+	setValidators(w, etag, modTime)
+	w.Header().Set("Cache-Control", cacheControl)
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// archiveETag returns the ETag of a cached archive, or an empty string if it is unknown
+func (h *Handlers) archiveETag(r *http.Request, archivePath string) string {
+	return archiveETag(h.archiveChecksum(r, archivePath))
+}
+
+// archiveChecksum returns the hex-encoded SHA-256 of a cached archive, or an empty string if it is unknown
+func (h *Handlers) archiveChecksum(r *http.Request, archivePath string) string {
+	sum, err := h.mirror.ArchiveChecksum(r.Context(), archivePath)
+	if err != nil {
+		return ""
+	}
+	return sum
+}
+
+// archiveModTime returns when an archive was cached, or the zero time if it is unknown
+func (h *Handlers) archiveModTime(r *http.Request, archivePath string) time.Time {
+	modTime, _ := h.mirror.ArchiveModTime(r.Context(), archivePath)
+	return modTime
+}
+
+// MetricsHandler returns the Prometheus metrics handler
+// Returns 404 if metrics are disabled
+func (h *Handlers) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !h.metrics.Enabled() {
+			http.NotFound(w, r)
+			return
+		}
+		h.metrics.Handler().ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,1016 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elisiariocouto/specular/internal/stats"
+	"github.com/elisiariocouto/specular/pkg/metrics"
+	"github.com/elisiariocouto/specular/pkg/mirror"
+	"github.com/elisiariocouto/specular/pkg/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+var testMetrics *metrics.Metrics
+
+func init() {
+	// Initialize metrics once for all tests
+	testMetrics = metrics.New(nil, metrics.Options{})
+}
+
+// TestStorage implements storage.Storage interface for testing
+type TestStorage struct {
+	indexData   []byte
+	indexErr    error
+	versionData []byte
+	versionErr  error
+	archiveData []byte
+	archiveErr  error
+}
+
+func (ts *TestStorage) GetIndex(ctx context.Context, hostname, namespace, providerType string) ([]byte, error) {
+	if ts.indexErr != nil {
+		return nil, ts.indexErr
+	}
+	return ts.indexData, nil
+}
+
+func (ts *TestStorage) PutIndex(ctx context.Context, hostname, namespace, providerType string, data []byte) error {
+	return nil
+}
+
+func (ts *TestStorage) GetVersion(ctx context.Context, hostname, namespace, providerType, version string) ([]byte, error) {
+	if ts.versionErr != nil {
+		return nil, ts.versionErr
+	}
+	return ts.versionData, nil
+}
+
+func (ts *TestStorage) PutVersion(ctx context.Context, hostname, namespace, providerType, version string, data []byte) error {
+	return nil
+}
+
+func (ts *TestStorage) GetVersionsResponse(ctx context.Context, hostname, namespace, providerType string) ([]byte, error) {
+	return nil, io.EOF
+}
+
+func (ts *TestStorage) PutVersionsResponse(ctx context.Context, hostname, namespace, providerType string, data []byte) error {
+	return nil
+}
+
+func (ts *TestStorage) GetArchive(ctx context.Context, path string) (io.ReadCloser, error) {
+	if ts.archiveErr != nil {
+		return nil, ts.archiveErr
+	}
+	return io.NopCloser(bytes.NewReader(ts.archiveData)), nil
+}
+
+func (ts *TestStorage) PutArchive(ctx context.Context, path string, data io.Reader) error {
+	return nil
+}
+
+func (ts *TestStorage) ExistsArchive(ctx context.Context, path string) (bool, error) {
+	return false, nil
+}
+
+func (ts *TestStorage) DeleteIndex(ctx context.Context, hostname, namespace, providerType string) error {
+	return nil
+}
+
+func (ts *TestStorage) DeleteVersion(ctx context.Context, hostname, namespace, providerType, version string) error {
+	return nil
+}
+
+func (ts *TestStorage) DeleteArchive(ctx context.Context, path string) error {
+	return nil
+}
+
+func (ts *TestStorage) PurgeProvider(ctx context.Context, hostname, namespace, providerType string) error {
+	return nil
+}
+
+func (ts *TestStorage) ListProviders(ctx context.Context) ([]storage.Provider, error) {
+	return nil, nil
+}
+
+func (ts *TestStorage) ListVersions(ctx context.Context, hostname, namespace, providerType string) ([]string, error) {
+	return nil, nil
+}
+
+func (ts *TestStorage) StatArchive(ctx context.Context, path string) (storage.ArchiveInfo, error) {
+	if ts.archiveErr != nil {
+		return storage.ArchiveInfo{}, ts.archiveErr
+	}
+	return storage.ArchiveInfo{Size: int64(len(ts.archiveData))}, nil
+}
+
+// metricsForTests returns the shared test metrics instance
+func metricsForTests() *metrics.Metrics {
+	return testMetrics
+}
+
+// createTestMirror creates a mirror instance configured for testing
+// upstreamFailed reports whether status is returned for an unreachable upstream
+// Whether it is 502 or 504 depends on how the network of the test environment fails
+func upstreamFailed(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusGatewayTimeout
+}
+
+func createTestMirror(indexData []byte, indexErr error, versionData []byte, versionErr error, archiveData []byte, archiveErr error) *mirror.Mirror {
+	storage := &TestStorage{
+		indexData:   indexData,
+		indexErr:    indexErr,
+		versionData: versionData,
+		versionErr:  versionErr,
+		archiveData: archiveData,
+		archiveErr:  archiveErr,
+	}
+
+	// Create an upstream client that will return the configured errors
+	upstreamLogger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	upstreamClient := mirror.NewUpstreamClient(30, 2, 1, upstreamLogger)
+
+	return mirror.NewMirror(storage, upstreamClient, "http://localhost:8080")
+}
+
+// TestIndexHandler_Success tests successful index request
+func TestIndexHandler_Success(t *testing.T) {
+	indexData := []byte(`{"versions":{"1.0.0":{},"2.0.0":{}}}`)
+	testMirror := createTestMirror(indexData, nil, nil, nil, nil, nil)
+	metricsInstance := metricsForTests()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handlers := NewHandlers(testMirror, metricsInstance, stats.NewRecorder(time.Hour), logger)
+
+	req := httptest.NewRequest("GET", "/terraform/providers/registry.terraform.io/hashicorp/aws/index.json", nil)
+	w := httptest.NewRecorder()
+
+	router := chi.NewRouter()
+	router.Get("/terraform/providers/{hostname}/{namespace}/{type}/*", handlers.MetadataHandler)
+
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", w.Code)
+	}
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected Content-Type application/json, got %s", ct)
+	}
+
+	if cc := w.Header().Get("Cache-Control"); cc != "public, max-age=300" {
+		t.Errorf("expected Cache-Control public, max-age=300, got %s", cc)
+	}
+
+	if !bytes.Equal(w.Body.Bytes(), indexData) {
+		t.Errorf("expected body %q, got %q", indexData, w.Body.Bytes())
+	}
+}
+
+// TestIndexHandler_VersionLimit tests that only the most recent versions are advertised
+func TestIndexHandler_VersionLimit(t *testing.T) {
+	indexData := []byte(`{"versions":{"1.0.0":{},"1.10.0":{},"1.9.0":{}}}`)
+	testMirror := createTestMirror(indexData, nil, nil, nil, nil, nil)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handlers := NewHandlers(testMirror, metricsForTests(), stats.NewRecorder(time.Hour), logger)
+	handlers.indexVersionLimit = 2
+
+	req := httptest.NewRequest("GET", "/terraform/providers/registry.terraform.io/hashicorp/aws/index.json", nil)
+	w := httptest.NewRecorder()
+
+	router := chi.NewRouter()
+	router.Get("/terraform/providers/{hostname}/{namespace}/{type}/*", handlers.MetadataHandler)
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	if want := `{"versions":{"1.10.0":{},"1.9.0":{}}}`; w.Body.String() != want {
+		t.Errorf("expected body %s, got %s", want, w.Body.String())
+	}
+}
+
+// TestIndexHandler_LastModified tests Last-Modified and If-Modified-Since on metadata
+func TestIndexHandler_LastModified(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	if err := store.PutIndex(context.Background(), "registry.terraform.io", "hashicorp", "aws", []byte(`{"versions":{}}`)); err != nil {
+		t.Fatalf("PutIndex failed: %v", err)
+	}
+	modTime, _ := store.IndexModTime(context.Background(), "registry.terraform.io", "hashicorp", "aws")
+	lastModified := modTime.UTC().Format(http.TimeFormat)
+
+	upstreamClient := mirror.NewUpstreamClient(30, 2, 1, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	testMirror := mirror.NewMirror(store, upstreamClient, "http://localhost:8080")
+	handlers := NewHandlers(testMirror, metricsForTests(), stats.NewRecorder(time.Hour), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	router := chi.NewRouter()
+	router.Get("/terraform/providers/{hostname}/{namespace}/{type}/*", handlers.MetadataHandler)
+
+	req := httptest.NewRequest("GET", "/terraform/providers/registry.terraform.io/hashicorp/aws/index.json", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	if got := w.Header().Get("Last-Modified"); got != lastModified {
+		t.Errorf("expected Last-Modified %s, got %s", lastModified, got)
+	}
+
+	req = httptest.NewRequest("GET", "/terraform/providers/registry.terraform.io/hashicorp/aws/index.json", nil)
+	req.Header.Set("If-Modified-Since", lastModified)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("expected status 304, got %d", w.Code)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("expected empty body, got %q", w.Body.String())
+	}
+}
+
+// refreshedMirror is a fakeMirror whose metadata is cached since modTime
+type refreshedMirror struct {
+	*fakeMirror
+	modTime time.Time
+}
+
+func (m refreshedMirror) IndexModTime(ctx context.Context, hostname, namespace, providerType string) (time.Time, error) {
+	return m.modTime, nil
+}
+
+func (m refreshedMirror) VersionModTime(ctx context.Context, hostname, namespace, providerType, version string) (time.Time, error) {
+	return m.modTime, nil
+}
+
+// TestMetadataHandler_RefreshSkipsNotModified tests that a forced refresh is served even when the client copy is current
+func TestMetadataHandler_RefreshSkipsNotModified(t *testing.T) {
+	modTime := time.Now().Add(-time.Hour)
+	m := refreshedMirror{fakeMirror: &fakeMirror{data: []byte(`{"versions":{}}`)}, modTime: modTime}
+	handlers := NewHandlers(m, metricsForTests(), stats.NewRecorder(time.Hour), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	router := chi.NewRouter()
+	router.Get("/terraform/providers/{hostname}/{namespace}/{type}/*", handlers.MetadataHandler)
+
+	for _, path := range []string{"index.json", "1.0.0.json"} {
+		for _, refresh := range []bool{false, true} {
+			req := httptest.NewRequest("GET", "/terraform/providers/registry.terraform.io/hashicorp/aws/"+path, nil)
+			req.Header.Set("If-Modified-Since", modTime.UTC().Format(http.TimeFormat))
+			want := http.StatusNotModified
+			if refresh {
+				req = req.WithContext(mirror.WithRefresh(req.Context()))
+				want = http.StatusOK
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != want {
+				t.Errorf("%s with refresh %v: expected status %d, got %d", path, refresh, want, w.Code)
+			}
+		}
+	}
+}
+
+// TestIndexHandler_StrictIndexRevalidates tests that conditional requests see archives cached in strict index mode
+func TestIndexHandler_StrictIndexRevalidates(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	ctx := context.Background()
+	if err := store.PutIndex(ctx, "registry.terraform.io", "hashicorp", "aws", []byte(`{"versions":{"1.0.0":{},"1.1.0":{}}}`)); err != nil {
+		t.Fatalf("PutIndex failed: %v", err)
+	}
+	for _, version := range []string{"1.0.0", "1.1.0"} {
+		versionJSON := `{"archives":{"linux_amd64":{"url":"http://localhost:8080/registry.terraform.io/hashicorp/aws/terraform-provider-aws_` + version + `_linux_amd64.zip"}}}`
+		if err := store.PutVersion(ctx, "registry.terraform.io", "hashicorp", "aws", version, []byte(versionJSON)); err != nil {
+			t.Fatalf("PutVersion failed: %v", err)
+		}
+	}
+	if err := store.PutArchive(ctx, "registry.terraform.io/hashicorp/aws/terraform-provider-aws_1.0.0_linux_amd64.zip", strings.NewReader("zip")); err != nil {
+		t.Fatalf("PutArchive failed: %v", err)
+	}
+	modTime, _ := store.IndexModTime(ctx, "registry.terraform.io", "hashicorp", "aws")
+
+	upstreamClient := mirror.NewUpstreamClient(30, 2, 1, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	testMirror := mirror.NewMirror(store, upstreamClient, "http://localhost:8080")
+	testMirror.SetStrictIndex(true)
+	handlers := NewHandlers(testMirror, metricsForTests(), stats.NewRecorder(time.Hour), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	router := chi.NewRouter()
+	router.Get("/terraform/providers/{hostname}/{namespace}/{type}/*", handlers.MetadataHandler)
+
+	// The index file is unchanged by a new archive, so its date cannot validate the index served
+	if err := store.PutArchive(ctx, "registry.terraform.io/hashicorp/aws/terraform-provider-aws_1.1.0_linux_amd64.zip", strings.NewReader("zip")); err != nil {
+		t.Fatalf("PutArchive failed: %v", err)
+	}
+	req := httptest.NewRequest("GET", "/terraform/providers/registry.terraform.io/hashicorp/aws/index.json", nil)
+	req.Header.Set("If-Modified-Since", modTime.Add(time.Hour).UTC().Format(http.TimeFormat))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `"1.1.0"`) {
+		t.Errorf("expected the newly cached version to be listed, got %s", w.Body.String())
+	}
+	if got := w.Header().Get("Last-Modified"); got != "" {
+		t.Errorf("expected no Last-Modified in strict index mode, got %s", got)
+	}
+}
+
+// TestIndexHandler_NotFound tests when index is not found
+func TestIndexHandler_NotFound(t *testing.T) {
+	testMirror := createTestMirror(nil, mirror.ErrNotFound, nil, nil, nil, nil)
+	metricsInstance := metricsForTests()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handlers := NewHandlers(testMirror, metricsInstance, stats.NewRecorder(time.Hour), logger)
+
+	req := httptest.NewRequest("GET", "/terraform/providers/registry.terraform.io/hashicorp/aws/index.json", nil)
+	w := httptest.NewRecorder()
+
+	router := chi.NewRouter()
+	router.Get("/terraform/providers/{hostname}/{namespace}/{type}/*", handlers.MetadataHandler)
+
+	router.ServeHTTP(w, req)
+
+	// Mirror will try to fetch from upstream when cache misses
+	// Since upstream also fails, we may get 502 or 504 instead of 404
+	if w.Code != http.StatusNotFound && !upstreamFailed(w.Code) {
+		t.Errorf("expected status 404, 502 or 504, got %d", w.Code)
+	}
+}
+
+// TestIndexHandler_Error tests error handling
+func TestIndexHandler_Error(t *testing.T) {
+	testMirror := createTestMirror(nil, fmt.Errorf("upstream error"), nil, nil, nil, nil)
+	metricsInstance := metricsForTests()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handlers := NewHandlers(testMirror, metricsInstance, stats.NewRecorder(time.Hour), logger)
+
+	req := httptest.NewRequest("GET", "/terraform/providers/registry.terraform.io/hashicorp/aws/index.json", nil)
+	w := httptest.NewRecorder()
+
+	router := chi.NewRouter()
+	router.Get("/terraform/providers/{hostname}/{namespace}/{type}/*", handlers.MetadataHandler)
+
+	router.ServeHTTP(w, req)
+
+	if !upstreamFailed(w.Code) {
+		t.Errorf("expected status 502 or 504 when upstream fails, got %d", w.Code)
+	}
+}
+
+// TestVersionHandler_Success tests successful version request
+func TestVersionHandler_Success(t *testing.T) {
+	versionData := []byte(`{"archives":{"linux_amd64":{"url":"http://localhost:8080/download/..."}}}`)
+	testMirror := createTestMirror(nil, nil, versionData, nil, nil, nil)
+	metricsInstance := metricsForTests()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handlers := NewHandlers(testMirror, metricsInstance, stats.NewRecorder(time.Hour), logger)
+
+	req := httptest.NewRequest("GET", "/terraform/providers/registry.terraform.io/hashicorp/aws/1.0.0.json", nil)
+	w := httptest.NewRecorder()
+
+	router := chi.NewRouter()
+	router.Get("/terraform/providers/{hostname}/{namespace}/{type}/*", handlers.MetadataHandler)
+
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", w.Code)
+	}
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected Content-Type application/json, got %s", ct)
+	}
+
+	if cc := w.Header().Get("Cache-Control"); cc != "public, max-age=300" {
+		t.Errorf("expected Cache-Control public, max-age=300, got %s", cc)
+	}
+
+	if !bytes.Equal(w.Body.Bytes(), versionData) {
+		t.Errorf("expected body %q, got %q", versionData, w.Body.Bytes())
+	}
+}
+
+// TestVersionHandler_NotFound tests when version is not found
+func TestVersionHandler_NotFound(t *testing.T) {
+	testMirror := createTestMirror(nil, nil, nil, mirror.ErrNotFound, nil, nil)
+	metricsInstance := metricsForTests()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handlers := NewHandlers(testMirror, metricsInstance, stats.NewRecorder(time.Hour), logger)
+
+	req := httptest.NewRequest("GET", "/terraform/providers/registry.terraform.io/hashicorp/aws/99.0.0.json", nil)
+	w := httptest.NewRecorder()
+
+	router := chi.NewRouter()
+	router.Get("/terraform/providers/{hostname}/{namespace}/{type}/*", handlers.MetadataHandler)
+
+	router.ServeHTTP(w, req)
+
+	// Mirror will try to fetch from upstream when cache misses
+	// Since upstream also fails, we may get 502 or 504 instead of 404
+	if w.Code != http.StatusNotFound && !upstreamFailed(w.Code) {
+		t.Errorf("expected status 404, 502 or 504, got %d", w.Code)
+	}
+}
+
+// TestVersionHandler_Error tests error handling for version requests
+func TestVersionHandler_Error(t *testing.T) {
+	testMirror := createTestMirror(nil, nil, nil, fmt.Errorf("upstream error"), nil, nil)
+	metricsInstance := metricsForTests()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handlers := NewHandlers(testMirror, metricsInstance, stats.NewRecorder(time.Hour), logger)
+
+	req := httptest.NewRequest("GET", "/terraform/providers/registry.terraform.io/hashicorp/aws/1.0.0.json", nil)
+	w := httptest.NewRecorder()
+
+	router := chi.NewRouter()
+	router.Get("/terraform/providers/{hostname}/{namespace}/{type}/*", handlers.MetadataHandler)
+
+	router.ServeHTTP(w, req)
+
+	if !upstreamFailed(w.Code) {
+		t.Errorf("expected status 502 or 504 when upstream fails, got %d", w.Code)
+	}
+}
+
+// TestDownloadHandler_Success tests successful archive download
+func TestDownloadHandler_Success(t *testing.T) {
+	archiveContent := []byte("archive file content")
+	testMirror := createTestMirror(nil, nil, nil, nil, archiveContent, nil)
+	metricsInstance := metricsForTests()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handlers := NewHandlers(testMirror, metricsInstance, stats.NewRecorder(time.Hour), logger)
+
+	req := httptest.NewRequest(
+		"GET",
+		"/terraform/providers/download/registry.terraform.io/hashicorp/aws/1.0.0/linux/amd64/terraform-provider-aws_1.0.0_linux_amd64.zip",
+		nil,
+	)
+	w := httptest.NewRecorder()
+
+	router := chi.NewRouter()
+	router.Get("/terraform/providers/download/{hostname}/{namespace}/{type}/{version}/{os}/{arch}/{filename}", handlers.DownloadHandler)
+
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", w.Code)
+	}
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/zip" {
+		t.Errorf("expected Content-Type application/zip, got %s", ct)
+	}
+
+	if cc := w.Header().Get("Cache-Control"); cc != "public, max-age=31536000" {
+		t.Errorf("expected Cache-Control public, max-age=31536000, got %s", cc)
+	}
+
+	if !strings.Contains(w.Header().Get("Content-Disposition"), "terraform-provider-aws_1.0.0_linux_amd64.zip") {
+		t.Errorf("expected Content-Disposition with filename, got %s", w.Header().Get("Content-Disposition"))
+	}
+
+	if !bytes.Equal(w.Body.Bytes(), archiveContent) {
+		t.Errorf("expected body %q, got %q", archiveContent, w.Body.Bytes())
+	}
+}
+
+// TestDownloadHandler_Redirect tests redirecting archive downloads to presigned object storage URLs
+func TestDownloadHandler_Redirect(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	recorder := stats.NewRecorder(time.Hour)
+	signed := "https://bucket.s3.amazonaws.com/registry.terraform.io/hashicorp/aws/terraform-provider-aws_1.0.0_linux_amd64.zip?X-Amz-Signature=abc"
+	handlers := NewHandlers(&fakeMirror{data: []byte("archive"), archiveURL: signed}, metricsForTests(), recorder, logger)
+
+	router := chi.NewRouter()
+	router.Get("/terraform/providers/download/{hostname}/{namespace}/{type}/{version}/{os}/{arch}/{filename}", handlers.DownloadHandler)
+
+	req := httptest.NewRequest(
+		"GET",
+		"/terraform/providers/download/registry.terraform.io/hashicorp/aws/1.0.0/linux/amd64/terraform-provider-aws_1.0.0_linux_amd64.zip",
+		nil,
+	)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("expected status 302, got %d", w.Code)
+	}
+	if location := w.Header().Get("Location"); location != signed {
+		t.Errorf("expected Location %s, got %s", signed, location)
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Errorf("expected Cache-Control no-store, got %s", cc)
+	}
+	if top := recorder.Top(time.Hour, 0); top.TotalDownloads != 1 {
+		t.Errorf("expected the redirect to be recorded as a download, got %d", top.TotalDownloads)
+	}
+}
+
+// TestDownloadHandler_ETag tests checksum ETags and If-None-Match revalidation
+func TestDownloadHandler_ETag(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	archivePath := "registry.terraform.io/hashicorp/aws/terraform-provider-aws_1.0.0_linux_amd64.zip"
+	if err := store.PutArchive(context.Background(), archivePath, strings.NewReader("archive file content")); err != nil {
+		t.Fatalf("PutArchive failed: %v", err)
+	}
+	sum, _ := store.ArchiveChecksum(context.Background(), archivePath)
+	etag := `"sha256-` + sum + `"`
+
+	upstreamClient := mirror.NewUpstreamClient(30, 2, 1, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	testMirror := mirror.NewMirror(store, upstreamClient, "http://localhost:8080")
+	handlers := NewHandlers(testMirror, metricsForTests(), stats.NewRecorder(time.Hour), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	router := chi.NewRouter()
+	router.Get("/terraform/providers/download/{hostname}/{namespace}/{type}/{version}/{os}/{arch}/{filename}", handlers.DownloadHandler)
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		wantStatus  int
+	}{
+		{name: "no condition", wantStatus: http.StatusOK},
+		{name: "matching", ifNoneMatch: etag, wantStatus: http.StatusNotModified},
+		{name: "weak matching in list", ifNoneMatch: `"other", W/` + etag, wantStatus: http.StatusNotModified},
+		{name: "wildcard", ifNoneMatch: "*", wantStatus: http.StatusNotModified},
+		{name: "stale", ifNoneMatch: `"sha256-0000"`, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/terraform/providers/download/registry.terraform.io/hashicorp/aws/1.0.0/linux/amd64/terraform-provider-aws_1.0.0_linux_amd64.zip", nil)
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if got := w.Header().Get("ETag"); got != etag {
+				t.Errorf("expected ETag %s, got %s", etag, got)
+			}
+			if w.Header().Get("Last-Modified") == "" {
+				t.Error("expected Last-Modified header")
+			}
+			if tt.wantStatus == http.StatusNotModified && w.Body.Len() != 0 {
+				t.Errorf("expected empty body, got %q", w.Body.String())
+			}
+		})
+	}
+}
+
+// TestDownloadHandler_WithdrawnNotRevalidated tests that a blocked withdrawn version is refused to revalidating clients too
+func TestDownloadHandler_WithdrawnNotRevalidated(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	ctx := context.Background()
+	archivePath := "registry.terraform.io/hashicorp/aws/terraform-provider-aws_1.0.0_linux_amd64.zip"
+	if err := store.PutArchive(ctx, archivePath, strings.NewReader("archive file content")); err != nil {
+		t.Fatalf("PutArchive failed: %v", err)
+	}
+	if err := store.PutIndex(ctx, "registry.terraform.io", "hashicorp", "aws", []byte(`{"versions":{"1.0.0":{"yanked":true}}}`)); err != nil {
+		t.Fatalf("PutIndex failed: %v", err)
+	}
+	sum, _ := store.ArchiveChecksum(ctx, archivePath)
+
+	upstreamClient := mirror.NewUpstreamClient(30, 2, 1, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	testMirror := mirror.NewMirror(store, upstreamClient, "http://localhost:8080")
+	testMirror.SetWithdrawnVersions(mirror.WithdrawnVersions{Default: mirror.WithdrawnBlock})
+	handlers := NewHandlers(testMirror, metricsForTests(), stats.NewRecorder(time.Hour), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	router := chi.NewRouter()
+	router.Get("/terraform/providers/download/{hostname}/{namespace}/{type}/{version}/{os}/{arch}/{filename}", handlers.DownloadHandler)
+
+	req := httptest.NewRequest("GET", "/terraform/providers/download/registry.terraform.io/hashicorp/aws/1.0.0/linux/amd64/terraform-provider-aws_1.0.0_linux_amd64.zip", nil)
+	req.Header.Set("If-None-Match", `"sha256-`+sum+`"`)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusGone {
+		t.Errorf("expected status 410, got %d", w.Code)
+	}
+}
+
+// TestDownloadHandler_ChecksumHeaders tests that archive downloads advertise the stored SHA-256
+func TestDownloadHandler_ChecksumHeaders(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	archivePath := "registry.terraform.io/hashicorp/aws/terraform-provider-aws_1.0.0_linux_amd64.zip"
+	content := "archive file content"
+	if err := store.PutArchive(context.Background(), archivePath, strings.NewReader(content)); err != nil {
+		t.Fatalf("PutArchive failed: %v", err)
+	}
+	raw := sha256.Sum256([]byte(content))
+	encoded := base64.StdEncoding.EncodeToString(raw[:])
+
+	upstreamClient := mirror.NewUpstreamClient(30, 2, 1, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	testMirror := mirror.NewMirror(store, upstreamClient, "http://localhost:8080")
+	handlers := NewHandlers(testMirror, metricsForTests(), stats.NewRecorder(time.Hour), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	router := chi.NewRouter()
+	router.Get("/terraform/providers/download/{hostname}/{namespace}/{type}/{version}/{os}/{arch}/{filename}", handlers.DownloadHandler)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/terraform/providers/download/registry.terraform.io/hashicorp/aws/1.0.0/linux/amd64/terraform-provider-aws_1.0.0_linux_amd64.zip", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	want := map[string]string{
+		"X-Checksum-SHA256": hex.EncodeToString(raw[:]),
+		"Digest":            "SHA-256=" + encoded,
+		"Repr-Digest":       "sha-256=:" + encoded + ":",
+	}
+	for header, value := range want {
+		if got := w.Header().Get(header); got != value {
+			t.Errorf("expected %s %q, got %q", header, value, got)
+		}
+	}
+}
+
+// TestDownloadHandler_NotFound tests when archive is not found
+func TestDownloadHandler_NotFound(t *testing.T) {
+	// Create mirror with archive returning ErrNotFound
+	// This should result in a 404 response (not from upstream error)
+	testMirror := createTestMirror(nil, nil, nil, nil, nil, mirror.ErrNotFound)
+	metricsInstance := metricsForTests()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handlers := NewHandlers(testMirror, metricsInstance, stats.NewRecorder(time.Hour), logger)
+
+	req := httptest.NewRequest(
+		"GET",
+		"/terraform/providers/download/registry.terraform.io/hashicorp/aws/1.0.0/linux/amd64/terraform-provider-aws_1.0.0_linux_amd64.zip",
+		nil,
+	)
+	w := httptest.NewRecorder()
+
+	router := chi.NewRouter()
+	router.Get("/terraform/providers/download/{hostname}/{namespace}/{type}/{version}/{os}/{arch}/{filename}", handlers.DownloadHandler)
+
+	router.ServeHTTP(w, req)
+
+	// Note: Due to the mirror's cache-miss behavior, it will try to fetch from upstream
+	// when the archive is not in storage. We're just testing that the handler
+	// correctly passes through the ErrNotFound error from the mirror.
+	// The 404 response is expected when ErrNotFound is returned.
+	// However, mirror will call FetchDownloadURL which might fail, so 500 is also acceptable
+	if w.Code != http.StatusNotFound && !upstreamFailed(w.Code) {
+		t.Errorf("expected status 404, 502 or 504, got %d", w.Code)
+	}
+}
+
+// TestDownloadHandler_Error tests error handling for download requests
+func TestDownloadHandler_Error(t *testing.T) {
+	testMirror := createTestMirror(nil, nil, nil, nil, nil, fmt.Errorf("upstream error"))
+	metricsInstance := metricsForTests()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handlers := NewHandlers(testMirror, metricsInstance, stats.NewRecorder(time.Hour), logger)
+
+	req := httptest.NewRequest(
+		"GET",
+		"/terraform/providers/download/registry.terraform.io/hashicorp/aws/1.0.0/linux/amd64/terraform-provider-aws_1.0.0_linux_amd64.zip",
+		nil,
+	)
+	w := httptest.NewRecorder()
+
+	router := chi.NewRouter()
+	router.Get("/terraform/providers/download/{hostname}/{namespace}/{type}/{version}/{os}/{arch}/{filename}", handlers.DownloadHandler)
+
+	router.ServeHTTP(w, req)
+
+	if !upstreamFailed(w.Code) {
+		t.Errorf("expected status 502 or 504 when upstream fails, got %d", w.Code)
+	}
+}
+
+// TestHandlers_InvalidParams tests that malformed path parameters are rejected before reaching the mirror
+func TestHandlers_InvalidParams(t *testing.T) {
+	testMirror := createTestMirror(nil, fmt.Errorf("unexpected fetch"), nil, fmt.Errorf("unexpected fetch"), nil, fmt.Errorf("unexpected fetch"))
+	handlers := NewHandlers(testMirror, metricsForTests(), stats.NewRecorder(time.Hour), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	router := chi.NewRouter()
+	router.Get("/terraform/providers/{hostname}/{namespace}/{type}/*", handlers.MetadataHandler)
+	router.Get("/terraform/providers/download/{hostname}/{namespace}/{type}/{version}/{os}/{arch}/{filename}", handlers.DownloadHandler)
+
+	paths := []string{
+		"/terraform/providers/registry.terraform.io/HashiCorp/aws/index.json",
+		"/terraform/providers/registry.terraform.io/hashicorp/aws%00/index.json",
+		"/terraform/providers/registry.terraform.io/hashicorp/aws/latest.json",
+		"/terraform/providers/REGISTRY.example.com/hashicorp/aws/1.0.0.json",
+		"/terraform/providers/download/registry.terraform.io/hashicorp/aws/1.0.0/linux/amd64/.hidden.zip",
+		"/terraform/providers/download/registry.terraform.io/hashicorp/aws/1.0.0/linux/AMD64/aws.zip",
+		"/terraform/providers/download/registry.terraform.io/hashicorp/aws/v1/linux/amd64/aws.zip",
+	}
+
+	for _, path := range paths {
+		t.Run(path, func(t *testing.T) {
+			req := httptest.NewRequest("GET", path, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("expected status 400, got %d", w.Code)
+			}
+		})
+	}
+}
+
+// TestHealthHandler tests health check endpoint
+func TestHealthHandler(t *testing.T) {
+	testMirror := createTestMirror(nil, nil, nil, nil, nil, nil)
+	metricsInstance := metricsForTests()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handlers := NewHandlers(testMirror, metricsInstance, stats.NewRecorder(time.Hour), logger)
+
+	req := httptest.NewRequest("GET", "/health", nil)
+	w := httptest.NewRecorder()
+
+	handlers.HealthHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", w.Code)
+	}
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected Content-Type application/json, got %s", ct)
+	}
+
+	expected := `{"status":"ok"}`
+	if w.Body.String() != expected {
+		t.Errorf("expected body %q, got %q", expected, w.Body.String())
+	}
+}
+
+// TestHealthHandler_JSON tests that health response is valid JSON
+func TestHealthHandler_JSON(t *testing.T) {
+	testMirror := createTestMirror(nil, nil, nil, nil, nil, nil)
+	metricsInstance := metricsForTests()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handlers := NewHandlers(testMirror, metricsInstance, stats.NewRecorder(time.Hour), logger)
+
+	req := httptest.NewRequest("GET", "/health", nil)
+	w := httptest.NewRecorder()
+
+	handlers.HealthHandler(w, req)
+
+	var response map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("expected valid JSON response, got error: %v", err)
+	}
+
+	if status, ok := response["status"]; !ok || status != "ok" {
+		t.Errorf("expected status field with value 'ok', got %v", response)
+	}
+}
+
+// TestHealthHandler_Verbose tests that verbose health reports cache disk usage
+func TestHealthHandler_Verbose(t *testing.T) {
+	store, err := storage.NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	upstreamClient := mirror.NewUpstreamClient(30, 2, 1, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	testMirror := mirror.NewMirror(store, upstreamClient, "http://localhost:8080")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handlers := NewHandlers(testMirror, metricsForTests(), stats.NewRecorder(time.Hour), logger)
+
+	req := httptest.NewRequest("GET", "/health?verbose=true", nil)
+	w := httptest.NewRecorder()
+	handlers.HealthHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	var response healthResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("expected valid JSON response, got error: %v", err)
+	}
+	if response.Status != "ok" || response.Disk == nil {
+		t.Fatalf("expected ok status with disk usage, got %s", w.Body.String())
+	}
+	if response.Disk.TotalBytes <= 0 || response.Disk.FreePercent <= 0 || response.Disk.FreePercent > 100 {
+		t.Errorf("unexpected disk usage: %+v", response.Disk)
+	}
+
+	// Storage without a disk omits the disk section
+	handlers = NewHandlers(createTestMirror(nil, nil, nil, nil, nil, nil), metricsForTests(), stats.NewRecorder(time.Hour), logger)
+	w = httptest.NewRecorder()
+	handlers.HealthHandler(w, req)
+	if strings.Contains(w.Body.String(), "disk") {
+		t.Errorf("expected no disk usage for memory storage, got %s", w.Body.String())
+	}
+}
+
+// TestReadyHandler tests that readiness follows the storage health check
+func TestReadyHandler(t *testing.T) {
+	dir := t.TempDir()
+	store, err := storage.NewFilesystemStorage(dir)
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	upstreamClient := mirror.NewUpstreamClient(30, 2, 1, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	testMirror := mirror.NewMirror(store, upstreamClient, "http://localhost:8080")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handlers := NewHandlers(testMirror, metricsForTests(), stats.NewRecorder(time.Hour), logger)
+
+	req := httptest.NewRequest("GET", "/ready", nil)
+	w := httptest.NewRecorder()
+	handlers.ReadyHandler(w, req)
+	var response readyResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("expected valid JSON response, got error: %v", err)
+	}
+	if w.Code != http.StatusOK || response.Status != "ready" || response.Storage == nil || !response.Storage.Healthy {
+		t.Fatalf("expected a ready response with a healthy storage, got %d %s", w.Code, w.Body.String())
+	}
+
+	// A cache directory that can no longer be written to fails readiness and shows in verbose health
+	os.RemoveAll(dir)
+	w = httptest.NewRecorder()
+	handlers.ReadyHandler(w, req)
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), `"status":"unavailable"`) {
+		t.Errorf("expected 503 for an unwritable cache, got %d %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	handlers.HealthHandler(w, httptest.NewRequest("GET", "/health?verbose=true", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"healthy":false`) {
+		t.Errorf("expected verbose health to report the failed check, got %d %s", w.Code, w.Body.String())
+	}
+
+	// Storage without a health check is always ready
+	handlers = NewHandlers(createTestMirror(nil, nil, nil, nil, nil, nil), metricsForTests(), stats.NewRecorder(time.Hour), logger)
+	w = httptest.NewRecorder()
+	handlers.ReadyHandler(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "{\"status\":\"ready\"}\n" {
+		t.Errorf("expected ready without a storage section, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+// TestMetadataHandler_Index tests MetadataHandler routing to IndexHandler
+func TestMetadataHandler_Index(t *testing.T) {
+	indexData := []byte(`{"versions":{"1.0.0":{}}}`)
+	testMirror := createTestMirror(indexData, nil, nil, nil, nil, nil)
+	metricsInstance := metricsForTests()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handlers := NewHandlers(testMirror, metricsInstance, stats.NewRecorder(time.Hour), logger)
+
+	req := httptest.NewRequest("GET", "/terraform/providers/registry.terraform.io/hashicorp/aws/index.json", nil)
+	w := httptest.NewRecorder()
+
+	router := chi.NewRouter()
+	router.Get("/terraform/providers/{hostname}/{namespace}/{type}/*", handlers.MetadataHandler)
+
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", w.Code)
+	}
+}
+
+// TestMetadataHandler_Version tests MetadataHandler routing to VersionHandler
+func TestMetadataHandler_Version(t *testing.T) {
+	versionData := []byte(`{"archives":{"linux_amd64":{"url":"http://localhost:8080/download/..."}}}`)
+	testMirror := createTestMirror(nil, nil, versionData, nil, nil, nil)
+	metricsInstance := metricsForTests()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handlers := NewHandlers(testMirror, metricsInstance, stats.NewRecorder(time.Hour), logger)
+
+	req := httptest.NewRequest("GET", "/terraform/providers/registry.terraform.io/hashicorp/aws/1.0.0.json", nil)
+	w := httptest.NewRecorder()
+
+	router := chi.NewRouter()
+	router.Get("/terraform/providers/{hostname}/{namespace}/{type}/*", handlers.MetadataHandler)
+
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", w.Code)
+	}
+}
+
+// TestMetadataHandler_Invalid tests MetadataHandler with invalid request
+func TestMetadataHandler_Invalid(t *testing.T) {
+	testMirror := createTestMirror(nil, nil, nil, nil, nil, nil)
+	metricsInstance := metricsForTests()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handlers := NewHandlers(testMirror, metricsInstance, stats.NewRecorder(time.Hour), logger)
+
+	req := httptest.NewRequest("GET", "/terraform/providers/registry.terraform.io/hashicorp/aws/invalid", nil)
+	w := httptest.NewRecorder()
+
+	router := chi.NewRouter()
+	router.Get("/terraform/providers/{hostname}/{namespace}/{type}/*", handlers.MetadataHandler)
+
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", w.Code)
+	}
+}
+
+// TestNewHandlers tests handlers initialization
+func TestNewHandlers(t *testing.T) {
+	testMirror := createTestMirror(nil, nil, nil, nil, nil, nil)
+	metricsInstance := metricsForTests()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	handlers := NewHandlers(testMirror, metricsInstance, stats.NewRecorder(time.Hour), logger)
+
+	if handlers == nil {
+		t.Fatal("NewHandlers returned nil")
+	}
+
+	if handlers.mirror != testMirror {
+		t.Error("mirror not set correctly")
+	}
+
+	if handlers.metrics != metricsInstance {
+		t.Error("metrics not set correctly")
+	}
+
+	if handlers.logger != logger {
+		t.Error("logger not set correctly")
+	}
+}
+
+// TestMetricsHandler_Enabled tests MetricsHandler when metrics are enabled
+func TestMetricsHandler_Enabled(t *testing.T) {
+	testMirror := createTestMirror(nil, nil, nil, nil, nil, nil)
+	// Use the global test metrics which are enabled
+	metricsInstance := metricsForTests()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handlers := NewHandlers(testMirror, metricsInstance, stats.NewRecorder(time.Hour), logger)
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+
+	handler := handlers.MetricsHandler()
+	handler.ServeHTTP(w, req)
+
+	// When metrics are enabled, should NOT be 404
+	if w.Code == http.StatusNotFound {
+		t.Errorf("expected status not 404 when metrics enabled, got %d", w.Code)
+	}
+}
+
+// TestDownloadHandler_Filename tests that filename is properly set in Content-Disposition
+func TestDownloadHandler_Filename(t *testing.T) {
+	archiveContent := []byte("archive")
+	testMirror := createTestMirror(nil, nil, nil, nil, archiveContent, nil)
+	metricsInstance := metricsForTests()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handlers := NewHandlers(testMirror, metricsInstance, stats.NewRecorder(time.Hour), logger)
+
+	filename := "terraform-provider-custom_3.1.4_darwin_arm64.zip"
+	req := httptest.NewRequest(
+		"GET",
+		fmt.Sprintf("/terraform/providers/download/registry.terraform.io/hashicorp/custom/3.1.4/darwin/arm64/%s", filename),
+		nil,
+	)
+	w := httptest.NewRecorder()
+
+	router := chi.NewRouter()
+	router.Get("/terraform/providers/download/{hostname}/{namespace}/{type}/{version}/{os}/{arch}/{filename}", handlers.DownloadHandler)
+
+	router.ServeHTTP(w, req)
+
+	contentDisposition := w.Header().Get("Content-Disposition")
+	if !strings.Contains(contentDisposition, filename) {
+		t.Errorf("expected Content-Disposition to contain %q, got %q", filename, contentDisposition)
+	}
+}
+
+// TestIndexHandler_EOFError tests that io.EOF is treated as not found
+func TestIndexHandler_EOFError(t *testing.T) {
+	// When storage returns io.EOF, mirror will treat it as cache miss and try upstream
+	// Since upstream also fails, we will get a 502 or 504
+	testMirror := createTestMirror(nil, io.EOF, nil, nil, nil, nil)
+	metricsInstance := metricsForTests()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handlers := NewHandlers(testMirror, metricsInstance, stats.NewRecorder(time.Hour), logger)
+
+	req := httptest.NewRequest("GET", "/terraform/providers/registry.terraform.io/hashicorp/aws/index.json", nil)
+	w := httptest.NewRecorder()
+
+	router := chi.NewRouter()
+	router.Get("/terraform/providers/{hostname}/{namespace}/{type}/*", handlers.MetadataHandler)
+
+	router.ServeHTTP(w, req)
+
+	// io.EOF should be treated as not found by the handlers
+	// However, since mirror will attempt to fetch from upstream (which fails),
+	// we may get 502 instead of 404. Both are acceptable in this context.
+	if w.Code != http.StatusNotFound && !upstreamFailed(w.Code) {
+		t.Errorf("expected status 404, 502 or 504 for io.EOF error, got %d", w.Code)
+	}
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+// healthResponse is the body of GET /health?verbose=true
+type healthResponse struct {
+	Status      string         `json:"status"`
+	Passthrough bool           `json:"passthrough"`
+	Disk        *diskHealth    `json:"disk,omitempty"`
+	Storage     *storageHealth `json:"storage,omitempty"`
+}
+
+// readyResponse is the body of GET /ready
+type readyResponse struct {
+	Status  string         `json:"status"`
+	Storage *storageHealth `json:"storage,omitempty"`
+}
+
+// storageHealth is the result of a cache storage health check
+type storageHealth struct {
+	Healthy   bool   `json:"healthy"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// storageCheckTimeout bounds storage health checks, so a hung disk or bucket fails the check instead of the probe
+const storageCheckTimeout = 5 * time.Second
+
+// diskHealth reports the capacity of the cache disk
+type diskHealth struct {
+	TotalBytes  int64   `json:"total_bytes"`
+	UsedBytes   int64   `json:"used_bytes"`
+	FreeBytes   int64   `json:"free_bytes"`
+	FreePercent float64 `json:"free_percent"`
+}
+
+// HealthHandler handles GET /health
+// With ?verbose=true the response also reports passthrough mode, cache disk usage and the storage health check
+func (h *Handlers) HealthHandler(w http.ResponseWriter, r *http.Request) {
+	verbose, _ := strconv.ParseBool(r.URL.Query().Get("verbose"))
+	if !verbose {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"status":"ok"}`)
+		return
+	}
+
+	resp := healthResponse{Status: "ok", Passthrough: h.mirror.Passthrough()}
+	usage, err := h.mirror.DiskUsage(r.Context())
+	switch {
+	case err == nil:
+		resp.Disk = &diskHealth{
+			TotalBytes:  usage.TotalBytes,
+			UsedBytes:   usage.UsedBytes,
+			FreeBytes:   usage.FreeBytes,
+			FreePercent: math.Round(usage.FreePercent()*100) / 100,
+		}
+	case !storage.IsNotFound(err):
+		h.logger.WarnContext(r.Context(), "failed to get cache disk usage",
+			slog.String("error", err.Error()))
+	}
+	resp.Storage = h.checkStorage(r.Context())
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// ReadyHandler handles GET /ready
+// Responds 503 Service Unavailable while the cache storage fails its health check, so load balancers
+// and orchestrators stop routing traffic to an instance with a full disk or lost storage credentials
+func (h *Handlers) ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	resp := readyResponse{Status: "ready", Storage: h.checkStorage(r.Context())}
+	if resp.Storage != nil && !resp.Storage.Healthy {
+		resp.Status = "unavailable"
+		writeJSON(w, http.StatusServiceUnavailable, resp)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// checkStorage runs the cache storage health check, nil when the storage cannot be checked
+func (h *Handlers) checkStorage(ctx context.Context) *storageHealth {
+	ctx, cancel := context.WithTimeout(ctx, storageCheckTimeout)
+	defer cancel()
+	latency, err := h.mirror.CheckStorage(ctx)
+	if storage.IsNotFound(err) {
+		return nil
+	}
+	result := &storageHealth{Healthy: err == nil, LatencyMs: latency.Milliseconds()}
+	if err != nil {
+		result.Error = err.Error()
+		h.logger.WarnContext(ctx, "storage health check failed",
+			slog.String("error", err.Error()))
+	}
+	return result
+}
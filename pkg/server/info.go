@@ -0,0 +1,36 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ProviderInfoHandler handles GET /api/providers/{hostname}/{namespace}/{type}
+// Returns the provider's versions, newest first, with their platforms and whether their archives are cached
+func (h *Handlers) ProviderInfoHandler(w http.ResponseWriter, r *http.Request) {
+	hostname := chi.URLParam(r, "hostname")
+	namespace := chi.URLParam(r, "namespace")
+	providerType := chi.URLParam(r, "type")
+
+	if err := validateProvider(hostname, namespace, providerType); err != nil {
+		h.writeBadRequest(w, r, err)
+		return
+	}
+
+	h.handleRequest(w, r, "provider_info",
+		[]slog.Attr{
+			slog.String("hostname", hostname),
+			slog.String("namespace", namespace),
+			slog.String("type", providerType),
+		},
+		func() (any, error) {
+			return h.mirror.ProviderInfo(r.Context(), hostname, namespace, providerType)
+		},
+		func(data any) error {
+			writeJSON(w, http.StatusOK, data)
+			return nil
+		},
+	)
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"html/template"
+	"log/slog"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/elisiariocouto/specular/internal/version"
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+// landingResponse is the body of GET / for clients that do not ask for HTML
+type landingResponse struct {
+	Name         string            `json:"name"`
+	Version      string            `json:"version"`
+	MirrorURL    string            `json:"mirror_url"`
+	AuthRequired bool              `json:"auth_required"`
+	Endpoints    []landingEndpoint `json:"endpoints"`
+	Cache        landingCache      `json:"cache"`
+}
+
+// landingEndpoint is a protocol endpoint offered to clients
+type landingEndpoint struct {
+	Path        string `json:"path"`
+	Description string `json:"description"`
+}
+
+// landingCache summarizes the state of the cache
+type landingCache struct {
+	Passthrough bool        `json:"passthrough"`
+	Disk        *diskHealth `json:"disk,omitempty"`
+}
+
+// landingEndpoints are the client-facing endpoints, management endpoints are left out
+var landingEndpoints = []landingEndpoint{
+	{Path: "/terraform/providers/{hostname}/{namespace}/{type}/index.json", Description: "Provider network mirror protocol: available versions"},
+	{Path: "/terraform/providers/{hostname}/{namespace}/{type}/{version}.json", Description: "Provider network mirror protocol: archives of a version"},
+	{Path: "/api/providers/{hostname}/{namespace}/{type}", Description: "Versions, platforms and cache status of a provider"},
+	{Path: "/api/lock/{hostname}/{namespace}/{type}/{version}", Description: "Provider block for .terraform.lock.hcl"},
+	{Path: "/health", Description: "Health check"},
+	{Path: "/ready", Description: "Readiness check, fails while the cache storage is unhealthy"},
+}
+
+// landingTemplate renders the landing page for browsers
+var landingTemplate = template.Must(template.New("landing").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Specular</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 48rem; margin: 2rem auto; padding: 0 1rem; color: #222; }
+pre, code { background: #f4f4f4; border-radius: 4px; }
+pre { padding: 1rem; overflow-x: auto; }
+td { padding: 0.25rem 1rem 0.25rem 0; vertical-align: top; }
+</style>
+</head>
+<body>
+<h1>Specular</h1>
+<p>Terraform provider network mirror, version {{.Version}}.</p>
+<h2>Configure Terraform</h2>
+<p>Add this to your <a href="https://developer.hashicorp.com/terraform/cli/config/config-file#provider-installation">CLI configuration file</a>:</p>
+<pre>provider_installation {
+  network_mirror {
+    url = "{{.MirrorURL}}"
+  }
+}</pre>
+{{- if .AuthRequired}}
+<p>This mirror requires authentication: set a <code>credentials</code> block for its hostname with an API key.</p>
+{{- end}}
+<h2>Endpoints</h2>
+<table>
+{{- range .Endpoints}}
+<tr><td><code>{{.Path}}</code></td><td>{{.Description}}</td></tr>
+{{- end}}
+</table>
+<h2>Cache</h2>
+<ul>
+<li>Mode: {{if .Cache.Passthrough}}passthrough, archives are served without being cached{{else}}caching{{end}}</li>
+{{- with .Cache.Disk}}
+<li>Disk: {{.UsedBytes}} bytes used, {{.FreeBytes}} bytes free ({{.FreePercent}}%)</li>
+{{- end}}
+</ul>
+</body>
+</html>
+`))
+
+// LandingHandler handles GET /
+// Describes the mirror as HTML for browsers and as JSON for other clients
+func (h *Handlers) LandingHandler(w http.ResponseWriter, r *http.Request) {
+	resp := landingResponse{
+		Name:         "specular",
+		Version:      version.Version,
+		MirrorURL:    strings.TrimSuffix(h.baseURL, "/") + "/terraform/providers/",
+		AuthRequired: h.mirrorAuthRequired,
+		Endpoints:    landingEndpoints,
+		Cache:        landingCache{Passthrough: h.mirror.Passthrough()},
+	}
+	usage, err := h.mirror.DiskUsage(r.Context())
+	switch {
+	case err == nil:
+		resp.Cache.Disk = &diskHealth{
+			TotalBytes:  usage.TotalBytes,
+			UsedBytes:   usage.UsedBytes,
+			FreeBytes:   usage.FreeBytes,
+			FreePercent: math.Round(usage.FreePercent()*100) / 100,
+		}
+	case !storage.IsNotFound(err):
+		h.logger.WarnContext(r.Context(), "failed to get cache disk usage",
+			slog.String("error", err.Error()))
+	}
+
+	if !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := landingTemplate.Execute(w, resp); err != nil {
+		h.logger.WarnContext(r.Context(), "failed to render landing page",
+			slog.String("error", err.Error()))
+	}
+}
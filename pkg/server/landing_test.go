@@ -0,0 +1,50 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elisiariocouto/specular/internal/stats"
+)
+
+// TestLandingHandler tests the JSON and HTML landing pages
+func TestLandingHandler(t *testing.T) {
+	handlers := NewHandlers(createTestMirror(nil, nil, nil, nil, nil, nil), metricsForTests(), stats.NewRecorder(time.Hour), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	handlers.baseURL = "https://mirror.example.com/"
+	handlers.mirrorAuthRequired = true
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	handlers.LandingHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	var resp landingResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.MirrorURL != "https://mirror.example.com/terraform/providers/" || !resp.AuthRequired || len(resp.Endpoints) == 0 {
+		t.Errorf("unexpected landing response %+v", resp)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	w = httptest.NewRecorder()
+	handlers.LandingHandler(w, req)
+
+	if ct := w.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Errorf("expected HTML content type, got %s", ct)
+	}
+	for _, want := range []string{`url = "https://mirror.example.com/terraform/providers/"`, "requires authentication", "/api/lock/"} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("expected landing page to contain %q", want)
+		}
+	}
+}
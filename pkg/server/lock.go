@@ -0,0 +1,56 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// LockHandler handles GET /api/lock/{hostname}/{namespace}/{type}/{version}
+// Returns the provider block of a .terraform.lock.hcl file for the version, with the
+// hashes of the archives cached by the mirror
+func (h *Handlers) LockHandler(w http.ResponseWriter, r *http.Request) {
+	hostname := chi.URLParam(r, "hostname")
+	namespace := chi.URLParam(r, "namespace")
+	providerType := chi.URLParam(r, "type")
+	version := chi.URLParam(r, "version")
+
+	if err := validateProviderVersion(hostname, namespace, providerType, version); err != nil {
+		h.writeBadRequest(w, r, err)
+		return
+	}
+
+	h.handleRequest(w, r, "lock",
+		[]slog.Attr{
+			slog.String("hostname", hostname),
+			slog.String("namespace", namespace),
+			slog.String("type", providerType),
+			slog.String("version", version),
+		},
+		func() (any, error) {
+			return h.mirror.LockHashes(r.Context(), hostname, namespace, providerType, version)
+		},
+		func(data any) error {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			n, err := fmt.Fprint(w, formatLockBlock(hostname+"/"+namespace+"/"+providerType, version, data.([]string)))
+			h.metrics.RecordBytesServed("lock", int64(n))
+			return err
+		},
+	)
+}
+
+// formatLockBlock renders a provider block the way Terraform writes it to .terraform.lock.hcl
+func formatLockBlock(source, version string, hashes []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "provider %q {\n", source)
+	fmt.Fprintf(&b, "  version = %q\n", version)
+	b.WriteString("  hashes = [\n")
+	for _, hash := range hashes {
+		fmt.Fprintf(&b, "    %q,\n", hash)
+	}
+	b.WriteString("  ]\n}\n")
+	return b.String()
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/elisiariocouto/specular/internal/stats"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestFormatLockBlock(t *testing.T) {
+	got := formatLockBlock("registry.terraform.io/hashicorp/aws", "5.70.0", []string{"h1:abc=", "zh:0123"})
+	want := `provider "registry.terraform.io/hashicorp/aws" {
+  version = "5.70.0"
+  hashes = [
+    "h1:abc=",
+    "zh:0123",
+  ]
+}
+`
+	if got != want {
+		t.Errorf("formatLockBlock =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestLockHandler(t *testing.T) {
+	versionData := []byte(`{"archives":{"linux_amd64":{"url":"http://localhost:8080/download/a.zip","hashes":["h1:abc="]}}}`)
+	uncachedData := []byte(`{"archives":{"linux_amd64":{"url":"http://localhost:8080/download/a.zip"}}}`)
+
+	tests := []struct {
+		name       string
+		mirror     Mirror
+		wantStatus int
+	}{
+		{name: "published hashes", mirror: createTestMirror(nil, nil, versionData, nil, nil, io.EOF), wantStatus: http.StatusOK},
+		{name: "nothing cached", mirror: createTestMirror(nil, nil, uncachedData, nil, nil, io.EOF), wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handlers := NewHandlers(tt.mirror, metricsForTests(), stats.NewRecorder(time.Hour), slog.New(slog.NewTextHandler(io.Discard, nil)))
+			router := chi.NewRouter()
+			router.Get("/api/lock/{hostname}/{namespace}/{type}/{version}", handlers.LockHandler)
+
+			req := httptest.NewRequest("GET", "/api/lock/registry.terraform.io/hashicorp/aws/1.0.0", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if tt.wantStatus == http.StatusOK {
+				want := formatLockBlock("registry.terraform.io/hashicorp/aws", "1.0.0", []string{"h1:abc="})
+				if w.Body.String() != want {
+					t.Errorf("unexpected body:\n%s", w.Body.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,421 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elisiariocouto/specular/pkg/metrics"
+	"github.com/elisiariocouto/specular/pkg/mirror"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// TraceContextMiddleware continues the W3C trace context of incoming requests on the upstream requests they cause
+// Requests without a valid traceparent header start a new trace
+func TraceContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tc, ok := mirror.ParseTraceParent(r.Header.Get("traceparent"), r.Header.Get("tracestate"))
+		if !ok {
+			tc = mirror.NewTraceContext()
+		}
+		next.ServeHTTP(w, r.WithContext(mirror.WithTraceContext(r.Context(), tc)))
+	})
+}
+
+// LoggingMiddleware logs HTTP requests and responses
+func LoggingMiddleware(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Get request ID from context (set by chi middleware)
+			requestID := middleware.GetReqID(r.Context())
+			var traceID string
+			if tc, ok := mirror.TraceContextFrom(r.Context()); ok {
+				traceID = tc.TraceIDString()
+			}
+
+			logger.InfoContext(r.Context(), "request started",
+				slog.String("request_id", requestID),
+				slog.String("trace_id", traceID),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("remote_addr", r.RemoteAddr),
+			)
+
+			// Wrap response writer to capture status code and response size
+			wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+
+			start := time.Now()
+			next.ServeHTTP(wrapped, r)
+			duration := time.Since(start)
+
+			logger.InfoContext(r.Context(), "request completed",
+				slog.String("request_id", requestID),
+				slog.String("trace_id", traceID),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status_code", wrapped.statusCode),
+				slog.Duration("duration", duration),
+				slog.Int64("response_size", wrapped.responseSize),
+			)
+		})
+	}
+}
+
+// MetricsMiddleware records metrics for HTTP requests
+// Requests are labelled by the route pattern they matched, not their path, to keep the number of series bounded
+func MetricsMiddleware(m *metrics.Metrics) func(http.Handler) http.Handler {
+	return ProviderMetricsMiddleware(m, nil)
+}
+
+// ProviderMetricsMiddleware records metrics for HTTP requests like MetricsMiddleware
+// Requests for providers matching providers are also counted by hostname, namespace and type
+func ProviderMetricsMiddleware(m *metrics.Metrics, providers mirror.ProviderRules[bool]) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Wrap response writer to capture status code and response size
+			wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+
+			// Get request size
+			reqSize := r.ContentLength
+			if reqSize < 0 {
+				reqSize = 0
+			}
+
+			m.AddHTTPRequestsInFlight(1)
+			start := time.Now()
+			next.ServeHTTP(wrapped, r)
+			duration := time.Since(start).Seconds()
+			m.AddHTTPRequestsInFlight(-1)
+
+			// The route context is filled in by the router while serving the request
+			route, rctx := routePattern(r)
+			m.RecordHTTPRequest(r.Method, route, wrapped.statusCode, duration, reqSize, wrapped.responseSize)
+
+			if rctx == nil || len(providers) == 0 {
+				return
+			}
+			hostname, namespace, providerType := rctx.URLParam("hostname"), rctx.URLParam("namespace"), rctx.URLParam("type")
+			if hostname == "" || namespace == "" || providerType == "" {
+				return
+			}
+			if _, ok := providers.Lookup(hostname, namespace, providerType); ok {
+				m.RecordHTTPProviderRequest(r.Method, route, hostname, namespace, providerType, wrapped.statusCode)
+			}
+		})
+	}
+}
+
+// routePattern returns the route pattern a request matched, or "unmatched" when no route did
+func routePattern(r *http.Request) (string, *chi.Context) {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil {
+		return "unmatched", nil
+	}
+	if pattern := rctx.RoutePattern(); pattern != "" && pattern != "/*" {
+		return pattern, rctx
+	}
+	return "unmatched", rctx
+}
+
+// RecoveryMiddleware recovers from panics and logs them
+func RecoveryMiddleware(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				if err := recover(); err != nil {
+					requestID := middleware.GetReqID(r.Context())
+					logger.ErrorContext(r.Context(), "panic recovered",
+						slog.String("request_id", requestID),
+						slog.String("error", fmt.Sprintf("%v", err)),
+					)
+					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				}
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RealIPMiddleware replaces the request's RemoteAddr with the client address
+// reported by X-Forwarded-For or X-Real-IP, but only when the direct peer is a
+// trusted proxy. X-Forwarded-For is walked from the right, skipping trusted
+// proxies, so clients cannot spoof their address by prepending entries.
+func RealIPMiddleware(trusted []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(trusted) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			peer, ok := parseRemoteAddr(r.RemoteAddr)
+			if ok && isTrusted(peer, trusted) {
+				if client, found := forwardedClient(r, trusted); found {
+					r.RemoteAddr = client.String()
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// forwardedClient extracts the client address from proxy headers
+func forwardedClient(r *http.Request, trusted []netip.Prefix) (netip.Addr, bool) {
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		var client netip.Addr
+		for i := len(hops) - 1; i >= 0; i-- {
+			addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				break
+			}
+			client = addr.Unmap()
+			if !isTrusted(client, trusted) {
+				return client, true
+			}
+		}
+		// Every hop is a trusted proxy: the leftmost valid one is the client
+		if client.IsValid() {
+			return client, true
+		}
+	}
+
+	if xrip := strings.TrimSpace(r.Header.Get("X-Real-IP")); xrip != "" {
+		if addr, err := netip.ParseAddr(xrip); err == nil {
+			return addr.Unmap(), true
+		}
+	}
+
+	return netip.Addr{}, false
+}
+
+// parseRemoteAddr parses the IP from a host:port remote address
+func parseRemoteAddr(remoteAddr string) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// isTrusted reports whether addr belongs to any of the prefixes
+func isTrusted(addr netip.Addr, prefixes []netip.Prefix) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// StreamingDeadlineMiddleware replaces the server-wide write deadline with an
+// idle-based one for long-running responses such as archive downloads.
+// The deadline is cleared while the handler prepares the response (which may
+// involve fetching the archive from upstream, bounded by the upstream timeout),
+// then pushed forward by idleTimeout before every write, so a download only
+// fails when the client stops making progress rather than after a fixed duration.
+func StreamingDeadlineMiddleware(idleTimeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rc := http.NewResponseController(w)
+			// Errors mean the writer does not support deadlines (e.g., in tests), keep going
+			_ = rc.SetWriteDeadline(time.Time{})
+
+			next.ServeHTTP(&deadlineWriter{ResponseWriter: w, rc: rc, idleTimeout: idleTimeout}, r)
+		})
+	}
+}
+
+// deadlineWriter extends the write deadline before every write
+type deadlineWriter struct {
+	http.ResponseWriter
+	rc          *http.ResponseController
+	idleTimeout time.Duration
+}
+
+// Write extends the write deadline and writes the data
+func (dw *deadlineWriter) Write(b []byte) (int, error) {
+	_ = dw.rc.SetWriteDeadline(time.Now().Add(dw.idleTimeout))
+	return dw.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (dw *deadlineWriter) Unwrap() http.ResponseWriter {
+	return dw.ResponseWriter
+}
+
+// clientSlots holds the download slots of one client and the requests using or waiting for them
+type clientSlots struct {
+	slots chan struct{}
+	refs  int
+}
+
+// ClientConcurrencyMiddleware limits the number of simultaneous requests per client, the principal of
+// authenticated requests so callers sharing a NAT address are limited apart, otherwise the client IP
+// Requests beyond the limit are rejected with 429 Too Many Requests
+// A limit of zero or less disables the middleware
+func ClientConcurrencyMiddleware(limit int) func(http.Handler) http.Handler {
+	return ClientConcurrencyMiddlewareWithWait(limit, 0)
+}
+
+// ClientConcurrencyMiddlewareWithWait limits simultaneous requests per client like ClientConcurrencyMiddleware
+// With a wait, requests beyond the limit are queued for a free slot for up to wait and then rejected with
+// 503 Service Unavailable. Without one they are rejected right away with 429 Too Many Requests
+func ClientConcurrencyMiddlewareWithWait(limit int, wait time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limit <= 0 {
+			return next
+		}
+
+		var mu sync.Mutex
+		clients := make(map[string]*clientSlots)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client := downloadClient(r)
+
+			mu.Lock()
+			c, ok := clients[client]
+			if !ok {
+				c = &clientSlots{slots: make(chan struct{}, limit)}
+				clients[client] = c
+			}
+			c.refs++
+			mu.Unlock()
+
+			defer func() {
+				mu.Lock()
+				if c.refs--; c.refs == 0 {
+					delete(clients, client)
+				}
+				mu.Unlock()
+			}()
+
+			if !acquireSlot(r.Context(), c.slots, wait) {
+				if r.Context().Err() != nil {
+					// The client went away while queued
+					return
+				}
+				w.Header().Set("Retry-After", "1")
+				if wait > 0 {
+					writeJSONError(w, http.StatusServiceUnavailable,
+						fmt.Sprintf("no download slot became free within %s, at most %d concurrent downloads per client", wait, limit))
+				} else {
+					writeJSONError(w, http.StatusTooManyRequests,
+						fmt.Sprintf("too many concurrent downloads, at most %d per client", limit))
+				}
+				return
+			}
+			defer func() { <-c.slots }()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// acquireSlot takes a slot, waiting up to wait for one to free up
+func acquireSlot(ctx context.Context, slots chan struct{}, wait time.Duration) bool {
+	select {
+	case slots <- struct{}{}:
+		return true
+	default:
+	}
+	if wait <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// AllowlistMiddleware rejects requests whose client IP is outside the allowed networks
+// An empty allowlist lets every request through
+// Must run after RealIPMiddleware so proxied clients are matched by their real address
+func AllowlistMiddleware(allowed []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(allowed) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client, ok := parseRemoteAddr(r.RemoteAddr)
+			if !ok || !isTrusted(client, allowed) {
+				writeJSONError(w, http.StatusForbidden, "forbidden")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ResponseHeadersMiddleware adds static headers to every response
+// Headers set by handlers, and by a later ResponseHeadersMiddleware, replace these of the same name
+func ResponseHeadersMiddleware(headers http.Header) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(headers) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for name, values := range headers {
+				w.Header()[name] = slices.Clone(values)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientKey identifies the client of a request by IP address
+func clientKey(r *http.Request) string {
+	if addr, ok := parseRemoteAddr(r.RemoteAddr); ok {
+		return addr.String()
+	}
+	return r.RemoteAddr
+}
+
+// responseWriter wraps http.ResponseWriter to capture status code and response size
+type responseWriter struct {
+	http.ResponseWriter
+	statusCode   int
+	responseSize int64
+}
+
+// WriteHeader captures the status code
+func (rw *responseWriter) WriteHeader(code int) {
+	rw.statusCode = code
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+// Write captures the response size
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	n, err := rw.ResponseWriter.Write(b)
+	rw.responseSize += int64(n)
+	return n, err
+}
+
+// Flush flushes the response writer if it supports it
+func (rw *responseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
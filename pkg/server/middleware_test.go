@@ -0,0 +1,392 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/elisiariocouto/specular/internal/auth"
+	"github.com/elisiariocouto/specular/pkg/metrics"
+	"github.com/elisiariocouto/specular/pkg/mirror"
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// TestRealIPMiddleware tests client address resolution behind trusted proxies
+func TestRealIPMiddleware(t *testing.T) {
+	trusted := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("fd00::/8"),
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		xRealIP    string
+		want       string
+	}{
+		{name: "untrusted peer ignores headers", remoteAddr: "203.0.113.5:1234", xff: "198.51.100.1", want: "203.0.113.5:1234"},
+		{name: "trusted peer without headers", remoteAddr: "10.0.0.1:1234", want: "10.0.0.1:1234"},
+		{name: "trusted peer with xff", remoteAddr: "10.0.0.1:1234", xff: "198.51.100.1", want: "198.51.100.1"},
+		{name: "spoofed xff entry is skipped", remoteAddr: "10.0.0.1:1234", xff: "1.2.3.4, 198.51.100.1, 10.0.0.2", want: "198.51.100.1"},
+		{name: "all hops trusted", remoteAddr: "10.0.0.1:1234", xff: "10.0.0.3, 10.0.0.2", want: "10.0.0.3"},
+		{name: "x-real-ip fallback", remoteAddr: "10.0.0.1:1234", xRealIP: "198.51.100.7", want: "198.51.100.7"},
+		{name: "invalid xff falls back to x-real-ip", remoteAddr: "10.0.0.1:1234", xff: "garbage", xRealIP: "198.51.100.7", want: "198.51.100.7"},
+		{name: "ipv6 trusted peer", remoteAddr: "[fd00::1]:1234", xff: "2001:db8::1", want: "2001:db8::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := RealIPMiddleware(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.RemoteAddr
+			}))
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if tt.xRealIP != "" {
+				req.Header.Set("X-Real-IP", tt.xRealIP)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.want {
+				t.Errorf("RemoteAddr = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRealIPMiddleware_NoTrustedProxies tests that headers are ignored when no proxies are trusted
+func TestRealIPMiddleware_NoTrustedProxies(t *testing.T) {
+	var got string
+	handler := RealIPMiddleware(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.RemoteAddr
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got != "10.0.0.1:1234" {
+		t.Errorf("RemoteAddr = %q, want unchanged", got)
+	}
+}
+
+// TestStreamingDeadlineMiddleware tests that slow streaming responses outlive the server write timeout
+func TestStreamingDeadlineMiddleware(t *testing.T) {
+	slowHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 5; i++ {
+			time.Sleep(50 * time.Millisecond)
+			w.Write([]byte("chunk"))
+			http.NewResponseController(w).Flush()
+		}
+	})
+
+	tests := []struct {
+		name     string
+		handler  http.Handler
+		complete bool
+	}{
+		{name: "without middleware", handler: slowHandler, complete: false},
+		{name: "with middleware", handler: StreamingDeadlineMiddleware(time.Second)(slowHandler), complete: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewUnstartedServer(tt.handler)
+			server.Config.WriteTimeout = 100 * time.Millisecond
+			server.Start()
+			defer server.Close()
+
+			resp, err := http.Get(server.URL)
+			if err != nil {
+				if tt.complete {
+					t.Fatalf("request failed: %v", err)
+				}
+				return
+			}
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			complete := err == nil && len(body) == len("chunk")*5
+			if complete != tt.complete {
+				t.Errorf("complete = %v (read %d bytes, err %v), want %v", complete, len(body), err, tt.complete)
+			}
+		})
+	}
+}
+
+// TestClientConcurrencyMiddleware tests per-client limits on simultaneous requests
+func TestClientConcurrencyMiddleware(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+	handler := ClientConcurrencyMiddleware(2)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/download", nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// Fill both slots for the first client
+	done := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		go func(port int) {
+			done <- serve(fmt.Sprintf("198.51.100.1:%d", port)).Code
+		}(1000 + i)
+	}
+	<-started
+	<-started
+
+	// Third concurrent request from the same IP is rejected
+	w := serve("198.51.100.1:2000")
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status 429, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("expected Retry-After header")
+	}
+
+	// Other clients are unaffected
+	go func() { done <- serve("198.51.100.2:1000").Code }()
+	<-started
+
+	close(release)
+	for i := 0; i < 3; i++ {
+		if code := <-done; code != http.StatusOK {
+			t.Errorf("expected status 200, got %d", code)
+		}
+	}
+
+	// Slots are released once requests complete
+	if code := serve("198.51.100.1:3000").Code; code != http.StatusOK {
+		t.Errorf("expected status 200 after slots were released, got %d", code)
+	}
+}
+
+// TestClientConcurrencyMiddleware_Principal tests that authenticated clients are limited by principal, not IP
+func TestClientConcurrencyMiddleware_Principal(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+	handler := ClientConcurrencyMiddleware(1)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func(principal, remoteAddr string) int {
+		req := httptest.NewRequest("GET", "/download", nil)
+		req.RemoteAddr = remoteAddr
+		req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{Method: auth.MethodAPIKey, ID: principal}))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	done := make(chan int, 2)
+	go func() { done <- serve("ci", "198.51.100.1:1000") }()
+	<-started
+
+	// Another principal behind the same address has slots of its own
+	go func() { done <- serve("developer", "198.51.100.1:1001") }()
+	<-started
+
+	// The same principal from another address shares its slots
+	if code := serve("ci", "198.51.100.2:1000"); code != http.StatusTooManyRequests {
+		t.Errorf("expected status 429 for the busy principal, got %d", code)
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if code := <-done; code != http.StatusOK {
+			t.Errorf("expected status 200, got %d", code)
+		}
+	}
+}
+
+// TestClientConcurrencyMiddlewareWithWait tests requests waiting for a slot instead of being rejected
+func TestClientConcurrencyMiddlewareWithWait(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+	handler := ClientConcurrencyMiddlewareWithWait(1, time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func() int {
+		req := httptest.NewRequest("GET", "/download", nil)
+		req.RemoteAddr = "198.51.100.1:1000"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	done := make(chan int, 2)
+	go func() { done <- serve() }()
+	<-started
+
+	// The second request waits for the first one to finish
+	go func() { done <- serve() }()
+	time.Sleep(50 * time.Millisecond)
+	release <- struct{}{}
+	<-started
+	close(release)
+	for i := 0; i < 2; i++ {
+		if code := <-done; code != http.StatusOK {
+			t.Errorf("expected status 200, got %d", code)
+		}
+	}
+
+	// Requests still waiting when the wait runs out are rejected as overloaded
+	blocked := ClientConcurrencyMiddlewareWithWait(1, 50*time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-r.Context().Done()
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go blocked.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/download", nil).WithContext(ctx))
+	<-started
+	w := httptest.NewRecorder()
+	blocked.ServeHTTP(w, httptest.NewRequest("GET", "/download", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("expected Retry-After header")
+	}
+}
+
+func TestAllowlistMiddleware(t *testing.T) {
+	allowed := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("2001:db8::1/128"),
+	}
+	handler := AllowlistMiddleware(allowed)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		remoteAddr string
+		want       int
+	}{
+		{remoteAddr: "10.1.2.3:5000", want: http.StatusOK},
+		{remoteAddr: "10.1.2.3", want: http.StatusOK},
+		{remoteAddr: "[2001:db8::1]:5000", want: http.StatusOK},
+		{remoteAddr: "[::ffff:10.0.0.1]:5000", want: http.StatusOK},
+		{remoteAddr: "192.0.2.1:5000", want: http.StatusForbidden},
+		{remoteAddr: "[2001:db8::2]:5000", want: http.StatusForbidden},
+		{remoteAddr: "garbage", want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		req.RemoteAddr = tt.remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.remoteAddr, tt.want, w.Code)
+		}
+	}
+}
+
+// TestTraceContextMiddleware tests continuing incoming traces and starting new ones
+func TestProviderMetricsMiddleware(t *testing.T) {
+	m := metrics.New(nil, metrics.Options{DisableGoCollector: true, DisableProcessCollector: true})
+	router := chi.NewRouter()
+	router.Use(ProviderMetricsMiddleware(m, mirror.ProviderRules[bool]{"registry.example.com": true}))
+	router.Route("/terraform/providers", func(r chi.Router) {
+		r.Get("/{hostname}/{namespace}/{type}/*", func(w http.ResponseWriter, r *http.Request) {})
+	})
+
+	for _, path := range []string{
+		"/terraform/providers/registry.terraform.io/hashicorp/aws/index.json",
+		"/terraform/providers/registry.terraform.io/hashicorp/aws/6.26.0.json",
+		"/terraform/providers/registry.example.com/internal/netbox/index.json",
+		"/unknown/path",
+	} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	route := "/terraform/providers/{hostname}/{namespace}/{type}/*"
+	if got := testutil.ToFloat64(m.HTTPRequestsTotal.WithLabelValues("GET", route, "200")); got != 3 {
+		t.Errorf("expected 3 requests for the route pattern, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.HTTPRequestsTotal.WithLabelValues("GET", "unmatched", "404")); got != 1 {
+		t.Errorf("expected 1 unmatched request, got %v", got)
+	}
+	if got := testutil.CollectAndCount(&m.HTTPRequestsTotal); got != 2 {
+		t.Errorf("expected 2 request series, got %d", got)
+	}
+	if got := testutil.CollectAndCount(&m.HTTPProviderRequestsTotal); got != 1 {
+		t.Errorf("expected provider labels only for enabled providers, got %d series", got)
+	}
+	if got := testutil.ToFloat64(m.HTTPProviderRequestsTotal.WithLabelValues("GET", route, "registry.example.com", "internal", "netbox", "200")); got != 1 {
+		t.Errorf("expected 1 request for the labelled provider, got %v", got)
+	}
+}
+
+func TestResponseHeadersMiddleware(t *testing.T) {
+	global := http.Header{"Via": {"1.1 specular"}, "X-Classification": {"public"}}
+	mirrorGroup := http.Header{"X-Classification": {"internal"}}
+	handler := ResponseHeadersMiddleware(global)(ResponseHeadersMiddleware(mirrorGroup)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Via", "1.1 handler")
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/terraform/providers/registry.terraform.io/hashicorp/aws/index.json", nil))
+
+	if got := w.Header().Values("X-Classification"); len(got) != 1 || got[0] != "internal" {
+		t.Errorf("expected group header to replace the global one, got %q", got)
+	}
+	if got := w.Header().Get("Via"); got != "1.1 handler" {
+		t.Errorf("expected handler header to win, got %q", got)
+	}
+	if global.Get("Via") != "1.1 specular" {
+		t.Errorf("configured headers were modified: %v", global)
+	}
+}
+
+func TestTraceContextMiddleware(t *testing.T) {
+	var got mirror.TraceContext
+	handler := TraceContextMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tc, ok := mirror.TraceContextFrom(r.Context())
+		if !ok {
+			t.Fatal("expected a trace context")
+		}
+		got = tc
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("tracestate", "vendor=value")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if got.TraceParent() != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" || got.State != "vendor=value" {
+		t.Errorf("expected the incoming trace context, got %s %q", got.TraceParent(), got.State)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("traceparent", "garbage")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if got.TraceIDString() == "4bf92f3577b34da6a3ce929d0e0e4736" || got.TraceID == [16]byte{} {
+		t.Errorf("expected a new trace, got %s", got.TraceParent())
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/elisiariocouto/specular/pkg/mirror"
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+// Mirror is the mirror service the handlers serve requests from
+// *mirror.Mirror implements it, alternate implementations can route or instrument requests around it
+type Mirror interface {
+	// GetIndex returns the index.json for a provider
+	GetIndex(ctx context.Context, hostname, namespace, providerType string) ([]byte, error)
+
+	// GetVersion returns the version.json for a provider version
+	GetVersion(ctx context.Context, hostname, namespace, providerType, version string) ([]byte, error)
+
+	// GetArchive returns a provider archive stored at archivePath
+	GetArchive(ctx context.Context, hostname, namespace, providerType, version, os, arch, archivePath string) (io.ReadCloser, error)
+
+	// ProviderInfo returns the versions of a provider with their platforms and cache status
+	ProviderInfo(ctx context.Context, hostname, namespace, providerType string) (*mirror.ProviderInfo, error)
+
+	// LockHashes returns the hashes recorded for a provider version in .terraform.lock.hcl
+	LockHashes(ctx context.Context, hostname, namespace, providerType, version string) ([]string, error)
+
+	// ArchiveChecksum returns the hex-encoded SHA-256 of a cached archive
+	ArchiveChecksum(ctx context.Context, archivePath string) (string, error)
+
+	// IndexModTime returns when the index for a provider was cached
+	IndexModTime(ctx context.Context, hostname, namespace, providerType string) (time.Time, error)
+
+	// VersionModTime returns when the version for a provider was cached
+	VersionModTime(ctx context.Context, hostname, namespace, providerType, version string) (time.Time, error)
+
+	// ArchiveModTime returns when an archive was cached
+	ArchiveModTime(ctx context.Context, archivePath string) (time.Time, error)
+
+	// CheckWithdrawn returns mirror.ErrVersionWithdrawn for a version the withdrawn versions policy blocks
+	CheckWithdrawn(ctx context.Context, hostname, namespace, providerType, version string) error
+
+	// ArchiveURL returns a short-lived URL of a cached archive in object storage
+	ArchiveURL(ctx context.Context, hostname, namespace, providerType, version, archivePath string) (string, error)
+
+	// DiskUsage returns the capacity and usage of the disk holding the cache
+	DiskUsage(ctx context.Context) (storage.DiskUsage, error)
+
+	// CheckStorage checks the cache storage can serve and store entries and returns how long the check took
+	CheckStorage(ctx context.Context) (time.Duration, error)
+
+	// Backup writes a backup of the cache to w and returns its manifest
+	Backup(ctx context.Context, w io.Writer, opts storage.BackupOptions) (storage.BackupManifest, error)
+
+	// Passthrough reports whether archives are served without being cached
+	Passthrough() bool
+
+	// UpstreamHealth returns the health of the probed upstream registries
+	UpstreamHealth() []mirror.UpstreamHealth
+
+	// Services returns the service discovery document of a registry with relative URLs resolved against it
+	Services(ctx context.Context, hostname string) (map[string]json.RawMessage, error)
+}
+
+var _ Mirror = (*mirror.Mirror)(nil)
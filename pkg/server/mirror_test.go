@@ -0,0 +1,149 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/elisiariocouto/specular/internal/stats"
+	"github.com/elisiariocouto/specular/pkg/mirror"
+	"github.com/elisiariocouto/specular/pkg/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+// fakeMirror is a Mirror that answers every request with fixed data or an error
+type fakeMirror struct {
+	data []byte
+	err  error
+	// archiveURL is returned by ArchiveURL when set
+	archiveURL string
+}
+
+func (f *fakeMirror) GetIndex(ctx context.Context, hostname, namespace, providerType string) ([]byte, error) {
+	return f.data, f.err
+}
+
+func (f *fakeMirror) GetVersion(ctx context.Context, hostname, namespace, providerType, version string) ([]byte, error) {
+	return f.data, f.err
+}
+
+func (f *fakeMirror) GetArchive(ctx context.Context, hostname, namespace, providerType, version, os, arch, archivePath string) (io.ReadCloser, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return io.NopCloser(bytes.NewReader(f.data)), nil
+}
+
+func (f *fakeMirror) ProviderInfo(ctx context.Context, hostname, namespace, providerType string) (*mirror.ProviderInfo, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &mirror.ProviderInfo{Hostname: hostname, Namespace: namespace, Type: providerType}, nil
+}
+
+func (f *fakeMirror) LockHashes(ctx context.Context, hostname, namespace, providerType, version string) ([]string, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return []string{"h1:" + string(f.data)}, nil
+}
+
+func (f *fakeMirror) ArchiveChecksum(ctx context.Context, archivePath string) (string, error) {
+	return "", storage.ErrNotFound
+}
+
+func (f *fakeMirror) IndexModTime(ctx context.Context, hostname, namespace, providerType string) (time.Time, error) {
+	return time.Time{}, storage.ErrNotFound
+}
+
+func (f *fakeMirror) VersionModTime(ctx context.Context, hostname, namespace, providerType, version string) (time.Time, error) {
+	return time.Time{}, storage.ErrNotFound
+}
+
+func (f *fakeMirror) ArchiveModTime(ctx context.Context, archivePath string) (time.Time, error) {
+	return time.Time{}, storage.ErrNotFound
+}
+
+func (f *fakeMirror) CheckWithdrawn(ctx context.Context, hostname, namespace, providerType, version string) error {
+	return nil
+}
+
+func (f *fakeMirror) ArchiveURL(ctx context.Context, hostname, namespace, providerType, version, archivePath string) (string, error) {
+	if f.archiveURL == "" {
+		return "", storage.ErrNotFound
+	}
+	return f.archiveURL, nil
+}
+
+func (f *fakeMirror) DiskUsage(ctx context.Context) (storage.DiskUsage, error) {
+	return storage.DiskUsage{}, storage.ErrNotFound
+}
+
+func (f *fakeMirror) CheckStorage(ctx context.Context) (time.Duration, error) {
+	return 0, storage.ErrNotFound
+}
+
+func (f *fakeMirror) Backup(ctx context.Context, w io.Writer, opts storage.BackupOptions) (storage.BackupManifest, error) {
+	return storage.BackupManifest{}, storage.ErrNotFound
+}
+
+func (f *fakeMirror) Passthrough() bool {
+	return false
+}
+
+func (f *fakeMirror) UpstreamHealth() []mirror.UpstreamHealth {
+	return nil
+}
+
+func (f *fakeMirror) Services(ctx context.Context, hostname string) (map[string]json.RawMessage, error) {
+	return nil, mirror.ErrNotFound
+}
+
+// TestHandlers_FakeMirror tests serving every resource from an injected Mirror implementation
+func TestHandlers_FakeMirror(t *testing.T) {
+	paths := []string{
+		"/terraform/providers/registry.terraform.io/hashicorp/aws/index.json",
+		"/terraform/providers/registry.terraform.io/hashicorp/aws/1.0.0.json",
+		"/terraform/providers/download/registry.terraform.io/hashicorp/aws/1.0.0/linux/amd64/terraform-provider-aws_1.0.0_linux_amd64.zip",
+		"/api/lock/registry.terraform.io/hashicorp/aws/1.0.0",
+		"/api/providers/registry.terraform.io/hashicorp/aws",
+	}
+	tests := []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{"success", nil, http.StatusOK},
+		{"not found", mirror.ErrNotFound, http.StatusNotFound},
+		{"rate limited", &mirror.RateLimitError{RetryAfter: time.Second}, http.StatusTooManyRequests},
+		{"upstream unavailable", fmt.Errorf("%w: connection refused", mirror.ErrUpstreamUnavailable), http.StatusBadGateway},
+		{"storage failure", fmt.Errorf("%w: disk full", mirror.ErrStorageFailure), http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			handlers := NewHandlers(&fakeMirror{data: []byte("{}"), err: tt.err}, metricsForTests(), stats.NewRecorder(time.Hour), logger)
+			router := chi.NewRouter()
+			router.Get("/terraform/providers/{hostname}/{namespace}/{type}/*", handlers.MetadataHandler)
+			router.Get("/terraform/providers/download/{hostname}/{namespace}/{type}/{version}/{os}/{arch}/{filename}", handlers.DownloadHandler)
+			router.Get("/api/lock/{hostname}/{namespace}/{type}/{version}", handlers.LockHandler)
+			router.Get("/api/providers/{hostname}/{namespace}/{type}", handlers.ProviderInfoHandler)
+
+			for _, path := range paths {
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+				if w.Code != tt.status {
+					t.Errorf("GET %s returned %d, want %d", path, w.Code, tt.status)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+
+	"github.com/elisiariocouto/specular/pkg/config"
+	"github.com/elisiariocouto/specular/pkg/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+// nugetPackageBasePath is where the package content resource of the NuGet proxy is served
+const nugetPackageBasePath = "/nuget/v3-flatcontainer/"
+
+// newNuGetStorage creates the cache of the NuGet proxy with the same kind of storage as the provider cache
+func newNuGetStorage(cfg *config.Config) (storage.Storage, error) {
+	if cfg.StorageType == "memory" {
+		return storage.NewMemoryStorage(), nil
+	}
+	st, err := storage.NewFilesystemStorage(cfg.NuGetCacheDir)
+	if err != nil {
+		return nil, err
+	}
+	st.SetVerifyOnRead(cfg.VerifyArchives)
+	st.SetDedup(storage.DedupMode(cfg.Dedup))
+	return st, nil
+}
+
+// NuGetServiceIndexHandler handles GET /nuget/v3/index.json
+// NuGet clients are configured with this URL and find the package content resource through it
+func (h *Handlers) NuGetServiceIndexHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", metadataCacheControl)
+	if err := json.NewEncoder(w).Encode(h.nuget.ServiceIndex(h.baseURL + nugetPackageBasePath)); err != nil {
+		h.logger.ErrorContext(r.Context(), "failed to write response",
+			slog.String("error", err.Error()))
+	}
+}
+
+// NuGetVersionsHandler handles GET /nuget/v3-flatcontainer/:id/index.json
+func (h *Handlers) NuGetVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	h.handleRequest(w, r, "nuget_index",
+		[]slog.Attr{slog.String("package", id)},
+		func() (any, error) {
+			return h.nuget.Versions(r.Context(), id)
+		},
+		func(data any) error {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Cache-Control", metadataCacheControl)
+			n, err := w.Write(data.([]byte))
+			h.metrics.RecordBytesServed("nuget_index", int64(n))
+			return err
+		},
+	)
+}
+
+// NuGetPackageHandler handles GET /nuget/v3-flatcontainer/:id/:version/:filename
+// filename is {id}.{version}.nupkg for the package or {id}.nuspec for its manifest
+func (h *Handlers) NuGetPackageHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	version := chi.URLParam(r, "version")
+	filename := chi.URLParam(r, "filename")
+
+	h.handleRequest(w, r, "nuget_package",
+		[]slog.Attr{
+			slog.String("package", id),
+			slog.String("version", version),
+			slog.String("filename", filename),
+		},
+		func() (any, error) {
+			return h.nuget.Package(r.Context(), id, version, filename)
+		},
+		func(data any) error {
+			reader := data.(io.ReadCloser)
+			defer reader.Close()
+
+			if path.Ext(filename) == ".nuspec" {
+				w.Header().Set("Content-Type", "application/xml")
+			} else {
+				w.Header().Set("Content-Type", "application/octet-stream")
+			}
+			w.Header().Set("Cache-Control", archiveCacheControl)
+			n, err := io.Copy(w, reader)
+			h.metrics.RecordBytesServed("nuget_package", n)
+			return err
+		},
+	)
+}
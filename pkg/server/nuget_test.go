@@ -0,0 +1,90 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/elisiariocouto/specular/internal/stats"
+	"github.com/elisiariocouto/specular/pkg/config"
+	"github.com/elisiariocouto/specular/pkg/nuget"
+)
+
+// TestNuGetRoutes tests the NuGet proxy through the router, from the service index to a package download
+func TestNuGetRoutes(t *testing.T) {
+	var source *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v3/index.json", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"version":"3.0.0","resources":[{"@id":"`+source.URL+`/flat/","@type":"PackageBaseAddress/3.0.0"}]}`)
+	})
+	mux.HandleFunc("/flat/serilog/index.json", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"versions":["4.0.0"]}`)
+	})
+	mux.HandleFunc("/flat/serilog/4.0.0/serilog.4.0.0.nupkg", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "nupkg")
+	})
+	source = httptest.NewServer(mux)
+	defer source.Close()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := &config.Config{
+		StorageType:   "memory",
+		BaseURL:       "https://specular.example.com",
+		NuGetUpstream: source.URL + "/v3/index.json",
+		AdminToken:    "s3cret",
+
+		MirrorAuthRequired: true,
+		UpstreamTimeout:    5 * time.Second,
+	}
+	router, _, err := newRouter(cfg, createTestMirror(nil, nil, nil, nil, nil, nil), metricsForTests(), stats.NewRecorder(time.Hour), nil, logger)
+	if err != nil {
+		t.Fatalf("newRouter failed: %v", err)
+	}
+
+	get := func(path string, authenticated bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if authenticated {
+			req.SetBasicAuth("build", "s3cret")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := get("/nuget/v3/index.json", false); w.Code != http.StatusUnauthorized {
+		t.Errorf("unauthenticated service index: expected status 401, got %d", w.Code)
+	}
+
+	w := get("/nuget/v3/index.json", true)
+	if w.Code != http.StatusOK {
+		t.Fatalf("service index: expected status 200, got %d", w.Code)
+	}
+	var index nuget.ServiceIndex
+	if err := json.Unmarshal(w.Body.Bytes(), &index); err != nil {
+		t.Fatalf("failed to decode service index: %v", err)
+	}
+	if len(index.Resources) != 1 || index.Resources[0].ID != "https://specular.example.com/nuget/v3-flatcontainer/" {
+		t.Errorf("unexpected service index %+v", index)
+	}
+
+	if w := get("/nuget/v3-flatcontainer/Serilog/index.json", true); w.Code != http.StatusOK || w.Body.String() != `{"versions":["4.0.0"]}` {
+		t.Errorf("versions: got %d %s", w.Code, w.Body.String())
+	}
+	w = get("/nuget/v3-flatcontainer/serilog/4.0.0/serilog.4.0.0.nupkg", true)
+	if w.Code != http.StatusOK || w.Body.String() != "nupkg" {
+		t.Errorf("package: got %d %s", w.Code, w.Body.String())
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != archiveCacheControl {
+		t.Errorf("package Cache-Control = %q", cc)
+	}
+	if w := get("/nuget/v3-flatcontainer/serilog/4.0.0/other.4.0.0.nupkg", true); w.Code != http.StatusBadRequest {
+		t.Errorf("foreign filename: expected status 400, got %d", w.Code)
+	}
+	if w := get("/nuget/v3-flatcontainer/missing/index.json", true); w.Code != http.StatusNotFound {
+		t.Errorf("missing package: expected status 404, got %d", w.Code)
+	}
+}
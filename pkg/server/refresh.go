@@ -0,0 +1,52 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/elisiariocouto/specular/internal/auth"
+	"github.com/elisiariocouto/specular/pkg/mirror"
+)
+
+// refreshHeader asks for cached metadata to be revalidated against upstream
+const refreshHeader = "X-Specular-Refresh"
+
+// RefreshMiddleware honors the refresh header for principals granted the prefetch scope and clients in the
+// allowed networks, other clients are served as if it was not set
+// authn may be nil when no credentials are configured. Must run after RealIPMiddleware
+func RefreshMiddleware(authn *Authenticator, allowed []netip.Prefix, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if authn == nil && len(allowed) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.EqualFold(r.Header.Get(refreshHeader), "true") {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !refreshAllowed(r, authn, allowed) {
+				logger.DebugContext(r.Context(), "refresh header ignored for unauthorized client",
+					slog.String("path", r.URL.Path))
+				next.ServeHTTP(w, r)
+				return
+			}
+			logger.InfoContext(r.Context(), "refreshing cached metadata on request",
+				slog.String("path", r.URL.Path))
+			next.ServeHTTP(w, r.WithContext(mirror.WithRefresh(r.Context())))
+		})
+	}
+}
+
+// refreshAllowed reports whether the client of r may force a refresh
+func refreshAllowed(r *http.Request, authn *Authenticator, allowed []netip.Prefix) bool {
+	if client, ok := parseRemoteAddr(r.RemoteAddr); ok && isTrusted(client, allowed) {
+		return true
+	}
+	if authn == nil {
+		return false
+	}
+	principal, ok := authn.Authenticate(r)
+	return ok && principal.HasScope(auth.ScopePrefetch)
+}
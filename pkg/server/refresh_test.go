@@ -0,0 +1,75 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/elisiariocouto/specular/internal/auth"
+	"github.com/elisiariocouto/specular/pkg/mirror"
+)
+
+// TestRefreshMiddleware tests that only authorized clients can force a metadata refresh
+func TestRefreshMiddleware(t *testing.T) {
+	sum := sha256.Sum256([]byte("ci-secret"))
+	keysFile := filepath.Join(t.TempDir(), "keys.json")
+	keysJSON := `{"keys": [{"id": "ci", "sha256": "` + hex.EncodeToString(sum[:]) + `", "scopes": ["read-mirror"]}]}`
+	if err := os.WriteFile(keysFile, []byte(keysJSON), 0o600); err != nil {
+		t.Fatalf("failed to write keys file: %v", err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	keys, err := auth.NewKeyStore(keysFile, logger)
+	if err != nil {
+		t.Fatalf("failed to load keys: %v", err)
+	}
+	authn := NewAuthenticator("s3cret", nil, keys, logger)
+	allowed := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	var refreshed bool
+	handler := RefreshMiddleware(authn, allowed, logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		refreshed = mirror.RefreshRequested(r.Context())
+	}))
+
+	tests := []struct {
+		name       string
+		header     string
+		token      string
+		remoteAddr string
+		want       bool
+	}{
+		{name: "no header", token: "s3cret", remoteAddr: "192.0.2.1:5000", want: false},
+		{name: "admin token", header: "true", token: "s3cret", remoteAddr: "192.0.2.1:5000", want: true},
+		{name: "allowlisted client", header: "TRUE", remoteAddr: "10.1.2.3:5000", want: true},
+		{name: "key without prefetch scope", header: "true", token: "ci-secret", remoteAddr: "192.0.2.1:5000", want: false},
+		{name: "anonymous client", header: "true", remoteAddr: "192.0.2.1:5000", want: false},
+		{name: "header not true", header: "1", token: "s3cret", remoteAddr: "10.1.2.3:5000", want: false},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/terraform/providers/registry.terraform.io/hashicorp/aws/index.json", nil)
+		req.RemoteAddr = tt.remoteAddr
+		if tt.header != "" {
+			req.Header.Set(refreshHeader, tt.header)
+		}
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		refreshed = false
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: expected status 200, got %d", tt.name, w.Code)
+		}
+		if refreshed != tt.want {
+			t.Errorf("%s: refresh requested = %v, want %v", tt.name, refreshed, tt.want)
+		}
+	}
+}
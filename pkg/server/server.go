@@ -0,0 +1,490 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/elisiariocouto/specular/internal/auth"
+	"github.com/elisiariocouto/specular/internal/jobs"
+	"github.com/elisiariocouto/specular/internal/stats"
+	"github.com/elisiariocouto/specular/pkg/config"
+	"github.com/elisiariocouto/specular/pkg/metrics"
+	"github.com/elisiariocouto/specular/pkg/mirror"
+	"github.com/elisiariocouto/specular/pkg/nuget"
+	"github.com/elisiariocouto/specular/pkg/storage"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Server represents the HTTP server
+type Server struct {
+	httpServer         *http.Server
+	listeners          []boundListener
+	mu                 sync.Mutex
+	sockets            []net.Listener // bound sockets, before TLS, handed over by Upgrade
+	certs              []*certReloader
+	tlsReloadInterval  time.Duration
+	keys               *auth.KeyStore
+	keysReloadInterval time.Duration
+	stopWatch          context.CancelFunc
+	logger             *slog.Logger
+}
+
+// Option configures optional dependencies of the server
+type Option func(*options)
+
+// options holds the dependencies set by Option, all nil by default
+type options struct {
+	queue *jobs.Queue
+}
+
+// WithJobQueue serves the job admin endpoints from queue, they are left out without one
+func WithJobQueue(queue *jobs.Queue) Option {
+	return func(o *options) {
+		o.queue = queue
+	}
+}
+
+// New creates and configures a new HTTP server
+// A nil recorder keeps download statistics for the configured retention
+func New(
+	cfg *config.Config,
+	m Mirror,
+	metrics *metrics.Metrics,
+	recorder *stats.Recorder,
+	logger *slog.Logger,
+	opts ...Option,
+) (*Server, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if recorder == nil {
+		recorder = stats.NewRecorder(cfg.StatsRetention)
+	}
+
+	router, keys, err := newRouter(cfg, m, metrics, recorder, o.queue, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	listeners, err := cfg.Listeners()
+	if err != nil {
+		return nil, fmt.Errorf("invalid listeners: %w", err)
+	}
+
+	httpServer := &http.Server{
+		Handler:      router,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  120 * time.Second,
+	}
+
+	server := &Server{
+		httpServer:         httpServer,
+		tlsReloadInterval:  cfg.TLSReloadInterval,
+		keys:               keys,
+		keysReloadInterval: cfg.APIKeysReloadInterval,
+		logger:             logger,
+	}
+
+	// Listeners sharing a certificate share its reloader
+	reloaders := make(map[[2]string]*certReloader)
+	for _, l := range listeners {
+		bound := boundListener{Listener: l}
+		if l.TLS() {
+			tlsConfig, err := newTLSConfig(cfg)
+			if err != nil {
+				return nil, err
+			}
+			certs, ok := reloaders[[2]string{l.CertFile, l.KeyFile}]
+			if !ok {
+				certs, err = newCertReloader(l.CertFile, l.KeyFile, logger)
+				if err != nil {
+					return nil, err
+				}
+				reloaders[[2]string{l.CertFile, l.KeyFile}] = certs
+				server.certs = append(server.certs, certs)
+			}
+			tlsConfig.GetCertificate = certs.GetCertificate
+			tlsConfig.NextProtos = []string{"h2", "http/1.1"}
+			bound.tlsConfig = tlsConfig
+		}
+		server.listeners = append(server.listeners, bound)
+	}
+
+	return server, nil
+}
+
+// NewHandler returns the full Specular router for mounting inside an existing HTTP server
+// It wires an upstream client, mirror service, metrics and statistics from cfg around store
+// Listener, TLS and shutdown settings are ignored, and API keys are loaded once. Background work is
+// not started either, so the job queue and its admin endpoints, retention, replication and monitors are left out
+func NewHandler(cfg *config.Config, store storage.Storage, logger *slog.Logger) (http.Handler, error) {
+	var m *metrics.Metrics
+	if cfg.MetricsEnabled {
+		m = metrics.New(nil, metrics.Options{
+			DisableGoCollector:      !cfg.MetricsGoCollector,
+			DisableProcessCollector: !cfg.MetricsProcessCollector,
+		})
+	} else {
+		m = metrics.Noop()
+	}
+
+	upstream := mirror.NewUpstreamClient(cfg.UpstreamTimeout, cfg.MaxRetries, cfg.DiscoveryCacheTTL, logger)
+	upstream.SetMetrics(m)
+	if err := ConfigureUpstream(upstream, cfg); err != nil {
+		return nil, err
+	}
+	if cfg.StorageReadOnly {
+		store = storage.NewReadOnly(store)
+	}
+	mirrorService := mirror.NewMirror(store, upstream, cfg.BaseURL)
+	if err := ConfigureMirror(mirrorService, cfg); err != nil {
+		return nil, err
+	}
+
+	router, _, err := newRouter(cfg, mirrorService, m, stats.NewRecorder(cfg.StatsRetention), nil, logger)
+	if err != nil {
+		return nil, err
+	}
+	return router, nil
+}
+
+// newRouter builds the router with every route and middleware
+// The API key store is returned so the server can watch it for changes
+func newRouter(
+	cfg *config.Config,
+	m Mirror,
+	metrics *metrics.Metrics,
+	recorder *stats.Recorder,
+	queue *jobs.Queue,
+	logger *slog.Logger,
+) (http.Handler, *auth.KeyStore, error) {
+	trustedProxies, err := config.ParsePrefixes(cfg.TrustedProxies)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+	managementAllowlist, err := config.ParsePrefixes(cfg.ManagementAllowlist)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid management allowlist: %w", err)
+	}
+	refreshAllowlist, err := config.ParsePrefixes(cfg.RefreshAllowlist)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid refresh allowlist: %w", err)
+	}
+	metricsProviders, err := config.ParseProviderPatterns(cfg.MetricsProviderLabels)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid metrics provider labels: %w", err)
+	}
+	labelledProviders := make(mirror.ProviderRules[bool], len(metricsProviders))
+	for _, pattern := range metricsProviders {
+		labelledProviders[pattern] = true
+	}
+	responseHeaders, err := config.ParseResponseHeaders(cfg.ResponseHeaders)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid response headers: %w", err)
+	}
+	cacheControlValues, err := config.ParseCacheControl(cfg.CacheControl)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid cache control: %w", err)
+	}
+	cacheControlOverrides, err := config.ParseCacheControlOverrides(cfg.CacheControlOverrides)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid cache control overrides: %w", err)
+	}
+
+	router := chi.NewRouter()
+
+	// Global middleware
+	router.Use(middleware.RequestID)
+	router.Use(TraceContextMiddleware)
+	router.Use(RealIPMiddleware(trustedProxies))
+	router.Use(RecoveryMiddleware(logger))
+	router.Use(LoggingMiddleware(logger))
+	router.Use(ProviderMetricsMiddleware(metrics, labelledProviders))
+	router.Use(ResponseHeadersMiddleware(responseHeaders[""]))
+
+	// Create handlers
+	handlers := NewHandlers(m, metrics, recorder, logger)
+	handlers.jobs = queue
+	handlers.indexVersionLimit = cfg.IndexVersionLimit
+	handlers.baseURL = cfg.BaseURL
+	handlers.mirrorAuthRequired = cfg.MirrorAuthRequired
+	handlers.discoveryHost = cfg.DiscoveryHost
+	handlers.cacheControl = cacheControl{
+		resources: cacheControlValues,
+		overrides: mirror.ProviderRules[string](cacheControlOverrides),
+	}
+
+	// Management routes (/admin, /metrics, /debug) can be restricted to internal networks
+	management := AllowlistMiddleware(managementAllowlist)
+
+	// Routes
+	router.Get("/", handlers.LandingHandler)
+	router.Get("/health", handlers.HealthHandler)
+	router.Get("/ready", handlers.ReadyHandler)
+	router.Get("/.well-known/terraform.json", handlers.WellKnownHandler)
+	router.With(management).Handle("/metrics", handlers.MetricsHandler())
+
+	// Bearer authentication from the admin token, OIDC issuer and API keys
+	var authn *Authenticator
+	var keys *auth.KeyStore
+	if cfg.AdminEnabled() {
+		var verifier *auth.OIDCVerifier
+		if cfg.AdminOIDCIssuer != "" {
+			requiredClaims, err := config.ParseRequiredClaims(cfg.AdminOIDCRequiredClaims)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid admin OIDC required claims: %w", err)
+			}
+			verifier = auth.NewOIDCVerifier(auth.OIDCConfig{
+				Issuer:         cfg.AdminOIDCIssuer,
+				Audience:       cfg.AdminOIDCAudience,
+				RequiredClaims: requiredClaims,
+			}, nil)
+		}
+		if cfg.APIKeysFile != "" {
+			keys, err = auth.NewKeyStore(cfg.APIKeysFile, logger)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		authn = NewAuthenticator(cfg.AdminToken, verifier, keys, logger)
+
+		// Admin API, only exposed when some form of authentication is configured
+		router.Route("/admin", func(r chi.Router) {
+			r.Use(ResponseHeadersMiddleware(responseHeaders["admin"]))
+			r.Use(management)
+			r.With(authn.RequireScope(auth.ScopeStats)).Get("/stats/top", handlers.TopStatsHandler)
+			r.With(authn.RequireScope(auth.ScopeStats)).Get("/reports/downloads", handlers.DownloadsReportHandler)
+			r.With(authn.RequireScope(auth.ScopeStats)).Get("/upstreams", handlers.UpstreamsHandler)
+			r.With(authn.RequireScope(auth.ScopeBackup), StreamingDeadlineMiddleware(cfg.DownloadIdleTimeout)).Get("/backup", handlers.BackupHandler)
+			if queue != nil {
+				r.Route("/jobs", func(r chi.Router) {
+					r.Use(authn.RequireScope(auth.ScopeJobs))
+					r.Get("/", handlers.ListJobsHandler)
+					r.Post("/", handlers.CreateJobHandler)
+					r.Get("/{id}", handlers.GetJobHandler)
+					r.Delete("/{id}", handlers.CancelJobHandler)
+				})
+				r.With(authn.RequireScope(auth.ScopePrefetch)).Post("/prefetch", handlers.PrefetchHandler)
+			}
+		})
+	}
+
+	// Tenants may be restricted to some providers, provider parameters are only known once a route matched
+	tenancy := TenantProviderMiddleware(m)
+
+	// Trusted clients may revalidate cached metadata against upstream
+	refresh := RefreshMiddleware(authn, refreshAllowlist, logger)
+
+	// Terraform provider mirror protocol endpoints under /terraform/providers base path
+	// This allows for future support of other registries (e.g., /docker/registries, /npm, /pypi)
+	router.Route("/terraform/providers", func(r chi.Router) {
+		r.Use(ResponseHeadersMiddleware(responseHeaders["mirror"]))
+		if cfg.MirrorAuthRequired {
+			r.Use(authn.RequireScope(auth.ScopeReadMirror))
+		}
+
+		// GET /terraform/providers/:hostname/:namespace/:type/* (catches index.json, version.json, and archives)
+		// Use wildcard to handle dots in version numbers (e.g., 6.26.0.json) and zip files
+		r.With(tenancy, refresh).Get("/{hostname}/{namespace}/{type}/*", handlers.MetadataHandler)
+
+		// Provider archive download endpoint with explicit parameters
+		// Downloads use an idle-based write deadline instead of the global write timeout
+		r.With(
+			tenancy,
+			ClientConcurrencyMiddlewareWithWait(cfg.DownloadConcurrencyPerClient, cfg.DownloadQueueTimeout),
+			StreamingDeadlineMiddleware(cfg.DownloadIdleTimeout),
+		).Get("/download/{hostname}/{namespace}/{type}/{version}/{os}/{arch}/{filename}", handlers.DownloadHandler)
+	})
+
+	// NuGet v3 package source proxy, for .NET builds sharing the cache and credentials of the mirror
+	if cfg.NuGetUpstream != "" {
+		store, err := newNuGetStorage(cfg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to initialize NuGet storage: %w", err)
+		}
+		handlers.nuget = nuget.NewProxy(store, cfg.NuGetUpstream, cfg.UpstreamTimeout, logger)
+
+		router.Route("/nuget", func(r chi.Router) {
+			r.Use(ResponseHeadersMiddleware(responseHeaders["mirror"]))
+			if cfg.MirrorAuthRequired {
+				r.Use(authn.RequireScope(auth.ScopeReadMirror))
+			}
+			r.Get("/v3/index.json", handlers.NuGetServiceIndexHandler)
+			r.Get("/v3-flatcontainer/{id}/index.json", handlers.NuGetVersionsHandler)
+			r.With(
+				ClientConcurrencyMiddlewareWithWait(cfg.DownloadConcurrencyPerClient, cfg.DownloadQueueTimeout),
+				StreamingDeadlineMiddleware(cfg.DownloadIdleTimeout),
+			).Get("/v3-flatcontainer/{id}/{version}/{filename}", handlers.NuGetPackageHandler)
+		})
+	}
+
+	// Helper API for tooling built around the mirror
+	router.Route("/api", func(r chi.Router) {
+		r.Use(ResponseHeadersMiddleware(responseHeaders["api"]))
+		if cfg.MirrorAuthRequired {
+			r.Use(authn.RequireScope(auth.ScopeReadMirror))
+		}
+
+		// GET /api/lock/:hostname/:namespace/:type/:version returns a .terraform.lock.hcl provider block
+		r.With(tenancy).Get("/lock/{hostname}/{namespace}/{type}/{version}", handlers.LockHandler)
+
+		// GET /api/providers/:hostname/:namespace/:type returns the provider's versions, platforms and cache status
+		r.With(tenancy).Get("/providers/{hostname}/{namespace}/{type}", handlers.ProviderInfoHandler)
+	})
+
+	// 404 handler
+	router.NotFound(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error":"not found"}`)
+	}))
+
+	return router, keys, nil
+}
+
+// boundListener is a configured listener with its TLS configuration, if any
+type boundListener struct {
+	config.Listener
+	tlsConfig *tls.Config
+}
+
+// Start binds every listener and serves requests until the server is shut down
+// If any address cannot be bound, no listener is served
+// When started by Upgrade, the sockets of the replaced process are reused instead of bound again
+func (s *Server) Start() error {
+	inherited, err := inheritedListeners()
+	if err != nil {
+		return err
+	}
+	listeners, err := s.listen(inherited)
+	if err != nil {
+		return err
+	}
+	if inherited != nil {
+		if err := notifyUpgradeReady(); err != nil {
+			s.logger.Warn("failed to notify the replaced process",
+				slog.String("error", err.Error()))
+		}
+	}
+	return s.serve(listeners)
+}
+
+// listen binds the configured addresses, taking the sockets found in inherited instead when present
+// Inherited sockets that are no longer configured are closed
+func (s *Server) listen(inherited map[string]net.Listener) ([]net.Listener, error) {
+	defer func() {
+		for _, ln := range inherited {
+			ln.Close()
+		}
+	}()
+
+	var lc net.ListenConfig
+	sockets := make([]net.Listener, 0, len(s.listeners))
+	listeners := make([]net.Listener, 0, len(s.listeners))
+	for _, l := range s.listeners {
+		key := listenerKey(l.Listener)
+		ln, ok := inherited[key]
+		if ok {
+			delete(inherited, key)
+		} else {
+			var err error
+			ln, err = lc.Listen(context.Background(), l.Network, l.Address)
+			if err != nil {
+				for _, opened := range sockets {
+					opened.Close()
+				}
+				return nil, fmt.Errorf("failed to listen on %s: %w", l.Address, err)
+			}
+		}
+		sockets = append(sockets, ln)
+		if l.tlsConfig != nil {
+			ln = tls.NewListener(ln, l.tlsConfig)
+		}
+		listeners = append(listeners, ln)
+	}
+
+	s.mu.Lock()
+	s.sockets = sockets
+	s.mu.Unlock()
+	return listeners, nil
+}
+
+// serve accepts connections on every listener and returns the first error
+// After Shutdown the error is http.ErrServerClosed
+func (s *Server) serve(listeners []net.Listener) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.stopWatch = cancel
+	s.mu.Unlock()
+	if s.keys != nil && s.keysReloadInterval > 0 {
+		go s.keys.Watch(ctx, s.keysReloadInterval)
+	}
+	if s.tlsReloadInterval > 0 {
+		for _, certs := range s.certs {
+			go certs.Watch(ctx, s.tlsReloadInterval)
+		}
+	}
+
+	errs := make(chan error, len(listeners))
+	for i, ln := range listeners {
+		s.logger.InfoContext(ctx, "starting HTTP server",
+			slog.String("address", ln.Addr().String()),
+			slog.String("network", s.listeners[i].Network),
+			slog.Bool("tls", s.listeners[i].tlsConfig != nil),
+		)
+		go func() {
+			errs <- s.httpServer.Serve(ln)
+		}()
+	}
+	return <-errs
+}
+
+// Shutdown gracefully shuts down the HTTP server
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.logger.InfoContext(ctx, "shutting down HTTP server")
+	s.mu.Lock()
+	if s.stopWatch != nil {
+		s.stopWatch()
+	}
+	s.mu.Unlock()
+	return s.httpServer.Shutdown(ctx)
+}
+
+// TLSEnabled reports whether a listener serves TLS, so there are certificates to reload
+func (s *Server) TLSEnabled() bool {
+	return len(s.certs) > 0
+}
+
+// APIKeysEnabled reports whether an API keys file is loaded, so there are keys to reload
+func (s *Server) APIKeysEnabled() bool {
+	return s.keys != nil
+}
+
+// ReloadTLS reloads the TLS certificates and keys of every listener from disk
+// It is a no-op when TLS is not enabled
+func (s *Server) ReloadTLS() error {
+	var errs []error
+	for _, certs := range s.certs {
+		errs = append(errs, certs.Reload())
+	}
+	return errors.Join(errs...)
+}
+
+// ReloadAPIKeys reloads the API keys file from disk
+// It is a no-op when no API keys file is configured
+func (s *Server) ReloadAPIKeys() error {
+	if s.keys == nil {
+		return nil
+	}
+	return s.keys.Reload()
+}
@@ -0,0 +1,334 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elisiariocouto/specular/internal/jobs"
+	"github.com/elisiariocouto/specular/internal/stats"
+	"github.com/elisiariocouto/specular/pkg/config"
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+// freeAddress returns a loopback address with a port that is currently unused
+func freeAddress(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// TestServerMultipleListeners tests serving plain HTTP and TLS listeners from one server
+func TestServerMultipleListeners(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	writeTestCertificate(t, certFile, keyFile, "listener")
+
+	plainAddr := freeAddress(t)
+	tlsAddr := freeAddress(t)
+	cfg := &config.Config{
+		Listen:       []string{plainAddr, tlsAddr + ";cert=" + certFile + ";key=" + keyFile + ";network=tcp4"},
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 5 * time.Second,
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s, err := New(cfg, createTestMirror(nil, nil, nil, nil, nil, nil), metricsForTests(), stats.NewRecorder(time.Hour), logger)
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+	listeners, err := s.listen(nil)
+	if err != nil {
+		t.Fatalf("listen() returned error: %v", err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- s.serve(listeners) }()
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+	for _, url := range []string{"http://" + plainAddr + "/health", "https://" + tlsAddr + "/health"} {
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", url, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("GET %s returned %d", url, resp.StatusCode)
+		}
+	}
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() returned error: %v", err)
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		t.Errorf("expected http.ErrServerClosed, got %v", err)
+	}
+}
+
+// TestServerTLSEnabled tests that only servers with a TLS listener have certificates to reload
+// TestServerOptions tests that New serves job endpoints only with a queue and accepts a nil recorder
+func TestServerOptions(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	queue, err := jobs.NewQueue(jobs.Options{Workers: 1, QueueSize: 1}, metricsForTests(), logger)
+	if err != nil {
+		t.Fatalf("NewQueue failed: %v", err)
+	}
+	cfg := &config.Config{Listen: []string{freeAddress(t)}, AdminToken: "s3cret", StatsRetention: time.Hour}
+
+	for name, tc := range map[string]struct {
+		opts []Option
+		want int
+	}{
+		"without queue": {want: http.StatusNotFound},
+		"with queue":    {opts: []Option{WithJobQueue(queue)}, want: http.StatusOK},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, err := New(cfg, createTestMirror(nil, nil, nil, nil, nil, nil), metricsForTests(), nil, logger, tc.opts...)
+			if err != nil {
+				t.Fatalf("New() returned error: %v", err)
+			}
+			for path, want := range map[string]int{"/admin/jobs": tc.want, "/admin/stats/top?window=1h": http.StatusOK} {
+				req := httptest.NewRequest("GET", path, nil)
+				req.Header.Set("Authorization", "Bearer s3cret")
+				w := httptest.NewRecorder()
+				s.httpServer.Handler.ServeHTTP(w, req)
+				if w.Code != want {
+					t.Errorf("%s: expected status %d, got %d", path, want, w.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestServerTLSEnabled(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	writeTestCertificate(t, certFile, keyFile, "listener")
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	addr := freeAddress(t)
+	for _, tt := range []struct {
+		listen string
+		want   bool
+	}{
+		{addr, false},
+		{addr + ";cert=" + certFile + ";key=" + keyFile, true},
+	} {
+		cfg := &config.Config{Listen: []string{tt.listen}, ReadTimeout: 5 * time.Second, WriteTimeout: 5 * time.Second}
+		s, err := New(cfg, createTestMirror(nil, nil, nil, nil, nil, nil), metricsForTests(), stats.NewRecorder(time.Hour), logger)
+		if err != nil {
+			t.Fatalf("New() returned error: %v", err)
+		}
+		if got := s.TLSEnabled(); got != tt.want {
+			t.Errorf("TLSEnabled() = %v for %s, want %v", got, tt.listen, tt.want)
+		}
+		if s.APIKeysEnabled() {
+			t.Errorf("expected no API keys to reload for %s", tt.listen)
+		}
+	}
+}
+
+// TestServerListenFailure tests that no listener is left open when one address cannot be bound
+func TestServerListenFailure(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer taken.Close()
+
+	freeAddr := freeAddress(t)
+	cfg := &config.Config{
+		Listen:       []string{freeAddr, taken.Addr().String()},
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 5 * time.Second,
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s, err := New(cfg, createTestMirror(nil, nil, nil, nil, nil, nil), metricsForTests(), stats.NewRecorder(time.Hour), logger)
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+	if _, err := s.listen(nil); err == nil {
+		t.Fatal("expected listen() to fail on a taken address")
+	}
+
+	// The first address was released again
+	ln, err := net.Listen("tcp", freeAddr)
+	if err != nil {
+		t.Fatalf("expected %s to be released: %v", freeAddr, err)
+	}
+	ln.Close()
+}
+
+// TestServerInheritListeners tests a server taking over the sockets of another, as after Upgrade
+func TestServerInheritListeners(t *testing.T) {
+	addr := freeAddress(t)
+	cfg := &config.Config{
+		Listen:       []string{addr},
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 5 * time.Second,
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	newServer := func() *Server {
+		s, err := New(cfg, createTestMirror(nil, nil, nil, nil, nil, nil), metricsForTests(), stats.NewRecorder(time.Hour), logger)
+		if err != nil {
+			t.Fatalf("New() returned error: %v", err)
+		}
+		return s
+	}
+
+	old := newServer()
+	listeners, err := old.listen(nil)
+	if err != nil {
+		t.Fatalf("listen() returned error: %v", err)
+	}
+	go old.serve(listeners)
+
+	f, err := old.sockets[0].(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("File() returned error: %v", err)
+	}
+	key := listenerKey(old.listeners[0].Listener)
+	inherited, err := fileListeners([]string{key}, []*os.File{f})
+	if err != nil {
+		t.Fatalf("fileListeners() returned error: %v", err)
+	}
+
+	// The address is still bound by the old server, so it can only be served through the inherited socket
+	replacement := newServer()
+	listeners, err = replacement.listen(inherited)
+	if err != nil {
+		t.Fatalf("listen() with inherited sockets returned error: %v", err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- replacement.serve(listeners) }()
+	if err := old.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() returned error: %v", err)
+	}
+
+	resp, err := http.Get("http://" + addr + "/health")
+	if err != nil {
+		t.Fatalf("GET after handover failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET after handover returned %d", resp.StatusCode)
+	}
+
+	if err := replacement.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() returned error: %v", err)
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		t.Errorf("expected http.ErrServerClosed, got %v", err)
+	}
+}
+
+// TestNewHandler tests mounting the router inside another HTTP server
+func TestNewHandler(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	index := []byte(`{"versions":{"1.0.0":{}}}`)
+	if err := store.PutIndex(context.Background(), "registry.terraform.io", "hashicorp", "aws", index); err != nil {
+		t.Fatalf("PutIndex failed: %v", err)
+	}
+
+	cfg := &config.Config{
+		BaseURL:        "https://gateway.example.com/specular",
+		MetricsEnabled: true,
+		StatsRetention: time.Hour,
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handler, err := NewHandler(cfg, store, logger)
+	if err != nil {
+		t.Fatalf("NewHandler() returned error: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/specular/", http.StripPrefix("/specular", handler))
+	mux.HandleFunc("/other", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/specular/terraform/providers/registry.terraform.io/hashicorp/aws/index.json", http.StatusOK, string(index)},
+		{"/specular/health", http.StatusOK, `{"status":"ok"}`},
+		{"/specular/metrics", http.StatusOK, ""},
+		{"/other", http.StatusTeapot, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.status {
+			t.Errorf("GET %s returned %d, want %d", tt.path, w.Code, tt.status)
+		}
+		if tt.body != "" && w.Body.String() != tt.body {
+			t.Errorf("GET %s returned body %q, want %q", tt.path, w.Body.String(), tt.body)
+		}
+	}
+}
+
+// TestNewHandler_MirrorSettings tests that the mirror settings of cfg apply to a mounted router
+func TestNewHandler_MirrorSettings(t *testing.T) {
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"versions":[{"version":"2.0.0","platforms":[{"os":"linux","arch":"amd64"}]}]}`)
+	}))
+	defer source.Close()
+
+	tests := []struct {
+		name string
+		cfg  func(cfg *config.Config)
+	}{
+		{"metadata TTL", func(cfg *config.Config) { cfg.MetadataTTL = time.Nanosecond }},
+		{"passthrough", func(cfg *config.Config) { cfg.PassthroughProviders = []string{"registry.terraform.io/hashicorp/aws"} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := storage.NewMemoryStorage()
+			if err := store.PutIndex(context.Background(), "registry.terraform.io", "hashicorp", "aws", []byte(`{"versions":{"1.0.0":{}}}`)); err != nil {
+				t.Fatalf("PutIndex failed: %v", err)
+			}
+			time.Sleep(time.Millisecond)
+
+			// The provider source stands in for the registry, so the cached index is only kept without the setting
+			cfg := &config.Config{
+				BaseURL:         "http://localhost:8080",
+				UpstreamTimeout: 5 * time.Second,
+				ProviderSources: []string{"registry.terraform.io/hashicorp=" + source.URL + "/v1/providers/"},
+			}
+			tt.cfg(cfg)
+			handler, err := NewHandler(cfg, store, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if err != nil {
+				t.Fatalf("NewHandler() returned error: %v", err)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("GET", "/terraform/providers/registry.terraform.io/hashicorp/aws/index.json", nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), `"2.0.0"`) {
+				t.Errorf("expected the index from the provider source, got %s", w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/elisiariocouto/specular/internal/auth"
+	"github.com/elisiariocouto/specular/pkg/mirror"
+	"github.com/elisiariocouto/specular/pkg/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+// Tenant holds the policies applied to requests from a tenant's principals
+type Tenant struct {
+	ID string
+	// Principals lists the API key IDs and token subjects identifying the tenant
+	Principals []string
+	// Providers restricts the providers the tenant may use, empty allows every provider
+	Providers mirror.ProviderRules[bool]
+	// Mirror serves the tenant from an isolated cache, nil uses the shared one
+	Mirror Mirror
+}
+
+// TenantMirror routes requests to the mirror of the tenant the authenticated principal belongs to
+// Requests without a principal or from principals outside every tenant use the shared mirror
+type TenantMirror struct {
+	shared      Mirror
+	byPrincipal map[string]*Tenant
+}
+
+var _ Mirror = (*TenantMirror)(nil)
+
+// NewTenantMirror creates a mirror routing requests between tenants and the shared mirror
+func NewTenantMirror(shared Mirror, tenants []*Tenant) *TenantMirror {
+	byPrincipal := make(map[string]*Tenant)
+	for _, tenant := range tenants {
+		for _, principal := range tenant.Principals {
+			byPrincipal[principal] = tenant
+		}
+	}
+	return &TenantMirror{shared: shared, byPrincipal: byPrincipal}
+}
+
+// tenant returns the tenant of the principal authenticated on ctx
+func (tm *TenantMirror) tenant(ctx context.Context) (*Tenant, bool) {
+	principal, ok := auth.PrincipalFromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	tenant, ok := tm.byPrincipal[principal.ID]
+	return tenant, ok
+}
+
+// mirror returns the mirror serving the request carried by ctx
+func (tm *TenantMirror) mirror(ctx context.Context) Mirror {
+	if tenant, ok := tm.tenant(ctx); ok && tenant.Mirror != nil {
+		return tenant.Mirror
+	}
+	return tm.shared
+}
+
+// Allowed reports whether the tenant behind ctx may use a provider
+func (tm *TenantMirror) Allowed(ctx context.Context, hostname, namespace, providerType string) bool {
+	tenant, ok := tm.tenant(ctx)
+	if !ok || len(tenant.Providers) == 0 {
+		return true
+	}
+	allowed, _ := tenant.Providers.Lookup(hostname, namespace, providerType)
+	return allowed
+}
+
+// The remaining Mirror methods serve the request from its tenant's mirror
+
+func (tm *TenantMirror) GetIndex(ctx context.Context, hostname, namespace, providerType string) ([]byte, error) {
+	return tm.mirror(ctx).GetIndex(ctx, hostname, namespace, providerType)
+}
+
+func (tm *TenantMirror) GetVersion(ctx context.Context, hostname, namespace, providerType, version string) ([]byte, error) {
+	return tm.mirror(ctx).GetVersion(ctx, hostname, namespace, providerType, version)
+}
+
+func (tm *TenantMirror) GetArchive(ctx context.Context, hostname, namespace, providerType, version, os, arch, archivePath string) (io.ReadCloser, error) {
+	return tm.mirror(ctx).GetArchive(ctx, hostname, namespace, providerType, version, os, arch, archivePath)
+}
+
+func (tm *TenantMirror) ProviderInfo(ctx context.Context, hostname, namespace, providerType string) (*mirror.ProviderInfo, error) {
+	return tm.mirror(ctx).ProviderInfo(ctx, hostname, namespace, providerType)
+}
+
+func (tm *TenantMirror) LockHashes(ctx context.Context, hostname, namespace, providerType, version string) ([]string, error) {
+	return tm.mirror(ctx).LockHashes(ctx, hostname, namespace, providerType, version)
+}
+
+func (tm *TenantMirror) ArchiveChecksum(ctx context.Context, archivePath string) (string, error) {
+	return tm.mirror(ctx).ArchiveChecksum(ctx, archivePath)
+}
+
+func (tm *TenantMirror) IndexModTime(ctx context.Context, hostname, namespace, providerType string) (time.Time, error) {
+	return tm.mirror(ctx).IndexModTime(ctx, hostname, namespace, providerType)
+}
+
+func (tm *TenantMirror) VersionModTime(ctx context.Context, hostname, namespace, providerType, version string) (time.Time, error) {
+	return tm.mirror(ctx).VersionModTime(ctx, hostname, namespace, providerType, version)
+}
+
+func (tm *TenantMirror) ArchiveModTime(ctx context.Context, archivePath string) (time.Time, error) {
+	return tm.mirror(ctx).ArchiveModTime(ctx, archivePath)
+}
+
+func (tm *TenantMirror) CheckWithdrawn(ctx context.Context, hostname, namespace, providerType, version string) error {
+	return tm.mirror(ctx).CheckWithdrawn(ctx, hostname, namespace, providerType, version)
+}
+
+func (tm *TenantMirror) ArchiveURL(ctx context.Context, hostname, namespace, providerType, version, archivePath string) (string, error) {
+	return tm.mirror(ctx).ArchiveURL(ctx, hostname, namespace, providerType, version, archivePath)
+}
+
+// DiskUsage, CheckStorage, Backup, Passthrough, UpstreamHealth and Services describe the shared cache and upstreams, they are not requested on behalf of a tenant
+func (tm *TenantMirror) DiskUsage(ctx context.Context) (storage.DiskUsage, error) {
+	return tm.shared.DiskUsage(ctx)
+}
+
+func (tm *TenantMirror) CheckStorage(ctx context.Context) (time.Duration, error) {
+	return tm.shared.CheckStorage(ctx)
+}
+
+func (tm *TenantMirror) Backup(ctx context.Context, w io.Writer, opts storage.BackupOptions) (storage.BackupManifest, error) {
+	return tm.shared.Backup(ctx, w, opts)
+}
+
+func (tm *TenantMirror) Passthrough() bool {
+	return tm.shared.Passthrough()
+}
+
+func (tm *TenantMirror) UpstreamHealth() []mirror.UpstreamHealth {
+	return tm.shared.UpstreamHealth()
+}
+
+func (tm *TenantMirror) Services(ctx context.Context, hostname string) (map[string]json.RawMessage, error) {
+	return tm.shared.Services(ctx, hostname)
+}
+
+// TenantProviderMiddleware rejects requests for providers outside the tenant's allowed providers with 403
+// Must be added to routes with hostname, namespace and type parameters, after authentication
+// Mirrors other than a *TenantMirror have no tenants and let every request through
+func TenantProviderMiddleware(m Mirror) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		tm, ok := m.(*TenantMirror)
+		if !ok {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !tm.Allowed(r.Context(), chi.URLParam(r, "hostname"), chi.URLParam(r, "namespace"), chi.URLParam(r, "type")) {
+				writeJSONError(w, http.StatusForbidden, "provider not allowed for tenant")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
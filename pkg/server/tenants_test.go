@@ -0,0 +1,93 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/elisiariocouto/specular/internal/stats"
+	"github.com/elisiariocouto/specular/pkg/config"
+	"github.com/elisiariocouto/specular/pkg/mirror"
+)
+
+// TestTenantMirror tests that tenants are served from their own mirror and limited to their providers
+func TestTenantMirror(t *testing.T) {
+	hash := func(secret string) string {
+		sum := sha256.Sum256([]byte(secret))
+		return hex.EncodeToString(sum[:])
+	}
+	keysFile := filepath.Join(t.TempDir(), "keys.json")
+	keysJSON := `{"keys": [
+		{"id": "payments", "sha256": "` + hash("payments-secret") + `", "scopes": ["read-mirror"]},
+		{"id": "data", "sha256": "` + hash("data-secret") + `", "scopes": ["read-mirror"]},
+		{"id": "other", "sha256": "` + hash("other-secret") + `", "scopes": ["read-mirror"]}
+	]}`
+	if err := os.WriteFile(keysFile, []byte(keysJSON), 0o600); err != nil {
+		t.Fatalf("failed to write keys file: %v", err)
+	}
+
+	shared := createTestMirror([]byte(`{"versions":{"1.0.0":{}}}`), nil, nil, nil, nil, nil)
+	isolated := createTestMirror([]byte(`{"versions":{"2.0.0":{}}}`), nil, nil, nil, nil, nil)
+	tenantMirror := NewTenantMirror(shared, []*Tenant{
+		{ID: "payments", Principals: []string{"payments"}, Mirror: isolated},
+		{ID: "data", Principals: []string{"data"}, Providers: mirror.ProviderRules[bool]{"registry.terraform.io/hashicorp": true}},
+	})
+
+	cfg := &config.Config{APIKeysFile: keysFile, MirrorAuthRequired: true}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	router, _, err := newRouter(cfg, tenantMirror, metricsForTests(), stats.NewRecorder(time.Hour), nil, logger)
+	if err != nil {
+		t.Fatalf("newRouter failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		secret   string
+		provider string
+		want     int
+		wantBody string
+	}{
+		{name: "isolated tenant", secret: "payments-secret", provider: "registry.terraform.io/acme/netbox", want: http.StatusOK, wantBody: `{"versions":{"2.0.0":{}}}`},
+		{name: "allowed provider", secret: "data-secret", provider: "registry.terraform.io/hashicorp/aws", want: http.StatusOK, wantBody: `{"versions":{"1.0.0":{}}}`},
+		{name: "disallowed provider", secret: "data-secret", provider: "registry.terraform.io/acme/netbox", want: http.StatusForbidden},
+		{name: "no tenant", secret: "other-secret", provider: "registry.terraform.io/acme/netbox", want: http.StatusOK, wantBody: `{"versions":{"1.0.0":{}}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/terraform/providers/"+tt.provider+"/index.json", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.secret)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("expected status %d, got %d: %s", tt.want, w.Code, w.Body.String())
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("expected body %s, got %s", tt.wantBody, w.Body.String())
+			}
+		})
+	}
+
+	// Downloads and lock files are restricted too
+	for _, path := range []string{
+		"/terraform/providers/download/registry.terraform.io/acme/netbox/1.0.0/linux/amd64/terraform-provider-netbox_1.0.0_linux_amd64.zip",
+		"/api/lock/registry.terraform.io/acme/netbox/1.0.0",
+	} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer data-secret")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: expected status 403, got %d", path, w.Code)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/elisiariocouto/specular/pkg/config"
+)
+
+// newTLSConfig builds the server TLS configuration from version and cipher settings
+func newTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	minVersion, err := config.ParseTLSVersion(cfg.TLSMinVersion)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS min version: %w", err)
+	}
+	maxVersion, err := config.ParseTLSVersion(cfg.TLSMaxVersion)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS max version: %w", err)
+	}
+	cipherSuites, err := config.ParseCipherSuites(cfg.TLSCipherSuites)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS cipher suites: %w", err)
+	}
+
+	return &tls.Config{
+		MinVersion: minVersion,
+		MaxVersion: maxVersion,
+		// Only applies to TLS 1.2 and below, TLS 1.3 suites are not configurable
+		CipherSuites: cipherSuites,
+	}, nil
+}
+
+// certReloader serves a TLS certificate that can be swapped at runtime
+// so short-lived certificates can rotate without restarting the server
+type certReloader struct {
+	certFile string
+	keyFile  string
+	logger   *slog.Logger
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// newCertReloader loads the initial certificate and key
+func newCertReloader(certFile, keyFile string, logger *slog.Logger) (*certReloader, error) {
+	cr := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		logger:   logger,
+	}
+	if err := cr.Reload(); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+// GetCertificate returns the current certificate, for use in tls.Config
+func (cr *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+	return cr.cert, nil
+}
+
+// Reload loads the certificate and key from disk and swaps them in
+// On failure the previous certificate keeps being served
+func (cr *certReloader) Reload() error {
+	modTime, err := cr.latestModTime()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	cr.mu.Lock()
+	cr.cert = &cert
+	cr.modTime = modTime
+	cr.mu.Unlock()
+
+	return nil
+}
+
+// Watch polls the certificate and key files and reloads them when they change
+// It returns when the context is cancelled
+func (cr *certReloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := cr.reloadIfChanged(); err != nil {
+				cr.logger.ErrorContext(ctx, "failed to reload TLS certificate",
+					slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+// reloadIfChanged reloads the certificate if either file was modified since the last load
+func (cr *certReloader) reloadIfChanged() (bool, error) {
+	modTime, err := cr.latestModTime()
+	if err != nil {
+		return false, err
+	}
+
+	cr.mu.RLock()
+	unchanged := modTime.Equal(cr.modTime)
+	cr.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	if err := cr.Reload(); err != nil {
+		return false, err
+	}
+	cr.logger.Info("TLS certificate reloaded",
+		slog.String("cert_file", cr.certFile))
+	return true, nil
+}
+
+// latestModTime returns the most recent modification time of the certificate and key files
+// Symlinks are followed, so atomic symlink swaps (as done by Kubernetes secrets) are detected
+func (cr *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{cr.certFile, cr.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to stat TLS file: %w", err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/elisiariocouto/specular/pkg/config"
+)
+
+// TestNewTLSConfig tests that TLS version and cipher settings are applied
+func TestNewTLSConfig(t *testing.T) {
+	cfg := &config.Config{
+		TLSMinVersion:   "1.2",
+		TLSMaxVersion:   "1.3",
+		TLSCipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+	}
+
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		t.Fatalf("newTLSConfig() returned error: %v", err)
+	}
+	if tlsConfig.MinVersion != tls.VersionTLS12 || tlsConfig.MaxVersion != tls.VersionTLS13 {
+		t.Errorf("unexpected versions: min %x max %x", tlsConfig.MinVersion, tlsConfig.MaxVersion)
+	}
+	if len(tlsConfig.CipherSuites) != 1 || tlsConfig.CipherSuites[0] != tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("unexpected cipher suites: %v", tlsConfig.CipherSuites)
+	}
+}
+
+// TestNewTLSConfig_Invalid tests that invalid TLS settings are rejected
+func TestNewTLSConfig_Invalid(t *testing.T) {
+	if _, err := newTLSConfig(&config.Config{TLSMinVersion: "2.0"}); err == nil {
+		t.Error("expected error for invalid min version")
+	}
+	if _, err := newTLSConfig(&config.Config{TLSCipherSuites: []string{"NOPE"}}); err == nil {
+		t.Error("expected error for invalid cipher suite")
+	}
+}
+
+// writeTestCertificate writes a self-signed certificate and key for commonName
+func writeTestCertificate(t *testing.T, certFile, keyFile, commonName string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+}
+
+// servedCommonName returns the common name of the certificate currently served
+func servedCommonName(t *testing.T, cr *certReloader) string {
+	t.Helper()
+	cert, err := cr.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("GetCertificate() returned error: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	return leaf.Subject.CommonName
+}
+
+// TestCertReloader tests that rotated certificates are picked up
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	writeTestCertificate(t, certFile, keyFile, "first")
+
+	cr, err := newCertReloader(certFile, keyFile, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("newCertReloader() returned error: %v", err)
+	}
+	if name := servedCommonName(t, cr); name != "first" {
+		t.Fatalf("expected first certificate, got %s", name)
+	}
+
+	// Unchanged files are not reloaded
+	if reloaded, err := cr.reloadIfChanged(); err != nil || reloaded {
+		t.Fatalf("expected no reload, got reloaded=%v err=%v", reloaded, err)
+	}
+
+	// Rotate the certificate with a newer modification time
+	writeTestCertificate(t, certFile, keyFile, "second")
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+
+	if reloaded, err := cr.reloadIfChanged(); err != nil || !reloaded {
+		t.Fatalf("expected reload, got reloaded=%v err=%v", reloaded, err)
+	}
+	if name := servedCommonName(t, cr); name != "second" {
+		t.Fatalf("expected second certificate, got %s", name)
+	}
+
+	// A broken key keeps the previous certificate
+	os.WriteFile(keyFile, []byte("garbage"), 0600)
+	if err := cr.Reload(); err == nil {
+		t.Fatal("expected error reloading invalid key")
+	}
+	if name := servedCommonName(t, cr); name != "second" {
+		t.Fatalf("expected second certificate to be kept, got %s", name)
+	}
+}
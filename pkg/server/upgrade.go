@@ -0,0 +1,148 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/elisiariocouto/specular/pkg/config"
+)
+
+// upgradeEnv lists the listeners a process inherits from the one it replaces, as comma-separated network/address keys
+// Their sockets are passed as file descriptors following upgradeReadyFD, in the listed order
+const upgradeEnv = "SPECULAR_UPGRADE_LISTENERS"
+
+// upgradeReadyFD is the pipe a new process writes to once it serves on the inherited sockets
+const upgradeReadyFD = 3
+
+// listenerKey identifies a configured listener across processes
+func listenerKey(l config.Listener) string {
+	return l.Network + "/" + l.Address
+}
+
+// inheritedListeners returns the sockets handed over by the process this one replaces, keyed by listenerKey
+// It returns nil when the process was not started by Upgrade
+func inheritedListeners() (map[string]net.Listener, error) {
+	value, ok := os.LookupEnv(upgradeEnv)
+	if !ok {
+		return nil, nil
+	}
+	// Processes started from this one must not inherit them again
+	os.Unsetenv(upgradeEnv)
+
+	keys := strings.Split(value, ",")
+	files := make([]*os.File, len(keys))
+	for i, key := range keys {
+		files[i] = os.NewFile(uintptr(upgradeReadyFD+1+i), key)
+	}
+	return fileListeners(keys, files)
+}
+
+// fileListeners turns inherited socket files into listeners, the files are closed
+func fileListeners(keys []string, files []*os.File) (map[string]net.Listener, error) {
+	listeners := make(map[string]net.Listener, len(keys))
+	var errs []error
+	for i, f := range files {
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to inherit listener %s: %w", keys[i], err))
+			continue
+		}
+		listeners[keys[i]] = ln
+	}
+	if len(errs) > 0 {
+		for _, ln := range listeners {
+			ln.Close()
+		}
+		return nil, errors.Join(errs...)
+	}
+	return listeners, nil
+}
+
+// notifyUpgradeReady tells the process this one replaces that it can shut down
+func notifyUpgradeReady() error {
+	ready := os.NewFile(upgradeReadyFD, "upgrade-ready")
+	defer ready.Close()
+	_, err := ready.Write([]byte{1})
+	return err
+}
+
+// Upgrade starts a new process from the current executable, handing over the listening sockets
+// It returns once the new process serves requests, this server should then be shut down to let in-flight requests finish
+// If the new process fails to start or exits first, an error is returned and this server keeps serving
+func (s *Server) Upgrade(ctx context.Context) error {
+	s.mu.Lock()
+	sockets := s.sockets
+	s.mu.Unlock()
+	if sockets == nil {
+		return errors.New("server is not listening")
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find executable: %w", err)
+	}
+
+	ready, readyWriter, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("failed to create readiness pipe: %w", err)
+	}
+	defer ready.Close()
+
+	files := []*os.File{readyWriter}
+	keys := make([]string, len(sockets))
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for i, ln := range sockets {
+		tcp, ok := ln.(*net.TCPListener)
+		if !ok {
+			return fmt.Errorf("listener %s cannot be handed over", ln.Addr())
+		}
+		f, err := tcp.File()
+		if err != nil {
+			return fmt.Errorf("failed to hand over listener %s: %w", ln.Addr(), err)
+		}
+		files = append(files, f)
+		keys[i] = listenerKey(s.listeners[i].Listener)
+	}
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(), upgradeEnv+"="+strings.Join(keys, ","))
+	cmd.ExtraFiles = files
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start new process: %w", err)
+	}
+	// Reap the new process if it exits before this one
+	go cmd.Wait()
+
+	// Only the new process holds the write end now, reading fails if it exits
+	readyWriter.Close()
+	result := make(chan error, 1)
+	go func() {
+		_, err := ready.Read(make([]byte, 1))
+		result <- err
+	}()
+
+	select {
+	case err := <-result:
+		if err != nil {
+			return fmt.Errorf("new process exited before serving: %w", err)
+		}
+		s.logger.InfoContext(ctx, "handed over listeners to new process",
+			slog.Int("pid", cmd.Process.Pid))
+		return nil
+	case <-ctx.Done():
+		cmd.Process.Kill()
+		return fmt.Errorf("new process did not start serving: %w", ctx.Err())
+	}
+}
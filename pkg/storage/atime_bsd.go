@@ -0,0 +1,19 @@
+//go:build darwin || freebsd
+
+package storage
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// accessTime returns when a file was last read, or its modification time when that is later
+func accessTime(info os.FileInfo) time.Time {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		if atime := time.Unix(st.Atimespec.Unix()); atime.After(info.ModTime()) {
+			return atime
+		}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package storage
+
+import (
+	"os"
+	"time"
+)
+
+// accessTime falls back to the modification time, access times are not read on this platform
+func accessTime(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
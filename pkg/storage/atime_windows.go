@@ -0,0 +1,17 @@
+package storage
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// accessTime returns when a file was last read, or its modification time when that is later
+func accessTime(info os.FileInfo) time.Time {
+	if attrs, ok := info.Sys().(*syscall.Win32FileAttributeData); ok {
+		if atime := time.Unix(0, attrs.LastAccessTime.Nanoseconds()); atime.After(info.ModTime()) {
+			return atime
+		}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,234 @@
+package storage
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// backupManifestName is the first entry of every backup
+const backupManifestName = "specular-backup.json"
+
+// BackupOptions controls what a backup contains
+type BackupOptions struct {
+	// Archives includes provider archives and their sidecars, otherwise only metadata is backed up
+	Archives bool
+	// Since only includes files changed after this time, the zero time backs up everything
+	Since time.Time
+}
+
+// BackupManifest describes a backup, it is stored as the first entry of the backup
+type BackupManifest struct {
+	CreatedAt time.Time `json:"created_at"`
+	// Since is set for incremental backups, restore the previous backups first
+	Since    *time.Time `json:"since,omitempty"`
+	Archives bool       `json:"archives"`
+	Files    int        `json:"files"`
+	Bytes    int64      `json:"bytes"`
+}
+
+// Backuper is implemented by storage backends that can write a backup of their content
+type Backuper interface {
+	// Backup writes a backup that Restore can extract and returns its manifest
+	Backup(ctx context.Context, w io.Writer, opts BackupOptions) (BackupManifest, error)
+}
+
+// Backup writes a gzip-compressed tar of the cache directory to w
+// Every file is written atomically by the storage, so each one is backed up whole even while the mirror
+// is serving requests. Temporary files of writes in progress are skipped
+func (fs *FilesystemStorage) Backup(ctx context.Context, w io.Writer, opts BackupOptions) (BackupManifest, error) {
+	manifest := BackupManifest{
+		CreatedAt: time.Now().UTC(),
+		Archives:  opts.Archives,
+	}
+	if !opts.Since.IsZero() {
+		since := opts.Since.UTC()
+		manifest.Since = &since
+	}
+
+	// Collect the files first so the manifest, written first, can describe them
+	var files []backupFile
+	err := fs.walkRoots(func(root, path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".tmp-") {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		internal := strings.HasPrefix(rel, ".specular-internal"+string(filepath.Separator))
+		if !opts.Archives && !internal && !isMetadataFile(path) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if !info.ModTime().After(opts.Since) {
+			return nil
+		}
+		files = append(files, backupFile{root: root, path: path})
+		manifest.Files++
+		manifest.Bytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return manifest, fmt.Errorf("failed to scan cache directory: %w", err)
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return manifest, err
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    backupManifestName,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: manifest.CreatedAt,
+	}); err != nil {
+		return manifest, fmt.Errorf("failed to write backup: %w", err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return manifest, fmt.Errorf("failed to write backup: %w", err)
+	}
+
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return manifest, err
+		}
+		if err := addBackupFile(tw, file.root, file.path); err != nil {
+			return manifest, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return manifest, fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return manifest, fmt.Errorf("failed to write backup: %w", err)
+	}
+	return manifest, nil
+}
+
+// backupFile is a file to back up and the cache root its name is relative to
+type backupFile struct {
+	root string
+	path string
+}
+
+// addBackupFile copies one cache file into the backup
+func addBackupFile(tw *tar.Writer, cacheDir, path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		// Removed since the scan, the manifest totals are an upper bound
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	defer f.Close()
+
+	// Size from the open file, it may have been replaced since the scan
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	rel, _ := filepath.Rel(cacheDir, path)
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    filepath.ToSlash(rel),
+		Mode:    0644,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	if _, err := io.Copy(tw, f); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	return nil
+}
+
+// ReadBackupManifest reads the manifest at the start of a backup
+func ReadBackupManifest(r io.Reader) (BackupManifest, error) {
+	_, manifest, err := openBackup(r)
+	return manifest, err
+}
+
+// openBackup reads the manifest of a backup and returns a reader positioned on the first file
+func openBackup(r io.Reader) (*tar.Reader, BackupManifest, error) {
+	var manifest BackupManifest
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, manifest, fmt.Errorf("invalid backup: %w", err)
+	}
+	tr := tar.NewReader(gz)
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != backupManifestName {
+		return nil, manifest, errors.New("invalid backup: missing manifest")
+	}
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return nil, manifest, fmt.Errorf("invalid backup manifest: %w", err)
+	}
+	return tr, manifest, nil
+}
+
+// Restore extracts a backup written by Backup into the cache directory and returns its manifest
+// Files are replaced atomically, so the mirror can keep serving while a backup is restored
+// Incremental backups are restored on top of the full backup they were taken after
+func (fs *FilesystemStorage) Restore(ctx context.Context, r io.Reader) (BackupManifest, error) {
+	tr, manifest, err := openBackup(r)
+	if err != nil {
+		return manifest, err
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return manifest, err
+		}
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return manifest, nil
+		}
+		if err != nil {
+			return manifest, fmt.Errorf("failed to read backup: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := filepath.FromSlash(hdr.Name)
+		if !filepath.IsLocal(name) {
+			return manifest, fmt.Errorf("invalid backup entry %q", hdr.Name)
+		}
+		// Archives go back to the archive directory they are placed in, which may differ from the backed up one
+		path := filepath.Join(fs.cacheDir, name)
+		if !strings.HasPrefix(name, ".specular-internal"+string(filepath.Separator)) && !isMetadataFile(name) {
+			path = fs.archivePath(name)
+		}
+		err = fs.atomicWrite(path, func(f *os.File) error {
+			_, err := io.Copy(f, tr)
+			return err
+		})
+		if err != nil {
+			return manifest, fmt.Errorf("failed to restore %s: %w", hdr.Name, err)
+		}
+		os.Chtimes(path, hdr.ModTime, hdr.ModTime)
+	}
+}
@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackupRestore(t *testing.T) {
+	ctx := context.Background()
+	src, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	archivePath := "registry.terraform.io/hashicorp/aws/terraform-provider-aws_1.0.0_linux_amd64.zip"
+	mustPut(t, src.PutIndex(ctx, "registry.terraform.io", "hashicorp", "aws", []byte(`{"versions":{}}`)))
+	mustPut(t, src.PutVersionsResponse(ctx, "registry.terraform.io", "hashicorp", "aws", []byte(`{"versions":[]}`)))
+	mustPut(t, src.PutArchive(ctx, archivePath, strings.NewReader("archive data")))
+
+	// Metadata only
+	var metadataOnly bytes.Buffer
+	manifest, err := src.Backup(ctx, &metadataOnly, BackupOptions{})
+	if err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	if manifest.Files != 2 || manifest.Archives || manifest.Since != nil {
+		t.Errorf("unexpected metadata backup manifest %+v", manifest)
+	}
+
+	var full bytes.Buffer
+	manifest, err = src.Backup(ctx, &full, BackupOptions{Archives: true})
+	if err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	// Index, versions response, archive and its checksum and size sidecars
+	if manifest.Files != 5 {
+		t.Errorf("expected 5 files in full backup, got %d", manifest.Files)
+	}
+	if read, err := ReadBackupManifest(bytes.NewReader(full.Bytes())); err != nil || read.Files != manifest.Files {
+		t.Errorf("ReadBackupManifest = %+v, %v", read, err)
+	}
+
+	// Incremental backups only hold files changed since the given time
+	time.Sleep(10 * time.Millisecond)
+	since := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	mustPut(t, src.PutIndex(ctx, "registry.terraform.io", "hashicorp", "random", []byte(`{"versions":{"3.0.0":{}}}`)))
+	var incremental bytes.Buffer
+	manifest, err = src.Backup(ctx, &incremental, BackupOptions{Archives: true, Since: since})
+	if err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	if manifest.Files != 1 || manifest.Since == nil {
+		t.Errorf("unexpected incremental backup manifest %+v", manifest)
+	}
+
+	dst, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	for _, backup := range []*bytes.Buffer{&full, &incremental} {
+		if _, err := dst.Restore(ctx, backup); err != nil {
+			t.Fatalf("Restore failed: %v", err)
+		}
+	}
+
+	if data, err := dst.GetIndex(ctx, "registry.terraform.io", "hashicorp", "random"); err != nil || string(data) != `{"versions":{"3.0.0":{}}}` {
+		t.Errorf("restored incremental index = %q, %v", data, err)
+	}
+	if _, err := dst.GetVersionsResponse(ctx, "registry.terraform.io", "hashicorp", "aws"); err != nil {
+		t.Errorf("expected versions response to be restored: %v", err)
+	}
+	reader, err := dst.GetArchive(ctx, archivePath)
+	if err != nil {
+		t.Fatalf("expected archive to be restored: %v", err)
+	}
+	data, _ := io.ReadAll(reader)
+	reader.Close()
+	if string(data) != "archive data" {
+		t.Errorf("restored archive = %q", data)
+	}
+	if sum, err := dst.ArchiveChecksum(ctx, archivePath); err != nil || sum == "" {
+		t.Errorf("expected archive checksum to be restored, got %q, %v", sum, err)
+	}
+}
+
+func TestRestore_RejectsUnsafePaths(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, entry := range []struct{ name, content string }{
+		{backupManifestName, `{}`},
+		{"../escape.json", `{}`},
+	} {
+		tw.WriteHeader(&tar.Header{Name: entry.name, Mode: 0644, Size: int64(len(entry.content))})
+		tw.Write([]byte(entry.content))
+	}
+	tw.Close()
+	gz.Close()
+
+	dir := t.TempDir()
+	fs, err := NewFilesystemStorage(dir + "/cache")
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	if _, err := fs.Restore(context.Background(), &buf); err == nil {
+		t.Fatal("expected restore to reject a path outside the cache directory")
+	}
+	if _, err := os.Stat(dir + "/escape.json"); !os.IsNotExist(err) {
+		t.Error("file outside the cache directory was written")
+	}
+}
+
+func TestRestore_InvalidBackup(t *testing.T) {
+	fs, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	if _, err := fs.Restore(context.Background(), strings.NewReader("not a backup")); err == nil {
+		t.Fatal("expected error for invalid backup")
+	}
+}
+
+func mustPut(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+}
@@ -0,0 +1,327 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of cached files recorded in the catalog
+const (
+	CatalogIndex            = "index"
+	CatalogVersion          = "version"
+	CatalogVersionsResponse = "versions-response"
+	CatalogArchive          = "archive"
+)
+
+// CatalogEntry describes a cached file as recorded in the catalog
+type CatalogEntry struct {
+	// Path is relative to the cache root, with slashes, and without the compressed suffix
+	Path      string `json:"path"`
+	Kind      string `json:"kind"`
+	Hostname  string `json:"hostname"`
+	Namespace string `json:"namespace"`
+	Type      string `json:"type"`
+	// Version, OS and Arch are set for archives, Version for version metadata
+	Version string `json:"version,omitempty"`
+	OS      string `json:"os,omitempty"`
+	Arch    string `json:"arch,omitempty"`
+	Size    int64  `json:"size"`
+	// Shasum is the hex-encoded SHA-256 of archives with a recorded checksum
+	Shasum     string    `json:"shasum,omitempty"`
+	FetchedAt  time.Time `json:"fetched_at"`
+	LastAccess time.Time `json:"last_access"`
+
+	// file is where the entry is stored on disk
+	file string
+}
+
+// CatalogStats summarizes the contents of the catalog
+type CatalogStats struct {
+	Providers     int   `json:"providers"`
+	Versions      int   `json:"versions"`
+	Archives      int   `json:"archives"`
+	MetadataBytes int64 `json:"metadata_bytes"`
+	ArchiveBytes  int64 `json:"archive_bytes"`
+}
+
+// Cataloger is implemented by storage backends that keep a catalog of their contents
+type Cataloger interface {
+	// CatalogEntries returns every cached file known to the catalog, sorted by path
+	// Returns ErrNotFound if the catalog is not enabled
+	CatalogEntries(ctx context.Context) ([]CatalogEntry, error)
+	// CatalogStats summarizes the catalog
+	// Returns ErrNotFound if the catalog is not enabled
+	CatalogStats(ctx context.Context) (CatalogStats, error)
+}
+
+// catalog indexes the cached files in memory, see BuildCatalog
+type catalog struct {
+	mu      sync.RWMutex
+	enabled bool
+	entries map[string]CatalogEntry
+}
+
+// BuildCatalog enables the catalog and rebuilds it from the files on disk
+// The catalog is updated on every read and write, so listings, statistics and RemoveUnused no longer
+// walk the cache directory. It lives in memory and is rebuilt at startup, so it never drifts from the
+// files on disk. Call it again after changes made outside Specular. Must be called before the storage is used
+func (fs *FilesystemStorage) BuildCatalog(ctx context.Context) (CatalogStats, error) {
+	entries := make(map[string]CatalogEntry)
+	err := fs.walkRoots(func(_, path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		entry, ok := fs.newCatalogEntry(path)
+		if !ok {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		entry.Size = info.Size()
+		entry.FetchedAt = info.ModTime()
+		entry.LastAccess = accessTime(info)
+		if entry.Kind == CatalogArchive {
+			entry.Shasum, _ = readChecksum(path)
+		}
+		entries[entry.Path] = entry
+		return nil
+	})
+	if err != nil {
+		return CatalogStats{}, fmt.Errorf("failed to build catalog: %w", err)
+	}
+
+	fs.catalog.mu.Lock()
+	fs.catalog.enabled = true
+	fs.catalog.entries = entries
+	fs.catalog.mu.Unlock()
+	return fs.CatalogStats(ctx)
+}
+
+// CatalogEntries returns every cached file known to the catalog, sorted by path
+func (fs *FilesystemStorage) CatalogEntries(ctx context.Context) ([]CatalogEntry, error) {
+	fs.catalog.mu.RLock()
+	defer fs.catalog.mu.RUnlock()
+	if !fs.catalog.enabled {
+		return nil, ErrNotFound
+	}
+	entries := make([]CatalogEntry, 0, len(fs.catalog.entries))
+	for _, entry := range fs.catalog.entries {
+		entries = append(entries, entry)
+	}
+	slices.SortFunc(entries, func(a, b CatalogEntry) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	return entries, nil
+}
+
+// CatalogStats summarizes the catalog
+func (fs *FilesystemStorage) CatalogStats(ctx context.Context) (CatalogStats, error) {
+	fs.catalog.mu.RLock()
+	defer fs.catalog.mu.RUnlock()
+	if !fs.catalog.enabled {
+		return CatalogStats{}, ErrNotFound
+	}
+	var stats CatalogStats
+	for _, entry := range fs.catalog.entries {
+		switch entry.Kind {
+		case CatalogIndex:
+			stats.Providers++
+		case CatalogVersion:
+			stats.Versions++
+		case CatalogArchive:
+			stats.Archives++
+			stats.ArchiveBytes += entry.Size
+			continue
+		}
+		stats.MetadataBytes += entry.Size
+	}
+	return stats, nil
+}
+
+// catalogWrite records a file just written at fullPath
+func (fs *FilesystemStorage) catalogWrite(fullPath string, size int64, sum string) {
+	fs.catalog.mu.Lock()
+	defer fs.catalog.mu.Unlock()
+	if !fs.catalog.enabled {
+		return
+	}
+	entry, ok := fs.newCatalogEntry(fullPath)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	entry.Size = size
+	entry.Shasum = sum
+	entry.FetchedAt = now
+	entry.LastAccess = now
+	fs.catalog.entries[entry.Path] = entry
+}
+
+// catalogRead records a read of the file at fullPath
+func (fs *FilesystemStorage) catalogRead(fullPath string) {
+	fs.catalog.mu.Lock()
+	defer fs.catalog.mu.Unlock()
+	if !fs.catalog.enabled {
+		return
+	}
+	key, ok := fs.catalogKey(fullPath)
+	if !ok {
+		return
+	}
+	if entry, ok := fs.catalog.entries[key]; ok {
+		entry.LastAccess = time.Now()
+		fs.catalog.entries[key] = entry
+	}
+}
+
+// catalogRemove forgets the file at fullPath
+func (fs *FilesystemStorage) catalogRemove(fullPath string) {
+	fs.catalog.mu.Lock()
+	defer fs.catalog.mu.Unlock()
+	if !fs.catalog.enabled {
+		return
+	}
+	if key, ok := fs.catalogKey(fullPath); ok {
+		delete(fs.catalog.entries, key)
+	}
+}
+
+// catalogRemoveProvider forgets every file of a provider
+func (fs *FilesystemStorage) catalogRemoveProvider(hostname, namespace, providerType string) {
+	fs.catalog.mu.Lock()
+	defer fs.catalog.mu.Unlock()
+	for key, entry := range fs.catalog.entries {
+		if entry.Hostname == hostname && entry.Namespace == namespace && entry.Type == providerType {
+			delete(fs.catalog.entries, key)
+		}
+	}
+}
+
+// catalogProviders returns the providers with a cached index, or false if the catalog is not enabled
+func (fs *FilesystemStorage) catalogProviders() ([]Provider, bool) {
+	fs.catalog.mu.RLock()
+	defer fs.catalog.mu.RUnlock()
+	if !fs.catalog.enabled {
+		return nil, false
+	}
+	var providers []Provider
+	for _, entry := range fs.catalog.entries {
+		if entry.Kind == CatalogIndex {
+			providers = append(providers, Provider{Hostname: entry.Hostname, Namespace: entry.Namespace, Type: entry.Type})
+		}
+	}
+	return sortProviders(providers), true
+}
+
+// catalogVersions returns the versions of a provider with cached metadata, or false if the catalog is not enabled
+func (fs *FilesystemStorage) catalogVersions(hostname, namespace, providerType string) ([]string, bool) {
+	fs.catalog.mu.RLock()
+	defer fs.catalog.mu.RUnlock()
+	if !fs.catalog.enabled {
+		return nil, false
+	}
+	var versions []string
+	for _, entry := range fs.catalog.entries {
+		if entry.Kind == CatalogVersion && entry.Hostname == hostname && entry.Namespace == namespace && entry.Type == providerType {
+			versions = append(versions, entry.Version)
+		}
+	}
+	return sortVersions(versions), true
+}
+
+// catalogArchive returns the catalog entry of the archive at fullPath, or false if the catalog is not enabled
+// The entry is zero if the archive is not cached
+func (fs *FilesystemStorage) catalogArchive(fullPath string) (CatalogEntry, bool) {
+	fs.catalog.mu.RLock()
+	defer fs.catalog.mu.RUnlock()
+	if !fs.catalog.enabled {
+		return CatalogEntry{}, false
+	}
+	key, _ := fs.catalogKey(fullPath)
+	return fs.catalog.entries[key], true
+}
+
+// catalogUnused returns the files neither written nor read since cutoff, or false if the catalog is not enabled
+func (fs *FilesystemStorage) catalogUnused(cutoff time.Time) ([]string, bool) {
+	fs.catalog.mu.RLock()
+	defer fs.catalog.mu.RUnlock()
+	if !fs.catalog.enabled {
+		return nil, false
+	}
+	var files []string
+	for _, entry := range fs.catalog.entries {
+		if entry.LastAccess.Before(cutoff) {
+			files = append(files, entry.file)
+		}
+	}
+	return files, true
+}
+
+// catalogKey returns the catalog key of the file at fullPath, its path relative to the root holding it
+func (fs *FilesystemStorage) catalogKey(fullPath string) (string, bool) {
+	for _, root := range fs.roots() {
+		rel, err := filepath.Rel(root, fullPath)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		// Sharded archives are keyed by their path in the flat layout
+		return strings.TrimSuffix(filepath.ToSlash(unshardArchivePath(rel)), compressedSuffix), true
+	}
+	return "", false
+}
+
+// newCatalogEntry describes the file at fullPath from its location, without size or times
+// Temporary files, sidecars and files outside the provider mirror layout are not cataloged
+func (fs *FilesystemStorage) newCatalogEntry(fullPath string) (CatalogEntry, bool) {
+	key, ok := fs.catalogKey(fullPath)
+	if !ok {
+		return CatalogEntry{}, false
+	}
+	name := filepath.Base(fullPath)
+	if strings.HasPrefix(name, ".tmp-") || slices.Contains(archiveSidecars, filepath.Ext(name)) {
+		return CatalogEntry{}, false
+	}
+
+	parts := strings.Split(key, "/")
+	if len(parts) == 5 && parts[0] == ".specular-internal" && parts[4] == "versions.json" {
+		return CatalogEntry{Path: key, Kind: CatalogVersionsResponse, Hostname: parts[1], Namespace: parts[2], Type: parts[3], file: fullPath}, true
+	}
+	if len(parts) != 4 || parts[0] == ".specular-internal" {
+		return CatalogEntry{}, false
+	}
+	entry := CatalogEntry{Path: key, Hostname: parts[0], Namespace: parts[1], Type: parts[2], file: fullPath}
+	switch file := parts[3]; {
+	case file == "index.json":
+		entry.Kind = CatalogIndex
+	case strings.HasSuffix(file, ".json"):
+		entry.Kind = CatalogVersion
+		entry.Version = strings.TrimSuffix(file, ".json")
+	default:
+		// Archives are named terraform-provider-TYPE_VERSION_OS_ARCH.zip
+		entry.Kind = CatalogArchive
+		if fields := strings.Split(strings.TrimSuffix(file, filepath.Ext(file)), "_"); len(fields) >= 4 {
+			entry.Version = fields[len(fields)-3]
+			entry.OS = fields[len(fields)-2]
+			entry.Arch = fields[len(fields)-1]
+		}
+	}
+	return entry, true
+}
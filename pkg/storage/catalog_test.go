@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const catalogArchivePath = "registry.terraform.io/hashicorp/aws/terraform-provider-aws_5.0.0_linux_amd64.zip"
+
+func TestBuildCatalog(t *testing.T) {
+	ctx := context.Background()
+	fs, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	fs.PutIndex(ctx, "registry.terraform.io", "hashicorp", "aws", []byte(`{"versions":{"5.0.0":{}}}`))
+	fs.PutVersion(ctx, "registry.terraform.io", "hashicorp", "aws", "5.0.0", []byte(`{"archives":{}}`))
+	fs.PutVersionsResponse(ctx, "registry.terraform.io", "hashicorp", "aws", []byte(`{"versions":[]}`))
+	fs.PutArchive(ctx, catalogArchivePath, strings.NewReader("archive"))
+
+	if _, err := fs.CatalogStats(ctx); !IsNotFound(err) {
+		t.Errorf("expected ErrNotFound before the catalog is built, got %v", err)
+	}
+	stats, err := fs.BuildCatalog(ctx)
+	if err != nil {
+		t.Fatalf("BuildCatalog failed: %v", err)
+	}
+	if stats.Providers != 1 || stats.Versions != 1 || stats.Archives != 1 || stats.ArchiveBytes != 7 || stats.MetadataBytes == 0 {
+		t.Errorf("unexpected catalog stats %+v", stats)
+	}
+
+	entries, err := fs.CatalogEntries(ctx)
+	if err != nil {
+		t.Fatalf("CatalogEntries failed: %v", err)
+	}
+	kinds := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		kinds = append(kinds, entry.Kind)
+	}
+	if want := []string{CatalogVersionsResponse, CatalogVersion, CatalogIndex, CatalogArchive}; !slices.Equal(kinds, want) {
+		t.Fatalf("expected entries of kinds %v, got %v", want, kinds)
+	}
+	archive := entries[3]
+	if archive.Path != catalogArchivePath || archive.Version != "5.0.0" || archive.OS != "linux" || archive.Arch != "amd64" {
+		t.Errorf("unexpected archive entry %+v", archive)
+	}
+	if sum, _ := fs.ArchiveChecksum(ctx, catalogArchivePath); archive.Shasum != sum || sum == "" {
+		t.Errorf("expected shasum %q, got %q", sum, archive.Shasum)
+	}
+}
+
+func TestCatalog_TracksChanges(t *testing.T) {
+	ctx := context.Background()
+	fs, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	fs.SetCompressMetadata(true)
+	if _, err := fs.BuildCatalog(ctx); err != nil {
+		t.Fatalf("BuildCatalog failed: %v", err)
+	}
+
+	fs.PutIndex(ctx, "registry.terraform.io", "hashicorp", "aws", []byte(`{"versions":{}}`))
+	fs.PutVersion(ctx, "registry.terraform.io", "hashicorp", "aws", "5.0.0", []byte(`{"archives":{}}`))
+	fs.PutArchive(ctx, catalogArchivePath, strings.NewReader("archive"))
+	if versions, _ := fs.ListVersions(ctx, "registry.terraform.io", "hashicorp", "aws"); !slices.Equal(versions, []string{"5.0.0"}) {
+		t.Errorf("expected the written version to be listed, got %v", versions)
+	}
+	if info, err := fs.StatArchive(ctx, catalogArchivePath); err != nil || info.Size != 7 {
+		t.Errorf("StatArchive = %+v, %v", info, err)
+	}
+
+	// Files added outside the process are only picked up by a rebuild
+	outside := filepath.Join(fs.cacheDir, "registry.terraform.io", "hashicorp", "google", "index.json")
+	os.MkdirAll(filepath.Dir(outside), 0755)
+	os.WriteFile(outside, []byte(`{"versions":{}}`), 0644)
+	if providers, _ := fs.ListProviders(ctx); len(providers) != 1 {
+		t.Errorf("expected only the cataloged provider, got %v", providers)
+	}
+	if _, err := fs.BuildCatalog(ctx); err != nil {
+		t.Fatalf("BuildCatalog failed: %v", err)
+	}
+	if providers, _ := fs.ListProviders(ctx); len(providers) != 2 {
+		t.Errorf("expected the rebuild to find the added provider, got %v", providers)
+	}
+
+	fs.DeleteArchive(ctx, catalogArchivePath)
+	if _, err := fs.StatArchive(ctx, catalogArchivePath); !IsNotFound(err) {
+		t.Errorf("expected ErrNotFound for the deleted archive, got %v", err)
+	}
+	fs.PurgeProvider(ctx, "registry.terraform.io", "hashicorp", "aws")
+	if stats, _ := fs.CatalogStats(ctx); stats.Providers != 1 || stats.Versions != 0 || stats.Archives != 0 {
+		t.Errorf("expected only the google index to be left, got %+v", stats)
+	}
+}
+
+func TestRemoveUnused_Catalog(t *testing.T) {
+	ctx := context.Background()
+	fs, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+
+	old := time.Now().Add(-48 * time.Hour)
+	for _, name := range []string{"read.zip", "unread.zip"} {
+		if err := putArchiveAt(t, fs, "registry.terraform.io/hashicorp/aws/"+name, 100, old); err != nil {
+			t.Fatalf("failed to store %s: %v", name, err)
+		}
+	}
+	if _, err := fs.BuildCatalog(ctx); err != nil {
+		t.Fatalf("BuildCatalog failed: %v", err)
+	}
+
+	// The catalog records reads without SetTrackAccess
+	rc, err := fs.GetArchive(ctx, "registry.terraform.io/hashicorp/aws/read.zip")
+	if err != nil {
+		t.Fatalf("GetArchive failed: %v", err)
+	}
+	rc.Close()
+
+	expired, err := fs.RemoveUnused(ctx, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("RemoveUnused failed: %v", err)
+	}
+	if expired.Archives != 1 || expired.Bytes < 100 {
+		t.Errorf("unexpected expired entries %+v", expired)
+	}
+	if exists, _ := fs.ExistsArchive(ctx, "registry.terraform.io/hashicorp/aws/unread.zip"); exists {
+		t.Error("expected the unread archive to be removed")
+	}
+	if exists, _ := fs.ExistsArchive(ctx, "registry.terraform.io/hashicorp/aws/read.zip"); !exists {
+		t.Error("expected the read archive to be kept")
+	}
+	if stats, _ := fs.CatalogStats(ctx); stats.Archives != 1 {
+		t.Errorf("expected the removed archive to leave the catalog, got %+v", stats)
+	}
+}
@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// checksumSuffix is appended to an archive path to form its checksum sidecar file
+// Sidecars use the sha256sum format so they can be checked with `sha256sum -c`
+const checksumSuffix = ".sha256"
+
+// ErrChecksumMismatch is returned when a cached archive no longer matches its recorded checksum
+var ErrChecksumMismatch = errors.New("archive checksum mismatch")
+
+// ChecksumReporter is implemented by storage backends that record archive checksums
+type ChecksumReporter interface {
+	// ArchiveChecksum returns the hex-encoded SHA-256 of a cached archive
+	// Returns ErrNotFound if the archive or its checksum is not found
+	ArchiveChecksum(ctx context.Context, path string) (string, error)
+}
+
+// ArchiveVerifier is implemented by storage backends that can check every cached archive for corruption
+type ArchiveVerifier interface {
+	// VerifyArchives checks every cached archive against its recorded checksum and removes corrupted ones
+	// It returns the number of archives checked and removed
+	VerifyArchives(ctx context.Context) (checked, removed int, err error)
+}
+
+// SetVerifyOnRead enables verifying archives against their recorded checksum before serving them
+// Corrupted archives are removed and reported as cache misses so they are fetched again
+// Must be called before the storage is used
+func (fs *FilesystemStorage) SetVerifyOnRead(enabled bool) {
+	fs.verifyOnRead = enabled
+}
+
+// ArchiveChecksum returns the recorded SHA-256 of a cached archive
+func (fs *FilesystemStorage) ArchiveChecksum(ctx context.Context, path string) (string, error) {
+	return readChecksum(fs.archivePath(path))
+}
+
+// VerifyArchives checks every archive with a recorded checksum and removes the corrupted ones
+func (fs *FilesystemStorage) VerifyArchives(ctx context.Context) (checked, removed int, err error) {
+	err = fs.walkRoots(func(_, path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), checksumSuffix) {
+			return nil
+		}
+
+		err = fs.verifyArchive(strings.TrimSuffix(path, checksumSuffix))
+		switch {
+		case errors.Is(err, ErrChecksumMismatch):
+			removed++
+		case errors.Is(err, ErrNotFound):
+			// Removed since the walk started
+			return nil
+		case err != nil:
+			return err
+		}
+		checked++
+		return nil
+	})
+	if err != nil {
+		return checked, removed, fmt.Errorf("failed to verify cache directory: %w", err)
+	}
+	return checked, removed, nil
+}
+
+// verifyArchive compares an archive with its recorded checksum
+// Archives cached before checksums were recorded get their checksum written on first verification,
+// when the cache can be written to, a read-only cache only has nothing to compare them with
+func (fs *FilesystemStorage) verifyArchive(fullPath string) error {
+	hashed, err := os.Stat(fullPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to stat archive: %w", err)
+	}
+	actual, err := fileSHA256(fullPath)
+	if err != nil {
+		return err
+	}
+
+	expected, err := readChecksum(fullPath)
+	if errors.Is(err, ErrNotFound) {
+		if err := writeChecksum(fullPath, actual); err != nil {
+			slog.Debug("failed to record archive checksum", "path", fullPath, "error", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if actual != expected {
+		// The sidecars are written before an archive is replaced, so the old archive may be compared with the
+		// checksum of the new one. It is only corrupted if it is still in place
+		if current, err := os.Stat(fullPath); err != nil || !os.SameFile(current, hashed) {
+			return nil
+		}
+		slog.Error("cached archive is corrupted, removing it",
+			"path", fullPath, "expected_sha256", expected, "actual_sha256", actual)
+		fs.removeArchive(fullPath)
+		return fmt.Errorf("%w: %s", ErrChecksumMismatch, filepath.Base(fullPath))
+	}
+	return nil
+}
+
+// readChecksum reads the checksum sidecar of an archive
+func readChecksum(fullPath string) (string, error) {
+	data, err := os.ReadFile(fullPath + checksumSuffix)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("failed to read checksum: %w", err)
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("empty checksum file for %s", filepath.Base(fullPath))
+	}
+	return fields[0], nil
+}
+
+// writeChecksum atomically writes the checksum sidecar of an archive
+func writeChecksum(fullPath, sum string) error {
+	line := fmt.Sprintf("%s  %s\n", sum, filepath.Base(fullPath))
+	if err := writeSidecar(fullPath+checksumSuffix, line); err != nil {
+		return fmt.Errorf("failed to write checksum: %w", err)
+	}
+	return nil
+}
+
+// writeSidecar atomically replaces a small file next to an archive
+func writeSidecar(path, content string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// fileSHA256 returns the hex-encoded SHA-256 of a file
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to hash archive: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
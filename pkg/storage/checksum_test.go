@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestArchiveChecksum(t *testing.T) {
+	content := []byte("provider archive data")
+	sum := sha256.Sum256(content)
+	want := hex.EncodeToString(sum[:])
+	path := "registry.terraform.io/hashicorp/aws/terraform-provider-aws_1.0.0_linux_amd64.zip"
+
+	fs, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+
+	backends := map[string]interface {
+		Storage
+		ChecksumReporter
+	}{
+		"filesystem": fs,
+		"memory":     NewMemoryStorage(),
+	}
+
+	for name, backend := range backends {
+		t.Run(name, func(t *testing.T) {
+			if _, err := backend.ArchiveChecksum(context.Background(), path); err != ErrNotFound {
+				t.Fatalf("expected ErrNotFound for missing archive, got %v", err)
+			}
+			if err := backend.PutArchive(context.Background(), path, bytes.NewReader(content)); err != nil {
+				t.Fatalf("PutArchive failed: %v", err)
+			}
+			got, err := backend.ArchiveChecksum(context.Background(), path)
+			if err != nil || got != want {
+				t.Errorf("ArchiveChecksum = %q, %v, want %q", got, err, want)
+			}
+		})
+	}
+
+	// The sidecar uses the sha256sum format
+	sidecar, err := os.ReadFile(fs.archivePath(path) + checksumSuffix)
+	if err != nil {
+		t.Fatalf("failed to read checksum sidecar: %v", err)
+	}
+	if string(sidecar) != want+"  terraform-provider-aws_1.0.0_linux_amd64.zip\n" {
+		t.Errorf("unexpected sidecar content %q", sidecar)
+	}
+}
+
+func TestVerifyOnRead(t *testing.T) {
+	fs, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	fs.SetVerifyOnRead(true)
+
+	ctx := context.Background()
+	path := "registry.terraform.io/hashicorp/aws/aws.zip"
+	if err := fs.PutArchive(ctx, path, strings.NewReader("intact")); err != nil {
+		t.Fatalf("PutArchive failed: %v", err)
+	}
+
+	reader, err := fs.GetArchive(ctx, path)
+	if err != nil {
+		t.Fatalf("GetArchive of intact archive failed: %v", err)
+	}
+	reader.Close()
+
+	// Simulate bit-rot
+	if err := os.WriteFile(fs.archivePath(path), []byte("intakt"), 0644); err != nil {
+		t.Fatalf("failed to corrupt archive: %v", err)
+	}
+	if _, err := fs.GetArchive(ctx, path); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected ErrChecksumMismatch, got %v", err)
+	}
+	if exists, _ := fs.ExistsArchive(ctx, path); exists {
+		t.Error("corrupted archive should be removed")
+	}
+	if _, err := os.Stat(fs.archivePath(path) + checksumSuffix); !os.IsNotExist(err) {
+		t.Error("checksum of corrupted archive should be removed")
+	}
+
+	// Archives without a recorded checksum get one on first read
+	legacy := "registry.terraform.io/hashicorp/aws/legacy.zip"
+	if err := os.WriteFile(fs.archivePath(legacy), []byte("legacy"), 0644); err != nil {
+		t.Fatalf("failed to write legacy archive: %v", err)
+	}
+	reader, err = fs.GetArchive(ctx, legacy)
+	if err != nil {
+		t.Fatalf("GetArchive of legacy archive failed: %v", err)
+	}
+	reader.Close()
+	if _, err := fs.ArchiveChecksum(ctx, legacy); err != nil {
+		t.Errorf("expected checksum to be backfilled, got %v", err)
+	}
+}
+
+func TestVerifyOnRead_ReadOnlyCache(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can write to read-only directories")
+	}
+	fs, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	fs.SetVerifyOnRead(true)
+
+	// An archive without a recorded checksum in a cache that cannot be written to is still served
+	path := "registry.terraform.io/hashicorp/aws/legacy.zip"
+	dir := filepath.Dir(fs.archivePath(path))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fs.archivePath(path), []byte("legacy"), 0644); err != nil {
+		t.Fatalf("failed to write legacy archive: %v", err)
+	}
+	if err := os.Chmod(dir, 0555); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(dir, 0755)
+
+	reader, err := fs.GetArchive(context.Background(), path)
+	if err != nil {
+		t.Fatalf("GetArchive failed: %v", err)
+	}
+	reader.Close()
+}
+
+func TestVerifyArchives(t *testing.T) {
+	fs, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+
+	ctx := context.Background()
+	intact := "registry.terraform.io/hashicorp/aws/intact.zip"
+	corrupted := "registry.terraform.io/hashicorp/aws/corrupted.zip"
+	for _, path := range []string{intact, corrupted} {
+		if err := fs.PutArchive(ctx, path, strings.NewReader("archive data")); err != nil {
+			t.Fatalf("PutArchive failed: %v", err)
+		}
+	}
+	if err := os.WriteFile(fs.archivePath(corrupted), []byte("archive dat4"), 0644); err != nil {
+		t.Fatalf("failed to corrupt archive: %v", err)
+	}
+
+	checked, removed, err := fs.VerifyArchives(ctx)
+	if err != nil {
+		t.Fatalf("VerifyArchives failed: %v", err)
+	}
+	if checked != 2 || removed != 1 {
+		t.Errorf("expected 2 checked and 1 removed, got %d and %d", checked, removed)
+	}
+	if exists, _ := fs.ExistsArchive(ctx, corrupted); exists {
+		t.Error("corrupted archive should be removed")
+	}
+	if exists, _ := fs.ExistsArchive(ctx, intact); !exists {
+		t.Error("intact archive should be kept")
+	}
+}
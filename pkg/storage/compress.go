@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// compressedSuffix is appended to metadata files stored gzip-compressed
+const compressedSuffix = ".gz"
+
+// SetCompressMetadata enables storing index and version metadata gzip-compressed
+// Reads transparently handle both compressed and uncompressed files, so the
+// setting can be changed without clearing the cache
+// Must be called before the storage is used
+func (fs *FilesystemStorage) SetCompressMetadata(enabled bool) {
+	fs.compressMetadata = enabled
+}
+
+// readMetadata reads a metadata file, falling back to its compressed form
+func (fs *FilesystemStorage) readMetadata(ctx context.Context, path string) ([]byte, error) {
+	data, err := fs.readFile(ctx, path)
+	if !errors.Is(err, ErrNotFound) {
+		if err == nil {
+			fs.catalogRead(path)
+			if fs.tracksAccess() {
+				touch(path)
+			}
+		}
+		return data, err
+	}
+
+	compressed, err := fs.readFile(ctx, path+compressedSuffix)
+	if err != nil {
+		return nil, err
+	}
+	fs.catalogRead(path)
+	if fs.tracksAccess() {
+		touch(path + compressedSuffix)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress metadata: %w", err)
+	}
+	defer zr.Close()
+	data, err = io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress metadata: %w", err)
+	}
+	return data, nil
+}
+
+// writeMetadata writes a metadata file, compressed if enabled
+// The other form of the file is removed so reads never see stale data
+func (fs *FilesystemStorage) writeMetadata(ctx context.Context, path string, data []byte) error {
+	// The record of the replaced file no longer applies
+	if err := os.Remove(entryInfoPath(path)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove stale entry info: %w", err)
+	}
+	if !fs.compressMetadata {
+		if err := fs.writeFileAtomic(ctx, path, data); err != nil {
+			return err
+		}
+		os.Remove(path + compressedSuffix)
+		fs.catalogWrite(path, int64(len(data)), "")
+		return nil
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return fmt.Errorf("failed to compress metadata: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to compress metadata: %w", err)
+	}
+	if err := fs.writeFileAtomic(ctx, path+compressedSuffix, buf.Bytes()); err != nil {
+		return err
+	}
+	os.Remove(path)
+	fs.catalogWrite(path+compressedSuffix, int64(buf.Len()), "")
+	return nil
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+func TestCompressMetadata(t *testing.T) {
+	fs, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+
+	ctx := context.Background()
+	plain := []byte(`{"versions":{"1.0.0":{}}}`)
+	if err := fs.PutIndex(ctx, "registry.terraform.io", "hashicorp", "aws", plain); err != nil {
+		t.Fatalf("PutIndex failed: %v", err)
+	}
+
+	// Enabling compression replaces the plain file and keeps it readable
+	fs.SetCompressMetadata(true)
+	compressed := []byte(`{"versions":{"1.0.0":{},"2.0.0":{}}}`)
+	if err := fs.PutIndex(ctx, "registry.terraform.io", "hashicorp", "aws", compressed); err != nil {
+		t.Fatalf("PutIndex failed: %v", err)
+	}
+	path := fs.indexPath("registry.terraform.io", "hashicorp", "aws")
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("expected uncompressed index to be removed")
+	}
+	onDisk, err := os.ReadFile(path + compressedSuffix)
+	if err != nil {
+		t.Fatalf("expected compressed index on disk: %v", err)
+	}
+	if string(onDisk) == string(compressed) {
+		t.Error("expected index to be stored compressed")
+	}
+
+	got, err := fs.GetIndex(ctx, "registry.terraform.io", "hashicorp", "aws")
+	if err != nil || string(got) != string(compressed) {
+		t.Errorf("GetIndex = %q, %v, want %q", got, err, compressed)
+	}
+	if modTime, err := fs.IndexModTime(ctx, "registry.terraform.io", "hashicorp", "aws"); err != nil || modTime.IsZero() {
+		t.Errorf("IndexModTime of compressed index = %v, %v", modTime, err)
+	}
+
+	// Disabling it again switches back to plain files
+	fs.SetCompressMetadata(false)
+	if err := fs.PutVersion(ctx, "registry.terraform.io", "hashicorp", "aws", "1.0.0", plain); err != nil {
+		t.Fatalf("PutVersion failed: %v", err)
+	}
+	if err := fs.PutIndex(ctx, "registry.terraform.io", "hashicorp", "aws", plain); err != nil {
+		t.Fatalf("PutIndex failed: %v", err)
+	}
+	if _, err := os.Stat(path + compressedSuffix); !os.IsNotExist(err) {
+		t.Error("expected compressed index to be removed")
+	}
+	got, err = fs.GetIndex(ctx, "registry.terraform.io", "hashicorp", "aws")
+	if err != nil || string(got) != string(plain) {
+		t.Errorf("GetIndex = %q, %v, want %q", got, err, plain)
+	}
+}
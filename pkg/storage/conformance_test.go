@@ -0,0 +1,106 @@
+package storage_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/elisiariocouto/specular/pkg/storage"
+	"github.com/elisiariocouto/specular/pkg/storage/storagetest"
+)
+
+func TestMemoryStorageConformance(t *testing.T) {
+	storagetest.TestStorage(t, func(t *testing.T) storage.Storage {
+		return storage.NewMemoryStorage()
+	})
+}
+
+func TestCappedMemoryStorageConformance(t *testing.T) {
+	storagetest.TestStorage(t, func(t *testing.T) storage.Storage {
+		m := storage.NewMemoryStorage()
+		m.SetMaxBytes(64 << 20)
+		return m
+	})
+}
+
+func TestFilesystemStorageConformance(t *testing.T) {
+	storagetest.TestStorage(t, func(t *testing.T) storage.Storage {
+		fs, err := storage.NewFilesystemStorage(t.TempDir())
+		if err != nil {
+			t.Fatalf("NewFilesystemStorage failed: %v", err)
+		}
+		return fs
+	})
+}
+
+func TestCompressedFilesystemStorageConformance(t *testing.T) {
+	storagetest.TestStorage(t, func(t *testing.T) storage.Storage {
+		fs, err := storage.NewFilesystemStorage(t.TempDir())
+		if err != nil {
+			t.Fatalf("NewFilesystemStorage failed: %v", err)
+		}
+		fs.SetCompressMetadata(true)
+		fs.SetVerifyOnRead(true)
+		return fs
+	})
+}
+
+func TestShardedFilesystemStorageConformance(t *testing.T) {
+	storagetest.TestStorage(t, func(t *testing.T) storage.Storage {
+		fs, err := storage.NewFilesystemStorage(t.TempDir())
+		if err != nil {
+			t.Fatalf("NewFilesystemStorage failed: %v", err)
+		}
+		fs.SetShardArchives(true)
+		if _, err := fs.BuildCatalog(context.Background()); err != nil {
+			t.Fatalf("BuildCatalog failed: %v", err)
+		}
+		return fs
+	})
+}
+
+func TestCatalogFilesystemStorageConformance(t *testing.T) {
+	storagetest.TestStorage(t, func(t *testing.T) storage.Storage {
+		fs, err := storage.NewFilesystemStorage(t.TempDir())
+		if err != nil {
+			t.Fatalf("NewFilesystemStorage failed: %v", err)
+		}
+		if _, err := fs.BuildCatalog(context.Background()); err != nil {
+			t.Fatalf("BuildCatalog failed: %v", err)
+		}
+		return fs
+	})
+}
+
+func TestS3StorageConformance(t *testing.T) {
+	storagetest.TestStorage(t, func(t *testing.T) storage.Storage {
+		return newTestS3Storage(t, newFakeS3(t).URL)
+	})
+}
+
+func TestRedisStorageConformance(t *testing.T) {
+	storagetest.TestStorage(t, func(t *testing.T) storage.Storage {
+		return newTestRedisStorage(t, newFakeRedis(t, ""), storage.NewMemoryStorage())
+	})
+}
+
+func TestReplicatedStorageConformance(t *testing.T) {
+	storagetest.TestStorage(t, func(t *testing.T) storage.Storage {
+		fs, err := storage.NewFilesystemStorage(t.TempDir())
+		if err != nil {
+			t.Fatalf("NewFilesystemStorage failed: %v", err)
+		}
+		return storage.NewReplicated(fs, storage.NewMemoryStorage())
+	})
+}
+
+func TestTieredStorageConformance(t *testing.T) {
+	storagetest.TestStorage(t, func(t *testing.T) storage.Storage {
+		fs, err := storage.NewFilesystemStorage(t.TempDir())
+		if err != nil {
+			t.Fatalf("NewFilesystemStorage failed: %v", err)
+		}
+		tiered := storage.NewTiered(fs, 1<<20)
+		tiered.SetMaxArchiveSize(1 << 10)
+		return tiered
+	})
+}
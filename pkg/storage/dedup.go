@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// DedupMode decides how archives with the same content cached under several paths share storage
+type DedupMode string
+
+const (
+	// DedupOff stores every archive as its own copy
+	DedupOff DedupMode = "off"
+	// DedupHardlink links duplicates to the first copy, they share one inode
+	DedupHardlink DedupMode = "hardlink"
+	// DedupReflink clones duplicates from the first copy, sharing blocks until one is modified
+	// Only supported on Linux filesystems with reflinks, such as Btrfs and XFS, others keep the copy
+	DedupReflink DedupMode = "reflink"
+)
+
+// dedupIndex maps archive checksums to a cached archive with that content
+type dedupIndex struct {
+	mu     sync.Mutex
+	loaded bool
+	paths  map[string]string
+}
+
+// SetDedup enables sharing storage between archives with the same content, such as the archives
+// of a provider cached under aliased hostnames. Must be called before the storage is used
+func (fs *FilesystemStorage) SetDedup(mode DedupMode) {
+	fs.dedup = mode
+}
+
+// dedupArchive replaces the archive just written at fullPath by a link or clone of an archive
+// with the same checksum, and otherwise remembers it for later duplicates
+// Failures only cost the space of the copy, so they are logged and not returned
+func (fs *FilesystemStorage) dedupArchive(fullPath, sum string, size int64) {
+	if fs.dedup == "" || fs.dedup == DedupOff {
+		return
+	}
+
+	fs.dedupIndex.mu.Lock()
+	defer fs.dedupIndex.mu.Unlock()
+	if !fs.dedupIndex.loaded {
+		fs.loadDedupIndex(fullPath)
+	}
+
+	original, ok := fs.dedupIndex.paths[sum]
+	if !ok || original == fullPath || !sameArchive(original, sum, size) {
+		fs.dedupIndex.paths[sum] = fullPath
+		return
+	}
+
+	var err error
+	if fs.dedup == DedupReflink {
+		err = replaceWithClone(original, fullPath)
+	} else {
+		err = replaceWithLink(original, fullPath)
+	}
+	if err != nil {
+		slog.Debug("failed to deduplicate archive, keeping the copy",
+			"path", fullPath, "original", original, "mode", fs.dedup, "error", err)
+		return
+	}
+	if fs.dedup == DedupHardlink {
+		// A clone is a file of its own as far as the quota can tell, only a link frees the copy
+		fs.uncountBytes(size)
+	}
+	slog.Debug("deduplicated archive", "path", fullPath, "original", original, "mode", fs.dedup, "bytes", size)
+}
+
+// loadDedupIndex records the checksum of every archive already cached except skip, the one just written
+// Must be called with dedupIndex.mu held
+func (fs *FilesystemStorage) loadDedupIndex(skip string) {
+	fs.dedupIndex.paths = make(map[string]string)
+	err := fs.walkRoots(func(_, path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), checksumSuffix) {
+			return nil
+		}
+		archive := strings.TrimSuffix(path, checksumSuffix)
+		if archive == skip {
+			return nil
+		}
+		if sum, err := readChecksum(archive); err == nil {
+			if _, ok := fs.dedupIndex.paths[sum]; !ok {
+				fs.dedupIndex.paths[sum] = archive
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Warn("failed to scan cache for duplicate archives", "error", err)
+	}
+	fs.dedupIndex.loaded = true
+}
+
+// sameArchive reports whether the archive at path is still cached with the given checksum and size
+func sameArchive(path, sum string, size int64) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.Size() != size {
+		return false
+	}
+	recorded, err := readChecksum(path)
+	return err == nil && recorded == sum
+}
+
+// replaceWithLink atomically replaces path by a hard link to original
+func replaceWithLink(original, path string) error {
+	tmp := filepath.Join(filepath.Dir(path), fmt.Sprintf(".tmp-link-%s", filepath.Base(path)))
+	os.Remove(tmp)
+	if err := os.Link(original, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// replaceWithClone atomically replaces path by a reflink clone of original
+func replaceWithClone(original, path string) error {
+	src, err := os.Open(original)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if err := cloneFile(tmp, src); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+// sameFile reports whether two archives share one inode
+func sameFile(t *testing.T, fs *FilesystemStorage, a, b string) bool {
+	t.Helper()
+	infoA, err := os.Stat(fs.archivePath(a))
+	if err != nil {
+		t.Fatalf("stat %s failed: %v", a, err)
+	}
+	infoB, err := os.Stat(fs.archivePath(b))
+	if err != nil {
+		t.Fatalf("stat %s failed: %v", b, err)
+	}
+	return os.SameFile(infoA, infoB)
+}
+
+func TestDedup_Hardlink(t *testing.T) {
+	dir := t.TempDir()
+	fs, err := NewFilesystemStorage(dir)
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	fs.SetDedup(DedupHardlink)
+	ctx := context.Background()
+
+	original := "registry.terraform.io/hashicorp/aws/terraform-provider-aws_1.0.0_linux_amd64.zip"
+	alias := "registry.opentofu.org/hashicorp/aws/terraform-provider-aws_1.0.0_linux_amd64.zip"
+	other := "registry.terraform.io/hashicorp/aws/terraform-provider-aws_1.0.0_darwin_arm64.zip"
+	for path, data := range map[string]string{original: "archive data", other: "other data"} {
+		if err := fs.PutArchive(ctx, path, strings.NewReader(data)); err != nil {
+			t.Fatalf("PutArchive failed: %v", err)
+		}
+	}
+	if err := fs.PutArchive(ctx, alias, strings.NewReader("archive data")); err != nil {
+		t.Fatalf("PutArchive failed: %v", err)
+	}
+
+	if !sameFile(t, fs, original, alias) {
+		t.Errorf("archive cached under an aliased hostname was not linked to the original")
+	}
+	if sameFile(t, fs, original, other) {
+		t.Errorf("archives with different content were linked")
+	}
+	if sum, err := fs.ArchiveChecksum(ctx, alias); err != nil || sum == "" {
+		t.Errorf("ArchiveChecksum = %q, %v, want the recorded checksum", sum, err)
+	}
+
+	// Replacing one copy leaves the other untouched
+	if err := fs.PutArchive(ctx, original, strings.NewReader("new data")); err != nil {
+		t.Fatalf("PutArchive failed: %v", err)
+	}
+	if data, err := os.ReadFile(fs.archivePath(alias)); err != nil || string(data) != "archive data" {
+		t.Errorf("alias = %q, %v, want %q", data, err, "archive data")
+	}
+
+	// Archives cached by an earlier process are found too
+	restarted, err := NewFilesystemStorage(dir)
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	restarted.SetDedup(DedupHardlink)
+	third := "mirror.example.com/hashicorp/aws/terraform-provider-aws_1.0.0_linux_amd64.zip"
+	if err := restarted.PutArchive(ctx, third, strings.NewReader("archive data")); err != nil {
+		t.Fatalf("PutArchive failed: %v", err)
+	}
+	if !sameFile(t, restarted, alias, third) {
+		t.Errorf("archive was not linked to one cached before a restart")
+	}
+}
+
+func TestDedup_Off(t *testing.T) {
+	fs, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	ctx := context.Background()
+
+	for _, path := range []string{"registry.terraform.io/hashicorp/aws/a.zip", "registry.opentofu.org/hashicorp/aws/a.zip"} {
+		if err := fs.PutArchive(ctx, path, strings.NewReader("archive data")); err != nil {
+			t.Fatalf("PutArchive failed: %v", err)
+		}
+	}
+	if sameFile(t, fs, "registry.terraform.io/hashicorp/aws/a.zip", "registry.opentofu.org/hashicorp/aws/a.zip") {
+		t.Errorf("archives were linked with deduplication off")
+	}
+}
+
+func TestDedup_ReflinkFallsBackToCopy(t *testing.T) {
+	fs, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	fs.SetDedup(DedupReflink)
+	ctx := context.Background()
+
+	// Whether or not the test filesystem supports reflinks, both archives must stay readable
+	for _, path := range []string{"registry.terraform.io/hashicorp/aws/a.zip", "registry.opentofu.org/hashicorp/aws/a.zip"} {
+		if err := fs.PutArchive(ctx, path, strings.NewReader("archive data")); err != nil {
+			t.Fatalf("PutArchive failed: %v", err)
+		}
+		if data, err := os.ReadFile(fs.archivePath(path)); err != nil || string(data) != "archive data" {
+			t.Errorf("%s = %q, %v, want %q", path, data, err, "archive data")
+		}
+	}
+	if sameFile(t, fs, "registry.terraform.io/hashicorp/aws/a.zip", "registry.opentofu.org/hashicorp/aws/a.zip") {
+		t.Errorf("reflinked archives must not share an inode")
+	}
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DeleteIndex removes the cached index.json and versions API response of a provider
+func (fs *FilesystemStorage) DeleteIndex(ctx context.Context, hostname, namespace, providerType string) error {
+	if err := validateProviderPath(hostname, namespace, providerType); err != nil {
+		return err
+	}
+	if err := fs.removeMetadata(fs.indexPath(hostname, namespace, providerType)); err != nil {
+		return err
+	}
+	return fs.removeMetadata(fs.versionsResponsePath(hostname, namespace, providerType))
+}
+
+// DeleteVersion removes the cached version.json for a specific provider version
+func (fs *FilesystemStorage) DeleteVersion(ctx context.Context, hostname, namespace, providerType, version string) error {
+	if err := validateProviderPath(hostname, namespace, providerType); err != nil {
+		return err
+	}
+	if version == "" {
+		return errors.New("version cannot be empty")
+	}
+	return fs.removeMetadata(fs.versionPath(hostname, namespace, providerType, version))
+}
+
+// DeleteArchive removes a cached provider archive and its sidecar files
+func (fs *FilesystemStorage) DeleteArchive(ctx context.Context, path string) error {
+	if path == "" {
+		return errors.New("archive path cannot be empty")
+	}
+	fullPath := fs.archivePath(path)
+	unlock, err := fs.lockArchive(ctx, fullPath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	fs.uncountArchive(fullPath)
+	if err := os.Remove(fullPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete archive: %w", err)
+	}
+	for _, suffix := range archiveSidecars {
+		os.Remove(fullPath + suffix)
+	}
+	fs.catalogRemove(fullPath)
+	return nil
+}
+
+// PurgeProvider removes the provider's directory from the cache and every archive directory
+func (fs *FilesystemStorage) PurgeProvider(ctx context.Context, hostname, namespace, providerType string) error {
+	if err := validateProviderPath(hostname, namespace, providerType); err != nil {
+		return err
+	}
+	dirs := []string{filepath.Dir(fs.versionsResponsePath(hostname, namespace, providerType))}
+	for _, root := range fs.roots() {
+		dirs = append(dirs, filepath.Join(root, hostname, namespace, providerType))
+	}
+	for _, dir := range dirs {
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("failed to purge provider: %w", err)
+		}
+	}
+	fs.catalogRemoveProvider(hostname, namespace, providerType)
+	return nil
+}
+
+// removeMetadata removes a metadata file, compressed or not
+func (fs *FilesystemStorage) removeMetadata(path string) error {
+	fs.catalogRemove(path)
+	for _, p := range []string{path, path + compressedSuffix, entryInfoPath(path)} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to delete metadata: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFilesystemStorage_PurgeProvider(t *testing.T) {
+	ctx := context.Background()
+	cacheDir := t.TempDir()
+	fs, err := NewFilesystemStorage(cacheDir)
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	archiveDirs := []string{t.TempDir(), t.TempDir()}
+	if err := fs.SetArchiveDirs(archiveDirs); err != nil {
+		t.Fatalf("SetArchiveDirs failed: %v", err)
+	}
+	fs.SetCompressMetadata(true)
+
+	fs.PutIndex(ctx, "registry.terraform.io", "hashicorp", "aws", []byte(`{"versions":{}}`))
+	fs.PutVersionsResponse(ctx, "registry.terraform.io", "hashicorp", "aws", []byte(`{}`))
+	for _, name := range []string{"a.zip", "b.zip", "c.zip", "d.zip"} {
+		if err := fs.PutArchive(ctx, "registry.terraform.io/hashicorp/aws/"+name, strings.NewReader(name)); err != nil {
+			t.Fatalf("PutArchive failed: %v", err)
+		}
+	}
+
+	if err := fs.PurgeProvider(ctx, "registry.terraform.io", "hashicorp", "aws"); err != nil {
+		t.Fatalf("PurgeProvider failed: %v", err)
+	}
+	for _, dir := range append(archiveDirs, cacheDir, filepath.Join(cacheDir, ".specular-internal")) {
+		if _, err := os.Stat(filepath.Join(dir, "registry.terraform.io", "hashicorp", "aws")); !os.IsNotExist(err) {
+			t.Errorf("expected the provider directory to be removed from %s, got %v", dir, err)
+		}
+	}
+
+	for _, component := range []string{"..", "."} {
+		if err := fs.PurgeProvider(ctx, "registry.terraform.io", component, "aws"); err == nil {
+			t.Errorf("expected %q to be rejected", component)
+		}
+	}
+	if _, err := os.Stat(cacheDir); err != nil {
+		t.Errorf("expected the cache directory to be kept, got %v", err)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build linux || darwin || freebsd
+
+package storage
+
+import "golang.org/x/sys/unix"
+
+// diskUsage returns the capacity and usage of the filesystem holding path
+// Free space is what unprivileged users can still allocate
+func diskUsage(path string) (DiskUsage, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return DiskUsage{}, err
+	}
+	bsize := int64(st.Bsize)
+	return DiskUsage{
+		TotalBytes: int64(st.Blocks) * bsize,
+		UsedBytes:  int64(st.Blocks-st.Bfree) * bsize,
+		FreeBytes:  int64(st.Bavail) * bsize,
+	}, nil
+}
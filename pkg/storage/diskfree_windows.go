@@ -0,0 +1,23 @@
+//go:build windows
+
+package storage
+
+import "golang.org/x/sys/windows"
+
+// diskUsage returns the capacity and usage of the volume holding path
+// Free space is what the current user can still allocate
+func diskUsage(path string) (DiskUsage, error) {
+	dir, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return DiskUsage{}, err
+	}
+	var available, total, free uint64
+	if err := windows.GetDiskFreeSpaceEx(dir, &available, &total, &free); err != nil {
+		return DiskUsage{}, err
+	}
+	return DiskUsage{
+		TotalBytes: int64(total),
+		UsedBytes:  int64(total - free),
+		FreeBytes:  int64(available),
+	}, nil
+}
@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// metaSuffix is appended to a cached file's name to store its EntryInfo record
+const metaSuffix = ".meta"
+
+// EntryInfo is the record kept with a cached index, version or archive
+type EntryInfo struct {
+	// FetchedAt is when the entry was fetched from upstream
+	FetchedAt time.Time `json:"fetched_at"`
+	// ETag and LastModified are the validators upstream sent with the entry, empty if it sent none
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Size         int64  `json:"size"`
+	// Shasum is the hex-encoded SHA-256 of the entry as cached
+	Shasum string `json:"shasum,omitempty"`
+	// RegistryShasum is the SHA-256 the registry published for an archive, empty if it is unknown
+	RegistryShasum string `json:"registry_shasum,omitempty"`
+}
+
+// EntryInfoStore is implemented by storage backends keeping an EntryInfo record with cached entries
+// Entries are named by IndexEntry and VersionEntry, archives by their archive path
+// Replacing or deleting an entry drops its record
+type EntryInfoStore interface {
+	// EntryInfo returns the record of a cached entry
+	// Returns ErrNotFound if the entry is not cached or has no record
+	EntryInfo(ctx context.Context, entry string) (EntryInfo, error)
+	// PutEntryInfo records info for a cached entry, the size and SHA-256 of archives are filled in when not set
+	// Returns ErrNotFound if the entry is not cached
+	PutEntryInfo(ctx context.Context, entry string, info EntryInfo) error
+}
+
+// IndexEntry names the index.json of a provider in an EntryInfoStore
+func IndexEntry(hostname, namespace, providerType string) string {
+	return hostname + "/" + namespace + "/" + providerType + "/index.json"
+}
+
+// VersionEntry names the version.json of a provider version in an EntryInfoStore
+func VersionEntry(hostname, namespace, providerType, version string) string {
+	return hostname + "/" + namespace + "/" + providerType + "/" + version + ".json"
+}
+
+// parseEntry splits an entry name into the kind of entry, one of the catalog kinds, and its provider and version
+func parseEntry(entry string) (kind, hostname, namespace, providerType, version string) {
+	parts := strings.Split(entry, "/")
+	if len(parts) == 4 {
+		if parts[3] == "index.json" {
+			return CatalogIndex, parts[0], parts[1], parts[2], ""
+		}
+		if v, ok := strings.CutSuffix(parts[3], ".json"); ok {
+			return CatalogVersion, parts[0], parts[1], parts[2], v
+		}
+	}
+	return CatalogArchive, "", "", "", ""
+}
+
+// entryFile returns where an entry is stored and whether it is an archive
+func (fs *FilesystemStorage) entryFile(entry string) (string, bool, error) {
+	kind, hostname, namespace, providerType, version := parseEntry(entry)
+	switch kind {
+	case CatalogIndex:
+		if err := validateProviderPath(hostname, namespace, providerType); err != nil {
+			return "", false, err
+		}
+		return fs.indexPath(hostname, namespace, providerType), false, nil
+	case CatalogVersion:
+		if err := validateProviderPath(hostname, namespace, providerType); err != nil {
+			return "", false, err
+		}
+		return fs.versionPath(hostname, namespace, providerType, version), false, nil
+	default:
+		if entry == "" {
+			return "", false, errors.New("archive path cannot be empty")
+		}
+		return fs.archivePath(entry), true, nil
+	}
+}
+
+// entryInfoPath returns where the record of the cached file at path is stored, compressed or not
+func entryInfoPath(path string) string {
+	return strings.TrimSuffix(path, compressedSuffix) + metaSuffix
+}
+
+// EntryInfo returns the record of a cached entry
+func (fs *FilesystemStorage) EntryInfo(ctx context.Context, entry string) (EntryInfo, error) {
+	path, archive, err := fs.entryFile(entry)
+	if err != nil {
+		return EntryInfo{}, err
+	}
+	if err := fs.entryExists(path, archive); err != nil {
+		return EntryInfo{}, err
+	}
+	data, err := os.ReadFile(entryInfoPath(path))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return EntryInfo{}, ErrNotFound
+		}
+		return EntryInfo{}, fmt.Errorf("failed to read entry info: %w", err)
+	}
+	var info EntryInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return EntryInfo{}, fmt.Errorf("invalid entry info for %s: %w", entry, err)
+	}
+	return info, nil
+}
+
+// PutEntryInfo records info for a cached entry next to it
+func (fs *FilesystemStorage) PutEntryInfo(ctx context.Context, entry string, info EntryInfo) error {
+	path, archive, err := fs.entryFile(entry)
+	if err != nil {
+		return err
+	}
+	if err := fs.entryExists(path, archive); err != nil {
+		return err
+	}
+	if archive {
+		if info.Size == 0 {
+			info.Size, _ = readSize(path)
+		}
+		if info.Shasum == "" {
+			info.Shasum, _ = readChecksum(path)
+		}
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	if err := writeSidecar(entryInfoPath(path), string(data)); err != nil {
+		return fmt.Errorf("failed to write entry info: %w", err)
+	}
+	return nil
+}
+
+// entryExists returns ErrNotFound if the entry stored at path is not cached
+func (fs *FilesystemStorage) entryExists(path string, archive bool) error {
+	if archive {
+		_, err := fileModTime(path)
+		return err
+	}
+	_, err := fs.metadataModTime(path)
+	return err
+}
+
+// EntryInfo returns the record of a stored entry
+func (m *MemoryStorage) EntryInfo(ctx context.Context, entry string) (EntryInfo, error) {
+	data, err := m.get(entryInfoKey(m.entryKey(entry)))
+	if err != nil {
+		return EntryInfo{}, err
+	}
+	var info EntryInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return EntryInfo{}, fmt.Errorf("invalid entry info for %s: %w", entry, err)
+	}
+	return info, nil
+}
+
+// PutEntryInfo records info for a stored entry
+func (m *MemoryStorage) PutEntryInfo(ctx context.Context, entry string, info EntryInfo) error {
+	key := m.entryKey(entry)
+	if _, err := m.modTime(key); err != nil {
+		return err
+	}
+	if kind, _, _, _, _ := parseEntry(entry); kind == CatalogArchive {
+		m.mu.RLock()
+		size := int64(len(m.archives[entry]))
+		m.mu.RUnlock()
+		if info.Size == 0 {
+			info.Size = size
+		}
+		if info.Shasum == "" {
+			info.Shasum, _ = m.ArchiveChecksum(ctx, entry)
+		}
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return m.put(entryInfoKey(key), data)
+}
+
+// entryKey returns the key an entry is stored under
+func (m *MemoryStorage) entryKey(entry string) string {
+	switch kind, hostname, namespace, providerType, version := parseEntry(entry); kind {
+	case CatalogIndex:
+		return indexKey(hostname, namespace, providerType)
+	case CatalogVersion:
+		return versionKey(hostname, namespace, providerType, version)
+	default:
+		return archiveKey(entry)
+	}
+}
+
+func entryInfoKey(key string) string {
+	return "entry:" + key
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestEntryInfo(t *testing.T) {
+	fs, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	compressed, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	compressed.SetCompressMetadata(true)
+
+	for name, s := range map[string]interface {
+		Storage
+		EntryInfoStore
+	}{"filesystem": fs, "compressed": compressed, "memory": NewMemoryStorage()} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			index := IndexEntry("registry.terraform.io", "hashicorp", "aws")
+			const archive = "registry.terraform.io/hashicorp/aws/terraform-provider-aws_5.0.0_linux_amd64.zip"
+
+			if err := s.PutEntryInfo(ctx, index, EntryInfo{FetchedAt: time.Now()}); !IsNotFound(err) {
+				t.Errorf("expected ErrNotFound recording an entry that is not cached, got %v", err)
+			}
+
+			s.PutIndex(ctx, "registry.terraform.io", "hashicorp", "aws", []byte(`{"versions":{}}`))
+			want := EntryInfo{FetchedAt: time.Now().UTC().Truncate(time.Second), ETag: `"abc"`, Size: 15, Shasum: "1234"}
+			if err := s.PutEntryInfo(ctx, index, want); err != nil {
+				t.Fatalf("PutEntryInfo failed: %v", err)
+			}
+			if got, err := s.EntryInfo(ctx, index); err != nil || got != want {
+				t.Errorf("EntryInfo = %+v, %v, want %+v", got, err, want)
+			}
+			if _, err := s.EntryInfo(ctx, VersionEntry("registry.terraform.io", "hashicorp", "aws", "5.0.0")); !IsNotFound(err) {
+				t.Errorf("expected ErrNotFound for an entry without a record, got %v", err)
+			}
+
+			// Replacing the entry drops its record
+			s.PutIndex(ctx, "registry.terraform.io", "hashicorp", "aws", []byte(`{"versions":{"5.0.0":{}}}`))
+			if _, err := s.EntryInfo(ctx, index); !IsNotFound(err) {
+				t.Errorf("expected the record to be dropped with the replaced index, got %v", err)
+			}
+
+			// The size and checksum of archives are filled in
+			s.PutArchive(ctx, archive, strings.NewReader("zip"))
+			if err := s.PutEntryInfo(ctx, archive, EntryInfo{FetchedAt: time.Now(), LastModified: "Mon, 02 Jan 2006 15:04:05 GMT"}); err != nil {
+				t.Fatalf("PutEntryInfo failed: %v", err)
+			}
+			got, err := s.EntryInfo(ctx, archive)
+			if err != nil || got.Size != 3 || got.Shasum == "" || got.LastModified != "Mon, 02 Jan 2006 15:04:05 GMT" {
+				t.Errorf("EntryInfo = %+v, %v", got, err)
+			}
+			if err := s.DeleteArchive(ctx, archive); err != nil {
+				t.Fatalf("DeleteArchive failed: %v", err)
+			}
+			if _, err := s.EntryInfo(ctx, archive); !IsNotFound(err) {
+				t.Errorf("expected the record to be deleted with the archive, got %v", err)
+			}
+		})
+	}
+}
+
+func TestPutArchive_FailedWriteKeepsEntryInfo(t *testing.T) {
+	fs, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	ctx := context.Background()
+	const archive = "registry.terraform.io/hashicorp/aws/terraform-provider-aws_5.0.0_linux_amd64.zip"
+
+	fs.PutArchive(ctx, archive, strings.NewReader("zip"))
+	want := EntryInfo{FetchedAt: time.Now().UTC().Truncate(time.Second), RegistryShasum: "abcd"}
+	if err := fs.PutEntryInfo(ctx, archive, want); err != nil {
+		t.Fatalf("PutEntryInfo failed: %v", err)
+	}
+
+	// The archive in place is still the one recorded
+	if err := fs.PutArchive(ctx, archive, iotest.ErrReader(errors.New("connection reset"))); err == nil {
+		t.Fatal("expected PutArchive to fail")
+	}
+	if got, err := fs.EntryInfo(ctx, archive); err != nil || got.RegistryShasum != want.RegistryShasum {
+		t.Errorf("EntryInfo = %+v, %v, want the record kept", got, err)
+	}
+
+	if err := fs.PutArchive(ctx, archive, strings.NewReader("new zip")); err != nil {
+		t.Fatalf("PutArchive failed: %v", err)
+	}
+	if _, err := fs.EntryInfo(ctx, archive); !IsNotFound(err) {
+		t.Errorf("expected the record to be dropped with the replaced archive, got %v", err)
+	}
+}
@@ -0,0 +1,491 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+// FilesystemStorage implements Storage using the local filesystem
+type FilesystemStorage struct {
+	cacheDir string
+
+	// archiveDirs holds archives sharded by hash when set, see SetArchiveDirs
+	archiveDirs []string
+
+	// shardArchives stores archives in hashed subdirectories of their provider, see SetShardArchives
+	shardArchives bool
+
+	// Namespace and cache-wide quotas, see SetNamespaceQuotas and SetQuota
+	quotaMu          sync.Mutex
+	quotas           map[string]int64
+	quota            int64
+	quotaPolicy      QuotaPolicy
+	cacheQuotaPolicy QuotaPolicy
+	// cacheUsage is the running usage of the cache quota, recounted from disk when cacheUsageCounted is too old
+	cacheUsage        int64
+	cacheUsageCounted time.Time
+
+	// trackAccess records reads in access times for RemoveUnused, see SetTrackAccess
+	trackAccess bool
+
+	// verifyOnRead checks archives against their checksum before serving them
+	verifyOnRead bool
+
+	// compressMetadata stores index and version files gzip-compressed
+	compressMetadata bool
+
+	// dedup shares storage between archives with the same content, see SetDedup
+	dedup      DedupMode
+	dedupIndex dedupIndex
+
+	// catalog indexes cached files for listings and expiry without walking the cache, see BuildCatalog
+	catalog catalog
+
+	// lockTTL enables lock files around archive writes for caches shared by several instances, see SetSharedLocks
+	lockTTL time.Duration
+}
+
+// NewFilesystemStorage creates a new filesystem storage backend
+func NewFilesystemStorage(cacheDir string) (*FilesystemStorage, error) {
+	// Ensure cache directory exists
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	return &FilesystemStorage{
+		cacheDir: cacheDir,
+	}, nil
+}
+
+// GetIndex retrieves the cached index.json for a provider
+func (fs *FilesystemStorage) GetIndex(ctx context.Context, hostname, namespace, providerType string) ([]byte, error) {
+	if err := validateProviderPath(hostname, namespace, providerType); err != nil {
+		return nil, err
+	}
+	path := fs.indexPath(hostname, namespace, providerType)
+	return fs.readMetadata(ctx, path)
+}
+
+// PutIndex stores the index.json for a provider
+func (fs *FilesystemStorage) PutIndex(ctx context.Context, hostname, namespace, providerType string, data []byte) error {
+	if err := validateProviderPath(hostname, namespace, providerType); err != nil {
+		return err
+	}
+	path := fs.indexPath(hostname, namespace, providerType)
+	return fs.writeMetadata(ctx, path, data)
+}
+
+// GetVersion retrieves the cached version.json for a specific provider version
+func (fs *FilesystemStorage) GetVersion(ctx context.Context, hostname, namespace, providerType, version string) ([]byte, error) {
+	if err := validateProviderPath(hostname, namespace, providerType); err != nil {
+		return nil, err
+	}
+	if version == "" {
+		return nil, errors.New("version cannot be empty")
+	}
+	path := fs.versionPath(hostname, namespace, providerType, version)
+	return fs.readMetadata(ctx, path)
+}
+
+// PutVersion stores the version.json for a specific provider version
+func (fs *FilesystemStorage) PutVersion(ctx context.Context, hostname, namespace, providerType, version string, data []byte) error {
+	if err := validateProviderPath(hostname, namespace, providerType); err != nil {
+		return err
+	}
+	if version == "" {
+		return errors.New("version cannot be empty")
+	}
+	path := fs.versionPath(hostname, namespace, providerType, version)
+	return fs.writeMetadata(ctx, path, data)
+}
+
+// GetArchive retrieves a cached provider archive
+func (fs *FilesystemStorage) GetArchive(ctx context.Context, path string) (io.ReadCloser, error) {
+	fullPath := fs.archivePath(path)
+	if err := fs.checkArchiveSize(fullPath); err != nil {
+		return nil, err
+	}
+	if fs.verifyOnRead {
+		if err := fs.verifyArchive(fullPath); err != nil {
+			return nil, err
+		}
+	}
+	file, err := os.Open(fullPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	fs.catalogRead(fullPath)
+	if fs.tracksAccess() {
+		touch(fullPath)
+	}
+	return file, nil
+}
+
+// PutArchive stores a provider archive
+func (fs *FilesystemStorage) PutArchive(ctx context.Context, path string, data io.Reader) error {
+	if path == "" {
+		return errors.New("archive path cannot be empty")
+	}
+	fullPath := fs.archivePath(path)
+	hash := sha256.New()
+	var size int64
+	writeFunc := func(f *os.File) error {
+		n, err := io.Copy(io.MultiWriter(f, hash), data)
+		size = n
+		return err
+	}
+
+	var check func(size int64) error
+	if dir, limit, ok := fs.quotaFor(path); ok || fs.quota > 0 {
+		check = func(size int64) error {
+			if ok {
+				if err := fs.enforceQuota(dir, limit, size, fullPath, fs.quotaPolicy); err != nil {
+					return err
+				}
+			}
+			if fs.quota > 0 {
+				return fs.enforceQuota("", fs.quota, size, fullPath, fs.cacheQuotaPolicy)
+			}
+			return nil
+		}
+	}
+	// Another instance sharing the cache may be writing the same archive, the lock is taken once the
+	// download is complete and held until the sidecars match the archive
+	unlock := func() {}
+	defer func() { unlock() }()
+	lock := func() error {
+		release, err := fs.lockArchive(ctx, fullPath)
+		if err != nil {
+			return err
+		}
+		unlock = release
+		return nil
+	}
+	// Record the size and checksum next to the archive so truncation and corruption can be detected later
+	// They are written before the archive is moved into place, so a concurrent read never compares the new
+	// archive with the checksum of the old one and removes it as corrupted
+	var sum string
+	finish := func() error {
+		// Hashes recorded for the replaced archive no longer apply
+		if err := os.Remove(fullPath + hashesSuffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove stale hashes: %w", err)
+		}
+		if err := writeSize(fullPath, size); err != nil {
+			return err
+		}
+		sum = hex.EncodeToString(hash.Sum(nil))
+		return writeChecksum(fullPath, sum)
+	}
+	if err := fs.atomicWriteChecked(fullPath, writeFunc, lock, check, finish); err != nil {
+		return err
+	}
+	// The record of the replaced archive no longer applies, it is kept when the write fails
+	if err := os.Remove(fullPath + metaSuffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove stale entry info: %w", err)
+	}
+	fs.dedupArchive(fullPath, sum, size)
+	fs.catalogWrite(fullPath, size, sum)
+	return nil
+}
+
+// ExistsArchive checks if an archive exists
+func (fs *FilesystemStorage) ExistsArchive(ctx context.Context, path string) (bool, error) {
+	fullPath := fs.archivePath(path)
+	_, err := os.Stat(fullPath)
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return false, err
+}
+
+// FreeSpace returns the bytes available to unprivileged users on the cache directory's filesystem
+// With several archive directories it is the lowest free space of any of them
+func (fs *FilesystemStorage) FreeSpace(ctx context.Context) (int64, error) {
+	usage, err := fs.rootsUsage()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get free space: %w", err)
+	}
+	return usage.FreeBytes, nil
+}
+
+// DiskUsage returns the capacity and usage of the cache directory's filesystem
+// With several archive directories the capacity and usage of their filesystems are added up
+func (fs *FilesystemStorage) DiskUsage(ctx context.Context) (DiskUsage, error) {
+	usage, err := fs.rootsUsage()
+	if err != nil {
+		return DiskUsage{}, fmt.Errorf("failed to get disk usage: %w", err)
+	}
+	return usage, nil
+}
+
+// IndexModTime returns when the index.json for a provider was written
+func (fs *FilesystemStorage) IndexModTime(ctx context.Context, hostname, namespace, providerType string) (time.Time, error) {
+	if err := validateProviderPath(hostname, namespace, providerType); err != nil {
+		return time.Time{}, err
+	}
+	return fs.metadataModTime(fs.indexPath(hostname, namespace, providerType))
+}
+
+// VersionModTime returns when the version.json for a provider version was written
+func (fs *FilesystemStorage) VersionModTime(ctx context.Context, hostname, namespace, providerType, version string) (time.Time, error) {
+	if err := validateProviderPath(hostname, namespace, providerType); err != nil {
+		return time.Time{}, err
+	}
+	if version == "" {
+		return time.Time{}, errors.New("version cannot be empty")
+	}
+	return fs.metadataModTime(fs.versionPath(hostname, namespace, providerType, version))
+}
+
+// ArchiveModTime returns when a provider archive was written
+func (fs *FilesystemStorage) ArchiveModTime(ctx context.Context, path string) (time.Time, error) {
+	return fileModTime(fs.archivePath(path))
+}
+
+// GetVersionsResponse retrieves the cached full versions API response
+func (fs *FilesystemStorage) GetVersionsResponse(ctx context.Context, hostname, namespace, providerType string) ([]byte, error) {
+	path := fs.versionsResponsePath(hostname, namespace, providerType)
+	return fs.readMetadata(ctx, path)
+}
+
+// PutVersionsResponse stores the full versions API response
+func (fs *FilesystemStorage) PutVersionsResponse(ctx context.Context, hostname, namespace, providerType string, data []byte) error {
+	path := fs.versionsResponsePath(hostname, namespace, providerType)
+	return fs.writeMetadata(ctx, path, data)
+}
+
+// Helper methods
+
+// indexPath constructs the filesystem path for an index.json file
+// Matches terraform providers mirror structure: hostname/namespace/type/index.json
+func (fs *FilesystemStorage) indexPath(hostname, namespace, providerType string) string {
+	return filepath.Join(
+		fs.cacheDir,
+		hostname,
+		namespace,
+		providerType,
+		"index.json",
+	)
+}
+
+// versionPath constructs the filesystem path for a version.json file
+// Matches terraform providers mirror structure: hostname/namespace/type/VERSION.json
+func (fs *FilesystemStorage) versionPath(hostname, namespace, providerType, version string) string {
+	return filepath.Join(
+		fs.cacheDir,
+		hostname,
+		namespace,
+		providerType,
+		fmt.Sprintf("%s.json", version),
+	)
+}
+
+// versionsResponsePath constructs the filesystem path for the full versions API response
+// Stored in internal cache: .specular-internal/hostname/namespace/type/versions.json
+func (fs *FilesystemStorage) versionsResponsePath(hostname, namespace, providerType string) string {
+	return filepath.Join(
+		fs.cacheDir,
+		".specular-internal",
+		hostname,
+		namespace,
+		providerType,
+		"versions.json",
+	)
+}
+
+// archivePath constructs the filesystem path for an archive file
+// Archives are stored alongside metadata: hostname/namespace/type/archives/...
+// or under one of the archive directories when SetArchiveDirs was called,
+// in hashed subdirectories when SetShardArchives was called
+func (fs *FilesystemStorage) archivePath(path string) string {
+	// Sanitize path to prevent directory traversal attacks
+	sanitized := filepath.Clean(path)
+	if strings.Contains(sanitized, "..") {
+		sanitized = strings.ReplaceAll(sanitized, "..", "")
+	}
+	sanitized = strings.TrimPrefix(sanitized, "/")
+
+	// Paths read from a sharded cache, such as backup entries, are located like any other
+	return fs.locateArchive(unshardArchivePath(sanitized))
+}
+
+// metadataModTime returns the modification time of a metadata file, compressed or not
+func (fs *FilesystemStorage) metadataModTime(path string) (time.Time, error) {
+	t, err := fileModTime(path)
+	if errors.Is(err, ErrNotFound) {
+		return fileModTime(path + compressedSuffix)
+	}
+	return t, err
+}
+
+// fileModTime returns the modification time of a file, or ErrNotFound if it does not exist
+func fileModTime(path string) (time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return time.Time{}, ErrNotFound
+		}
+		return time.Time{}, fmt.Errorf("failed to stat file: %w", err)
+	}
+	return info.ModTime(), nil
+}
+
+// readFile reads a file from disk, respecting context cancellation
+func (fs *FilesystemStorage) readFile(ctx context.Context, path string) ([]byte, error) {
+	// Check for context cancellation
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	// Ensure path is within cache directory
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve path: %w", err)
+	}
+
+	absCacheDir, err := filepath.Abs(fs.cacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve cache directory: %w", err)
+	}
+
+	if !strings.HasPrefix(absPath, absCacheDir) {
+		return nil, errors.New("path is outside cache directory")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	return data, nil
+}
+
+// atomicWrite is a helper that writes to a file atomically using a temporary file and rename
+// The writeFunc should write data to the provided file and return an error if writing fails
+func (fs *FilesystemStorage) atomicWrite(path string, writeFunc func(*os.File) error) error {
+	return fs.atomicWriteChecked(path, writeFunc, nil, nil, nil)
+}
+
+// atomicWriteChecked is like atomicWrite, but when check is set it is called with the
+// written size before the file is moved into place. A check error discards the write, a quota
+// rejection hands it over in a QuotaExceededError.
+// Checks are serialized so concurrent writes cannot both pass a quota check.
+// When lock is set it is called once the data is written and before the check, outside the
+// serialization, so waiting for another instance does not hold up the other writes of this one.
+// When finish is set it is called right before the file is moved into place, an error discards the write
+func (fs *FilesystemStorage) atomicWriteChecked(path string, writeFunc func(*os.File) error, lock func() error, check func(size int64) error, finish func() error) error {
+	// Create directory if it doesn't exist
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	// Write to temporary file first, then rename (atomic)
+	tmpFile, err := os.CreateTemp(dir, ".tmp-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpPath := tmpFile.Name()
+
+	if err := writeFunc(tmpFile); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpPath) // Clean up temp file on write error
+		return fmt.Errorf("failed to write data: %w", err)
+	}
+
+	// Flush to disk so a crash after the rename cannot leave a truncated file in place
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to sync temporary file: %w", err)
+	}
+
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpPath) // Clean up temp file on close error
+		return fmt.Errorf("failed to close temporary file: %w", err)
+	}
+
+	if lock != nil {
+		if err := lock(); err != nil {
+			os.Remove(tmpPath)
+			return err
+		}
+	}
+
+	if check != nil {
+		info, err := os.Stat(tmpPath)
+		if err != nil {
+			os.Remove(tmpPath)
+			return fmt.Errorf("failed to stat temporary file: %w", err)
+		}
+
+		fs.quotaMu.Lock()
+		defer fs.quotaMu.Unlock()
+
+		if err := check(info.Size()); err != nil {
+			return rejectArchive(tmpPath, err)
+		}
+	}
+
+	if finish != nil {
+		if err := finish(); err != nil {
+			os.Remove(tmpPath)
+			return err
+		}
+	}
+
+	// Atomically move temp file to final location
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath) // Clean up temp file on rename error
+		return fmt.Errorf("failed to finalize write: %w", err)
+	}
+
+	return nil
+}
+
+// writeFileAtomic writes a file atomically using a temporary file
+func (fs *FilesystemStorage) writeFileAtomic(ctx context.Context, path string, data []byte) error {
+	return fs.atomicWrite(path, func(f *os.File) error {
+		_, err := f.Write(data)
+		return err
+	})
+}
+
+// validateProviderPath checks that provider path components are valid
+func validateProviderPath(hostname, namespace, providerType string) error {
+	if hostname == "" || namespace == "" || providerType == "" {
+		return errors.New("hostname, namespace, and providerType cannot be empty")
+	}
+	// Reject paths with suspicious characters that could cause issues
+	for _, component := range []string{hostname, namespace, providerType} {
+		if slices.Contains([]rune(component), '/') || slices.Contains([]rune(component), '\\') {
+			return fmt.Errorf("invalid character in path component: %s", component)
+		}
+		if component == "." || component == ".." {
+			return fmt.Errorf("invalid path component: %s", component)
+		}
+	}
+	return nil
+}
@@ -58,8 +58,8 @@ func TestGetIndex_NotFound(t *testing.T) {
 	ctx := context.Background()
 
 	_, err := fs.GetIndex(ctx, "registry.terraform.io", "hashicorp", "aws")
-	if err != io.EOF {
-		t.Errorf("GetIndex() error = %v, want io.EOF", err)
+	if err != ErrNotFound {
+		t.Errorf("GetIndex() error = %v, want ErrNotFound", err)
 	}
 }
 
@@ -96,8 +96,8 @@ func TestGetVersion_NotFound(t *testing.T) {
 	ctx := context.Background()
 
 	_, err := fs.GetVersion(ctx, "registry.terraform.io", "hashicorp", "aws", "1.0.0")
-	if err != io.EOF {
-		t.Errorf("GetVersion() error = %v, want io.EOF", err)
+	if err != ErrNotFound {
+		t.Errorf("GetVersion() error = %v, want ErrNotFound", err)
 	}
 }
 
@@ -190,8 +190,8 @@ func TestGetArchive_NotFound(t *testing.T) {
 	ctx := context.Background()
 
 	_, err := fs.GetArchive(ctx, "nonexistent/file.zip")
-	if err != io.EOF {
-		t.Errorf("GetArchive() error = %v, want io.EOF", err)
+	if err != ErrNotFound {
+		t.Errorf("GetArchive() error = %v, want ErrNotFound", err)
 	}
 }
 
@@ -446,3 +446,39 @@ func TestLargeArchive(t *testing.T) {
 		t.Errorf("archive size mismatch: got %d, want %d", len(got), len(largeData))
 	}
 }
+
+func TestFreeSpace(t *testing.T) {
+	fs, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+
+	free, err := fs.FreeSpace(context.Background())
+	if err != nil {
+		t.Fatalf("FreeSpace failed: %v", err)
+	}
+	if free <= 0 {
+		t.Errorf("expected positive free space, got %d", free)
+	}
+}
+
+func TestDiskUsage(t *testing.T) {
+	fs, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+
+	usage, err := fs.DiskUsage(context.Background())
+	if err != nil {
+		t.Fatalf("DiskUsage failed: %v", err)
+	}
+	if usage.TotalBytes <= 0 || usage.FreeBytes <= 0 {
+		t.Errorf("expected positive capacity and free space, got %+v", usage)
+	}
+	if usage.UsedBytes+usage.FreeBytes > usage.TotalBytes {
+		t.Errorf("used and free bytes exceed capacity: %+v", usage)
+	}
+	if pct := usage.FreePercent(); pct <= 0 || pct > 100 {
+		t.Errorf("expected free percent in (0, 100], got %v", pct)
+	}
+}
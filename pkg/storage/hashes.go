@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// hashesSuffix is appended to an archive path to form the sidecar holding its lock file hashes
+const hashesSuffix = ".hashes"
+
+// HashRecorder is implemented by storage backends that can keep the lock file hashes of archives
+// Recorded hashes are dropped when the archive is replaced
+type HashRecorder interface {
+	// ArchiveHashes returns the hashes recorded for a cached archive
+	// Returns ErrNotFound if no hashes are recorded
+	ArchiveHashes(ctx context.Context, path string) ([]string, error)
+
+	// PutArchiveHashes records the hashes of a cached archive
+	PutArchiveHashes(ctx context.Context, path string, hashes []string) error
+}
+
+// ArchiveHashes returns the hashes recorded next to a cached archive
+func (fs *FilesystemStorage) ArchiveHashes(ctx context.Context, path string) ([]string, error) {
+	data, err := os.ReadFile(fs.archivePath(path) + hashesSuffix)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to read hashes: %w", err)
+	}
+	return strings.Fields(string(data)), nil
+}
+
+// PutArchiveHashes records the hashes of a cached archive in a sidecar file, one per line
+func (fs *FilesystemStorage) PutArchiveHashes(ctx context.Context, path string, hashes []string) error {
+	fullPath := fs.archivePath(path)
+	if _, err := os.Stat(fullPath); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ErrNotFound
+		}
+		return err
+	}
+	if err := writeSidecar(fullPath+hashesSuffix, strings.Join(hashes, "\n")+"\n"); err != nil {
+		return fmt.Errorf("failed to write hashes: %w", err)
+	}
+	return nil
+}
+
+// ArchiveHashes returns the hashes recorded for a cached archive
+func (m *MemoryStorage) ArchiveHashes(ctx context.Context, path string) ([]string, error) {
+	data, err := m.get(hashesKey(path))
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(data)), nil
+}
+
+// PutArchiveHashes records the hashes of a cached archive
+func (m *MemoryStorage) PutArchiveHashes(ctx context.Context, path string, hashes []string) error {
+	if exists, _ := m.ExistsArchive(ctx, path); !exists {
+		return ErrNotFound
+	}
+	return m.put(hashesKey(path), []byte(strings.Join(hashes, "\n")))
+}
+
+func hashesKey(path string) string {
+	return "hashes:" + path
+}
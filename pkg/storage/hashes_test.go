@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestArchiveHashes(t *testing.T) {
+	fs, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	for name, store := range map[string]interface {
+		Storage
+		HashRecorder
+	}{"filesystem": fs, "memory": NewMemoryStorage()} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			path := "registry.terraform.io/hashicorp/aws/terraform-provider-aws_1.0.0_linux_amd64.zip"
+			hashes := []string{"h1:abc=", "zh:def"}
+
+			if err := store.PutArchiveHashes(ctx, path, hashes); !errors.Is(err, ErrNotFound) {
+				t.Errorf("PutArchiveHashes without archive = %v, want ErrNotFound", err)
+			}
+			if err := store.PutArchive(ctx, path, strings.NewReader("archive data")); err != nil {
+				t.Fatalf("PutArchive failed: %v", err)
+			}
+			if _, err := store.ArchiveHashes(ctx, path); !errors.Is(err, ErrNotFound) {
+				t.Errorf("ArchiveHashes before recording = %v, want ErrNotFound", err)
+			}
+			if err := store.PutArchiveHashes(ctx, path, hashes); err != nil {
+				t.Fatalf("PutArchiveHashes failed: %v", err)
+			}
+			if got, err := store.ArchiveHashes(ctx, path); err != nil || !slices.Equal(got, hashes) {
+				t.Errorf("ArchiveHashes = %v, %v, want %v", got, err, hashes)
+			}
+
+			// Replacing the archive drops its hashes
+			if err := store.PutArchive(ctx, path, strings.NewReader("new archive data")); err != nil {
+				t.Fatalf("PutArchive failed: %v", err)
+			}
+			if _, err := store.ArchiveHashes(ctx, path); !errors.Is(err, ErrNotFound) {
+				t.Errorf("ArchiveHashes after replacing = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// HealthCheck writes, syncs and removes a small file in the cache directory and every archive directory
+// Probe files are named like interrupted writes, so one left behind by a crash is purged at startup
+func (fs *FilesystemStorage) HealthCheck(ctx context.Context) error {
+	for _, root := range fs.roots() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := probeDir(root); err != nil {
+			return fmt.Errorf("cache directory %s is not writable: %w", root, err)
+		}
+	}
+	return nil
+}
+
+// probeDir checks a file can be written to dir
+func probeDir(dir string) error {
+	f, err := os.CreateTemp(dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write([]byte{0}); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// HealthCheck checks the bucket is reachable with the configured credentials
+func (s *S3Storage) HealthCheck(ctx context.Context) error {
+	resp, err := s.send(ctx, http.MethodHead, s.bucketURL(), nil, emptyPayloadHash, nil)
+	if err != nil {
+		if IsNotFound(err) {
+			return fmt.Errorf("S3 bucket %s does not exist", s.bucket)
+		}
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// HealthCheck checks Redis is reachable, then the archive backend if it can be checked
+func (s *RedisStorage) HealthCheck(ctx context.Context) error {
+	if err := s.Ping(ctx); err != nil {
+		return fmt.Errorf("redis is not reachable: %w", err)
+	}
+	if checker, ok := As[HealthChecker](s.archives); ok {
+		return checker.HealthCheck(ctx)
+	}
+	return nil
+}
+
+// HealthCheck lists the cached providers, since the backend's own check may expect to write
+func (r *ReadOnly) HealthCheck(ctx context.Context) error {
+	_, err := r.backend.ListProviders(ctx)
+	return err
+}
@@ -0,0 +1,115 @@
+package storage_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+func TestFilesystemStorage_HealthCheck(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	fs, err := storage.NewFilesystemStorage(dir)
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	archives := filepath.Join(t.TempDir(), "disk1")
+	if err := fs.SetArchiveDirs([]string{archives}); err != nil {
+		t.Fatalf("SetArchiveDirs failed: %v", err)
+	}
+
+	if err := fs.HealthCheck(ctx); err != nil {
+		t.Fatalf("HealthCheck failed: %v", err)
+	}
+	for _, root := range []string{dir, archives} {
+		if entries, _ := os.ReadDir(root); len(entries) != 0 {
+			t.Errorf("expected the probe file to be removed from %s, found %d entries", root, len(entries))
+		}
+	}
+
+	// A lost archive disk fails the check
+	os.RemoveAll(archives)
+	if err := fs.HealthCheck(ctx); err == nil || !strings.Contains(err.Error(), archives) {
+		t.Errorf("expected the missing archive directory to fail the check, got %v", err)
+	}
+}
+
+func TestS3Storage_HealthCheck(t *testing.T) {
+	ctx := context.Background()
+	server := newFakeS3(t)
+	if err := newTestS3Storage(t, server.URL).HealthCheck(ctx); err != nil {
+		t.Errorf("HealthCheck failed: %v", err)
+	}
+
+	missing, err := storage.NewS3Storage(storage.S3Config{
+		Endpoint:        server.URL,
+		Region:          "us-east-1",
+		Bucket:          "missing",
+		AccessKeyID:     "test",
+		SecretAccessKey: "secret",
+		PathStyle:       true,
+	})
+	if err != nil {
+		t.Fatalf("NewS3Storage failed: %v", err)
+	}
+	if err := missing.HealthCheck(ctx); err == nil || storage.IsNotFound(err) {
+		t.Errorf("expected a missing bucket to fail the check, got %v", err)
+	}
+
+	denied, err := storage.NewS3Storage(storage.S3Config{
+		Endpoint:        server.URL,
+		Region:          "us-east-1",
+		Bucket:          "cache",
+		AccessKeyID:     "revoked",
+		SecretAccessKey: "secret",
+		PathStyle:       true,
+	})
+	if err != nil {
+		t.Fatalf("NewS3Storage failed: %v", err)
+	}
+	if err := denied.HealthCheck(ctx); err == nil {
+		t.Error("expected lost credentials to fail the check")
+	}
+}
+
+func TestRedisStorage_HealthCheck(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	archives, err := storage.NewFilesystemStorage(dir)
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	s := newTestRedisStorage(t, newFakeRedis(t, ""), archives)
+	if err := s.HealthCheck(ctx); err != nil {
+		t.Fatalf("HealthCheck failed: %v", err)
+	}
+
+	// The archive backend is checked too
+	os.RemoveAll(dir)
+	if err := s.HealthCheck(ctx); err == nil {
+		t.Error("expected the unwritable archive backend to fail the check")
+	}
+}
+
+func TestReadOnly_HealthCheck(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	fs, err := storage.NewFilesystemStorage(dir)
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	checker, ok := storage.As[storage.HealthChecker](storage.NewReadOnly(fs))
+	if !ok {
+		t.Fatal("expected ReadOnly to implement HealthChecker")
+	}
+	if err := checker.HealthCheck(ctx); err != nil {
+		t.Errorf("HealthCheck failed: %v", err)
+	}
+	if _, ok := storage.As[storage.HealthChecker](storage.NewMemoryStorage()); ok {
+		t.Error("expected memory storage not to implement HealthChecker")
+	}
+}
@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Provider identifies a provider with a cached index
+type Provider struct {
+	Hostname  string `json:"hostname"`
+	Namespace string `json:"namespace"`
+	Type      string `json:"type"`
+}
+
+// ListProviders returns every provider with a cached index.json, sorted
+func (fs *FilesystemStorage) ListProviders(ctx context.Context) ([]Provider, error) {
+	if providers, ok := fs.catalogProviders(); ok {
+		return providers, nil
+	}
+	var providers []Provider
+	err := filepath.WalkDir(fs.cacheDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(fs.cacheDir, path)
+		depth := strings.Count(rel, string(filepath.Separator))
+		if d.IsDir() {
+			// Providers live exactly three levels down, internal files are not listed
+			if d.Name() == ".specular-internal" || depth >= 3 {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if depth != 3 || (d.Name() != "index.json" && d.Name() != "index.json"+compressedSuffix) {
+			return nil
+		}
+		parts := strings.Split(rel, string(filepath.Separator))
+		providers = append(providers, Provider{Hostname: parts[0], Namespace: parts[1], Type: parts[2]})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sortProviders(providers), nil
+}
+
+// ListProviders returns every provider with a cached index.json, sorted
+func (m *MemoryStorage) ListProviders(ctx context.Context) ([]Provider, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var providers []Provider
+	for key := range m.data {
+		rest, ok := strings.CutPrefix(key, "index:")
+		if !ok {
+			continue
+		}
+		parts := strings.SplitN(rest, ":", 3)
+		providers = append(providers, Provider{Hostname: parts[0], Namespace: parts[1], Type: parts[2]})
+	}
+	return sortProviders(providers), nil
+}
+
+// ListVersions returns the versions of a provider with a cached version.json, sorted by name
+func (fs *FilesystemStorage) ListVersions(ctx context.Context, hostname, namespace, providerType string) ([]string, error) {
+	if err := validateProviderPath(hostname, namespace, providerType); err != nil {
+		return nil, err
+	}
+	if versions, ok := fs.catalogVersions(hostname, namespace, providerType); ok {
+		return versions, nil
+	}
+	entries, err := os.ReadDir(filepath.Dir(fs.indexPath(hostname, namespace, providerType)))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list versions: %w", err)
+	}
+	var versions []string
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), compressedSuffix)
+		if version, ok := strings.CutSuffix(name, ".json"); ok && !entry.IsDir() && version != "index" {
+			versions = append(versions, version)
+		}
+	}
+	return sortVersions(versions), nil
+}
+
+// StatArchive returns the size and modification time of a cached archive
+func (fs *FilesystemStorage) StatArchive(ctx context.Context, path string) (ArchiveInfo, error) {
+	fullPath := fs.archivePath(path)
+	if entry, ok := fs.catalogArchive(fullPath); ok {
+		if entry.Kind != CatalogArchive {
+			return ArchiveInfo{}, ErrNotFound
+		}
+		return ArchiveInfo{Size: entry.Size, ModTime: entry.FetchedAt}, nil
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ArchiveInfo{}, ErrNotFound
+		}
+		return ArchiveInfo{}, fmt.Errorf("failed to stat archive: %w", err)
+	}
+	return ArchiveInfo{Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// ListVersions returns the versions of a provider with a stored version.json, sorted by name
+func (m *MemoryStorage) ListVersions(ctx context.Context, hostname, namespace, providerType string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	prefix := versionKey(hostname, namespace, providerType, "")
+	var versions []string
+	for key := range m.data {
+		if version, ok := strings.CutPrefix(key, prefix); ok {
+			versions = append(versions, version)
+		}
+	}
+	return sortVersions(versions), nil
+}
+
+// StatArchive returns the size and modification time of a stored archive
+func (m *MemoryStorage) StatArchive(ctx context.Context, path string) (ArchiveInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	data, ok := m.archives[path]
+	if !ok {
+		return ArchiveInfo{}, ErrNotFound
+	}
+	return ArchiveInfo{Size: int64(len(data)), ModTime: m.modTimes[archiveKey(path)]}, nil
+}
+
+// sortVersions sorts versions and drops duplicates, which happen when both a plain and compressed file exist
+func sortVersions(versions []string) []string {
+	slices.Sort(versions)
+	return slices.Compact(versions)
+}
+
+// sortProviders sorts providers and drops duplicates, which happen when both a plain and compressed index exist
+func sortProviders(providers []Provider) []Provider {
+	sort.Slice(providers, func(i, j int) bool {
+		a, b := providers[i], providers[j]
+		if a.Hostname != b.Hostname {
+			return a.Hostname < b.Hostname
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Type < b.Type
+	})
+	deduped := providers[:0]
+	for i, p := range providers {
+		if i == 0 || p != providers[i-1] {
+			deduped = append(deduped, p)
+		}
+	}
+	return deduped
+}
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// lockPrefix starts the name of the lock file of an archive, which sits next to it
+// It is a temporary file name so cache walks skip it and garbage collection removes abandoned ones
+const lockPrefix = ".tmp-lock-"
+
+// lockPollInterval is how often a held lock is checked while waiting for it
+const lockPollInterval = 50 * time.Millisecond
+
+// SetSharedLocks makes archive writes and deletes take a lock file, so several instances can share
+// one cache directory on NFS or EFS without interleaving the archive and its sidecars. The lock is held
+// from moving the archive into place until its sidecars are written, not while it is downloaded, and is
+// refreshed while held. A lock not refreshed for ttl is considered abandoned by a crashed instance and taken
+// over. Startup also stops purging temporary files other instances may still be writing. Zero disables locking.
+// Must be called before the storage is used
+func (fs *FilesystemStorage) SetSharedLocks(ttl time.Duration) {
+	fs.lockTTL = ttl
+}
+
+// lockArchive takes the lock of an archive, waiting while another writer holds it
+// The returned function releases it. Without shared locks it does nothing
+func (fs *FilesystemStorage) lockArchive(ctx context.Context, fullPath string) (func(), error) {
+	if fs.lockTTL <= 0 {
+		return func() {}, nil
+	}
+	path := filepath.Join(filepath.Dir(fullPath), lockPrefix+filepath.Base(fullPath))
+	owner, err := lockOwner()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = f.WriteString(owner)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(path)
+				return nil, fmt.Errorf("failed to write lock file: %w", err)
+			}
+			return fs.holdLock(path, owner), nil
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			// Nothing is stored in a directory that does not exist, so there is nothing to lock
+			return func() {}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to create lock file: %w", err)
+		}
+
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > fs.lockTTL {
+			if fs.breakLock(path, info) {
+				continue
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for archive lock: %w", ctx.Err())
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// breakLock removes the abandoned lock file at path, stale is what it looked like when it was found abandoned
+// Breaking is itself guarded by a lock file, and the lock is checked again under it, so two instances finding
+// the same abandoned lock cannot remove the lock one of them has just taken. It reports whether the lock
+// is worth trying again, false while another instance is breaking it
+func (fs *FilesystemStorage) breakLock(path string, stale os.FileInfo) bool {
+	breaker := path + ".break"
+	f, err := os.OpenFile(breaker, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		// Breaking takes an instant, a breaker this old was left by an instance that crashed while breaking
+		if info, err := os.Stat(breaker); err == nil && time.Since(info.ModTime()) > fs.lockTTL {
+			os.Remove(breaker)
+		}
+		return false
+	}
+	f.Close()
+	defer os.Remove(breaker)
+
+	current, err := os.Stat(path)
+	if err != nil {
+		return errors.Is(err, os.ErrNotExist)
+	}
+	// A lock taken or refreshed in the meantime is no longer abandoned
+	if !os.SameFile(current, stale) || !current.ModTime().Equal(stale.ModTime()) {
+		return true
+	}
+	holder, _ := os.ReadFile(path)
+	slog.Warn("taking over abandoned archive lock", "path", path, "owner", string(holder), "age", time.Since(current.ModTime()))
+	os.Remove(path)
+	return true
+}
+
+// holdLock refreshes the lock file at path until the returned function releases it
+// A lock taken over by another instance in the meantime is left to its new owner
+func (fs *FilesystemStorage) holdLock(path, owner string) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(fs.lockTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				now := time.Now()
+				os.Chtimes(path, now, now)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		if holder, err := os.ReadFile(path); err == nil && string(holder) == owner {
+			os.Remove(path)
+		}
+	}
+}
+
+// lockOwner identifies a lock holder in its lock file, the hostname and process ID tell whose lock it is
+// and the random token tells locks of the same process apart
+func lockOwner() (string, error) {
+	token := make([]byte, 8)
+	if _, err := rand.Read(token); err != nil {
+		return "", fmt.Errorf("failed to generate lock token: %w", err)
+	}
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s %d %s", hostname, os.Getpid(), hex.EncodeToString(token)), nil
+}
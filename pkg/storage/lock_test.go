@@ -0,0 +1,241 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newSharedStorage(t *testing.T, dir string) *FilesystemStorage {
+	t.Helper()
+	fs, err := NewFilesystemStorage(dir)
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	fs.SetSharedLocks(time.Minute)
+	return fs
+}
+
+func TestSharedLocks_SerializeWritesAcrossInstances(t *testing.T) {
+	dir := t.TempDir()
+	first, second := newSharedStorage(t, dir), newSharedStorage(t, dir)
+	ctx := context.Background()
+	path := "registry.terraform.io/hashicorp/aws/aws.zip"
+	fullPath := first.archivePath(path)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second instance waits while the first holds the lock
+	unlock, err := first.lockArchive(ctx, fullPath)
+	if err != nil {
+		t.Fatalf("lockArchive failed: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- second.PutArchive(ctx, path, strings.NewReader("archive from second"))
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("expected the write to wait for the lock, it returned %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+	if _, err := os.Stat(fullPath); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected the archive not to be moved into place while locked, got %v", err)
+	}
+	unlock()
+	if err := <-done; err != nil {
+		t.Fatalf("PutArchive failed: %v", err)
+	}
+
+	// Archive and sidecars match, and the lock is gone
+	rc, err := first.GetArchive(ctx, path)
+	if err != nil {
+		t.Fatalf("GetArchive failed: %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "archive from second" {
+		t.Errorf("unexpected archive content %q", data)
+	}
+	if err := first.verifyArchive(fullPath); err != nil {
+		t.Errorf("expected the checksum to match the archive: %v", err)
+	}
+	lockPath := filepath.Join(filepath.Dir(fullPath), lockPrefix+filepath.Base(fullPath))
+	if _, err := os.Stat(lockPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the lock file to be removed, got %v", err)
+	}
+
+	if err := second.DeleteArchive(ctx, path); err != nil {
+		t.Fatalf("DeleteArchive failed: %v", err)
+	}
+	if _, err := os.Stat(lockPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the lock file to be removed after a delete, got %v", err)
+	}
+}
+
+func TestSharedLocks_AbandonedLock(t *testing.T) {
+	fs := newSharedStorage(t, t.TempDir())
+	ctx := context.Background()
+	path := "registry.terraform.io/hashicorp/aws/aws.zip"
+	fullPath := fs.archivePath(path)
+	lockPath := filepath.Join(filepath.Dir(fullPath), lockPrefix+filepath.Base(fullPath))
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(lockPath, []byte("crashed 1 token"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A lock refreshed within the TTL is waited for until the context ends
+	waitCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if err := fs.PutArchive(waitCtx, path, strings.NewReader("archive")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the write to give up waiting, got %v", err)
+	}
+
+	// One not refreshed for the TTL is taken over
+	old := time.Now().Add(-2 * time.Minute)
+	if err := os.Chtimes(lockPath, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.PutArchive(ctx, path, strings.NewReader("archive")); err != nil {
+		t.Fatalf("PutArchive failed: %v", err)
+	}
+	if _, err := os.Stat(lockPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the abandoned lock file to be removed, got %v", err)
+	}
+}
+
+func TestSharedLocks_WaitingDoesNotBlockOtherWrites(t *testing.T) {
+	dir := t.TempDir()
+	first, second := newSharedStorage(t, dir), newSharedStorage(t, dir)
+	// A quota makes writes go through the serialized check
+	second.SetQuota(1<<30, QuotaReject)
+	ctx := context.Background()
+	locked := "registry.terraform.io/hashicorp/aws/aws.zip"
+	fullPath := first.archivePath(locked)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	unlock, err := first.lockArchive(ctx, fullPath)
+	if err != nil {
+		t.Fatalf("lockArchive failed: %v", err)
+	}
+	defer unlock()
+
+	waitCtx, cancel := context.WithCancel(ctx)
+	waiting := make(chan error, 1)
+	go func() {
+		waiting <- second.PutArchive(waitCtx, locked, strings.NewReader("waiting"))
+	}()
+	defer func() {
+		cancel()
+		<-waiting
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// Another archive of the waiting instance is written while the first write waits for its lock
+	done := make(chan error, 1)
+	go func() {
+		done <- second.PutArchive(ctx, "registry.terraform.io/hashicorp/google/google.zip", strings.NewReader("other"))
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("PutArchive failed: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a write of another archive not to wait for the held lock")
+	}
+}
+
+func TestSharedLocks_RacingForAbandonedLock(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	first, second := newSharedStorage(t, dir), newSharedStorage(t, dir)
+	fullPath := first.archivePath("registry.terraform.io/hashicorp/aws/aws.zip")
+	lockPath := filepath.Join(filepath.Dir(fullPath), lockPrefix+filepath.Base(fullPath))
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(lockPath, []byte("crashed 1 token"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * time.Minute)
+	if err := os.Chtimes(lockPath, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both contenders find the lock abandoned, the first takes it over before the second acts
+	stale, err := os.Stat(lockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock, err := first.lockArchive(ctx, fullPath)
+	if err != nil {
+		t.Fatalf("lockArchive failed: %v", err)
+	}
+	if !second.breakLock(lockPath, stale) {
+		t.Error("expected the second contender to try the lock again")
+	}
+	if _, err := os.Stat(lockPath); err != nil {
+		t.Fatalf("expected the lock of the first contender to be kept: %v", err)
+	}
+
+	// The second contender then waits for the first, instead of holding the lock too
+	waitCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if _, err := second.lockArchive(waitCtx, fullPath); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the second contender to wait, got %v", err)
+	}
+	unlock()
+
+	// A breaker left by a crashed contender is itself taken over once abandoned
+	for _, path := range []string{lockPath, lockPath + ".break"} {
+		if err := os.WriteFile(path, []byte("crashed 1 token"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	unlock, err = second.lockArchive(ctx, fullPath)
+	if err != nil {
+		t.Fatalf("lockArchive failed: %v", err)
+	}
+	unlock()
+}
+
+func TestSharedLocks_PurgeKeepsOtherWrites(t *testing.T) {
+	dir := t.TempDir()
+	fs := newSharedStorage(t, dir)
+	inFlight := filepath.Join(dir, ".tmp-123")
+	abandoned := filepath.Join(dir, ".tmp-456")
+	for _, path := range []string{inFlight, abandoned} {
+		if err := os.WriteFile(path, []byte("partial"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-2 * staleTempAge)
+	if err := os.Chtimes(abandoned, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another instance may still be writing the young temporary file
+	removed, err := fs.PurgeTruncated(context.Background())
+	if err != nil {
+		t.Fatalf("PurgeTruncated failed: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("expected 1 file removed, got %d", removed)
+	}
+	if _, err := os.Stat(inFlight); err != nil {
+		t.Errorf("expected the young temporary file to be kept: %v", err)
+	}
+}
@@ -0,0 +1,296 @@
+package storage
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStorage implements Storage using an in-memory map
+// Useful for testing without filesystem dependencies
+type MemoryStorage struct {
+	mu                sync.RWMutex
+	data              map[string][]byte
+	archives          map[string][]byte
+	versionsResponses map[string][]byte
+	modTimes          map[string]time.Time
+	// generation counts writes, snapshotGeneration is its value at the last snapshot or restore
+	generation         uint64
+	snapshotGeneration uint64
+
+	// size is the bytes of stored data, maxBytes caps it when set
+	size     int64
+	maxBytes int64
+	// lru holds the keys of stored data, most recently used first, while maxBytes is set
+	lru        *list.List
+	lruEntries map[string]*list.Element
+}
+
+// NewMemoryStorage creates a new in-memory storage backend
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		data:              make(map[string][]byte),
+		archives:          make(map[string][]byte),
+		versionsResponses: make(map[string][]byte),
+		modTimes:          make(map[string]time.Time),
+	}
+}
+
+// GetIndex retrieves the cached index.json for a provider
+func (m *MemoryStorage) GetIndex(ctx context.Context, hostname, namespace, providerType string) ([]byte, error) {
+	key := indexKey(hostname, namespace, providerType)
+	return m.get(key)
+}
+
+// PutIndex stores the index.json for a provider
+func (m *MemoryStorage) PutIndex(ctx context.Context, hostname, namespace, providerType string, data []byte) error {
+	key := indexKey(hostname, namespace, providerType)
+	return m.put(key, data)
+}
+
+// GetVersion retrieves the cached version.json for a specific provider version
+func (m *MemoryStorage) GetVersion(ctx context.Context, hostname, namespace, providerType, version string) ([]byte, error) {
+	key := versionKey(hostname, namespace, providerType, version)
+	return m.get(key)
+}
+
+// PutVersion stores the version.json for a specific provider version
+func (m *MemoryStorage) PutVersion(ctx context.Context, hostname, namespace, providerType, version string, data []byte) error {
+	key := versionKey(hostname, namespace, providerType, version)
+	return m.put(key, data)
+}
+
+// GetArchive retrieves a cached provider archive
+func (m *MemoryStorage) GetArchive(ctx context.Context, path string) (io.ReadCloser, error) {
+	data, ok := m.lookup(path, true)
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	// Return a copy wrapped in a ReadCloser
+	return io.NopCloser(bytes.NewReader(bytes.Clone(data))), nil
+}
+
+// PutArchive stores a provider archive
+func (m *MemoryStorage) PutArchive(ctx context.Context, path string, data io.Reader) error {
+	// Read all data into memory
+	content, err := io.ReadAll(data)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.fitsLocked(path, content); err != nil {
+		return &QuotaExceededError{Err: err, Archive: io.NopCloser(bytes.NewReader(content))}
+	}
+	m.size += int64(len(content) - len(m.archives[path]))
+	m.archives[path] = content
+	m.modTimes[archiveKey(path)] = time.Now()
+	m.dropLocked(hashesKey(path))
+	m.dropLocked(entryInfoKey(archiveKey(path)))
+	m.generation++
+	m.usedLocked(archiveKey(path))
+	m.evictLocked(archiveKey(path))
+	return nil
+}
+
+// ExistsArchive checks if an archive exists
+func (m *MemoryStorage) ExistsArchive(ctx context.Context, path string) (bool, error) {
+	m.mu.RLock()
+	_, ok := m.archives[path]
+	m.mu.RUnlock()
+	return ok, nil
+}
+
+// ArchiveChecksum returns the SHA-256 of a cached archive
+func (m *MemoryStorage) ArchiveChecksum(ctx context.Context, path string) (string, error) {
+	m.mu.RLock()
+	data, ok := m.archives[path]
+	m.mu.RUnlock()
+
+	if !ok {
+		return "", ErrNotFound
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// IndexModTime returns when the index.json for a provider was stored
+func (m *MemoryStorage) IndexModTime(ctx context.Context, hostname, namespace, providerType string) (time.Time, error) {
+	return m.modTime(indexKey(hostname, namespace, providerType))
+}
+
+// VersionModTime returns when the version.json for a provider version was stored
+func (m *MemoryStorage) VersionModTime(ctx context.Context, hostname, namespace, providerType, version string) (time.Time, error) {
+	return m.modTime(versionKey(hostname, namespace, providerType, version))
+}
+
+// ArchiveModTime returns when a provider archive was stored
+func (m *MemoryStorage) ArchiveModTime(ctx context.Context, path string) (time.Time, error) {
+	return m.modTime(archiveKey(path))
+}
+
+// GetVersionsResponse retrieves the cached full versions API response
+func (m *MemoryStorage) GetVersionsResponse(ctx context.Context, hostname, namespace, providerType string) ([]byte, error) {
+	key := versionsResponseKey(hostname, namespace, providerType)
+	return m.get(key)
+}
+
+// PutVersionsResponse stores the full versions API response
+func (m *MemoryStorage) PutVersionsResponse(ctx context.Context, hostname, namespace, providerType string, data []byte) error {
+	key := versionsResponseKey(hostname, namespace, providerType)
+	return m.put(key, data)
+}
+
+// DeleteIndex removes the stored index.json and versions API response of a provider
+func (m *MemoryStorage) DeleteIndex(ctx context.Context, hostname, namespace, providerType string) error {
+	m.delete(indexKey(hostname, namespace, providerType), versionsResponseKey(hostname, namespace, providerType))
+	return nil
+}
+
+// DeleteVersion removes the stored version.json for a specific provider version
+func (m *MemoryStorage) DeleteVersion(ctx context.Context, hostname, namespace, providerType, version string) error {
+	m.delete(versionKey(hostname, namespace, providerType, version))
+	return nil
+}
+
+// DeleteArchive removes a stored provider archive and its recorded hashes
+func (m *MemoryStorage) DeleteArchive(ctx context.Context, path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deleteArchiveLocked(path)
+	return nil
+}
+
+// PurgeProvider removes every stored index, version and archive of a provider
+// Archives belong to the provider when their path starts with hostname/namespace/type/
+func (m *MemoryStorage) PurgeProvider(ctx context.Context, hostname, namespace, providerType string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deleteLocked(indexKey(hostname, namespace, providerType), versionsResponseKey(hostname, namespace, providerType))
+	versionPrefix := versionKey(hostname, namespace, providerType, "")
+	for key := range m.data {
+		if strings.HasPrefix(key, versionPrefix) {
+			m.deleteLocked(key)
+		}
+	}
+	archivePrefix := hostname + "/" + namespace + "/" + providerType + "/"
+	for path := range m.archives {
+		if strings.HasPrefix(path, archivePrefix) {
+			m.deleteArchiveLocked(path)
+		}
+	}
+	return nil
+}
+
+// Helper functions
+
+func indexKey(hostname, namespace, providerType string) string {
+	return "index:" + hostname + ":" + namespace + ":" + providerType
+}
+
+func versionKey(hostname, namespace, providerType, version string) string {
+	return "version:" + hostname + ":" + namespace + ":" + providerType + ":" + version
+}
+
+func versionsResponseKey(hostname, namespace, providerType string) string {
+	return "versions_response:" + hostname + ":" + namespace + ":" + providerType
+}
+
+func archiveKey(path string) string {
+	return "archive:" + path
+}
+
+func (m *MemoryStorage) get(key string) ([]byte, error) {
+	data, ok := m.lookup(key, false)
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return bytes.Clone(data), nil
+}
+
+func (m *MemoryStorage) put(key string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.fitsLocked(key, data); err != nil {
+		return err
+	}
+	m.size += int64(len(data) - len(m.data[key]))
+	m.data[key] = bytes.Clone(data)
+	m.modTimes[key] = time.Now()
+	// The record of the replaced entry no longer applies
+	m.dropLocked(entryInfoKey(key))
+	m.generation++
+	m.usedLocked(key)
+	m.evictLocked(key)
+	return nil
+}
+
+func (m *MemoryStorage) delete(keys ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deleteLocked(keys...)
+}
+
+// deleteLocked removes entries and their modification times, must be called with mu held
+func (m *MemoryStorage) deleteLocked(keys ...string) {
+	for _, key := range keys {
+		if _, ok := m.data[key]; ok {
+			m.dropLocked(key)
+			m.generation++
+		}
+		m.dropLocked(entryInfoKey(key))
+		delete(m.modTimes, key)
+	}
+}
+
+// deleteArchiveLocked removes an archive, its modification time and recorded hashes, must be called with mu held
+func (m *MemoryStorage) deleteArchiveLocked(path string) {
+	if data, ok := m.archives[path]; ok {
+		delete(m.archives, path)
+		m.size -= int64(len(data))
+		m.forgetLocked(archiveKey(path))
+		m.generation++
+	}
+	m.deleteLocked(archiveKey(path), hashesKey(path))
+}
+
+// dropLocked removes a single data entry, must be called with mu held
+func (m *MemoryStorage) dropLocked(key string) {
+	if data, ok := m.data[key]; ok {
+		delete(m.data, key)
+		m.size -= int64(len(data))
+		m.forgetLocked(key)
+	}
+}
+
+func (m *MemoryStorage) modTime(key string) (time.Time, error) {
+	m.mu.RLock()
+	t, ok := m.modTimes[key]
+	m.mu.RUnlock()
+
+	if !ok {
+		return time.Time{}, ErrNotFound
+	}
+	return t, nil
+}
+
+// Clear removes all data from memory storage (useful for testing)
+func (m *MemoryStorage) Clear() {
+	m.mu.Lock()
+	m.data = make(map[string][]byte)
+	m.archives = make(map[string][]byte)
+	m.versionsResponses = make(map[string][]byte)
+	m.modTimes = make(map[string]time.Time)
+	m.generation++
+	m.recountLocked()
+	m.mu.Unlock()
+}
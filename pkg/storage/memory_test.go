@@ -19,8 +19,8 @@ func TestMemoryStorage_GetIndex_NotFound(t *testing.T) {
 	ctx := context.Background()
 
 	_, err := m.GetIndex(ctx, "registry.terraform.io", "hashicorp", "aws")
-	if err != io.EOF {
-		t.Errorf("GetIndex() error = %v, want io.EOF", err)
+	if err != ErrNotFound {
+		t.Errorf("GetIndex() error = %v, want ErrNotFound", err)
 	}
 }
 
@@ -55,8 +55,8 @@ func TestMemoryStorage_GetVersion_NotFound(t *testing.T) {
 	ctx := context.Background()
 
 	_, err := m.GetVersion(ctx, "registry.terraform.io", "hashicorp", "aws", "1.0.0")
-	if err != io.EOF {
-		t.Errorf("GetVersion() error = %v, want io.EOF", err)
+	if err != ErrNotFound {
+		t.Errorf("GetVersion() error = %v, want ErrNotFound", err)
 	}
 }
 
@@ -149,8 +149,8 @@ func TestMemoryStorage_GetArchive_NotFound(t *testing.T) {
 	ctx := context.Background()
 
 	_, err := m.GetArchive(ctx, "nonexistent/file.zip")
-	if err != io.EOF {
-		t.Errorf("GetArchive() error = %v, want io.EOF", err)
+	if err != ErrNotFound {
+		t.Errorf("GetArchive() error = %v, want ErrNotFound", err)
 	}
 }
 
@@ -214,8 +214,8 @@ func TestMemoryStorage_Clear(t *testing.T) {
 
 	// Verify data is gone
 	_, err = m.GetIndex(ctx, "registry.terraform.io", "hashicorp", "aws")
-	if err != io.EOF {
-		t.Errorf("after Clear: GetIndex() error = %v, want io.EOF", err)
+	if err != ErrNotFound {
+		t.Errorf("after Clear: GetIndex() error = %v, want ErrNotFound", err)
 	}
 
 	exists, _ = m.ExistsArchive(ctx, "path/to/archive.zip")
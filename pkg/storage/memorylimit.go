@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"container/list"
+	"fmt"
+	"strings"
+)
+
+// SetMaxBytes caps the data held by the storage, zero leaves it unbounded
+// The least recently used entries, metadata and archives alike, are evicted to make room for new ones and are
+// fetched from upstream again on their next request. Entries larger than the cap are rejected with ErrQuotaExceeded.
+// Must be called before the storage is used
+func (m *MemoryStorage) SetMaxBytes(maxBytes int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.maxBytes = maxBytes
+	m.recountLocked()
+}
+
+// Size returns the bytes of data held by the storage
+func (m *MemoryStorage) Size() int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.size
+}
+
+// lookup returns stored data, marking it as used when the storage is capped
+func (m *MemoryStorage) lookup(name string, archive bool) ([]byte, bool) {
+	key := name
+	if archive {
+		key = archiveKey(name)
+	}
+	if m.maxBytes == 0 {
+		m.mu.RLock()
+		defer m.mu.RUnlock()
+		return m.stored(name, archive)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.stored(name, archive)
+	if ok {
+		m.usedLocked(key)
+	}
+	return data, ok
+}
+
+// stored returns a data entry or an archive, must be called with mu held
+func (m *MemoryStorage) stored(name string, archive bool) ([]byte, bool) {
+	if archive {
+		data, ok := m.archives[name]
+		return data, ok
+	}
+	data, ok := m.data[name]
+	return data, ok
+}
+
+// fitsLocked rejects data that could not fit even in an empty storage, must be called with mu held
+func (m *MemoryStorage) fitsLocked(name string, data []byte) error {
+	if m.maxBytes > 0 && int64(len(data)) > m.maxBytes {
+		return fmt.Errorf("%w: %s is %d bytes, more than the %d bytes memory storage holds", ErrQuotaExceeded, name, len(data), m.maxBytes)
+	}
+	return nil
+}
+
+// usedLocked marks key as the most recently used, must be called with mu held
+func (m *MemoryStorage) usedLocked(key string) {
+	if m.lru == nil {
+		return
+	}
+	if elem, ok := m.lruEntries[key]; ok {
+		m.lru.MoveToFront(elem)
+		return
+	}
+	m.lruEntries[key] = m.lru.PushFront(key)
+}
+
+// forgetLocked removes key from the LRU list, must be called with mu held
+func (m *MemoryStorage) forgetLocked(key string) {
+	if m.lru == nil {
+		return
+	}
+	if elem, ok := m.lruEntries[key]; ok {
+		m.lru.Remove(elem)
+		delete(m.lruEntries, key)
+	}
+}
+
+// evictLocked removes the least recently used entries until the storage fits its cap, keep is never evicted
+// Must be called with mu held
+func (m *MemoryStorage) evictLocked(keep string) {
+	if m.lru == nil {
+		return
+	}
+	for m.size > m.maxBytes {
+		elem := m.lru.Back()
+		for elem != nil && elem.Value.(string) == keep {
+			elem = elem.Prev()
+		}
+		if elem == nil {
+			return
+		}
+		key := elem.Value.(string)
+		if path, ok := strings.CutPrefix(key, "archive:"); ok {
+			m.deleteArchiveLocked(path)
+		} else {
+			m.deleteLocked(key)
+		}
+	}
+}
+
+// recountLocked recomputes the size after the stored data was replaced wholesale and rebuilds the LRU list
+// Entries restored from a snapshot are evicted in no particular order when they exceed the cap
+// Must be called with mu held
+func (m *MemoryStorage) recountLocked() {
+	m.size = 0
+	m.lru, m.lruEntries = nil, nil
+	if m.maxBytes > 0 {
+		m.lru, m.lruEntries = list.New(), make(map[string]*list.Element)
+	}
+	for key, data := range m.data {
+		m.size += int64(len(data))
+		m.usedLocked(key)
+	}
+	for path, data := range m.archives {
+		m.size += int64(len(data))
+		m.usedLocked(archiveKey(path))
+	}
+	m.evictLocked("")
+}
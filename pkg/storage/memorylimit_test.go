@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMemoryStorage_MaxBytesEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryStorage()
+	m.SetMaxBytes(16)
+
+	m.PutIndex(ctx, "registry.terraform.io", "hashicorp", "aws", []byte("aaaa"))
+	m.PutVersion(ctx, "registry.terraform.io", "hashicorp", "aws", "1.0.0", []byte("bbbb"))
+	// Reading the index makes the version the least recently used entry
+	if _, err := m.GetIndex(ctx, "registry.terraform.io", "hashicorp", "aws"); err != nil {
+		t.Fatalf("GetIndex failed: %v", err)
+	}
+	if err := m.PutArchive(ctx, "registry.terraform.io/hashicorp/aws/aws.zip", strings.NewReader("ccccccccc")); err != nil {
+		t.Fatalf("PutArchive failed: %v", err)
+	}
+
+	if _, err := m.GetVersion(ctx, "registry.terraform.io", "hashicorp", "aws", "1.0.0"); !IsNotFound(err) {
+		t.Errorf("expected the least recently used version to be evicted, got %v", err)
+	}
+	if _, err := m.GetIndex(ctx, "registry.terraform.io", "hashicorp", "aws"); err != nil {
+		t.Errorf("expected the recently read index to stay, got %v", err)
+	}
+	if ok, _ := m.ExistsArchive(ctx, "registry.terraform.io/hashicorp/aws/aws.zip"); !ok {
+		t.Error("expected the new archive to be stored")
+	}
+	if size := m.Size(); size != 13 {
+		t.Errorf("expected 13 bytes stored, got %d", size)
+	}
+
+	// Archives are evicted like metadata, along with their recorded hashes
+	m.PutArchiveHashes(ctx, "registry.terraform.io/hashicorp/aws/aws.zip", []string{"h1"})
+	m.GetIndex(ctx, "registry.terraform.io", "hashicorp", "aws")
+	m.PutVersion(ctx, "registry.terraform.io", "hashicorp", "aws", "2.0.0", []byte("dddd"))
+	if ok, _ := m.ExistsArchive(ctx, "registry.terraform.io/hashicorp/aws/aws.zip"); ok {
+		t.Error("expected the least recently used archive to be evicted")
+	}
+	if _, err := m.ArchiveHashes(ctx, "registry.terraform.io/hashicorp/aws/aws.zip"); !IsNotFound(err) {
+		t.Errorf("expected the hashes of the evicted archive to go with it, got %v", err)
+	}
+	if _, err := m.GetIndex(ctx, "registry.terraform.io", "hashicorp", "aws"); err != nil {
+		t.Errorf("expected the recently read index to stay, got %v", err)
+	}
+	if size := m.Size(); size != 8 {
+		t.Errorf("expected 8 bytes stored, got %d", size)
+	}
+}
+
+func TestMemoryStorage_MaxBytesRejectsOversizedEntries(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryStorage()
+	m.SetMaxBytes(4)
+	m.PutIndex(ctx, "registry.terraform.io", "hashicorp", "aws", []byte("aaaa"))
+
+	err := m.PutArchive(ctx, "registry.terraform.io/hashicorp/aws/aws.zip", strings.NewReader("too large"))
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("expected ErrQuotaExceeded, got %v", err)
+	}
+	if _, err := m.GetIndex(ctx, "registry.terraform.io", "hashicorp", "aws"); err != nil {
+		t.Errorf("expected a rejected entry not to evict anything, got %v", err)
+	}
+}
+
+func TestMemoryStorage_SetMaxBytesOnExistingData(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryStorage()
+	m.PutIndex(ctx, "registry.terraform.io", "hashicorp", "aws", []byte("aaaa"))
+	m.PutIndex(ctx, "registry.terraform.io", "hashicorp", "google", []byte("bbbb"))
+	if size := m.Size(); size != 8 {
+		t.Fatalf("expected 8 bytes stored, got %d", size)
+	}
+
+	// Data restored before the cap was set is trimmed to fit
+	m.SetMaxBytes(6)
+	if size := m.Size(); size != 4 {
+		t.Errorf("expected one entry left, got %d bytes", size)
+	}
+	m.Clear()
+	if size := m.Size(); size != 0 {
+		t.Errorf("expected an empty storage after Clear, got %d bytes", size)
+	}
+}
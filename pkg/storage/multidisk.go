@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// SetArchiveDirs spreads archives over several directories, typically on separate disks
+// Each archive is placed by rendezvous hashing of its path, so adding a directory only moves
+// the archives that hash to it. Archives already stored in another directory keep being served
+// from there. Metadata stays in the cache directory. Must be called before the storage is used
+func (fs *FilesystemStorage) SetArchiveDirs(dirs []string) error {
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create archive directory: %w", err)
+		}
+	}
+	fs.archiveDirs = dirs
+	return nil
+}
+
+// roots returns every directory holding cache files, the cache directory first
+func (fs *FilesystemStorage) roots() []string {
+	roots := []string{fs.cacheDir}
+	for _, dir := range fs.archiveDirs {
+		if !slices.ContainsFunc(roots, func(root string) bool { return filepath.Clean(root) == filepath.Clean(dir) }) {
+			roots = append(roots, dir)
+		}
+	}
+	return roots
+}
+
+// archiveRoot returns the directory an archive, or one of its sidecars, is placed in
+// rel is the archive path relative to the cache root
+func (fs *FilesystemStorage) archiveRoot(rel string) string {
+	if len(fs.archiveDirs) == 0 {
+		return fs.cacheDir
+	}
+	for _, suffix := range archiveSidecars {
+		rel = strings.TrimSuffix(rel, suffix)
+	}
+
+	var best string
+	var bestScore uint64
+	for _, dir := range fs.archiveDirs {
+		h := fnv.New64a()
+		h.Write([]byte(dir))
+		h.Write([]byte{0})
+		h.Write([]byte(filepath.ToSlash(rel)))
+		if score := h.Sum64(); best == "" || score > bestScore {
+			best, bestScore = dir, score
+		}
+	}
+	return best
+}
+
+// locateArchive returns where an archive is stored: the first root already holding it, in either
+// the flat or the sharded layout, or where it is placed when it is not stored yet
+// rel is the archive path relative to the cache root, in the flat layout
+func (fs *FilesystemStorage) locateArchive(rel string) string {
+	layout, other := fs.archiveLayouts(rel)
+	placed := filepath.Join(fs.archiveRoot(rel), layout)
+	if len(fs.archiveDirs) == 0 && !fs.shardArchives {
+		return placed
+	}
+	if _, err := os.Stat(placed); err == nil {
+		return placed
+	}
+	for _, root := range fs.roots() {
+		for _, candidate := range []string{filepath.Join(root, layout), filepath.Join(root, other)} {
+			if candidate == placed {
+				continue
+			}
+			if _, err := os.Stat(candidate); err == nil {
+				return candidate
+			}
+		}
+	}
+	return placed
+}
+
+// walkRoots walks every directory holding cache files, stopping at the first error
+func (fs *FilesystemStorage) walkRoots(fn func(root, path string, d os.DirEntry, err error) error) error {
+	for _, root := range fs.roots() {
+		err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+			return fn(root, path, d, err)
+		})
+		if err != nil && !errors.Is(err, filepath.SkipAll) {
+			return err
+		}
+	}
+	return nil
+}
+
+// rootsUsage sums the disk usage of every root, counting each filesystem once
+// FreeBytes is the lowest free space of any root, since any of them may receive the next archive
+func (fs *FilesystemStorage) rootsUsage() (DiskUsage, error) {
+	var total DiskUsage
+	seen := make(map[DiskUsage]bool)
+	for i, root := range fs.roots() {
+		usage, err := diskUsage(root)
+		if err != nil {
+			return DiskUsage{}, err
+		}
+		if i == 0 || usage.FreeBytes < total.FreeBytes {
+			total.FreeBytes = usage.FreeBytes
+		}
+		// Directories on the same filesystem report the same usage
+		if seen[usage] {
+			continue
+		}
+		seen[usage] = true
+		total.TotalBytes += usage.TotalBytes
+		total.UsedBytes += usage.UsedBytes
+	}
+	return total, nil
+}
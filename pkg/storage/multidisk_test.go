@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newMultiDiskStorage returns a filesystem storage with archives sharded across dirs archive directories
+func newMultiDiskStorage(t *testing.T, dirs int) (*FilesystemStorage, []string) {
+	t.Helper()
+	fs, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	var archiveDirs []string
+	for range dirs {
+		archiveDirs = append(archiveDirs, t.TempDir())
+	}
+	if err := fs.SetArchiveDirs(archiveDirs); err != nil {
+		t.Fatalf("SetArchiveDirs failed: %v", err)
+	}
+	return fs, archiveDirs
+}
+
+// archiveDirOf returns the archive directory holding path, or an empty string
+func archiveDirOf(dirs []string, path string) string {
+	for _, dir := range dirs {
+		if _, err := os.Stat(filepath.Join(dir, path)); err == nil {
+			return dir
+		}
+	}
+	return ""
+}
+
+func TestArchiveDirs_Sharding(t *testing.T) {
+	fs, dirs := newMultiDiskStorage(t, 3)
+	ctx := context.Background()
+
+	used := make(map[string]bool)
+	for i := range 30 {
+		path := fmt.Sprintf("registry.terraform.io/hashicorp/aws/%d/terraform-provider-aws_%d_linux_amd64.zip", i, i)
+		if err := fs.PutArchive(ctx, path, strings.NewReader("archive data")); err != nil {
+			t.Fatalf("PutArchive failed: %v", err)
+		}
+		dir := archiveDirOf(dirs, path)
+		if dir == "" {
+			t.Fatalf("%s: not stored in any archive directory", path)
+		}
+		// Sidecars are kept next to their archive
+		if _, err := readChecksum(filepath.Join(dir, path)); err != nil {
+			t.Errorf("%s: checksum not stored next to the archive: %v", path, err)
+		}
+		used[dir] = true
+
+		rc, err := fs.GetArchive(ctx, path)
+		if err != nil {
+			t.Fatalf("GetArchive failed: %v", err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		if string(data) != "archive data" {
+			t.Errorf("GetArchive = %q, want %q", data, "archive data")
+		}
+	}
+	if len(used) != len(dirs) {
+		t.Errorf("archives stored in %d of %d directories", len(used), len(dirs))
+	}
+
+	// Metadata stays in the cache directory
+	if err := fs.PutIndex(ctx, "registry.terraform.io", "hashicorp", "aws", []byte(`{}`)); err != nil {
+		t.Fatalf("PutIndex failed: %v", err)
+	}
+	if dir := archiveDirOf(dirs, "registry.terraform.io/hashicorp/aws/index.json"); dir != "" {
+		t.Errorf("index stored in archive directory %s", dir)
+	}
+}
+
+func TestArchiveDirs_ExistingArchives(t *testing.T) {
+	fs, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	ctx := context.Background()
+	path := "registry.terraform.io/hashicorp/aws/old.zip"
+	if err := fs.PutArchive(ctx, path, strings.NewReader("old")); err != nil {
+		t.Fatalf("PutArchive failed: %v", err)
+	}
+
+	// Archives cached before adding archive directories are still served from the cache directory
+	if err := fs.SetArchiveDirs([]string{t.TempDir(), t.TempDir()}); err != nil {
+		t.Fatalf("SetArchiveDirs failed: %v", err)
+	}
+	if exists, err := fs.ExistsArchive(ctx, path); err != nil || !exists {
+		t.Fatalf("ExistsArchive = %v, %v, want true", exists, err)
+	}
+	if err := fs.PutArchive(ctx, path, strings.NewReader("new")); err != nil {
+		t.Fatalf("PutArchive failed: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(fs.cacheDir, path)); err != nil || string(data) != "new" {
+		t.Errorf("archive in cache directory = %q, %v, want replaced in place", data, err)
+	}
+
+	checked, removed, err := fs.VerifyArchives(ctx)
+	if err != nil || checked != 1 || removed != 0 {
+		t.Errorf("VerifyArchives = %d, %d, %v, want 1, 0, nil", checked, removed, err)
+	}
+}
+
+func TestArchiveDirs_Maintenance(t *testing.T) {
+	fs, _ := newMultiDiskStorage(t, 2)
+	ctx := context.Background()
+
+	var paths []string
+	for i := range 10 {
+		path := fmt.Sprintf("registry.terraform.io/hashicorp/aws/%d.zip", i)
+		if err := fs.PutArchive(ctx, path, strings.NewReader("archive data")); err != nil {
+			t.Fatalf("PutArchive failed: %v", err)
+		}
+		paths = append(paths, path)
+	}
+
+	// Corrupt one archive and truncate another, wherever they are stored
+	if err := os.WriteFile(fs.archivePath(paths[0]), []byte("archive DATA"), 0644); err != nil {
+		t.Fatalf("failed to corrupt archive: %v", err)
+	}
+	if err := os.WriteFile(fs.archivePath(paths[1]), []byte("arch"), 0644); err != nil {
+		t.Fatalf("failed to truncate archive: %v", err)
+	}
+
+	if removed, err := fs.CollectGarbage(ctx); err != nil || removed != 1 {
+		t.Errorf("CollectGarbage = %d, %v, want 1", removed, err)
+	}
+	checked, removed, err := fs.VerifyArchives(ctx)
+	if err != nil || checked != 9 || removed != 1 {
+		t.Errorf("VerifyArchives = %d, %d, %v, want 9, 1, nil", checked, removed, err)
+	}
+	contents, err := fs.Reconcile(ctx)
+	if err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	if contents.Archives != 8 {
+		t.Errorf("Reconcile found %d archives, want 8", contents.Archives)
+	}
+
+	// A backup covers every directory and restores into another layout
+	var backup bytes.Buffer
+	manifest, err := fs.Backup(ctx, &backup, BackupOptions{Archives: true})
+	if err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	// Each archive has a checksum and a size sidecar
+	if manifest.Files != 8*3 {
+		t.Errorf("backup has %d files, want %d", manifest.Files, 8*3)
+	}
+	dst, dstDirs := newMultiDiskStorage(t, 3)
+	if _, err := dst.Restore(ctx, &backup); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	for _, path := range paths[2:] {
+		if archiveDirOf(dstDirs, path) == "" {
+			t.Errorf("%s: not restored into an archive directory", path)
+		}
+		if _, err := dst.ArchiveChecksum(ctx, path); err != nil {
+			t.Errorf("%s: checksum not restored: %v", path, err)
+		}
+	}
+}
+
+func TestArchiveDirs_Quota(t *testing.T) {
+	fs, _ := newMultiDiskStorage(t, 2)
+	fs.SetNamespaceQuotas(map[string]int64{"partner": 1000}, QuotaReject)
+	ctx := context.Background()
+
+	// Archives count against the quota whichever directory they are stored in
+	for i := range 4 {
+		path := fmt.Sprintf("registry.terraform.io/partner/tool/%d.zip", i)
+		if err := fs.PutArchive(ctx, path, bytes.NewReader(make([]byte, 250))); err != nil {
+			t.Fatalf("PutArchive failed: %v", err)
+		}
+	}
+	err := fs.PutArchive(ctx, "registry.terraform.io/partner/tool/4.zip", bytes.NewReader(make([]byte, 250)))
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("expected ErrQuotaExceeded, got %v", err)
+	}
+}
@@ -0,0 +1,339 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// QuotaPolicy decides what happens when an archive would push a namespace over its quota
+type QuotaPolicy string
+
+const (
+	// QuotaReject refuses to cache the archive
+	QuotaReject QuotaPolicy = "reject"
+	// QuotaEvict removes the namespace's least recently written archives to make room
+	QuotaEvict QuotaPolicy = "evict"
+	// QuotaEvictLRU removes the namespace's least recently read archives to make room
+	// Reads are recorded in the archives' access time, which is set explicitly so noatime mounts work too
+	QuotaEvictLRU QuotaPolicy = "evict-lru"
+)
+
+// ErrQuotaExceeded is returned by PutArchive when an archive does not fit in its namespace or cache quota
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// QuotaExceededError is returned by PutArchive for an archive rejected by a quota after it was read
+// Archive holds the rejected archive, so it can still be served without being fetched again. The caller must close it
+type QuotaExceededError struct {
+	Err     error
+	Archive io.ReadCloser
+}
+
+func (e *QuotaExceededError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *QuotaExceededError) Unwrap() error {
+	return e.Err
+}
+
+// rejectArchive discards the temporary file of an archive write rejected by its check
+// A quota rejection hands the file over in a QuotaExceededError
+func rejectArchive(tmpPath string, err error) error {
+	if !errors.Is(err, ErrQuotaExceeded) {
+		os.Remove(tmpPath)
+		return err
+	}
+	f, openErr := os.Open(tmpPath)
+	if openErr != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	// Removed right away where an open file can be, so callers not reading it leave nothing behind
+	os.Remove(tmpPath)
+	return &QuotaExceededError{Err: err, Archive: &removeOnClose{File: f}}
+}
+
+// removeOnClose is a temporary file removed once read, on systems where it could not be removed while open
+type removeOnClose struct {
+	*os.File
+}
+
+func (f *removeOnClose) Close() error {
+	err := f.File.Close()
+	os.Remove(f.Name())
+	return err
+}
+
+// SetNamespaceQuotas limits the cache space used per provider namespace
+// Keys are either "hostname/namespace" or a bare "namespace", which applies to that
+// namespace on every hostname separately. Values are limits in bytes.
+// Must be called before the storage is used.
+func (fs *FilesystemStorage) SetNamespaceQuotas(quotas map[string]int64, policy QuotaPolicy) {
+	fs.quotas = quotas
+	fs.quotaPolicy = policy
+}
+
+// SetQuota limits the cache space used by the whole cache directory to limit bytes
+// It applies on top of namespace quotas, with its own policy. Must be called before the storage is used.
+func (fs *FilesystemStorage) SetQuota(limit int64, policy QuotaPolicy) {
+	fs.quota = limit
+	fs.cacheQuotaPolicy = policy
+}
+
+// tracksAccess reports whether reads are recorded, for least recently read eviction or retention
+func (fs *FilesystemStorage) tracksAccess() bool {
+	return fs.trackAccess || (len(fs.quotas) > 0 && fs.quotaPolicy == QuotaEvictLRU) || (fs.quota > 0 && fs.cacheQuotaPolicy == QuotaEvictLRU)
+}
+
+// touch records a read of the file at fullPath in its access time, leaving its modification time alone
+func touch(fullPath string) {
+	if err := os.Chtimes(fullPath, time.Now(), time.Time{}); err != nil {
+		slog.Debug("failed to record cache access", "path", fullPath, "error", err)
+	}
+}
+
+// quotaFor returns the namespace directory, relative to the cache roots, and limit applying to an archive path
+func (fs *FilesystemStorage) quotaFor(path string) (string, int64, bool) {
+	if len(fs.quotas) == 0 {
+		return "", 0, false
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(filepath.ToSlash(filepath.Clean(path)), "/"), "/", 3)
+	if len(parts) < 3 {
+		return "", 0, false
+	}
+	hostname, namespace := parts[0], parts[1]
+
+	limit, ok := fs.quotas[hostname+"/"+namespace]
+	if !ok {
+		limit, ok = fs.quotas[namespace]
+	}
+	if !ok {
+		return "", 0, false
+	}
+	return filepath.Join(hostname, namespace), limit, true
+}
+
+// cacheUsageRefresh is how often the running usage of the cache quota is recounted from disk
+// Writes, deletes and evictions keep it current, the recount catches metadata writes and the
+// removals of retention, purges and restores, and anything changed outside Specular
+const cacheUsageRefresh = 10 * time.Minute
+
+// fileKey identifies the inode of a file, so hard links are counted once
+type fileKey struct {
+	dev, ino uint64
+}
+
+// quotaFile is a cached archive counted against a quota, with every hard link to it within the quota
+type quotaFile struct {
+	paths []string
+	size  int64
+	// lastUsed is when the archive was written, or last read with the evict-lru policy
+	lastUsed time.Time
+	// shared is set when the archive is also linked from outside the quota, removing its links frees nothing
+	shared bool
+}
+
+// enforceQuota makes sure size more bytes fit in dir, a namespace or the whole cache when empty
+// dir is relative to the cache roots and counted in all of them
+// replacing is the destination of the write, which does not count against the quota
+// With the evict policies the least recently used archives are removed until the new one fits
+// The whole cache is only walked to evict or to recount its usage, otherwise a running count is used
+// Must be called with quotaMu held, the write is expected to be moved into place right after
+func (fs *FilesystemStorage) enforceQuota(dir string, limit, size int64, replacing string, policy QuotaPolicy) error {
+	if size > limit {
+		return fmt.Errorf("%w: archive of %d bytes is larger than the %d byte quota", ErrQuotaExceeded, size, limit)
+	}
+
+	replaced := freedBy(replacing)
+	if dir == "" && fs.cacheUsageCurrent() && fs.cacheUsage-replaced+size <= limit {
+		fs.cacheUsage += size - replaced
+		return nil
+	}
+
+	usage, archives, err := fs.quotaUsage(dir, replacing, policy)
+	if err != nil {
+		return fmt.Errorf("failed to compute quota usage: %w", err)
+	}
+	if dir == "" {
+		// Until the write is moved into place the replaced archive is still there
+		fs.cacheUsage, fs.cacheUsageCounted = usage+replaced, time.Now()
+	}
+
+	if usage+size <= limit {
+		if dir == "" {
+			fs.cacheUsage = usage + size
+		}
+		return nil
+	}
+	if policy != QuotaEvict && policy != QuotaEvictLRU {
+		return fmt.Errorf("%w: %d bytes used of %d", ErrQuotaExceeded, usage, limit)
+	}
+
+	sort.Slice(archives, func(i, j int) bool {
+		return archives[i].lastUsed.Before(archives[j].lastUsed)
+	})
+	for _, archive := range archives {
+		if usage+size <= limit {
+			break
+		}
+		if archive.shared {
+			continue
+		}
+		for _, path := range archive.paths {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("failed to evict archive: %w", err)
+			}
+			fs.catalogRemove(path)
+			for _, suffix := range archiveSidecars {
+				os.Remove(path + suffix)
+			}
+			slog.Info("evicted archive to stay within quota",
+				"path", path, "bytes", archive.size, "limit", limit)
+		}
+		usage -= archive.size
+		if dir == "" {
+			fs.cacheUsage -= archive.size
+		}
+	}
+
+	if usage+size > limit {
+		return fmt.Errorf("%w: %d bytes used of %d after eviction", ErrQuotaExceeded, usage, limit)
+	}
+	if dir == "" {
+		fs.cacheUsage = usage + size
+	}
+	return nil
+}
+
+// quotaUsage walks dir in every cache root and returns the bytes it uses and the archives that can be evicted
+// replacing, the destination of a write, and sidecars are left out. Hard links are counted once
+func (fs *FilesystemStorage) quotaUsage(dir, replacing string, policy QuotaPolicy) (int64, []*quotaFile, error) {
+	var usage int64
+	var archives []*quotaFile
+	inodes := make(map[fileKey]*quotaFile)
+	err := fs.walkRoots(func(root, path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			// Only descend into dir, the walk starts at each root
+			if rel, _ := filepath.Rel(root, path); rel != "." && !withinDir(rel, dir) && !withinDir(dir, rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if rel, _ := filepath.Rel(root, path); !withinDir(rel, dir) {
+			return nil
+		}
+		// Sidecars are a few bytes of bookkeeping, quotas limit the archives and metadata
+		if strings.HasPrefix(d.Name(), ".tmp-") || isArchiveFile(path, replacing) || slices.Contains(archiveSidecars, filepath.Ext(path)) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+
+		key, links, ok := inodeOf(info)
+		if ok && links > 1 {
+			if archive, seen := inodes[key]; seen {
+				archive.paths = append(archive.paths, path)
+				archive.shared = links > uint64(len(archive.paths))
+				return nil
+			}
+		}
+		usage += info.Size()
+		// Metadata is small and needed to serve the namespace, only archives are evicted
+		if isMetadataFile(path) {
+			return nil
+		}
+		lastUsed := info.ModTime()
+		if policy == QuotaEvictLRU {
+			lastUsed = accessTime(info)
+		}
+		archive := &quotaFile{paths: []string{path}, size: info.Size(), lastUsed: lastUsed, shared: links > 1}
+		if ok && links > 1 {
+			inodes[key] = archive
+		}
+		archives = append(archives, archive)
+		return nil
+	})
+	return usage, archives, err
+}
+
+// cacheUsageCurrent reports whether the running usage of the cache quota can be relied on
+// Must be called with quotaMu held
+func (fs *FilesystemStorage) cacheUsageCurrent() bool {
+	return !fs.cacheUsageCounted.IsZero() && time.Since(fs.cacheUsageCounted) < cacheUsageRefresh && fs.cacheUsage >= 0
+}
+
+// uncountArchive takes the archive at fullPath, about to be removed, out of the running usage of the cache quota
+func (fs *FilesystemStorage) uncountArchive(fullPath string) {
+	if fs.quota <= 0 {
+		return
+	}
+	fs.quotaMu.Lock()
+	defer fs.quotaMu.Unlock()
+	if !fs.cacheUsageCounted.IsZero() {
+		fs.cacheUsage -= freedBy(fullPath)
+	}
+}
+
+// uncountBytes takes size bytes freed by deduplication out of the running usage of the cache quota
+func (fs *FilesystemStorage) uncountBytes(size int64) {
+	if fs.quota <= 0 {
+		return
+	}
+	fs.quotaMu.Lock()
+	defer fs.quotaMu.Unlock()
+	if !fs.cacheUsageCounted.IsZero() {
+		fs.cacheUsage -= size
+	}
+}
+
+// freedBy returns the bytes removing the file at path frees, none when it is missing or linked elsewhere too
+func freedBy(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	if _, links, ok := inodeOf(info); ok && links > 1 {
+		return 0
+	}
+	return info.Size()
+}
+
+// withinDir reports whether the relative path rel is dir or inside it, every path is inside the empty dir
+func withinDir(rel, dir string) bool {
+	return dir == "" || rel == dir || strings.HasPrefix(rel, dir+string(filepath.Separator))
+}
+
+// isArchiveFile reports whether path is the archive at fullPath or one of its sidecars
+func isArchiveFile(path, fullPath string) bool {
+	if path == fullPath {
+		return true
+	}
+	for _, suffix := range archiveSidecars {
+		if path == fullPath+suffix {
+			return true
+		}
+	}
+	return false
+}
+
+// isMetadataFile reports whether path is an index or version file, compressed or not
+func isMetadataFile(path string) bool {
+	return strings.HasSuffix(path, ".json") || strings.HasSuffix(path, ".json"+compressedSuffix) || strings.HasSuffix(path, ".json"+metaSuffix)
+}
@@ -0,0 +1,266 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// putArchiveAt stores an archive and backdates its modification time
+func putArchiveAt(t *testing.T, fs *FilesystemStorage, path string, size int, modTime time.Time) error {
+	t.Helper()
+	if err := fs.PutArchive(context.Background(), path, bytes.NewReader(make([]byte, size))); err != nil {
+		return err
+	}
+	return os.Chtimes(fs.archivePath(path), modTime, modTime)
+}
+
+func TestNamespaceQuota_Reject(t *testing.T) {
+	fs, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	fs.SetNamespaceQuotas(map[string]int64{"partner": 100}, QuotaReject)
+
+	now := time.Now()
+	if err := putArchiveAt(t, fs, "registry.terraform.io/partner/a/a.zip", 60, now); err != nil {
+		t.Fatalf("first archive should fit: %v", err)
+	}
+
+	err = putArchiveAt(t, fs, "registry.terraform.io/partner/b/b.zip", 60, now)
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected ErrQuotaExceeded, got %v", err)
+	}
+	// The rejected archive is handed back so it can be served without downloading it again
+	var rejected *QuotaExceededError
+	if !errors.As(err, &rejected) {
+		t.Fatalf("expected a QuotaExceededError, got %T", err)
+	}
+	data, _ := io.ReadAll(rejected.Archive)
+	rejected.Archive.Close()
+	if len(data) != 60 {
+		t.Errorf("expected the 60 byte rejected archive, got %d bytes", len(data))
+	}
+	if exists, _ := fs.ExistsArchive(context.Background(), "registry.terraform.io/partner/b/b.zip"); exists {
+		t.Error("rejected archive should not be stored")
+	}
+
+	// Rewriting an existing archive does not count its old size
+	if err := putArchiveAt(t, fs, "registry.terraform.io/partner/a/a.zip", 90, now); err != nil {
+		t.Errorf("replacing an archive within quota should succeed: %v", err)
+	}
+
+	// Other namespaces and hostnames are measured separately
+	if err := putArchiveAt(t, fs, "registry.terraform.io/hashicorp/aws/aws.zip", 500, now); err != nil {
+		t.Errorf("namespace without quota should not be limited: %v", err)
+	}
+	if err := putArchiveAt(t, fs, "other.example.com/partner/a/a.zip", 60, now); err != nil {
+		t.Errorf("bare namespace quota should apply per hostname: %v", err)
+	}
+
+	// No temporary files are left behind
+	matches, _ := filepath.Glob(filepath.Join(fs.cacheDir, "registry.terraform.io", "partner", "*", ".tmp-*"))
+	if len(matches) != 0 {
+		t.Errorf("expected no temporary files, found %v", matches)
+	}
+}
+
+func TestNamespaceQuota_Evict(t *testing.T) {
+	fs, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	fs.SetNamespaceQuotas(map[string]int64{"registry.terraform.io/partner": 100}, QuotaEvict)
+
+	now := time.Now()
+	if err := fs.PutIndex(context.Background(), "registry.terraform.io", "partner", "a", []byte(`{"versions":{}}`)); err != nil {
+		t.Fatalf("PutIndex failed: %v", err)
+	}
+	for i, name := range []string{"old.zip", "mid.zip"} {
+		if err := putArchiveAt(t, fs, "registry.terraform.io/partner/a/"+name, 40, now.Add(time.Duration(i-2)*time.Hour)); err != nil {
+			t.Fatalf("failed to store %s: %v", name, err)
+		}
+	}
+
+	if err := putArchiveAt(t, fs, "registry.terraform.io/partner/a/new.zip", 40, now); err != nil {
+		t.Fatalf("expected eviction to make room, got %v", err)
+	}
+
+	want := map[string]bool{"old.zip": false, "mid.zip": true, "new.zip": true}
+	for name, shouldExist := range want {
+		exists, _ := fs.ExistsArchive(context.Background(), "registry.terraform.io/partner/a/"+name)
+		if exists != shouldExist {
+			t.Errorf("%s: expected exists=%v, got %v", name, shouldExist, exists)
+		}
+	}
+	if _, err := fs.GetIndex(context.Background(), "registry.terraform.io", "partner", "a"); err != nil {
+		t.Errorf("metadata should never be evicted: %v", err)
+	}
+
+	// Archives larger than the whole quota are rejected even when evicting
+	err = putArchiveAt(t, fs, "registry.terraform.io/partner/a/huge.zip", 101, now)
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("expected ErrQuotaExceeded for oversized archive, got %v", err)
+	}
+}
+
+func TestCacheQuota(t *testing.T) {
+	fs, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	fs.SetQuota(2000, QuotaEvict)
+
+	now := time.Now()
+	if err := putArchiveAt(t, fs, "registry.terraform.io/hashicorp/aws/old.zip", 900, now.Add(-time.Hour)); err != nil {
+		t.Fatalf("first archive should fit: %v", err)
+	}
+	if err := putArchiveAt(t, fs, "other.example.com/acme/netbox/new.zip", 900, now); err != nil {
+		t.Fatalf("second archive should fit: %v", err)
+	}
+
+	// The cache-wide quota spans namespaces and hostnames, the oldest archive anywhere is evicted
+	if err := putArchiveAt(t, fs, "registry.terraform.io/partner/a/a.zip", 900, now); err != nil {
+		t.Fatalf("archive should fit after eviction: %v", err)
+	}
+	if exists, _ := fs.ExistsArchive(context.Background(), "registry.terraform.io/hashicorp/aws/old.zip"); exists {
+		t.Error("expected the oldest archive to be evicted")
+	}
+	if exists, _ := fs.ExistsArchive(context.Background(), "other.example.com/acme/netbox/new.zip"); !exists {
+		t.Error("expected the newer archive to be kept")
+	}
+
+	if err := putArchiveAt(t, fs, "registry.terraform.io/partner/b/b.zip", 3000, now); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("expected ErrQuotaExceeded for an archive larger than the quota, got %v", err)
+	}
+}
+
+func TestCacheQuota_EvictLRU(t *testing.T) {
+	fs, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	fs.SetQuota(2000, QuotaEvictLRU)
+
+	now := time.Now()
+	if err := putArchiveAt(t, fs, "registry.terraform.io/hashicorp/aws/old.zip", 900, now.Add(-2*time.Hour)); err != nil {
+		t.Fatalf("first archive should fit: %v", err)
+	}
+	if err := putArchiveAt(t, fs, "registry.terraform.io/hashicorp/google/new.zip", 900, now.Add(-time.Hour)); err != nil {
+		t.Fatalf("second archive should fit: %v", err)
+	}
+
+	// Reading the oldest archive makes it the most recently used
+	rc, err := fs.GetArchive(context.Background(), "registry.terraform.io/hashicorp/aws/old.zip")
+	if err != nil {
+		t.Fatalf("GetArchive failed: %v", err)
+	}
+	rc.Close()
+	info, _ := os.Stat(fs.archivePath("registry.terraform.io/hashicorp/aws/old.zip"))
+	if !info.ModTime().Before(now.Add(-time.Hour)) {
+		t.Errorf("reading an archive should not change its modification time, got %v", info.ModTime())
+	}
+
+	if err := putArchiveAt(t, fs, "registry.terraform.io/hashicorp/null/a.zip", 900, now); err != nil {
+		t.Fatalf("archive should fit after eviction: %v", err)
+	}
+	if exists, _ := fs.ExistsArchive(context.Background(), "registry.terraform.io/hashicorp/aws/old.zip"); !exists {
+		t.Error("expected the recently read archive to be kept")
+	}
+	if exists, _ := fs.ExistsArchive(context.Background(), "registry.terraform.io/hashicorp/google/new.zip"); exists {
+		t.Error("expected the least recently read archive to be evicted")
+	}
+}
+
+func TestCacheQuota_RunningUsage(t *testing.T) {
+	fs, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	fs.SetQuota(100, QuotaReject)
+	ctx := context.Background()
+
+	now := time.Now()
+	if err := putArchiveAt(t, fs, "registry.terraform.io/hashicorp/aws/a.zip", 40, now); err != nil {
+		t.Fatalf("first archive should fit: %v", err)
+	}
+
+	// Once counted the cache is not walked again, a file added behind its back goes unnoticed
+	outside := filepath.Join(fs.cacheDir, "registry.terraform.io", "hashicorp", "aws", "outside.zip")
+	if err := os.WriteFile(outside, make([]byte, 50), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := putArchiveAt(t, fs, "registry.terraform.io/hashicorp/aws/b.zip", 40, now); err != nil {
+		t.Fatalf("second archive should fit the running count: %v", err)
+	}
+
+	// Until the count is refreshed
+	fs.cacheUsageCounted = now.Add(-2 * cacheUsageRefresh)
+	if err := putArchiveAt(t, fs, "registry.terraform.io/hashicorp/aws/c.zip", 10, now); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected ErrQuotaExceeded after recounting, got %v", err)
+	}
+
+	// Deletes free their bytes in the running count
+	if err := fs.DeleteArchive(ctx, "registry.terraform.io/hashicorp/aws/a.zip"); err != nil {
+		t.Fatalf("DeleteArchive failed: %v", err)
+	}
+	if err := putArchiveAt(t, fs, "registry.terraform.io/hashicorp/aws/c.zip", 10, now); err != nil {
+		t.Errorf("archive should fit after a delete: %v", err)
+	}
+	if fs.cacheUsage != 100 {
+		t.Errorf("expected a running usage of 100 bytes, got %d", fs.cacheUsage)
+	}
+}
+
+func TestCacheQuota_HardLinksCountOnce(t *testing.T) {
+	dir := t.TempDir()
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := inodeOf(info); !ok {
+		t.Skip("hard links cannot be told apart on this platform")
+	}
+	fs, err := NewFilesystemStorage(dir)
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	fs.SetDedup(DedupHardlink)
+	fs.SetQuota(250, QuotaEvict)
+
+	// The same archive under two hostnames shares one inode and uses its size once
+	now := time.Now()
+	for _, path := range []string{"registry.terraform.io/hashicorp/aws/aws.zip", "mirror.example.com/hashicorp/aws/aws.zip"} {
+		if err := putArchiveAt(t, fs, path, 100, now.Add(-time.Hour)); err != nil {
+			t.Fatalf("archive should fit: %v", err)
+		}
+	}
+	if err := putArchiveAt(t, fs, "registry.terraform.io/hashicorp/google/google.zip", 90, now); err != nil {
+		t.Fatalf("archive should fit: %v", err)
+	}
+	fs.cacheUsageCounted = time.Time{}
+	if err := putArchiveAt(t, fs, "registry.terraform.io/hashicorp/null/null.zip", 60, now); err != nil {
+		t.Fatalf("archive should fit when links are counted once: %v", err)
+	}
+	if exists, _ := fs.ExistsArchive(context.Background(), "registry.terraform.io/hashicorp/aws/aws.zip"); !exists {
+		t.Fatal("expected no eviction while the linked archive is counted once")
+	}
+
+	// Evicting the linked archive removes every link, or it would free nothing
+	if err := putArchiveAt(t, fs, "registry.terraform.io/hashicorp/random/random.zip", 80, now); err != nil {
+		t.Fatalf("archive should fit after eviction: %v", err)
+	}
+	for _, path := range []string{"registry.terraform.io/hashicorp/aws/aws.zip", "mirror.example.com/hashicorp/aws/aws.zip"} {
+		if exists, _ := fs.ExistsArchive(context.Background(), path); exists {
+			t.Errorf("expected %s to be evicted", path)
+		}
+	}
+	if exists, _ := fs.ExistsArchive(context.Background(), "registry.terraform.io/hashicorp/google/google.zip"); !exists {
+		t.Error("expected the newer archive to be kept")
+	}
+}
@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrReadOnly is returned by every write to a ReadOnly storage
+var ErrReadOnly = errors.New("storage is read-only")
+
+// ReadOnly serves reads from another backend and rejects every write and delete with ErrReadOnly,
+// for caches seeded ahead of time and shipped on immutable media such as container layers
+// It has no Unwrap method on purpose: optional interfaces that modify the cache, such as garbage
+// collection or retention, stay out of reach. The read-only optional interfaces are forwarded
+type ReadOnly struct {
+	backend Storage
+}
+
+// NewReadOnly creates a storage serving reads from backend and rejecting writes
+func NewReadOnly(backend Storage) *ReadOnly {
+	return &ReadOnly{backend: backend}
+}
+
+// GetIndex retrieves the cached index.json for a provider
+func (r *ReadOnly) GetIndex(ctx context.Context, hostname, namespace, providerType string) ([]byte, error) {
+	return r.backend.GetIndex(ctx, hostname, namespace, providerType)
+}
+
+// PutIndex returns ErrReadOnly
+func (r *ReadOnly) PutIndex(ctx context.Context, hostname, namespace, providerType string, data []byte) error {
+	return ErrReadOnly
+}
+
+// GetVersion retrieves the cached version.json for a specific provider version
+func (r *ReadOnly) GetVersion(ctx context.Context, hostname, namespace, providerType, version string) ([]byte, error) {
+	return r.backend.GetVersion(ctx, hostname, namespace, providerType, version)
+}
+
+// PutVersion returns ErrReadOnly
+func (r *ReadOnly) PutVersion(ctx context.Context, hostname, namespace, providerType, version string, data []byte) error {
+	return ErrReadOnly
+}
+
+// GetVersionsResponse retrieves the cached full versions API response
+func (r *ReadOnly) GetVersionsResponse(ctx context.Context, hostname, namespace, providerType string) ([]byte, error) {
+	return r.backend.GetVersionsResponse(ctx, hostname, namespace, providerType)
+}
+
+// PutVersionsResponse returns ErrReadOnly
+func (r *ReadOnly) PutVersionsResponse(ctx context.Context, hostname, namespace, providerType string, data []byte) error {
+	return ErrReadOnly
+}
+
+// GetArchive retrieves a cached provider archive
+func (r *ReadOnly) GetArchive(ctx context.Context, path string) (io.ReadCloser, error) {
+	return r.backend.GetArchive(ctx, path)
+}
+
+// PutArchive returns ErrReadOnly without reading data
+func (r *ReadOnly) PutArchive(ctx context.Context, path string, data io.Reader) error {
+	return ErrReadOnly
+}
+
+// ExistsArchive checks if an archive exists
+func (r *ReadOnly) ExistsArchive(ctx context.Context, path string) (bool, error) {
+	return r.backend.ExistsArchive(ctx, path)
+}
+
+// DeleteIndex returns ErrReadOnly
+func (r *ReadOnly) DeleteIndex(ctx context.Context, hostname, namespace, providerType string) error {
+	return ErrReadOnly
+}
+
+// DeleteVersion returns ErrReadOnly
+func (r *ReadOnly) DeleteVersion(ctx context.Context, hostname, namespace, providerType, version string) error {
+	return ErrReadOnly
+}
+
+// DeleteArchive returns ErrReadOnly
+func (r *ReadOnly) DeleteArchive(ctx context.Context, path string) error {
+	return ErrReadOnly
+}
+
+// PurgeProvider returns ErrReadOnly
+func (r *ReadOnly) PurgeProvider(ctx context.Context, hostname, namespace, providerType string) error {
+	return ErrReadOnly
+}
+
+// ListProviders returns every provider with a cached index.json, sorted
+func (r *ReadOnly) ListProviders(ctx context.Context) ([]Provider, error) {
+	return r.backend.ListProviders(ctx)
+}
+
+// ListVersions returns the versions of a provider with a cached version.json, sorted by name
+func (r *ReadOnly) ListVersions(ctx context.Context, hostname, namespace, providerType string) ([]string, error) {
+	return r.backend.ListVersions(ctx, hostname, namespace, providerType)
+}
+
+// StatArchive returns the size and modification time of a cached archive
+func (r *ReadOnly) StatArchive(ctx context.Context, path string) (ArchiveInfo, error) {
+	return r.backend.StatArchive(ctx, path)
+}
+
+// IndexModTime returns when the index.json for a provider was cached
+// Returns ErrNotFound if the backend does not track modification times
+func (r *ReadOnly) IndexModTime(ctx context.Context, hostname, namespace, providerType string) (time.Time, error) {
+	reporter, ok := As[ModTimeReporter](r.backend)
+	if !ok {
+		return time.Time{}, ErrNotFound
+	}
+	return reporter.IndexModTime(ctx, hostname, namespace, providerType)
+}
+
+// VersionModTime returns when the version.json for a provider version was cached
+// Returns ErrNotFound if the backend does not track modification times
+func (r *ReadOnly) VersionModTime(ctx context.Context, hostname, namespace, providerType, version string) (time.Time, error) {
+	reporter, ok := As[ModTimeReporter](r.backend)
+	if !ok {
+		return time.Time{}, ErrNotFound
+	}
+	return reporter.VersionModTime(ctx, hostname, namespace, providerType, version)
+}
+
+// ArchiveModTime returns when a provider archive was cached
+func (r *ReadOnly) ArchiveModTime(ctx context.Context, path string) (time.Time, error) {
+	info, err := r.backend.StatArchive(ctx, path)
+	return info.ModTime, err
+}
+
+// ArchiveChecksum returns the recorded SHA-256 of a cached archive
+// Returns ErrNotFound if the backend does not record checksums
+func (r *ReadOnly) ArchiveChecksum(ctx context.Context, path string) (string, error) {
+	reporter, ok := As[ChecksumReporter](r.backend)
+	if !ok {
+		return "", ErrNotFound
+	}
+	return reporter.ArchiveChecksum(ctx, path)
+}
+
+// DiskUsage returns the capacity and usage of the disk holding the cache
+// Returns ErrNotFound if the backend does not live on a disk
+func (r *ReadOnly) DiskUsage(ctx context.Context) (DiskUsage, error) {
+	reporter, ok := As[UsageReporter](r.backend)
+	if !ok {
+		return DiskUsage{}, ErrNotFound
+	}
+	return reporter.DiskUsage(ctx)
+}
+
+// SignArchiveURL returns a short-lived URL to a cached archive
+// Returns ErrNotFound if the backend cannot sign URLs, so the archive is served through the mirror
+func (r *ReadOnly) SignArchiveURL(ctx context.Context, path string, expiry time.Duration) (string, error) {
+	signer, ok := As[ArchiveURLSigner](r.backend)
+	if !ok {
+		return "", ErrNotFound
+	}
+	return signer.SignArchiveURL(ctx, path, expiry)
+}
+
+// EntryInfo returns the record of a cached entry
+// Returns ErrNotFound if the backend does not keep entry records
+func (r *ReadOnly) EntryInfo(ctx context.Context, entry string) (EntryInfo, error) {
+	store, ok := As[EntryInfoStore](r.backend)
+	if !ok {
+		return EntryInfo{}, ErrNotFound
+	}
+	return store.EntryInfo(ctx, entry)
+}
+
+// PutEntryInfo returns ErrReadOnly
+func (r *ReadOnly) PutEntryInfo(ctx context.Context, entry string, info EntryInfo) error {
+	return ErrReadOnly
+}
+
+// GetState returns a stored state document
+// Returns ErrNotFound if the backend does not keep state
+func (r *ReadOnly) GetState(ctx context.Context, name string) ([]byte, error) {
+	store, ok := As[StateStore](r.backend)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return store.GetState(ctx, name)
+}
+
+// PutState returns ErrReadOnly
+func (r *ReadOnly) PutState(ctx context.Context, name string, data []byte) error {
+	return ErrReadOnly
+}
+
+// Backup writes a backup of the backend, which does not write to it
+// Returns ErrNotFound if the backend cannot be backed up
+func (r *ReadOnly) Backup(ctx context.Context, w io.Writer, opts BackupOptions) (BackupManifest, error) {
+	backuper, ok := As[Backuper](r.backend)
+	if !ok {
+		return BackupManifest{}, ErrNotFound
+	}
+	return backuper.Backup(ctx, w, opts)
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadOnly(t *testing.T) {
+	ctx := context.Background()
+	fs, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	fs.PutIndex(ctx, "registry.terraform.io", "hashicorp", "aws", []byte(`{"versions":{}}`))
+	fs.PutArchive(ctx, "registry.terraform.io/hashicorp/aws/aws.zip", strings.NewReader("zip"))
+	ro := NewReadOnly(fs)
+
+	if data, err := ro.GetIndex(ctx, "registry.terraform.io", "hashicorp", "aws"); err != nil || string(data) != `{"versions":{}}` {
+		t.Errorf("GetIndex = %s, %v", data, err)
+	}
+	rc, err := ro.GetArchive(ctx, "registry.terraform.io/hashicorp/aws/aws.zip")
+	if err != nil {
+		t.Fatalf("GetArchive failed: %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "zip" {
+		t.Errorf("GetArchive = %q", data)
+	}
+	if sum, err := ro.ArchiveChecksum(ctx, "registry.terraform.io/hashicorp/aws/aws.zip"); err != nil || sum == "" {
+		t.Errorf("expected the checksum to be forwarded, got %q, %v", sum, err)
+	}
+
+	for name, err := range map[string]error{
+		"PutIndex":      ro.PutIndex(ctx, "registry.terraform.io", "hashicorp", "aws", []byte(`{}`)),
+		"PutArchive":    ro.PutArchive(ctx, "registry.terraform.io/hashicorp/aws/aws.zip", strings.NewReader("new")),
+		"DeleteArchive": ro.DeleteArchive(ctx, "registry.terraform.io/hashicorp/aws/aws.zip"),
+		"PurgeProvider": ro.PurgeProvider(ctx, "registry.terraform.io", "hashicorp", "aws"),
+	} {
+		if !errors.Is(err, ErrReadOnly) {
+			t.Errorf("%s: expected ErrReadOnly, got %v", name, err)
+		}
+	}
+	if data, _ := fs.GetIndex(ctx, "registry.terraform.io", "hashicorp", "aws"); string(data) != `{"versions":{}}` {
+		t.Errorf("expected the backend to be left alone, got %s", data)
+	}
+
+	// Interfaces that modify the cache are out of reach
+	if _, ok := As[GarbageCollector](ro); ok {
+		t.Error("expected GarbageCollector to be hidden")
+	}
+	if _, ok := As[Expirer](ro); ok {
+		t.Error("expected Expirer to be hidden")
+	}
+	if _, err := NewReadOnly(NewMemoryStorage()).DiskUsage(ctx); !IsNotFound(err) {
+		t.Errorf("expected ErrNotFound for a backend without disk usage, got %v", err)
+	}
+	if manifest, err := ro.Backup(ctx, io.Discard, BackupOptions{Archives: true}); err != nil || manifest.Files == 0 {
+		t.Errorf("expected a backup of the backend, got %+v, %v", manifest, err)
+	}
+}
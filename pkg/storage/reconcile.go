@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// CacheContents summarizes the archives found in the cache by a reconciliation
+type CacheContents struct {
+	// Archives and Bytes count every cached archive, sidecars excluded
+	Archives int   `json:"archives"`
+	Bytes    int64 `json:"bytes"`
+	// Adopted counts archives added out-of-band that had their checksum and size recorded
+	Adopted int `json:"adopted"`
+	// Orphans counts sidecar files removed because their archive was deleted out-of-band
+	Orphans int `json:"orphans"`
+}
+
+// Reconciler is implemented by storage backends whose contents can change outside the process
+type Reconciler interface {
+	// Reconcile brings the storage's records in line with what is actually stored
+	Reconcile(ctx context.Context) (CacheContents, error)
+}
+
+// Reconcile scans the cache directory for changes made outside Specular, such as seeding with rsync or
+// manual cleanup. Archives without a recorded checksum get one, and sidecars of deleted archives are removed
+func (fs *FilesystemStorage) Reconcile(ctx context.Context) (CacheContents, error) {
+	var contents CacheContents
+	err := fs.walkRoots(func(_, path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if name == ".specular-internal" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(name, ".tmp-") || isMetadataFile(path) {
+			return nil
+		}
+
+		if ext := filepath.Ext(name); slices.Contains(archiveSidecars, ext) {
+			archive := strings.TrimSuffix(path, ext)
+			if _, err := os.Stat(archive); errors.Is(err, os.ErrNotExist) && os.Remove(path) == nil {
+				slog.Info("removed sidecar of archive deleted outside specular", "path", path)
+				contents.Orphans++
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		contents.Archives++
+		contents.Bytes += info.Size()
+
+		adopted, err := adoptArchive(path, info.Size())
+		if err != nil {
+			return err
+		}
+		if adopted {
+			slog.Info("recorded checksum of archive added outside specular", "path", path)
+			contents.Adopted++
+		}
+		return nil
+	})
+	if err != nil {
+		return contents, fmt.Errorf("failed to scan cache directory: %w", err)
+	}
+	return contents, nil
+}
+
+// adoptArchive records the checksum and size of an archive that has no checksum yet
+// The archive is trusted as found, verification only catches later changes
+func adoptArchive(fullPath string, size int64) (bool, error) {
+	if _, err := readChecksum(fullPath); !errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	sum, err := fileSHA256(fullPath)
+	if errors.Is(err, ErrNotFound) {
+		// Removed since the walk started
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := writeChecksum(fullPath, sum); err != nil {
+		return false, err
+	}
+	if err := writeSize(fullPath, size); err != nil {
+		return false, err
+	}
+	return true, nil
+}
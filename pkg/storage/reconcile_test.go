@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReconcile(t *testing.T) {
+	fs, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	ctx := context.Background()
+
+	cached := "registry.terraform.io/hashicorp/aws/cached.zip"
+	deleted := "registry.terraform.io/hashicorp/aws/deleted.zip"
+	seeded := "registry.terraform.io/hashicorp/aws/seeded.zip"
+	for _, path := range []string{cached, deleted} {
+		if err := fs.PutArchive(ctx, path, strings.NewReader("archive data")); err != nil {
+			t.Fatalf("PutArchive failed: %v", err)
+		}
+	}
+	if err := fs.PutIndex(ctx, "registry.terraform.io", "hashicorp", "aws", []byte(`{}`)); err != nil {
+		t.Fatalf("PutIndex failed: %v", err)
+	}
+
+	// Changes made outside specular
+	if err := os.Remove(fs.archivePath(deleted)); err != nil {
+		t.Fatalf("failed to delete archive: %v", err)
+	}
+	if err := os.WriteFile(fs.archivePath(seeded), []byte("seeded"), 0644); err != nil {
+		t.Fatalf("failed to seed archive: %v", err)
+	}
+
+	contents, err := fs.Reconcile(ctx)
+	if err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	want := CacheContents{Archives: 2, Bytes: int64(len("archive data") + len("seeded")), Adopted: 1, Orphans: 2}
+	if contents != want {
+		t.Errorf("Reconcile = %+v, want %+v", contents, want)
+	}
+
+	seededSum := sha256.Sum256([]byte("seeded"))
+	if sum, err := fs.ArchiveChecksum(ctx, seeded); err != nil || sum != hex.EncodeToString(seededSum[:]) {
+		t.Errorf("expected seeded archive checksum %x, got %q, %v", seededSum, sum, err)
+	}
+	for _, suffix := range archiveSidecars {
+		if _, err := os.Stat(fs.archivePath(deleted) + suffix); !os.IsNotExist(err) {
+			t.Errorf("expected %s sidecar of deleted archive to be removed", suffix)
+		}
+	}
+
+	// A second pass finds nothing to change
+	contents, err = fs.Reconcile(ctx)
+	if err != nil || contents.Adopted != 0 || contents.Orphans != 0 || contents.Archives != 2 {
+		t.Errorf("second Reconcile = %+v, %v", contents, err)
+	}
+	if _, err := os.Stat(filepath.Join(fs.cacheDir, "registry.terraform.io", "hashicorp", "aws", "index.json")); err != nil {
+		t.Errorf("expected index to be kept: %v", err)
+	}
+}
@@ -0,0 +1,344 @@
+package storage
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RedisConfig configures the server of a RedisStorage
+type RedisConfig struct {
+	// URL of the server, as redis://[user:password@]host[:port][/db], or rediss:// for TLS
+	URL string
+	// Prefix is prepended to every key, so the cache can share a database
+	Prefix string
+	// Timeout bounds each command, 5 seconds when zero
+	Timeout time.Duration
+	// MaxIdleConns is how many connections are kept open for reuse, 10 when zero
+	MaxIdleConns int
+}
+
+// RedisStorage keeps index, version and versions API responses in Redis and archives in another backend,
+// so several mirror replicas pointed at the same server share the metadata cache
+// Each entry is a hash with the data and the time it was written, providers and their versions are
+// tracked in sets so they can be listed without scanning the keyspace
+type RedisStorage struct {
+	client   *redisClient
+	prefix   string
+	archives Storage
+}
+
+// NewRedisStorage creates a storage keeping metadata in Redis and archives in archives
+// No connection is made until the storage is used
+func NewRedisStorage(cfg RedisConfig, archives Storage) (*RedisStorage, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid Redis URL %q", cfg.URL)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	db := 0
+	if path := strings.Trim(u.Path, "/"); path != "" {
+		if db, err = strconv.Atoi(path); err != nil || db < 0 {
+			return nil, fmt.Errorf("invalid Redis database %q", path)
+		}
+	}
+	var tlsConfig *tls.Config
+	if u.Scheme == "rediss" {
+		tlsConfig = &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}
+	}
+	password, _ := u.User.Password()
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	maxIdle := cfg.MaxIdleConns
+	if maxIdle <= 0 {
+		maxIdle = 10
+	}
+	return &RedisStorage{
+		client:   newRedisClient(addr, u.User.Username(), password, db, tlsConfig, timeout, maxIdle),
+		prefix:   cfg.Prefix,
+		archives: archives,
+	}, nil
+}
+
+// Unwrap returns the backend holding archives
+func (s *RedisStorage) Unwrap() Storage {
+	return s.archives
+}
+
+// Close closes the connections kept for reuse
+func (s *RedisStorage) Close() error {
+	return s.client.close()
+}
+
+// Ping checks that the Redis server is reachable
+func (s *RedisStorage) Ping(ctx context.Context) error {
+	_, err := s.client.do(ctx, "PING")
+	return err
+}
+
+// GetIndex retrieves the cached index.json for a provider
+func (s *RedisStorage) GetIndex(ctx context.Context, hostname, namespace, providerType string) ([]byte, error) {
+	if err := validateProviderPath(hostname, namespace, providerType); err != nil {
+		return nil, err
+	}
+	return s.get(ctx, s.key("index", hostname, namespace, providerType))
+}
+
+// PutIndex stores the index.json for a provider and adds it to the listed providers
+func (s *RedisStorage) PutIndex(ctx context.Context, hostname, namespace, providerType string, data []byte) error {
+	if err := validateProviderPath(hostname, namespace, providerType); err != nil {
+		return err
+	}
+	_, err := s.client.transaction(ctx,
+		s.set(s.key("index", hostname, namespace, providerType), data),
+		[]string{"SADD", s.prefix + "providers", providerMember(hostname, namespace, providerType)},
+	)
+	return wrapRedisError("failed to write index", err)
+}
+
+// GetVersion retrieves the cached version.json for a specific provider version
+func (s *RedisStorage) GetVersion(ctx context.Context, hostname, namespace, providerType, version string) ([]byte, error) {
+	if err := validateProviderPath(hostname, namespace, providerType); err != nil {
+		return nil, err
+	}
+	return s.get(ctx, s.key("version", hostname, namespace, providerType, version))
+}
+
+// PutVersion stores the version.json for a specific provider version and adds it to the provider's versions
+func (s *RedisStorage) PutVersion(ctx context.Context, hostname, namespace, providerType, version string, data []byte) error {
+	if err := validateProviderPath(hostname, namespace, providerType); err != nil {
+		return err
+	}
+	if version == "" {
+		return errors.New("version cannot be empty")
+	}
+	_, err := s.client.transaction(ctx,
+		s.set(s.key("version", hostname, namespace, providerType, version), data),
+		[]string{"SADD", s.key("versions", hostname, namespace, providerType), version},
+	)
+	return wrapRedisError("failed to write version", err)
+}
+
+// GetVersionsResponse retrieves the cached full versions API response
+func (s *RedisStorage) GetVersionsResponse(ctx context.Context, hostname, namespace, providerType string) ([]byte, error) {
+	if err := validateProviderPath(hostname, namespace, providerType); err != nil {
+		return nil, err
+	}
+	return s.get(ctx, s.key("versions-response", hostname, namespace, providerType))
+}
+
+// PutVersionsResponse stores the full versions API response
+func (s *RedisStorage) PutVersionsResponse(ctx context.Context, hostname, namespace, providerType string, data []byte) error {
+	if err := validateProviderPath(hostname, namespace, providerType); err != nil {
+		return err
+	}
+	_, err := s.client.do(ctx, s.set(s.key("versions-response", hostname, namespace, providerType), data)...)
+	return wrapRedisError("failed to write versions response", err)
+}
+
+// GetArchive retrieves a cached provider archive from the archive backend
+func (s *RedisStorage) GetArchive(ctx context.Context, path string) (io.ReadCloser, error) {
+	return s.archives.GetArchive(ctx, path)
+}
+
+// PutArchive stores a provider archive in the archive backend
+func (s *RedisStorage) PutArchive(ctx context.Context, path string, data io.Reader) error {
+	return s.archives.PutArchive(ctx, path, data)
+}
+
+// ExistsArchive checks if an archive exists in the archive backend
+func (s *RedisStorage) ExistsArchive(ctx context.Context, path string) (bool, error) {
+	return s.archives.ExistsArchive(ctx, path)
+}
+
+// IndexModTime returns when the index.json for a provider was cached
+func (s *RedisStorage) IndexModTime(ctx context.Context, hostname, namespace, providerType string) (time.Time, error) {
+	if err := validateProviderPath(hostname, namespace, providerType); err != nil {
+		return time.Time{}, err
+	}
+	return s.modTime(ctx, s.key("index", hostname, namespace, providerType))
+}
+
+// VersionModTime returns when the version.json for a provider version was cached
+func (s *RedisStorage) VersionModTime(ctx context.Context, hostname, namespace, providerType, version string) (time.Time, error) {
+	if err := validateProviderPath(hostname, namespace, providerType); err != nil {
+		return time.Time{}, err
+	}
+	return s.modTime(ctx, s.key("version", hostname, namespace, providerType, version))
+}
+
+// ArchiveModTime returns when a provider archive was cached, as reported by the archive backend
+func (s *RedisStorage) ArchiveModTime(ctx context.Context, path string) (time.Time, error) {
+	info, err := s.archives.StatArchive(ctx, path)
+	return info.ModTime, err
+}
+
+// DeleteIndex removes the cached index.json and versions API response of a provider
+func (s *RedisStorage) DeleteIndex(ctx context.Context, hostname, namespace, providerType string) error {
+	if err := validateProviderPath(hostname, namespace, providerType); err != nil {
+		return err
+	}
+	_, err := s.client.transaction(ctx,
+		[]string{"DEL", s.key("index", hostname, namespace, providerType), s.key("versions-response", hostname, namespace, providerType)},
+		[]string{"SREM", s.prefix + "providers", providerMember(hostname, namespace, providerType)},
+	)
+	return wrapRedisError("failed to delete index", err)
+}
+
+// DeleteVersion removes the cached version.json for a specific provider version
+func (s *RedisStorage) DeleteVersion(ctx context.Context, hostname, namespace, providerType, version string) error {
+	if err := validateProviderPath(hostname, namespace, providerType); err != nil {
+		return err
+	}
+	if version == "" {
+		return errors.New("version cannot be empty")
+	}
+	_, err := s.client.transaction(ctx,
+		[]string{"DEL", s.key("version", hostname, namespace, providerType, version)},
+		[]string{"SREM", s.key("versions", hostname, namespace, providerType), version},
+	)
+	return wrapRedisError("failed to delete version", err)
+}
+
+// DeleteArchive removes a cached provider archive from the archive backend
+func (s *RedisStorage) DeleteArchive(ctx context.Context, path string) error {
+	return s.archives.DeleteArchive(ctx, path)
+}
+
+// PurgeProvider removes the provider's metadata from Redis and its archives from the archive backend
+func (s *RedisStorage) PurgeProvider(ctx context.Context, hostname, namespace, providerType string) error {
+	versions, err := s.ListVersions(ctx, hostname, namespace, providerType)
+	if err != nil {
+		return err
+	}
+	del := []string{
+		"DEL",
+		s.key("index", hostname, namespace, providerType),
+		s.key("versions-response", hostname, namespace, providerType),
+		s.key("versions", hostname, namespace, providerType),
+	}
+	for _, version := range versions {
+		del = append(del, s.key("version", hostname, namespace, providerType, version))
+	}
+	_, err = s.client.transaction(ctx, del,
+		[]string{"SREM", s.prefix + "providers", providerMember(hostname, namespace, providerType)},
+	)
+	if err != nil {
+		return wrapRedisError("failed to purge provider", err)
+	}
+	return s.archives.PurgeProvider(ctx, hostname, namespace, providerType)
+}
+
+// ListProviders returns every provider with a cached index.json, sorted
+func (s *RedisStorage) ListProviders(ctx context.Context) ([]Provider, error) {
+	members, err := s.members(ctx, s.prefix+"providers")
+	if err != nil {
+		return nil, err
+	}
+	var providers []Provider
+	for _, member := range members {
+		if parts := strings.Split(member, "/"); len(parts) == 3 {
+			providers = append(providers, Provider{Hostname: parts[0], Namespace: parts[1], Type: parts[2]})
+		}
+	}
+	return sortProviders(providers), nil
+}
+
+// ListVersions returns the versions of a provider with a cached version.json, sorted by name
+func (s *RedisStorage) ListVersions(ctx context.Context, hostname, namespace, providerType string) ([]string, error) {
+	if err := validateProviderPath(hostname, namespace, providerType); err != nil {
+		return nil, err
+	}
+	versions, err := s.members(ctx, s.key("versions", hostname, namespace, providerType))
+	if err != nil {
+		return nil, err
+	}
+	return sortVersions(versions), nil
+}
+
+// StatArchive returns the size and modification time of a cached archive from the archive backend
+func (s *RedisStorage) StatArchive(ctx context.Context, path string) (ArchiveInfo, error) {
+	return s.archives.StatArchive(ctx, path)
+}
+
+// key returns the Redis key of a metadata entry
+func (s *RedisStorage) key(kind string, parts ...string) string {
+	return s.prefix + kind + ":" + strings.Join(parts, "/")
+}
+
+// set returns the command storing data in the hash at key, with the time it was written
+func (s *RedisStorage) set(key string, data []byte) []string {
+	return []string{"HSET", key, "data", string(data), "mtime", strconv.FormatInt(time.Now().UnixNano(), 10)}
+}
+
+// get returns the data stored in the hash at key, or ErrNotFound
+func (s *RedisStorage) get(ctx context.Context, key string) ([]byte, error) {
+	reply, err := s.client.do(ctx, "HGET", key, "data")
+	if err != nil {
+		return nil, wrapRedisError("failed to read metadata", err)
+	}
+	data, ok := reply.([]byte)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return data, nil
+}
+
+// modTime returns when the hash at key was written, or ErrNotFound
+func (s *RedisStorage) modTime(ctx context.Context, key string) (time.Time, error) {
+	reply, err := s.client.do(ctx, "HGET", key, "mtime")
+	if err != nil {
+		return time.Time{}, wrapRedisError("failed to read modification time", err)
+	}
+	data, ok := reply.([]byte)
+	if !ok {
+		return time.Time{}, ErrNotFound
+	}
+	nanos, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid modification time of %s: %w", key, err)
+	}
+	return time.Unix(0, nanos), nil
+}
+
+// members returns the members of the set at key
+func (s *RedisStorage) members(ctx context.Context, key string) ([]string, error) {
+	reply, err := s.client.do(ctx, "SMEMBERS", key)
+	if err != nil {
+		return nil, wrapRedisError("failed to list members", err)
+	}
+	items, _ := reply.([]any)
+	members := make([]string, 0, len(items))
+	for _, item := range items {
+		if member, ok := item.([]byte); ok {
+			members = append(members, string(member))
+		}
+	}
+	return members, nil
+}
+
+// providerMember returns the member of the providers set for a provider
+func providerMember(hostname, namespace, providerType string) string {
+	return hostname + "/" + namespace + "/" + providerType
+}
+
+// wrapRedisError adds context to a failed command, nil stays nil
+func wrapRedisError(msg string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
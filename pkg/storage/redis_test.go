@@ -0,0 +1,237 @@
+package storage_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+// fakeRedis is a Redis server holding hashes and sets in memory, with the commands RedisStorage sends
+type fakeRedis struct {
+	password string
+	mu       sync.Mutex
+	hashes   map[string]map[string]string
+	sets     map[string]map[string]bool
+}
+
+// newFakeRedis starts a fake Redis server requiring password when set and returns its URL
+func newFakeRedis(t *testing.T, password string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	f := &fakeRedis{password: password, hashes: make(map[string]map[string]string), sets: make(map[string]map[string]bool)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return "redis://" + listener.Addr().String()
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authenticated := f.password == ""
+	var queued [][]string
+	inMulti := false
+	for {
+		cmd, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		name := strings.ToUpper(cmd[0])
+		switch {
+		case name == "AUTH":
+			if cmd[len(cmd)-1] != f.password {
+				io.WriteString(conn, "-WRONGPASS invalid password\r\n")
+				continue
+			}
+			authenticated = true
+			io.WriteString(conn, "+OK\r\n")
+		case !authenticated:
+			io.WriteString(conn, "-NOAUTH Authentication required.\r\n")
+		case name == "MULTI":
+			inMulti = true
+			queued = nil
+			io.WriteString(conn, "+OK\r\n")
+		case name == "EXEC":
+			fmt.Fprintf(conn, "*%d\r\n", len(queued))
+			for _, c := range queued {
+				io.WriteString(conn, f.run(c))
+			}
+			inMulti = false
+		case inMulti:
+			queued = append(queued, cmd)
+			io.WriteString(conn, "+QUEUED\r\n")
+		default:
+			io.WriteString(conn, f.run(cmd))
+		}
+	}
+}
+
+// run executes a command and returns its encoded reply
+func (f *fakeRedis) run(cmd []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch strings.ToUpper(cmd[0]) {
+	case "PING":
+		return "+PONG\r\n"
+	case "SELECT":
+		return "+OK\r\n"
+	case "HSET":
+		hash := f.hashes[cmd[1]]
+		if hash == nil {
+			hash = make(map[string]string)
+			f.hashes[cmd[1]] = hash
+		}
+		for i := 2; i+1 < len(cmd); i += 2 {
+			hash[cmd[i]] = cmd[i+1]
+		}
+		return ":1\r\n"
+	case "HGET":
+		value, ok := f.hashes[cmd[1]][cmd[2]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	case "DEL":
+		deleted := 0
+		for _, key := range cmd[1:] {
+			if _, ok := f.hashes[key]; ok {
+				deleted++
+			}
+			if _, ok := f.sets[key]; ok {
+				deleted++
+			}
+			delete(f.hashes, key)
+			delete(f.sets, key)
+		}
+		return fmt.Sprintf(":%d\r\n", deleted)
+	case "SADD":
+		set := f.sets[cmd[1]]
+		if set == nil {
+			set = make(map[string]bool)
+			f.sets[cmd[1]] = set
+		}
+		for _, member := range cmd[2:] {
+			set[member] = true
+		}
+		return ":1\r\n"
+	case "SREM":
+		for _, member := range cmd[2:] {
+			delete(f.sets[cmd[1]], member)
+		}
+		return ":1\r\n"
+	case "SMEMBERS":
+		var b strings.Builder
+		fmt.Fprintf(&b, "*%d\r\n", len(f.sets[cmd[1]]))
+		for member := range f.sets[cmd[1]] {
+			fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(member), member)
+		}
+		return b.String()
+	default:
+		return "-ERR unknown command '" + cmd[0] + "'\r\n"
+	}
+}
+
+// readCommand reads a command sent as an array of bulk strings
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+	cmd := make([]string, n)
+	for i := range cmd {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		cmd[i] = string(data[:size])
+	}
+	return cmd, nil
+}
+
+func newTestRedisStorage(t *testing.T, url string, archives storage.Storage) *storage.RedisStorage {
+	t.Helper()
+	s, err := storage.NewRedisStorage(storage.RedisConfig{URL: url, Prefix: "specular:"}, archives)
+	if err != nil {
+		t.Fatalf("NewRedisStorage failed: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestRedisStorage_SharedBetweenReplicas(t *testing.T) {
+	ctx := context.Background()
+	url := newFakeRedis(t, "")
+	archives := storage.NewMemoryStorage()
+	first := newTestRedisStorage(t, url, archives)
+	second := newTestRedisStorage(t, url, storage.NewMemoryStorage())
+
+	if err := first.PutIndex(ctx, "registry.terraform.io", "hashicorp", "aws", []byte(`{"versions":{}}`)); err != nil {
+		t.Fatalf("PutIndex failed: %v", err)
+	}
+	if data, err := second.GetIndex(ctx, "registry.terraform.io", "hashicorp", "aws"); err != nil || string(data) != `{"versions":{}}` {
+		t.Errorf("expected the other replica to read the index, got %s, %v", data, err)
+	}
+	if providers, _ := second.ListProviders(ctx); len(providers) != 1 || providers[0].Type != "aws" {
+		t.Errorf("expected the other replica to list the provider, got %v", providers)
+	}
+
+	// Archives stay in their own backend
+	first.PutArchive(ctx, "registry.terraform.io/hashicorp/aws/aws.zip", strings.NewReader("zip"))
+	if exists, _ := archives.ExistsArchive(ctx, "registry.terraform.io/hashicorp/aws/aws.zip"); !exists {
+		t.Error("expected the archive in the archive backend")
+	}
+	if _, ok := storage.As[*storage.MemoryStorage](first); !ok {
+		t.Error("expected the archive backend to be reachable with As")
+	}
+}
+
+func TestRedisStorage_Auth(t *testing.T) {
+	ctx := context.Background()
+	url := newFakeRedis(t, "secret")
+
+	s := newTestRedisStorage(t, strings.Replace(url, "redis://", "redis://:secret@", 1)+"/2", storage.NewMemoryStorage())
+	if err := s.Ping(ctx); err != nil {
+		t.Errorf("Ping with the password failed: %v", err)
+	}
+	wrong := newTestRedisStorage(t, strings.Replace(url, "redis://", "redis://:wrong@", 1), storage.NewMemoryStorage())
+	if err := wrong.Ping(ctx); err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Errorf("expected a WRONGPASS error, got %v", err)
+	}
+}
+
+func TestNewRedisStorage_Invalid(t *testing.T) {
+	for _, url := range []string{"localhost:6379", "http://localhost:6379", "redis://", "redis://localhost/db"} {
+		if _, err := storage.NewRedisStorage(storage.RedisConfig{URL: url}, storage.NewMemoryStorage()); err == nil {
+			t.Errorf("expected an error for %q", url)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package storage
+
+import (
+	"errors"
+	"os"
+)
+
+// cloneFile is not implemented on this platform
+func cloneFile(dst, src *os.File) error {
+	return errors.New("reflinks are not supported on this platform")
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+)
+
+// Factory creates a storage backend registered with Register
+// Settings beyond Options are up to the backend, typically read from its own environment variables
+type Factory func(ctx context.Context, opts Options) (Storage, error)
+
+// Options are passed to the factories of registered backends
+type Options struct {
+	// CacheDir is the configured cache directory, for backends that keep local files
+	CacheDir string
+	Logger   *slog.Logger
+}
+
+// builtinBackends are configured by Specular itself and cannot be registered
+var builtinBackends = []string{"filesystem", "memory", "s3"}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes a storage backend available as a storage type, typically from the init function of its package
+// so that a blank import is enough to compile it in. Like database/sql.Register, it panics if name is empty,
+// already registered or the name of a built-in backend
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if name == "" || factory == nil {
+		panic("storage: Register requires a name and a factory")
+	}
+	if slices.Contains(builtinBackends, name) {
+		panic("storage: cannot register built-in backend " + name)
+	}
+	if _, ok := registry[name]; ok {
+		panic("storage: Register called twice for backend " + name)
+	}
+	registry[name] = factory
+}
+
+// Registered returns the names of the registered backends, sorted
+func Registered() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Open creates the registered backend called name
+func Open(ctx context.Context, name string, opts Options) (Storage, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown storage backend %q", name)
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	s, err := factory(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize %s storage: %w", name, err)
+	}
+	return s, nil
+}
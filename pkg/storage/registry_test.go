@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestRegister(t *testing.T) {
+	t.Cleanup(func() {
+		registryMu.Lock()
+		delete(registry, "test-backend")
+		delete(registry, "test-failing")
+		registryMu.Unlock()
+	})
+
+	var got Options
+	Register("test-backend", func(ctx context.Context, opts Options) (Storage, error) {
+		got = opts
+		return NewMemoryStorage(), nil
+	})
+	Register("test-failing", func(ctx context.Context, opts Options) (Storage, error) {
+		return nil, errors.New("cluster unreachable")
+	})
+	if names := Registered(); !slices.Equal(names, []string{"test-backend", "test-failing"}) {
+		t.Errorf("unexpected registered backends %v", names)
+	}
+
+	s, err := Open(context.Background(), "test-backend", Options{CacheDir: "/var/cache/specular"})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if _, ok := s.(*MemoryStorage); !ok || got.CacheDir != "/var/cache/specular" || got.Logger == nil {
+		t.Errorf("unexpected backend %T created with %+v", s, got)
+	}
+	if _, err := Open(context.Background(), "test-failing", Options{}); err == nil || err.Error() != "failed to initialize test-failing storage: cluster unreachable" {
+		t.Errorf("expected the factory error, got %v", err)
+	}
+	if _, err := Open(context.Background(), "ceph", Options{}); err == nil {
+		t.Error("expected an error opening an unregistered backend")
+	}
+
+	for _, name := range []string{"", "filesystem", "test-backend"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected Register(%q) to panic", name)
+				}
+			}()
+			Register(name, func(ctx context.Context, opts Options) (Storage, error) { return nil, nil })
+		}()
+	}
+}
@@ -0,0 +1,271 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+)
+
+// Replicated writes to a primary backend and one or more secondaries, such as a local cache directory
+// and an S3 bucket, so the secondaries are warm standbys of the primary. Reads go to the primary and
+// fall back to the secondaries, in order, when it misses or fails. Whatever a secondary serves is copied
+// back to the primary, so a primary replaced by an empty one fills up from the secondaries again
+// Writes only fail when the primary fails, secondaries failing are logged. Deletes apply to every backend,
+// so deleted entries are not served again from a secondary
+type Replicated struct {
+	primary     Storage
+	secondaries []Storage
+
+	// queue copies writes to the secondaries in the background, nil writes them synchronously
+	queue *replicationQueue
+}
+
+// NewReplicated creates a storage writing to primary and every secondary and reading from the first that has the data
+func NewReplicated(primary Storage, secondaries ...Storage) *Replicated {
+	return &Replicated{primary: primary, secondaries: secondaries}
+}
+
+// Unwrap returns the primary backend, optional interfaces such as retention only apply to it
+func (r *Replicated) Unwrap() Storage {
+	return r.primary
+}
+
+// GetIndex retrieves the cached index.json for a provider
+func (r *Replicated) GetIndex(ctx context.Context, hostname, namespace, providerType string) ([]byte, error) {
+	return r.getMetadata(ctx, "index", func(s Storage) ([]byte, error) {
+		return s.GetIndex(ctx, hostname, namespace, providerType)
+	}, func(s Storage, data []byte) error {
+		return s.PutIndex(ctx, hostname, namespace, providerType, data)
+	})
+}
+
+// PutIndex stores the index.json for a provider
+func (r *Replicated) PutIndex(ctx context.Context, hostname, namespace, providerType string, data []byte) error {
+	return r.put(ctx, "index", func(ctx context.Context, s Storage) error {
+		return s.PutIndex(ctx, hostname, namespace, providerType, data)
+	})
+}
+
+// GetVersion retrieves the cached version.json for a specific provider version
+func (r *Replicated) GetVersion(ctx context.Context, hostname, namespace, providerType, version string) ([]byte, error) {
+	return r.getMetadata(ctx, "version", func(s Storage) ([]byte, error) {
+		return s.GetVersion(ctx, hostname, namespace, providerType, version)
+	}, func(s Storage, data []byte) error {
+		return s.PutVersion(ctx, hostname, namespace, providerType, version, data)
+	})
+}
+
+// PutVersion stores the version.json for a specific provider version
+func (r *Replicated) PutVersion(ctx context.Context, hostname, namespace, providerType, version string, data []byte) error {
+	return r.put(ctx, "version", func(ctx context.Context, s Storage) error {
+		return s.PutVersion(ctx, hostname, namespace, providerType, version, data)
+	})
+}
+
+// GetVersionsResponse retrieves the cached full versions API response
+func (r *Replicated) GetVersionsResponse(ctx context.Context, hostname, namespace, providerType string) ([]byte, error) {
+	return r.getMetadata(ctx, "versions response", func(s Storage) ([]byte, error) {
+		return s.GetVersionsResponse(ctx, hostname, namespace, providerType)
+	}, func(s Storage, data []byte) error {
+		return s.PutVersionsResponse(ctx, hostname, namespace, providerType, data)
+	})
+}
+
+// PutVersionsResponse stores the full versions API response
+func (r *Replicated) PutVersionsResponse(ctx context.Context, hostname, namespace, providerType string, data []byte) error {
+	return r.put(ctx, "versions response", func(ctx context.Context, s Storage) error {
+		return s.PutVersionsResponse(ctx, hostname, namespace, providerType, data)
+	})
+}
+
+// GetArchive retrieves a cached provider archive
+// An archive found on a secondary is copied to the primary first, and served from the secondary if that fails
+func (r *Replicated) GetArchive(ctx context.Context, path string) (io.ReadCloser, error) {
+	rc, err := r.primary.GetArchive(ctx, path)
+	if err == nil {
+		return rc, nil
+	}
+	for _, secondary := range r.secondaries {
+		src, serr := secondary.GetArchive(ctx, path)
+		if serr != nil {
+			continue
+		}
+		perr := r.primary.PutArchive(ctx, path, src)
+		src.Close()
+		if perr == nil {
+			if rc, perr = r.primary.GetArchive(ctx, path); perr == nil {
+				return rc, nil
+			}
+		}
+		slog.WarnContext(ctx, "failed to restore archive from secondary storage", "path", path, "error", perr)
+		return secondary.GetArchive(ctx, path)
+	}
+	return nil, err
+}
+
+// PutArchive stores a provider archive in the primary, then copies it from there to every secondary
+func (r *Replicated) PutArchive(ctx context.Context, path string, data io.Reader) error {
+	if err := r.primary.PutArchive(ctx, path, data); err != nil {
+		return err
+	}
+	r.replicate(ctx, "archive", func(ctx context.Context, s Storage) error {
+		err := copyArchive(ctx, r.primary, s, path)
+		if IsNotFound(err) {
+			// Deleted from the primary before a background copy got to it
+			return nil
+		}
+		return err
+	}, "path", path)
+	return nil
+}
+
+// ExistsArchive checks if an archive exists in any backend
+func (r *Replicated) ExistsArchive(ctx context.Context, path string) (bool, error) {
+	exists, err := r.primary.ExistsArchive(ctx, path)
+	if err == nil && exists {
+		return true, nil
+	}
+	for _, secondary := range r.secondaries {
+		if ok, serr := secondary.ExistsArchive(ctx, path); serr == nil && ok {
+			return true, nil
+		}
+	}
+	return exists, err
+}
+
+// DeleteIndex removes the cached index.json and versions API response of a provider from every backend
+func (r *Replicated) DeleteIndex(ctx context.Context, hostname, namespace, providerType string) error {
+	return r.each(func(s Storage) error {
+		return s.DeleteIndex(ctx, hostname, namespace, providerType)
+	})
+}
+
+// DeleteVersion removes the cached version.json for a specific provider version from every backend
+func (r *Replicated) DeleteVersion(ctx context.Context, hostname, namespace, providerType, version string) error {
+	return r.each(func(s Storage) error {
+		return s.DeleteVersion(ctx, hostname, namespace, providerType, version)
+	})
+}
+
+// DeleteArchive removes a cached provider archive from every backend
+func (r *Replicated) DeleteArchive(ctx context.Context, path string) error {
+	return r.each(func(s Storage) error {
+		return s.DeleteArchive(ctx, path)
+	})
+}
+
+// PurgeProvider removes everything cached for a provider from every backend
+func (r *Replicated) PurgeProvider(ctx context.Context, hostname, namespace, providerType string) error {
+	return r.each(func(s Storage) error {
+		return s.PurgeProvider(ctx, hostname, namespace, providerType)
+	})
+}
+
+// ListProviders returns every provider with a cached index.json in the primary, sorted
+// The first secondary that answers is listed instead when the primary fails
+func (r *Replicated) ListProviders(ctx context.Context) ([]Provider, error) {
+	providers, err := r.primary.ListProviders(ctx)
+	if err == nil {
+		return providers, nil
+	}
+	for _, secondary := range r.secondaries {
+		if providers, serr := secondary.ListProviders(ctx); serr == nil {
+			return providers, nil
+		}
+	}
+	return nil, err
+}
+
+// ListVersions returns the versions of a provider with a cached version.json in the primary, sorted by name
+// The first secondary that answers is listed instead when the primary fails
+func (r *Replicated) ListVersions(ctx context.Context, hostname, namespace, providerType string) ([]string, error) {
+	versions, err := r.primary.ListVersions(ctx, hostname, namespace, providerType)
+	if err == nil {
+		return versions, nil
+	}
+	for _, secondary := range r.secondaries {
+		if versions, serr := secondary.ListVersions(ctx, hostname, namespace, providerType); serr == nil {
+			return versions, nil
+		}
+	}
+	return nil, err
+}
+
+// StatArchive returns the size and modification time of a cached archive from the first backend holding it
+func (r *Replicated) StatArchive(ctx context.Context, path string) (ArchiveInfo, error) {
+	info, err := r.primary.StatArchive(ctx, path)
+	if err == nil {
+		return info, nil
+	}
+	for _, secondary := range r.secondaries {
+		if info, serr := secondary.StatArchive(ctx, path); serr == nil {
+			return info, nil
+		}
+	}
+	return ArchiveInfo{}, err
+}
+
+// getMetadata reads metadata from the primary, or from the first secondary holding it which is then copied to the primary
+func (r *Replicated) getMetadata(ctx context.Context, kind string, get func(Storage) ([]byte, error), put func(Storage, []byte) error) ([]byte, error) {
+	data, err := get(r.primary)
+	if err == nil {
+		return data, nil
+	}
+	for _, secondary := range r.secondaries {
+		data, serr := get(secondary)
+		if serr != nil {
+			continue
+		}
+		if perr := put(r.primary, data); perr != nil {
+			slog.WarnContext(ctx, "failed to restore "+kind+" from secondary storage", "error", perr)
+		}
+		return data, nil
+	}
+	return nil, err
+}
+
+// put writes to the primary, then to every secondary
+func (r *Replicated) put(ctx context.Context, kind string, put func(context.Context, Storage) error) error {
+	if err := put(ctx, r.primary); err != nil {
+		return err
+	}
+	r.replicate(ctx, kind, put)
+	return nil
+}
+
+// replicate writes to every secondary, logging the secondaries that fail, or queues the write in the background
+func (r *Replicated) replicate(ctx context.Context, kind string, put func(context.Context, Storage) error, logArgs ...any) {
+	if r.queue != nil {
+		r.queue.enqueue(replicationTask{kind: kind, put: put, queued: time.Now(), logArgs: logArgs})
+		return
+	}
+	for _, secondary := range r.secondaries {
+		if err := put(ctx, secondary); err != nil {
+			slog.WarnContext(ctx, "failed to replicate "+kind+" to secondary storage", append(logArgs, "error", err)...)
+		}
+	}
+}
+
+// each applies fn to every backend, returning every error
+func (r *Replicated) each(fn func(Storage) error) error {
+	errs := []error{fn(r.primary)}
+	for i, secondary := range r.secondaries {
+		if err := fn(secondary); err != nil {
+			errs = append(errs, fmt.Errorf("secondary storage %d: %w", i+1, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// copyArchive copies an archive from one backend to another
+func copyArchive(ctx context.Context, from, to Storage, path string) error {
+	rc, err := from.GetArchive(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return to.PutArchive(ctx, path, rc)
+}
@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elisiariocouto/specular/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// failingStorage fails every write, like a secondary that is unreachable
+type failingStorage struct {
+	*MemoryStorage
+}
+
+func (f failingStorage) PutIndex(ctx context.Context, hostname, namespace, providerType string, data []byte) error {
+	return errors.New("bucket unreachable")
+}
+
+func (f failingStorage) PutArchive(ctx context.Context, path string, data io.Reader) error {
+	return errors.New("bucket unreachable")
+}
+
+func TestReplicatedWritesEveryBackend(t *testing.T) {
+	ctx := context.Background()
+	primary, secondary := NewMemoryStorage(), NewMemoryStorage()
+	r := NewReplicated(primary, secondary, failingStorage{NewMemoryStorage()})
+
+	// A failing secondary does not fail the write
+	if err := r.PutIndex(ctx, "registry.terraform.io", "hashicorp", "aws", []byte(`{}`)); err != nil {
+		t.Fatalf("PutIndex failed: %v", err)
+	}
+	if err := r.PutArchive(ctx, "registry.terraform.io/hashicorp/aws/aws.zip", strings.NewReader("zip")); err != nil {
+		t.Fatalf("PutArchive failed: %v", err)
+	}
+	for name, s := range map[string]Storage{"primary": primary, "secondary": secondary} {
+		if _, err := s.GetIndex(ctx, "registry.terraform.io", "hashicorp", "aws"); err != nil {
+			t.Errorf("%s: index not written: %v", name, err)
+		}
+		if ok, _ := s.ExistsArchive(ctx, "registry.terraform.io/hashicorp/aws/aws.zip"); !ok {
+			t.Errorf("%s: archive not written", name)
+		}
+	}
+
+	// Deletes apply to every backend, so the secondary does not serve the entry again
+	if err := r.DeleteArchive(ctx, "registry.terraform.io/hashicorp/aws/aws.zip"); err != nil {
+		t.Fatalf("DeleteArchive failed: %v", err)
+	}
+	if _, err := r.GetArchive(ctx, "registry.terraform.io/hashicorp/aws/aws.zip"); !IsNotFound(err) {
+		t.Errorf("expected ErrNotFound after DeleteArchive, got %v", err)
+	}
+}
+
+func TestReplicatedFallsBackToSecondaries(t *testing.T) {
+	ctx := context.Background()
+	primary, first, second := NewMemoryStorage(), NewMemoryStorage(), NewMemoryStorage()
+	second.PutVersion(ctx, "registry.terraform.io", "hashicorp", "aws", "5.0.0", []byte(`{"archives":{}}`))
+	second.PutArchive(ctx, "registry.terraform.io/hashicorp/aws/aws.zip", strings.NewReader("zip"))
+	r := NewReplicated(primary, first, second)
+
+	data, err := r.GetVersion(ctx, "registry.terraform.io", "hashicorp", "aws", "5.0.0")
+	if err != nil || string(data) != `{"archives":{}}` {
+		t.Fatalf("GetVersion = %s, %v", data, err)
+	}
+	rc, err := r.GetArchive(ctx, "registry.terraform.io/hashicorp/aws/aws.zip")
+	if err != nil {
+		t.Fatalf("GetArchive failed: %v", err)
+	}
+	data, _ = io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "zip" {
+		t.Errorf("GetArchive = %q", data)
+	}
+
+	// What the secondary served is copied back to the primary
+	if _, err := primary.GetVersion(ctx, "registry.terraform.io", "hashicorp", "aws", "5.0.0"); err != nil {
+		t.Errorf("version not restored to the primary: %v", err)
+	}
+	if ok, _ := primary.ExistsArchive(ctx, "registry.terraform.io/hashicorp/aws/aws.zip"); !ok {
+		t.Error("archive not restored to the primary")
+	}
+
+	if _, err := r.GetIndex(ctx, "registry.terraform.io", "hashicorp", "aws"); !IsNotFound(err) {
+		t.Errorf("expected ErrNotFound when no backend has the index, got %v", err)
+	}
+}
+
+// runReplicated copies the writes queued by r until the test ends
+func runReplicated(t *testing.T, r *Replicated) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func drainReplicated(t *testing.T, r *Replicated) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := r.Drain(ctx); err != nil {
+		t.Fatalf("Drain failed: %v", err)
+	}
+}
+
+func TestReplicatedAsync(t *testing.T) {
+	ctx := context.Background()
+	m := metrics.New(nil, metrics.Options{DisableGoCollector: true, DisableProcessCollector: true})
+	primary, secondary := NewMemoryStorage(), NewMemoryStorage()
+	r := NewReplicated(primary, secondary)
+	r.SetAsync(100, m)
+
+	if err := r.PutIndex(ctx, "registry.terraform.io", "hashicorp", "aws", []byte(`{}`)); err != nil {
+		t.Fatalf("PutIndex failed: %v", err)
+	}
+	if err := r.PutArchive(ctx, "registry.terraform.io/hashicorp/aws/aws.zip", strings.NewReader("zip")); err != nil {
+		t.Fatalf("PutArchive failed: %v", err)
+	}
+	// Nothing reaches the secondary until the queue is running
+	if _, err := secondary.GetIndex(ctx, "registry.terraform.io", "hashicorp", "aws"); !IsNotFound(err) {
+		t.Fatalf("expected the index to be queued, got %v", err)
+	}
+
+	runReplicated(t, r)
+	drainReplicated(t, r)
+	if _, err := secondary.GetIndex(ctx, "registry.terraform.io", "hashicorp", "aws"); err != nil {
+		t.Errorf("index not replicated: %v", err)
+	}
+	rc, err := secondary.GetArchive(ctx, "registry.terraform.io/hashicorp/aws/aws.zip")
+	if err != nil {
+		t.Fatalf("archive not replicated: %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "zip" {
+		t.Errorf("replicated archive = %q", data)
+	}
+	if got := testutil.ToFloat64(m.ReplicationTotal.WithLabelValues("replicated")); got != 2 {
+		t.Errorf("expected 2 replicated objects, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.ReplicationLag); got != 0 {
+		t.Errorf("expected no lag once drained, got %v", got)
+	}
+}
+
+func TestReplicatedAsync_Failures(t *testing.T) {
+	ctx := context.Background()
+	m := metrics.New(nil, metrics.Options{DisableGoCollector: true, DisableProcessCollector: true})
+	r := NewReplicated(NewMemoryStorage(), failingStorage{NewMemoryStorage()})
+	r.SetAsync(1, m)
+	r.queue.retryWait = time.Millisecond
+
+	// Nothing is copying yet, the second archive overflows the queue
+	for _, path := range []string{"a.zip", "b.zip"} {
+		if err := r.PutArchive(ctx, path, strings.NewReader("zip")); err != nil {
+			t.Fatalf("PutArchive failed: %v", err)
+		}
+	}
+	if got := testutil.ToFloat64(m.ReplicationTotal.WithLabelValues("dropped")); got != 1 {
+		t.Errorf("expected 1 dropped object, got %v", got)
+	}
+
+	runReplicated(t, r)
+	drainReplicated(t, r)
+	if got := testutil.ToFloat64(m.ReplicationTotal.WithLabelValues("failed")); got != 1 {
+		t.Errorf("expected 1 failed object, got %v", got)
+	}
+}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/elisiariocouto/specular/pkg/metrics"
+)
+
+// replicationWorkers is the number of objects copied to the secondaries at the same time
+const replicationWorkers = 4
+
+// replicationAttempts is how many times an object is copied to a secondary before it is given up on
+const replicationAttempts = 3
+
+// replicationTask copies one object written to the primary to the secondaries
+type replicationTask struct {
+	kind    string
+	put     func(ctx context.Context, s Storage) error
+	queued  time.Time
+	logArgs []any
+}
+
+// replicationQueue holds the writes waiting to be copied to the secondaries
+type replicationQueue struct {
+	tasks     chan replicationTask
+	pending   sync.WaitGroup
+	metrics   *metrics.Metrics
+	retryWait time.Duration
+}
+
+// SetAsync makes writes reach the secondaries in the background, so requests only wait on the primary
+// Up to queueSize objects wait to be copied, objects written beyond that are dropped and counted in m
+// Run copies them. Must be called before the storage is used
+func (r *Replicated) SetAsync(queueSize int, m *metrics.Metrics) {
+	if m == nil {
+		m = metrics.Noop()
+	}
+	r.queue = &replicationQueue{
+		tasks:     make(chan replicationTask, queueSize),
+		metrics:   m,
+		retryWait: time.Second,
+	}
+}
+
+// Run copies queued writes to the secondaries until ctx is done, it returns right away when writes are synchronous
+func (r *Replicated) Run(ctx context.Context) {
+	if r.queue == nil {
+		return
+	}
+	var wg sync.WaitGroup
+	for range replicationWorkers {
+		wg.Go(func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case task := <-r.queue.tasks:
+					r.copy(ctx, task)
+				}
+			}
+		})
+	}
+	wg.Wait()
+}
+
+// Drain waits until every queued write has been copied or ctx is done
+func (r *Replicated) Drain(ctx context.Context) error {
+	if r.queue == nil {
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		r.queue.pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// enqueue adds a task without blocking the write that produced it
+func (q *replicationQueue) enqueue(task replicationTask) {
+	q.pending.Add(1)
+	select {
+	case q.tasks <- task:
+		q.metrics.SetReplicationPending(len(q.tasks))
+	default:
+		q.pending.Done()
+		q.metrics.RecordReplication("dropped")
+		slog.Warn("replication queue is full, "+task.kind+" not replicated", task.logArgs...)
+	}
+}
+
+// copy writes one object to every secondary, retrying each a few times before giving up on it
+func (r *Replicated) copy(ctx context.Context, task replicationTask) {
+	q := r.queue
+	defer q.pending.Done()
+	q.metrics.SetReplicationPending(len(q.tasks))
+
+	failed := false
+	for _, secondary := range r.secondaries {
+		var err error
+		for attempt := range replicationAttempts {
+			if attempt > 0 {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(q.retryWait << (attempt - 1)):
+				}
+			}
+			if err = task.put(ctx, secondary); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			failed = true
+			slog.WarnContext(ctx, "failed to replicate "+task.kind+" to secondary storage", append(task.logArgs, "error", err)...)
+		}
+	}
+
+	if failed {
+		q.metrics.RecordReplication("failed")
+		return
+	}
+	q.metrics.RecordReplication("replicated")
+	if len(q.tasks) == 0 {
+		q.metrics.SetReplicationLag(0)
+	} else {
+		q.metrics.SetReplicationLag(time.Since(task.queued))
+	}
+}
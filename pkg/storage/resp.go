@@ -0,0 +1,260 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// redisError is an error reply from the Redis server
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// redisClient sends commands to a Redis server using the RESP protocol
+// Connections are opened on demand and kept for reuse, a connection that fails is dropped
+type redisClient struct {
+	addr     string
+	username string
+	password string
+	db       int
+	tls      *tls.Config
+	timeout  time.Duration
+	idle     chan *redisConn
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// newRedisClient creates a client keeping up to maxIdle idle connections
+func newRedisClient(addr, username, password string, db int, tlsConfig *tls.Config, timeout time.Duration, maxIdle int) *redisClient {
+	return &redisClient{
+		addr:     addr,
+		username: username,
+		password: password,
+		db:       db,
+		tls:      tlsConfig,
+		timeout:  timeout,
+		idle:     make(chan *redisConn, maxIdle),
+	}
+}
+
+// do sends a command and returns its reply, error replies are returned as errors
+// Replies are strings for status replies, int64 for integers, []byte or nil for bulk strings and []any or nil for arrays
+func (c *redisClient) do(ctx context.Context, args ...string) (any, error) {
+	replies, err := c.pipeline(ctx, [][]string{args})
+	if err != nil {
+		return nil, err
+	}
+	if err, ok := replies[0].(error); ok {
+		return nil, err
+	}
+	return replies[0], nil
+}
+
+// transaction runs the commands atomically in a MULTI/EXEC block and returns their replies
+func (c *redisClient) transaction(ctx context.Context, cmds ...[]string) ([]any, error) {
+	all := make([][]string, 0, len(cmds)+2)
+	all = append(all, []string{"MULTI"})
+	all = append(all, cmds...)
+	all = append(all, []string{"EXEC"})
+	replies, err := c.pipeline(ctx, all)
+	if err != nil {
+		return nil, err
+	}
+	// Commands rejected while queueing abort the transaction, EXEC reports it
+	switch exec := replies[len(replies)-1].(type) {
+	case error:
+		for _, reply := range replies[1 : len(replies)-1] {
+			if err, ok := reply.(error); ok {
+				return nil, err
+			}
+		}
+		return nil, exec
+	case []any:
+		for _, reply := range exec {
+			if err, ok := reply.(error); ok {
+				return nil, err
+			}
+		}
+		return exec, nil
+	default:
+		return nil, errors.New("redis: transaction aborted")
+	}
+}
+
+// pipeline sends the commands in one round trip and returns their replies, error replies included
+func (c *redisClient) pipeline(ctx context.Context, cmds [][]string) ([]any, error) {
+	conn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	replies, err := conn.roundTrip(ctx, c.timeout, cmds)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c.put(conn)
+	return replies, nil
+}
+
+// close closes the idle connections
+func (c *redisClient) close() error {
+	for {
+		select {
+		case conn := <-c.idle:
+			conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// get returns an idle connection or opens a new one
+func (c *redisClient) get(ctx context.Context) (*redisConn, error) {
+	select {
+	case conn := <-c.idle:
+		return conn, nil
+	default:
+	}
+
+	dialer := &net.Dialer{Timeout: c.timeout}
+	var netConn net.Conn
+	var err error
+	if c.tls != nil {
+		netConn, err = (&tls.Dialer{NetDialer: dialer, Config: c.tls}).DialContext(ctx, "tcp", c.addr)
+	} else {
+		netConn, err = dialer.DialContext(ctx, "tcp", c.addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+	conn := &redisConn{Conn: netConn, r: bufio.NewReader(netConn)}
+
+	var setup [][]string
+	if c.password != "" {
+		if c.username != "" {
+			setup = append(setup, []string{"AUTH", c.username, c.password})
+		} else {
+			setup = append(setup, []string{"AUTH", c.password})
+		}
+	}
+	if c.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(c.db)})
+	}
+	if len(setup) > 0 {
+		replies, err := conn.roundTrip(ctx, c.timeout, setup)
+		if err == nil {
+			for _, reply := range replies {
+				if replyErr, ok := reply.(error); ok {
+					err = replyErr
+					break
+				}
+			}
+		}
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to set up redis connection: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// put keeps a healthy connection for reuse, or closes it if enough are idle
+func (c *redisClient) put(conn *redisConn) {
+	select {
+	case c.idle <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+// roundTrip writes the commands and reads one reply for each, within timeout or the context deadline
+func (conn *redisConn) roundTrip(ctx context.Context, timeout time.Duration, cmds [][]string) ([]any, error) {
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	var buf bytes.Buffer
+	for _, cmd := range cmds {
+		fmt.Fprintf(&buf, "*%d\r\n", len(cmd))
+		for _, arg := range cmd {
+			fmt.Fprintf(&buf, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+	}
+	if _, err := conn.Write(buf.Bytes()); err != nil {
+		return nil, fmt.Errorf("failed to send redis command: %w", err)
+	}
+
+	replies := make([]any, len(cmds))
+	for i := range cmds {
+		reply, err := readRedisReply(conn.r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read redis reply: %w", err)
+		}
+		replies[i] = reply
+	}
+	return replies, nil
+}
+
+// readRedisReply reads one RESP reply, error replies are returned as redisError values
+func readRedisReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("malformed reply %q", line)
+	}
+	kind, payload := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return payload, nil
+	case '-':
+		return redisError(payload), nil
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, fmt.Errorf("malformed bulk length %q", payload)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, fmt.Errorf("malformed array length %q", payload)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = readRedisReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unsupported reply type %q", kind)
+	}
+}
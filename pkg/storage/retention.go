@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ExpiredEntries counts the cache entries removed for not being read within the retention window
+type ExpiredEntries struct {
+	Metadata int   `json:"metadata"`
+	Archives int   `json:"archives"`
+	Bytes    int64 `json:"bytes"`
+}
+
+// Expirer is implemented by storage backends that can remove entries nobody reads anymore
+type Expirer interface {
+	// RemoveUnused removes metadata and archives last read before cutoff
+	RemoveUnused(ctx context.Context, cutoff time.Time) (ExpiredEntries, error)
+}
+
+// SetTrackAccess records reads of metadata and archives in their access time, which RemoveUnused relies on
+// Access times are set explicitly, so it also works on noatime mounts. Must be called before the storage is used
+func (fs *FilesystemStorage) SetTrackAccess(enabled bool) {
+	fs.trackAccess = enabled
+}
+
+// RemoveUnused removes metadata and archives, with their sidecars, that were neither written nor read since cutoff
+// Reads are only known with SetTrackAccess or the catalog, otherwise entries expire by write time
+func (fs *FilesystemStorage) RemoveUnused(ctx context.Context, cutoff time.Time) (ExpiredEntries, error) {
+	var expired ExpiredEntries
+	if files, ok := fs.catalogUnused(cutoff); ok {
+		for _, path := range files {
+			if err := ctx.Err(); err != nil {
+				return expired, err
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				fs.catalogRemove(path)
+				continue
+			}
+			if err := fs.expire(path, info, &expired); err != nil {
+				return expired, fmt.Errorf("failed to remove unused entry: %w", err)
+			}
+		}
+		return expired, nil
+	}
+
+	err := fs.walkRoots(func(_, path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// Server state is not cache data
+		if d.IsDir() && path == fs.stateDir() {
+			return filepath.SkipDir
+		}
+		// Temporary files are garbage collection's, sidecars go with their archive
+		name := d.Name()
+		if d.IsDir() || strings.HasPrefix(name, ".tmp-") || slices.Contains(archiveSidecars, filepath.Ext(name)) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || !accessTime(info).Before(cutoff) {
+			return nil
+		}
+		return fs.expire(path, info, &expired)
+	})
+	if err != nil {
+		return expired, fmt.Errorf("failed to scan cache directory: %w", err)
+	}
+	return expired, nil
+}
+
+// expire removes an unused metadata file or archive, with the archive's sidecars, and counts it
+func (fs *FilesystemStorage) expire(path string, info os.FileInfo, expired *ExpiredEntries) error {
+	if err := os.Remove(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	fs.catalogRemove(path)
+	expired.Bytes += info.Size()
+	if isMetadataFile(path) {
+		os.Remove(entryInfoPath(path))
+		expired.Metadata++
+		return nil
+	}
+	expired.Archives++
+	for _, suffix := range archiveSidecars {
+		if sidecar, err := os.Stat(path + suffix); err == nil && os.Remove(path+suffix) == nil {
+			expired.Bytes += sidecar.Size()
+		}
+	}
+	slog.Debug("removed archive not read within retention", "path", path, "bytes", info.Size())
+	return nil
+}
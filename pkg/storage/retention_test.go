@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRemoveUnused(t *testing.T) {
+	ctx := context.Background()
+	fs, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	fs.SetTrackAccess(true)
+
+	old := time.Now().Add(-48 * time.Hour)
+	fs.PutIndex(ctx, "registry.terraform.io", "hashicorp", "aws", []byte(`{"versions":{}}`))
+	fs.PutIndex(ctx, "registry.terraform.io", "hashicorp", "google", []byte(`{"versions":{}}`))
+	for _, path := range []string{fs.indexPath("registry.terraform.io", "hashicorp", "aws"), fs.indexPath("registry.terraform.io", "hashicorp", "google")} {
+		os.Chtimes(path, old, old)
+	}
+	for _, name := range []string{"read.zip", "unread.zip"} {
+		if err := putArchiveAt(t, fs, "registry.terraform.io/hashicorp/aws/"+name, 100, old); err != nil {
+			t.Fatalf("failed to store %s: %v", name, err)
+		}
+	}
+
+	// Reads keep entries written long ago
+	if _, err := fs.GetIndex(ctx, "registry.terraform.io", "hashicorp", "aws"); err != nil {
+		t.Fatalf("GetIndex failed: %v", err)
+	}
+	rc, err := fs.GetArchive(ctx, "registry.terraform.io/hashicorp/aws/read.zip")
+	if err != nil {
+		t.Fatalf("GetArchive failed: %v", err)
+	}
+	rc.Close()
+
+	expired, err := fs.RemoveUnused(ctx, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("RemoveUnused failed: %v", err)
+	}
+	if expired.Metadata != 1 || expired.Archives != 1 || expired.Bytes < 100 {
+		t.Errorf("unexpected expired entries %+v", expired)
+	}
+
+	if _, err := fs.GetIndex(ctx, "registry.terraform.io", "hashicorp", "google"); !IsNotFound(err) {
+		t.Errorf("expected the unread index to be removed, got %v", err)
+	}
+	if _, err := fs.GetIndex(ctx, "registry.terraform.io", "hashicorp", "aws"); err != nil {
+		t.Errorf("expected the read index to be kept, got %v", err)
+	}
+	if exists, _ := fs.ExistsArchive(ctx, "registry.terraform.io/hashicorp/aws/unread.zip"); exists {
+		t.Error("expected the unread archive to be removed")
+	}
+	if _, err := os.Stat(fs.archivePath("registry.terraform.io/hashicorp/aws/unread.zip") + checksumSuffix); !os.IsNotExist(err) {
+		t.Errorf("expected the sidecars of the unread archive to be removed, got %v", err)
+	}
+	if exists, _ := fs.ExistsArchive(ctx, "registry.terraform.io/hashicorp/aws/read.zip"); !exists {
+		t.Error("expected the read archive to be kept")
+	}
+}
@@ -0,0 +1,483 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Config configures the bucket of an S3Storage
+type S3Config struct {
+	// Endpoint is the base URL of the S3 API, such as https://s3.eu-west-1.amazonaws.com or http://minio:9000
+	Endpoint string
+	Region   string
+	Bucket   string
+	// Prefix is prepended to every object key, so the cache can share a bucket
+	Prefix          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is only set for temporary credentials
+	SessionToken string
+	// PathStyle addresses the bucket in the URL path instead of the hostname, as MinIO and most other S3-compatible stores expect
+	PathStyle bool
+	// HTTPClient sends requests to the endpoint, http.DefaultClient when nil
+	HTTPClient *http.Client
+}
+
+// S3Storage implements Storage on an S3-compatible object store
+// Objects are laid out like the filesystem cache, under the configured prefix
+type S3Storage struct {
+	endpoint *url.URL
+	region   string
+	bucket   string
+	prefix   string
+	creds    sigV4Credentials
+	// pathStyle addresses the bucket in the URL path
+	pathStyle bool
+	client    *http.Client
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// checksumMetadata is the user metadata header holding the SHA-256 of archives
+const checksumMetadata = "X-Amz-Meta-Sha256"
+
+// NewS3Storage creates a storage backend on an S3 bucket, no request is made until the storage is used
+func NewS3Storage(cfg S3Config) (*S3Storage, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", cfg.Endpoint)
+	}
+	if cfg.Bucket == "" {
+		return nil, errors.New("S3 bucket cannot be empty")
+	}
+	if cfg.Region == "" {
+		return nil, errors.New("S3 region cannot be empty")
+	}
+	prefix := strings.Trim(cfg.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &S3Storage{
+		endpoint: endpoint,
+		region:   cfg.Region,
+		bucket:   cfg.Bucket,
+		prefix:   prefix,
+		creds: sigV4Credentials{
+			AccessKeyID:     cfg.AccessKeyID,
+			SecretAccessKey: cfg.SecretAccessKey,
+			SessionToken:    cfg.SessionToken,
+		},
+		pathStyle: cfg.PathStyle,
+		client:    client,
+		now:       time.Now,
+	}, nil
+}
+
+// GetIndex retrieves the cached index.json for a provider
+func (s *S3Storage) GetIndex(ctx context.Context, hostname, namespace, providerType string) ([]byte, error) {
+	return s.getObject(ctx, objectKey(hostname, namespace, providerType, "index.json"))
+}
+
+// PutIndex stores the index.json for a provider
+func (s *S3Storage) PutIndex(ctx context.Context, hostname, namespace, providerType string, data []byte) error {
+	return s.putObject(ctx, objectKey(hostname, namespace, providerType, "index.json"), data)
+}
+
+// GetVersion retrieves the cached version.json for a specific provider version
+func (s *S3Storage) GetVersion(ctx context.Context, hostname, namespace, providerType, version string) ([]byte, error) {
+	return s.getObject(ctx, objectKey(hostname, namespace, providerType, version+".json"))
+}
+
+// PutVersion stores the version.json for a specific provider version
+func (s *S3Storage) PutVersion(ctx context.Context, hostname, namespace, providerType, version string, data []byte) error {
+	return s.putObject(ctx, objectKey(hostname, namespace, providerType, version+".json"), data)
+}
+
+// GetVersionsResponse retrieves the cached full versions API response
+func (s *S3Storage) GetVersionsResponse(ctx context.Context, hostname, namespace, providerType string) ([]byte, error) {
+	return s.getObject(ctx, ".specular-internal/"+objectKey(hostname, namespace, providerType, "versions.json"))
+}
+
+// PutVersionsResponse stores the full versions API response
+func (s *S3Storage) PutVersionsResponse(ctx context.Context, hostname, namespace, providerType string, data []byte) error {
+	return s.putObject(ctx, ".specular-internal/"+objectKey(hostname, namespace, providerType, "versions.json"), data)
+}
+
+// GetArchive retrieves a cached provider archive, streamed from the bucket
+func (s *S3Storage) GetArchive(ctx context.Context, path string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, archiveObject(path), nil, emptyPayloadHash, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// PutArchive stores a provider archive
+// The archive is spooled to a temporary file first, uploads need its size and SHA-256 up front
+func (s *S3Storage) PutArchive(ctx context.Context, path string, data io.Reader) error {
+	if path == "" {
+		return errors.New("archive path cannot be empty")
+	}
+	tmpFile, err := os.CreateTemp("", "specular-s3-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmpFile, hash), data); err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+	if _, err := tmpFile.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind archive: %w", err)
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	header := http.Header{}
+	header.Set("Content-Type", "application/zip")
+	header.Set(checksumMetadata, sum)
+	resp, err := s.do(ctx, http.MethodPut, archiveObject(path), tmpFile, sum, header)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// ExistsArchive checks if an archive exists
+func (s *S3Storage) ExistsArchive(ctx context.Context, path string) (bool, error) {
+	_, err := s.headObject(ctx, archiveObject(path))
+	if IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ArchiveChecksum returns the SHA-256 recorded when an archive was stored
+func (s *S3Storage) ArchiveChecksum(ctx context.Context, path string) (string, error) {
+	header, err := s.headObject(ctx, archiveObject(path))
+	if err != nil {
+		return "", err
+	}
+	sum := header.Get(checksumMetadata)
+	if sum == "" {
+		return "", ErrNotFound
+	}
+	return sum, nil
+}
+
+// IndexModTime returns when the index.json for a provider was cached
+func (s *S3Storage) IndexModTime(ctx context.Context, hostname, namespace, providerType string) (time.Time, error) {
+	return s.modTime(ctx, objectKey(hostname, namespace, providerType, "index.json"))
+}
+
+// VersionModTime returns when the version.json for a provider version was cached
+func (s *S3Storage) VersionModTime(ctx context.Context, hostname, namespace, providerType, version string) (time.Time, error) {
+	return s.modTime(ctx, objectKey(hostname, namespace, providerType, version+".json"))
+}
+
+// ArchiveModTime returns when a provider archive was cached
+func (s *S3Storage) ArchiveModTime(ctx context.Context, path string) (time.Time, error) {
+	return s.modTime(ctx, archiveObject(path))
+}
+
+// SignArchiveURL returns a presigned URL of a cached archive valid until expiry has passed
+func (s *S3Storage) SignArchiveURL(ctx context.Context, path string, expiry time.Duration) (string, error) {
+	key := archiveObject(path)
+	if _, err := s.headObject(ctx, key); err != nil {
+		return "", err
+	}
+	return presignURL(s.objectURL(s.prefix+key), s.creds, s.region, "s3", expiry, s.now()), nil
+}
+
+// DeleteIndex removes the cached index.json and versions API response of a provider
+func (s *S3Storage) DeleteIndex(ctx context.Context, hostname, namespace, providerType string) error {
+	if err := s.deleteObject(ctx, objectKey(hostname, namespace, providerType, "index.json")); err != nil {
+		return err
+	}
+	return s.deleteObject(ctx, ".specular-internal/"+objectKey(hostname, namespace, providerType, "versions.json"))
+}
+
+// DeleteVersion removes the cached version.json for a specific provider version
+func (s *S3Storage) DeleteVersion(ctx context.Context, hostname, namespace, providerType, version string) error {
+	return s.deleteObject(ctx, objectKey(hostname, namespace, providerType, version+".json"))
+}
+
+// DeleteArchive removes a cached provider archive, its checksum is metadata of the object and goes with it
+func (s *S3Storage) DeleteArchive(ctx context.Context, path string) error {
+	if path == "" {
+		return errors.New("archive path cannot be empty")
+	}
+	return s.deleteObject(ctx, archiveObject(path))
+}
+
+// PurgeProvider removes every object under the provider's prefix, one request per object
+func (s *S3Storage) PurgeProvider(ctx context.Context, hostname, namespace, providerType string) error {
+	for _, prefix := range []string{objectKey(hostname, namespace, providerType, ""), ".specular-internal/" + objectKey(hostname, namespace, providerType, "")} {
+		keys, err := s.listKeys(ctx, prefix)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err := s.deleteObject(ctx, key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ListProviders returns every provider with a cached index.json, sorted
+func (s *S3Storage) ListProviders(ctx context.Context) ([]Provider, error) {
+	keys, err := s.listKeys(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	var providers []Provider
+	for _, key := range keys {
+		parts := strings.Split(key, "/")
+		if len(parts) == 4 && parts[3] == "index.json" && parts[0] != ".specular-internal" {
+			providers = append(providers, Provider{Hostname: parts[0], Namespace: parts[1], Type: parts[2]})
+		}
+	}
+	return sortProviders(providers), nil
+}
+
+// ListVersions returns the versions of a provider with a cached version.json, sorted by name
+func (s *S3Storage) ListVersions(ctx context.Context, hostname, namespace, providerType string) ([]string, error) {
+	prefix := objectKey(hostname, namespace, providerType, "")
+	keys, err := s.listKeys(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	var versions []string
+	for _, key := range keys {
+		name := strings.TrimPrefix(key, prefix)
+		if version, ok := strings.CutSuffix(name, ".json"); ok && version != "index" && !strings.Contains(version, "/") {
+			versions = append(versions, version)
+		}
+	}
+	return sortVersions(versions), nil
+}
+
+// StatArchive returns the size and modification time of a cached archive from a HEAD request
+func (s *S3Storage) StatArchive(ctx context.Context, path string) (ArchiveInfo, error) {
+	key := archiveObject(path)
+	header, err := s.headObject(ctx, key)
+	if err != nil {
+		return ArchiveInfo{}, err
+	}
+	size, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	if err != nil {
+		return ArchiveInfo{}, fmt.Errorf("invalid Content-Length of S3 object %s: %w", key, err)
+	}
+	modTime, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		return ArchiveInfo{}, fmt.Errorf("invalid Last-Modified of S3 object %s: %w", key, err)
+	}
+	return ArchiveInfo{Size: size, ModTime: modTime}, nil
+}
+
+// listKeys returns the keys of every object under prefix, relative to the storage prefix
+func (s *S3Storage) listKeys(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		page, err := s.listObjects(ctx, prefix, token)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range page.Contents {
+			keys = append(keys, strings.TrimPrefix(object.Key, s.prefix))
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// listBucketResult is the response of a ListObjectsV2 request
+type listBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// listObjects returns a page of the objects under prefix, relative to the storage prefix
+func (s *S3Storage) listObjects(ctx context.Context, prefix, token string) (*listBucketResult, error) {
+	query := url.Values{"list-type": {"2"}}
+	if s.prefix+prefix != "" {
+		query.Set("prefix", s.prefix+prefix)
+	}
+	if token != "" {
+		query.Set("continuation-token", token)
+	}
+	u := s.bucketURL()
+	u.RawQuery = canonicalQuery(query)
+	resp, err := s.send(ctx, http.MethodGet, u, nil, emptyPayloadHash, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var page listBucketResult
+	if err := xml.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, fmt.Errorf("failed to parse S3 object listing: %w", err)
+	}
+	return &page, nil
+}
+
+func (s *S3Storage) getObject(ctx context.Context, key string) ([]byte, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, emptyPayloadHash, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read S3 object %s: %w", key, err)
+	}
+	return data, nil
+}
+
+func (s *S3Storage) putObject(ctx context.Context, key string, data []byte) error {
+	sum := sha256.Sum256(data)
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	resp, err := s.do(ctx, http.MethodPut, key, bytes.NewReader(data), hex.EncodeToString(sum[:]), header)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// deleteObject removes an object, S3 answers deletes of missing keys with success too
+func (s *S3Storage) deleteObject(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, emptyPayloadHash, nil)
+	if err != nil && !IsNotFound(err) {
+		return err
+	}
+	if resp != nil {
+		resp.Body.Close()
+	}
+	return nil
+}
+
+func (s *S3Storage) headObject(ctx context.Context, key string) (http.Header, error) {
+	resp, err := s.do(ctx, http.MethodHead, key, nil, emptyPayloadHash, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp.Header, nil
+}
+
+func (s *S3Storage) modTime(ctx context.Context, key string) (time.Time, error) {
+	header, err := s.headObject(ctx, key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	t, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid Last-Modified of S3 object %s: %w", key, err)
+	}
+	return t, nil
+}
+
+// do sends a signed request for an object key relative to the prefix
+func (s *S3Storage) do(ctx context.Context, method, key string, body io.Reader, payloadHash string, header http.Header) (*http.Response, error) {
+	return s.send(ctx, method, s.objectURL(s.prefix+key), body, payloadHash, header)
+}
+
+// send signs and sends a request, responses other than 2xx are turned into errors
+// Missing objects return ErrNotFound
+func (s *S3Storage) send(ctx context.Context, method string, u *url.URL, body io.Reader, payloadHash string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 request: %w", err)
+	}
+	if f, ok := body.(*os.File); ok {
+		info, err := f.Stat()
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat upload: %w", err)
+		}
+		req.ContentLength = info.Size()
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	signRequest(req, s.creds, s.region, "s3", payloadHash, s.now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("S3 %s request failed: %w", method, err)
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	var s3Err struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	xml.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&s3Err)
+	// A missing bucket is a misconfiguration, not a cache miss. HEAD responses have no body to tell them apart
+	if resp.StatusCode == http.StatusNotFound && (s3Err.Code == "" || s3Err.Code == "NoSuchKey") {
+		return nil, ErrNotFound
+	}
+	if s3Err.Code != "" {
+		return nil, fmt.Errorf("S3 %s %s: %s: %s", method, u.Path, s3Err.Code, s3Err.Message)
+	}
+	return nil, fmt.Errorf("S3 %s %s: unexpected status %d", method, u.Path, resp.StatusCode)
+}
+
+// bucketURL returns the URL of the bucket
+func (s *S3Storage) bucketURL() *url.URL {
+	u := *s.endpoint
+	if s.pathStyle {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.bucket + "/"
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/"
+	}
+	u.RawPath = ""
+	return &u
+}
+
+// objectURL returns the URL of an object, with its key encoded the way signatures expect
+func (s *S3Storage) objectURL(key string) *url.URL {
+	u := s.bucketURL()
+	u.Path += key
+	u.RawPath = uriEncode(u.Path, true)
+	return u
+}
+
+// archiveObject returns the key of an archive relative to the prefix, sanitized like filesystem archive paths
+func archiveObject(path string) string {
+	return strings.TrimPrefix(strings.ReplaceAll(path, "..", ""), "/")
+}
+
+// objectKey joins a provider address and a file name into an object key
+func objectKey(hostname, namespace, providerType, name string) string {
+	return hostname + "/" + namespace + "/" + providerType + "/" + name
+}
@@ -0,0 +1,204 @@
+package storage_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+// fakeS3 is a path-style S3 API holding objects of a single bucket in memory
+type fakeS3 struct {
+	t       *testing.T
+	mu      sync.Mutex
+	objects map[string]fakeObject
+}
+
+type fakeObject struct {
+	data     []byte
+	metadata http.Header
+	modTime  time.Time
+}
+
+func newFakeS3(t *testing.T) *httptest.Server {
+	f := &fakeS3{t: t, objects: make(map[string]fakeObject)}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=test/") {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, "<Error><Code>AccessDenied</Code><Message>missing signature</Message></Error>")
+		return
+	}
+	key, ok := strings.CutPrefix(r.URL.Path, "/cache/")
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, "<Error><Code>NoSuchBucket</Code><Message>bucket not found</Message></Error>")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.Method == http.MethodGet && key == "" && r.URL.Query().Get("list-type") == "2":
+		f.list(w, r)
+	case r.Method == http.MethodHead && key == "":
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		sum := sha256.Sum256(data)
+		if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, "<Error><Code>XAmzContentSHA256Mismatch</Code><Message>bad hash</Message></Error>")
+			return
+		}
+		metadata := http.Header{}
+		for name, values := range r.Header {
+			if strings.HasPrefix(name, "X-Amz-Meta-") {
+				metadata[name] = values
+			}
+		}
+		f.objects[key] = fakeObject{data: data, metadata: metadata, modTime: time.Now()}
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		object, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		for name, values := range object.metadata {
+			w.Header()[name] = values
+		}
+		w.Header().Set("Last-Modified", object.modTime.UTC().Format(http.TimeFormat))
+		w.Header().Set("Content-Length", strconv.Itoa(len(object.data)))
+		if r.Method == http.MethodGet {
+			w.Write(object.data)
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// list answers ListObjectsV2 requests two keys at a time, so clients have to follow continuation tokens
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, r.URL.Query().Get("prefix")) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	start, _ := strconv.Atoi(r.URL.Query().Get("continuation-token"))
+	end := min(start+2, len(keys))
+
+	type content struct {
+		Key string `xml:"Key"`
+	}
+	result := struct {
+		XMLName               xml.Name  `xml:"ListBucketResult"`
+		Contents              []content `xml:"Contents"`
+		IsTruncated           bool      `xml:"IsTruncated"`
+		NextContinuationToken string    `xml:"NextContinuationToken,omitempty"`
+	}{IsTruncated: end < len(keys)}
+	for _, key := range keys[start:end] {
+		result.Contents = append(result.Contents, content{Key: key})
+	}
+	if result.IsTruncated {
+		result.NextContinuationToken = strconv.Itoa(end)
+	}
+	xml.NewEncoder(w).Encode(result)
+}
+
+func newTestS3Storage(t *testing.T, endpoint string) *storage.S3Storage {
+	t.Helper()
+	s3, err := storage.NewS3Storage(storage.S3Config{
+		Endpoint:        endpoint,
+		Region:          "us-east-1",
+		Bucket:          "cache",
+		Prefix:          "/specular/",
+		AccessKeyID:     "test",
+		SecretAccessKey: "secret",
+		PathStyle:       true,
+	})
+	if err != nil {
+		t.Fatalf("NewS3Storage failed: %v", err)
+	}
+	return s3
+}
+
+func TestS3Storage(t *testing.T) {
+	ctx := context.Background()
+	server := newFakeS3(t)
+	s3 := newTestS3Storage(t, server.URL)
+
+	for _, providerType := range []string{"aws", "google", "null"} {
+		if err := s3.PutIndex(ctx, "registry.terraform.io", "hashicorp", providerType, []byte(`{"versions":{}}`)); err != nil {
+			t.Fatalf("PutIndex failed: %v", err)
+		}
+	}
+	s3.PutVersionsResponse(ctx, "registry.terraform.io", "hashicorp", "aws", []byte(`{}`))
+	providers, err := s3.ListProviders(ctx)
+	if err != nil {
+		t.Fatalf("ListProviders failed: %v", err)
+	}
+	if len(providers) != 3 || providers[0].Type != "aws" || providers[2].Type != "null" {
+		t.Errorf("unexpected providers %v", providers)
+	}
+
+	archive := "registry.terraform.io/hashicorp/aws/terraform-provider-aws_6.0.0+ent_linux_amd64.zip"
+	if err := s3.PutArchive(ctx, archive, strings.NewReader("zip")); err != nil {
+		t.Fatalf("PutArchive failed: %v", err)
+	}
+	sum := sha256.Sum256([]byte("zip"))
+	if got, err := s3.ArchiveChecksum(ctx, archive); err != nil || got != hex.EncodeToString(sum[:]) {
+		t.Errorf("ArchiveChecksum = %s, %v", got, err)
+	}
+	if modTime, err := s3.ArchiveModTime(ctx, archive); err != nil || time.Since(modTime) > time.Minute {
+		t.Errorf("ArchiveModTime = %v, %v", modTime, err)
+	}
+
+	url, err := s3.SignArchiveURL(ctx, archive, 5*time.Minute)
+	if err != nil {
+		t.Fatalf("SignArchiveURL failed: %v", err)
+	}
+	if !strings.HasPrefix(url, server.URL+"/cache/specular/registry.terraform.io/hashicorp/aws/terraform-provider-aws_6.0.0%2Bent_linux_amd64.zip?") ||
+		!strings.Contains(url, "X-Amz-Expires=300") || !strings.Contains(url, "X-Amz-Signature=") {
+		t.Errorf("unexpected presigned URL %s", url)
+	}
+	if _, err := s3.SignArchiveURL(ctx, "registry.terraform.io/hashicorp/aws/missing.zip", time.Minute); !storage.IsNotFound(err) {
+		t.Errorf("expected ErrNotFound signing a missing archive, got %v", err)
+	}
+
+	wrongBucket, _ := storage.NewS3Storage(storage.S3Config{Endpoint: server.URL, Region: "us-east-1", Bucket: "other", AccessKeyID: "test", PathStyle: true})
+	if err := wrongBucket.PutIndex(ctx, "registry.terraform.io", "hashicorp", "aws", []byte(`{}`)); err == nil || !strings.Contains(err.Error(), "NoSuchBucket") {
+		t.Errorf("expected a NoSuchBucket error, got %v", err)
+	}
+}
+
+func TestNewS3Storage_Invalid(t *testing.T) {
+	for _, cfg := range []storage.S3Config{
+		{Endpoint: "s3.amazonaws.com", Region: "us-east-1", Bucket: "cache"},
+		{Endpoint: "https://s3.amazonaws.com", Region: "us-east-1"},
+		{Endpoint: "https://s3.amazonaws.com", Bucket: "cache"},
+	} {
+		if _, err := storage.NewS3Storage(cfg); err == nil {
+			t.Errorf("expected an error for %+v", cfg)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// SetShardArchives stores each archive two hashed directories below its provider, such as
+// hostname/namespace/type/ab/cd/terraform-provider-type_1.0.0_linux_amd64.zip, so providers with
+// thousands of cached archives do not end up in directories too large to list and stat quickly
+// Archives in the other layout keep being served, ReshardArchives moves them. Must be called before the storage is used
+func (fs *FilesystemStorage) SetShardArchives(enabled bool) {
+	fs.shardArchives = enabled
+}
+
+// archiveShard returns the shard directories of an archive, or one of its sidecars, from the hash of its name
+func archiveShard(name string) (string, string) {
+	for _, suffix := range archiveSidecars {
+		name = strings.TrimSuffix(name, suffix)
+	}
+	sum := sha256.Sum256([]byte(name))
+	shard := hex.EncodeToString(sum[:2])
+	return shard[:2], shard[2:]
+}
+
+// shardArchivePath returns rel, an archive path relative to a cache root, in the sharded layout
+func shardArchivePath(rel string) string {
+	dir, name := filepath.Split(rel)
+	first, second := archiveShard(name)
+	return filepath.Join(dir, first, second, name)
+}
+
+// unshardArchivePath returns rel in the flat layout, rel is returned as is when it is not sharded
+func unshardArchivePath(rel string) string {
+	dir, name := filepath.Split(rel)
+	first, second := archiveShard(name)
+	dir = filepath.Clean(dir)
+	if filepath.Base(dir) != second || filepath.Base(filepath.Dir(dir)) != first {
+		return rel
+	}
+	return filepath.Join(filepath.Dir(filepath.Dir(dir)), name)
+}
+
+// archiveLayouts returns rel, a flat archive path, in the configured layout and in the other one
+func (fs *FilesystemStorage) archiveLayouts(rel string) (string, string) {
+	if fs.shardArchives {
+		return shardArchivePath(rel), rel
+	}
+	return rel, shardArchivePath(rel)
+}
+
+// ReshardArchives moves every archive and its sidecars stored in the other layout into the configured one,
+// flat or sharded, and returns how many were moved. Archives stay in the directory they are in, only their
+// path below it changes. Must be called before BuildCatalog, typically at startup
+func (fs *FilesystemStorage) ReshardArchives(ctx context.Context) (int, error) {
+	type move struct{ from, to string }
+	var moves []move
+	err := fs.walkRoots(func(root, path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if name == ".specular-internal" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(name, ".tmp-") || isMetadataFile(path) || slices.Contains(archiveSidecars, filepath.Ext(name)) {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		placed, _ := fs.archiveLayouts(unshardArchivePath(rel))
+		if placed != rel {
+			moves = append(moves, move{from: path, to: filepath.Join(root, placed)})
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to scan cache directory: %w", err)
+	}
+
+	for i, m := range moves {
+		if err := ctx.Err(); err != nil {
+			return i, err
+		}
+		if err := moveArchive(m.from, m.to); err != nil {
+			return i, err
+		}
+	}
+	return len(moves), nil
+}
+
+// moveArchive renames an archive and its sidecars, removing the shard directories it leaves empty
+func moveArchive(from, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return fmt.Errorf("failed to create shard directory: %w", err)
+	}
+	// The archive goes last, so an archive found at its new path always has its sidecars
+	for _, suffix := range archiveSidecars {
+		if err := os.Rename(from+suffix, to+suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to move %s: %w", filepath.Base(from+suffix), err)
+		}
+	}
+	if err := os.Rename(from, to); err != nil {
+		return fmt.Errorf("failed to move %s: %w", filepath.Base(from), err)
+	}
+	// Removing a directory fails unless it is empty
+	dir := filepath.Dir(from)
+	if unshardArchivePath(from) != from && os.Remove(dir) == nil {
+		os.Remove(filepath.Dir(dir))
+	}
+	return nil
+}
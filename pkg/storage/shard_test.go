@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestShardArchivePath(t *testing.T) {
+	rel := filepath.FromSlash("registry.terraform.io/hashicorp/aws/terraform-provider-aws_5.0.0_linux_amd64.zip")
+	sharded := shardArchivePath(rel)
+	if want := filepath.FromSlash("registry.terraform.io/hashicorp/aws/a6/a8/terraform-provider-aws_5.0.0_linux_amd64.zip"); sharded != want {
+		t.Fatalf("shardArchivePath = %s, want %s", sharded, want)
+	}
+	// Sidecars are sharded with their archive
+	if got := shardArchivePath(rel + checksumSuffix); got != sharded+checksumSuffix {
+		t.Errorf("sidecar sharded to %s", got)
+	}
+	if got := unshardArchivePath(sharded); got != rel {
+		t.Errorf("unshardArchivePath = %s, want %s", got, rel)
+	}
+	if got := unshardArchivePath(rel); got != rel {
+		t.Errorf("expected a flat path to be left as is, got %s", got)
+	}
+}
+
+func TestShardArchives(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	fs, err := NewFilesystemStorage(dir)
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	const path = "registry.terraform.io/hashicorp/aws/terraform-provider-aws_5.0.0_linux_amd64.zip"
+	if err := fs.PutArchive(ctx, path, strings.NewReader("flat")); err != nil {
+		t.Fatalf("PutArchive failed: %v", err)
+	}
+
+	// Archives cached before sharding was enabled are still served
+	fs.SetShardArchives(true)
+	assertArchive(t, fs, path, "flat")
+
+	moved, err := fs.ReshardArchives(ctx)
+	if err != nil || moved != 1 {
+		t.Fatalf("ReshardArchives = %d, %v", moved, err)
+	}
+	sharded := filepath.Join(dir, shardArchivePath(filepath.FromSlash(path)))
+	for _, suffix := range []string{"", checksumSuffix, sizeSuffix} {
+		if _, err := os.Stat(sharded + suffix); err != nil {
+			t.Errorf("expected %s to be moved: %v", filepath.Base(sharded+suffix), err)
+		}
+	}
+	assertArchive(t, fs, path, "flat")
+	if sum, err := fs.ArchiveChecksum(ctx, path); err != nil || sum == "" {
+		t.Errorf("expected the checksum to move with the archive, got %q, %v", sum, err)
+	}
+	if moved, _ := fs.ReshardArchives(ctx); moved != 0 {
+		t.Errorf("expected nothing left to move, moved %d", moved)
+	}
+
+	// Turning sharding off moves archives back and removes the empty shard directories
+	fs.SetShardArchives(false)
+	if moved, err := fs.ReshardArchives(ctx); err != nil || moved != 1 {
+		t.Fatalf("ReshardArchives = %d, %v", moved, err)
+	}
+	if _, err := os.Stat(filepath.Dir(filepath.Dir(sharded))); !os.IsNotExist(err) {
+		t.Errorf("expected the shard directories to be removed, got %v", err)
+	}
+	assertArchive(t, fs, path, "flat")
+}
+
+// assertArchive checks the content of a cached archive
+func assertArchive(t *testing.T, fs *FilesystemStorage, path, want string) {
+	t.Helper()
+	rc, err := fs.GetArchive(context.Background(), path)
+	if err != nil {
+		t.Fatalf("GetArchive failed: %v", err)
+	}
+	defer rc.Close()
+	data, _ := io.ReadAll(rc)
+	if string(data) != want {
+		t.Errorf("GetArchive = %q, want %q", data, want)
+	}
+}
@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// snapshotFormat is bumped when memorySnapshot changes incompatibly
+const snapshotFormat = 1
+
+// memorySnapshot is the gob-encoded content of a snapshot file
+type memorySnapshot struct {
+	Format   int
+	Data     map[string][]byte
+	Archives map[string][]byte
+	ModTimes map[string]time.Time
+}
+
+// Snapshot writes everything stored in memory to a gzip-compressed file at path, replacing it atomically
+// It returns false without writing anything when nothing was stored since the last snapshot or restore
+func (m *MemoryStorage) Snapshot(path string) (bool, error) {
+	// Stored slices are never modified in place, copying the maps is enough to encode them unlocked
+	m.mu.RLock()
+	generation := m.generation
+	if generation == m.snapshotGeneration {
+		m.mu.RUnlock()
+		return false, nil
+	}
+	snapshot := memorySnapshot{
+		Format:   snapshotFormat,
+		Data:     maps.Clone(m.data),
+		Archives: maps.Clone(m.archives),
+		ModTimes: maps.Clone(m.modTimes),
+	}
+	m.mu.RUnlock()
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return false, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	tmpFile, err := os.CreateTemp(dir, ".tmp-snapshot-")
+	if err != nil {
+		return false, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpPath := tmpFile.Name()
+	defer os.Remove(tmpPath)
+
+	zw := gzip.NewWriter(tmpFile)
+	err = gob.NewEncoder(zw).Encode(snapshot)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return false, fmt.Errorf("failed to finalize snapshot: %w", err)
+	}
+
+	m.mu.Lock()
+	m.snapshotGeneration = generation
+	m.mu.Unlock()
+	return true, nil
+}
+
+// RestoreSnapshot replaces everything stored in memory with a snapshot written by Snapshot
+// It returns ErrNotFound when there is no snapshot at path
+func (m *MemoryStorage) RestoreSnapshot(path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	var snapshot memorySnapshot
+	if err := gob.NewDecoder(zr).Decode(&snapshot); err != nil {
+		return fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	if snapshot.Format != snapshotFormat {
+		return fmt.Errorf("unsupported snapshot format %d", snapshot.Format)
+	}
+
+	m.mu.Lock()
+	m.data = snapshot.Data
+	m.archives = snapshot.Archives
+	m.modTimes = snapshot.ModTimes
+	for _, stored := range []*map[string][]byte{&m.data, &m.archives} {
+		if *stored == nil {
+			*stored = make(map[string][]byte)
+		}
+	}
+	if m.modTimes == nil {
+		m.modTimes = make(map[string]time.Time)
+	}
+	m.snapshotGeneration = m.generation
+	m.recountLocked()
+	m.mu.Unlock()
+	return nil
+}
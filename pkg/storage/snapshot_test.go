@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMemoryStorageSnapshot(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state", "memory.snapshot")
+
+	m := NewMemoryStorage()
+	if written, err := m.Snapshot(path); err != nil || written {
+		t.Fatalf("Snapshot of empty storage = %v, %v, want nothing written", written, err)
+	}
+
+	if err := m.PutIndex(ctx, "registry.terraform.io", "hashicorp", "aws", []byte(`{"versions":{}}`)); err != nil {
+		t.Fatalf("PutIndex failed: %v", err)
+	}
+	if err := m.PutArchive(ctx, "registry.terraform.io/hashicorp/aws/aws.zip", strings.NewReader("zip")); err != nil {
+		t.Fatalf("PutArchive failed: %v", err)
+	}
+	if err := m.PutArchiveHashes(ctx, "registry.terraform.io/hashicorp/aws/aws.zip", []string{"h1:abc"}); err != nil {
+		t.Fatalf("PutArchiveHashes failed: %v", err)
+	}
+	if written, err := m.Snapshot(path); err != nil || !written {
+		t.Fatalf("Snapshot = %v, %v, want written", written, err)
+	}
+	if written, err := m.Snapshot(path); err != nil || written {
+		t.Errorf("unchanged Snapshot = %v, %v, want nothing written", written, err)
+	}
+
+	restored := NewMemoryStorage()
+	if err := restored.RestoreSnapshot(path); err != nil {
+		t.Fatalf("RestoreSnapshot failed: %v", err)
+	}
+	if data, err := restored.GetIndex(ctx, "registry.terraform.io", "hashicorp", "aws"); err != nil || string(data) != `{"versions":{}}` {
+		t.Errorf("restored index = %s, %v", data, err)
+	}
+	rc, err := restored.GetArchive(ctx, "registry.terraform.io/hashicorp/aws/aws.zip")
+	if err != nil {
+		t.Fatalf("restored archive: %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "zip" {
+		t.Errorf("restored archive = %q", data)
+	}
+	if hashes, err := restored.ArchiveHashes(ctx, "registry.terraform.io/hashicorp/aws/aws.zip"); err != nil || len(hashes) != 1 || hashes[0] != "h1:abc" {
+		t.Errorf("restored hashes = %v, %v", hashes, err)
+	}
+	original, _ := m.ArchiveModTime(ctx, "registry.terraform.io/hashicorp/aws/aws.zip")
+	if got, err := restored.ArchiveModTime(ctx, "registry.terraform.io/hashicorp/aws/aws.zip"); err != nil || !got.Equal(original) {
+		t.Errorf("restored mod time = %v, %v, want %v", got, err, original)
+	}
+	if written, _ := restored.Snapshot(path); written {
+		t.Error("Snapshot right after a restore wrote the same contents again")
+	}
+
+	if err := NewMemoryStorage().RestoreSnapshot(filepath.Join(t.TempDir(), "missing")); !IsNotFound(err) {
+		t.Errorf("RestoreSnapshot of a missing file returned %v, want ErrNotFound", err)
+	}
+	corrupt := filepath.Join(t.TempDir(), "corrupt")
+	os.WriteFile(corrupt, []byte("not a snapshot"), 0o644)
+	if err := NewMemoryStorage().RestoreSnapshot(corrupt); err == nil || IsNotFound(err) {
+		t.Errorf("RestoreSnapshot of a corrupt file returned %v", err)
+	}
+}
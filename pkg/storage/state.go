@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// StateStore is implemented by storage backends that can keep small documents of server state, such as the
+// service discovery cache, so they survive restarts. Names are plain words without path separators
+type StateStore interface {
+	// GetState returns a stored state document
+	// Returns ErrNotFound if nothing is stored under name
+	GetState(ctx context.Context, name string) ([]byte, error)
+	// PutState stores a state document, replacing the previous one
+	PutState(ctx context.Context, name string, data []byte) error
+}
+
+// validateStateName rejects state names that are not a single path element
+func validateStateName(name string) error {
+	if name == "" || name == "." || name == ".." || filepath.Base(name) != name {
+		return fmt.Errorf("invalid state name %q", name)
+	}
+	return nil
+}
+
+// stateDir is where state documents are kept in the cache directory
+func (fs *FilesystemStorage) stateDir() string {
+	return filepath.Join(fs.cacheDir, ".specular-internal", "state")
+}
+
+// GetState returns a state document stored under .specular-internal/state
+func (fs *FilesystemStorage) GetState(ctx context.Context, name string) ([]byte, error) {
+	if err := validateStateName(name); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(fs.stateDir(), name+".json"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to read state: %w", err)
+	}
+	return data, nil
+}
+
+// PutState stores a state document under .specular-internal/state
+func (fs *FilesystemStorage) PutState(ctx context.Context, name string, data []byte) error {
+	if err := validateStateName(name); err != nil {
+		return err
+	}
+	return fs.writeFileAtomic(ctx, filepath.Join(fs.stateDir(), name+".json"), data)
+}
+
+// GetState returns a stored state document
+func (m *MemoryStorage) GetState(ctx context.Context, name string) ([]byte, error) {
+	if err := validateStateName(name); err != nil {
+		return nil, err
+	}
+	return m.get(stateKey(name))
+}
+
+// PutState stores a state document, it is kept in memory snapshots with the cache
+func (m *MemoryStorage) PutState(ctx context.Context, name string, data []byte) error {
+	if err := validateStateName(name); err != nil {
+		return err
+	}
+	return m.put(stateKey(name), data)
+}
+
+func stateKey(name string) string {
+	return "state:" + name
+}
+
+// GetState returns a state document stored under .specular-internal/state/ in the bucket
+func (s *S3Storage) GetState(ctx context.Context, name string) ([]byte, error) {
+	if err := validateStateName(name); err != nil {
+		return nil, err
+	}
+	return s.getObject(ctx, ".specular-internal/state/"+name+".json")
+}
+
+// PutState stores a state document under .specular-internal/state/ in the bucket
+func (s *S3Storage) PutState(ctx context.Context, name string, data []byte) error {
+	if err := validateStateName(name); err != nil {
+		return err
+	}
+	return s.putObject(ctx, ".specular-internal/state/"+name+".json", data)
+}
@@ -0,0 +1,52 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+func TestStateStore(t *testing.T) {
+	fs, err := storage.NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	backends := map[string]storage.StateStore{
+		"filesystem": fs,
+		"memory":     storage.NewMemoryStorage(),
+		"s3":         newTestS3Storage(t, newFakeS3(t).URL),
+	}
+	for name, store := range backends {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if _, err := store.GetState(ctx, "discovery"); !storage.IsNotFound(err) {
+				t.Errorf("expected ErrNotFound before anything is stored, got %v", err)
+			}
+			for _, data := range []string{`[1]`, `[2]`} {
+				if err := store.PutState(ctx, "discovery", []byte(data)); err != nil {
+					t.Fatalf("PutState failed: %v", err)
+				}
+				if got, err := store.GetState(ctx, "discovery"); err != nil || string(got) != data {
+					t.Errorf("GetState = %s, %v, want %s", got, err, data)
+				}
+			}
+			if err := store.PutState(ctx, "../index", []byte(`{}`)); err == nil {
+				t.Error("expected an error for a state name with a path separator")
+			}
+		})
+	}
+
+	// State is neither a cached provider nor visible through read-only storage as writable
+	if providers, _ := fs.ListProviders(context.Background()); len(providers) != 0 {
+		t.Errorf("expected state not to be listed as a provider, got %v", providers)
+	}
+	ro := storage.NewReadOnly(fs)
+	if data, err := ro.GetState(context.Background(), "discovery"); err != nil || string(data) != `[2]` {
+		t.Errorf("expected read-only storage to read state, got %s, %v", data, err)
+	}
+	if err := ro.PutState(context.Background(), "discovery", []byte(`[]`)); !errors.Is(err, storage.ErrReadOnly) {
+		t.Errorf("expected ErrReadOnly, got %v", err)
+	}
+}
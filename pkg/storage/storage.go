@@ -0,0 +1,145 @@
+// Package storage defines the cache storage interface and its filesystem and in-memory backends
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrNotFound is returned when an entry is not in the cache
+// It also matches io.EOF, the sentinel used before it existed, so older callers keep working
+var ErrNotFound error = notFoundError{}
+
+type notFoundError struct{}
+
+func (notFoundError) Error() string { return "not found in cache" }
+
+func (notFoundError) Is(target error) bool { return target == io.EOF }
+
+// IsNotFound reports whether err means an entry is not in the cache
+// Backends that still return io.EOF for missing entries are accepted for now
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound) || errors.Is(err, io.EOF)
+}
+
+// Storage defines the interface for storing and retrieving cached data
+type Storage interface {
+	// GetIndex retrieves the cached index.json for a provider
+	// Returns ErrNotFound if not found
+	GetIndex(ctx context.Context, hostname, namespace, providerType string) ([]byte, error)
+
+	// PutIndex stores the index.json for a provider
+	PutIndex(ctx context.Context, hostname, namespace, providerType string, data []byte) error
+
+	// GetVersion retrieves the cached version.json for a specific provider version
+	// Returns ErrNotFound if not found
+	GetVersion(ctx context.Context, hostname, namespace, providerType, version string) ([]byte, error)
+
+	// PutVersion stores the version.json for a specific provider version
+	PutVersion(ctx context.Context, hostname, namespace, providerType, version string, data []byte) error
+
+	// GetVersionsResponse retrieves the cached full versions API response
+	// Returns ErrNotFound if not found
+	GetVersionsResponse(ctx context.Context, hostname, namespace, providerType string) ([]byte, error)
+
+	// PutVersionsResponse stores the full versions API response
+	PutVersionsResponse(ctx context.Context, hostname, namespace, providerType string, data []byte) error
+
+	// GetArchive retrieves a cached provider archive
+	// Returns ErrNotFound if not found
+	// Caller is responsible for closing the returned ReadCloser
+	GetArchive(ctx context.Context, path string) (io.ReadCloser, error)
+
+	// PutArchive stores a provider archive
+	PutArchive(ctx context.Context, path string, data io.Reader) error
+
+	// ExistsArchive checks if an archive exists
+	ExistsArchive(ctx context.Context, path string) (bool, error)
+
+	// DeleteIndex removes the cached index.json for a provider, with the versions API response cached alongside it
+	// Deleting an entry that is not cached is not an error, as for every delete
+	DeleteIndex(ctx context.Context, hostname, namespace, providerType string) error
+
+	// DeleteVersion removes the cached version.json for a specific provider version
+	DeleteVersion(ctx context.Context, hostname, namespace, providerType, version string) error
+
+	// DeleteArchive removes a cached provider archive and anything recorded about it, such as its checksum
+	DeleteArchive(ctx context.Context, path string) error
+
+	// PurgeProvider removes every cached index, version and archive of a provider
+	PurgeProvider(ctx context.Context, hostname, namespace, providerType string) error
+
+	// ListProviders returns every provider with a cached index.json, sorted
+	ListProviders(ctx context.Context) ([]Provider, error)
+
+	// ListVersions returns the versions of a provider with a cached version.json, sorted by name
+	// A provider with nothing cached has no versions, it is not an error
+	ListVersions(ctx context.Context, hostname, namespace, providerType string) ([]string, error)
+
+	// StatArchive returns the size and modification time of a cached archive
+	// Returns ErrNotFound if not found
+	StatArchive(ctx context.Context, path string) (ArchiveInfo, error)
+}
+
+// ArchiveInfo describes a cached archive
+type ArchiveInfo struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// SpaceReporter is implemented by storage backends that live on a disk with limited capacity
+type SpaceReporter interface {
+	// FreeSpace returns the number of bytes available to the cache
+	FreeSpace(ctx context.Context) (int64, error)
+}
+
+// UsageReporter is implemented by storage backends that can report the capacity of their disk
+type UsageReporter interface {
+	// DiskUsage returns the capacity and usage of the filesystem holding the cache
+	DiskUsage(ctx context.Context) (DiskUsage, error)
+}
+
+// DiskUsage describes the capacity and usage of a filesystem
+type DiskUsage struct {
+	TotalBytes int64 `json:"total_bytes"`
+	UsedBytes  int64 `json:"used_bytes"`
+	FreeBytes  int64 `json:"free_bytes"`
+}
+
+// FreePercent returns the free bytes as a percentage of the total
+func (u DiskUsage) FreePercent() float64 {
+	if u.TotalBytes <= 0 {
+		return 0
+	}
+	return float64(u.FreeBytes) / float64(u.TotalBytes) * 100
+}
+
+// ModTimeReporter is implemented by storage backends that know when cache entries were written
+// Each method returns ErrNotFound if the entry is not found
+type ModTimeReporter interface {
+	// IndexModTime returns when the index.json for a provider was cached
+	IndexModTime(ctx context.Context, hostname, namespace, providerType string) (time.Time, error)
+
+	// VersionModTime returns when the version.json for a provider version was cached
+	VersionModTime(ctx context.Context, hostname, namespace, providerType, version string) (time.Time, error)
+
+	// ArchiveModTime returns when a provider archive was cached
+	ArchiveModTime(ctx context.Context, path string) (time.Time, error)
+}
+
+// ArchiveURLSigner is implemented by object storage backends that can hand out short-lived URLs to cached archives,
+// so clients download them from the backend instead of through the mirror
+type ArchiveURLSigner interface {
+	// SignArchiveURL returns a URL granting read access to a cached archive until expiry has passed
+	// Returns ErrNotFound if the archive is not cached
+	SignArchiveURL(ctx context.Context, path string, expiry time.Duration) (string, error)
+}
+
+// HealthChecker is implemented by storage backends that can check they are able to serve and store cache entries,
+// so a full disk or lost credentials show up in readiness checks instead of as errors on client requests
+type HealthChecker interface {
+	// HealthCheck returns an error if the storage cannot currently serve or store cache entries
+	HealthCheck(ctx context.Context) error
+}
@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestErrNotFound(t *testing.T) {
+	wrapped := fmt.Errorf("lookup failed: %w", ErrNotFound)
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"sentinel", ErrNotFound, true},
+		{"wrapped", wrapped, true},
+		{"legacy io.EOF", io.EOF, true},
+		{"other error", errors.New("disk failure"), false},
+		{"nil", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsNotFound(tt.err); got != tt.want {
+				t.Errorf("IsNotFound(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+
+	// Callers still checking for io.EOF keep working
+	if !errors.Is(wrapped, io.EOF) {
+		t.Error("expected ErrNotFound to match io.EOF")
+	}
+}
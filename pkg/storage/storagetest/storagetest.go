@@ -0,0 +1,531 @@
+// Package storagetest provides a conformance test suite for storage backends
+// Third-party backends run it from their own tests to check they behave like the built-in ones
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/elisiariocouto/specular/pkg/storage"
+)
+
+// Factory returns a new, empty storage backend for a single test
+// Use t.TempDir or t.Cleanup to release any resources it holds
+type Factory func(t *testing.T) storage.Storage
+
+const (
+	hostname     = "registry.terraform.io"
+	namespace    = "hashicorp"
+	providerType = "aws"
+	version      = "6.26.0"
+	archivePath  = "releases.hashicorp.com/terraform-provider-aws/6.26.0/terraform-provider-aws_6.26.0_linux_amd64.zip"
+)
+
+// TestStorage runs the conformance suite against backends created by newStorage
+func TestStorage(t *testing.T, newStorage Factory) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s storage.Storage)
+	}{
+		{"NotFound", testNotFound},
+		{"RoundTrip", testRoundTrip},
+		{"Overwrite", testOverwrite},
+		{"Isolation", testIsolation},
+		{"Aliasing", testAliasing},
+		{"Streaming", testStreaming},
+		{"Concurrency", testConcurrency},
+		{"ChecksumReporter", testChecksumReporter},
+		{"ModTimeReporter", testModTimeReporter},
+		{"ListProviders", testListProviders},
+		{"ListVersions", testListVersions},
+		{"StatArchive", testStatArchive},
+		{"Delete", testDelete},
+		{"PurgeProvider", testPurgeProvider},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newStorage(t))
+		})
+	}
+}
+
+// testNotFound checks that missing entries are reported as storage.ErrNotFound
+// io.EOF is still accepted while backends migrate to storage.ErrNotFound
+func testNotFound(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	if _, err := s.GetIndex(ctx, hostname, namespace, providerType); !storage.IsNotFound(err) {
+		t.Errorf("GetIndex on empty storage: expected storage.ErrNotFound, got %v", err)
+	}
+	if _, err := s.GetVersion(ctx, hostname, namespace, providerType, version); !storage.IsNotFound(err) {
+		t.Errorf("GetVersion on empty storage: expected storage.ErrNotFound, got %v", err)
+	}
+	if _, err := s.GetVersionsResponse(ctx, hostname, namespace, providerType); !storage.IsNotFound(err) {
+		t.Errorf("GetVersionsResponse on empty storage: expected storage.ErrNotFound, got %v", err)
+	}
+	if _, err := s.GetArchive(ctx, archivePath); !storage.IsNotFound(err) {
+		t.Errorf("GetArchive on empty storage: expected storage.ErrNotFound, got %v", err)
+	}
+	exists, err := s.ExistsArchive(ctx, archivePath)
+	if err != nil || exists {
+		t.Errorf("ExistsArchive on empty storage: expected false, nil, got %v, %v", exists, err)
+	}
+}
+
+// testRoundTrip checks that stored entries are returned unchanged
+func testRoundTrip(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	index := []byte(`{"versions":{"6.26.0":{}}}`)
+	versionData := []byte(`{"archives":{"linux_amd64":{"url":"terraform-provider-aws_6.26.0_linux_amd64.zip"}}}`)
+	versions := []byte(`{"versions":[{"version":"6.26.0"}]}`)
+	archive := []byte("PK archive content")
+
+	mustPut(t, s.PutIndex(ctx, hostname, namespace, providerType, index))
+	mustPut(t, s.PutVersion(ctx, hostname, namespace, providerType, version, versionData))
+	mustPut(t, s.PutVersionsResponse(ctx, hostname, namespace, providerType, versions))
+	mustPut(t, s.PutArchive(ctx, archivePath, bytes.NewReader(archive)))
+
+	expectBytes(t, "GetIndex", index)(s.GetIndex(ctx, hostname, namespace, providerType))
+	expectBytes(t, "GetVersion", versionData)(s.GetVersion(ctx, hostname, namespace, providerType, version))
+	expectBytes(t, "GetVersionsResponse", versions)(s.GetVersionsResponse(ctx, hostname, namespace, providerType))
+	expectArchive(t, s, archivePath, archive)
+
+	exists, err := s.ExistsArchive(ctx, archivePath)
+	if err != nil || !exists {
+		t.Errorf("ExistsArchive after PutArchive: expected true, nil, got %v, %v", exists, err)
+	}
+}
+
+// testOverwrite checks that a second write replaces the first
+func testOverwrite(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	mustPut(t, s.PutIndex(ctx, hostname, namespace, providerType, []byte(`{"versions":{"1.0.0":{}}}`)))
+	mustPut(t, s.PutIndex(ctx, hostname, namespace, providerType, []byte(`{"versions":{"2.0.0":{}}}`)))
+	expectBytes(t, "GetIndex", []byte(`{"versions":{"2.0.0":{}}}`))(s.GetIndex(ctx, hostname, namespace, providerType))
+
+	mustPut(t, s.PutArchive(ctx, archivePath, bytes.NewReader([]byte("a much longer first archive"))))
+	mustPut(t, s.PutArchive(ctx, archivePath, bytes.NewReader([]byte("second"))))
+	expectArchive(t, s, archivePath, []byte("second"))
+}
+
+// testIsolation checks that entries for different keys never collide
+func testIsolation(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	providers := [][3]string{
+		{hostname, namespace, providerType},
+		{"registry.example.com", namespace, providerType},
+		{hostname, "partner", providerType},
+		{hostname, namespace, "google"},
+	}
+	for _, p := range providers {
+		id := p[0] + "/" + p[1] + "/" + p[2]
+		mustPut(t, s.PutIndex(ctx, p[0], p[1], p[2], []byte("index "+id)))
+		mustPut(t, s.PutVersionsResponse(ctx, p[0], p[1], p[2], []byte("versions "+id)))
+		mustPut(t, s.PutVersion(ctx, p[0], p[1], p[2], "1.0.0", []byte("1.0.0 "+id)))
+		mustPut(t, s.PutVersion(ctx, p[0], p[1], p[2], "1.0.1", []byte("1.0.1 "+id)))
+		mustPut(t, s.PutArchive(ctx, p[0]+"/"+p[1]+"/"+p[2]+"/archive.zip", bytes.NewReader([]byte("archive "+id))))
+	}
+
+	for _, p := range providers {
+		id := p[0] + "/" + p[1] + "/" + p[2]
+		expectBytes(t, "GetIndex "+id, []byte("index "+id))(s.GetIndex(ctx, p[0], p[1], p[2]))
+		expectBytes(t, "GetVersionsResponse "+id, []byte("versions "+id))(s.GetVersionsResponse(ctx, p[0], p[1], p[2]))
+		expectBytes(t, "GetVersion 1.0.0 "+id, []byte("1.0.0 "+id))(s.GetVersion(ctx, p[0], p[1], p[2], "1.0.0"))
+		expectBytes(t, "GetVersion 1.0.1 "+id, []byte("1.0.1 "+id))(s.GetVersion(ctx, p[0], p[1], p[2], "1.0.1"))
+		expectArchive(t, s, p[0]+"/"+p[1]+"/"+p[2]+"/archive.zip", []byte("archive "+id))
+	}
+}
+
+// testAliasing checks that callers cannot modify stored entries through the slices they pass or receive
+func testAliasing(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	data := []byte(`{"versions":{}}`)
+	mustPut(t, s.PutIndex(ctx, hostname, namespace, providerType, data))
+	data[0] = 'X'
+
+	got, err := s.GetIndex(ctx, hostname, namespace, providerType)
+	if err != nil {
+		t.Fatalf("GetIndex failed: %v", err)
+	}
+	got[1] = 'X'
+	expectBytes(t, "GetIndex", []byte(`{"versions":{}}`))(s.GetIndex(ctx, hostname, namespace, providerType))
+}
+
+// testStreaming checks that large archives written in small chunks are stored intact
+func testStreaming(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	archive := make([]byte, 4<<20)
+	for i := range archive {
+		archive[i] = byte(i * 31)
+	}
+
+	mustPut(t, s.PutArchive(ctx, archivePath, &chunkedReader{data: archive, chunk: 1000}))
+	expectArchive(t, s, archivePath, archive)
+
+	// A failing reader must not leave a partial archive behind
+	failing := io.MultiReader(bytes.NewReader(archive[:1<<20]), errReader{})
+	if err := s.PutArchive(ctx, "failed/archive.zip", failing); err == nil {
+		t.Error("PutArchive with a failing reader: expected an error")
+	}
+	if _, err := s.GetArchive(ctx, "failed/archive.zip"); !storage.IsNotFound(err) {
+		t.Errorf("GetArchive after a failed PutArchive: expected storage.ErrNotFound, got %v", err)
+	}
+}
+
+// testConcurrency checks that concurrent readers and writers never observe partial entries
+// Archives are immutable, so concurrent writers of one path always store the same content
+func testConcurrency(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	shared := bytes.Repeat([]byte("shared"), 16<<10)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 64)
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v := fmt.Sprintf("1.0.%d", i)
+			own := bytes.Repeat([]byte(v), (i+1)<<10)
+			ownPath := fmt.Sprintf("%s/%s/%s/archive_%d.zip", hostname, namespace, providerType, i)
+			for range 10 {
+				if err := s.PutVersion(ctx, hostname, namespace, providerType, v, []byte(v)); err != nil {
+					errs <- fmt.Errorf("PutVersion %s: %w", v, err)
+					return
+				}
+				if err := s.PutArchive(ctx, archivePath, bytes.NewReader(shared)); err != nil {
+					errs <- fmt.Errorf("PutArchive: %w", err)
+					return
+				}
+				if err := s.PutArchive(ctx, ownPath, bytes.NewReader(own)); err != nil {
+					errs <- fmt.Errorf("PutArchive %s: %w", ownPath, err)
+					return
+				}
+				data, err := s.GetVersion(ctx, hostname, namespace, providerType, v)
+				if err != nil || string(data) != v {
+					errs <- fmt.Errorf("GetVersion %s returned %q, %v", v, data, err)
+					return
+				}
+				if err := readWhole(s, archivePath, shared); err != nil {
+					errs <- err
+					return
+				}
+				if err := readWhole(s, ownPath, own); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// testChecksumReporter checks reported checksums when the backend records them
+func testChecksumReporter(t *testing.T, s storage.Storage) {
+	reporter, ok := storage.As[storage.ChecksumReporter](s)
+	if !ok {
+		t.Skip("storage does not implement ChecksumReporter")
+	}
+	ctx := context.Background()
+
+	if _, err := reporter.ArchiveChecksum(ctx, archivePath); !storage.IsNotFound(err) {
+		t.Errorf("ArchiveChecksum on empty storage: expected storage.ErrNotFound, got %v", err)
+	}
+
+	archive := []byte("checksummed archive")
+	mustPut(t, s.PutArchive(ctx, archivePath, bytes.NewReader(archive)))
+	sum := sha256.Sum256(archive)
+	got, err := reporter.ArchiveChecksum(ctx, archivePath)
+	if err != nil || got != hex.EncodeToString(sum[:]) {
+		t.Errorf("ArchiveChecksum: expected %x, got %q, %v", sum, got, err)
+	}
+}
+
+// testModTimeReporter checks reported modification times when the backend tracks them
+func testModTimeReporter(t *testing.T, s storage.Storage) {
+	reporter, ok := storage.As[storage.ModTimeReporter](s)
+	if !ok {
+		t.Skip("storage does not implement ModTimeReporter")
+	}
+	ctx := context.Background()
+
+	if _, err := reporter.IndexModTime(ctx, hostname, namespace, providerType); !storage.IsNotFound(err) {
+		t.Errorf("IndexModTime on empty storage: expected storage.ErrNotFound, got %v", err)
+	}
+	if _, err := reporter.VersionModTime(ctx, hostname, namespace, providerType, version); !storage.IsNotFound(err) {
+		t.Errorf("VersionModTime on empty storage: expected storage.ErrNotFound, got %v", err)
+	}
+	if _, err := reporter.ArchiveModTime(ctx, archivePath); !storage.IsNotFound(err) {
+		t.Errorf("ArchiveModTime on empty storage: expected storage.ErrNotFound, got %v", err)
+	}
+
+	mustPut(t, s.PutIndex(ctx, hostname, namespace, providerType, []byte(`{}`)))
+	mustPut(t, s.PutVersion(ctx, hostname, namespace, providerType, version, []byte(`{}`)))
+	mustPut(t, s.PutArchive(ctx, archivePath, bytes.NewReader([]byte("archive"))))
+
+	if mt, err := reporter.IndexModTime(ctx, hostname, namespace, providerType); err != nil || mt.IsZero() {
+		t.Errorf("IndexModTime: expected a time, got %v, %v", mt, err)
+	}
+	if mt, err := reporter.VersionModTime(ctx, hostname, namespace, providerType, version); err != nil || mt.IsZero() {
+		t.Errorf("VersionModTime: expected a time, got %v, %v", mt, err)
+	}
+	if mt, err := reporter.ArchiveModTime(ctx, archivePath); err != nil || mt.IsZero() {
+		t.Errorf("ArchiveModTime: expected a time, got %v, %v", mt, err)
+	}
+}
+
+// testListProviders checks that providers are listed once their index is cached
+func testListProviders(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	if providers, err := s.ListProviders(ctx); err != nil || len(providers) != 0 {
+		t.Errorf("ListProviders on empty storage: expected none, got %v, %v", providers, err)
+	}
+
+	mustPut(t, s.PutIndex(ctx, hostname, namespace, providerType, []byte(`{}`)))
+	mustPut(t, s.PutIndex(ctx, hostname, namespace, "random", []byte(`{}`)))
+	mustPut(t, s.PutVersion(ctx, hostname, "other", providerType, version, []byte(`{}`)))
+	mustPut(t, s.PutVersionsResponse(ctx, hostname, "other", providerType, []byte(`{}`)))
+	mustPut(t, s.PutArchive(ctx, archivePath, bytes.NewReader([]byte("archive"))))
+
+	want := []storage.Provider{
+		{Hostname: hostname, Namespace: namespace, Type: providerType},
+		{Hostname: hostname, Namespace: namespace, Type: "random"},
+	}
+	providers, err := s.ListProviders(ctx)
+	if err != nil || !slices.Equal(providers, want) {
+		t.Errorf("ListProviders: expected %v, got %v, %v", want, providers, err)
+	}
+}
+
+// testDelete checks that deleted entries are gone and that deleting missing entries succeeds
+func testDelete(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	if err := s.DeleteIndex(ctx, hostname, namespace, providerType); err != nil {
+		t.Errorf("DeleteIndex on empty storage: %v", err)
+	}
+	if err := s.DeleteVersion(ctx, hostname, namespace, providerType, version); err != nil {
+		t.Errorf("DeleteVersion on empty storage: %v", err)
+	}
+	if err := s.DeleteArchive(ctx, archivePath); err != nil {
+		t.Errorf("DeleteArchive on empty storage: %v", err)
+	}
+
+	mustPut(t, s.PutIndex(ctx, hostname, namespace, providerType, []byte(`{}`)))
+	mustPut(t, s.PutVersionsResponse(ctx, hostname, namespace, providerType, []byte(`{}`)))
+	mustPut(t, s.PutVersion(ctx, hostname, namespace, providerType, version, []byte(`{}`)))
+	mustPut(t, s.PutVersion(ctx, hostname, namespace, providerType, "6.27.0", []byte(`{}`)))
+	mustPut(t, s.PutArchive(ctx, archivePath, bytes.NewReader([]byte("archive"))))
+
+	if err := s.DeleteIndex(ctx, hostname, namespace, providerType); err != nil {
+		t.Fatalf("DeleteIndex failed: %v", err)
+	}
+	if _, err := s.GetIndex(ctx, hostname, namespace, providerType); !storage.IsNotFound(err) {
+		t.Errorf("GetIndex after DeleteIndex: expected storage.ErrNotFound, got %v", err)
+	}
+	if _, err := s.GetVersionsResponse(ctx, hostname, namespace, providerType); !storage.IsNotFound(err) {
+		t.Errorf("GetVersionsResponse after DeleteIndex: expected storage.ErrNotFound, got %v", err)
+	}
+
+	if err := s.DeleteVersion(ctx, hostname, namespace, providerType, version); err != nil {
+		t.Fatalf("DeleteVersion failed: %v", err)
+	}
+	if _, err := s.GetVersion(ctx, hostname, namespace, providerType, version); !storage.IsNotFound(err) {
+		t.Errorf("GetVersion after DeleteVersion: expected storage.ErrNotFound, got %v", err)
+	}
+	expectBytes(t, "GetVersion of another version", []byte(`{}`))(s.GetVersion(ctx, hostname, namespace, providerType, "6.27.0"))
+
+	if err := s.DeleteArchive(ctx, archivePath); err != nil {
+		t.Fatalf("DeleteArchive failed: %v", err)
+	}
+	if _, err := s.GetArchive(ctx, archivePath); !storage.IsNotFound(err) {
+		t.Errorf("GetArchive after DeleteArchive: expected storage.ErrNotFound, got %v", err)
+	}
+	if exists, err := s.ExistsArchive(ctx, archivePath); err != nil || exists {
+		t.Errorf("ExistsArchive after DeleteArchive: expected false, nil, got %v, %v", exists, err)
+	}
+	if reporter, ok := storage.As[storage.ChecksumReporter](s); ok {
+		if _, err := reporter.ArchiveChecksum(ctx, archivePath); !storage.IsNotFound(err) {
+			t.Errorf("ArchiveChecksum after DeleteArchive: expected storage.ErrNotFound, got %v", err)
+		}
+	}
+}
+
+// testPurgeProvider checks that purging a provider removes its entries and nothing else
+func testPurgeProvider(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	providerArchive := hostname + "/" + namespace + "/" + providerType + "/terraform-provider-aws_6.26.0_linux_amd64.zip"
+	otherArchive := hostname + "/" + namespace + "/" + providerType + "2/terraform-provider-aws2_1.0.0_linux_amd64.zip"
+
+	for _, pt := range []string{providerType, providerType + "2"} {
+		mustPut(t, s.PutIndex(ctx, hostname, namespace, pt, []byte(`{}`)))
+		mustPut(t, s.PutVersionsResponse(ctx, hostname, namespace, pt, []byte(`{}`)))
+		mustPut(t, s.PutVersion(ctx, hostname, namespace, pt, version, []byte(`{}`)))
+	}
+	mustPut(t, s.PutArchive(ctx, providerArchive, bytes.NewReader([]byte("archive"))))
+	mustPut(t, s.PutArchive(ctx, otherArchive, bytes.NewReader([]byte("other archive"))))
+
+	if err := s.PurgeProvider(ctx, hostname, namespace, providerType); err != nil {
+		t.Fatalf("PurgeProvider failed: %v", err)
+	}
+	if _, err := s.GetIndex(ctx, hostname, namespace, providerType); !storage.IsNotFound(err) {
+		t.Errorf("GetIndex after PurgeProvider: expected storage.ErrNotFound, got %v", err)
+	}
+	if _, err := s.GetVersionsResponse(ctx, hostname, namespace, providerType); !storage.IsNotFound(err) {
+		t.Errorf("GetVersionsResponse after PurgeProvider: expected storage.ErrNotFound, got %v", err)
+	}
+	if _, err := s.GetVersion(ctx, hostname, namespace, providerType, version); !storage.IsNotFound(err) {
+		t.Errorf("GetVersion after PurgeProvider: expected storage.ErrNotFound, got %v", err)
+	}
+	if exists, err := s.ExistsArchive(ctx, providerArchive); err != nil || exists {
+		t.Errorf("ExistsArchive after PurgeProvider: expected false, nil, got %v, %v", exists, err)
+	}
+
+	// A provider whose name starts with the purged one is left alone
+	expectBytes(t, "GetIndex of another provider", []byte(`{}`))(s.GetIndex(ctx, hostname, namespace, providerType+"2"))
+	expectBytes(t, "GetVersion of another provider", []byte(`{}`))(s.GetVersion(ctx, hostname, namespace, providerType+"2", version))
+	expectArchive(t, s, otherArchive, []byte("other archive"))
+
+	if err := s.PurgeProvider(ctx, hostname, namespace, providerType); err != nil {
+		t.Errorf("PurgeProvider of a purged provider: %v", err)
+	}
+}
+
+// testListVersions checks that versions are listed once their version.json is cached
+func testListVersions(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	if versions, err := s.ListVersions(ctx, hostname, namespace, providerType); err != nil || len(versions) != 0 {
+		t.Errorf("ListVersions on empty storage: expected none, got %v, %v", versions, err)
+	}
+
+	mustPut(t, s.PutIndex(ctx, hostname, namespace, providerType, []byte(`{}`)))
+	mustPut(t, s.PutVersion(ctx, hostname, namespace, providerType, "6.27.0", []byte(`{}`)))
+	mustPut(t, s.PutVersion(ctx, hostname, namespace, providerType, version, []byte(`{}`)))
+	mustPut(t, s.PutVersion(ctx, hostname, namespace, providerType+"2", "1.0.0", []byte(`{}`)))
+	mustPut(t, s.PutArchive(ctx, hostname+"/"+namespace+"/"+providerType+"/terraform-provider-aws_6.26.0_linux_amd64.zip", bytes.NewReader([]byte("archive"))))
+
+	want := []string{version, "6.27.0"}
+	versions, err := s.ListVersions(ctx, hostname, namespace, providerType)
+	if err != nil || !slices.Equal(versions, want) {
+		t.Errorf("ListVersions: expected %v, got %v, %v", want, versions, err)
+	}
+}
+
+// testStatArchive checks the reported size and modification time of archives
+func testStatArchive(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	if _, err := s.StatArchive(ctx, archivePath); !storage.IsNotFound(err) {
+		t.Errorf("StatArchive on empty storage: expected storage.ErrNotFound, got %v", err)
+	}
+
+	mustPut(t, s.PutArchive(ctx, archivePath, bytes.NewReader([]byte("archive"))))
+	info, err := s.StatArchive(ctx, archivePath)
+	if err != nil || info.Size != int64(len("archive")) || info.ModTime.IsZero() {
+		t.Errorf("StatArchive: expected %d bytes and a time, got %+v, %v", len("archive"), info, err)
+	}
+}
+
+func mustPut(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+}
+
+// expectBytes returns a checker for the results of a metadata Get call
+func expectBytes(t *testing.T, op string, want []byte) func([]byte, error) {
+	t.Helper()
+	return func(got []byte, err error) {
+		t.Helper()
+		if err != nil {
+			t.Errorf("%s failed: %v", op, err)
+			return
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s returned %q, want %q", op, truncate(got), truncate(want))
+		}
+	}
+}
+
+// expectArchive reads an archive and compares it with want
+func expectArchive(t *testing.T, s storage.Storage, path string, want []byte) {
+	t.Helper()
+	reader, err := s.GetArchive(context.Background(), path)
+	if err != nil {
+		t.Errorf("GetArchive %s failed: %v", path, err)
+		return
+	}
+	defer reader.Close()
+	got, err := io.ReadAll(reader)
+	if err != nil {
+		t.Errorf("reading archive %s failed: %v", path, err)
+		return
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("GetArchive %s returned %q, want %q", path, truncate(got), truncate(want))
+	}
+}
+
+// readWhole reads an archive and checks that it is complete
+func readWhole(s storage.Storage, path string, want []byte) error {
+	reader, err := s.GetArchive(context.Background(), path)
+	if err != nil {
+		return fmt.Errorf("GetArchive: %w", err)
+	}
+	defer reader.Close()
+	got, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("reading archive: %w", err)
+	}
+	if !bytes.Equal(got, want) {
+		return fmt.Errorf("GetArchive %s returned %d bytes, want %d", path, len(got), len(want))
+	}
+	return nil
+}
+
+// truncate shortens data for error messages
+func truncate(data []byte) []byte {
+	if len(data) > 64 {
+		return append(data[:64:64], "..."...)
+	}
+	return data
+}
+
+// chunkedReader returns data in reads of at most chunk bytes
+type chunkedReader struct {
+	data  []byte
+	chunk int
+}
+
+func (r *chunkedReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	n := min(len(p), r.chunk, len(r.data))
+	copy(p, r.data[:n])
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// errReader fails every read
+type errReader struct{}
+
+func (errReader) Read(p []byte) (int, error) {
+	return 0, errors.New("read failed")
+}
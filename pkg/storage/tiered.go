@@ -0,0 +1,280 @@
+package storage
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Tiered keeps recently read index, version and versions API responses, and optionally small archives,
+// in an LRU memory layer in front of another backend. Every write goes through to the backend, which
+// stays the source of truth, so the memory layer only saves reads. It assumes no other process writes
+// the backend's metadata, entries are only replaced through the Tiered storage itself
+type Tiered struct {
+	backend Storage
+	// maxBytes caps the size of the data held in memory
+	maxBytes int64
+	// maxArchiveSize is the size up to which archives are kept in memory, zero keeps none
+	maxArchiveSize int64
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// lru holds *tieredEntry values, most recently used first
+	lru  *list.List
+	size int64
+}
+
+type tieredEntry struct {
+	key  string
+	data []byte
+}
+
+// NewTiered creates a storage keeping up to maxBytes of recently read metadata in memory in front of backend
+func NewTiered(backend Storage, maxBytes int64) *Tiered {
+	return &Tiered{
+		backend:  backend,
+		maxBytes: maxBytes,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// SetMaxArchiveSize keeps archives of up to size bytes in memory as well, zero keeps none
+// Must be called before the storage is used
+func (t *Tiered) SetMaxArchiveSize(size int64) {
+	t.maxArchiveSize = size
+}
+
+// Unwrap returns the backend underneath the memory layer
+func (t *Tiered) Unwrap() Storage {
+	return t.backend
+}
+
+// As finds the first storage in the chain of wrapped backends implementing T, like errors.As
+// Wrapping backends expose what they wrap with an Unwrap method
+func As[T any](s Storage) (T, bool) {
+	for s != nil {
+		if target, ok := s.(T); ok {
+			return target, true
+		}
+		wrapper, ok := s.(interface{ Unwrap() Storage })
+		if !ok {
+			break
+		}
+		s = wrapper.Unwrap()
+	}
+	var zero T
+	return zero, false
+}
+
+// Len returns the number of entries and bytes held in memory
+func (t *Tiered) Len() (entries int, bytes int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.lru.Len(), t.size
+}
+
+// GetIndex retrieves the cached index.json for a provider
+func (t *Tiered) GetIndex(ctx context.Context, hostname, namespace, providerType string) ([]byte, error) {
+	return t.getMetadata(indexKey(hostname, namespace, providerType), func() ([]byte, error) {
+		return t.backend.GetIndex(ctx, hostname, namespace, providerType)
+	})
+}
+
+// PutIndex stores the index.json for a provider
+func (t *Tiered) PutIndex(ctx context.Context, hostname, namespace, providerType string, data []byte) error {
+	return t.putMetadata(indexKey(hostname, namespace, providerType), data, func() error {
+		return t.backend.PutIndex(ctx, hostname, namespace, providerType, data)
+	})
+}
+
+// GetVersion retrieves the cached version.json for a specific provider version
+func (t *Tiered) GetVersion(ctx context.Context, hostname, namespace, providerType, version string) ([]byte, error) {
+	return t.getMetadata(versionKey(hostname, namespace, providerType, version), func() ([]byte, error) {
+		return t.backend.GetVersion(ctx, hostname, namespace, providerType, version)
+	})
+}
+
+// PutVersion stores the version.json for a specific provider version
+func (t *Tiered) PutVersion(ctx context.Context, hostname, namespace, providerType, version string, data []byte) error {
+	return t.putMetadata(versionKey(hostname, namespace, providerType, version), data, func() error {
+		return t.backend.PutVersion(ctx, hostname, namespace, providerType, version, data)
+	})
+}
+
+// GetVersionsResponse retrieves the cached full versions API response
+func (t *Tiered) GetVersionsResponse(ctx context.Context, hostname, namespace, providerType string) ([]byte, error) {
+	return t.getMetadata(versionsResponseKey(hostname, namespace, providerType), func() ([]byte, error) {
+		return t.backend.GetVersionsResponse(ctx, hostname, namespace, providerType)
+	})
+}
+
+// PutVersionsResponse stores the full versions API response
+func (t *Tiered) PutVersionsResponse(ctx context.Context, hostname, namespace, providerType string, data []byte) error {
+	return t.putMetadata(versionsResponseKey(hostname, namespace, providerType), data, func() error {
+		return t.backend.PutVersionsResponse(ctx, hostname, namespace, providerType, data)
+	})
+}
+
+// GetArchive retrieves a cached provider archive, from memory when it is small enough to be kept there
+func (t *Tiered) GetArchive(ctx context.Context, path string) (io.ReadCloser, error) {
+	key := archiveKey(path)
+	if data, ok := t.get(key); ok {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	rc, err := t.backend.GetArchive(ctx, path)
+	if err != nil || t.maxArchiveSize <= 0 {
+		return rc, err
+	}
+
+	// Read one byte past the limit to tell small archives from large ones
+	head, err := io.ReadAll(io.LimitReader(rc, t.maxArchiveSize+1))
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	if int64(len(head)) > t.maxArchiveSize {
+		return struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(head), rc), rc}, nil
+	}
+	rc.Close()
+	t.add(key, head)
+	return io.NopCloser(bytes.NewReader(head)), nil
+}
+
+// PutArchive stores a provider archive, replacing any copy held in memory
+func (t *Tiered) PutArchive(ctx context.Context, path string, data io.Reader) error {
+	t.remove(archiveKey(path))
+	return t.backend.PutArchive(ctx, path, data)
+}
+
+// ExistsArchive checks if an archive exists
+func (t *Tiered) ExistsArchive(ctx context.Context, path string) (bool, error) {
+	if _, ok := t.get(archiveKey(path)); ok {
+		return true, nil
+	}
+	return t.backend.ExistsArchive(ctx, path)
+}
+
+// DeleteIndex removes the cached index.json and versions API response of a provider
+func (t *Tiered) DeleteIndex(ctx context.Context, hostname, namespace, providerType string) error {
+	t.remove(indexKey(hostname, namespace, providerType))
+	t.remove(versionsResponseKey(hostname, namespace, providerType))
+	return t.backend.DeleteIndex(ctx, hostname, namespace, providerType)
+}
+
+// DeleteVersion removes the cached version.json for a specific provider version
+func (t *Tiered) DeleteVersion(ctx context.Context, hostname, namespace, providerType, version string) error {
+	t.remove(versionKey(hostname, namespace, providerType, version))
+	return t.backend.DeleteVersion(ctx, hostname, namespace, providerType, version)
+}
+
+// DeleteArchive removes a cached provider archive
+func (t *Tiered) DeleteArchive(ctx context.Context, path string) error {
+	t.remove(archiveKey(path))
+	return t.backend.DeleteArchive(ctx, path)
+}
+
+// PurgeProvider removes every cached index, version and archive of a provider
+func (t *Tiered) PurgeProvider(ctx context.Context, hostname, namespace, providerType string) error {
+	prefixes := []string{
+		versionKey(hostname, namespace, providerType, ""),
+		archiveKey(hostname + "/" + namespace + "/" + providerType + "/"),
+	}
+	t.mu.Lock()
+	t.removeLocked(indexKey(hostname, namespace, providerType))
+	t.removeLocked(versionsResponseKey(hostname, namespace, providerType))
+	for key := range t.entries {
+		if slices.ContainsFunc(prefixes, func(prefix string) bool { return strings.HasPrefix(key, prefix) }) {
+			t.removeLocked(key)
+		}
+	}
+	t.mu.Unlock()
+	return t.backend.PurgeProvider(ctx, hostname, namespace, providerType)
+}
+
+// ListProviders returns every provider with a cached index.json, sorted
+func (t *Tiered) ListProviders(ctx context.Context) ([]Provider, error) {
+	return t.backend.ListProviders(ctx)
+}
+
+// ListVersions returns the versions of a provider with a cached version.json, sorted by name
+func (t *Tiered) ListVersions(ctx context.Context, hostname, namespace, providerType string) ([]string, error) {
+	return t.backend.ListVersions(ctx, hostname, namespace, providerType)
+}
+
+// StatArchive returns the size and modification time of a cached archive
+func (t *Tiered) StatArchive(ctx context.Context, path string) (ArchiveInfo, error) {
+	return t.backend.StatArchive(ctx, path)
+}
+
+func (t *Tiered) getMetadata(key string, load func() ([]byte, error)) ([]byte, error) {
+	if data, ok := t.get(key); ok {
+		return bytes.Clone(data), nil
+	}
+	data, err := load()
+	if err != nil {
+		return nil, err
+	}
+	t.add(key, bytes.Clone(data))
+	return data, nil
+}
+
+// putMetadata writes through to the backend, a failed write drops the entry so it is read again from the backend
+func (t *Tiered) putMetadata(key string, data []byte, store func() error) error {
+	if err := store(); err != nil {
+		t.remove(key)
+		return err
+	}
+	t.add(key, bytes.Clone(data))
+	return nil
+}
+
+func (t *Tiered) get(key string) ([]byte, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	elem, ok := t.entries[key]
+	if !ok {
+		return nil, false
+	}
+	t.lru.MoveToFront(elem)
+	return elem.Value.(*tieredEntry).data, true
+}
+
+// add stores an entry as the most recently used one, evicting the least recently used until it fits
+// Entries larger than the whole memory layer are not kept
+func (t *Tiered) add(key string, data []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.removeLocked(key)
+	if int64(len(data)) > t.maxBytes {
+		return
+	}
+	t.entries[key] = t.lru.PushFront(&tieredEntry{key: key, data: data})
+	t.size += int64(len(data))
+	for t.size > t.maxBytes {
+		t.removeLocked(t.lru.Back().Value.(*tieredEntry).key)
+	}
+}
+
+func (t *Tiered) remove(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.removeLocked(key)
+}
+
+func (t *Tiered) removeLocked(key string) {
+	elem, ok := t.entries[key]
+	if !ok {
+		return
+	}
+	t.lru.Remove(elem)
+	delete(t.entries, key)
+	t.size -= int64(len(elem.Value.(*tieredEntry).data))
+}
@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+// countingStorage counts the reads reaching the wrapped memory storage
+type countingStorage struct {
+	*MemoryStorage
+	indexReads   int
+	archiveReads int
+}
+
+func (c *countingStorage) GetIndex(ctx context.Context, hostname, namespace, providerType string) ([]byte, error) {
+	c.indexReads++
+	return c.MemoryStorage.GetIndex(ctx, hostname, namespace, providerType)
+}
+
+func (c *countingStorage) GetArchive(ctx context.Context, path string) (io.ReadCloser, error) {
+	c.archiveReads++
+	return c.MemoryStorage.GetArchive(ctx, path)
+}
+
+func TestTiered_ServesMetadataFromMemory(t *testing.T) {
+	ctx := context.Background()
+	backend := &countingStorage{MemoryStorage: NewMemoryStorage()}
+	backend.PutIndex(ctx, "registry.terraform.io", "hashicorp", "aws", []byte(`{"versions":{}}`))
+	tiered := NewTiered(backend, 1024)
+
+	for range 3 {
+		data, err := tiered.GetIndex(ctx, "registry.terraform.io", "hashicorp", "aws")
+		if err != nil || string(data) != `{"versions":{}}` {
+			t.Fatalf("GetIndex = %s, %v", data, err)
+		}
+		data[0] = 'x'
+	}
+	if backend.indexReads != 1 {
+		t.Errorf("expected the backend to be read once, got %d reads", backend.indexReads)
+	}
+
+	if err := tiered.PutIndex(ctx, "registry.terraform.io", "hashicorp", "aws", []byte(`{"versions":{"1.0.0":{}}}`)); err != nil {
+		t.Fatalf("PutIndex failed: %v", err)
+	}
+	if data, _ := tiered.GetIndex(ctx, "registry.terraform.io", "hashicorp", "aws"); string(data) != `{"versions":{"1.0.0":{}}}` {
+		t.Errorf("expected the replaced index, got %s", data)
+	}
+	if data, _ := backend.MemoryStorage.GetIndex(ctx, "registry.terraform.io", "hashicorp", "aws"); string(data) != `{"versions":{"1.0.0":{}}}` {
+		t.Errorf("expected the write to reach the backend, got %s", data)
+	}
+	if backend.indexReads != 1 {
+		t.Errorf("expected writes to update the memory tier, got %d backend reads", backend.indexReads)
+	}
+
+	if _, err := tiered.GetIndex(ctx, "registry.terraform.io", "hashicorp", "google"); !IsNotFound(err) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestTiered_EvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	backend := &countingStorage{MemoryStorage: NewMemoryStorage()}
+	tiered := NewTiered(backend, 20)
+
+	for _, providerType := range []string{"aws", "google", "null"} {
+		tiered.PutIndex(ctx, "registry.terraform.io", "hashicorp", providerType, []byte("0123456789"))
+		// Reading aws keeps it recently used, so google is evicted when null is added
+		tiered.GetIndex(ctx, "registry.terraform.io", "hashicorp", "aws")
+	}
+	if entries, size := tiered.Len(); entries != 2 || size != 20 {
+		t.Errorf("expected 2 entries of 20 bytes, got %d entries of %d bytes", entries, size)
+	}
+
+	backend.indexReads = 0
+	tiered.GetIndex(ctx, "registry.terraform.io", "hashicorp", "aws")
+	tiered.GetIndex(ctx, "registry.terraform.io", "hashicorp", "null")
+	if backend.indexReads != 0 {
+		t.Errorf("expected aws and null in memory, got %d backend reads", backend.indexReads)
+	}
+	tiered.GetIndex(ctx, "registry.terraform.io", "hashicorp", "google")
+	if backend.indexReads != 1 {
+		t.Errorf("expected google to be evicted, got %d backend reads", backend.indexReads)
+	}
+
+	tiered.PutIndex(ctx, "registry.terraform.io", "hashicorp", "big", make([]byte, 21))
+	if entries, size := tiered.Len(); entries != 2 || size != 20 {
+		t.Errorf("expected entries larger than the tier to be skipped, got %d entries of %d bytes", entries, size)
+	}
+}
+
+func TestTiered_Archives(t *testing.T) {
+	ctx := context.Background()
+	backend := &countingStorage{MemoryStorage: NewMemoryStorage()}
+	tiered := NewTiered(backend, 1024)
+	tiered.SetMaxArchiveSize(8)
+	tiered.PutArchive(ctx, "small.zip", strings.NewReader("small"))
+	tiered.PutArchive(ctx, "large.zip", strings.NewReader("much larger archive"))
+
+	for range 2 {
+		for path, want := range map[string]string{"small.zip": "small", "large.zip": "much larger archive"} {
+			rc, err := tiered.GetArchive(ctx, path)
+			if err != nil {
+				t.Fatalf("GetArchive(%s) failed: %v", path, err)
+			}
+			data, _ := io.ReadAll(rc)
+			rc.Close()
+			if string(data) != want {
+				t.Errorf("GetArchive(%s) = %q, want %q", path, data, want)
+			}
+		}
+	}
+	// The small archive is read once, the large one on every request
+	if backend.archiveReads != 3 {
+		t.Errorf("expected 3 backend archive reads, got %d", backend.archiveReads)
+	}
+
+	tiered.PutArchive(ctx, "small.zip", strings.NewReader("newer"))
+	rc, _ := tiered.GetArchive(ctx, "small.zip")
+	data, _ := io.ReadAll(rc)
+	if !bytes.Equal(data, []byte("newer")) {
+		t.Errorf("expected the replaced archive, got %q", data)
+	}
+}
+
+func TestAs(t *testing.T) {
+	fs, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+	tiered := NewTiered(fs, 1024)
+
+	if reporter, ok := As[ModTimeReporter](tiered); !ok || reporter != ModTimeReporter(fs) {
+		t.Errorf("expected the filesystem storage to be found under the memory tier")
+	}
+	if _, ok := As[ArchiveURLSigner](tiered); ok {
+		t.Errorf("expected no ArchiveURLSigner in the chain")
+	}
+	if _, ok := As[*Tiered](tiered); !ok {
+		t.Errorf("expected the outer storage to match first")
+	}
+}
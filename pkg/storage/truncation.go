@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sizeSuffix is appended to an archive path to form its size sidecar file
+const sizeSuffix = ".size"
+
+// archiveSidecars lists the suffixes of files stored next to each archive
+var archiveSidecars = []string{checksumSuffix, sizeSuffix, hashesSuffix, metaSuffix}
+
+// staleTempAge is how old a temporary file must be before garbage collection removes it
+// Younger files may belong to a write still in progress
+const staleTempAge = time.Hour
+
+// GarbageCollector is implemented by storage backends that can clean up leftovers of failed writes
+type GarbageCollector interface {
+	// CollectGarbage removes leftovers of failed writes while the storage is in use
+	// It returns the number of files removed
+	CollectGarbage(ctx context.Context) (int, error)
+}
+
+// ErrArchiveTruncated is returned when a cached archive is smaller or larger than the size recorded when it was written
+var ErrArchiveTruncated = errors.New("archive size mismatch")
+
+// checkArchiveSize compares an archive with its recorded size
+// Mismatching archives are removed so the next request fetches them again
+// Archives without a recorded size are assumed to be intact
+func (fs *FilesystemStorage) checkArchiveSize(fullPath string) error {
+	expected, err := readSize(fullPath)
+	if err != nil {
+		return nil
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return nil
+	}
+	if info.Size() == expected {
+		return nil
+	}
+
+	slog.Error("cached archive is truncated, removing it",
+		"path", fullPath, "expected_bytes", expected, "actual_bytes", info.Size())
+	fs.removeArchive(fullPath)
+	return fmt.Errorf("%w: %s", ErrArchiveTruncated, filepath.Base(fullPath))
+}
+
+// PurgeTruncated removes leftovers of interrupted writes from the cache directory:
+// temporary files and archives whose size does not match the recorded one
+// With shared locks other instances may be writing, so only temporary files older than an hour are removed
+// Must be called before the storage is used, it returns the number of files removed
+func (fs *FilesystemStorage) PurgeTruncated(ctx context.Context) (int, error) {
+	if fs.lockTTL > 0 {
+		return fs.purge(ctx, staleTempAge)
+	}
+	return fs.purge(ctx, 0)
+}
+
+// CollectGarbage removes temporary files older than an hour and archives whose size
+// does not match the recorded one. Unlike PurgeTruncated it is safe while the storage is in use
+func (fs *FilesystemStorage) CollectGarbage(ctx context.Context) (int, error) {
+	return fs.purge(ctx, staleTempAge)
+}
+
+// purge removes temporary files older than minTempAge and truncated archives
+func (fs *FilesystemStorage) purge(ctx context.Context, minTempAge time.Duration) (int, error) {
+	removed := 0
+	err := fs.walkRoots(func(_, path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		name := d.Name()
+		if strings.HasPrefix(name, ".tmp-") {
+			if minTempAge > 0 {
+				info, err := d.Info()
+				if err != nil || time.Since(info.ModTime()) < minTempAge {
+					return nil
+				}
+			}
+			if os.Remove(path) == nil {
+				slog.Info("removed leftover temporary file", "path", path)
+				removed++
+			}
+			return nil
+		}
+		if !strings.HasSuffix(name, sizeSuffix) {
+			return nil
+		}
+		if errors.Is(fs.checkArchiveSize(strings.TrimSuffix(path, sizeSuffix)), ErrArchiveTruncated) {
+			removed++
+		}
+		return nil
+	})
+	if err != nil {
+		return removed, fmt.Errorf("failed to scan cache directory: %w", err)
+	}
+	return removed, nil
+}
+
+// removeArchive deletes an archive and its sidecar files
+func (fs *FilesystemStorage) removeArchive(fullPath string) {
+	fs.catalogRemove(fullPath)
+	fs.uncountArchive(fullPath)
+	os.Remove(fullPath)
+	for _, suffix := range archiveSidecars {
+		os.Remove(fullPath + suffix)
+	}
+}
+
+// readSize reads the size sidecar of an archive
+func readSize(fullPath string) (int64, error) {
+	data, err := os.ReadFile(fullPath + sizeSuffix)
+	if err != nil {
+		return 0, err
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size file for %s: %w", filepath.Base(fullPath), err)
+	}
+	return size, nil
+}
+
+// writeSize atomically writes the size sidecar of an archive
+func writeSize(fullPath string, size int64) error {
+	if err := writeSidecar(fullPath+sizeSuffix, strconv.FormatInt(size, 10)+"\n"); err != nil {
+		return fmt.Errorf("failed to write size: %w", err)
+	}
+	return nil
+}
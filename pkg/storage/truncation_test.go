@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetArchive_Truncated(t *testing.T) {
+	fs, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+
+	ctx := context.Background()
+	path := "registry.terraform.io/hashicorp/aws/aws.zip"
+	if err := fs.PutArchive(ctx, path, strings.NewReader("complete archive")); err != nil {
+		t.Fatalf("PutArchive failed: %v", err)
+	}
+	if size, err := readSize(fs.archivePath(path)); err != nil || size != 16 {
+		t.Fatalf("expected recorded size 16, got %d, %v", size, err)
+	}
+
+	if err := os.Truncate(fs.archivePath(path), 8); err != nil {
+		t.Fatalf("failed to truncate archive: %v", err)
+	}
+	if _, err := fs.GetArchive(ctx, path); !errors.Is(err, ErrArchiveTruncated) {
+		t.Fatalf("expected ErrArchiveTruncated, got %v", err)
+	}
+	for _, suffix := range []string{"", checksumSuffix, sizeSuffix} {
+		if _, err := os.Stat(fs.archivePath(path) + suffix); !os.IsNotExist(err) {
+			t.Errorf("expected %q to be removed", filepath.Base(path)+suffix)
+		}
+	}
+	if _, err := fs.GetArchive(ctx, path); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound after removal, got %v", err)
+	}
+}
+
+func TestPurgeTruncated(t *testing.T) {
+	fs, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+
+	ctx := context.Background()
+	intact := "registry.terraform.io/hashicorp/aws/intact.zip"
+	truncated := "registry.terraform.io/hashicorp/aws/truncated.zip"
+	for _, path := range []string{intact, truncated} {
+		if err := fs.PutArchive(ctx, path, strings.NewReader("archive data")); err != nil {
+			t.Fatalf("PutArchive failed: %v", err)
+		}
+	}
+	if err := os.Truncate(fs.archivePath(truncated), 3); err != nil {
+		t.Fatalf("failed to truncate archive: %v", err)
+	}
+	leftover := filepath.Join(filepath.Dir(fs.archivePath(intact)), ".tmp-12345")
+	if err := os.WriteFile(leftover, []byte("partial"), 0644); err != nil {
+		t.Fatalf("failed to write temporary file: %v", err)
+	}
+
+	removed, err := fs.PurgeTruncated(ctx)
+	if err != nil {
+		t.Fatalf("PurgeTruncated failed: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("expected 2 removals, got %d", removed)
+	}
+	if exists, _ := fs.ExistsArchive(ctx, truncated); exists {
+		t.Error("truncated archive should be removed")
+	}
+	if exists, _ := fs.ExistsArchive(ctx, intact); !exists {
+		t.Error("intact archive should be kept")
+	}
+	if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+		t.Error("leftover temporary file should be removed")
+	}
+}
+
+func TestCollectGarbage(t *testing.T) {
+	fs, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemStorage failed: %v", err)
+	}
+
+	ctx := context.Background()
+	truncated := "registry.terraform.io/hashicorp/aws/truncated.zip"
+	if err := fs.PutArchive(ctx, truncated, strings.NewReader("archive data")); err != nil {
+		t.Fatalf("PutArchive failed: %v", err)
+	}
+	if err := os.Truncate(fs.archivePath(truncated), 3); err != nil {
+		t.Fatalf("failed to truncate archive: %v", err)
+	}
+
+	dir := filepath.Dir(fs.archivePath(truncated))
+	stale := filepath.Join(dir, ".tmp-stale")
+	inProgress := filepath.Join(dir, ".tmp-in-progress")
+	for _, path := range []string{stale, inProgress} {
+		if err := os.WriteFile(path, []byte("partial"), 0644); err != nil {
+			t.Fatalf("failed to write temporary file: %v", err)
+		}
+	}
+	old := time.Now().Add(-2 * staleTempAge)
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatalf("failed to age temporary file: %v", err)
+	}
+
+	removed, err := fs.CollectGarbage(ctx)
+	if err != nil {
+		t.Fatalf("CollectGarbage failed: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("expected 2 removals, got %d", removed)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("stale temporary file should be removed")
+	}
+	if _, err := os.Stat(inProgress); err != nil {
+		t.Error("recent temporary file should be kept, it may belong to a write in progress")
+	}
+}